@@ -15,18 +15,21 @@
 package appservice
 
 import (
+	"reflect"
+
 	"github.com/finogeeks/ligase/appservice/consumers"
 	"github.com/finogeeks/ligase/appservice/types"
 	"github.com/finogeeks/ligase/appservice/workers"
+	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/skunkworks/log"
-	"sync"
 )
 
 // SetupApplicationServiceComponent sets up
 // 因为roomserver 的api实现不全 要查房间别名的时候需要databse
 // 正常应该使用api访问来实现
-func SetupApplicationServiceComponent(base *basecomponent.BaseDendrite) {
+func SetupApplicationServiceComponent(base *basecomponent.BaseDendrite, rpcClient *common.RpcClient) {
 	applicationServiceDB := base.CreateApplicationServiceDB()
 	roomserverDB := base.CreateRoomDB()
 
@@ -34,15 +37,7 @@ func SetupApplicationServiceComponent(base *basecomponent.BaseDendrite) {
 	// a sync.Cond object that can be used to notify workers when there are new
 	// events to be sent out.
 	// 每一个appservice 对应 一个 worker
-	workerStates := make([]types.ApplicationServiceWorkerState, len(base.Cfg.Derived.ApplicationServices))
-	for i, appservice := range base.Cfg.Derived.ApplicationServices {
-		m := sync.Mutex{}
-		ws := types.ApplicationServiceWorkerState{
-			AppService: appservice,
-			Cond:       sync.NewCond(&m),
-		}
-		workerStates[i] = ws
-	}
+	workerStates := types.NewWorkerStates(base.Cfg.Derived.ApplicationServices)
 
 	consumer := consumers.NewOutputRoomEventConsumer(base.Cfg, applicationServiceDB, roomserverDB,
 		workerStates)
@@ -51,8 +46,25 @@ func SetupApplicationServiceComponent(base *basecomponent.BaseDendrite) {
 		log.Panicw("failed to start room server consumer", log.KeysAndValues{"error", err})
 	}
 
+	ephemeralConsumer := consumers.NewEphemeralConsumer(base.Cfg, rpcClient, workerStates)
+	if err := ephemeralConsumer.Start(); err != nil {
+		log.Panicw("failed to start appservice ephemeral consumer", log.KeysAndValues{"error", err})
+	}
+
 	// Create application service transaction workers
 	if err := workers.SetupTransactionWorkers(applicationServiceDB, workerStates); err != nil {
 		log.Panicw("failed to start app service transaction workers", log.KeysAndValues{"error", err})
 	}
+
+	// the workers and the consumers follow the reloaded registrations
+	config.OnReload(func(prev, cur *config.Reloadable) {
+		if reflect.DeepEqual(prev.ApplicationServices, cur.ApplicationServices) {
+			return
+		}
+		workers.ReloadTransactionWorkers(applicationServiceDB, workerStates, cur.ApplicationServices)
+		if err := ephemeralConsumer.Start(); err != nil {
+			log.Errorw("failed to start appservice ephemeral consumer", log.KeysAndValues{"error", err})
+		}
+		log.Infof("application services reloaded")
+	})
 }
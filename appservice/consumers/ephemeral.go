@@ -0,0 +1,235 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package consumers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/finogeeks/ligase/appservice/types"
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/syncapitypes"
+	mtypes "github.com/finogeeks/ligase/model/types"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/nats-io/go-nats"
+)
+
+// typing notifications not refreshed within this many seconds are dropped
+const typingExpire = 30
+
+// EphemeralConsumer pushes typing notifications, read receipts and presence
+// updates to the application services that asked for them (MSC2409).
+type EphemeralConsumer struct {
+	cfg          *config.Dendrite
+	rpcClient    *common.RpcClient
+	channel      core.IChannel
+	workerStates *types.WorkerStates
+	// room ID -> *sync.Map of user ID -> unix time of the last typing update
+	typing   sync.Map
+	chanSize uint32
+	msgChan  []chan common.ContextMsg
+	// set once the updates are consumed
+	started int32
+}
+
+// NewEphemeralConsumer creates a new EphemeralConsumer. Call Start() to begin
+// consuming typing and receipt updates and the profile output log.
+func NewEphemeralConsumer(
+	cfg *config.Dendrite,
+	rpcClient *common.RpcClient,
+	workerStates *types.WorkerStates,
+) *EphemeralConsumer {
+	s := &EphemeralConsumer{
+		cfg:          cfg,
+		rpcClient:    rpcClient,
+		workerStates: workerStates,
+		chanSize:     16,
+	}
+	s.msgChan = make([]chan common.ContextMsg, s.chanSize)
+	for i := uint32(0); i < s.chanSize; i++ {
+		s.msgChan[i] = make(chan common.ContextMsg, 512)
+		go s.startWorker(s.msgChan[i])
+	}
+
+	val, ok := common.GetTransportMultiplexer().GetChannel(
+		cfg.Kafka.Consumer.OutputProfileAppservice.Underlying,
+		cfg.Kafka.Consumer.OutputProfileAppservice.Name,
+	)
+	if ok {
+		s.channel = val.(core.IChannel)
+		s.channel.SetHandler(s)
+	} else {
+		log.Warnf("appservice ephemeral consumer: no profile channel, presence will not be pushed")
+	}
+
+	return s
+}
+
+// Start consuming ephemeral updates, unless no application service wants
+// them. It is called again when the registrations are reloaded.
+func (s *EphemeralConsumer) Start() error {
+	wanted := false
+	for _, ws := range s.workerStates.Load() {
+		if ws.AppService.URL != "" && ws.AppService.WantsEphemeralEvents() {
+			wanted = true
+		}
+	}
+	if !wanted || !atomic.CompareAndSwapInt32(&s.started, 0, 1) {
+		return nil
+	}
+
+	s.rpcClient.ReplyGrpWithContext(mtypes.TypingUpdateTopicDef, mtypes.APPSERVICE_RPC_GROUP, s.typingCB)
+	s.rpcClient.ReplyGrpWithContext(mtypes.ReceiptTopicDef, mtypes.APPSERVICE_RPC_GROUP, s.receiptCB)
+	return nil
+}
+
+func (s *EphemeralConsumer) startWorker(msgChan chan common.ContextMsg) {
+	for msg := range msgChan {
+		switch data := msg.Msg.(type) {
+		case *syncapitypes.TypingUpdate:
+			s.onTyping(data)
+		case *mtypes.ReceiptContent:
+			s.onReceipt(data)
+		case *mtypes.ProfileStreamUpdate:
+			s.onPresence(data)
+		}
+	}
+}
+
+func (s *EphemeralConsumer) typingCB(ctx context.Context, msg *nats.Msg) {
+	var result syncapitypes.TypingUpdate
+	if err := json.Unmarshal(msg.Data, &result); err != nil {
+		log.Errorf("appservice typing update cb error %v", err)
+		return
+	}
+	idx := common.CalcStringHashCode(result.RoomID) % s.chanSize
+	s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: &result}
+}
+
+func (s *EphemeralConsumer) receiptCB(ctx context.Context, msg *nats.Msg) {
+	var result mtypes.ReceiptContent
+	if err := json.Unmarshal(msg.Data, &result); err != nil {
+		log.Errorf("appservice receipt cb error %v", err)
+		return
+	}
+	idx := common.CalcStringHashCode(result.RoomID) % s.chanSize
+	s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: &result}
+}
+
+// OnMessage is called when the profile output log has a presence update
+func (s *EphemeralConsumer) OnMessage(ctx context.Context, topic string, partition int32, data []byte, rawMsg interface{}) {
+	if atomic.LoadInt32(&s.started) == 0 {
+		return
+	}
+	var output mtypes.ProfileStreamUpdate
+	if err := json.Unmarshal(data, &output); err != nil {
+		log.Errorw("appservice profile consumer: message parse failure", log.KeysAndValues{"error", err})
+		return
+	}
+	idx := common.CalcStringHashCode(output.UserID) % s.chanSize
+	s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: &output}
+}
+
+func (s *EphemeralConsumer) onTyping(data *syncapitypes.TypingUpdate) {
+	val, _ := s.typing.LoadOrStore(data.RoomID, new(sync.Map))
+	typingMap := val.(*sync.Map)
+	switch data.Type {
+	case "add":
+		typingMap.Store(data.UserID, time.Now().Unix())
+	case "remove":
+		typingMap.Delete(data.UserID)
+	default:
+		return
+	}
+
+	now := time.Now().Unix()
+	userIDs := []string{}
+	typingMap.Range(func(key, value interface{}) bool {
+		if now-value.(int64) > typingExpire {
+			typingMap.Delete(key)
+		} else {
+			userIDs = append(userIDs, key.(string))
+		}
+		return true
+	})
+
+	content, _ := json.Marshal(map[string][]string{"user_ids": userIDs})
+	ev := types.EphemeralEvent{Type: "m.typing", RoomID: data.RoomID, Content: content}
+	s.dispatch(ev, func(ws *types.ApplicationServiceWorkerState) bool {
+		if s.isInterestedInRoom(ws, data.RoomID) {
+			return true
+		}
+		for _, user := range data.RoomUsers {
+			if ws.AppService.IsInterestedInUserID(user) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (s *EphemeralConsumer) onReceipt(data *mtypes.ReceiptContent) {
+	receiptType := data.ReceiptType
+	if receiptType == "" {
+		receiptType = "m.read"
+	}
+	content, _ := json.Marshal(map[string]interface{}{
+		data.EventID: map[string]interface{}{
+			receiptType: map[string]interface{}{
+				data.UserID: map[string]int64{"ts": time.Now().UnixNano() / int64(time.Millisecond)},
+			},
+		},
+	})
+	ev := types.EphemeralEvent{Type: "m.receipt", RoomID: data.RoomID, Content: content}
+	s.dispatch(ev, func(ws *types.ApplicationServiceWorkerState) bool {
+		return s.isInterestedInRoom(ws, data.RoomID) || ws.AppService.IsInterestedInUserID(data.UserID)
+	})
+}
+
+func (s *EphemeralConsumer) onPresence(data *mtypes.ProfileStreamUpdate) {
+	content, err := json.Marshal(data.Presence)
+	if err != nil {
+		log.Errorw("appservice marshal presence error", log.KeysAndValues{"userID", data.UserID, "error", err})
+		return
+	}
+	ev := types.EphemeralEvent{Type: "m.presence", Sender: data.UserID, Content: content}
+	s.dispatch(ev, func(ws *types.ApplicationServiceWorkerState) bool {
+		return ws.AppService.InterestedAll ||
+			ws.AppService.IsInterestedInUserID(data.UserID) ||
+			ws.Interest.HasUser(data.UserID)
+	})
+}
+
+func (s *EphemeralConsumer) isInterestedInRoom(ws *types.ApplicationServiceWorkerState, roomID string) bool {
+	return ws.AppService.InterestedAll ||
+		ws.AppService.IsInterestedInRoomID(roomID) ||
+		ws.Interest.HasRoom(roomID)
+}
+
+// dispatch queues an ephemeral event for every application service that wants
+// ephemeral events and is interested in this one, then wakes its worker.
+func (s *EphemeralConsumer) dispatch(ev types.EphemeralEvent, interested func(*types.ApplicationServiceWorkerState) bool) {
+	for _, ws := range s.workerStates.Load() {
+		if ws.AppService.URL == "" || !ws.AppService.WantsEphemeralEvents() || !interested(ws) {
+			continue
+		}
+		ws.Ephemeral.Push(ev)
+		ws.NotifyNewEvents()
+	}
+}
@@ -19,6 +19,7 @@ package consumers
 
 import (
 	"context"
+	"sync"
 
 	"github.com/finogeeks/ligase/appservice/types"
 	"github.com/finogeeks/ligase/common"
@@ -39,7 +40,10 @@ type OutputRoomEventConsumer struct {
 	channel      core.IChannel
 	asDB         model.AppServiceDatabase
 	rsDB         model.RoomServerDatabase
-	workerStates []types.ApplicationServiceWorkerState
+	workerStates *types.WorkerStates
+	// room ID -> []string of the room's aliases, only filled in when some
+	// application service registered an alias namespace
+	aliases sync.Map
 }
 
 // NewOutputRoomEventConsumer creates a new OutputRoomEventConsumer. Call Start() to begin consuming from room servers.
@@ -47,7 +51,7 @@ func NewOutputRoomEventConsumer(
 	cfg *config.Dendrite,
 	appserviceDB model.AppServiceDatabase,
 	rsDB model.RoomServerDatabase,
-	workerStates []types.ApplicationServiceWorkerState,
+	workerStates *types.WorkerStates,
 ) *OutputRoomEventConsumer {
 	val, ok := common.GetTransportMultiplexer().GetChannel(
 		cfg.Kafka.Consumer.OutputRoomEventAppservice.Underlying,
@@ -94,6 +98,11 @@ func (c *OutputRoomEventConsumer) OnMessage(ctx context.Context, topic string, p
 	ev := &output.NewRoomEvent.Event
 	log.Infow("applicationservice received event from roomserver", log.KeysAndValues{"event_id", ev.EventID, "room_id", ev.RoomID, "type", ev.Type})
 
+	if ev.Type == "m.room.aliases" || ev.Type == "m.room.canonical_alias" {
+		// aliases of the room changed, load them again on next use
+		c.aliases.Delete(ev.RoomID)
+	}
+
 	// todo 从字段获取missevents
 	missingEvents := []gomatrixserverlib.ClientEvent{}
 
@@ -114,10 +123,11 @@ func (s *OutputRoomEventConsumer) filterRoomserverEvents(
 	ctx context.Context,
 	events []gomatrixserverlib.ClientEvent,
 ) error {
-	for _, ws := range s.workerStates {
+	for _, ws := range s.workerStates.Load() {
 		for _, event := range events {
 			// Check if this event is interesting to this application service
 			if s.appserviceIsInterestedInEvent(ctx, event, ws.AppService) {
+				s.trackInterest(ws, event)
 				// Queue this event to be sent off to the application service
 				if err := s.asDB.StoreEvent(ctx, ws.AppService.ID, &event); err != nil {
 					log.Warnw("failed to insert incoming event into appservices database", log.KeysAndValues{"error", err})
@@ -153,22 +163,50 @@ func (s *OutputRoomEventConsumer) appserviceIsInterestedInEvent(ctx context.Cont
 		return true
 	}
 
-	// 注意 这里去掉了根据别名过滤的功能，这样就不会去查询roomserver的db了 但是同时根据别名过滤的功能也失效了
-	// 暂时没用用到，以后应该让roomserver使用api支持这个功能
-
-	//aliasList, err := s.rsDB.GetAliasesFromRoomID(context.Background(), event.RoomID)
-	//// Check all known room aliases of the room the event came from
-	//if err == nil {
-	//	for _, alias := range aliasList {
-	//		if appservice.IsInterestedInRoomAlias(alias) {
-	//			return true
-	//		}
-	//	}
-	//} else {
-	//	log.WithFields(log.Fields{
-	//		"room_id": event.RoomID(),
-	//	}).WithError(err).Errorf("Unable to get aliases for room")
-	//}
+	// Check the state key of membership events, the application service
+	// wants to know about its users being invited or kicked
+	if event.Type == "m.room.member" && event.StateKey != nil &&
+		appservice.IsInterestedInUserID(*event.StateKey) {
+		return true
+	}
+
+	// Check all known room aliases of the room the event came from
+	if appservice.IsInterestedInAnyRoomAlias() {
+		for _, alias := range s.getRoomAliases(ctx, event.RoomID) {
+			if appservice.IsInterestedInRoomAlias(alias) {
+				return true
+			}
+		}
+	}
 
 	return false
 }
+
+// getRoomAliases returns the aliases of a room, asking the roomserver database
+// only the first time a room is seen or after its aliases changed.
+func (s *OutputRoomEventConsumer) getRoomAliases(ctx context.Context, roomID string) []string {
+	if val, ok := s.aliases.Load(roomID); ok {
+		return val.([]string)
+	}
+
+	aliasList, err := s.rsDB.GetAliasesFromRoomID(ctx, roomID)
+	if err != nil {
+		log.Errorw("unable to get aliases for room", log.KeysAndValues{"room_id", roomID, "error", err})
+		return nil
+	}
+	s.aliases.Store(roomID, aliasList)
+	return aliasList
+}
+
+// trackInterest records the room and users of an event sent to an application
+// service, ephemeral events about them are sent to it as well.
+func (s *OutputRoomEventConsumer) trackInterest(ws *types.ApplicationServiceWorkerState, event gomatrixserverlib.ClientEvent) {
+	if !ws.AppService.WantsEphemeralEvents() {
+		return
+	}
+	ws.Interest.TrackRoom(event.RoomID)
+	ws.Interest.TrackUser(event.Sender)
+	if event.Type == "m.room.member" && event.StateKey != nil {
+		ws.Interest.TrackUser(*event.StateKey)
+	}
+}
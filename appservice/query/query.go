@@ -0,0 +1,186 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package query implements the homeserver side of the application service
+// query API, which lets an application service lazily provision the users
+// and room aliases inside its namespaces.
+// https://spec.matrix.org/v1.7/application-service-api/#querying
+package query
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	pathPrefix = "/_matrix/app/v1"
+	// Application services are expected to answer queries quickly, the
+	// caller is usually a client waiting on a profile or alias lookup
+	queryTimeout = time.Second * 10
+)
+
+var (
+	// ErrURLNotSet is returned when the application service has no url
+	ErrURLNotSet = errors.New("application service has no url configured")
+
+	httpClient = &http.Client{Timeout: queryTimeout}
+)
+
+// ErrStatus is returned when the application service answers a request with
+// a non-2xx status code
+type ErrStatus struct {
+	Code int
+	Body []byte
+}
+
+func (e *ErrStatus) Error() string {
+	return fmt.Sprintf("application service returned status %d", e.Code)
+}
+
+// UserIDExists asks every application service whose user namespace covers
+// userID whether the user exists. An application service that answers 200 is
+// expected to have registered the user before replying.
+func UserIDExists(ctx context.Context, cfg *config.Dendrite, userID string) bool {
+	for _, as := range config.GetReloadable().ApplicationServices {
+		if as.URL == "" || !as.IsInterestedInUserID(userID) {
+			continue
+		}
+		if exists(ctx, &as, "/users/"+url.PathEscape(userID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoomAliasExists asks every application service whose alias namespace covers
+// alias whether the alias exists. An application service that answers 200 is
+// expected to have created the room and set the alias before replying.
+func RoomAliasExists(ctx context.Context, cfg *config.Dendrite, alias string) bool {
+	for _, as := range config.GetReloadable().ApplicationServices {
+		if as.URL == "" || !as.IsInterestedInRoomAlias(alias) {
+			continue
+		}
+		if exists(ctx, &as, "/rooms/"+url.PathEscape(alias)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUserIDInterested returns a bool on whether any application service can be
+// queried about the given user ID
+func IsUserIDInterested(cfg *config.Dendrite, userID string) bool {
+	for _, as := range config.GetReloadable().ApplicationServices {
+		if as.URL != "" && as.IsInterestedInUserID(userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRoomAliasInterested returns a bool on whether any application service can
+// be queried about the given room alias
+func IsRoomAliasInterested(cfg *config.Dendrite, alias string) bool {
+	for _, as := range config.GetReloadable().ApplicationServices {
+		if as.URL != "" && as.IsInterestedInRoomAlias(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ping sends a POST /_matrix/app/v1/ping to the application service and
+// returns the round trip time.
+func Ping(ctx context.Context, as *config.ApplicationService, txnID string) (time.Duration, error) {
+	if as.URL == "" {
+		return 0, ErrURLNotSet
+	}
+
+	body := struct {
+		TxnID string `json:"transaction_id,omitempty"`
+	}{txnID}
+	content, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	err = do(ctx, as, http.MethodPost, "/ping", nil, content, nil)
+	return time.Since(start), err
+}
+
+func exists(ctx context.Context, as *config.ApplicationService, path string) bool {
+	err := do(ctx, as, http.MethodGet, path, nil, nil, nil)
+	if err == nil {
+		return true
+	}
+	if e, ok := err.(*ErrStatus); ok && e.Code == http.StatusNotFound {
+		return false
+	}
+	log.Warnw("application service query failed", log.KeysAndValues{
+		"appservice", as.ID, "path", path, "error", err,
+	})
+	return false
+}
+
+// do sends a request to the application service, the response body is
+// decoded into out unless it is nil
+func do(
+	ctx context.Context, as *config.ApplicationService,
+	method, path string, params url.Values, body []byte, out interface{},
+) error {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("access_token", as.HSToken)
+	address := fmt.Sprintf("%s%s%s?%s", as.URL, pathPrefix, path, query.Encode())
+
+	req, err := http.NewRequest(method, address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+as.HSToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return &ErrStatus{Code: resp.StatusCode, Body: data}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
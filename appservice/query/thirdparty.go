@@ -0,0 +1,201 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+// Protocols returns the third party protocols declared by the application
+// services, sorted by name
+func Protocols(cfg *config.Dendrite) []string {
+	seen := make(map[string]bool)
+	protocols := []string{}
+	for _, as := range config.GetReloadable().ApplicationServices {
+		if as.URL == "" {
+			continue
+		}
+		for _, p := range as.Protocols {
+			if !seen[p] {
+				seen[p] = true
+				protocols = append(protocols, p)
+			}
+		}
+	}
+	sort.Strings(protocols)
+	return protocols
+}
+
+// GetProtocols returns the metadata of every declared protocol which at
+// least one application service answered for
+func GetProtocols(ctx context.Context, cfg *config.Dendrite) external.GetThirdPartyProtocalsResponse {
+	res := external.GetThirdPartyProtocalsResponse{}
+	for _, protocol := range Protocols(cfg) {
+		if p, ok := GetProtocol(ctx, cfg, protocol); ok {
+			res[protocol] = *p
+		}
+	}
+	return res
+}
+
+// GetProtocol asks the application services handling protocol for its
+// metadata. The first answer wins, the instances of all answers are merged
+// and tagged with an instance id unique across the application services.
+func GetProtocol(ctx context.Context, cfg *config.Dendrite, protocol string) (*external.ThirdPartyProtocol, bool) {
+	var result *external.ThirdPartyProtocol
+	var mutex sync.Mutex
+	path := "/thirdparty/protocol/" + url.PathEscape(protocol)
+	fanOut(cfg, protocol, func(as *config.ApplicationService) {
+		var p external.ThirdPartyProtocol
+		if !get(ctx, as, path, nil, &p) {
+			return
+		}
+		for i := range p.Instances {
+			p.Instances[i].InstanceID = as.ID + "|" + p.Instances[i].NetworkID
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if result == nil {
+			result = &p
+			return
+		}
+		result.Instances = append(result.Instances, p.Instances...)
+	})
+	if result != nil && result.Instances == nil {
+		result.Instances = []external.ProtocolInstance{}
+	}
+	return result, result != nil
+}
+
+// QueryLocations looks up the portal rooms matching fields in every
+// application service handling protocol
+func QueryLocations(ctx context.Context, cfg *config.Dendrite, protocol string, fields map[string]string) []external.Location {
+	res := []external.Location{}
+	var mutex sync.Mutex
+	path := "/thirdparty/location/" + url.PathEscape(protocol)
+	fanOut(cfg, protocol, func(as *config.ApplicationService) {
+		var locations []external.Location
+		if get(ctx, as, path, toValues(fields), &locations) {
+			mutex.Lock()
+			res = append(res, locations...)
+			mutex.Unlock()
+		}
+	})
+	return res
+}
+
+// QueryUsers looks up the remote users matching fields in every application
+// service handling protocol
+func QueryUsers(ctx context.Context, cfg *config.Dendrite, protocol string, fields map[string]string) []external.ThirdPartyUser {
+	res := []external.ThirdPartyUser{}
+	var mutex sync.Mutex
+	path := "/thirdparty/user/" + url.PathEscape(protocol)
+	fanOut(cfg, protocol, func(as *config.ApplicationService) {
+		var users []external.ThirdPartyUser
+		if get(ctx, as, path, toValues(fields), &users) {
+			mutex.Lock()
+			res = append(res, users...)
+			mutex.Unlock()
+		}
+	})
+	return res
+}
+
+// LocationsByAlias asks every application service with a third party
+// protocol which remote locations a room alias is bridged to
+func LocationsByAlias(ctx context.Context, cfg *config.Dendrite, alias string) []external.Location {
+	res := []external.Location{}
+	var mutex sync.Mutex
+	params := url.Values{"alias": []string{alias}}
+	fanOut(cfg, "", func(as *config.ApplicationService) {
+		var locations []external.Location
+		if get(ctx, as, "/thirdparty/location", params, &locations) {
+			mutex.Lock()
+			res = append(res, locations...)
+			mutex.Unlock()
+		}
+	})
+	return res
+}
+
+// UsersByID asks every application service with a third party protocol
+// which remote users a matrix user id stands for
+func UsersByID(ctx context.Context, cfg *config.Dendrite, userID string) []external.ThirdPartyUser {
+	res := []external.ThirdPartyUser{}
+	var mutex sync.Mutex
+	params := url.Values{"userid": []string{userID}}
+	fanOut(cfg, "", func(as *config.ApplicationService) {
+		var users []external.ThirdPartyUser
+		if get(ctx, as, "/thirdparty/user", params, &users) {
+			mutex.Lock()
+			res = append(res, users...)
+			mutex.Unlock()
+		}
+	})
+	return res
+}
+
+// fanOut calls fn in parallel for every application service handling
+// protocol, or declaring any protocol if it is empty, and waits for them
+func fanOut(cfg *config.Dendrite, protocol string, fn func(as *config.ApplicationService)) {
+	var wg sync.WaitGroup
+	appServices := config.GetReloadable().ApplicationServices
+	for i := range appServices {
+		as := &appServices[i]
+		if as.URL == "" || len(as.Protocols) == 0 {
+			continue
+		}
+		if protocol != "" && !as.HandlesProtocol(protocol) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(as)
+		}()
+	}
+	wg.Wait()
+}
+
+func get(ctx context.Context, as *config.ApplicationService, path string, params url.Values, out interface{}) bool {
+	err := do(ctx, as, http.MethodGet, path, params, nil, out)
+	if err == nil {
+		return true
+	}
+	if e, ok := err.(*ErrStatus); ok && e.Code == http.StatusNotFound {
+		return false
+	}
+	log.Warnw("application service third party lookup failed", log.KeysAndValues{
+		"appservice", as.ID, "path", path, "error", err,
+	})
+	return false
+}
+
+func toValues(fields map[string]string) url.Values {
+	values := url.Values{}
+	for k, v := range fields {
+		values.Set(k, v)
+	}
+	return values
+}
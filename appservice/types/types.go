@@ -15,46 +15,228 @@
 package types
 
 import (
-	"github.com/finogeeks/ligase/common/config"
+	"context"
+	"encoding/json"
+	"reflect"
 	"sync"
+	"sync/atomic"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
 )
 
+// Maximum number of ephemeral events kept for an application service that is
+// not taking transactions. Older ones are dropped first, they are only useful
+// while they are fresh.
+const maxEphemeralQueued = 1000
+
 // ApplicationServiceWorkerState is a type that couples an application service,
-// a lockable condition as well as some other state variables, allowing the
+// a wakeup channel as well as some other state variables, allowing the
 // roomserver to notify appservice workers when there are events ready to send
 // externally to application services.
 type ApplicationServiceWorkerState struct {
 	AppService config.ApplicationService
-	Cond       *sync.Cond
-	// Events ready to be sent
-	EventsReady bool
+	// Buffered so that a notification sent while the worker is busy is kept
+	// until the worker waits again
+	wake chan struct{}
 	// Backoff exponent (2^x secs). Max 6, aka 64s.
 	Backoff int
+	// Ephemeral events waiting to be sent
+	Ephemeral *EphemeralQueue
+	// Rooms and users the application service has been sent events about
+	Interest *InterestSet
+}
+
+// NewApplicationServiceWorkerState creates the worker state for an
+// application service.
+func NewApplicationServiceWorkerState(as config.ApplicationService) *ApplicationServiceWorkerState {
+	return &ApplicationServiceWorkerState{
+		AppService: as,
+		wake:       make(chan struct{}, 1),
+		Ephemeral:  &EphemeralQueue{},
+		Interest:   &InterestSet{},
+	}
 }
 
-// NotifyNewEvents wakes up all waiting goroutines, notifying that events remain
-// in the event queue for this application service worker.
+// NotifyNewEvents wakes up the worker, notifying that events remain in the
+// event queue for this application service worker. It never blocks.
 func (a *ApplicationServiceWorkerState) NotifyNewEvents() {
-	a.Cond.L.Lock()
-	a.EventsReady = true
-	a.Cond.Broadcast()
-	a.Cond.L.Unlock()
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
 }
 
-// FinishEventProcessing marks all events of this worker as being sent to the
-// application service.
-func (a *ApplicationServiceWorkerState) FinishEventProcessing() {
-	a.Cond.L.Lock()
-	a.EventsReady = false
-	a.Cond.L.Unlock()
+// WaitForNewEvents causes the calling goroutine to wait until events are
+// ready to be sent. It returns false if ctx is done first.
+func (a *ApplicationServiceWorkerState) WaitForNewEvents(ctx context.Context) bool {
+	select {
+	case <-a.wake:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// WorkerStates holds the worker states of the registered application
+// services. Readers load the list on every use, a reload of the
+// registrations replaces it.
+type WorkerStates struct {
+	states atomic.Value
+}
+
+// NewWorkerStates creates the worker states of services.
+func NewWorkerStates(services []config.ApplicationService) *WorkerStates {
+	w := &WorkerStates{}
+	states := make([]*ApplicationServiceWorkerState, len(services))
+	for i, as := range services {
+		states[i] = NewApplicationServiceWorkerState(as)
+	}
+	w.states.Store(states)
+	return w
+}
+
+// Load returns the worker states in use.
+func (w *WorkerStates) Load() []*ApplicationServiceWorkerState {
+	states, _ := w.states.Load().([]*ApplicationServiceWorkerState)
+	return states
+}
+
+// Reload replaces the worker states by the ones of services. The state of a
+// service whose registration did not change is kept, a changed one gets a new
+// state with the ephemeral events and the interest of the old one. stopped
+// are the states whose worker must stop, started the ones to start a worker
+// for.
+func (w *WorkerStates) Reload(services []config.ApplicationService) (started, stopped []*ApplicationServiceWorkerState) {
+	prev := make(map[string]*ApplicationServiceWorkerState)
+	for _, ws := range w.Load() {
+		prev[ws.AppService.ID] = ws
+	}
+	states := make([]*ApplicationServiceWorkerState, len(services))
+	for i, as := range services {
+		old, ok := prev[as.ID]
+		delete(prev, as.ID)
+		if ok && reflect.DeepEqual(old.AppService, as) {
+			states[i] = old
+			continue
+		}
+		states[i] = NewApplicationServiceWorkerState(as)
+		if ok {
+			states[i].Ephemeral = old.Ephemeral
+			states[i].Interest = old.Interest
+			stopped = append(stopped, old)
+		}
+		started = append(started, states[i])
+	}
+	for _, old := range prev {
+		stopped = append(stopped, old)
+	}
+	w.states.Store(states)
+	return started, stopped
+}
+
+// EphemeralEvent is a typing notification, receipt or presence update pushed
+// to an application service (MSC2409).
+type EphemeralEvent struct {
+	Type    string          `json:"type"`
+	RoomID  string          `json:"room_id,omitempty"`
+	Sender  string          `json:"sender,omitempty"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ApplicationServiceTransaction is the body of PUT /transactions/{txnId}.
+// Ephemeral events are sent under the stable and the unstable key depending on
+// which one the application service registered with.
+type ApplicationServiceTransaction struct {
+	Events            []gomatrixserverlib.ClientEvent `json:"events"`
+	Ephemeral         []EphemeralEvent                `json:"ephemeral,omitempty"`
+	UnstableEphemeral []EphemeralEvent                `json:"de.sorunome.msc2409.ephemeral,omitempty"`
+}
+
+// EphemeralQueue holds the ephemeral events of an application service until
+// a transaction carrying them has been accepted. Events are addressed by
+// their offset since the queue was created, so that an event dropped because
+// the queue is full does not shift the events of a transaction in flight.
+type EphemeralQueue struct {
+	mutex  sync.Mutex
+	events []EphemeralEvent
+	// offset of events[0]
+	base uint64
+}
+
+// Push appends an event, dropping the oldest one when the queue is full.
+func (q *EphemeralQueue) Push(ev EphemeralEvent) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.events) >= maxEphemeralQueued {
+		q.events = q.events[1:]
+		q.base++
+	}
+	q.events = append(q.events, ev)
+}
+
+// Peek returns up to limit of the oldest queued events without removing
+// them, and the offset just past the last of them to pass to Drop.
+func (q *EphemeralQueue) Peek(limit int) ([]EphemeralEvent, uint64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if limit > len(q.events) {
+		limit = len(q.events)
+	}
+	events := make([]EphemeralEvent, limit)
+	copy(events, q.events)
+	return events, q.base + uint64(limit)
 }
 
-// WaitForNewEvents causes the calling goroutine to wait on the worker state's
-// condition for a broadcast or similar wakeup, if there are no events ready.
-func (a *ApplicationServiceWorkerState) WaitForNewEvents() {
-	a.Cond.L.Lock()
-	if !a.EventsReady {
-		a.Cond.Wait()
+// Drop removes the events before offset end once they have been delivered.
+// Those pushed out of a full queue meanwhile are already gone.
+func (q *EphemeralQueue) Drop(end uint64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if end <= q.base {
+		return
+	}
+	n := end - q.base
+	if n > uint64(len(q.events)) {
+		n = uint64(len(q.events))
 	}
-	a.Cond.L.Unlock()
+	q.events = q.events[n:]
+	q.base += n
+}
+
+// Len returns the number of queued events.
+func (q *EphemeralQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.events)
+}
+
+// InterestSet remembers the rooms and users an application service has been
+// sent room events about, so ephemeral events in those rooms and from those
+// users can be routed to it as well.
+type InterestSet struct {
+	rooms sync.Map
+	users sync.Map
+}
+
+// TrackRoom marks a room as being of interest.
+func (i *InterestSet) TrackRoom(roomID string) {
+	i.rooms.Store(roomID, true)
+}
+
+// TrackUser marks a user as being of interest.
+func (i *InterestSet) TrackUser(userID string) {
+	i.users.Store(userID, true)
+}
+
+// HasRoom returns a bool on whether the room has been marked.
+func (i *InterestSet) HasRoom(roomID string) bool {
+	_, ok := i.rooms.Load(roomID)
+	return ok
+}
+
+// HasUser returns a bool on whether the user has been marked.
+func (i *InterestSet) HasUser(userID string) bool {
+	_, ok := i.users.Load(userID)
+	return ok
 }
@@ -0,0 +1,101 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+)
+
+func pushN(q *EphemeralQueue, from, n int) {
+	for i := from; i < from+n; i++ {
+		q.Push(EphemeralEvent{Type: strconv.Itoa(i)})
+	}
+}
+
+func TestEphemeralQueuePeekDrop(t *testing.T) {
+	q := &EphemeralQueue{}
+	pushN(q, 0, 5)
+	events, end := q.Peek(3)
+	if len(events) != 3 || events[0].Type != "0" || end != 3 {
+		t.Fatalf("peek %v %d", events, end)
+	}
+	pushN(q, 5, 1)
+	q.Drop(end)
+	if events, _ = q.Peek(10); len(events) != 3 || events[0].Type != "3" {
+		t.Fatalf("after drop %v", events)
+	}
+	q.Drop(end)
+	if q.Len() != 3 {
+		t.Fatalf("drop again removed events, %d left", q.Len())
+	}
+}
+
+// Events pushed out of a full queue while a transaction is in flight must
+// not make the transaction acknowledge events it did not carry
+func TestEphemeralQueueFullDuringTransaction(t *testing.T) {
+	q := &EphemeralQueue{}
+	pushN(q, 0, maxEphemeralQueued)
+	events, end := q.Peek(10)
+	if events[9].Type != "9" {
+		t.Fatalf("peek %v", events)
+	}
+	pushN(q, maxEphemeralQueued, 4)
+	q.Drop(end)
+	events, _ = q.Peek(1)
+	if events[0].Type != "10" || q.Len() != maxEphemeralQueued-6 {
+		t.Fatalf("first left %s, %d left", events[0].Type, q.Len())
+	}
+
+	// the whole transaction was pushed out
+	_, end = q.Peek(5)
+	pushN(q, 2*maxEphemeralQueued, maxEphemeralQueued)
+	q.Drop(end)
+	events, _ = q.Peek(1)
+	if q.Len() != maxEphemeralQueued || events[0].Type != strconv.Itoa(2*maxEphemeralQueued) {
+		t.Fatalf("first left %s, %d left", events[0].Type, q.Len())
+	}
+}
+
+func TestWorkerStatesReload(t *testing.T) {
+	w := NewWorkerStates([]config.ApplicationService{
+		{ID: "kept", URL: "http://kept"},
+		{ID: "changed", URL: "http://old"},
+		{ID: "removed", URL: "http://removed"},
+	})
+	prev := w.Load()
+	prev[1].Ephemeral.Push(EphemeralEvent{Type: "m.typing"})
+
+	started, stopped := w.Reload([]config.ApplicationService{
+		{ID: "kept", URL: "http://kept"},
+		{ID: "changed", URL: "http://new"},
+		{ID: "added", URL: "http://added"},
+	})
+	cur := w.Load()
+	if len(cur) != 3 || cur[0] != prev[0] {
+		t.Fatalf("the state of an unchanged service was not kept: %v", cur)
+	}
+	if cur[1] == prev[1] || cur[1].AppService.URL != "http://new" || cur[1].Ephemeral.Len() != 1 {
+		t.Fatalf("changed service state %+v", cur[1])
+	}
+	if len(started) != 2 || started[0] != cur[1] || started[1] != cur[2] {
+		t.Fatalf("started %v", started)
+	}
+	if len(stopped) != 2 || stopped[0] != prev[1] || stopped[1] != prev[2] {
+		t.Fatalf("stopped %v", stopped)
+	}
+}
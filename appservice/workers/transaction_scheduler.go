@@ -22,109 +22,229 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/finogeeks/ligase/common"
+	"io/ioutil"
 	"math"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/finogeeks/ligase/appservice/types"
+	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
 	log "github.com/finogeeks/ligase/skunkworks/log"
+	mon "github.com/finogeeks/ligase/skunkworks/monitor/go-client/monitor"
 	"github.com/finogeeks/ligase/storage/model"
 )
 
+const (
+	// Maximum backoff exponent (2^x secs), aka 64s.
+	maxBackoff = 6
+	// How long to wait before restarting a worker that panicked.
+	restartDelay = time.Second * 5
+)
+
 var (
-	// Maximum size of events sent in each transaction.
-	transactionBatchSize = 50
-	// Timeout for sending a single transaction to an application service.
-	transactionTimeout = time.Second * 60
+	// Number of events and ephemeral events waiting to be sent, per service
+	queueDepthGauge mon.LabeledGauge
+	// Unix time in seconds of the last transaction accepted, per service
+	lastSuccessGauge mon.LabeledGauge
+
+	runningMu sync.Mutex
+	// the workers started, by worker state
+	running = make(map[*types.ApplicationServiceWorkerState]*runningWorker)
 )
 
+type runningWorker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
 // SetupTransactionWorkers spawns a separate goroutine for each application
 // service. Each of these "workers" handle taking all events intended for their
 // app service, batch them up into a single transaction (up to a max transaction
 // size), then send that off to the AS's /transactions/{txnID} endpoint. It also
 // handles exponentially backing off in case the AS isn't currently available.
+// Workers never stop on errors, a broken application service only delays its
+// own events.
 func SetupTransactionWorkers(
 	appserviceDB model.AppServiceDatabase,
-	workerStates []types.ApplicationServiceWorkerState,
+	workerStates *types.WorkerStates,
 ) error {
+	monitor := mon.GetInstance()
+	queueDepthGauge = monitor.NewLabeledGauge("appservice_queue_depth", []string{"appservice"})
+	lastSuccessGauge = monitor.NewLabeledGauge("appservice_last_success_timestamp_seconds", []string{"appservice"})
+
 	// Create a worker that handles transmitting events to a single homeserver
-	for _, workerState := range workerStates {
-		log.Infof("start workerState for %s", workerState.AppService.URL)
-		// Don't create a worker if this AS doesn't want to receive events
-		if workerState.AppService.URL != "" {
-			go worker(appserviceDB, workerState)
-		}
+	for _, workerState := range workerStates.Load() {
+		startWorker(appserviceDB, workerState)
 	}
 	return nil
 }
 
+// ReloadTransactionWorkers applies reloaded registrations: the workers of
+// the removed and changed application services stop, the ones of the added
+// and changed services start. The events of a removed service stay in the
+// database until it is registered again.
+func ReloadTransactionWorkers(
+	appserviceDB model.AppServiceDatabase,
+	workerStates *types.WorkerStates,
+	services []config.ApplicationService,
+) {
+	started, stopped := workerStates.Reload(services)
+	if len(started) == 0 && len(stopped) == 0 {
+		return
+	}
+	go func() {
+		// the old worker of a changed service may be sending a transaction,
+		// it ends before the new one sends it again
+		for _, ws := range stopped {
+			stopWorker(ws)
+		}
+		for _, ws := range started {
+			startWorker(appserviceDB, ws)
+		}
+	}()
+}
+
+func startWorker(db model.AppServiceDatabase, ws *types.ApplicationServiceWorkerState) {
+	log.Infof("start workerState for %s", ws.AppService.URL)
+	// Don't create a worker if this AS doesn't want to receive events
+	if ws.AppService.URL == "" {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &runningWorker{cancel: cancel, done: make(chan struct{})}
+	runningMu.Lock()
+	running[ws] = w
+	runningMu.Unlock()
+	go func() {
+		defer close(w.done)
+		runWorker(ctx, db, ws)
+	}()
+}
+
+// stopWorker stops the worker of ws and waits for it to end
+func stopWorker(ws *types.ApplicationServiceWorkerState) {
+	runningMu.Lock()
+	w, ok := running[ws]
+	delete(running, ws)
+	runningMu.Unlock()
+	if !ok {
+		return
+	}
+	log.Infow("stopping application service", log.KeysAndValues{"appservice", ws.AppService.ID})
+	w.cancel()
+	<-w.done
+}
+
+// runWorker keeps the worker of an application service running, restarting it
+// if it panics so that the other application services are not affected.
+func runWorker(ctx context.Context, db model.AppServiceDatabase, ws *types.ApplicationServiceWorkerState) {
+	for {
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					log.Errorw("appservice worker panic, restarting", log.KeysAndValues{"appservice", ws.AppService.ID, "panic", e})
+				}
+			}()
+			worker(ctx, db, ws)
+		}()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
 // worker is a goroutine that sends any queued events to the application service
 // it is given.
-func worker(db model.AppServiceDatabase, ws types.ApplicationServiceWorkerState) {
+func worker(ctx context.Context, db model.AppServiceDatabase, ws *types.ApplicationServiceWorkerState) {
 	log.Infow("starting application service", log.KeysAndValues{"appservice", ws.AppService.ID})
-	span, ctx := common.StartSobSomSpan(context.Background(), "transaction_scheduler.worker")
+	span, ctx := common.StartSobSomSpan(ctx, "transaction_scheduler.worker")
 	defer span.Finish()
 
 	// Create a HTTP client for sending requests to app services
 	client := &http.Client{
-		Timeout: transactionTimeout,
+		Timeout: time.Duration(ws.AppService.TransactionTimeout) * time.Second,
 	}
 
-	// Initial check for any leftover events to send from last time
-	eventCount, err := db.CountEventsWithAppServiceID(ctx, ws.AppService.ID)
-	if err != nil {
-		log.Fatalw("appservice worker unable to read queued events from DB", log.KeysAndValues{"appservice", ws.AppService.ID, "error", err})
-		return
-	}
-	if eventCount > 0 {
+	// Keep the events queued and try again later, only this application
+	// service is held up
+	retry := func(err error) bool {
 		ws.NotifyNewEvents()
+		updateQueueDepth(ctx, db, ws)
+		return backoff(ctx, ws, err)
 	}
 
-	// Loop forever and keep waiting for more events to send
-	for {
-		// Wait for more events if we've sent all the events in the database
-		ws.WaitForNewEvents()
+	// Always look once for leftover events, including a transaction that was
+	// sent but not acknowledged before a restart
+	ws.NotifyNewEvents()
 
+	// Loop forever and keep waiting for more events to send
+	for ws.WaitForNewEvents(ctx) {
 		// Batch events up into a transaction
-		transactionJSON, txnID, maxEventID, eventsRemaining, err := createTransaction(ctx, db, ws.AppService.ID)
+		transactionJSON, txnID, maxEventID, ephemeralEnd, eventsRemaining, err := createTransaction(ctx, db, ws)
 		if err != nil {
-			log.Fatalw("appservice worker unable to create transaction", log.KeysAndValues{"appservice", ws.AppService.ID, "error", err})
-
-			return
+			if !retry(err) {
+				return
+			}
+			continue
 		}
 
 		// Send the events off to the application service
 		// Backoff if the application service does not respond
-		err = send(client, ws.AppService, txnID, transactionJSON)
+		err = send(client, ws, txnID, transactionJSON)
 		if err != nil {
-			// Backoff
-			backoff(&ws, err)
+			if !retry(err) {
+				return
+			}
 			continue
 		}
 
 		// We sent successfully, hooray!
 		ws.Backoff = 0
-
-		// Transactions have a maximum event size, so there may still be some events
-		// left over to send. Keep sending until none are left
-		if !eventsRemaining {
-			ws.FinishEventProcessing()
+		ws.Ephemeral.Drop(ephemeralEnd)
+		if txnID != 0 {
+			lastSuccessGauge.WithLabelValues(ws.AppService.ID).Set(float64(time.Now().Unix()))
 		}
 
-		// Remove sent events from the DB
+		// Remove sent events from the DB. If this fails the transaction is
+		// sent again with the same ID, which the application service ignores.
 		err = db.RemoveEventsBeforeAndIncludingID(ctx, ws.AppService.ID, maxEventID)
 		if err != nil {
-			log.Fatalw("unable to remove appservice events from the database", log.KeysAndValues{"appservice", ws.AppService.ID, "error", err})
-			return
+			log.Errorw("unable to remove appservice events from the database", log.KeysAndValues{"appservice", ws.AppService.ID, "error", err})
+			if !retry(err) {
+				return
+			}
+			continue
+		}
+
+		// Transactions have a maximum event size, so there may still be some events
+		// left over to send. Keep sending until none are left
+		if eventsRemaining || ws.Ephemeral.Len() > 0 {
+			ws.NotifyNewEvents()
 		}
+		updateQueueDepth(ctx, db, ws)
+	}
+}
+
+// updateQueueDepth reports how many events are waiting for an application service
+func updateQueueDepth(ctx context.Context, db model.AppServiceDatabase, ws *types.ApplicationServiceWorkerState) {
+	count, err := db.CountEventsWithAppServiceID(ctx, ws.AppService.ID)
+	if err != nil {
+		log.Warnw("appservice worker unable to count queued events", log.KeysAndValues{"appservice", ws.AppService.ID, "error", err})
+		return
 	}
+	queueDepthGauge.WithLabelValues(ws.AppService.ID).Set(float64(count + ws.Ephemeral.Len()))
 }
 
-// backoff pauses the calling goroutine for a 2^some backoff exponent seconds
-func backoff(ws *types.ApplicationServiceWorkerState, err error) {
+// backoff pauses the calling worker for a 2^some backoff exponent seconds. It
+// only holds up this application service and returns false if ctx is done
+// before the backoff is over.
+func backoff(ctx context.Context, ws *types.ApplicationServiceWorkerState, err error) bool {
 	// Calculate how long to backoff for
 	backoffDuration := time.Duration(math.Pow(2, float64(ws.Backoff)))
 	backoffSeconds := time.Second * backoffDuration
@@ -134,60 +254,93 @@ func backoff(ws *types.ApplicationServiceWorkerState, err error) {
 	})
 
 	ws.Backoff++
-	if ws.Backoff > 6 {
-		ws.Backoff = 6
+	if ws.Backoff > maxBackoff {
+		ws.Backoff = maxBackoff
 	}
 
-	// Backoff
-	time.Sleep(backoffSeconds)
+	timer := time.NewTimer(backoffSeconds)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 // createTransaction takes in a slice of AS events, stores them in an AS
-// transaction, and JSON-encodes the results.
+// transaction along with any queued ephemeral events, and JSON-encodes the
+// results. Events that already belong to a transaction are always sent again
+// under that same transaction ID, so the application service can drop the
+// duplicate if it had already processed it before we crashed.
 func createTransaction(
 	ctx context.Context,
 	db model.AppServiceDatabase,
-	appserviceID string,
+	ws *types.ApplicationServiceWorkerState,
 ) (
 	transactionJSON []byte,
 	txnID, maxID int,
+	ephemeralEnd uint64,
 	eventsRemaining bool,
 	err error,
 ) {
+	appserviceID := ws.AppService.ID
+	batchSize := ws.AppService.TransactionBatchSize
+
 	// Retrieve the latest events from the DB (will return old events if they weren't successfully sent)
-	txnID, maxID, events, eventsRemaining, err := db.GetEventsWithAppServiceID(ctx, appserviceID, transactionBatchSize)
+	txnID, maxID, events, eventsRemaining, err := db.GetEventsWithAppServiceID(ctx, appserviceID, batchSize)
 	if err != nil {
-		log.Fatalw("appservice worker unable to read queued events from DB", log.KeysAndValues{"appservice", appserviceID, "error", err})
+		log.Errorw("appservice worker unable to read queued events from DB", log.KeysAndValues{"appservice", appserviceID, "error", err})
+		return nil, 0, 0, 0, false, err
+	}
 
-		return
+	// Ephemeral events are only added to new transactions, a transaction
+	// being retried must keep the content it was first sent with
+	var ephemeral []types.EphemeralEvent
+	if txnID == -1 || len(events) == 0 {
+		ephemeral, ephemeralEnd = ws.Ephemeral.Peek(batchSize)
 	}
 
-	// Check if these events do not already have a transaction ID
-	if txnID == -1 {
+	if len(events) == 0 && len(ephemeral) > 0 {
+		// Nothing in the DB, the transaction only carries ephemeral events
+		txnID, err = db.GetLatestTxnID(ctx)
+		if err != nil {
+			log.Errorw("get latest txnid error", log.KeysAndValues{"appservice", appserviceID, "error", err})
+			return nil, 0, 0, 0, false, err
+		}
+	} else if txnID == -1 {
 		// If not, grab next available ID from the DB
 		txnID, err = db.GetLatestTxnID(ctx)
 		if err != nil {
-			log.Fatalw("get latest txnid error", log.KeysAndValues{"appservice", appserviceID, "error", err})
-			fmt.Println("get latest txnid error")
-			return nil, 0, 0, false, err
+			log.Errorw("get latest txnid error", log.KeysAndValues{"appservice", appserviceID, "error", err})
+			return nil, 0, 0, 0, false, err
 		}
 
-		// Mark new events with current transactionID
+		// Mark new events with current transactionID before sending, so
+		// they are sent with this ID again after a restart
 		if err = db.UpdateTxnIDForEvents(ctx, appserviceID, maxID, txnID); err != nil {
-			log.Fatalw("update txnid error", log.KeysAndValues{"appservice", appserviceID, "error", err})
-			fmt.Println("update txnid error")
-			return nil, 0, 0, false, err
+			log.Errorw("update txnid error", log.KeysAndValues{"appservice", appserviceID, "error", err})
+			return nil, 0, 0, 0, false, err
 		}
 	}
 
 	// Create a transaction and store the events inside
-	transaction := gomatrixserverlib.ApplicationServiceTransaction{
+	transaction := types.ApplicationServiceTransaction{
 		Events: events,
 	}
+	if transaction.Events == nil {
+		transaction.Events = []gomatrixserverlib.ClientEvent{}
+	}
+	if ws.AppService.ReceiveEphemeral {
+		transaction.Ephemeral = ephemeral
+	}
+	if ws.AppService.PushEphemeral {
+		transaction.UnstableEphemeral = ephemeral
+	}
 
 	transactionJSON, err = json.Marshal(transaction)
 	if err != nil {
-		return
+		return nil, 0, 0, 0, false, err
 	}
 
 	return
@@ -197,23 +350,27 @@ func createTransaction(
 // received back from the application service or the request timed out.
 func send(
 	client *http.Client,
-	appservice config.ApplicationService,
+	ws *types.ApplicationServiceWorkerState,
 	txnID int,
 	transaction []byte,
 ) error {
 	if txnID == 0 {
 		return nil
 	}
+	appservice := ws.AppService
 
-	// POST a transaction to our AS
+	// PUT a transaction to our AS
 	address := fmt.Sprintf("%s/transactions/%d?access_token=%s", appservice.URL, txnID, appservice.HSToken)
 
 	req, err := http.NewRequest("PUT", address, bytes.NewBuffer(transaction))
+	if err != nil {
+		return err
+	}
 	req.Header.Add("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
 
-	log.Infow("send requset "+address, log.KeysAndValues{"appservice", appservice.ID})
+	log.Infow(fmt.Sprintf("send transaction %d", txnID), log.KeysAndValues{"appservice", appservice.ID})
 
 	if err != nil {
 		return err
@@ -227,8 +384,8 @@ func send(
 
 	//Check the AS received the events correctly
 	if resp.StatusCode != http.StatusOK {
-		// TODO: Handle non-200 error codes from application services
-		return fmt.Errorf("non-OK status code %d returned from AS", resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("non-OK status code %d returned from AS: %s", resp.StatusCode, body)
 	}
 
 	return nil
@@ -0,0 +1,181 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package retentionmgr
+
+import (
+	"context"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/purge"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/model/types"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const roomsPageSize = 500
+
+// RetentionMgr periodically purges the history older than the max_lifetime
+// of the m.room.retention policy of each room, or of the server default.
+type RetentionMgr struct {
+	cfg       *config.Dendrite
+	roomDB    model.RoomServerDatabase
+	syncDB    model.SyncAPIDatabase
+	cache     service.Cache
+	rpcClient *common.RpcClient
+}
+
+func NewRetentionMgr(
+	cfg *config.Dendrite,
+	roomDB model.RoomServerDatabase,
+	syncDB model.SyncAPIDatabase,
+	cache service.Cache,
+	rpcClient *common.RpcClient,
+) *RetentionMgr {
+	return &RetentionMgr{
+		cfg:       cfg,
+		roomDB:    roomDB,
+		syncDB:    syncDB,
+		cache:     cache,
+		rpcClient: rpcClient,
+	}
+}
+
+func (rm *RetentionMgr) Start() {
+	if !rm.cfg.Retention.Enabled {
+		return
+	}
+	interval := rm.cfg.Retention.ScanInterval
+	if interval <= 0 {
+		interval = 3600000
+	}
+	go func() {
+		t := time.NewTicker(time.Millisecond * time.Duration(interval))
+		for {
+			select {
+			case <-t.C:
+				if !rm.lockInterval(interval) {
+					continue
+				}
+				func() {
+					span, ctx := common.StartSobSomSpan(context.Background(), "RetentionMgr.Start")
+					defer span.Finish()
+					rm.purgeExpired(ctx)
+				}()
+			}
+		}
+	}()
+}
+
+// lockInterval elects the instance which purges during this interval. Every
+// front and monolith server runs a RetentionMgr, the lock is never released
+// but expires with the interval, so the other servers skip their ticks
+// until then.
+func (rm *RetentionMgr) lockInterval(interval int64) bool {
+	expire := int(interval / 1000)
+	if expire < 1 {
+		expire = 1
+	}
+	if _, err := rm.cache.Lock(types.LOCK_RETENTION_PURGE, expire, -1); err != nil {
+		log.Debugf("retention purge runs on another server: %v", err)
+		return false
+	}
+	return true
+}
+
+// maxLifetime returns how long the history of a room is kept, 0 keeps it
+// forever. content is nil for a room without a policy.
+func (rm *RetentionMgr) maxLifetime(content *common.RetentionContent) int64 {
+	cfg := &rm.cfg.Retention
+	minLifetime, maxLifetime := cfg.DefaultMinLifetime, cfg.DefaultMaxLifetime
+	if content != nil {
+		if content.MinLifetime != nil {
+			minLifetime = *content.MinLifetime
+		}
+		if content.MaxLifetime != nil {
+			maxLifetime = *content.MaxLifetime
+		}
+	}
+	if maxLifetime <= 0 {
+		return 0
+	}
+	if cfg.AllowedLifetimeMin > 0 && maxLifetime < cfg.AllowedLifetimeMin {
+		maxLifetime = cfg.AllowedLifetimeMin
+	}
+	if cfg.AllowedLifetimeMax > 0 && maxLifetime > cfg.AllowedLifetimeMax {
+		maxLifetime = cfg.AllowedLifetimeMax
+	}
+	if maxLifetime < minLifetime {
+		maxLifetime = minLifetime
+	}
+	return maxLifetime
+}
+
+func (rm *RetentionMgr) purgeExpired(ctx context.Context) {
+	lifetimes := map[string]int64{}
+	if rm.cfg.Retention.DefaultMaxLifetime > 0 {
+		defaultLifetime := rm.maxLifetime(nil)
+		for offset := 0; ; offset += roomsPageSize {
+			rooms, err := rm.roomDB.GetAllRooms(ctx, roomsPageSize, offset)
+			if err != nil {
+				log.Errorf("retention load rooms offset:%d err:%v", offset, err)
+				return
+			}
+			for _, room := range rooms {
+				lifetimes[room.RoomID] = defaultLifetime
+			}
+			if len(rooms) < roomsPageSize {
+				break
+			}
+		}
+	}
+	roomIDs, events, err := rm.syncDB.SelectRoomsStateByType(ctx, "m.room.retention")
+	if err != nil {
+		log.Errorf("retention load room policies err:%v", err)
+		return
+	}
+	for i, ev := range events {
+		var content common.RetentionContent
+		if err := json.Unmarshal([]byte(ev.Content), &content); err != nil {
+			log.Warnf("retention room:%s invalid policy err:%v", roomIDs[i], err)
+			continue
+		}
+		lifetimes[roomIDs[i]] = rm.maxLifetime(&content)
+	}
+
+	now := time.Now().UnixNano() / 1000000
+	for roomID, lifetime := range lifetimes {
+		if lifetime <= 0 {
+			continue
+		}
+		deleted, err := purge.RoomEventsBefore(ctx, rm.roomDB, rm.syncDB, rm.cache, rm.rpcClient, roomID, now-lifetime, nil)
+		if err == purge.ErrRoomLegalHold {
+			log.Infof("retention skip room:%s under legal hold", roomID)
+			continue
+		}
+		if err != nil {
+			log.Errorf("retention purge room:%s err:%v", roomID, err)
+			continue
+		}
+		if deleted > 0 {
+			log.Infof("retention purge room:%s lifetime:%d deleted:%d", roomID, lifetime, deleted)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package retentionmgr
+
+import (
+	"testing"
+
+	"github.com/finogeeks/ligase/cache"
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestMaxLifetime(t *testing.T) {
+	cfg := &config.Dendrite{}
+	cfg.Retention.DefaultMinLifetime = 1000
+	cfg.Retention.DefaultMaxLifetime = 50000
+	cfg.Retention.AllowedLifetimeMin = 10000
+	cfg.Retention.AllowedLifetimeMax = 100000
+	rm := NewRetentionMgr(cfg, nil, nil, nil, nil)
+
+	cases := []struct {
+		name    string
+		content *common.RetentionContent
+		want    int64
+	}{
+		{"no policy", nil, 50000},
+		{"within bounds", &common.RetentionContent{MaxLifetime: int64Ptr(20000)}, 20000},
+		{"below allowed min", &common.RetentionContent{MaxLifetime: int64Ptr(10)}, 10000},
+		{"above allowed max", &common.RetentionContent{MaxLifetime: int64Ptr(1000000)}, 100000},
+		{"raised to min_lifetime", &common.RetentionContent{MinLifetime: int64Ptr(30000), MaxLifetime: int64Ptr(20000)}, 30000},
+		{"keeps forever", &common.RetentionContent{MaxLifetime: int64Ptr(0)}, 0},
+		{"only min_lifetime", &common.RetentionContent{MinLifetime: int64Ptr(2000)}, 50000},
+	}
+	for _, c := range cases {
+		if got := rm.maxLifetime(c.content); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+
+	// without a default policy a room without its own keeps its history
+	cfg.Retention.DefaultMaxLifetime = 0
+	if got := rm.maxLifetime(nil); got != 0 {
+		t.Errorf("no default: got %d, want 0", got)
+	}
+}
+
+func TestLockInterval(t *testing.T) {
+	rc := &cache.RedisCache{}
+	if err := rc.Prepare(config.RedisConf{Mode: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Dendrite{}
+	first := NewRetentionMgr(cfg, nil, nil, rc, nil)
+	second := NewRetentionMgr(cfg, nil, nil, rc, nil)
+	if !first.lockInterval(60000) {
+		t.Fatal("the first server must purge")
+	}
+	if second.lockInterval(60000) {
+		t.Fatal("only one server may purge during an interval")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	BLOCKED_ROOMS_KEY    = "blocked_rooms"
+	PURGE_HISTORY_PREFIX = "purge_history"
+)
+
+// SetRoomBlocked marks the room as blocked by the admin userID. The roomserver
+// table is the durable copy, this one is read on every join and invite.
+func (rc *RedisCache) SetRoomBlocked(roomID, userID string) error {
+	return rc.HSet(BLOCKED_ROOMS_KEY, roomID, userID)
+}
+
+func (rc *RedisCache) DelRoomBlocked(roomID string) error {
+	return rc.HDel(BLOCKED_ROOMS_KEY, roomID)
+}
+
+// GetRoomBlocked returns the admin who blocked the room, "" if it is not
+// blocked
+func (rc *RedisCache) GetRoomBlocked(roomID string) (string, error) {
+	userID, err := rc.HGetString(BLOCKED_ROOMS_KEY, roomID)
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return userID, err
+}
+
+func (rc *RedisCache) SetPurgeHistoryStatus(purgeID string, status interface{}, expire int64) error {
+	key := fmt.Sprintf("%s:%s", PURGE_HISTORY_PREFIX, purgeID)
+	return rc.Set(key, status, expire)
+}
+
+// GetPurgeHistoryStatus returns the json status of the purge, nil if the
+// purge is unknown or expired
+func (rc *RedisCache) GetPurgeHistoryStatus(purgeID string) ([]byte, error) {
+	key := fmt.Sprintf("%s:%s", PURGE_HISTORY_PREFIX, purgeID)
+	status, err := redis.Bytes(rc.Get(key))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	return status, err
+}
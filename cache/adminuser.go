@@ -0,0 +1,39 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"github.com/gomodule/redigo/redis"
+)
+
+const SHADOW_BANNED_USERS_KEY = "shadow_banned_users"
+
+// SetUserShadowBanned marks the user as shadow banned. The account table is
+// the durable copy, this one is read on every send.
+func (rc *RedisCache) SetUserShadowBanned(userID string) error {
+	return rc.HSet(SHADOW_BANNED_USERS_KEY, userID, 1)
+}
+
+func (rc *RedisCache) DelUserShadowBanned(userID string) error {
+	return rc.HDel(SHADOW_BANNED_USERS_KEY, userID)
+}
+
+func (rc *RedisCache) GetUserShadowBanned(userID string) (bool, error) {
+	_, err := rc.HGetString(SHADOW_BANNED_USERS_KEY, userID)
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/finogeeks/ligase/model/types"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	DEVICE_LAST_SEEN_PREFIX = "device_last_seen"
+	// users that stay away for longer are shown without connections
+	deviceLastSeenExpire = 30 * 24 * 3600
+)
+
+func deviceLastSeenKey(userID string) string {
+	return fmt.Sprintf("%s:%s", DEVICE_LAST_SEEN_PREFIX, userID)
+}
+
+func (rc *RedisCache) SetDeviceLastSeen(userID, deviceID string, lastSeen *types.DeviceLastSeen) error {
+	key := deviceLastSeenKey(userID)
+	if err := rc.HSet(key, deviceID, lastSeen); err != nil {
+		return err
+	}
+	return rc.Expire(key, deviceLastSeenExpire)
+}
+
+// GetDevicesLastSeen returns the last connection of each device of the user,
+// keyed by device id
+func (rc *RedisCache) GetDevicesLastSeen(userID string) (map[string]*types.DeviceLastSeen, error) {
+	values, err := redis.StringMap(rc.SafeDo("HGETALL", deviceLastSeenKey(userID)))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*types.DeviceLastSeen, len(values))
+	for deviceID, value := range values {
+		var lastSeen types.DeviceLastSeen
+		if err := json.Unmarshal([]byte(value), &lastSeen); err != nil {
+			return nil, err
+		}
+		result[deviceID] = &lastSeen
+	}
+	return result, nil
+}
+
+func (rc *RedisCache) DelDeviceLastSeen(userID, deviceID string) error {
+	return rc.HDel(deviceLastSeenKey(userID), deviceID)
+}
@@ -77,26 +77,31 @@ func (rc *RedisCache) doLock(lockKey, token string, expire, retry int) bool {
 	return false
 }
 
+// The token is compared and the key deleted in one step, a lock that
+// expired and was taken by another holder meanwhile is left alone. The
+// script only touches KEYS[1], so it runs on any redis deployment.
+const scriptDelIfEqual = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+var delIfEqualScript = redis.NewScript(1, scriptDelIfEqual)
+
 func (rc *RedisCache) UnLock(lockKey, token string, force bool) (err error) {
 	if force {
 		return rc.Del(lockKey)
 	}
-	val, err := rc.Get(lockKey)
+	conn := rc.pool().Get()
+	defer conn.Close()
+	deleted, err := redis.Int(delIfEqualScript.Do(conn, lockKey, token))
 	if err != nil {
-		log.Errorf("unlock get lock key:%s token faild with redis err:%v", lockKey, err)
+		log.Errorf("unlock key:%s faild with redis err:%v", lockKey, err)
 		return err
 	}
-	lockToken, e := String(val, err)
-	if e != nil {
-		if e == redis.ErrNil {
-			log.Warnf("unlock parse lock key:%s token has expired", lockKey)
-		} else {
-			log.Errorf("unlock parse lock key:%s token faild with err:%v", lockKey, e)
-		}
-		return e
-	}
-	if lockToken != token {
-		return errors.New(fmt.Sprintf("unlock key:%s token:%s is not equal lock token:%s unlock failed", lockKey, token, lockToken))
+	if deleted == 0 {
+		return errors.New(fmt.Sprintf("unlock key:%s token:%s has expired or is held by another token, unlock failed", lockKey, token))
 	}
-	return rc.Del(lockKey)
+	return nil
 }
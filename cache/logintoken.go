@@ -0,0 +1,80 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func loginTokenKey(token string) string {
+	return fmt.Sprintf("login_token:%s", token)
+}
+
+func samlRequestKey(id string) string {
+	return fmt.Sprintf("saml_request:%s", id)
+}
+
+func samlAssertionKey(id string) string {
+	return fmt.Sprintf("saml_assertion:%s", id)
+}
+
+// SetLoginToken stores the user a m.login.token was issued to, expire is in
+// milliseconds
+func (rc *RedisCache) SetLoginToken(token, userID string, expire int64) error {
+	_, err := rc.SafeDo("SET", loginTokenKey(token), userID, "PX", expire)
+	return err
+}
+
+// TakeLoginToken returns the user a m.login.token was issued to and deletes
+// it, an empty string is returned once it was used or expired
+func (rc *RedisCache) TakeLoginToken(token string) (string, error) {
+	key := loginTokenKey(token)
+	userID, err := redis.String(rc.SafeDo("GET", key))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// only the request which deleted the token may use it
+	deleted, err := redis.Int(rc.SafeDo("DEL", key))
+	if err != nil || deleted == 0 {
+		return "", err
+	}
+	return userID, nil
+}
+
+// AddSAMLRequest records the id of an AuthnRequest sent to the identity
+// provider, expire is in milliseconds
+func (rc *RedisCache) AddSAMLRequest(id string, expire int64) error {
+	_, err := rc.SafeDo("SET", samlRequestKey(id), 1, "PX", expire)
+	return err
+}
+
+// TakeSAMLRequest tells if the AuthnRequest id was sent and not answered yet,
+// it is true once only
+func (rc *RedisCache) TakeSAMLRequest(id string) (bool, error) {
+	deleted, err := redis.Int(rc.SafeDo("DEL", samlRequestKey(id)))
+	return deleted > 0, err
+}
+
+// AddSAMLAssertion records the id of an accepted assertion, false is returned
+// if it was already, expire is in milliseconds
+func (rc *RedisCache) AddSAMLAssertion(id string, expire int64) (bool, error) {
+	reply, err := rc.SafeDo("SET", samlAssertionKey(id), 1, "PX", expire, "NX")
+	return reply != nil, err
+}
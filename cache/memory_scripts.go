@@ -0,0 +1,156 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/finogeeks/ligase/common/redispool"
+	"github.com/gomodule/redigo/redis"
+)
+
+// The scripts of the cache in go, for the memory mode of redispool. They do
+// what the lua does, step by step.
+func init() {
+	redispool.RegisterScript(scriptTakeToken, takeTokenMemory)
+	redispool.RegisterScript(scriptDelIfEqual, delIfEqualMemory)
+	redispool.RegisterScript(scriptSwapRefreshToken, swapRefreshTokenMemory)
+	redispool.RegisterScript(scriptTakeRefreshToken, takeRefreshTokenMemory)
+	redispool.RegisterScript(scriptIncrFedRoomPending, incrFedRoomPendingMemory)
+	redispool.RegisterScript(scriptIncrFedRoomDomainOffset, incrFedRoomDomainOffsetMemory)
+	redispool.RegisterScript(scriptStoreFedBackfillRec, storeFedBackfillRecMemory)
+	redispool.RegisterScript(scriptUpdateFedBackfillRec, updateFedBackfillRecMemory)
+}
+
+type redisCall = func(cmd string, args ...interface{}) (interface{}, error)
+
+func takeTokenMemory(call redisCall, keys, args []string) (interface{}, error) {
+	rate, _ := strconv.ParseFloat(args[0], 64)
+	burst, _ := strconv.ParseFloat(args[1], 64)
+	now := float64(time.Now().UnixNano() / int64(time.Millisecond))
+	bucket, err := redis.Strings(call("HMGET", keys[0], "tokens", "ts"))
+	if err != nil {
+		return nil, err
+	}
+	tokens, err1 := strconv.ParseFloat(bucket[0], 64)
+	ts, err2 := strconv.ParseFloat(bucket[1], 64)
+	if err1 != nil || err2 != nil {
+		tokens = burst
+		ts = now
+	}
+	tokens = math.Min(burst, tokens+math.Max(0, now-ts)*rate/1000)
+	retry := 0.0
+	if tokens >= 1 {
+		tokens = tokens - 1
+	} else {
+		retry = math.Ceil((1 - tokens) * 1000 / rate)
+	}
+	if _, err = call("HMSET", keys[0], "tokens", strconv.FormatFloat(tokens, 'f', -1, 64), "ts", int64(now)); err != nil {
+		return nil, err
+	}
+	if _, err = call("PEXPIRE", keys[0], int64(math.Ceil(burst*1000/rate))+1000); err != nil {
+		return nil, err
+	}
+	return int64(retry), nil
+}
+
+func delIfEqualMemory(call redisCall, keys, args []string) (interface{}, error) {
+	v, err := redis.String(call("GET", keys[0]))
+	if err == nil && v == args[0] {
+		return call("DEL", keys[0])
+	}
+	if err != nil && err != redis.ErrNil {
+		return nil, err
+	}
+	return int64(0), nil
+}
+
+func swapRefreshTokenMemory(call redisCall, keys, args []string) (interface{}, error) {
+	old, err := call("GETSET", keys[0], args[0])
+	if err != nil {
+		return nil, err
+	}
+	if expire, _ := strconv.ParseInt(args[1], 10, 64); expire > 0 {
+		if _, err = call("PEXPIRE", keys[0], expire); err != nil {
+			return nil, err
+		}
+	}
+	return old, nil
+}
+
+func takeRefreshTokenMemory(call redisCall, keys, args []string) (interface{}, error) {
+	dev, err := redis.Values(call("HGETALL", keys[0]))
+	if err != nil {
+		return nil, err
+	}
+	if len(dev) > 0 {
+		if _, err = call("DEL", keys[0]); err != nil {
+			return nil, err
+		}
+	}
+	return dev, nil
+}
+
+func incrFedRoomPendingMemory(call redisCall, keys, args []string) (interface{}, error) {
+	exists, err := redis.Int(call("EXISTS", keys[0]))
+	if err != nil || exists == 0 {
+		return int64(0), err
+	}
+	if _, err = call("HINCRBY", keys[0], "pendingSize", args[0]); err != nil {
+		return nil, err
+	}
+	return int64(1), nil
+}
+
+func incrFedRoomDomainOffsetMemory(call redisCall, keys, args []string) (interface{}, error) {
+	exists, err := redis.Int(call("EXISTS", keys[0]))
+	if err != nil || exists == 0 {
+		return nil, err
+	}
+	if _, err = call("HMSET", keys[0], "domainOffset", args[0], "eventID", args[1]); err != nil {
+		return nil, err
+	}
+	pendingSize, err := call("HINCRBY", keys[0], "pendingSize", args[2])
+	if err != nil {
+		return nil, err
+	}
+	if _, err = call("HINCRBY", keys[0], "sendTimes", 1); err != nil {
+		return nil, err
+	}
+	return pendingSize, nil
+}
+
+// setFedBackfillRecMemory writes the record when its existence is exists
+func setFedBackfillRecMemory(call redisCall, keys, args []string, exists int) (interface{}, error) {
+	n, err := redis.Int(call("EXISTS", keys[0]))
+	if err != nil || n != exists {
+		return int64(0), err
+	}
+	_, err = call("HMSET", keys[0], "depth", args[0], "finished", args[1], "finishedDomains", args[2], "states", args[3])
+	if err != nil {
+		return nil, err
+	}
+	return int64(1), nil
+}
+
+func storeFedBackfillRecMemory(call redisCall, keys, args []string) (interface{}, error) {
+	return setFedBackfillRecMemory(call, keys, args, 0)
+}
+
+func updateFedBackfillRecMemory(call redisCall, keys, args []string) (interface{}, error) {
+	return setFedBackfillRecMemory(call, keys, args, 1)
+}
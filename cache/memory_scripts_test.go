@@ -0,0 +1,149 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/authtypes"
+)
+
+// The scripts run on the memory store of redispool, as the monolith-server
+// does in one process
+func newMemoryCache(t *testing.T) *RedisCache {
+	rc := &RedisCache{}
+	if err := rc.Prepare(config.RedisConf{Mode: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	return rc
+}
+
+func TestMemoryLock(t *testing.T) {
+	rc := newMemoryCache(t)
+	token, err := rc.Lock("TestMemoryLock", 10, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rc.Lock("TestMemoryLock", 10, -1); err == nil {
+		t.Fatal("locked twice")
+	}
+	if err = rc.UnLock("TestMemoryLock", "other", false); err == nil {
+		t.Fatal("unlocked with another token")
+	}
+	if err = rc.UnLock("TestMemoryLock", token, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryRateLimit(t *testing.T) {
+	rc := newMemoryCache(t)
+	for i := 0; i < 2; i++ {
+		if retry, err := rc.TakeRateLimitToken("TestMemoryRateLimit", 1, 2); retry != 0 || err != nil {
+			t.Fatalf("token %d: %d %v", i, retry, err)
+		}
+	}
+	if retry, err := rc.TakeRateLimitToken("TestMemoryRateLimit", 1, 2); retry <= 0 || retry > 1000 || err != nil {
+		t.Fatalf("empty bucket: %d %v", retry, err)
+	}
+}
+
+func TestMemoryRefreshToken(t *testing.T) {
+	rc := newMemoryCache(t)
+	dev := &authtypes.Device{ID: "DEV", UserID: "@TestMemoryRefreshToken:a", IsHuman: true}
+	if err := rc.SetRefreshToken("one", dev, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.SetRefreshToken("two", dev, 60000); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rc.TakeRefreshToken("one"); got != nil || err != nil {
+		t.Fatalf("replaced token: %v %v", got, err)
+	}
+	got, err := rc.TakeRefreshToken("two")
+	if err != nil || got == nil || got.UserID != dev.UserID || !got.IsHuman {
+		t.Fatalf("token: %+v %v", got, err)
+	}
+	if got, _ = rc.TakeRefreshToken("two"); got != nil {
+		t.Fatal("token taken twice")
+	}
+}
+
+func TestMemoryDelUserRefreshTokens(t *testing.T) {
+	rc := newMemoryCache(t)
+	userID := "@TestMemoryDelUserRefreshTokens:a"
+	for _, id := range []string{"A", "B"} {
+		if err := rc.SetRefreshToken("TestMemoryDelUserRefreshTokens"+id, &authtypes.Device{ID: id, UserID: userID}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rc.DelUserRefreshTokens(userID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"A", "B"} {
+		if got, err := rc.TakeRefreshToken("TestMemoryDelUserRefreshTokens" + id); got != nil || err != nil {
+			t.Fatalf("token of %s kept: %v %v", id, got, err)
+		}
+	}
+}
+
+func TestMemoryFedScripts(t *testing.T) {
+	rc := newMemoryCache(t)
+	if loaded, err := rc.StoreFedBackfillRec("!TestMemoryFedScripts", 3, false, "a", "s"); loaded || err != nil {
+		t.Fatalf("store: %v %v", loaded, err)
+	}
+	if loaded, _ := rc.StoreFedBackfillRec("!TestMemoryFedScripts", 4, false, "a", "s"); !loaded {
+		t.Fatal("stored twice")
+	}
+	if _, err := rc.UpdateFedBackfillRec("!TestMemoryFedScripts", 5, true, "a,b", "s"); err != nil {
+		t.Fatal(err)
+	}
+	depth, finished, domains, _, err := rc.GetFedBackfillRec("!TestMemoryFedScripts")
+	if err != nil || depth != 5 || !finished || domains != "a,b" {
+		t.Fatalf("record: %d %v %s %v", depth, finished, domains, err)
+	}
+
+	if err := rc.StoreFedSendRec("!TestMemoryFedScripts", "b", "", 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.IncrFedRoomPending("!TestMemoryFedScripts", "b", 2); err != nil {
+		t.Fatal(err)
+	}
+	pending := func() bool {
+		rooms, err := rc.QryFedPendingRooms()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, room := range rooms {
+			if room == "!TestMemoryFedScripts|b" {
+				return true
+			}
+		}
+		return false
+	}
+	if err := rc.IncrFedRoomDomainOffset("!TestMemoryFedScripts", "b", "$e", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !pending() {
+		t.Fatal("room left the pending set with events to send")
+	}
+	// the last sent event takes the room out of the pending set
+	if err := rc.IncrFedRoomDomainOffset("!TestMemoryFedScripts", "b", "$f", 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if pending() {
+		t.Fatal("room still pending without events to send")
+	}
+}
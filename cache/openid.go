@@ -0,0 +1,42 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func openIDTokenKey(token string) string {
+	return fmt.Sprintf("openid:%s", token)
+}
+
+// SetOpenIDToken stores the user an OpenID token was issued to, expire is in
+// milliseconds
+func (rc *RedisCache) SetOpenIDToken(token, userID string, expire int64) error {
+	_, err := rc.SafeDo("SET", openIDTokenKey(token), userID, "PX", expire)
+	return err
+}
+
+// GetOpenIDToken returns the user an OpenID token was issued to, or an empty
+// string once it expired
+func (rc *RedisCache) GetOpenIDToken(token string) (string, error) {
+	userID, err := redis.String(rc.SafeDo("GET", openIDTokenKey(token)))
+	if err == redis.ErrNil {
+		return "", nil
+	}
+	return userID, err
+}
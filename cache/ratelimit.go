@@ -0,0 +1,63 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// The bucket is refilled from the redis clock so that proxies with skewed
+// clocks still share one bucket. Returns 0 when a token was taken, otherwise
+// the number of milliseconds until the next token is available.
+const scriptTakeToken = `
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	retry = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return retry
+`
+
+var takeTokenScript = redis.NewScript(1, scriptTakeToken)
+
+// TakeRateLimitToken takes one token from the bucket stored at key, creating
+// a full bucket if there is none. It returns 0 if the token was taken, or how
+// many milliseconds the caller has to wait before retrying.
+func (rc *RedisCache) TakeRateLimitToken(key string, perSecond float64, burst int) (int64, error) {
+	conn := rc.pool().Get()
+	defer conn.Close()
+
+	return redis.Int64(takeTokenScript.Do(conn, "ratelimit:"+key, strconv.FormatFloat(perSecond, 'f', -1, 64), burst))
+}
@@ -15,6 +15,7 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -22,6 +23,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/health"
+	"github.com/finogeeks/ligase/common/redispool"
 	"github.com/finogeeks/ligase/model/authtypes"
 	push "github.com/finogeeks/ligase/model/pushapitypes"
 	e2e "github.com/finogeeks/ligase/model/types"
@@ -30,8 +34,7 @@ import (
 )
 
 type RedisCache struct {
-	pools    []*redis.Pool
-	poolSize int
+	connPool *redis.Pool
 }
 
 type DeviceInfo struct {
@@ -44,25 +47,21 @@ type DeviceInfo struct {
 	lastTouchTime int64
 }
 
-func (rc *RedisCache) Prepare(cfg []string) (err error) {
-	rc.poolSize = len(cfg)
-	rc.pools = make([]*redis.Pool, rc.poolSize)
-	for i := 0; i < rc.poolSize; i++ {
-		addr := cfg[i]
-		rc.pools[i] = &redis.Pool{
-			MaxIdle:     200,
-			MaxActive:   200,
-			Wait:        true,
-			IdleTimeout: 240 * time.Second,
-			Dial:        func() (redis.Conn, error) { return redis.DialURL(addr) },
-		}
+func (rc *RedisCache) Prepare(cfg config.RedisConf) (err error) {
+	rc.connPool, err = redispool.NewPool(cfg)
+	if err == nil {
+		health.Register("redis", rc.ping)
 	}
 	return err
 }
 
+func (rc *RedisCache) ping(ctx context.Context) error {
+	_, err := rc.SafeDo("PING")
+	return err
+}
+
 func (rc *RedisCache) pool() *redis.Pool {
-	slot := rand.Int() % rc.poolSize
-	return rc.pools[slot]
+	return rc.connPool
 }
 
 func (rc *RedisCache) SafeDo(commandName string, args ...interface{}) (reply interface{}, err error) {
@@ -1180,12 +1179,9 @@ func (rc *RedisCache) GetFedSendRec(roomID, domain string) (eventID string, send
 	return
 }
 
-func (rc *RedisCache) IncrFedRoomPending(roomID, domain string, amt int) error {
-	conn := rc.pool().Get()
-	defer conn.Close()
-
-	const SCRIPT_INCR = `
-redis.call('SADD', 'fedsender:pendding', ARGV[2])
+// scripts may only touch KEYS, the pending set is updated on its own as
+// it is not in the slot of the record
+const scriptIncrFedRoomPending = `
 if redis.call('EXISTS', KEYS[1]) == 1 then
 	redis.call('HINCRBY', KEYS[1], 'pendingSize', ARGV[1])
 	return 1
@@ -1193,30 +1189,46 @@ else
 	return 0
 end
 `
-	lua := redis.NewScript(1, SCRIPT_INCR)
-	_, err := lua.Do(conn, "fedsend:"+roomID+":"+domain, amt, roomID+"|"+domain)
-	return err
-}
 
-func (rc *RedisCache) IncrFedRoomDomainOffset(roomID, domain, eventID string, domainOffset int64, penddingDecr int32) error {
+func (rc *RedisCache) IncrFedRoomPending(roomID, domain string, amt int) error {
 	conn := rc.pool().Get()
 	defer conn.Close()
 
-	const SCRIPT_INCR = `
+	err := conn.Send("SADD", "fedsender:pendding", roomID+"|"+domain)
+	if err != nil {
+		return err
+	}
+	lua := redis.NewScript(1, scriptIncrFedRoomPending)
+	_, err = lua.Do(conn, "fedsend:"+roomID+":"+domain, amt)
+	return err
+}
+
+const scriptIncrFedRoomDomainOffset = `
 if redis.call('EXISTS', KEYS[1]) == 1 then
 	redis.call('HMSET', KEYS[1], 'domainOffset', ARGV[1], "eventID", ARGV[2])
 	local pendingSize = redis.call('HINCRBY',KEYS[1], 'pendingSize', ARGV[3])
-	if pendingSize <= 0 then
-		redis.call('SREM', 'fedsender:pendding', ARGV[4])
-	end
 	redis.call('HINCRBY', KEYS[1], 'sendTimes', 1)
-	return 1
+	return pendingSize
 else
-	return 0
+	return false
 end
 `
-	lua := redis.NewScript(1, SCRIPT_INCR)
-	err := lua.Send(conn, "fedsend:"+roomID+":"+domain, domainOffset, eventID, -penddingDecr, roomID+"|"+domain)
+
+func (rc *RedisCache) IncrFedRoomDomainOffset(roomID, domain, eventID string, domainOffset int64, penddingDecr int32) error {
+	conn := rc.pool().Get()
+	defer conn.Close()
+
+	lua := redis.NewScript(1, scriptIncrFedRoomDomainOffset)
+	pendingSize, err := redis.Int64(lua.Do(conn, "fedsend:"+roomID+":"+domain, domainOffset, eventID, -penddingDecr))
+	if err == redis.ErrNil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if pendingSize <= 0 {
+		_, err = conn.Do("SREM", "fedsender:pendding", roomID+"|"+domain)
+	}
 	return err
 }
 
@@ -1314,19 +1326,20 @@ func (rc *RedisCache) QryFedBackfillRooms() ([]string, error) {
 	return roomIDs, nil
 }
 
-func (rc *RedisCache) StoreFedBackfillRec(roomID string, depth int64, finished bool, finishedDomains string, states string) (loaded bool, err error) {
-	conn := rc.pool().Get()
-	defer conn.Close()
-
-	const SCRIPT_INCR = `
+const scriptStoreFedBackfillRec = `
 if redis.call('EXISTS', KEYS[1]) == 0 then
-	redis.call('HMSET', KEYS[1], 'depth', ARGV[1], 'finished', ARGV[2], 'finishedDomains', ARGV[3], 'states': ARGV4)
+	redis.call('HMSET', KEYS[1], 'depth', ARGV[1], 'finished', ARGV[2], 'finishedDomains', ARGV[3], 'states', ARGV[4])
 	return 1
 else
 	return 0
 end
 `
-	lua := redis.NewScript(1, SCRIPT_INCR)
+
+func (rc *RedisCache) StoreFedBackfillRec(roomID string, depth int64, finished bool, finishedDomains string, states string) (loaded bool, err error) {
+	conn := rc.pool().Get()
+	defer conn.Close()
+
+	lua := redis.NewScript(1, scriptStoreFedBackfillRec)
 	reply, err := redis.Int(lua.Do(conn, "fedbackfill:"+roomID, depth, finished, finishedDomains, states))
 	if err != nil {
 		return false, err
@@ -1334,19 +1347,20 @@ end
 	return reply == 0, nil
 }
 
-func (rc *RedisCache) UpdateFedBackfillRec(roomID string, depth int64, finished bool, finishedDomains string, states string) (updated bool, err error) {
-	conn := rc.pool().Get()
-	defer conn.Close()
-
-	const SCRIPT_INCR = `
+const scriptUpdateFedBackfillRec = `
 if redis.call('EXISTS', KEYS[1]) == 1 then
-	redis.call('HMSET', KEYS[1], 'depth', ARGV[1], 'finished', ARGV[2], 'finishedDomains', ARGV[3], 'states': ARGV4)
+	redis.call('HMSET', KEYS[1], 'depth', ARGV[1], 'finished', ARGV[2], 'finishedDomains', ARGV[3], 'states', ARGV[4])
 	return 1
 else
 	return 0
 end
 `
-	lua := redis.NewScript(1, SCRIPT_INCR)
+
+func (rc *RedisCache) UpdateFedBackfillRec(roomID string, depth int64, finished bool, finishedDomains string, states string) (updated bool, err error) {
+	conn := rc.pool().Get()
+	defer conn.Close()
+
+	lua := redis.NewScript(1, scriptUpdateFedBackfillRec)
 	reply, err := redis.Int(lua.Do(conn, "fedbackfill:"+roomID, depth, finished, finishedDomains, states))
 	if err != nil {
 		return false, err
@@ -0,0 +1,160 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/gomodule/redigo/redis"
+)
+
+// A device holds at most one refresh token, storing a new one drops the old.
+// The device key is swapped atomically and returns the token it held.
+// KEYS[1] device key, ARGV[1] token, ARGV[2] expire in ms
+const scriptSwapRefreshToken = `
+local old = redis.call('GETSET', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return old
+`
+
+// Refresh tokens are single use, the token is read and dropped atomically so
+// two concurrent refreshes cannot both succeed.
+const scriptTakeRefreshToken = `
+local dev = redis.call('HGETALL', KEYS[1])
+if #dev > 0 then
+	redis.call('DEL', KEYS[1])
+end
+return dev
+`
+
+// The scripts only touch their KEYS, the token and device keys are not in
+// the same slot of a redis cluster.
+var (
+	swapRefreshTokenScript = redis.NewScript(1, scriptSwapRefreshToken)
+	takeRefreshTokenScript = redis.NewScript(1, scriptTakeRefreshToken)
+)
+
+func refreshTokenKey(token string) string {
+	return fmt.Sprintf("refreshtoken:%s", token)
+}
+
+// the devices of a user holding a refresh token, so that all of them can be
+// revoked without knowing the devices
+func refreshTokenUserKey(userID string) string {
+	return fmt.Sprintf("refreshtoken_user:%s", userID)
+}
+
+func refreshTokenDeviceKey(userID, deviceID string) string {
+	return fmt.Sprintf("refreshtoken_dev:%s:%s", userID, deviceID)
+}
+
+// SetRefreshToken stores the device a refresh token was issued to. expire is
+// in milliseconds, 0 keeps the token until it is used or the device is gone.
+func (rc *RedisCache) SetRefreshToken(token string, dev *authtypes.Device, expire int64) error {
+	conn := rc.pool().Get()
+	defer conn.Close()
+
+	key := refreshTokenKey(token)
+	err := conn.Send("HMSET", key, "user_id", dev.UserID, "device_id", dev.ID, "device_type", dev.DeviceType,
+		"identifier", dev.Identifier, "human", strconv.FormatBool(dev.IsHuman))
+	if err != nil {
+		return err
+	}
+	if expire > 0 {
+		if err := conn.Send("PEXPIRE", key, expire); err != nil {
+			return err
+		}
+	}
+	if err := conn.Send("SADD", refreshTokenUserKey(dev.UserID), dev.ID); err != nil {
+		return err
+	}
+	old, err := redis.String(swapRefreshTokenScript.Do(conn, refreshTokenDeviceKey(dev.UserID, dev.ID), token, expire))
+	if err == redis.ErrNil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if old != token {
+		_, err = conn.Do("DEL", refreshTokenKey(old))
+	}
+	return err
+}
+
+// TakeRefreshToken returns the device the refresh token was issued to and
+// invalidates the token. It returns nil if the token is unknown.
+func (rc *RedisCache) TakeRefreshToken(token string) (*authtypes.Device, error) {
+	conn := rc.pool().Get()
+	defer conn.Close()
+
+	fields, err := redis.StringMap(takeRefreshTokenScript.Do(conn, refreshTokenKey(token)))
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	devKey := refreshTokenDeviceKey(fields["user_id"], fields["device_id"])
+	if _, err := delIfEqualScript.Do(conn, devKey, token); err != nil {
+		return nil, err
+	}
+	human, _ := strconv.ParseBool(fields["human"])
+	return &authtypes.Device{
+		ID:         fields["device_id"],
+		UserID:     fields["user_id"],
+		DeviceType: fields["device_type"],
+		Identifier: fields["identifier"],
+		IsHuman:    human,
+	}, nil
+}
+
+// DelDeviceRefreshToken invalidates the refresh token of a device
+func (rc *RedisCache) DelDeviceRefreshToken(userID, deviceID string) error {
+	devKey := refreshTokenDeviceKey(userID, deviceID)
+	token, err := redis.String(rc.SafeDo("GET", devKey))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+	if err == nil {
+		if _, err := rc.SafeDo("DEL", refreshTokenKey(token)); err != nil {
+			return err
+		}
+		if _, err := rc.SafeDo("DEL", devKey); err != nil {
+			return err
+		}
+	}
+	_, err = rc.SafeDo("SREM", refreshTokenUserKey(userID), deviceID)
+	return err
+}
+
+// DelUserRefreshTokens invalidates the refresh tokens of all the devices of
+// a user
+func (rc *RedisCache) DelUserRefreshTokens(userID string) error {
+	deviceIDs, err := redis.Strings(rc.SafeDo("SMEMBERS", refreshTokenUserKey(userID)))
+	if err != nil {
+		return err
+	}
+	for _, deviceID := range deviceIDs {
+		if err := rc.DelDeviceRefreshToken(userID, deviceID); err != nil {
+			return err
+		}
+	}
+	_, err = rc.SafeDo("DEL", refreshTokenUserKey(userID))
+	return err
+}
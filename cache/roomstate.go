@@ -105,3 +105,9 @@ func (rc *RedisCache) SetRoomStateExt(roomID string, roomstateExt *types.RoomSta
 	key := fmt.Sprintf("%s:%s", ROOM_STATE_EXT_PREFIX, roomID)
 	return rc.HMSet(key, ext)
 }
+
+// DelRoomState drops the cached room state, the next reader rebuilds it from
+// the roomserver db
+func (rc *RedisCache) DelRoomState(roomID string) error {
+	return rc.Del(fmt.Sprintf("%s:%s", ROOM_STATE_PREFIX, roomID))
+}
@@ -19,12 +19,11 @@ package consumers
 
 import (
 	"context"
-	"math/rand"
 	"sync"
-	"time"
 
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/redispool"
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/model/dbtypes"
 	"github.com/gomodule/redigo/redis"
@@ -38,8 +37,7 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 // DBEventDataConsumer consumes db events for cache writer.
 type DBEventCacheConsumer struct {
 	channel  core.IChannel
-	pools    []*redis.Pool
-	poolSize int
+	connPool *redis.Pool
 
 	consumerRepo sync.Map
 }
@@ -59,18 +57,11 @@ func NewDBEventCacheConsumer(
 		}
 		channel.SetHandler(s)
 
-		s.poolSize = len(cfg.Redis.Uris)
-		s.pools = make([]*redis.Pool, s.poolSize)
-		for i := 0; i < s.poolSize; i++ {
-			addr := cfg.Redis.Uris[i]
-			s.pools[i] = &redis.Pool{
-				MaxIdle:     200,
-				MaxActive:   200,
-				Wait:        true,
-				IdleTimeout: 240 * time.Second,
-				Dial:        func() (redis.Conn, error) { return redis.DialURL(addr) },
-			}
+		connPool, err := redispool.NewPool(cfg.Redis)
+		if err != nil {
+			log.Panicf("NewDBEventCacheConsumer: failed to connect to redis err:%v", err)
 		}
+		s.connPool = connPool
 
 		//load instance
 		for key, f := range newHandler {
@@ -87,8 +78,7 @@ func NewDBEventCacheConsumer(
 }
 
 func (s *DBEventCacheConsumer) Pool() *redis.Pool {
-	slot := rand.Int() % s.poolSize
-	return s.pools[slot]
+	return s.connPool
 }
 
 // Start consuming from room servers
@@ -18,6 +18,7 @@ import (
 	"context"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/finogeeks/ligase/cache"
@@ -134,13 +135,50 @@ func init() {
 	apiconsumer.SetAPIProcessor(ReqPostRegister{})
 	apiconsumer.SetAPIProcessor(ReqPostRegisterLegacy{})
 	apiconsumer.SetAPIProcessor(ReqGetRegitsterAvailable{})
+	apiconsumer.SetAPIProcessor(ReqGetRegistrationTokenValidity{})
 	apiconsumer.SetAPIProcessor(ReqGetDirectoryRoomAlias{})
 	apiconsumer.SetAPIProcessor(ReqPutDirectoryRoomAlias{})
 	apiconsumer.SetAPIProcessor(ReqDelDirectoryRoomAlias{})
 	apiconsumer.SetAPIProcessor(ReqPostLogout{})
 	apiconsumer.SetAPIProcessor(ReqPostLogoutAll{})
+	apiconsumer.SetAPIProcessor(ReqPostRefresh{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminRoomShutdown{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminRoomPurgeHistory{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminRoomPurgeStatus{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminRoomBlock{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminRoomUnblock{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminRoomBlock{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminUsers{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminUser{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminUserResetPassword{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminUserLock{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminUserUnlock{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminUserLogout{})
+	apiconsumer.SetAPIProcessor(ReqPutAdminUserAdmin{})
+	apiconsumer.SetAPIProcessor(ReqPutAdminUserShadowBan{})
+	apiconsumer.SetAPIProcessor(ReqGetWhoIs{})
+	apiconsumer.SetAPIProcessor(ReqPostRoomReport{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminEventReports{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminEventReport{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminEventReportResolve{})
+	apiconsumer.SetAPIProcessor(ReqPutAdminEventReportNote{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminRoomExport{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminLegalHolds{})
+	apiconsumer.SetAPIProcessor(ReqPutAdminLegalHold{})
+	apiconsumer.SetAPIProcessor(ReqDelAdminLegalHold{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminRegistrationTokens{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminRegistrationToken{})
+	apiconsumer.SetAPIProcessor(ReqDelAdminRegistrationToken{})
+	apiconsumer.SetAPIProcessor(ReqPostAdminConfigReload{})
+	apiconsumer.SetAPIProcessor(ReqGetAdminAuditEvents{})
+	apiconsumer.SetAPIProcessor(ReqPostUserOpenID{})
+	apiconsumer.SetAPIProcessor(ReqGetFedOpenIDUserInfo{})
 	apiconsumer.SetAPIProcessor(ReqGetLogin{})
 	apiconsumer.SetAPIProcessor(ReqPostLogin{})
+	apiconsumer.SetAPIProcessor(ReqGetSSOLoginRedirect{})
+	apiconsumer.SetAPIProcessor(ReqGetCasLoginRedirect{})
+	apiconsumer.SetAPIProcessor(ReqGetCasLoginTicket{})
+	apiconsumer.SetAPIProcessor(ReqPostSAMLAuthnResponse{})
 	apiconsumer.SetAPIProcessor(ReqGetLoginAdmin{})
 	apiconsumer.SetAPIProcessor(ReqPostLoginAdmin{})
 	apiconsumer.SetAPIProcessor(ReqPostUserFilter{})
@@ -155,8 +193,17 @@ func init() {
 	apiconsumer.SetAPIProcessor(ReqPostAssociated3PIDs{})
 	apiconsumer.SetAPIProcessor(ReqPostAssociated3PIDsDel{})
 	apiconsumer.SetAPIProcessor(ReqPostAccount3PIDEmail{})
+	apiconsumer.SetAPIProcessor(ReqPostRegisterEmail{})
+	apiconsumer.SetAPIProcessor(ReqPostAccount3PIDMsisdn{})
+	apiconsumer.SetAPIProcessor(ReqPostRegisterMsisdn{})
+	apiconsumer.SetAPIProcessor(ReqPost3PIDSubmitToken{})
 	apiconsumer.SetAPIProcessor(ReqGetVoipTurnServer{})
 	apiconsumer.SetAPIProcessor(ReqGetThirdpartyProtos{})
+	apiconsumer.SetAPIProcessor(ReqGetThirdpartyProtoByName{})
+	apiconsumer.SetAPIProcessor(ReqGetThirdpartyLocationByProto{})
+	apiconsumer.SetAPIProcessor(ReqGetThirdpartyUserByProto{})
+	apiconsumer.SetAPIProcessor(ReqGetThirdpartyLocation{})
+	apiconsumer.SetAPIProcessor(ReqGetThirdpartyUser{})
 	apiconsumer.SetAPIProcessor(ReqGetDevicesByUserID{})
 	apiconsumer.SetAPIProcessor(ReqGetDeviceByID{})
 	apiconsumer.SetAPIProcessor(ReqPutDevice{})
@@ -187,6 +234,7 @@ func init() {
 	apiconsumer.SetAPIProcessor(ReqPostUserInfo{})
 	apiconsumer.SetAPIProcessor(ReqDeleteUserInfo{})
 	apiconsumer.SetAPIProcessor(ReqDismissRoom{})
+	apiconsumer.SetAPIProcessor(ReqPostAppServicePing{})
 }
 
 type ReqPostCreateRoom struct{}
@@ -680,7 +728,7 @@ func (ReqPostRegister) Process(ctx context.Context, consumer interface{}, msg co
 	c := consumer.(*InternalMsgConsumer)
 	req := msg.(*external.PostRegisterRequest)
 	return routing.Register(
-		ctx, req, c.accountDB, c.deviceDB, &c.Cfg, c.idg,
+		ctx, req, c.accountDB, c.deviceDB, &c.Cfg, c.idg, c.cacheIn,
 	)
 }
 
@@ -741,6 +789,40 @@ func (ReqGetRegitsterAvailable) Process(ctx context.Context, consumer interface{
 	return routing.RegisterAvailable()
 }
 
+type ReqGetRegistrationTokenValidity struct{}
+
+func (ReqGetRegistrationTokenValidity) GetRoute() string {
+	return "/register/m.login.registration_token/validity"
+}
+func (ReqGetRegistrationTokenValidity) GetMetricsName() string { return "registration_token_validity" }
+func (ReqGetRegistrationTokenValidity) GetMsgType() int32 {
+	return internals.MSG_GET_REGISTER_TOKEN_VALIDITY
+}
+func (ReqGetRegistrationTokenValidity) GetAPIType() int8 { return apiconsumer.APITypeExternal }
+func (ReqGetRegistrationTokenValidity) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetRegistrationTokenValidity) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqGetRegistrationTokenValidity) NewRequest() core.Coder {
+	return new(external.GetRegistrationTokenValidityRequest)
+}
+func (ReqGetRegistrationTokenValidity) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetRegistrationTokenValidityRequest)
+	msg.Token = req.URL.Query().Get("token")
+	return nil
+}
+func (ReqGetRegistrationTokenValidity) NewResponse(code int) core.Coder {
+	return new(external.GetRegistrationTokenValidityResponse)
+}
+func (ReqGetRegistrationTokenValidity) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetRegistrationTokenValidity) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetRegistrationTokenValidityRequest)
+	return routing.GetRegistrationTokenValidity(ctx, req, &c.Cfg, c.accountDB)
+}
+
 type ReqGetDirectoryRoomAlias struct{}
 
 func (ReqGetDirectoryRoomAlias) GetRoute() string       { return "/directory/room/{roomAlias}" }
@@ -885,6 +967,29 @@ func (ReqPostLogoutAll) Process(ctx context.Context, consumer interface{}, msg c
 	)
 }
 
+type ReqPostRefresh struct{}
+
+func (ReqPostRefresh) GetRoute() string                     { return "/refresh" }
+func (ReqPostRefresh) GetMetricsName() string               { return "refresh" }
+func (ReqPostRefresh) GetMsgType() int32                    { return internals.MSG_POST_REFRESH }
+func (ReqPostRefresh) GetAPIType() int8                     { return apiconsumer.APITypeExternal }
+func (ReqPostRefresh) GetMethod() []string                  { return []string{http.MethodPost, http.MethodOptions} }
+func (ReqPostRefresh) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostRefresh) NewRequest() core.Coder {
+	return new(external.PostRefreshRequest)
+}
+func (ReqPostRefresh) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostRefreshRequest)
+	return common.UnmarshalJSON(req, msg)
+}
+func (ReqPostRefresh) NewResponse(code int) core.Coder { return new(external.PostRefreshResponse) }
+func (ReqPostRefresh) GetPrefix() []string             { return []string{"r0", "clientV1"} }
+func (ReqPostRefresh) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostRefreshRequest)
+	return routing.PostRefresh(ctx, req, &c.Cfg, c.cacheIn)
+}
+
 type ReqGetLogin struct{}
 
 func (ReqGetLogin) GetRoute() string                     { return "/login" }
@@ -927,6 +1032,7 @@ func (ReqPostLogin) FillRequest(coder core.Coder, req *http.Request, vars map[st
 	if err != nil {
 		return err
 	}
+	msg.IP = common.GetRemoteIP(req)
 	return nil
 }
 func (ReqPostLogin) NewResponse(code int) core.Coder { return new(external.PostLoginResponse) }
@@ -936,10 +1042,130 @@ func (ReqPostLogin) Process(ctx context.Context, consumer interface{}, msg core.
 	req := msg.(*external.PostLoginRequest)
 	return routing.LoginPost(
 		ctx, req, c.accountDB, c.deviceDB, c.encryptDB,
-		c.syncDB, c.Cfg, false, c.idg, c.tokenFilter, c.RpcCli,
+		c.syncDB, c.Cfg, false, c.idg, c.tokenFilter, c.RpcCli, c.cacheIn,
 	)
 }
 
+type ReqGetSSOLoginRedirect struct{}
+
+func (ReqGetSSOLoginRedirect) GetRoute() string       { return "/login/sso/redirect" }
+func (ReqGetSSOLoginRedirect) GetMetricsName() string { return "sso_redirect" }
+func (ReqGetSSOLoginRedirect) GetMsgType() int32      { return internals.MSG_GET_SSO_LOGIN_REDIRECT }
+func (ReqGetSSOLoginRedirect) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqGetSSOLoginRedirect) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetSSOLoginRedirect) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetSSOLoginRedirect) NewRequest() core.Coder {
+	return new(external.GetSSOLoginRedirectRequest)
+}
+func (ReqGetSSOLoginRedirect) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetSSOLoginRedirectRequest)
+	msg.RedirectURL = req.URL.Query().Get("redirectUrl")
+	return nil
+}
+func (ReqGetSSOLoginRedirect) NewResponse(code int) core.Coder {
+	return new(external.SSORedirectResponse)
+}
+func (ReqGetSSOLoginRedirect) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetSSOLoginRedirect) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetSSOLoginRedirectRequest)
+	return routing.SSORedirect(ctx, req.RedirectURL, &c.Cfg, c.cacheIn)
+}
+
+type ReqGetCasLoginRedirect struct{}
+
+func (ReqGetCasLoginRedirect) GetRoute() string       { return "/login/cas/redirect" }
+func (ReqGetCasLoginRedirect) GetMetricsName() string { return "cas_redirect" }
+func (ReqGetCasLoginRedirect) GetMsgType() int32      { return internals.MSG_GET_CAS_LOGIN_REDIRECT }
+func (ReqGetCasLoginRedirect) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqGetCasLoginRedirect) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetCasLoginRedirect) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetCasLoginRedirect) NewRequest() core.Coder {
+	return new(external.GetCasLoginRedirectRequest)
+}
+func (ReqGetCasLoginRedirect) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetCasLoginRedirectRequest)
+	msg.RedirectURL = req.URL.Query().Get("redirectUrl")
+	return nil
+}
+func (ReqGetCasLoginRedirect) NewResponse(code int) core.Coder {
+	return new(external.SSORedirectResponse)
+}
+func (ReqGetCasLoginRedirect) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetCasLoginRedirect) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetCasLoginRedirectRequest)
+	if c.Cfg.SSO.Provider != "cas" {
+		return http.StatusNotFound, jsonerror.NotFound("CAS login is not enabled")
+	}
+	return routing.SSORedirect(ctx, req.RedirectURL, &c.Cfg, c.cacheIn)
+}
+
+type ReqGetCasLoginTicket struct{}
+
+func (ReqGetCasLoginTicket) GetRoute() string       { return "/login/cas/ticket" }
+func (ReqGetCasLoginTicket) GetMetricsName() string { return "cas_ticket" }
+func (ReqGetCasLoginTicket) GetMsgType() int32      { return internals.MSG_GET_CAS_LOGIN_TICKET }
+func (ReqGetCasLoginTicket) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqGetCasLoginTicket) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetCasLoginTicket) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetCasLoginTicket) NewRequest() core.Coder {
+	return new(external.GetCasLoginTickerRequest)
+}
+func (ReqGetCasLoginTicket) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetCasLoginTickerRequest)
+	msg.RedirectURL = req.URL.Query().Get("redirectUrl")
+	msg.Ticket = req.URL.Query().Get("ticket")
+	return nil
+}
+func (ReqGetCasLoginTicket) NewResponse(code int) core.Coder {
+	return new(external.SSORedirectResponse)
+}
+func (ReqGetCasLoginTicket) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetCasLoginTicket) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetCasLoginTickerRequest)
+	return routing.CASTicket(ctx, req, &c.Cfg, c.accountDB, c.cacheIn)
+}
+
+type ReqPostSAMLAuthnResponse struct{}
+
+func (ReqPostSAMLAuthnResponse) GetRoute() string       { return "/login/saml2/authn_response" }
+func (ReqPostSAMLAuthnResponse) GetMetricsName() string { return "saml_authn_response" }
+func (ReqPostSAMLAuthnResponse) GetMsgType() int32      { return internals.MSG_POST_SAML_AUTHN_RESP }
+func (ReqPostSAMLAuthnResponse) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqPostSAMLAuthnResponse) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostSAMLAuthnResponse) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostSAMLAuthnResponse) NewRequest() core.Coder {
+	return new(external.PostSAMLAuthnResponseRequest)
+}
+func (ReqPostSAMLAuthnResponse) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostSAMLAuthnResponseRequest)
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+	msg.SAMLResponse = req.PostForm.Get("SAMLResponse")
+	msg.RelayState = req.PostForm.Get("RelayState")
+	return nil
+}
+func (ReqPostSAMLAuthnResponse) NewResponse(code int) core.Coder {
+	return new(external.SSORedirectResponse)
+}
+func (ReqPostSAMLAuthnResponse) GetPrefix() []string { return []string{"r0"} }
+func (ReqPostSAMLAuthnResponse) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostSAMLAuthnResponseRequest)
+	return routing.SAMLAuthnResponse(ctx, req, &c.Cfg, c.accountDB, c.cacheIn)
+}
+
 type ReqGetLoginAdmin struct{}
 
 func (ReqGetLoginAdmin) GetRoute() string                     { return "/adminlogin" }
@@ -982,6 +1208,7 @@ func (ReqPostLoginAdmin) FillRequest(coder core.Coder, req *http.Request, vars m
 	if err != nil {
 		return err
 	}
+	msg.IP = common.GetRemoteIP(req)
 	return nil
 }
 func (ReqPostLoginAdmin) NewResponse(code int) core.Coder { return new(external.PostLoginResponse) }
@@ -991,7 +1218,7 @@ func (ReqPostLoginAdmin) Process(ctx context.Context, consumer interface{}, msg
 	req := msg.(*external.PostLoginRequest)
 	return routing.LoginPost(
 		ctx, req, c.accountDB, c.deviceDB, c.encryptDB,
-		c.syncDB, c.Cfg, true, c.idg, c.tokenFilter, c.RpcCli,
+		c.syncDB, c.Cfg, true, c.idg, c.tokenFilter, c.RpcCli, c.cacheIn,
 	)
 }
 
@@ -1262,7 +1489,8 @@ func (ReqGetAssociated3PIDs) NewResponse(code int) core.Coder {
 }
 func (ReqGetAssociated3PIDs) GetPrefix() []string { return []string{"r0"} }
 func (ReqGetAssociated3PIDs) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
-	return routing.GetAssociated3PIDs()
+	c := consumer.(*InternalMsgConsumer)
+	return routing.GetAssociated3PIDs(ctx, device.UserID, c.accountDB)
 }
 
 type ReqPostAssociated3PIDs struct{}
@@ -1289,7 +1517,9 @@ func (ReqPostAssociated3PIDs) FillRequest(coder core.Coder, req *http.Request, v
 func (ReqPostAssociated3PIDs) NewResponse(code int) core.Coder { return nil }
 func (ReqPostAssociated3PIDs) GetPrefix() []string             { return []string{"r0"} }
 func (ReqPostAssociated3PIDs) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
-	return routing.CheckAndSave3PIDAssociation()
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAccount3PIDRequest)
+	return routing.CheckAndSave3PIDAssociation(ctx, req, device.UserID, &c.Cfg, c.accountDB)
 }
 
 type ReqPostAssociated3PIDsDel struct{}
@@ -1316,14 +1546,40 @@ func (ReqPostAssociated3PIDsDel) FillRequest(coder core.Coder, req *http.Request
 func (ReqPostAssociated3PIDsDel) NewResponse(code int) core.Coder { return nil }
 func (ReqPostAssociated3PIDsDel) GetPrefix() []string             { return []string{"unstable"} }
 func (ReqPostAssociated3PIDsDel) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
-	return routing.Forget3PID()
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAccount3PIDDelRequest)
+	return routing.Forget3PID(ctx, req, device.UserID, c.accountDB)
+}
+
+// send_attempt is an integer in the spec but travels as a string inside the
+// requestToken messages, accept both from clients
+func fillEmailTokenRequest(msg *external.PostAccount3PIDEmailRequest, req *http.Request) error {
+	body := struct {
+		*external.PostAccount3PIDEmailRequest
+		SendAttempt jsoniter.Number `json:"send_attempt"`
+	}{PostAccount3PIDEmailRequest: msg}
+	if err := common.UnmarshalJSON(req, &body); err != nil {
+		return err
+	}
+	msg.SendAttempt = body.SendAttempt.String()
+	return nil
+}
+
+func fillMsisdnTokenRequest(msg *external.PostAccount3PIDMsisdnRequest, req *http.Request) error {
+	body := struct {
+		*external.PostAccount3PIDMsisdnRequest
+		SendAttempt jsoniter.Number `json:"send_attempt"`
+	}{PostAccount3PIDMsisdnRequest: msg}
+	if err := common.UnmarshalJSON(req, &body); err != nil {
+		return err
+	}
+	msg.SendAttempt = body.SendAttempt.String()
+	return nil
 }
 
 type ReqPostAccount3PIDEmail struct{}
 
-func (ReqPostAccount3PIDEmail) GetRoute() string {
-	return "/{path:(?:account/3pid|register)}/email/requestToken"
-}
+func (ReqPostAccount3PIDEmail) GetRoute() string       { return "/account/3pid/email/requestToken" }
 func (ReqPostAccount3PIDEmail) GetMetricsName() string { return "account_3pid_email_request_token" }
 func (ReqPostAccount3PIDEmail) GetMsgType() int32      { return internals.MSG_POST_ACCOUNT_3PID_EMAIL }
 func (ReqPostAccount3PIDEmail) GetAPIType() int8       { return apiconsumer.APITypeExternal }
@@ -1336,13 +1592,11 @@ func (ReqPostAccount3PIDEmail) NewRequest() core.Coder {
 }
 func (ReqPostAccount3PIDEmail) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
 	msg := coder.(*external.PostAccount3PIDEmailRequest)
-	if vars != nil {
-		msg.Path = vars["path"]
-	}
-	err := common.UnmarshalJSON(req, msg)
+	err := fillEmailTokenRequest(msg, req)
 	if err != nil {
 		return err
 	}
+	msg.Path = "account/3pid"
 	return nil
 }
 func (ReqPostAccount3PIDEmail) NewResponse(code int) core.Coder {
@@ -1350,7 +1604,152 @@ func (ReqPostAccount3PIDEmail) NewResponse(code int) core.Coder {
 }
 func (ReqPostAccount3PIDEmail) GetPrefix() []string { return []string{"r0"} }
 func (ReqPostAccount3PIDEmail) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
-	return routing.RequestEmailToken()
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAccount3PIDEmailRequest)
+	return routing.RequestEmailToken(ctx, req, &c.Cfg, c.accountDB)
+}
+
+type ReqPostRegisterEmail struct{}
+
+func (ReqPostRegisterEmail) GetRoute() string       { return "/register/email/requestToken" }
+func (ReqPostRegisterEmail) GetMetricsName() string { return "register_email_request_token" }
+func (ReqPostRegisterEmail) GetMsgType() int32      { return internals.MSG_POST_REGISTER_EMAIL }
+func (ReqPostRegisterEmail) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqPostRegisterEmail) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostRegisterEmail) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostRegisterEmail) NewRequest() core.Coder {
+	return new(external.PostAccount3PIDEmailRequest)
+}
+func (ReqPostRegisterEmail) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAccount3PIDEmailRequest)
+	err := fillEmailTokenRequest(msg, req)
+	if err != nil {
+		return err
+	}
+	msg.Path = "register"
+	return nil
+}
+func (ReqPostRegisterEmail) NewResponse(code int) core.Coder {
+	return new(external.PostAccount3PIDEmailResponse)
+}
+func (ReqPostRegisterEmail) GetPrefix() []string { return []string{"r0"} }
+func (ReqPostRegisterEmail) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAccount3PIDEmailRequest)
+	return routing.RequestEmailToken(ctx, req, &c.Cfg, c.accountDB)
+}
+
+type ReqPostAccount3PIDMsisdn struct{}
+
+func (ReqPostAccount3PIDMsisdn) GetRoute() string       { return "/account/3pid/msisdn/requestToken" }
+func (ReqPostAccount3PIDMsisdn) GetMetricsName() string { return "account_3pid_msisdn_request_token" }
+func (ReqPostAccount3PIDMsisdn) GetMsgType() int32      { return internals.MSG_POST_ACCOUNT_3PID_MSISDN }
+func (ReqPostAccount3PIDMsisdn) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqPostAccount3PIDMsisdn) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAccount3PIDMsisdn) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAccount3PIDMsisdn) NewRequest() core.Coder {
+	return new(external.PostAccount3PIDMsisdnRequest)
+}
+func (ReqPostAccount3PIDMsisdn) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAccount3PIDMsisdnRequest)
+	err := fillMsisdnTokenRequest(msg, req)
+	if err != nil {
+		return err
+	}
+	msg.Path = "account/3pid"
+	return nil
+}
+func (ReqPostAccount3PIDMsisdn) NewResponse(code int) core.Coder {
+	return new(external.PostAccount3PIDMsisdnResponse)
+}
+func (ReqPostAccount3PIDMsisdn) GetPrefix() []string { return []string{"r0"} }
+func (ReqPostAccount3PIDMsisdn) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAccount3PIDMsisdnRequest)
+	return routing.RequestMSISDNToken(ctx, req, &c.Cfg, c.accountDB)
+}
+
+type ReqPostRegisterMsisdn struct{}
+
+func (ReqPostRegisterMsisdn) GetRoute() string       { return "/register/msisdn/requestToken" }
+func (ReqPostRegisterMsisdn) GetMetricsName() string { return "register_msisdn_request_token" }
+func (ReqPostRegisterMsisdn) GetMsgType() int32      { return internals.MSG_POST_REGISTER_MSISDN }
+func (ReqPostRegisterMsisdn) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqPostRegisterMsisdn) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostRegisterMsisdn) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostRegisterMsisdn) NewRequest() core.Coder {
+	return new(external.PostAccount3PIDMsisdnRequest)
+}
+func (ReqPostRegisterMsisdn) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAccount3PIDMsisdnRequest)
+	err := fillMsisdnTokenRequest(msg, req)
+	if err != nil {
+		return err
+	}
+	msg.Path = "register"
+	return nil
+}
+func (ReqPostRegisterMsisdn) NewResponse(code int) core.Coder {
+	return new(external.PostAccount3PIDMsisdnResponse)
+}
+func (ReqPostRegisterMsisdn) GetPrefix() []string { return []string{"r0"} }
+func (ReqPostRegisterMsisdn) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAccount3PIDMsisdnRequest)
+	return routing.RequestMSISDNToken(ctx, req, &c.Cfg, c.accountDB)
+}
+
+type ReqPost3PIDSubmitToken struct{}
+
+func (ReqPost3PIDSubmitToken) GetRoute() string {
+	return "/{path:(?:account/3pid|register)}/{medium:(?:email|msisdn)}/submitToken"
+}
+func (ReqPost3PIDSubmitToken) GetMetricsName() string { return "3pid_submit_token" }
+func (ReqPost3PIDSubmitToken) GetMsgType() int32      { return internals.MSG_POST_3PID_SUBMIT_TOKEN }
+func (ReqPost3PIDSubmitToken) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqPost3PIDSubmitToken) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+}
+func (ReqPost3PIDSubmitToken) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPost3PIDSubmitToken) NewRequest() core.Coder {
+	return new(external.Post3PIDSubmitTokenRequest)
+}
+func (ReqPost3PIDSubmitToken) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.Post3PIDSubmitTokenRequest)
+	if req.Method == http.MethodGet {
+		// the link sent by email
+		query := req.URL.Query()
+		msg.Sid = query.Get("sid")
+		msg.ClientSecret = query.Get("client_secret")
+		msg.Token = query.Get("token")
+		msg.Redirect = true
+	} else if err := common.UnmarshalJSON(req, msg); err != nil {
+		return err
+	}
+	if vars["medium"] == "msisdn" {
+		msg.Medium = authtypes.MediumMSISDN
+	} else {
+		msg.Medium = authtypes.MediumEmail
+	}
+	return nil
+}
+func (ReqPost3PIDSubmitToken) NewResponse(code int) core.Coder {
+	if code == http.StatusFound {
+		return new(external.SSORedirectResponse)
+	}
+	return new(external.Post3PIDSubmitTokenResponse)
+}
+func (ReqPost3PIDSubmitToken) GetPrefix() []string { return []string{"r0"} }
+func (ReqPost3PIDSubmitToken) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.Post3PIDSubmitTokenRequest)
+	return routing.SubmitThreePIDToken(ctx, req, &c.Cfg, c.accountDB)
 }
 
 type ReqGetVoipTurnServer struct{}
@@ -1372,8 +1771,7 @@ func (ReqGetVoipTurnServer) NewResponse(code int) core.Coder {
 }
 func (ReqGetVoipTurnServer) GetPrefix() []string { return []string{"r0"} }
 func (ReqGetVoipTurnServer) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
-	c := consumer.(*InternalMsgConsumer)
-	return routing.RequestTurnServer(ctx, device.UserID, c.Cfg)
+	return routing.RequestTurnServer(ctx, device.UserID)
 }
 
 type ReqGetThirdpartyProtos struct{}
@@ -1390,11 +1788,179 @@ func (ReqGetThirdpartyProtos) NewRequest() core.Coder               { return nil
 func (ReqGetThirdpartyProtos) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
 	return nil
 }
-func (ReqGetThirdpartyProtos) NewResponse(code int) core.Coder { return nil }
-func (ReqGetThirdpartyProtos) GetPrefix() []string             { return []string{"r0"} }
+func (ReqGetThirdpartyProtos) NewResponse(code int) core.Coder {
+	return new(external.GetThirdPartyProtocalsResponse)
+}
+func (ReqGetThirdpartyProtos) GetPrefix() []string { return []string{"r0"} }
 func (ReqGetThirdpartyProtos) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
-	// TODO: Return the third party protcols
-	return http.StatusOK, nil
+	c := consumer.(*InternalMsgConsumer)
+	return routing.GetThirdPartyProtocols(ctx, &c.Cfg)
+}
+
+type ReqGetThirdpartyProtoByName struct{}
+
+func (ReqGetThirdpartyProtoByName) GetRoute() string       { return "/thirdparty/protocol/{protocol}" }
+func (ReqGetThirdpartyProtoByName) GetMetricsName() string { return "thirdparty_by_name" }
+func (ReqGetThirdpartyProtoByName) GetMsgType() int32 {
+	return internals.MSG_GET_THIRDPARTY_PROTO_BY_NAME
+}
+func (ReqGetThirdpartyProtoByName) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqGetThirdpartyProtoByName) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetThirdpartyProtoByName) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqGetThirdpartyProtoByName) NewRequest() core.Coder {
+	return new(external.GetThirdPartyProtocalByNameRequest)
+}
+func (ReqGetThirdpartyProtoByName) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetThirdPartyProtocalByNameRequest)
+	msg.Protocol = vars["protocol"]
+	return nil
+}
+func (ReqGetThirdpartyProtoByName) NewResponse(code int) core.Coder {
+	return new(external.GetThirdPartyProtocalByNameResponse)
+}
+func (ReqGetThirdpartyProtoByName) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetThirdpartyProtoByName) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetThirdPartyProtocalByNameRequest)
+	return routing.GetThirdPartyProtocol(ctx, req, &c.Cfg)
+}
+
+type ReqGetThirdpartyLocationByProto struct{}
+
+func (ReqGetThirdpartyLocationByProto) GetRoute() string       { return "/thirdparty/location/{protocol}" }
+func (ReqGetThirdpartyLocationByProto) GetMetricsName() string { return "thirdparty_location_by_name" }
+func (ReqGetThirdpartyLocationByProto) GetMsgType() int32 {
+	return internals.MSG_GET_THIRDPARTY_LOCATION_BY_PROTO
+}
+func (ReqGetThirdpartyLocationByProto) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqGetThirdpartyLocationByProto) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetThirdpartyLocationByProto) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqGetThirdpartyLocationByProto) NewRequest() core.Coder {
+	return new(external.GetThirdPartyLocationByProtocolRequest)
+}
+func (ReqGetThirdpartyLocationByProto) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetThirdPartyLocationByProtocolRequest)
+	msg.Protocol = vars["protocol"]
+	msg.Fields = thirdPartyFields(req)
+	return nil
+}
+func (ReqGetThirdpartyLocationByProto) NewResponse(code int) core.Coder {
+	return new(external.GetThirdPartyLocationByProtocolResponse)
+}
+func (ReqGetThirdpartyLocationByProto) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetThirdpartyLocationByProto) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetThirdPartyLocationByProtocolRequest)
+	return routing.GetThirdPartyLocationsByProtocol(ctx, req, &c.Cfg)
+}
+
+type ReqGetThirdpartyUserByProto struct{}
+
+func (ReqGetThirdpartyUserByProto) GetRoute() string       { return "/thirdparty/user/{protocol}" }
+func (ReqGetThirdpartyUserByProto) GetMetricsName() string { return "thirdparty_user_by_name" }
+func (ReqGetThirdpartyUserByProto) GetMsgType() int32 {
+	return internals.MSG_GET_THIRDPARTY_USER_BY_PROTO
+}
+func (ReqGetThirdpartyUserByProto) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqGetThirdpartyUserByProto) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetThirdpartyUserByProto) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqGetThirdpartyUserByProto) NewRequest() core.Coder {
+	return new(external.GetThirdPartyUserByProtocolRequest)
+}
+func (ReqGetThirdpartyUserByProto) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetThirdPartyUserByProtocolRequest)
+	msg.Protocol = vars["protocol"]
+	msg.Fields = thirdPartyFields(req)
+	return nil
+}
+func (ReqGetThirdpartyUserByProto) NewResponse(code int) core.Coder {
+	return new(external.GetThirdPartyUserByProtocolResponse)
+}
+func (ReqGetThirdpartyUserByProto) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetThirdpartyUserByProto) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetThirdPartyUserByProtocolRequest)
+	return routing.GetThirdPartyUsersByProtocol(ctx, req, &c.Cfg)
+}
+
+type ReqGetThirdpartyLocation struct{}
+
+func (ReqGetThirdpartyLocation) GetRoute() string       { return "/thirdparty/location" }
+func (ReqGetThirdpartyLocation) GetMetricsName() string { return "thirdparty_location" }
+func (ReqGetThirdpartyLocation) GetMsgType() int32      { return internals.MSG_GET_THIRDPARTY_LOCATION }
+func (ReqGetThirdpartyLocation) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetThirdpartyLocation) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetThirdpartyLocation) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetThirdpartyLocation) NewRequest() core.Coder {
+	return new(external.GetThirdPartyLocationRequest)
+}
+func (ReqGetThirdpartyLocation) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetThirdPartyLocationRequest)
+	msg.Alias = req.URL.Query().Get("alias")
+	return nil
+}
+func (ReqGetThirdpartyLocation) NewResponse(code int) core.Coder {
+	return new(external.GetThirdPartyLocationResponse)
+}
+func (ReqGetThirdpartyLocation) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetThirdpartyLocation) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetThirdPartyLocationRequest)
+	return routing.GetThirdPartyLocationsByAlias(ctx, req, &c.Cfg)
+}
+
+type ReqGetThirdpartyUser struct{}
+
+func (ReqGetThirdpartyUser) GetRoute() string       { return "/thirdparty/user" }
+func (ReqGetThirdpartyUser) GetMetricsName() string { return "thirdparty_user" }
+func (ReqGetThirdpartyUser) GetMsgType() int32      { return internals.MSG_GET_THIRDPARTY_USER }
+func (ReqGetThirdpartyUser) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetThirdpartyUser) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetThirdpartyUser) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetThirdpartyUser) NewRequest() core.Coder {
+	return new(external.GetThirdPartyUserRequest)
+}
+func (ReqGetThirdpartyUser) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetThirdPartyUserRequest)
+	msg.UserID = req.URL.Query().Get("userid")
+	return nil
+}
+func (ReqGetThirdpartyUser) NewResponse(code int) core.Coder {
+	return new(external.GetThirdPartyUserResponse)
+}
+func (ReqGetThirdpartyUser) GetPrefix() []string { return []string{"r0"} }
+func (ReqGetThirdpartyUser) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetThirdPartyUserRequest)
+	return routing.GetThirdPartyUsersByID(ctx, req, &c.Cfg)
+}
+
+// thirdPartyFields returns the query parameters of a third party lookup, they
+// are handed to the application services as they are
+func thirdPartyFields(req *http.Request) map[string]string {
+	fields := make(map[string]string)
+	for k, v := range req.URL.Query() {
+		if k != "access_token" && len(v) > 0 {
+			fields[k] = v[0]
+		}
+	}
+	return fields
 }
 
 type ReqGetDevicesByUserID struct{}
@@ -1508,7 +2074,7 @@ func (ReqDelDevice) GetPrefix() []string { return []string{"r0", "unstable"} }
 func (ReqDelDevice) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
 	c := consumer.(*InternalMsgConsumer)
 	req := msg.(*external.DelDeviceRequest)
-	return routing.DeleteDeviceByID(ctx, req, req.DeviceID, c.Cfg, c.cacheIn,
+	return routing.DeleteDeviceByID(ctx, req, device, req.DeviceID, c.Cfg, c.cacheIn,
 		c.encryptDB, c.tokenFilter, c.syncDB, c.deviceDB, c.RpcCli,
 	)
 }
@@ -2331,3 +2897,1062 @@ func (ReqDismissRoom) Process(ctx context.Context, consumer interface{}, msg cor
 		c.Cfg, c.rsRpcCli, c.federation, c.cacheIn, c.idg, c.complexCache,
 	)
 }
+
+type ReqPostAppServicePing struct{}
+
+func (ReqPostAppServicePing) GetRoute() string       { return "/appservice/{appserviceId}/ping" }
+func (ReqPostAppServicePing) GetMetricsName() string { return "appservice_ping" }
+func (ReqPostAppServicePing) GetMsgType() int32      { return internals.MSG_POST_APPSERVICE_PING }
+func (ReqPostAppServicePing) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqPostAppServicePing) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAppServicePing) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAppServicePing) GetPrefix() []string                  { return []string{"clientV1"} }
+func (ReqPostAppServicePing) NewRequest() core.Coder {
+	return new(external.PostAppServicePingRequest)
+}
+func (ReqPostAppServicePing) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAppServicePingRequest)
+	err := common.UnmarshalJSON(req, msg)
+	if err != nil {
+		return err
+	}
+	msg.AppServiceID = vars["appserviceId"]
+	msg.AccessToken, _ = common.ExtractAccessToken(req)
+	return nil
+}
+func (ReqPostAppServicePing) NewResponse(code int) core.Coder {
+	return new(external.PostAppServicePingResponse)
+}
+func (ReqPostAppServicePing) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAppServicePingRequest)
+	return routing.PingAppService(ctx, req, &c.Cfg)
+}
+
+type ReqPostAdminRoomShutdown struct{}
+
+func (ReqPostAdminRoomShutdown) GetRoute() string       { return "/rooms/{roomID}/shutdown" }
+func (ReqPostAdminRoomShutdown) GetMetricsName() string { return "admin_room_shutdown" }
+func (ReqPostAdminRoomShutdown) GetMsgType() int32      { return internals.MSG_POST_ADMIN_ROOM_SHUTDOWN }
+func (ReqPostAdminRoomShutdown) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostAdminRoomShutdown) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminRoomShutdown) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAdminRoomShutdown) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPostAdminRoomShutdown) NewRequest() core.Coder {
+	return new(external.PostAdminRoomShutdownRequest)
+}
+func (ReqPostAdminRoomShutdown) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAdminRoomShutdownRequest)
+	if req.ContentLength != 0 {
+		if err := common.UnmarshalJSON(req, msg); err != nil {
+			return err
+		}
+	}
+	msg.RoomID = vars["roomID"]
+	return nil
+}
+func (ReqPostAdminRoomShutdown) NewResponse(code int) core.Coder {
+	return new(external.PostAdminRoomShutdownResponse)
+}
+func (ReqPostAdminRoomShutdown) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAdminRoomShutdownRequest)
+	return routing.AdminRoomShutdown(
+		ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB,
+		c.rsRpcCli, c.federation, c.cacheIn, c.idg, c.complexCache,
+	)
+}
+
+type ReqPostAdminRoomPurgeHistory struct{}
+
+func (ReqPostAdminRoomPurgeHistory) GetRoute() string       { return "/rooms/{roomID}/purge_history" }
+func (ReqPostAdminRoomPurgeHistory) GetMetricsName() string { return "admin_room_purge_history" }
+func (ReqPostAdminRoomPurgeHistory) GetMsgType() int32 {
+	return internals.MSG_POST_ADMIN_ROOM_PURGE_HISTORY
+}
+func (ReqPostAdminRoomPurgeHistory) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqPostAdminRoomPurgeHistory) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminRoomPurgeHistory) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqPostAdminRoomPurgeHistory) GetPrefix() []string { return []string{"admin"} }
+func (ReqPostAdminRoomPurgeHistory) NewRequest() core.Coder {
+	return new(external.PostAdminRoomPurgeHistoryRequest)
+}
+func (ReqPostAdminRoomPurgeHistory) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAdminRoomPurgeHistoryRequest)
+	if err := common.UnmarshalJSON(req, msg); err != nil {
+		return err
+	}
+	msg.RoomID = vars["roomID"]
+	return nil
+}
+func (ReqPostAdminRoomPurgeHistory) NewResponse(code int) core.Coder {
+	return new(external.PostAdminRoomPurgeHistoryResponse)
+}
+func (ReqPostAdminRoomPurgeHistory) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAdminRoomPurgeHistoryRequest)
+	return routing.AdminRoomPurgeHistory(
+		ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB, c.syncDB, c.cacheIn, c.RpcCli, c.idg,
+	)
+}
+
+type ReqGetAdminRoomPurgeStatus struct{}
+
+func (ReqGetAdminRoomPurgeStatus) GetRoute() string {
+	return "/rooms/{roomID}/purge_history/{purgeID}"
+}
+func (ReqGetAdminRoomPurgeStatus) GetMetricsName() string { return "admin_room_purge_status" }
+func (ReqGetAdminRoomPurgeStatus) GetMsgType() int32 {
+	return internals.MSG_GET_ADMIN_ROOM_PURGE_STATUS
+}
+func (ReqGetAdminRoomPurgeStatus) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqGetAdminRoomPurgeStatus) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminRoomPurgeStatus) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminRoomPurgeStatus) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminRoomPurgeStatus) NewRequest() core.Coder {
+	return new(external.GetAdminRoomPurgeStatusRequest)
+}
+func (ReqGetAdminRoomPurgeStatus) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetAdminRoomPurgeStatusRequest)
+	msg.RoomID = vars["roomID"]
+	msg.PurgeID = vars["purgeID"]
+	return nil
+}
+func (ReqGetAdminRoomPurgeStatus) NewResponse(code int) core.Coder {
+	return new(external.GetAdminRoomPurgeStatusResponse)
+}
+func (ReqGetAdminRoomPurgeStatus) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetAdminRoomPurgeStatusRequest)
+	return routing.GetAdminRoomPurgeStatus(ctx, req, device.UserID, c.Cfg, c.accountDB, c.cacheIn)
+}
+
+type ReqPostAdminRoomBlock struct{}
+
+func (ReqPostAdminRoomBlock) GetRoute() string       { return "/rooms/{roomID}/block" }
+func (ReqPostAdminRoomBlock) GetMetricsName() string { return "admin_room_block" }
+func (ReqPostAdminRoomBlock) GetMsgType() int32      { return internals.MSG_POST_ADMIN_ROOM_BLOCK }
+func (ReqPostAdminRoomBlock) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostAdminRoomBlock) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminRoomBlock) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAdminRoomBlock) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPostAdminRoomBlock) NewRequest() core.Coder {
+	return new(external.AdminRoomBlockRequest)
+}
+func (ReqPostAdminRoomBlock) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminRoomBlockRequest)
+	msg.RoomID = vars["roomID"]
+	return nil
+}
+func (ReqPostAdminRoomBlock) NewResponse(code int) core.Coder {
+	return new(external.AdminRoomBlockResponse)
+}
+func (ReqPostAdminRoomBlock) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminRoomBlockRequest)
+	return routing.AdminRoomBlock(ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB, c.cacheIn)
+}
+
+type ReqPostAdminRoomUnblock struct{}
+
+func (ReqPostAdminRoomUnblock) GetRoute() string       { return "/rooms/{roomID}/unblock" }
+func (ReqPostAdminRoomUnblock) GetMetricsName() string { return "admin_room_unblock" }
+func (ReqPostAdminRoomUnblock) GetMsgType() int32      { return internals.MSG_POST_ADMIN_ROOM_UNBLOCK }
+func (ReqPostAdminRoomUnblock) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostAdminRoomUnblock) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminRoomUnblock) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAdminRoomUnblock) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPostAdminRoomUnblock) NewRequest() core.Coder {
+	return new(external.AdminRoomBlockRequest)
+}
+func (ReqPostAdminRoomUnblock) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminRoomBlockRequest)
+	msg.RoomID = vars["roomID"]
+	return nil
+}
+func (ReqPostAdminRoomUnblock) NewResponse(code int) core.Coder {
+	return new(external.AdminRoomBlockResponse)
+}
+func (ReqPostAdminRoomUnblock) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminRoomBlockRequest)
+	return routing.AdminRoomUnblock(ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB, c.cacheIn)
+}
+
+type ReqGetAdminRoomBlock struct{}
+
+func (ReqGetAdminRoomBlock) GetRoute() string       { return "/rooms/{roomID}/block" }
+func (ReqGetAdminRoomBlock) GetMetricsName() string { return "admin_room_block" }
+func (ReqGetAdminRoomBlock) GetMsgType() int32      { return internals.MSG_GET_ADMIN_ROOM_BLOCK }
+func (ReqGetAdminRoomBlock) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminRoomBlock) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminRoomBlock) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminRoomBlock) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminRoomBlock) NewRequest() core.Coder {
+	return new(external.AdminRoomBlockRequest)
+}
+func (ReqGetAdminRoomBlock) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminRoomBlockRequest)
+	msg.RoomID = vars["roomID"]
+	return nil
+}
+func (ReqGetAdminRoomBlock) NewResponse(code int) core.Coder {
+	return new(external.AdminRoomBlockResponse)
+}
+func (ReqGetAdminRoomBlock) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminRoomBlockRequest)
+	return routing.GetAdminRoomBlock(ctx, req, device.UserID, c.Cfg, c.accountDB, c.cacheIn)
+}
+
+type ReqGetAdminUsers struct{}
+
+func (ReqGetAdminUsers) GetRoute() string       { return "/users" }
+func (ReqGetAdminUsers) GetMetricsName() string { return "admin_users" }
+func (ReqGetAdminUsers) GetMsgType() int32      { return internals.MSG_GET_ADMIN_USERS }
+func (ReqGetAdminUsers) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminUsers) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminUsers) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminUsers) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminUsers) NewRequest() core.Coder {
+	return new(external.GetAdminUsersRequest)
+}
+func (ReqGetAdminUsers) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetAdminUsersRequest)
+	query := req.URL.Query()
+	msg.Search = query.Get("search")
+	if from := query.Get("from"); from != "" {
+		v, err := strconv.Atoi(from)
+		if err != nil {
+			return err
+		}
+		msg.From = v
+	}
+	if limit := query.Get("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil {
+			return err
+		}
+		msg.Limit = v
+	}
+	return nil
+}
+func (ReqGetAdminUsers) NewResponse(code int) core.Coder {
+	return new(external.GetAdminUsersResponse)
+}
+func (ReqGetAdminUsers) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetAdminUsersRequest)
+	return routing.GetAdminUsers(ctx, req, device.UserID, c.Cfg, c.accountDB)
+}
+
+type ReqGetAdminUser struct{}
+
+func (ReqGetAdminUser) GetRoute() string       { return "/users/{userID}" }
+func (ReqGetAdminUser) GetMetricsName() string { return "admin_user" }
+func (ReqGetAdminUser) GetMsgType() int32      { return internals.MSG_GET_ADMIN_USER }
+func (ReqGetAdminUser) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminUser) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminUser) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminUser) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminUser) NewRequest() core.Coder {
+	return new(external.AdminUserRequest)
+}
+func (ReqGetAdminUser) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminUserRequest)
+	msg.UserID = vars["userID"]
+	return nil
+}
+func (ReqGetAdminUser) NewResponse(code int) core.Coder {
+	return new(external.AdminUserInfo)
+}
+func (ReqGetAdminUser) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminUserRequest)
+	return routing.GetAdminUser(ctx, req, device.UserID, c.Cfg, c.accountDB)
+}
+
+type ReqPostAdminUserResetPassword struct{}
+
+func (ReqPostAdminUserResetPassword) GetRoute() string       { return "/users/{userID}/reset_password" }
+func (ReqPostAdminUserResetPassword) GetMetricsName() string { return "admin_user_reset_password" }
+func (ReqPostAdminUserResetPassword) GetMsgType() int32 {
+	return internals.MSG_POST_ADMIN_USER_RESET_PASSWORD
+}
+func (ReqPostAdminUserResetPassword) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqPostAdminUserResetPassword) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminUserResetPassword) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqPostAdminUserResetPassword) GetPrefix() []string { return []string{"admin"} }
+func (ReqPostAdminUserResetPassword) NewRequest() core.Coder {
+	return new(external.PostAdminUserResetPasswordRequest)
+}
+func (ReqPostAdminUserResetPassword) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAdminUserResetPasswordRequest)
+	if err := common.UnmarshalJSON(req, msg); err != nil {
+		return err
+	}
+	msg.UserID = vars["userID"]
+	return nil
+}
+func (ReqPostAdminUserResetPassword) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPostAdminUserResetPassword) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAdminUserResetPasswordRequest)
+	return routing.AdminUserResetPassword(
+		ctx, req, device.UserID, c.Cfg, c.accountDB, c.deviceDB, c.cacheIn,
+		c.encryptDB, c.syncDB, c.tokenFilter, c.RpcCli,
+	)
+}
+
+type ReqPostAdminUserLock struct{}
+
+func (ReqPostAdminUserLock) GetRoute() string       { return "/users/{userID}/lock" }
+func (ReqPostAdminUserLock) GetMetricsName() string { return "admin_user_lock" }
+func (ReqPostAdminUserLock) GetMsgType() int32      { return internals.MSG_POST_ADMIN_USER_LOCK }
+func (ReqPostAdminUserLock) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostAdminUserLock) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminUserLock) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAdminUserLock) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPostAdminUserLock) NewRequest() core.Coder {
+	return new(external.AdminUserRequest)
+}
+func (ReqPostAdminUserLock) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminUserRequest)
+	msg.UserID = vars["userID"]
+	return nil
+}
+func (ReqPostAdminUserLock) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPostAdminUserLock) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminUserRequest)
+	return routing.AdminUserLock(
+		ctx, req, device.UserID, c.Cfg, c.accountDB, c.deviceDB, c.cacheIn,
+		c.encryptDB, c.syncDB, c.tokenFilter, c.RpcCli,
+	)
+}
+
+type ReqPostAdminUserUnlock struct{}
+
+func (ReqPostAdminUserUnlock) GetRoute() string       { return "/users/{userID}/unlock" }
+func (ReqPostAdminUserUnlock) GetMetricsName() string { return "admin_user_unlock" }
+func (ReqPostAdminUserUnlock) GetMsgType() int32      { return internals.MSG_POST_ADMIN_USER_UNLOCK }
+func (ReqPostAdminUserUnlock) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostAdminUserUnlock) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminUserUnlock) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAdminUserUnlock) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPostAdminUserUnlock) NewRequest() core.Coder {
+	return new(external.AdminUserRequest)
+}
+func (ReqPostAdminUserUnlock) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminUserRequest)
+	msg.UserID = vars["userID"]
+	return nil
+}
+func (ReqPostAdminUserUnlock) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPostAdminUserUnlock) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminUserRequest)
+	return routing.AdminUserUnlock(ctx, req, device.UserID, c.Cfg, c.accountDB)
+}
+
+type ReqPostAdminUserLogout struct{}
+
+func (ReqPostAdminUserLogout) GetRoute() string       { return "/users/{userID}/logout" }
+func (ReqPostAdminUserLogout) GetMetricsName() string { return "admin_user_logout" }
+func (ReqPostAdminUserLogout) GetMsgType() int32      { return internals.MSG_POST_ADMIN_USER_LOGOUT }
+func (ReqPostAdminUserLogout) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostAdminUserLogout) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminUserLogout) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostAdminUserLogout) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPostAdminUserLogout) NewRequest() core.Coder {
+	return new(external.AdminUserRequest)
+}
+func (ReqPostAdminUserLogout) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminUserRequest)
+	msg.UserID = vars["userID"]
+	return nil
+}
+func (ReqPostAdminUserLogout) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPostAdminUserLogout) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminUserRequest)
+	return routing.AdminUserLogout(
+		ctx, req, device.UserID, c.Cfg, c.accountDB, c.deviceDB, c.cacheIn,
+		c.encryptDB, c.syncDB, c.tokenFilter, c.RpcCli,
+	)
+}
+
+type ReqPutAdminUserAdmin struct{}
+
+func (ReqPutAdminUserAdmin) GetRoute() string       { return "/users/{userID}/admin" }
+func (ReqPutAdminUserAdmin) GetMetricsName() string { return "admin_user_admin" }
+func (ReqPutAdminUserAdmin) GetMsgType() int32      { return internals.MSG_PUT_ADMIN_USER_ADMIN }
+func (ReqPutAdminUserAdmin) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPutAdminUserAdmin) GetMethod() []string {
+	return []string{http.MethodPut, http.MethodOptions}
+}
+func (ReqPutAdminUserAdmin) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPutAdminUserAdmin) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPutAdminUserAdmin) NewRequest() core.Coder {
+	return new(external.PutAdminUserAdminRequest)
+}
+func (ReqPutAdminUserAdmin) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PutAdminUserAdminRequest)
+	if err := common.UnmarshalJSON(req, msg); err != nil {
+		return err
+	}
+	msg.UserID = vars["userID"]
+	return nil
+}
+func (ReqPutAdminUserAdmin) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPutAdminUserAdmin) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PutAdminUserAdminRequest)
+	return routing.PutAdminUserAdmin(ctx, req, device.UserID, c.Cfg, c.accountDB)
+}
+
+type ReqPutAdminUserShadowBan struct{}
+
+func (ReqPutAdminUserShadowBan) GetRoute() string       { return "/users/{userID}/shadow_ban" }
+func (ReqPutAdminUserShadowBan) GetMetricsName() string { return "admin_user_shadow_ban" }
+func (ReqPutAdminUserShadowBan) GetMsgType() int32      { return internals.MSG_PUT_ADMIN_USER_SHADOW_BAN }
+func (ReqPutAdminUserShadowBan) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPutAdminUserShadowBan) GetMethod() []string {
+	return []string{http.MethodPut, http.MethodOptions}
+}
+func (ReqPutAdminUserShadowBan) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPutAdminUserShadowBan) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPutAdminUserShadowBan) NewRequest() core.Coder {
+	return new(external.PutAdminUserShadowBanRequest)
+}
+func (ReqPutAdminUserShadowBan) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PutAdminUserShadowBanRequest)
+	if err := common.UnmarshalJSON(req, msg); err != nil {
+		return err
+	}
+	msg.UserID = vars["userID"]
+	return nil
+}
+func (ReqPutAdminUserShadowBan) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPutAdminUserShadowBan) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PutAdminUserShadowBanRequest)
+	return routing.PutAdminUserShadowBan(ctx, req, device.UserID, c.Cfg, c.accountDB, c.cacheIn)
+}
+
+type ReqGetWhoIs struct{}
+
+func (ReqGetWhoIs) GetRoute() string       { return "/admin/whois/{userId}" }
+func (ReqGetWhoIs) GetMetricsName() string { return "whois" }
+func (ReqGetWhoIs) GetMsgType() int32      { return internals.MSG_GET_WHO_IS }
+func (ReqGetWhoIs) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetWhoIs) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetWhoIs) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetWhoIs) GetPrefix() []string                  { return []string{"r0"} }
+func (ReqGetWhoIs) NewRequest() core.Coder {
+	return new(external.GetWhoIsRequest)
+}
+func (ReqGetWhoIs) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetWhoIsRequest)
+	msg.UserID = vars["userId"]
+	return nil
+}
+func (ReqGetWhoIs) NewResponse(code int) core.Coder {
+	return new(external.GetWhoIsResponse)
+}
+func (ReqGetWhoIs) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetWhoIsRequest)
+	return routing.GetWhoIs(ctx, req, device.UserID, c.Cfg, c.accountDB, c.cacheIn)
+}
+
+type ReqPostRoomReport struct{}
+
+func (ReqPostRoomReport) GetRoute() string       { return "/rooms/{roomId}/report/{eventId}" }
+func (ReqPostRoomReport) GetMetricsName() string { return "room_report" }
+func (ReqPostRoomReport) GetMsgType() int32      { return internals.MSG_POST_ROOM_REPORT }
+func (ReqPostRoomReport) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostRoomReport) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostRoomReport) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostRoomReport) GetPrefix() []string                  { return []string{"r0"} }
+func (ReqPostRoomReport) NewRequest() core.Coder {
+	return new(external.PostRoomReportRequest)
+}
+func (ReqPostRoomReport) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostRoomReportRequest)
+	if err := common.UnmarshalJSON(req, msg); err != nil {
+		return err
+	}
+	msg.RoomID = vars["roomId"]
+	msg.EventID = vars["eventId"]
+	return nil
+}
+func (ReqPostRoomReport) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPostRoomReport) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostRoomReportRequest)
+	return routing.ReportEvent(ctx, req, device.UserID, c.Cfg, c.roomDB, c.rsRpcCli, c.idg)
+}
+
+type ReqGetAdminEventReports struct{}
+
+func (ReqGetAdminEventReports) GetRoute() string       { return "/event_reports" }
+func (ReqGetAdminEventReports) GetMetricsName() string { return "admin_event_reports" }
+func (ReqGetAdminEventReports) GetMsgType() int32      { return internals.MSG_GET_ADMIN_EVENT_REPORTS }
+func (ReqGetAdminEventReports) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminEventReports) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminEventReports) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminEventReports) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminEventReports) NewRequest() core.Coder {
+	return new(external.GetAdminEventReportsRequest)
+}
+func (ReqGetAdminEventReports) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetAdminEventReportsRequest)
+	query := req.URL.Query()
+	msg.RoomID = query.Get("room_id")
+	msg.UserID = query.Get("user_id")
+	msg.Resolved = query.Get("resolved")
+	if from := query.Get("from"); from != "" {
+		v, err := strconv.Atoi(from)
+		if err != nil {
+			return err
+		}
+		msg.From = v
+	}
+	if limit := query.Get("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil {
+			return err
+		}
+		msg.Limit = v
+	}
+	return nil
+}
+func (ReqGetAdminEventReports) NewResponse(code int) core.Coder {
+	return new(external.GetAdminEventReportsResponse)
+}
+func (ReqGetAdminEventReports) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetAdminEventReportsRequest)
+	return routing.GetAdminEventReports(ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB)
+}
+
+type ReqGetAdminEventReport struct{}
+
+func (ReqGetAdminEventReport) GetRoute() string       { return "/event_reports/{reportID}" }
+func (ReqGetAdminEventReport) GetMetricsName() string { return "admin_event_report" }
+func (ReqGetAdminEventReport) GetMsgType() int32      { return internals.MSG_GET_ADMIN_EVENT_REPORT }
+func (ReqGetAdminEventReport) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminEventReport) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminEventReport) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminEventReport) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminEventReport) NewRequest() core.Coder {
+	return new(external.AdminEventReportRequest)
+}
+func (ReqGetAdminEventReport) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.AdminEventReportRequest)
+	id, err := strconv.ParseInt(vars["reportID"], 10, 64)
+	if err != nil {
+		return err
+	}
+	msg.ReportID = id
+	return nil
+}
+func (ReqGetAdminEventReport) NewResponse(code int) core.Coder {
+	return new(external.EventReportInfo)
+}
+func (ReqGetAdminEventReport) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.AdminEventReportRequest)
+	return routing.GetAdminEventReport(ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB)
+}
+
+type ReqPostAdminEventReportResolve struct{}
+
+func (ReqPostAdminEventReportResolve) GetRoute() string { return "/event_reports/{reportID}/resolve" }
+func (ReqPostAdminEventReportResolve) GetMetricsName() string {
+	return "admin_event_report_resolve"
+}
+func (ReqPostAdminEventReportResolve) GetMsgType() int32 {
+	return internals.MSG_POST_ADMIN_EVENT_REPORT_RESOLVE
+}
+func (ReqPostAdminEventReportResolve) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqPostAdminEventReportResolve) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminEventReportResolve) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqPostAdminEventReportResolve) GetPrefix() []string { return []string{"admin"} }
+func (ReqPostAdminEventReportResolve) NewRequest() core.Coder {
+	return new(external.PostAdminEventReportResolveRequest)
+}
+func (ReqPostAdminEventReportResolve) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAdminEventReportResolveRequest)
+	if req.ContentLength != 0 {
+		if err := common.UnmarshalJSON(req, msg); err != nil {
+			return err
+		}
+	}
+	id, err := strconv.ParseInt(vars["reportID"], 10, 64)
+	if err != nil {
+		return err
+	}
+	msg.ReportID = id
+	return nil
+}
+func (ReqPostAdminEventReportResolve) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPostAdminEventReportResolve) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAdminEventReportResolveRequest)
+	return routing.AdminEventReportResolve(ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB)
+}
+
+type ReqPutAdminEventReportNote struct{}
+
+func (ReqPutAdminEventReportNote) GetRoute() string       { return "/event_reports/{reportID}/note" }
+func (ReqPutAdminEventReportNote) GetMetricsName() string { return "admin_event_report_note" }
+func (ReqPutAdminEventReportNote) GetMsgType() int32 {
+	return internals.MSG_PUT_ADMIN_EVENT_REPORT_NOTE
+}
+func (ReqPutAdminEventReportNote) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqPutAdminEventReportNote) GetMethod() []string {
+	return []string{http.MethodPut, http.MethodOptions}
+}
+func (ReqPutAdminEventReportNote) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPutAdminEventReportNote) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPutAdminEventReportNote) NewRequest() core.Coder {
+	return new(external.PutAdminEventReportNoteRequest)
+}
+func (ReqPutAdminEventReportNote) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PutAdminEventReportNoteRequest)
+	if err := common.UnmarshalJSON(req, msg); err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(vars["reportID"], 10, 64)
+	if err != nil {
+		return err
+	}
+	msg.ReportID = id
+	return nil
+}
+func (ReqPutAdminEventReportNote) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPutAdminEventReportNote) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PutAdminEventReportNoteRequest)
+	return routing.PutAdminEventReportNote(ctx, req, device.UserID, c.Cfg, c.accountDB, c.roomDB)
+}
+
+type ReqGetAdminRoomExport struct{}
+
+func (ReqGetAdminRoomExport) GetRoute() string       { return "/rooms/{roomID}/export" }
+func (ReqGetAdminRoomExport) GetMetricsName() string { return "admin_room_export" }
+func (ReqGetAdminRoomExport) GetMsgType() int32      { return internals.MSG_GET_ADMIN_ROOM_EXPORT }
+func (ReqGetAdminRoomExport) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminRoomExport) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminRoomExport) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminRoomExport) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminRoomExport) NewRequest() core.Coder {
+	return new(external.GetAdminRoomExportRequest)
+}
+func (ReqGetAdminRoomExport) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetAdminRoomExportRequest)
+	msg.RoomID = vars["roomID"]
+	query := req.URL.Query()
+	msg.From = query.Get("from")
+	for name, dst := range map[string]*int64{"from_ts": &msg.FromTs, "to_ts": &msg.ToTs} {
+		if val := query.Get(name); val != "" {
+			v, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return err
+			}
+			*dst = v
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil {
+			return err
+		}
+		msg.Limit = v
+	}
+	return nil
+}
+func (ReqGetAdminRoomExport) NewResponse(code int) core.Coder {
+	return new(external.GetAdminRoomExportResponse)
+}
+func (ReqGetAdminRoomExport) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetAdminRoomExportRequest)
+	return routing.GetAdminRoomExport(ctx, req, device.UserID, c.Cfg, c.accountDB, c.syncDB)
+}
+
+type ReqGetAdminLegalHolds struct{}
+
+func (ReqGetAdminLegalHolds) GetRoute() string       { return "/legal_holds" }
+func (ReqGetAdminLegalHolds) GetMetricsName() string { return "admin_legal_holds" }
+func (ReqGetAdminLegalHolds) GetMsgType() int32      { return internals.MSG_GET_ADMIN_LEGAL_HOLDS }
+func (ReqGetAdminLegalHolds) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminLegalHolds) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminLegalHolds) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminLegalHolds) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminLegalHolds) NewRequest() core.Coder               { return nil }
+func (ReqGetAdminLegalHolds) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	return nil
+}
+func (ReqGetAdminLegalHolds) NewResponse(code int) core.Coder {
+	return new(external.GetAdminLegalHoldsResponse)
+}
+func (ReqGetAdminLegalHolds) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	return routing.GetAdminLegalHolds(ctx, device.UserID, c.Cfg, c.accountDB, c.syncDB)
+}
+
+type ReqPutAdminLegalHold struct{}
+
+func (ReqPutAdminLegalHold) GetRoute() string       { return "/legal_holds/{target}" }
+func (ReqPutAdminLegalHold) GetMetricsName() string { return "admin_put_legal_hold" }
+func (ReqPutAdminLegalHold) GetMsgType() int32      { return internals.MSG_PUT_ADMIN_LEGAL_HOLD }
+func (ReqPutAdminLegalHold) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPutAdminLegalHold) GetMethod() []string {
+	return []string{http.MethodPut, http.MethodOptions}
+}
+func (ReqPutAdminLegalHold) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPutAdminLegalHold) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqPutAdminLegalHold) NewRequest() core.Coder {
+	return new(external.PutAdminLegalHoldRequest)
+}
+func (ReqPutAdminLegalHold) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PutAdminLegalHoldRequest)
+	if req.ContentLength != 0 {
+		if err := common.UnmarshalJSON(req, msg); err != nil {
+			return err
+		}
+	}
+	msg.Target = vars["target"]
+	return nil
+}
+func (ReqPutAdminLegalHold) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqPutAdminLegalHold) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PutAdminLegalHoldRequest)
+	return routing.PutAdminLegalHold(ctx, req, device.UserID, c.Cfg, c.accountDB, c.syncDB)
+}
+
+type ReqDelAdminLegalHold struct{}
+
+func (ReqDelAdminLegalHold) GetRoute() string       { return "/legal_holds/{target}" }
+func (ReqDelAdminLegalHold) GetMetricsName() string { return "admin_del_legal_hold" }
+func (ReqDelAdminLegalHold) GetMsgType() int32      { return internals.MSG_DEL_ADMIN_LEGAL_HOLD }
+func (ReqDelAdminLegalHold) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqDelAdminLegalHold) GetMethod() []string {
+	return []string{http.MethodDelete, http.MethodOptions}
+}
+func (ReqDelAdminLegalHold) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqDelAdminLegalHold) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqDelAdminLegalHold) NewRequest() core.Coder {
+	return new(external.DelAdminLegalHoldRequest)
+}
+func (ReqDelAdminLegalHold) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.DelAdminLegalHoldRequest)
+	msg.Target = vars["target"]
+	return nil
+}
+func (ReqDelAdminLegalHold) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqDelAdminLegalHold) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.DelAdminLegalHoldRequest)
+	return routing.DelAdminLegalHold(ctx, req, device.UserID, c.Cfg, c.accountDB, c.syncDB)
+}
+
+type ReqGetAdminRegistrationTokens struct{}
+
+func (ReqGetAdminRegistrationTokens) GetRoute() string       { return "/registration_tokens" }
+func (ReqGetAdminRegistrationTokens) GetMetricsName() string { return "admin_registration_tokens" }
+func (ReqGetAdminRegistrationTokens) GetMsgType() int32 {
+	return internals.MSG_GET_ADMIN_REGISTRATION_TOKENS
+}
+func (ReqGetAdminRegistrationTokens) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqGetAdminRegistrationTokens) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminRegistrationTokens) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqGetAdminRegistrationTokens) GetPrefix() []string { return []string{"admin"} }
+func (ReqGetAdminRegistrationTokens) NewRequest() core.Coder {
+	return nil
+}
+func (ReqGetAdminRegistrationTokens) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	return nil
+}
+func (ReqGetAdminRegistrationTokens) NewResponse(code int) core.Coder {
+	return new(external.GetAdminRegistrationTokensResponse)
+}
+func (ReqGetAdminRegistrationTokens) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	return routing.GetAdminRegistrationTokens(ctx, device.UserID, &c.Cfg, c.accountDB)
+}
+
+type ReqPostAdminRegistrationToken struct{}
+
+func (ReqPostAdminRegistrationToken) GetRoute() string       { return "/registration_tokens/new" }
+func (ReqPostAdminRegistrationToken) GetMetricsName() string { return "admin_post_registration_token" }
+func (ReqPostAdminRegistrationToken) GetMsgType() int32 {
+	return internals.MSG_POST_ADMIN_REGISTRATION_TOKEN
+}
+func (ReqPostAdminRegistrationToken) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqPostAdminRegistrationToken) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminRegistrationToken) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqPostAdminRegistrationToken) GetPrefix() []string { return []string{"admin"} }
+func (ReqPostAdminRegistrationToken) NewRequest() core.Coder {
+	return new(external.PostAdminRegistrationTokenRequest)
+}
+func (ReqPostAdminRegistrationToken) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostAdminRegistrationTokenRequest)
+	if req.ContentLength != 0 {
+		if err := common.UnmarshalJSON(req, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (ReqPostAdminRegistrationToken) NewResponse(code int) core.Coder {
+	return new(external.AdminRegistrationToken)
+}
+func (ReqPostAdminRegistrationToken) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostAdminRegistrationTokenRequest)
+	return routing.PostAdminRegistrationToken(ctx, req, device.UserID, &c.Cfg, c.accountDB)
+}
+
+type ReqDelAdminRegistrationToken struct{}
+
+func (ReqDelAdminRegistrationToken) GetRoute() string       { return "/registration_tokens/{token}" }
+func (ReqDelAdminRegistrationToken) GetMetricsName() string { return "admin_del_registration_token" }
+func (ReqDelAdminRegistrationToken) GetMsgType() int32 {
+	return internals.MSG_DEL_ADMIN_REGISTRATION_TOKEN
+}
+func (ReqDelAdminRegistrationToken) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqDelAdminRegistrationToken) GetMethod() []string {
+	return []string{http.MethodDelete, http.MethodOptions}
+}
+func (ReqDelAdminRegistrationToken) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqDelAdminRegistrationToken) GetPrefix() []string { return []string{"admin"} }
+func (ReqDelAdminRegistrationToken) NewRequest() core.Coder {
+	return new(external.DelAdminRegistrationTokenRequest)
+}
+func (ReqDelAdminRegistrationToken) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.DelAdminRegistrationTokenRequest)
+	msg.Token = vars["token"]
+	return nil
+}
+func (ReqDelAdminRegistrationToken) NewResponse(code int) core.Coder {
+	return nil
+}
+func (ReqDelAdminRegistrationToken) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.DelAdminRegistrationTokenRequest)
+	return routing.DelAdminRegistrationToken(ctx, req, device.UserID, &c.Cfg, c.accountDB)
+}
+
+type ReqPostAdminConfigReload struct{}
+
+func (ReqPostAdminConfigReload) GetRoute() string       { return "/config/reload" }
+func (ReqPostAdminConfigReload) GetMetricsName() string { return "admin_config_reload" }
+func (ReqPostAdminConfigReload) GetMsgType() int32 {
+	return internals.MSG_POST_ADMIN_CONFIG_RELOAD
+}
+func (ReqPostAdminConfigReload) GetAPIType() int8 { return apiconsumer.APITypeAuth }
+func (ReqPostAdminConfigReload) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostAdminConfigReload) GetTopic(cfg *config.Dendrite) string {
+	return getProxyRpcTopic(cfg)
+}
+func (ReqPostAdminConfigReload) GetPrefix() []string { return []string{"admin"} }
+func (ReqPostAdminConfigReload) NewRequest() core.Coder {
+	return nil
+}
+func (ReqPostAdminConfigReload) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	return nil
+}
+func (ReqPostAdminConfigReload) NewResponse(code int) core.Coder {
+	return new(external.PostAdminConfigReloadResponse)
+}
+func (ReqPostAdminConfigReload) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	return routing.AdminConfigReload(ctx, device.UserID, &c.Cfg, c.accountDB)
+}
+
+type ReqGetAdminAuditEvents struct{}
+
+func (ReqGetAdminAuditEvents) GetRoute() string       { return "/audit" }
+func (ReqGetAdminAuditEvents) GetMetricsName() string { return "admin_audit_events" }
+func (ReqGetAdminAuditEvents) GetMsgType() int32      { return internals.MSG_GET_ADMIN_AUDIT_EVENTS }
+func (ReqGetAdminAuditEvents) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqGetAdminAuditEvents) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetAdminAuditEvents) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetAdminAuditEvents) GetPrefix() []string                  { return []string{"admin"} }
+func (ReqGetAdminAuditEvents) NewRequest() core.Coder {
+	return new(external.GetAdminAuditEventsRequest)
+}
+func (ReqGetAdminAuditEvents) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetAdminAuditEventsRequest)
+	query := req.URL.Query()
+	msg.UserID = query.Get("user_id")
+	msg.Type = query.Get("type")
+	for name, v := range map[string]*int64{"from": &msg.From, "since": &msg.Since, "until": &msg.Until} {
+		if s := query.Get(name); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return err
+			}
+			*v = n
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil {
+			return err
+		}
+		msg.Limit = v
+	}
+	return nil
+}
+func (ReqGetAdminAuditEvents) NewResponse(code int) core.Coder {
+	return new(external.GetAdminAuditEventsResponse)
+}
+func (ReqGetAdminAuditEvents) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetAdminAuditEventsRequest)
+	return routing.GetAdminAuditEvents(ctx, req, device.UserID, &c.Cfg, c.accountDB)
+}
+
+type ReqPostUserOpenID struct{}
+
+func (ReqPostUserOpenID) GetRoute() string       { return "/user/{userId}/openid/request_token" }
+func (ReqPostUserOpenID) GetMetricsName() string { return "user_openid" }
+func (ReqPostUserOpenID) GetMsgType() int32      { return internals.MSG_POST_USER_OPENID }
+func (ReqPostUserOpenID) GetAPIType() int8       { return apiconsumer.APITypeAuth }
+func (ReqPostUserOpenID) GetMethod() []string {
+	return []string{http.MethodPost, http.MethodOptions}
+}
+func (ReqPostUserOpenID) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqPostUserOpenID) GetPrefix() []string                  { return []string{"r0"} }
+func (ReqPostUserOpenID) NewRequest() core.Coder {
+	return new(external.PostUserOpenIDRequest)
+}
+func (ReqPostUserOpenID) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.PostUserOpenIDRequest)
+	msg.UserID = vars["userId"]
+	return nil
+}
+func (ReqPostUserOpenID) NewResponse(code int) core.Coder {
+	return new(external.PostUserOpenIDResponse)
+}
+func (ReqPostUserOpenID) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.PostUserOpenIDRequest)
+	return routing.RequestOpenIDToken(ctx, req, device.UserID, c.Cfg, c.cacheIn)
+}
+
+type ReqGetFedOpenIDUserInfo struct{}
+
+func (ReqGetFedOpenIDUserInfo) GetRoute() string       { return "/openid/userinfo" }
+func (ReqGetFedOpenIDUserInfo) GetMetricsName() string { return "federation_openid_userinfo" }
+func (ReqGetFedOpenIDUserInfo) GetMsgType() int32      { return internals.MSG_GET_FED_OPENID_USERINFO }
+func (ReqGetFedOpenIDUserInfo) GetAPIType() int8       { return apiconsumer.APITypeExternal }
+func (ReqGetFedOpenIDUserInfo) GetMethod() []string {
+	return []string{http.MethodGet, http.MethodOptions}
+}
+func (ReqGetFedOpenIDUserInfo) GetTopic(cfg *config.Dendrite) string { return getProxyRpcTopic(cfg) }
+func (ReqGetFedOpenIDUserInfo) GetPrefix() []string                  { return []string{"fedV1"} }
+func (ReqGetFedOpenIDUserInfo) NewRequest() core.Coder {
+	return new(external.GetFedOpenIDUserInfoRequest)
+}
+func (ReqGetFedOpenIDUserInfo) FillRequest(coder core.Coder, req *http.Request, vars map[string]string) error {
+	msg := coder.(*external.GetFedOpenIDUserInfoRequest)
+	msg.AccessToken, _ = common.ExtractAccessToken(req)
+	return nil
+}
+func (ReqGetFedOpenIDUserInfo) NewResponse(code int) core.Coder {
+	return new(external.GetFedOpenIDUserInfoResponse)
+}
+func (ReqGetFedOpenIDUserInfo) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
+	c := consumer.(*InternalMsgConsumer)
+	req := msg.(*external.GetFedOpenIDUserInfoRequest)
+	return routing.GetOpenIDUserInfo(ctx, req, c.cacheIn)
+}
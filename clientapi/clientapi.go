@@ -18,18 +18,22 @@
 package clientapi
 
 import (
+	"context"
+
 	"github.com/finogeeks/ligase/clientapi/api"
 	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
 
 	// "github.com/finogeeks/ligase/clientapi/routing"
 	"github.com/finogeeks/ligase/clientapi/rpc"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/basecomponent"
 	"github.com/finogeeks/ligase/common/filter"
 	"github.com/finogeeks/ligase/common/uid"
 	fed "github.com/finogeeks/ligase/federation/fedreq"
 	"github.com/finogeeks/ligase/model/service"
 	"github.com/finogeeks/ligase/model/service/roomserverapi"
+	"github.com/finogeeks/ligase/skunkworks/log"
 	"github.com/finogeeks/ligase/storage/model"
 )
 
@@ -53,6 +57,9 @@ func SetupClientAPIComponent(
 	complexCache *common.ComplexCache,
 	serverConfDB model.ConfigDatabase,
 ) {
+	audit.Init(base.Cfg, accountsDB)
+	loadShadowBannedUsers(accountsDB, cache)
+
 	profileRpcConsumer := rpc.NewProfileRpcConsumer(rpcCli, base.Cfg, rsRpcCli, idg, accountsDB, presenceDB, cache, complexCache)
 	profileRpcConsumer.Start()
 
@@ -65,3 +72,19 @@ func SetupClientAPIComponent(
 	)
 	apiConsumer.Start()
 }
+
+// loadShadowBannedUsers copies the shadow banned accounts to the cache, sends
+// are checked against the cache only
+func loadShadowBannedUsers(db model.AccountsDatabase, cache service.Cache) {
+	userIDs, err := db.GetShadowBannedAccounts(context.Background())
+	if err != nil {
+		log.Errorf("clientapi load shadow banned users error %v", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if err := cache.SetUserShadowBanned(userID); err != nil {
+			log.Errorf("clientapi cache shadow banned user %s error %v", userID, err)
+		}
+	}
+	log.Infof("clientapi loaded %d shadow banned users", len(userIDs))
+}
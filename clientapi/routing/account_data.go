@@ -46,7 +46,7 @@ func SaveAccountData(
 ) (int, core.Coder) {
 	body := content
 
-	log.Infof("SaveAccountData user %s device_id %s room_id %s data_type %s data %", userID, deviceID, roomID, dataType, string(body))
+	log.Infof("SaveAccountData user %s device_id %s room_id %s data_type %s data %s", userID, deviceID, roomID, dataType, string(body))
 
 	data := new(types.ActDataStreamUpdate)
 	data.UserID = userID
@@ -0,0 +1,111 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/finogeeks/ligase/common/audit"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+// auditAdmin records an action done through the admin api
+func auditAdmin(ctx context.Context, userID, action, target, roomID string, details map[string]string) {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["action"] = action
+	audit.Emit(ctx, &authtypes.AuditEvent{
+		Type:    authtypes.AuditAdminAction,
+		UserID:  userID,
+		Target:  target,
+		RoomID:  roomID,
+		Success: true,
+		Details: details,
+	})
+}
+
+// GetAdminAuditEvents implements GET /_ligase/admin/v1/audit, for the server
+// admins and the auditors of the config
+func GetAdminAuditEvents(
+	ctx context.Context,
+	req *external.GetAdminAuditEventsRequest,
+	userID string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !audit.IsAuditor(userID) && !isServerAdmin(ctx, cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not an auditor")
+	}
+	if !cfg.Audit.Table {
+		return http.StatusNotFound, jsonerror.NotFound("The audit events are not stored, audit.table is off")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = adminUsersDefaultLimit
+	} else if limit > adminUsersMaxLimit {
+		limit = adminUsersMaxLimit
+	}
+	if req.From < 0 {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("from must not be negative")
+	}
+
+	events, err := accountDB.GetAuditEvents(ctx, &authtypes.AuditFilter{
+		From:   req.From,
+		Limit:  limit,
+		UserID: req.UserID,
+		Type:   req.Type,
+		Since:  req.Since,
+		Until:  req.Until,
+	})
+	if err != nil {
+		log.Errorf("get audit events error %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to get audit events")
+	}
+	log.Infof("%s read %d audit events from %d", userID, len(events), req.From)
+
+	resp := &external.GetAdminAuditEventsResponse{
+		Events: make([]external.AdminAuditEvent, 0, len(events)),
+		// a filtered page skips the events of the others
+		ChainBrokenAt: authtypes.VerifyAuditChain(events, req.UserID == "" && req.Type == "" && req.Since == 0 && req.Until == 0),
+	}
+	for _, ev := range events {
+		resp.Events = append(resp.Events, external.AdminAuditEvent{
+			Seq:      ev.Seq,
+			Ts:       ev.Ts,
+			Type:     ev.Type,
+			UserID:   ev.UserID,
+			DeviceID: ev.DeviceID,
+			IP:       ev.IP,
+			Target:   ev.Target,
+			RoomID:   ev.RoomID,
+			Success:  ev.Success,
+			Details:  ev.Details,
+			PrevHash: ev.PrevHash,
+			Hash:     ev.Hash,
+		})
+	}
+	if len(events) == limit {
+		resp.NextFrom = events[len(events)-1].Seq
+	}
+	return http.StatusOK, resp
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	jsonRaw "encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/compliance"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/syncapitypes"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+const (
+	adminExportDefaultLimit = 500
+	adminExportMaxLimit     = 5000
+)
+
+// GetAdminRoomExport implements GET /_ligase/admin/v1/rooms/{roomID}/export
+// Every page is signed by the server key, the whole history is fetched by
+// following next_token. The cmd/export tool writes it in one file instead.
+func GetAdminRoomExport(
+	ctx context.Context,
+	req *external.GetAdminRoomExportRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	syncDB model.SyncAPIDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = adminExportDefaultLimit
+	} else if limit > adminExportMaxLimit {
+		limit = adminExportMaxLimit
+	}
+	now := time.Now().UnixNano() / 1000000
+	toTs := req.ToTs
+	if toTs <= 0 {
+		toTs = now
+	}
+	fromPos := compliance.MinStreamPos
+	if req.From != "" {
+		pos, err := strconv.ParseInt(req.From, 10, 64)
+		if err != nil {
+			return http.StatusBadRequest, jsonerror.InvalidArgumentValue("invalid from token")
+		}
+		fromPos = pos
+	}
+
+	exporter := compliance.NewExporter(&cfg, syncDB)
+	records, err := exporter.Records(ctx, req.RoomID, req.FromTs, toTs, fromPos, limit)
+	if err != nil {
+		log.Errorf("admin export room %s error %v", req.RoomID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to export room")
+	}
+	resp := &external.GetAdminRoomExportResponse{
+		RoomID:     req.RoomID,
+		FromTs:     req.FromTs,
+		ToTs:       toTs,
+		ExportedTs: now,
+		Count:      len(records),
+		Events:     make([]jsonRaw.RawMessage, 0, len(records)),
+	}
+	for i := range records {
+		bytes, err := json.Marshal(&records[i])
+		if err != nil {
+			return http.StatusInternalServerError, jsonerror.Unknown("failed to export room")
+		}
+		resp.Events = append(resp.Events, bytes)
+	}
+	if len(records) == limit {
+		resp.NextToken = strconv.FormatInt(records[len(records)-1].StreamID, 10)
+	}
+
+	unsigned, err := json.Marshal(resp)
+	if err == nil {
+		var signed []byte
+		if signed, err = exporter.Sign(unsigned); err == nil {
+			err = json.Unmarshal(signed, resp)
+		}
+	}
+	if err != nil {
+		log.Errorf("admin export room %s sign error %v", req.RoomID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to sign export")
+	}
+	log.Infof("admin %s export room %s from %d count %d", userID, req.RoomID, fromPos, len(records))
+	auditAdmin(ctx, userID, "export_room", "", req.RoomID, map[string]string{"count": strconv.Itoa(len(records))})
+	return http.StatusOK, resp
+}
+
+// GetAdminLegalHolds implements GET /_ligase/admin/v1/legal_holds
+func GetAdminLegalHolds(
+	ctx context.Context,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	syncDB model.SyncAPIDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	holds, err := syncDB.GetLegalHolds(ctx)
+	if err != nil {
+		log.Errorf("admin list legal holds error %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to list legal holds")
+	}
+	resp := &external.GetAdminLegalHoldsResponse{LegalHolds: make([]external.AdminLegalHold, 0, len(holds))}
+	for _, hold := range holds {
+		resp.LegalHolds = append(resp.LegalHolds, external.AdminLegalHold{
+			Target:    hold.Target,
+			Reason:    hold.Reason,
+			CreatedBy: hold.CreatedBy,
+			CreatedTs: hold.CreatedTs,
+		})
+	}
+	return http.StatusOK, resp
+}
+
+// PutAdminLegalHold implements PUT /_ligase/admin/v1/legal_holds/{target}
+// The target is a room or a user, a user hold covers what they sent in any
+// room. The hold only protects what happens after it is placed: events
+// redacted or edited earlier have lost their original already.
+func PutAdminLegalHold(
+	ctx context.Context,
+	req *external.PutAdminLegalHoldRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	syncDB model.SyncAPIDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if !strings.HasPrefix(req.Target, "!") && !strings.HasPrefix(req.Target, "@") {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("target must be a room or a user ID")
+	}
+	hold := &syncapitypes.LegalHold{
+		Target:    req.Target,
+		Reason:    req.Reason,
+		CreatedBy: userID,
+		CreatedTs: time.Now().UnixNano() / 1000000,
+	}
+	if err := syncDB.InsertLegalHold(ctx, hold); err != nil {
+		log.Errorf("admin put legal hold %s error %v", req.Target, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to put legal hold")
+	}
+	log.Infof("admin %s put legal hold on %s reason %s", userID, req.Target, req.Reason)
+	auditAdmin(ctx, userID, "put_legal_hold", req.Target, "", map[string]string{"reason": req.Reason})
+	return http.StatusOK, nil
+}
+
+// DelAdminLegalHold implements DELETE /_ligase/admin/v1/legal_holds/{target}
+func DelAdminLegalHold(
+	ctx context.Context,
+	req *external.DelAdminLegalHoldRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	syncDB model.SyncAPIDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	found, err := syncDB.DeleteLegalHold(ctx, req.Target)
+	if err != nil {
+		log.Errorf("admin delete legal hold %s error %v", req.Target, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to delete legal hold")
+	}
+	if !found {
+		return http.StatusNotFound, jsonerror.NotFound("No legal hold on " + req.Target)
+	}
+	log.Infof("admin %s released legal hold on %s", userID, req.Target)
+	auditAdmin(ctx, userID, "delete_legal_hold", req.Target, "", nil)
+	return http.StatusOK, nil
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+// AdminConfigReload implements POST /_ligase/admin/v1/config/reload. The
+// config file of this server is reloaded first, so a config failing the
+// checks is reported and kept away from the other servers, which reload
+// their own file once it passed.
+func AdminConfigReload(
+	ctx context.Context,
+	userID string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	cur, changed, err := config.Reload()
+	if err != nil {
+		log.Warnf("admin %s reload config error %v", userID, err)
+		return http.StatusBadRequest, jsonerror.InvalidParam("config reload failed: " + err.Error())
+	}
+	if err = common.BroadcastConfigReload(ctx, cur.Digest); err != nil {
+		log.Errorf("admin %s broadcast config reload error %v", userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to broadcast the config reload")
+	}
+	log.Infof("admin %s reloaded config, digest %s changed %t", userID, cur.Digest, changed)
+	auditAdmin(ctx, userID, "reload_config", "", "", map[string]string{"digest": cur.Digest, "changed": strconv.FormatBool(changed)})
+	return http.StatusOK, &external.PostAdminConfigReloadResponse{Digest: cur.Digest, Changed: changed}
+}
@@ -0,0 +1,197 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+const (
+	registrationTokenChars         = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789._~-"
+	registrationTokenDefaultLength = 16
+	registrationTokenMaxLength     = 64
+)
+
+var registrationTokenRegex = regexp.MustCompile(`^[A-Za-z0-9._~-]{1,64}$`)
+
+// GetRegistrationTokenValidity implements
+// GET /register/m.login.registration_token/validity
+func GetRegistrationTokenValidity(
+	ctx context.Context,
+	req *external.GetRegistrationTokenValidityRequest,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !cfg.Matrix.RegistrationRequiresToken {
+		return http.StatusForbidden, jsonerror.Forbidden("Registration tokens are not enabled")
+	}
+	if req.Token == "" {
+		return http.StatusBadRequest, jsonerror.MissingParam("token is missing")
+	}
+	token, err := accountDB.GetRegistrationToken(ctx, req.Token)
+	if err != nil {
+		log.Errorf("get registration token error %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to check registration token")
+	}
+	valid := token != nil && token.Valid(time.Now().UnixNano()/1000000)
+	return http.StatusOK, &external.GetRegistrationTokenValidityResponse{Valid: valid}
+}
+
+// GetAdminRegistrationTokens implements GET /_ligase/admin/v1/registration_tokens
+func GetAdminRegistrationTokens(
+	ctx context.Context,
+	userID string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	tokens, err := accountDB.GetRegistrationTokens(ctx)
+	if err != nil {
+		log.Errorf("admin list registration tokens error %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to list registration tokens")
+	}
+	resp := &external.GetAdminRegistrationTokensResponse{
+		RegistrationTokens: make([]external.AdminRegistrationToken, 0, len(tokens)),
+	}
+	for _, token := range tokens {
+		resp.RegistrationTokens = append(resp.RegistrationTokens, toAdminRegistrationToken(&token))
+	}
+	return http.StatusOK, resp
+}
+
+// PostAdminRegistrationToken implements POST /_ligase/admin/v1/registration_tokens/new
+func PostAdminRegistrationToken(
+	ctx context.Context,
+	req *external.PostAdminRegistrationTokenRequest,
+	userID string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	token := &authtypes.RegistrationToken{Token: req.Token}
+	if req.UsesAllowed != nil {
+		// 0 is stored as unlimited, a token nobody can use is pointless
+		if *req.UsesAllowed < 1 {
+			return http.StatusBadRequest, jsonerror.InvalidParam("uses_allowed must be a positive integer or null")
+		}
+		token.UsesAllowed = *req.UsesAllowed
+	}
+	if req.ExpiryTime != nil {
+		if *req.ExpiryTime <= time.Now().UnixNano()/1000000 {
+			return http.StatusBadRequest, jsonerror.InvalidParam("expiry_time must not be in the past")
+		}
+		token.ExpiryTs = *req.ExpiryTime
+	}
+	if token.Token == "" {
+		length := req.Length
+		if length == 0 {
+			length = registrationTokenDefaultLength
+		}
+		if length < 0 || length > registrationTokenMaxLength {
+			return http.StatusBadRequest, jsonerror.InvalidParam("length must be between 1 and 64")
+		}
+		generated, err := newRegistrationToken(length)
+		if err != nil {
+			log.Errorf("generate registration token error %v", err)
+			return http.StatusInternalServerError, jsonerror.Unknown("failed to generate registration token")
+		}
+		token.Token = generated
+	} else if !registrationTokenRegex.MatchString(token.Token) {
+		return http.StatusBadRequest, jsonerror.InvalidParam("token must be 1 to 64 characters of [A-Za-z0-9._~-]")
+	}
+
+	inserted, err := accountDB.InsertRegistrationToken(ctx, token)
+	if err != nil {
+		log.Errorf("admin create registration token error %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to create registration token")
+	}
+	if !inserted {
+		return http.StatusBadRequest, jsonerror.InvalidParam("Token already exists")
+	}
+	log.Infof("admin %s created registration token uses_allowed %d expiry %d", userID, token.UsesAllowed, token.ExpiryTs)
+	auditAdmin(ctx, userID, "create_registration_token", "", "", nil)
+	resp := toAdminRegistrationToken(token)
+	return http.StatusOK, &resp
+}
+
+// DelAdminRegistrationToken implements DELETE /_ligase/admin/v1/registration_tokens/{token}
+func DelAdminRegistrationToken(
+	ctx context.Context,
+	req *external.DelAdminRegistrationTokenRequest,
+	userID string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	found, err := accountDB.DeleteRegistrationToken(ctx, req.Token)
+	if err != nil {
+		log.Errorf("admin delete registration token error %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to delete registration token")
+	}
+	if !found {
+		return http.StatusNotFound, jsonerror.NotFound("No such registration token")
+	}
+	log.Infof("admin %s deleted a registration token", userID)
+	auditAdmin(ctx, userID, "delete_registration_token", "", "", nil)
+	return http.StatusOK, nil
+}
+
+func toAdminRegistrationToken(token *authtypes.RegistrationToken) external.AdminRegistrationToken {
+	resp := external.AdminRegistrationToken{
+		Token:     token.Token,
+		Completed: token.Completed,
+	}
+	if token.UsesAllowed != 0 {
+		uses := token.UsesAllowed
+		resp.UsesAllowed = &uses
+	}
+	if token.ExpiryTs != 0 {
+		expiry := token.ExpiryTs
+		resp.ExpiryTime = &expiry
+	}
+	return resp
+}
+
+func newRegistrationToken(length int) (string, error) {
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(registrationTokenChars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = registrationTokenChars[n.Int64()]
+	}
+	return string(b), nil
+}
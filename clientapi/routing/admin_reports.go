@@ -0,0 +1,161 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/roomservertypes"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+// GetAdminEventReports implements GET /_ligase/admin/v1/event_reports
+func GetAdminEventReports(
+	ctx context.Context,
+	req *external.GetAdminEventReportsRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = adminUsersDefaultLimit
+	} else if limit > adminUsersMaxLimit {
+		limit = adminUsersMaxLimit
+	}
+	if req.From < 0 {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("from must not be negative")
+	}
+	filter := &roomservertypes.EventReportFilter{RoomID: req.RoomID, UserID: req.UserID}
+	switch req.Resolved {
+	case "":
+	case "true", "false":
+		resolved := req.Resolved == "true"
+		filter.Resolved = &resolved
+	default:
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("resolved must be true or false")
+	}
+
+	reports, total, err := roomDB.GetEventReports(ctx, filter, limit, req.From)
+	if err != nil {
+		log.Errorf("admin list event reports error %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to list event reports")
+	}
+	resp := &external.GetAdminEventReportsResponse{
+		EventReports: make([]external.EventReportInfo, 0, len(reports)),
+		Total:        total,
+	}
+	for _, report := range reports {
+		resp.EventReports = append(resp.EventReports, eventReportInfo(report, false))
+	}
+	if next := req.From + len(reports); next < total {
+		resp.NextToken = strconv.Itoa(next)
+	}
+	return http.StatusOK, resp
+}
+
+// GetAdminEventReport implements GET /_ligase/admin/v1/event_reports/{reportID}
+func GetAdminEventReport(
+	ctx context.Context,
+	req *external.AdminEventReportRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	report, err := roomDB.GetEventReport(ctx, req.ReportID)
+	if err != nil {
+		log.Errorf("admin get event report %d error %v", req.ReportID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to get event report")
+	}
+	if report == nil {
+		return http.StatusNotFound, jsonerror.NotFound("Event report not found")
+	}
+	info := eventReportInfo(report, true)
+	return http.StatusOK, &info
+}
+
+// AdminEventReportResolve implements POST /_ligase/admin/v1/event_reports/{reportID}/resolve
+func AdminEventReportResolve(
+	ctx context.Context,
+	req *external.PostAdminEventReportResolveRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	// reopening a report clears who resolved it
+	resolved, resolvedBy, ts := true, userID, time.Now().UnixNano()/1000000
+	if req.Resolved != nil && !*req.Resolved {
+		resolved, resolvedBy, ts = false, "", 0
+	}
+	found, err := roomDB.ResolveEventReport(ctx, req.ReportID, resolved, resolvedBy, ts)
+	if err != nil {
+		log.Errorf("admin resolve event report %d error %v", req.ReportID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to resolve event report")
+	}
+	if !found {
+		return http.StatusNotFound, jsonerror.NotFound("Event report not found")
+	}
+	log.Infof("admin %s set event report %d resolved %t", userID, req.ReportID, resolved)
+	auditAdmin(ctx, userID, "resolve_event_report", "", "", map[string]string{
+		"report_id": strconv.FormatInt(req.ReportID, 10), "resolved": strconv.FormatBool(resolved),
+	})
+	return http.StatusOK, nil
+}
+
+// PutAdminEventReportNote implements PUT /_ligase/admin/v1/event_reports/{reportID}/note
+func PutAdminEventReportNote(
+	ctx context.Context,
+	req *external.PutAdminEventReportNoteRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if len(req.Note) > reportMaxReasonLen {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("note is too long")
+	}
+	found, err := roomDB.SetEventReportNote(ctx, req.ReportID, req.Note)
+	if err != nil {
+		log.Errorf("admin set event report %d note error %v", req.ReportID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to set event report note")
+	}
+	if !found {
+		return http.StatusNotFound, jsonerror.NotFound("Event report not found")
+	}
+	return http.StatusOK, nil
+}
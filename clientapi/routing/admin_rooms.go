@@ -0,0 +1,423 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/common/purge"
+	"github.com/finogeeks/ligase/common/uid"
+	"github.com/finogeeks/ligase/core"
+	fed "github.com/finogeeks/ligase/federation/fedreq"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/model/service/roomserverapi"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+const (
+	purgeStatusActive   = "active"
+	purgeStatusComplete = "complete"
+	purgeStatusFailed   = "failed"
+
+	// how long the status of a finished purge can be queried, in seconds
+	purgeStatusExpire = 24 * 3600
+	// a running purge refreshes its status this often, a purge whose status
+	// was not refreshed for purgeStaleAfter died with its server
+	purgeHeartbeat  = 30 * time.Second
+	purgeStaleAfter = 3 * purgeHeartbeat
+)
+
+func isLocalUser(cfg *config.Dendrite, userID string) bool {
+	domain, err := common.DomainFromID(userID)
+	if err != nil {
+		return false
+	}
+	return common.IsLocalDomain(domain)
+}
+
+// roomBlockedError returns the error to reply to a join or invite into a
+// blocked room, nil if the room is not blocked. A cache failure lets the
+// request through, the roomserver checks again.
+func roomBlockedError(cache service.Cache, roomID string) *jsonerror.MatrixError {
+	blockedBy, err := cache.GetRoomBlocked(roomID)
+	if err != nil {
+		log.Errorf("get room %s blocked error %v", roomID, err)
+		return nil
+	}
+	if blockedBy == "" {
+		return nil
+	}
+	return jsonerror.Forbidden("This room has been blocked on this server")
+}
+
+// AdminRoomShutdown implements POST /_ligase/admin/v1/rooms/{roomID}/shutdown
+func AdminRoomShutdown(
+	ctx context.Context,
+	req *external.PostAdminRoomShutdownRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+	rpcCli roomserverapi.RoomserverRPCAPI,
+	federation *fed.Federation,
+	cache service.Cache,
+	idg *uid.UidGenerator,
+	complexCache *common.ComplexCache,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	roomID := req.RoomID
+	if req.NewRoomUserID != "" && !isLocalUser(&cfg, req.NewRoomUserID) {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("new_room_user_id must be a local user")
+	}
+
+	queryReq := roomserverapi.QueryRoomStateRequest{RoomID: roomID}
+	var queryRes roomserverapi.QueryRoomStateResponse
+	if err := rpcCli.QueryRoomState(ctx, &queryReq, &queryRes); err != nil {
+		log.Errorf("admin shutdown room %s query state error %v", roomID, err)
+		return http.StatusNotFound, jsonerror.NotFound("Unknown room")
+	}
+
+	// block first so nobody rejoins while the members are kicked
+	if req.Block == nil || *req.Block {
+		if err := blockRoom(ctx, roomDB, cache, roomID, userID); err != nil {
+			log.Errorf("admin shutdown room %s block error %v", roomID, err)
+			return http.StatusInternalServerError, jsonerror.Unknown("failed to block room")
+		}
+	}
+
+	resp := &external.PostAdminRoomShutdownResponse{
+		KickedUsers:       []string{},
+		FailedToKickUsers: []string{},
+		LocalAliases:      []string{},
+	}
+	members := []string{}
+	for member := range queryRes.Join {
+		members = append(members, member)
+	}
+	for member := range queryRes.Invite {
+		members = append(members, member)
+	}
+	for _, member := range members {
+		if !isLocalUser(&cfg, member) {
+			continue
+		}
+		leave := &external.PostRoomsMembershipRequest{RoomID: roomID, Membership: "leave"}
+		code, _ := SendMembership(
+			ctx, leave, accountDB, member, "", roomID, "leave",
+			cfg, rpcCli, federation, cache, idg, complexCache,
+		)
+		if code != http.StatusOK {
+			log.Warnf("admin shutdown room %s kick %s code %d", roomID, member, code)
+			resp.FailedToKickUsers = append(resp.FailedToKickUsers, member)
+			continue
+		}
+		resp.KickedUsers = append(resp.KickedUsers, member)
+	}
+
+	aliases, err := roomDB.GetAliasesFromRoomID(ctx, roomID)
+	if err != nil {
+		log.Errorf("admin shutdown room %s get aliases error %v", roomID, err)
+	}
+	for _, alias := range aliases {
+		if err := cache.DelAlias(alias); err != nil {
+			log.Errorf("admin shutdown room %s del alias %s cache error %v", roomID, alias, err)
+		}
+		if err := roomDB.RemoveRoomAlias(ctx, alias); err != nil {
+			log.Errorf("admin shutdown room %s remove alias %s error %v", roomID, alias, err)
+			continue
+		}
+		resp.LocalAliases = append(resp.LocalAliases, alias)
+	}
+
+	if req.NewRoomUserID != "" {
+		roomName := req.RoomName
+		if roomName == "" {
+			roomName = "Content Violation Notification"
+		}
+		create := &external.PostCreateRoomRequest{
+			Name:     roomName,
+			Preset:   "private_chat",
+			Invite:   resp.KickedUsers,
+			AutoJoin: true,
+		}
+		code, res := CreateRoom(ctx, create, req.NewRoomUserID, cfg, accountDB, rpcCli, cache, idg, complexCache)
+		if code != http.StatusOK {
+			log.Errorf("admin shutdown room %s create notice room code %d", roomID, code)
+			return code, res
+		}
+		resp.NewRoomID = res.(*external.PostCreateRoomResponse).RoomID
+
+		message := req.Message
+		if message == "" {
+			message = "Sharing illegal content on this server is not permitted and rooms in violation will be blocked."
+		}
+		content, _ := json.Marshal(map[string]string{"msgtype": "m.text", "body": message})
+		post := &external.PutRoomStateByTypeWithTxnID{Content: content}
+		code, _ = PostEvent(
+			ctx, post, req.NewRoomUserID, "", "", resp.NewRoomID, "m.room.message",
+			nil, nil, cfg, rpcCli, cache, idg,
+		)
+		if code != http.StatusOK {
+			log.Errorf("admin shutdown room %s post notice message code %d", roomID, code)
+		}
+	}
+
+	log.Infof("admin %s shutdown room %s kicked %d failed %d", userID, roomID, len(resp.KickedUsers), len(resp.FailedToKickUsers))
+	auditAdmin(ctx, userID, "shutdown_room", "", roomID, map[string]string{"kicked": strconv.Itoa(len(resp.KickedUsers))})
+	return http.StatusOK, resp
+}
+
+// AdminRoomPurgeHistory implements POST /_ligase/admin/v1/rooms/{roomID}/purge_history
+// The purge runs in the background, its progress is read back with the
+// returned purge_id.
+func AdminRoomPurgeHistory(
+	ctx context.Context,
+	req *external.PostAdminRoomPurgeHistoryRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+	syncDB model.SyncAPIDatabase,
+	cache service.Cache,
+	rpcClient *common.RpcClient,
+	idg *uid.UidGenerator,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	roomID := req.RoomID
+	ts := req.PurgeUpToTs
+	if req.PurgeUpToEvent != "" {
+		eventTs, err := syncDB.SelectRoomEventTs(ctx, roomID, req.PurgeUpToEvent)
+		if err != nil {
+			return http.StatusNotFound, jsonerror.NotFound("Unknown purge_up_to_event_id")
+		}
+		ts = eventTs
+	}
+	if ts <= 0 {
+		return http.StatusBadRequest, jsonerror.MissingParam("purge_up_to_ts or purge_up_to_event_id must be supplied")
+	}
+	if held, err := syncDB.GetLegalHoldTargets(ctx, []string{roomID}); err != nil {
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to check legal hold")
+	} else if held[roomID] {
+		return http.StatusForbidden, jsonerror.Forbidden(purge.ErrRoomLegalHold.Error())
+	}
+
+	nid, err := idg.Next()
+	if err != nil {
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to create purge id")
+	}
+	purgeID := fmt.Sprintf("%d", nid)
+	status := &external.GetAdminRoomPurgeStatusResponse{RoomID: roomID, Status: purgeStatusActive}
+	if err := setPurgeStatus(cache, purgeID, status); err != nil {
+		log.Errorf("admin purge room %s set status error %v", roomID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to start purge")
+	}
+
+	log.Infof("admin %s purge room %s history up to %d purge_id %s", userID, roomID, ts, purgeID)
+	auditAdmin(ctx, userID, "purge_history", "", roomID, map[string]string{"purge_up_to_ts": strconv.FormatInt(ts, 10)})
+	go purgeRoomHistory(roomDB, syncDB, cache, rpcClient, purgeID, roomID, ts, status)
+	return http.StatusOK, &external.PostAdminRoomPurgeHistoryResponse{PurgeID: purgeID}
+}
+
+// purgeRoomHistory deletes the timeline events of the room older than ts.
+// State events are kept, the room can't be rebuilt without them, and so is
+// the latest event, clients sync from it.
+func purgeRoomHistory(
+	roomDB model.RoomServerDatabase,
+	syncDB model.SyncAPIDatabase,
+	cache service.Cache,
+	rpcClient *common.RpcClient,
+	purgeID, roomID string,
+	ts int64,
+	status *external.GetAdminRoomPurgeStatusResponse,
+) {
+	ctx := context.Background()
+	// the batches and the heartbeat both write the status
+	var mu sync.Mutex
+	update := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+		if err := setPurgeStatus(cache, purgeID, status); err != nil {
+			log.Errorf("admin purge room %s set status error %v", roomID, err)
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(purgeHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				update(func() {})
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	_, err := purge.RoomEventsBefore(ctx, roomDB, syncDB, cache, rpcClient, roomID, ts, func(deleted int64) {
+		update(func() { status.DeletedEvents = deleted })
+	})
+	if err != nil {
+		log.Errorf("admin purge room %s purge_id %s error %v", roomID, purgeID, err)
+		update(func() {
+			status.Status = purgeStatusFailed
+			status.Error = err.Error()
+		})
+		return
+	}
+
+	update(func() { status.Status = purgeStatusComplete })
+	log.Infof("admin purge room %s purge_id %s complete deleted %d", roomID, purgeID, status.DeletedEvents)
+}
+
+func setPurgeStatus(cache service.Cache, purgeID string, status *external.GetAdminRoomPurgeStatusResponse) error {
+	status.UpdatedTs = time.Now().UnixNano() / 1000000
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	// a []byte would be stored json encoded
+	return cache.SetPurgeHistoryStatus(purgeID, string(bytes), purgeStatusExpire)
+}
+
+// purgeStale tells if the server running an active purge stopped refreshing
+// its status
+func purgeStale(status *external.GetAdminRoomPurgeStatusResponse, now time.Time) bool {
+	return now.Sub(time.Unix(0, status.UpdatedTs*int64(time.Millisecond))) > purgeStaleAfter
+}
+
+// GetAdminRoomPurgeStatus implements GET /_ligase/admin/v1/rooms/{roomID}/purge_history/{purgeID}
+func GetAdminRoomPurgeStatus(
+	ctx context.Context,
+	req *external.GetAdminRoomPurgeStatusRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	bytes, err := cache.GetPurgeHistoryStatus(req.PurgeID)
+	if err != nil {
+		log.Errorf("admin get purge %s status error %v", req.PurgeID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to get purge status")
+	}
+	var status external.GetAdminRoomPurgeStatusResponse
+	if bytes == nil || json.Unmarshal(bytes, &status) != nil || status.RoomID != req.RoomID {
+		return http.StatusNotFound, jsonerror.NotFound("Unknown purge_id")
+	}
+	if status.Status == purgeStatusActive && purgeStale(&status, time.Now()) {
+		// the server running the purge went down, the events deleted so far
+		// stay deleted and a new purge finishes the job
+		status.Status = purgeStatusFailed
+		status.Error = "the purge was interrupted"
+		if err := setPurgeStatus(cache, req.PurgeID, &status); err != nil {
+			log.Errorf("admin purge %s set status error %v", req.PurgeID, err)
+		}
+	}
+	return http.StatusOK, &status
+}
+
+func blockRoom(ctx context.Context, roomDB model.RoomServerDatabase, cache service.Cache, roomID, userID string) error {
+	if err := roomDB.BlockRoom(ctx, roomID, userID, time.Now().UnixNano()/1000000); err != nil {
+		return err
+	}
+	return cache.SetRoomBlocked(roomID, userID)
+}
+
+// AdminRoomBlock implements POST /_ligase/admin/v1/rooms/{roomID}/block
+func AdminRoomBlock(
+	ctx context.Context,
+	req *external.AdminRoomBlockRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if err := blockRoom(ctx, roomDB, cache, req.RoomID, userID); err != nil {
+		log.Errorf("admin %s block room %s error %v", userID, req.RoomID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to block room")
+	}
+	log.Infof("admin %s block room %s", userID, req.RoomID)
+	auditAdmin(ctx, userID, "block_room", "", req.RoomID, nil)
+	return http.StatusOK, &external.AdminRoomBlockResponse{Block: true, User: userID}
+}
+
+// AdminRoomUnblock implements POST /_ligase/admin/v1/rooms/{roomID}/unblock
+func AdminRoomUnblock(
+	ctx context.Context,
+	req *external.AdminRoomBlockRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	roomDB model.RoomServerDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if err := roomDB.UnblockRoom(ctx, req.RoomID); err != nil {
+		log.Errorf("admin %s unblock room %s error %v", userID, req.RoomID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to unblock room")
+	}
+	if err := cache.DelRoomBlocked(req.RoomID); err != nil {
+		log.Errorf("admin %s unblock room %s cache error %v", userID, req.RoomID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to unblock room")
+	}
+	log.Infof("admin %s unblock room %s", userID, req.RoomID)
+	auditAdmin(ctx, userID, "unblock_room", "", req.RoomID, nil)
+	return http.StatusOK, &external.AdminRoomBlockResponse{Block: false}
+}
+
+// GetAdminRoomBlock implements GET /_ligase/admin/v1/rooms/{roomID}/block
+func GetAdminRoomBlock(
+	ctx context.Context,
+	req *external.AdminRoomBlockRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	blockedBy, err := cache.GetRoomBlocked(req.RoomID)
+	if err != nil {
+		log.Errorf("admin get room %s block error %v", req.RoomID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to get room block")
+	}
+	return http.StatusOK, &external.AdminRoomBlockResponse{Block: blockedBy != "", User: blockedBy}
+}
@@ -0,0 +1,65 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/finogeeks/ligase/cache"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/plugins/message/external"
+)
+
+func TestPurgeStatusStale(t *testing.T) {
+	rc := &cache.RedisCache{}
+	if err := rc.Prepare(config.RedisConf{Mode: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	accounts := &fakeAccounts{admins: map[string]bool{"@admin:test": true}}
+
+	running := &external.GetAdminRoomPurgeStatusResponse{RoomID: "!purge:test", Status: purgeStatusActive}
+	if err := setPurgeStatus(rc, "purge-running", running); err != nil {
+		t.Fatal(err)
+	}
+	req := &external.GetAdminRoomPurgeStatusRequest{RoomID: "!purge:test", PurgeID: "purge-running"}
+	code, resp := GetAdminRoomPurgeStatus(ctx, req, "@admin:test", config.Dendrite{}, accounts, rc)
+	if code != http.StatusOK || resp.(*external.GetAdminRoomPurgeStatusResponse).Status != purgeStatusActive {
+		t.Fatalf("a refreshed purge must stay active, got %d %+v", code, resp)
+	}
+
+	// the server running this one went down without a last update
+	dead := &external.GetAdminRoomPurgeStatusResponse{RoomID: "!purge:test", Status: purgeStatusActive, DeletedEvents: 7}
+	dead.UpdatedTs = time.Now().Add(-2*purgeStaleAfter).UnixNano() / 1000000
+	bytes, _ := json.Marshal(dead)
+	if err := rc.SetPurgeHistoryStatus("purge-dead", string(bytes), purgeStatusExpire); err != nil {
+		t.Fatal(err)
+	}
+	req.PurgeID = "purge-dead"
+	_, resp = GetAdminRoomPurgeStatus(ctx, req, "@admin:test", config.Dendrite{}, accounts, rc)
+	status := resp.(*external.GetAdminRoomPurgeStatusResponse)
+	if status.Status != purgeStatusFailed || status.Error == "" || status.DeletedEvents != 7 {
+		t.Fatalf("a stale purge must be reported failed, got %+v", status)
+	}
+	// and stays failed
+	stored, _ := rc.GetPurgeHistoryStatus("purge-dead")
+	var again external.GetAdminRoomPurgeStatusResponse
+	if err := json.Unmarshal(stored, &again); err != nil || again.Status != purgeStatusFailed {
+		t.Fatalf("the failure was not stored: %s", stored)
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/filter"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+const (
+	adminUsersDefaultLimit = 100
+	adminUsersMaxLimit     = 1000
+)
+
+// isServerAdmin tells if userID may call the /_ligase/admin api, either
+// through the admin flag of the account or because it is listed in the
+// admin_users config, which bootstraps the first admins.
+func isServerAdmin(ctx context.Context, cfg *config.Dendrite, accountDB model.AccountsDatabase, userID string) bool {
+	for _, admin := range cfg.Authorization.AdminUsers {
+		if admin == userID {
+			return true
+		}
+	}
+	account, err := accountDB.GetAccount(ctx, userID)
+	if err != nil {
+		log.Errorf("check server admin %s error %v", userID, err)
+		return false
+	}
+	return account.IsAdmin
+}
+
+// getLocalAccount returns the account targeted by an admin request, with the
+// error to reply if there is none
+func getLocalAccount(
+	ctx context.Context, cfg *config.Dendrite, accountDB model.AccountsDatabase, userID string,
+) (*authtypes.Account, int, core.Coder) {
+	if !isLocalUser(cfg, userID) {
+		return nil, http.StatusBadRequest, jsonerror.InvalidArgumentValue("Can only manage local users")
+	}
+	account, err := accountDB.GetAccount(ctx, userID)
+	if err != nil {
+		log.Errorf("admin get account %s error %v", userID, err)
+		return nil, http.StatusInternalServerError, jsonerror.Unknown("failed to get account")
+	}
+	if account.UserID == "" {
+		return nil, http.StatusNotFound, jsonerror.NotFound("Unknown user")
+	}
+	return account, http.StatusOK, nil
+}
+
+func adminUserInfo(account *authtypes.Account) external.AdminUserInfo {
+	info := external.AdminUserInfo{
+		UserID:       account.UserID,
+		CreationTs:   account.CreatedTs,
+		AppServiceID: account.AppServiceID,
+		Admin:        account.IsAdmin,
+		Locked:       account.Locked,
+		ShadowBanned: account.ShadowBanned,
+	}
+	if account.Profile != nil {
+		info.DisplayName = account.Profile.DisplayName
+		info.AvatarURL = account.Profile.AvatarURL
+	}
+	return info
+}
+
+// GetAdminUsers implements GET /_ligase/admin/v1/users
+func GetAdminUsers(
+	ctx context.Context,
+	req *external.GetAdminUsersRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = adminUsersDefaultLimit
+	} else if limit > adminUsersMaxLimit {
+		limit = adminUsersMaxLimit
+	}
+	if req.From < 0 {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("from must not be negative")
+	}
+
+	accounts, total, err := accountDB.GetAccounts(ctx, req.Search, limit, req.From)
+	if err != nil {
+		log.Errorf("admin list users search %s error %v", req.Search, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to list users")
+	}
+	resp := &external.GetAdminUsersResponse{
+		Users: make([]external.AdminUserInfo, 0, len(accounts)),
+		Total: total,
+	}
+	for i := range accounts {
+		resp.Users = append(resp.Users, adminUserInfo(&accounts[i]))
+	}
+	if next := req.From + len(accounts); next < total {
+		resp.NextToken = strconv.Itoa(next)
+	}
+	return http.StatusOK, resp
+}
+
+// GetAdminUser implements GET /_ligase/admin/v1/users/{userID}
+func GetAdminUser(
+	ctx context.Context,
+	req *external.AdminUserRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	account, code, errResp := getLocalAccount(ctx, &cfg, accountDB, req.UserID)
+	if account == nil {
+		return code, errResp
+	}
+	profile, err := accountDB.GetProfileByUserID(ctx, req.UserID)
+	if err == nil {
+		account.Profile = &profile
+	}
+	info := adminUserInfo(account)
+	return http.StatusOK, &info
+}
+
+// AdminUserResetPassword implements POST /_ligase/admin/v1/users/{userID}/reset_password
+func AdminUserResetPassword(
+	ctx context.Context,
+	req *external.PostAdminUserResetPasswordRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	deviceDB model.DeviceDatabase,
+	cache service.Cache,
+	encryptDB model.EncryptorAPIDatabase,
+	syncDB model.SyncAPIDatabase,
+	tokenFilter *filter.Filter,
+	rpcClient *common.RpcClient,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if req.NewPassword == "" {
+		return http.StatusBadRequest, jsonerror.MissingParam("new_password must be supplied")
+	}
+	if code, errResp := validatePassword(req.NewPassword); errResp != nil {
+		return code, errResp
+	}
+	if account, code, errResp := getLocalAccount(ctx, &cfg, accountDB, req.UserID); account == nil {
+		return code, errResp
+	}
+
+	if err := accountDB.SetPassword(ctx, req.UserID, req.NewPassword); err != nil {
+		log.Errorf("admin %s reset password of %s error %v", userID, req.UserID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to reset password")
+	}
+	if req.LogoutDevices == nil || *req.LogoutDevices {
+		logoutAll(ctx, deviceDB, req.UserID, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+	}
+	log.Infof("admin %s reset password of %s", userID, req.UserID)
+	audit.Emit(ctx, &authtypes.AuditEvent{
+		Type:    authtypes.AuditPasswordChange,
+		UserID:  userID,
+		Target:  req.UserID,
+		Success: true,
+		Details: map[string]string{"action": "reset_password"},
+	})
+	return http.StatusOK, nil
+}
+
+// AdminUserLock implements POST /_ligase/admin/v1/users/{userID}/lock
+// The devices of the user are logged out, and it can't log in again until
+// it is unlocked.
+func AdminUserLock(
+	ctx context.Context,
+	req *external.AdminUserRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	deviceDB model.DeviceDatabase,
+	cache service.Cache,
+	encryptDB model.EncryptorAPIDatabase,
+	syncDB model.SyncAPIDatabase,
+	tokenFilter *filter.Filter,
+	rpcClient *common.RpcClient,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if account, code, errResp := getLocalAccount(ctx, &cfg, accountDB, req.UserID); account == nil {
+		return code, errResp
+	}
+
+	if err := accountDB.SetAccountLocked(ctx, req.UserID, true); err != nil {
+		log.Errorf("admin %s lock %s error %v", userID, req.UserID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to lock user")
+	}
+	logoutAll(ctx, deviceDB, req.UserID, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+	log.Infof("admin %s lock %s", userID, req.UserID)
+	auditAdmin(ctx, userID, "lock_user", req.UserID, "", nil)
+	return http.StatusOK, nil
+}
+
+// AdminUserUnlock implements POST /_ligase/admin/v1/users/{userID}/unlock
+func AdminUserUnlock(
+	ctx context.Context,
+	req *external.AdminUserRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if account, code, errResp := getLocalAccount(ctx, &cfg, accountDB, req.UserID); account == nil {
+		return code, errResp
+	}
+
+	if err := accountDB.SetAccountLocked(ctx, req.UserID, false); err != nil {
+		log.Errorf("admin %s unlock %s error %v", userID, req.UserID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to unlock user")
+	}
+	log.Infof("admin %s unlock %s", userID, req.UserID)
+	auditAdmin(ctx, userID, "unlock_user", req.UserID, "", nil)
+	return http.StatusOK, nil
+}
+
+// AdminUserLogout implements POST /_ligase/admin/v1/users/{userID}/logout
+func AdminUserLogout(
+	ctx context.Context,
+	req *external.AdminUserRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	deviceDB model.DeviceDatabase,
+	cache service.Cache,
+	encryptDB model.EncryptorAPIDatabase,
+	syncDB model.SyncAPIDatabase,
+	tokenFilter *filter.Filter,
+	rpcClient *common.RpcClient,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if account, code, errResp := getLocalAccount(ctx, &cfg, accountDB, req.UserID); account == nil {
+		return code, errResp
+	}
+
+	log.Infof("admin %s logout all devices of %s", userID, req.UserID)
+	logoutAll(ctx, deviceDB, req.UserID, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+	auditAdmin(ctx, userID, "logout_user", req.UserID, "", nil)
+	return http.StatusOK, nil
+}
+
+// PutAdminUserAdmin implements PUT /_ligase/admin/v1/users/{userID}/admin
+func PutAdminUserAdmin(
+	ctx context.Context,
+	req *external.PutAdminUserAdminRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if account, code, errResp := getLocalAccount(ctx, &cfg, accountDB, req.UserID); account == nil {
+		return code, errResp
+	}
+
+	if err := accountDB.SetAccountAdmin(ctx, req.UserID, req.Admin); err != nil {
+		log.Errorf("admin %s set admin %t of %s error %v", userID, req.Admin, req.UserID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to update user")
+	}
+	log.Infof("admin %s set admin %t of %s", userID, req.Admin, req.UserID)
+	auditAdmin(ctx, userID, "set_admin", req.UserID, "", map[string]string{"admin": strconv.FormatBool(req.Admin)})
+	return http.StatusOK, nil
+}
+
+// PutAdminUserShadowBan implements PUT /_ligase/admin/v1/users/{userID}/shadow_ban
+// The account table is the durable copy, the cache is read on every send.
+func PutAdminUserShadowBan(
+	ctx context.Context,
+	req *external.PutAdminUserShadowBanRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+	if account, code, errResp := getLocalAccount(ctx, &cfg, accountDB, req.UserID); account == nil {
+		return code, errResp
+	}
+
+	if err := accountDB.SetAccountShadowBanned(ctx, req.UserID, req.ShadowBanned); err != nil {
+		log.Errorf("admin %s set shadow ban %t of %s error %v", userID, req.ShadowBanned, req.UserID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to update user")
+	}
+	var err error
+	if req.ShadowBanned {
+		err = cache.SetUserShadowBanned(req.UserID)
+	} else {
+		err = cache.DelUserShadowBanned(req.UserID)
+	}
+	if err != nil {
+		log.Errorf("admin %s set shadow ban %t of %s cache error %v", userID, req.ShadowBanned, req.UserID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to update user")
+	}
+	log.Infof("admin %s set shadow ban %t of %s", userID, req.ShadowBanned, req.UserID)
+	auditAdmin(ctx, userID, "shadow_ban", req.UserID, "", map[string]string{"shadow_banned": strconv.FormatBool(req.ShadowBanned)})
+	return http.StatusOK, nil
+}
+
+// isShadowBanned tells if the events of userID must be dropped. A cache error
+// lets the user through, as does roomBlockedError.
+func isShadowBanned(cache service.Cache, userID string) bool {
+	banned, err := cache.GetUserShadowBanned(userID)
+	if err != nil {
+		log.Errorf("get user %s shadow banned error %v", userID, err)
+		return false
+	}
+	return banned
+}
+
+// GetWhoIs implements GET /admin/whois/{userId}
+// Users may look themselves up, anyone else needs to be a server admin.
+func GetWhoIs(
+	ctx context.Context,
+	req *external.GetWhoIsRequest,
+	userID string,
+	cfg config.Dendrite,
+	accountDB model.AccountsDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if req.UserID != userID && !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
+	}
+
+	lastSeen, err := cache.GetDevicesLastSeen(req.UserID)
+	if err != nil {
+		log.Errorf("whois %s get last seen error %v", req.UserID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to get user connections")
+	}
+	resp := &external.GetWhoIsResponse{
+		UserID:  req.UserID,
+		Devices: make(map[string]external.DeviceInfo),
+	}
+	devs := cache.GetDevicesByUserID(req.UserID)
+	for _, dev := range *devs {
+		connections := []external.ConnectionInfo{}
+		if seen, ok := lastSeen[dev.ID]; ok {
+			connections = append(connections, external.ConnectionInfo{
+				Ip:        seen.IP,
+				LastSeen:  seen.Ts,
+				UserAgent: seen.UserAgent,
+			})
+		}
+		resp.Devices[dev.ID] = external.DeviceInfo{
+			Sessions: []external.SessionInfo{{Connections: connections}},
+		}
+	}
+	return http.StatusOK, resp
+}
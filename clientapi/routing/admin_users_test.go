@@ -0,0 +1,82 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/finogeeks/ligase/cache"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/uid"
+	"github.com/finogeeks/ligase/plugins/message/external"
+)
+
+// shadowBanAccounts keeps the shadow ban flags in memory
+type shadowBanAccounts struct {
+	*fakeAccounts
+	banned map[string]bool
+}
+
+func (f *shadowBanAccounts) SetAccountShadowBanned(ctx context.Context, userID string, banned bool) error {
+	f.banned[userID] = banned
+	return nil
+}
+
+func TestShadowBan(t *testing.T) {
+	rc := &cache.RedisCache{}
+	if err := rc.Prepare(config.RedisConf{Mode: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	cfg := config.Dendrite{}
+	cfg.Matrix.ServerName = []string{"test"}
+	config.SetConfig(&cfg)
+	accounts := &shadowBanAccounts{
+		fakeAccounts: &fakeAccounts{admins: map[string]bool{"@admin:test": true}},
+		banned:       map[string]bool{},
+	}
+
+	req := &external.PutAdminUserShadowBanRequest{UserID: "@shadow:test", ShadowBanned: true}
+	if code, _ := PutAdminUserShadowBan(ctx, req, "@shadow:test", cfg, accounts, rc); code != http.StatusForbidden {
+		t.Fatalf("a user can't shadow ban, got %d", code)
+	}
+	if code, resp := PutAdminUserShadowBan(ctx, req, "@admin:test", cfg, accounts, rc); code != http.StatusOK {
+		t.Fatalf("got %d %v", code, resp)
+	}
+	if !accounts.banned["@shadow:test"] || !isShadowBanned(rc, "@shadow:test") {
+		t.Fatal("the shadow ban was not stored")
+	}
+	if isShadowBanned(rc, "@admin:test") {
+		t.Fatal("the admin must not be shadow banned")
+	}
+
+	// the invite looks sent but never reaches the roomserver, which is nil here
+	idg, _ := uid.NewDefaultIdGenerator(0)
+	invite := &external.PostRoomsMembershipRequest{Content: []byte(`{"user_id":"@alice:test"}`)}
+	code, _ := SendMembership(ctx, invite, accounts, "@shadow:test", "DEVICE", "!room:test", "invite", cfg, nil, nil, rc, idg, nil)
+	if code != http.StatusOK {
+		t.Fatalf("the invite of a shadow banned user must look sent, got %d", code)
+	}
+
+	req.ShadowBanned = false
+	if code, resp := PutAdminUserShadowBan(ctx, req, "@admin:test", cfg, accounts, rc); code != http.StatusOK {
+		t.Fatalf("got %d %v", code, resp)
+	}
+	if accounts.banned["@shadow:test"] || isShadowBanned(rc, "@shadow:test") {
+		t.Fatal("the shadow ban was not lifted")
+	}
+}
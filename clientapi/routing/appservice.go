@@ -0,0 +1,77 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/finogeeks/ligase/appservice/query"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	log "github.com/finogeeks/ligase/skunkworks/log"
+)
+
+// PingAppService implements POST /_matrix/client/v1/appservice/{appserviceId}/ping
+// The caller must be the application service itself, authenticated with its
+// as_token.
+func PingAppService(
+	ctx context.Context,
+	req *external.PostAppServicePingRequest,
+	cfg *config.Dendrite,
+) (int, core.Coder) {
+	if req.AccessToken == "" {
+		return http.StatusUnauthorized, jsonerror.MissingToken("Missing access token")
+	}
+
+	var appService *config.ApplicationService
+	appServices := config.GetReloadable().ApplicationServices
+	for i := range appServices {
+		if appServices[i].ASToken == req.AccessToken {
+			appService = &appServices[i]
+			break
+		}
+	}
+	if appService == nil {
+		return http.StatusUnauthorized, jsonerror.UnknownToken("Supplied access_token does not match any known application service")
+	}
+	if appService.ID != req.AppServiceID {
+		return http.StatusForbidden, jsonerror.Forbidden("Supplied access_token does not belong to this application service")
+	}
+
+	duration, err := query.Ping(ctx, appService, req.TxnID)
+	if err != nil {
+		log.Warnf("ping appservice %s error: %v", appService.ID, err)
+		if err == query.ErrURLNotSet {
+			return http.StatusBadRequest, jsonerror.URLNotSet("Application service has no URL configured")
+		}
+		if e, ok := err.(*query.ErrStatus); ok {
+			return http.StatusBadGateway, jsonerror.BadStatus(fmt.Sprintf("Application service returned status %d", e.Code))
+		}
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return http.StatusGatewayTimeout, jsonerror.ConnectionTimeout("Timed out while pinging application service")
+		}
+		return http.StatusBadGateway, jsonerror.ConnectionFailed("Failed to connect to application service")
+	}
+
+	return http.StatusOK, &external.PostAppServicePingResponse{
+		DurationMS: int64(duration / time.Millisecond),
+	}
+}
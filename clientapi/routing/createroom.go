@@ -310,7 +310,13 @@ func createRoom(ctx context.Context, r *external.PostCreateRoomRequest,
 	log.Debugf("send event set event use %v", now.Sub(last))
 	last = now
 
-	for _, invitor := range r.Invite {
+	invites := r.Invite
+	if len(invites) > 0 && isShadowBanned(cache, userID) {
+		// the room is created, the invites are silently dropped
+		log.Infof("createRoom drop invites of shadow banned user %s room %s", userID, roomID)
+		invites = nil
+	}
+	for _, invitor := range invites {
 
 		displayName, avatarURL, _ := complexCache.GetProfileByUserID(ctx, invitor)
 
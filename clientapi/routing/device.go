@@ -25,6 +25,7 @@ import (
 
 	"github.com/finogeeks/ligase/clientapi/httputil"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/filter"
 	"github.com/finogeeks/ligase/common/jsonerror"
@@ -110,6 +111,7 @@ func UpdateDeviceByID(
 func DeleteDeviceByID(
 	ctx context.Context,
 	delReq *external.DelDeviceRequest,
+	device *authtypes.Device,
 	deviceID string,
 	cfg config.Dendrite,
 	cache service.Cache,
@@ -129,16 +131,29 @@ func DeleteDeviceByID(
 			return http.StatusBadRequest, jsonerror.InvalidUsername("Invalid username")
 		}
 
-		if common.CheckValidDomain(domain, cfg.Matrix.ServerName) == false {
+		if common.IsLocalDomain(domain) == false {
 			return http.StatusBadRequest, jsonerror.InvalidUsername("Invalid username")
 		}
 	}
 
 	LogoutDevice(ctx, delReq.Auth.User, deviceID, deviceDB, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+	auditDeviceDelete(ctx, device, delReq.Auth.User, deviceID, delReq.Auth.Type)
 
 	return http.StatusOK, nil
 }
 
+// auditDeviceDelete records that device deleted the device deviceID of userID
+func auditDeviceDelete(ctx context.Context, device *authtypes.Device, userID, deviceID, authType string) {
+	audit.Emit(ctx, &authtypes.AuditEvent{
+		Type:     authtypes.AuditDeviceDelete,
+		UserID:   device.UserID,
+		DeviceID: device.ID,
+		Target:   userID,
+		Success:  true,
+		Details:  map[string]string{"device_id": deviceID, "auth_type": authType},
+	})
+}
+
 func DeleteDevices(
 	ctx context.Context,
 	req *external.PostDelDevicesRequest,
@@ -164,14 +179,27 @@ func DeleteDevices(
 					hasPwdDevice = true
 				}
 				LogoutDevice(ctx, dev.UserID, dev.ID, deviceDB, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+				auditDeviceDelete(ctx, device, dev.UserID, dev.ID, req.Auth.Type)
 			}
 		}
 		if hasPwdDevice {
 			cache.ExpirePwdChangeDevice(device.UserID)
 		}
+		// the password is changed by the identity provider, which then
+		// logs the other devices out
+		if req.Auth.Type == "m.change_password" {
+			audit.Emit(ctx, &authtypes.AuditEvent{
+				Type:     authtypes.AuditPasswordChange,
+				UserID:   device.UserID,
+				DeviceID: device.ID,
+				Target:   device.UserID,
+				Success:  true,
+			})
+		}
 	} else {
 		for _, deviceId := range req.Devices {
 			LogoutDevice(ctx, device.UserID, deviceId, deviceDB, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+			auditDeviceDelete(ctx, device, device.UserID, deviceId, req.Auth.Type)
 		}
 	}
 
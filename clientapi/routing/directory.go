@@ -105,7 +105,7 @@ func SetLocalAlias(
 		return http.StatusBadRequest, jsonerror.BadJSON("Room alias must be in the form '#localpart:domain'")
 	}
 
-	if common.CheckValidDomain(domain, cfg.Matrix.ServerName) == false {
+	if common.IsLocalDomain(domain) == false {
 		return http.StatusForbidden, jsonerror.Forbidden("Alias must be on local homeserver")
 	}
 
@@ -102,7 +102,7 @@ func OnGetServerNameCfg(
 ) (int, core.Coder) {
 	if !cfg.Matrix.ServerFromDB {
 		return http.StatusOK, &external.GetServerNamesResponse{
-			ServerNames: cfg.Matrix.ServerName,
+			ServerNames: config.GetReloadable().ServerName,
 		}
 	}
 	domains, err := getServerNameCfg(serverConfDB, cache)
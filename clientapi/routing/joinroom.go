@@ -63,7 +63,7 @@ func JoinRoomByIDOrAlias(
 	content["displayname"] = displayName
 	content["avatar_url"] = avatarURL
 
-	req := joinRoomReq{ctx, content, userID, cfg, federation, rpcCli, keyRing}
+	req := joinRoomReq{ctx, content, userID, cfg, federation, rpcCli, keyRing, cache}
 
 	if strings.HasPrefix(roomIDOrAlias, "!") {
 		return req.joinRoomByID(ctx, roomIDOrAlias, idg)
@@ -83,6 +83,7 @@ type joinRoomReq struct {
 	federation *fed.Federation
 	rpcCli     roomserverapi.RoomserverRPCAPI
 	keyRing    gomatrixserverlib.KeyRing
+	cache      service.Cache
 }
 
 // joinRoomByID joins a room by room ID
@@ -176,6 +177,10 @@ func (r joinRoomReq) joinRoom(
 	roomID, domainID string,
 	idg *uid.UidGenerator,
 ) (int, core.Coder) {
+	if blocked := roomBlockedError(r.cache, roomID); blocked != nil {
+		return http.StatusForbidden, blocked
+	}
+
 	var queryRes roomserverapi.QueryRoomStateResponse
 	var queryReq roomserverapi.QueryRoomStateRequest
 	queryReq.RoomID = roomID
@@ -184,7 +189,7 @@ func (r joinRoomReq) joinRoom(
 	err := r.rpcCli.QueryRoomState(r.ctx, &queryReq, &queryRes)
 	if err != nil {
 		domainID, _ := common.DomainFromID(roomID)
-		if common.CheckValidDomain(domainID, r.cfg.Matrix.ServerName) == false {
+		if common.IsLocalDomain(domainID) == false {
 			// resp, err := r.federation.LookupState(domainID, roomID)
 			resp, err := r.federation.MakeJoin(domainID, roomID, r.userID, []string{"1"})
 			if err != nil {
@@ -25,12 +25,15 @@ import (
 	"strings"
 
 	"github.com/finogeeks/ligase/clientapi/httputil"
+	"github.com/finogeeks/ligase/clientapi/sso"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/filter"
 	"github.com/finogeeks/ligase/common/jsonerror"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/service"
 	"github.com/finogeeks/ligase/model/types"
 	"github.com/finogeeks/ligase/plugins/message/external"
 	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
@@ -45,6 +48,40 @@ func passwordLogin() *external.GetLoginResponse {
 	return f
 }
 
+// ssoLogin adds the single sign-on flows, the client exchanges the token it
+// is sent back with through m.login.token
+func ssoLogin(f *external.GetLoginResponse, cfg *config.Dendrite) *external.GetLoginResponse {
+	if cfg.SSO.Provider == "" {
+		return f
+	}
+	f.Flows = append(f.Flows, external.Flow{Type: authtypes.LoginTypeSSO})
+	if cfg.SSO.Provider == sso.ProviderCAS {
+		f.Flows = append(f.Flows, external.Flow{Type: authtypes.LoginTypeCAS})
+	}
+	f.Flows = append(f.Flows, external.Flow{Type: authtypes.LoginTypeToken})
+	return f
+}
+
+// tokenLogin logs in with a m.login.token handed out by single sign-on
+func tokenLogin(
+	ctx context.Context,
+	req *external.PostLoginRequest,
+	cfg config.Dendrite,
+	cache service.Cache,
+) (string, int, core.Coder) {
+	if req.Token == "" {
+		return "", http.StatusBadRequest, jsonerror.BadJSON("'token' must be supplied.")
+	}
+	userID, err := cache.TakeLoginToken(req.Token)
+	if err != nil {
+		return "", http.StatusInternalServerError, jsonerror.Unknown("failed to check login token: " + err.Error())
+	}
+	if userID == "" {
+		return "", http.StatusForbidden, jsonerror.Forbidden("Invalid login token")
+	}
+	return userID, http.StatusOK, nil
+}
+
 func providerLogin(
 	userID string,
 	ctx context.Context,
@@ -58,11 +95,10 @@ func providerLogin(
 	idg *uid.UidGenerator,
 	tokenFilter *filter.Filter,
 	rpcClient *common.RpcClient,
+	cache service.Cache,
 ) (int, core.Coder) {
-	if admin == true {
-		if r.Password != cfg.Authorization.AuthorizeCode {
-			return http.StatusUnauthorized, jsonerror.Unknown("password incorrect")
-		}
+	if admin && !isServerAdmin(ctx, &cfg, accountDB, userID) {
+		return http.StatusForbidden, jsonerror.Forbidden("You are not a server admin")
 	}
 	devID := &r.DeviceID
 	account, allow, e := checkCreateAccount(cfg, accountDB, userID, *devID)
@@ -72,6 +108,9 @@ func providerLogin(
 	if !allow {
 		return http.StatusUnauthorized, jsonerror.Unknown(fmt.Sprintf("account has to max count: %d", cfg.LicenseItem.TotalUsers))
 	}
+	if account != nil && account.Locked {
+		return http.StatusUnauthorized, jsonerror.UserLocked("This account has been locked")
+	}
 	appServiceID := "virtual"
 	if (account != nil && account.AppServiceID == "actual") || *devID != "" {
 		appServiceID = "actual"
@@ -122,7 +161,16 @@ func providerLogin(
 		return http.StatusInternalServerError, jsonerror.Unknown("failed to create device: " + err.Error())
 	}
 
-	log.Infof("login success user %s device %s token %s", dev.UserID, dev.ID, token)
+	var refreshToken string
+	var expiresInMS int64
+	if r.RefreshToken {
+		token, refreshToken, expiresInMS, err = refreshableToken(&cfg, cache, token)
+		if err != nil {
+			return http.StatusInternalServerError, jsonerror.Unknown("failed to generate access token: " + err.Error())
+		}
+	}
+
+	log.Infof("login success user %s device %s", dev.UserID, dev.ID)
 
 	if cfg.PubLoginInfo {
 		content := types.LoginInfoContent{
@@ -135,7 +183,7 @@ func providerLogin(
 
 		bytes, err := json.Marshal(content)
 		if err == nil {
-			log.Infof("pub login info %s", string(bytes))
+			log.Infof("pub login info user %s device %s", userID, dev.ID)
 			rpcClient.Pub(types.LoginTopicDef, bytes)
 		} else {
 			log.Errorf("pub login info  Marshal err %v", err)
@@ -143,10 +191,12 @@ func providerLogin(
 	}
 	pubLoginToken(userID, deviceID, rpcClient)
 	return http.StatusOK, &external.PostLoginResponse{
-		UserID:      dev.UserID,
-		AccessToken: token,
-		HomeServer:  domain,
-		DeviceID:    dev.ID,
+		UserID:       dev.UserID,
+		AccessToken:  token,
+		HomeServer:   domain,
+		DeviceID:     dev.ID,
+		ExpiresInMS:  expiresInMS,
+		RefreshToken: refreshToken,
 	}
 }
 
@@ -201,7 +251,58 @@ func LoginPost(
 	idg *uid.UidGenerator,
 	tokenFilter *filter.Filter,
 	rpcClient *common.RpcClient,
+	cache service.Cache,
 ) (int, core.Coder) {
+	code, res := loginPost(ctx, req, accountDB, deviceDB, encryptDB, syncDB, cfg, admin, idg, tokenFilter, rpcClient, cache)
+	auditLogin(ctx, req, admin, code, res)
+	return code, res
+}
+
+// auditLogin records the outcome of a login, the user is the one logged in
+// or, when it failed, the one asked for
+func auditLogin(ctx context.Context, req *external.PostLoginRequest, admin bool, code int, res core.Coder) {
+	ev := &authtypes.AuditEvent{
+		Type:    authtypes.AuditLogin,
+		UserID:  req.User,
+		IP:      req.IP,
+		Success: code == http.StatusOK,
+		Details: map[string]string{"login_type": req.RequestType},
+	}
+	if admin {
+		ev.Type = authtypes.AuditAdminLogin
+	}
+	switch r := res.(type) {
+	case *external.PostLoginResponse:
+		ev.UserID, ev.DeviceID = r.UserID, r.DeviceID
+	case *jsonerror.MatrixError:
+		ev.Details["error"] = r.Err
+	}
+	audit.Emit(ctx, ev)
+}
+
+func loginPost(
+	ctx context.Context,
+	req *external.PostLoginRequest,
+	accountDB model.AccountsDatabase,
+	deviceDB model.DeviceDatabase,
+	encryptDB model.EncryptorAPIDatabase,
+	syncDB model.SyncAPIDatabase,
+	cfg config.Dendrite,
+	admin bool,
+	idg *uid.UidGenerator,
+	tokenFilter *filter.Filter,
+	rpcClient *common.RpcClient,
+	cache service.Cache,
+) (int, core.Coder) {
+	if req.RequestType == authtypes.LoginTypeToken {
+		userID, code, resErr := tokenLogin(ctx, req, cfg, cache)
+		if resErr != nil {
+			return code, resErr
+		}
+		req.User = userID
+		return providerLogin(userID, ctx, *req, cfg, deviceDB, accountDB, encryptDB, syncDB, admin, idg, tokenFilter, rpcClient, cache)
+	}
+
 	// r.User can either be a user ID or just the userID... or other things maybe.
 	localPart, domain, err := gomatrixserverlib.SplitID('@', req.User)
 	if err != nil {
@@ -212,12 +313,12 @@ func LoginPost(
 		return http.StatusBadRequest, jsonerror.BadJSON("'user' must be supplied.")
 	}
 
-	if common.CheckValidDomain(string(domain), cfg.Matrix.ServerName) == false {
+	if common.IsLocalDomain(string(domain)) == false {
 		return http.StatusBadRequest, jsonerror.InvalidUsername("User ID not ours")
 	}
 
 	if strings.EqualFold(cfg.Authorization.AuthorizeMode, "provider") {
-		return providerLogin(req.User, ctx, *req, cfg, deviceDB, accountDB, encryptDB, syncDB, admin, idg, tokenFilter, rpcClient)
+		return providerLogin(req.User, ctx, *req, cfg, deviceDB, accountDB, encryptDB, syncDB, admin, idg, tokenFilter, rpcClient, cache)
 	}
 
 	return http.StatusServiceUnavailable, jsonerror.Unknown("Internal Server Error")
@@ -236,6 +337,5 @@ func LoginGet(
 	tokenFilter *filter.Filter,
 	rpcClient *common.RpcClient,
 ) (int, core.Coder) {
-	// TODO: support other forms of login other than password, depending on config options
-	return http.StatusOK, passwordLogin()
+	return http.StatusOK, ssoLogin(passwordLogin(), &cfg)
 }
@@ -20,11 +20,14 @@ package routing
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/filter"
 	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
 	"github.com/finogeeks/ligase/model/service"
 	"github.com/finogeeks/ligase/model/types"
 	"github.com/finogeeks/ligase/skunkworks/log"
@@ -43,6 +46,7 @@ func Logout(
 	rpcClient *common.RpcClient,
 ) (int, core.Coder) {
 	LogoutDevice(ctx, userID, deviceID, deviceDB, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+	audit.Emit(ctx, &authtypes.AuditEvent{Type: authtypes.AuditLogout, UserID: userID, DeviceID: deviceID, Success: true})
 	return http.StatusOK, nil
 }
 
@@ -73,6 +77,14 @@ func LogoutDevice(
 
 	cache.DeleteDeviceKey(userID, deviceID)
 
+	if err := cache.DelDeviceRefreshToken(userID, deviceID); err != nil {
+		log.Errorf("Log out remove refresh token error, device: %s ,  user: %s , error: %v", deviceID, userID, err)
+	}
+
+	if err := cache.DelDeviceLastSeen(userID, deviceID); err != nil {
+		log.Errorf("Log out remove last seen error, device: %s ,  user: %s , error: %v", deviceID, userID, err)
+	}
+
 	err = syncDB.DeleteDeviceStdMessage(ctx, userID, deviceID)
 	if err != nil {
 		log.Errorf("Log out remove device std message, device: %s ,  user: %s , error: %v", deviceID, userID, err)
@@ -122,10 +134,35 @@ func LogoutAll(
 ) (int, core.Coder) {
 	log.Infof("logout all user %s device %s", userID, deviceID)
 
+	count := logoutAll(ctx, deviceDB, userID, cache, encryptDB, syncDB, tokenFilter, rpcClient)
+	audit.Emit(ctx, &authtypes.AuditEvent{
+		Type:     authtypes.AuditLogoutAll,
+		UserID:   userID,
+		DeviceID: deviceID,
+		Success:  true,
+		Details:  map[string]string{"devices": strconv.Itoa(count)},
+	})
+	return http.StatusOK, nil
+}
+
+// logoutAll logs out the devices of userID, it returns how many there were
+func logoutAll(
+	ctx context.Context,
+	deviceDB model.DeviceDatabase,
+	userID string,
+	cache service.Cache,
+	encryptDB model.EncryptorAPIDatabase,
+	syncDB model.SyncAPIDatabase,
+	tokenFilter *filter.Filter,
+	rpcClient *common.RpcClient,
+) int {
 	devs := cache.GetDevicesByUserID(userID)
 	for _, dev := range *devs {
 		LogoutDevice(ctx, dev.UserID, dev.ID, deviceDB, cache, encryptDB, syncDB, tokenFilter, rpcClient)
 	}
-
-	return http.StatusOK, nil
+	// also the refresh tokens of devices the cache did not list
+	if err := cache.DelUserRefreshTokens(userID); err != nil {
+		log.Errorf("Log out all remove refresh tokens error, user: %s , error: %v", userID, err)
+	}
+	return len(*devs)
 }
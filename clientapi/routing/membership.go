@@ -27,6 +27,7 @@ import (
 	"github.com/finogeeks/ligase/clientapi/httputil"
 	"github.com/finogeeks/ligase/clientapi/threepid"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/jsonerror"
 	"github.com/finogeeks/ligase/common/uid"
@@ -44,6 +45,13 @@ import (
 
 var errMissingUserID = errors.New("'user_id' must be supplied")
 
+// the memberships acting on another user, recorded in the audit log
+var membershipAuditTypes = map[string]string{
+	"ban":   authtypes.AuditBan,
+	"unban": authtypes.AuditUnban,
+	"kick":  authtypes.AuditKick,
+}
+
 // SendMembership implements PUT /rooms/{roomID}/(join|kick|ban|unban|leave|invite)
 // by building a m.room.member event then sending it to the room server
 func SendMembership(
@@ -54,7 +62,7 @@ func SendMembership(
 	cache service.Cache,
 	idg *uid.UidGenerator,
 	complexCache *common.ComplexCache,
-) (int, core.Coder) {
+) (code int, resp core.Coder) {
 	tid, err := idg.Next()
 	traceId := fmt.Sprintf("%d", tid)
 	log.Infof("------- traceId:%s handle SendMembership QueryRoomState send room %s membership:%s user:%s", traceId, roomID, membership, userID)
@@ -66,6 +74,31 @@ func SendMembership(
 		}
 	}
 	log.Infof("------- traceId:%s handle SendMembership QueryRoomState send room %s membership:%s user:%s body.user:%s", traceId, roomID, membership, userID, body.UserID)
+	if auditType, ok := membershipAuditTypes[membership]; ok {
+		defer func() {
+			ev := &authtypes.AuditEvent{
+				Type:     auditType,
+				UserID:   userID,
+				DeviceID: deviceID,
+				Target:   body.UserID,
+				RoomID:   roomID,
+				Success:  code == http.StatusOK,
+			}
+			if body.Reason != "" {
+				ev.Details = map[string]string{"reason": body.Reason}
+			}
+			audit.Emit(ctx, ev)
+		}()
+	}
+	if membership == "join" || membership == "invite" {
+		if blocked := roomBlockedError(cache, roomID); blocked != nil {
+			return http.StatusForbidden, blocked
+		}
+	}
+	if membership == "invite" && isShadowBanned(cache, userID) {
+		log.Infof("------- traceId:%s handle SendMembership drop invite of shadow banned user %s room %s", traceId, userID, roomID)
+		return http.StatusOK, &external.PostRoomsMembershipResponse{}
+	}
 	inviteStored, err := threepid.CheckAndProcessInvite(
 		ctx, userID, &body, cfg, rpcCli, cache, membership, roomID, idg, complexCache,
 	)
@@ -96,7 +129,7 @@ func SendMembership(
 	log.Infof("-------traceId:%s handle SendMembership QueryRoomState recv roomID:%s resp %v, err:%v", traceId, roomID, queryRes, err)
 	if err != nil {
 		domainID, _ := common.DomainFromID(roomID)
-		if membership == "join" && common.CheckValidDomain(domainID, cfg.Matrix.ServerName) == false {
+		if membership == "join" && common.IsLocalDomain(domainID) == false {
 			resp, err := federation.MakeJoin(domainID, roomID, userID, []string{"1"})
 			if err != nil {
 				log.Errorf("traceId:%s handle SendMembership user:%s roomID:%s make join error: %v", traceId, userID, roomID, err)
@@ -194,7 +227,7 @@ func SendMembership(
 			}
 		}
 		domainID, _ := common.DomainFromID(roomID)
-		if ok2 && !common.CheckValidDomain(domainID, cfg.Matrix.ServerName) {
+		if ok2 && !common.IsLocalDomain(domainID) {
 			resp, err := federation.MakeLeave(domainID, roomID, userID)
 			if err != nil {
 				log.Errorf("traceId:%s handle SendMembership user:%s roomID:%s make leave error: %v", traceId, userID, roomID, err)
@@ -217,7 +250,7 @@ func SendMembership(
 				return httputil.LogThenErrorCtx(ctx, err)
 			}
 
-			log.Infof("traceId:%s handle SendMembership user:%s roomID:%s leave room resp:%s", traceId, userID, roomID, resp)
+			log.Infof("traceId:%s handle SendMembership user:%s roomID:%s leave room resp:%+v", traceId, userID, roomID, resp)
 		}
 	}
 
@@ -270,7 +303,7 @@ func SendMembership(
 		// 	return http.StatusBadRequest, jsonerror.BadJSON("invitee Id must be in the form '@localpart:domain'")
 		// }
 
-		// if !common.CheckValidDomain(inviteeDomain, cfg.Matrix.ServerName) {
+		// if !common.IsLocalDomain(inviteeDomain) {
 		// 	//TODO federation auto join
 		// 	type UnsingedInviteStates struct {
 		// 		States []gomatrixserverlib.Event `json:"invite_room_state"`
@@ -436,7 +469,7 @@ func loadProfile(
 	}
 	var profile *authtypes.Profile
 	profile = &authtypes.Profile{}
-	if common.CheckValidDomain(domain, cfg.Matrix.ServerName) {
+	if common.IsLocalDomain(domain) {
 		displayName, avatarURL, _ := complexCache.GetProfileByUserID(ctx, userID)
 
 		profile.DisplayName = displayName
@@ -77,7 +77,7 @@ func GenNewToken(
 		return http.StatusInternalServerError, jsonerror.Unknown("failed to create device: " + err.Error())
 	}
 
-	log.Infof("login success user %s device %s token %s", dev.UserID, dev.ID, token)
+	log.Infof("login success user %s device %s", dev.UserID, dev.ID)
 	pubLoginToken(dev.UserID, dev.ID, rpcClient)
 	return http.StatusOK, &external.PostLoginResponse{
 		UserID:      dev.UserID,
@@ -112,7 +112,7 @@ func GetSuperAdminToken(
 			httputil.LogThenErrorCtx(ctx, err)
 		}
 
-		log.Infof("login success super user %s get token %s", userID, token)
+		log.Infof("login success super user %s reuse device %s", userID, oldDevID)
 		return http.StatusOK, &external.PostLoginResponse{
 			UserID:      userID,
 			AccessToken: token,
@@ -150,7 +150,7 @@ func GetSuperAdminToken(
 		return http.StatusInternalServerError, jsonerror.Unknown("failed to create super device: " + err.Error())
 	}
 
-	log.Infof("login success super user %s device %s gen token %s", userID, dev.ID, token)
+	log.Infof("login success super user %s device %s", userID, dev.ID)
 	pubLoginToken(userID, dev.ID, rpcClient)
 	return http.StatusOK, &external.PostLoginResponse{
 		UserID:      userID,
@@ -0,0 +1,79 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+// RequestOpenIDToken implements POST /user/{userId}/openid/request_token
+func RequestOpenIDToken(
+	ctx context.Context,
+	req *external.PostUserOpenIDRequest,
+	userID string,
+	cfg config.Dendrite,
+	cache service.Cache,
+) (int, core.Coder) {
+	if req.UserID != userID {
+		return http.StatusForbidden, jsonerror.Forbidden("Cannot request tokens for other users")
+	}
+
+	token, err := common.BuildRandomURLEncString()
+	if err != nil {
+		log.Errorf("RequestOpenIDToken build token user:%s err:%v", userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to generate token")
+	}
+	lifetime := cfg.Authorization.OpenIDTokenLifetime
+	if err := cache.SetOpenIDToken(token, userID, lifetime); err != nil {
+		log.Errorf("RequestOpenIDToken store token user:%s err:%v", userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to store token")
+	}
+
+	return http.StatusOK, &external.PostUserOpenIDResponse{
+		AccessToken:      token,
+		TokenType:        "Bearer",
+		MatrixServerName: cfg.Matrix.ServerName[0],
+		ExpiresIn:        int(lifetime / 1000),
+	}
+}
+
+// GetOpenIDUserInfo implements GET /_matrix/federation/v1/openid/userinfo
+func GetOpenIDUserInfo(
+	ctx context.Context,
+	req *external.GetFedOpenIDUserInfoRequest,
+	cache service.Cache,
+) (int, core.Coder) {
+	if req.AccessToken == "" {
+		return http.StatusUnauthorized, jsonerror.MissingToken("Missing access token")
+	}
+	userID, err := cache.GetOpenIDToken(req.AccessToken)
+	if err != nil {
+		log.Errorf("GetOpenIDUserInfo lookup token err:%v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to look up token")
+	}
+	if userID == "" {
+		return http.StatusUnauthorized, jsonerror.UnknownToken("Access Token unknown or expired")
+	}
+	return http.StatusOK, &external.GetFedOpenIDUserInfoResponse{Sub: userID}
+}
@@ -21,10 +21,12 @@ import (
 
 	"github.com/finogeeks/ligase/clientapi/httputil"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/jsonerror"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
 	"github.com/finogeeks/ligase/model/roomservertypes"
 	"github.com/finogeeks/ligase/model/service"
 	"github.com/finogeeks/ligase/model/service/roomserverapi"
@@ -58,6 +60,19 @@ func PostEvent(
 			r["membership"] = "leave"
 		}
 	}
+	if eventType == "m.room.retention" && stateKey != nil {
+		var retention common.RetentionContent
+		if err := json.Unmarshal(req.Content, &retention); err != nil {
+			return http.StatusBadRequest, jsonerror.BadJSON("m.room.retention content is invalid")
+		}
+		if (retention.MinLifetime != nil && *retention.MinLifetime < 0) ||
+			(retention.MaxLifetime != nil && *retention.MaxLifetime < 0) {
+			return http.StatusBadRequest, jsonerror.BadJSON("lifetimes must not be negative")
+		}
+		if retention.MinLifetime != nil && retention.MaxLifetime != nil && *retention.MinLifetime > *retention.MaxLifetime {
+			return http.StatusBadRequest, jsonerror.BadJSON("min_lifetime must not exceed max_lifetime")
+		}
+	}
 	var txnAndDeviceID *roomservertypes.TransactionID
 	if txnID != nil {
 		txnAndDeviceID = &roomservertypes.TransactionID{
@@ -88,7 +103,7 @@ func PostEvent(
 	}
 	err := builder.SetContent(r)
 	if err != nil {
-		log.Errorf("PostEvent SetContent error, txnid:%s userID %s roomID %s eventType %s stateKey %s err %v", txnAndDeviceID.TransactionID, userID, roomID, eventType, stateKey, err)
+		log.Errorf("PostEvent SetContent error, txnid:%s userID %s roomID %s eventType %s stateKey %v err %v", txnAndDeviceID.TransactionID, userID, roomID, eventType, stateKey, err)
 		return httputil.LogThenErrorCtx(ctx, err)
 	}
 
@@ -116,12 +131,26 @@ func PostEvent(
 	}
 	if err = gomatrixserverlib.Allowed(*e, &queryRes); err != nil {
 		log.Errorf("PostEvent Allowed error, txnid:%s userID %s roomID %s err %v", txnAndDeviceID.TransactionID, userID, roomID,  err)
+		auditPowerLevels(ctx, eventType, userID, deviceID, IP, roomID, "", err)
 		return http.StatusForbidden, jsonerror.Forbidden(err.Error()) // TODO: Is this error string comprehensible to the client?
 	}
 
 	log.Debugf("------------------------PostEvent check-event-allowed %v", (time.Now().UnixNano()-last)/1000)
 	last = time.Now().UnixNano()
 
+	// a shadow banned user only gets to change its own membership, anything
+	// else looks sent but never reaches the roomserver
+	ownMembership := eventType == "m.room.member" && stateKey != nil && *stateKey == userID
+	if !ownMembership && isShadowBanned(cache, userID) {
+		log.Infof("PostEvent drop event of shadow banned user %s roomID %s txnid:%s", userID, roomID, txnAndDeviceID.TransactionID)
+		if txnID != nil {
+			cache.PutTxnID(roomID, roomID+eventType+(*txnID), e.EventID())
+		}
+		return http.StatusOK, &external.PutRoomStateByTypeWithTxnIDResponse{
+			EventID: e.EventID(),
+		}
+	}
+
 	// pass the new event to the roomserver
 	rawEvent := roomserverapi.RawEvent{
 		RoomID: roomID,
@@ -145,6 +174,7 @@ func PostEvent(
 	if txnID != nil {
 		cache.PutTxnID(roomID, roomID+eventType+(*txnID), e.EventID())
 	}
+	auditPowerLevels(ctx, eventType, userID, deviceID, IP, roomID, e.EventID(), nil)
 
 	log.Debugf("------------------------PostEvent send-event-to-server %v", (time.Now().UnixNano()-last)/1000)
 	log.Infof("------------------------PostEvent all %v remote:%s dev:%s eventId:%s txnId:%s", (time.Now().UnixNano()-start)/1000, IP, deviceID, e.EventID(), txnAndDeviceID.TransactionID)
@@ -153,3 +183,26 @@ func PostEvent(
 		EventID: e.EventID(),
 	}
 }
+
+// auditPowerLevels records a change of the power levels of a room, or the
+// attempt refused with err
+func auditPowerLevels(ctx context.Context, eventType, userID, deviceID, IP, roomID, eventID string, err error) {
+	if eventType != "m.room.power_levels" {
+		return
+	}
+	ev := &authtypes.AuditEvent{
+		Type:     authtypes.AuditPowerLevels,
+		UserID:   userID,
+		DeviceID: deviceID,
+		IP:       IP,
+		RoomID:   roomID,
+		Success:  err == nil,
+		Details:  map[string]string{},
+	}
+	if err != nil {
+		ev.Details["error"] = err.Error()
+	} else {
+		ev.Details["event_id"] = eventID
+	}
+	audit.Emit(ctx, ev)
+}
@@ -98,7 +98,7 @@ func UpdatePresenceByID(
 		return httputil.LogThenErrorCtx(ctx, err)
 	}
 	cache.SetPresences(reqContent.UserID, presence, statusMsg, extStatusMsg)
-	log.Infof("Set Presences success userID:%s Presence:%s StatusMsg:%s ExtStatusMsg:%s", reqContent.UserID, reqContent.Presence, reqContent.StatusMsg, reqContent.ExtStatusMsg)
+	log.Infof("Set Presences success userID:%s Presence:%v StatusMsg:%v ExtStatusMsg:%v", reqContent.UserID, reqContent.Presence, reqContent.StatusMsg, reqContent.ExtStatusMsg)
 
 	displayName, avatarURL, _ := complexCache.GetProfileByUserID(ctx, reqContent.UserID)
 	user_info := cache.GetUserInfoByUserID(reqContent.UserID)
@@ -186,7 +186,7 @@ func GetPresenceByID(
 	}
 	if status == "" {
 		domain, _ := common.DomainFromID(userID)
-		if !common.CheckValidDomain(domain, cfg.Matrix.ServerName) {
+		if !common.IsLocalDomain(domain) {
 			profile, err := federation.LookupProfile(domain, userID)
 			if err != nil {
 				return http.StatusInternalServerError, jsonerror.Unknown("Internal Server Error." + err.Error())
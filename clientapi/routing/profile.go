@@ -22,6 +22,7 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/finogeeks/ligase/appservice/query"
 	"github.com/finogeeks/ligase/clientapi/httputil"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
@@ -57,6 +58,12 @@ func getFedProfile(
 	avatarURL := cfg.DefaultAvatar
 	displayName := ""
 
+	if common.IsLocalDomain(domain) {
+		if resp, ok := getAppServiceProfile(ctx, userID, cfg, complexCache); ok {
+			return http.StatusOK, resp
+		}
+	}
+
 	resp, err := federation.LookupProfile(domain, userID)
 	if err != nil {
 		log.Errorf("get profile from federation error %v", err)
@@ -73,8 +80,31 @@ func getFedProfile(
 	}
 }
 
+// getAppServiceProfile lets the application service owning a missing local
+// user provision it, then looks the profile up again
+func getAppServiceProfile(
+	ctx context.Context,
+	userID string,
+	cfg config.Dendrite,
+	complexCache *common.ComplexCache,
+) (*external.GetProfileResponse, bool) {
+	if !query.IsUserIDInterested(&cfg, userID) || !query.UserIDExists(ctx, &cfg, userID) {
+		return nil, false
+	}
+
+	displayName, avatarURL, err := complexCache.GetProfileByUserID(ctx, userID)
+	if err != nil {
+		log.Warnf("get profile of appservice user: %s after query, error: %v", userID, err)
+		return nil, false
+	}
+	return &external.GetProfileResponse{
+		AvatarURL:   avatarURL,
+		DisplayName: displayName,
+	}, true
+}
+
 func checkDomain(ctx context.Context, cfg config.Dendrite, domain string, cache service.Cache, db model.RoomServerDatabase) bool {
-	if common.CheckValidDomain(domain, cfg.Matrix.ServerName) {
+	if common.IsLocalDomain(domain) {
 		return true
 	}
 	settingKey := "im.federation.domains"
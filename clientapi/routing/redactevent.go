@@ -94,7 +94,7 @@ func RedactEvent(
 		return 404, jsonerror.NotFound("can't find original event")
 	}
 
-	log.Infof("------------------------RedactEvent get target ev %s sender %v", queryRoomEventByIDResponse.Event, queryRoomEventByIDResponse.Event.Sender())
+	log.Infof("------------------------RedactEvent get target ev %v sender %v", queryRoomEventByIDResponse.Event, queryRoomEventByIDResponse.Event.Sender())
 
 	builder := gomatrixserverlib.EventBuilder{
 		Sender:        userID,
@@ -141,6 +141,13 @@ func RedactEvent(
 	log.Debugf("------------------------RedactEvent check-event-allowed %v", (time.Now().UnixNano()-last)/1000)
 	last = time.Now().UnixNano()
 
+	if isShadowBanned(cache, userID) {
+		log.Infof("RedactEvent drop redaction of shadow banned user %s roomID %s", userID, roomID)
+		return http.StatusOK, &external.PutRedactEventResponse{
+			EventID: e.EventID(),
+		}
+	}
+
 	// pass the new event to the roomserver
 	rawEvent := roomserverapi.RawEvent{
 		RoomID: roomID,
@@ -0,0 +1,124 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+// the refresh token is longer than the nonce of access tokens, it is the only
+// secret protecting a session that outlives its access token
+const refreshTokenBytes = 32
+
+// PostRefresh implements POST /refresh
+func PostRefresh(
+	ctx context.Context,
+	req *external.PostRefreshRequest,
+	cfg *config.Dendrite,
+	cache service.Cache,
+) (int, core.Coder) {
+	if req.RefreshToken == "" {
+		return http.StatusBadRequest, jsonerror.MissingParam("refresh_token must be supplied")
+	}
+
+	dev, err := cache.TakeRefreshToken(req.RefreshToken)
+	if err != nil {
+		log.Errorf("refresh token lookup error: %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to look up refresh token")
+	}
+	if dev == nil {
+		return http.StatusUnauthorized, jsonerror.UnknownToken("Unknown refresh token")
+	}
+	// the refresh token is worthless once its device was logged out or
+	// deleted, whichever path did it
+	if cache.GetDeviceByDeviceID(dev.ID, dev.UserID) == nil {
+		log.Infof("refresh token of removed device user %s device %s", dev.UserID, dev.ID)
+		return http.StatusUnauthorized, jsonerror.UnknownToken("Unknown refresh token")
+	}
+
+	accessToken, refreshToken, expiresInMS, err := issueRefreshableToken(cfg, cache, dev)
+	if err != nil {
+		log.Errorf("refresh token user %s device %s error: %v", dev.UserID, dev.ID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to refresh access token")
+	}
+
+	log.Infof("refresh token success user %s device %s", dev.UserID, dev.ID)
+	return http.StatusOK, &external.PostRefreshResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresInMS:  expiresInMS,
+	}
+}
+
+// refreshableToken swaps a freshly built access token that never expires for
+// one that does, together with a refresh token to renew it. Guest tokens and
+// servers without access_token_lifetime_ms keep the token they have.
+func refreshableToken(cfg *config.Dendrite, cache service.Cache, token string) (string, string, int64, error) {
+	if cfg.Authorization.AccessTokenLifetime <= 0 || token == "" {
+		return token, "", 0, nil
+	}
+	dev, guest, err := common.ExtractToken(cfg.Macaroon.Key, cfg.Macaroon.Id, cfg.Macaroon.Loc, token)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if guest {
+		return token, "", 0, nil
+	}
+	return issueRefreshableToken(cfg, cache, dev)
+}
+
+func issueRefreshableToken(cfg *config.Dendrite, cache service.Cache, dev *authtypes.Device) (string, string, int64, error) {
+	lifetime := cfg.Authorization.AccessTokenLifetime
+	var expireTs int64
+	if lifetime > 0 {
+		expireTs = time.Now().UnixNano()/int64(time.Millisecond) + lifetime
+	}
+
+	domain, _ := common.DomainFromID(dev.UserID)
+	accessToken, err := common.BuildExpiringToken(
+		cfg.Macaroon.Key, dev.UserID, domain, dev.UserID, dev.Identifier,
+		false, dev.ID, dev.DeviceType, dev.IsHuman, expireTs,
+	)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if expireTs == 0 {
+		// refresh tokens were switched off since the old token was issued
+		return accessToken, "", 0, nil
+	}
+
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", 0, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(b)
+	if err := cache.SetRefreshToken(refreshToken, dev, cfg.Authorization.RefreshTokenLifetime); err != nil {
+		return "", "", 0, err
+	}
+	return accessToken, refreshToken, lifetime, nil
+}
@@ -31,13 +31,16 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/finogeeks/ligase/clientapi/threepid"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/model/service"
 	"github.com/finogeeks/ligase/plugins/message/external"
 	"github.com/finogeeks/ligase/plugins/message/internals"
 	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
@@ -58,11 +61,23 @@ const (
 
 // sessionsDict keeps track of completed auth stages for each session.
 type sessionsDict struct {
+	sync.Mutex
 	sessions map[string][]string
+	// third party identifiers validated in a session, they are bound to
+	// the account once it is created
+	threepids map[string][]*authtypes.ThreePIDSession
+	// registration token a session was checked with
+	tokens map[string]string
 }
 
 // GetCompletedStages returns the completed stages for a session.
-func (d sessionsDict) GetCompletedStages(sessionID string) []string {
+func (d *sessionsDict) GetCompletedStages(sessionID string) []string {
+	d.Lock()
+	defer d.Unlock()
+	return d.completedStages(sessionID)
+}
+
+func (d *sessionsDict) completedStages(sessionID string) []string {
 	if completedStages, ok := d.sessions[sessionID]; ok {
 		return completedStages
 	}
@@ -72,12 +87,53 @@ func (d sessionsDict) GetCompletedStages(sessionID string) []string {
 
 // AAddCompletedStage records that a session has completed an auth stage.
 func (d *sessionsDict) AddCompletedStage(sessionID string, stage string) {
-	d.sessions[sessionID] = append(d.GetCompletedStages(sessionID), stage)
+	d.Lock()
+	defer d.Unlock()
+	d.sessions[sessionID] = append(d.completedStages(sessionID), stage)
+}
+
+// AddThreePID records an identifier validated by a session.
+func (d *sessionsDict) AddThreePID(sessionID string, session *authtypes.ThreePIDSession) {
+	d.Lock()
+	defer d.Unlock()
+	d.threepids[sessionID] = append(d.threepids[sessionID], session)
+}
+
+// GetThreePIDs returns the identifiers validated by a session.
+func (d *sessionsDict) GetThreePIDs(sessionID string) []*authtypes.ThreePIDSession {
+	d.Lock()
+	defer d.Unlock()
+	return d.threepids[sessionID]
+}
+
+// GetToken returns the registration token checked by a session.
+func (d *sessionsDict) GetToken(sessionID string) string {
+	d.Lock()
+	defer d.Unlock()
+	return d.tokens[sessionID]
+}
+
+// SetToken records the registration token checked by a session.
+func (d *sessionsDict) SetToken(sessionID, token string) {
+	d.Lock()
+	defer d.Unlock()
+	d.tokens[sessionID] = token
+}
+
+// Delete forgets a session once its registration is complete.
+func (d *sessionsDict) Delete(sessionID string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.sessions, sessionID)
+	delete(d.threepids, sessionID)
+	delete(d.tokens, sessionID)
 }
 
 func newSessionsDict() *sessionsDict {
 	return &sessionsDict{
-		sessions: make(map[string][]string),
+		sessions:  make(map[string][]string),
+		threepids: make(map[string][]*authtypes.ThreePIDSession),
+		tokens:    make(map[string]string),
 	}
 }
 
@@ -205,7 +261,7 @@ func UsernameIsWithinApplicationServiceNamespace(
 	}
 
 	// Loop through all known Application Service's namespaces and see if any match
-	for _, knownAppService := range cfg.Derived.ApplicationServices {
+	for _, knownAppService := range config.GetReloadable().ApplicationServices {
 		for _, namespace := range knownAppService.NamespaceMap["users"] {
 			// AS namespaces are checked for validity in config
 			namespace.RegexpObject, _ = regexp.Compile(namespace.Regex)
@@ -225,7 +281,7 @@ func UsernameMatchesMultipleExclusiveNamespaces(
 ) bool {
 	// Check namespaces and see if more than one match
 	matchCount := 0
-	for _, appService := range cfg.Derived.ApplicationServices {
+	for _, appService := range config.GetReloadable().ApplicationServices {
 		for _, namespaceSlice := range appService.NamespaceMap {
 			for _, namespace := range namespaceSlice {
 				// Check if we have a match on this username
@@ -253,7 +309,7 @@ func validateApplicationService(
 	accessToken := req.AccessToken
 	userID := username
 	var matchedApplicationService *config.ApplicationService
-	for _, appService := range cfg.Derived.ApplicationServices {
+	for _, appService := range config.GetReloadable().ApplicationServices {
 		if appService.ASToken == accessToken {
 			matchedApplicationService = &appService
 			break
@@ -290,6 +346,31 @@ func Register(
 	deviceDB model.DeviceDatabase,
 	cfg *config.Dendrite,
 	idg *uid.UidGenerator,
+	cache service.Cache,
+) (int, core.Coder) {
+	code, resp := register(ctx, req, accountDB, deviceDB, cfg, idg)
+	r, ok := resp.(*external.RegisterResponse)
+	if !ok || code != http.StatusOK || !req.RefreshToken {
+		return code, resp
+	}
+
+	token, refreshToken, expiresInMS, err := refreshableToken(cfg, cache, r.AccessToken)
+	if err != nil {
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to generate access token")
+	}
+	r.AccessToken = token
+	r.RefreshToken = refreshToken
+	r.ExpiresInMS = expiresInMS
+	return code, r
+}
+
+func register(
+	ctx context.Context,
+	req *external.PostRegisterRequest,
+	accountDB model.AccountsDatabase,
+	deviceDB model.DeviceDatabase,
+	cfg *config.Dendrite,
+	idg *uid.UidGenerator,
 ) (int, core.Coder) {
 	kind := req.Kind
 	if kind == "guest" {
@@ -336,9 +417,10 @@ func Register(
 
 	// Make sure normal user isn't registering under an exclusive application
 	// service namespace. Skip this check if no app services are registered.
+	reloaded := config.GetReloadable()
 	if req.Auth.Type != "m.login.application_service" &&
-		len(cfg.Derived.ApplicationServices) != 0 &&
-		cfg.Derived.ExclusiveApplicationServicesUsernameRegexp.MatchString(req.Username) {
+		len(reloaded.ApplicationServices) != 0 &&
+		reloaded.ExclusiveApplicationServicesUsernameRegexp.MatchString(req.Username) {
 		return http.StatusBadRequest, jsonerror.ASExclusive("This username is reserved by an application service.")
 	}
 
@@ -357,7 +439,7 @@ func handleGuestRegister(idg *uid.UidGenerator, cfg *config.Dendrite, domain str
 		return http.StatusInternalServerError, jsonerror.Unknown("Failed to generate uid")
 	}
 
-	if common.CheckValidDomain(domain, cfg.Matrix.ServerName) == false {
+	if common.IsLocalDomain(domain) == false {
 		return http.StatusBadRequest, jsonerror.BadJSON("domain not valid")
 	}
 
@@ -399,8 +481,6 @@ func handleRegistrationFlow(
 	// TODO: Handle loading of previous session parameters from database.
 	// TODO: Handle mapping registrationRequest parameters into session parameters
 
-	// TODO: email / msisdn auth types.
-
 	if cfg.Matrix.RegistrationDisabled && req.Auth.Type != authtypes.LoginTypeSharedSecret {
 		return http.StatusForbidden, &internals.RespMessage{Message: "Registration has been disabled"}
 	}
@@ -443,6 +523,20 @@ func handleRegistrationFlow(
 		return completeRegistration(ctx, cfg, accountDB, deviceDB,
 			req.Username, "", appServiceID, req.InitialDisplayName, idg)
 
+	case authtypes.LoginTypeEmail, authtypes.LoginTypeMSISDN:
+		// Check the validation session the client completed
+		if code, err := validateThreePIDStage(ctx, req, sessionID, cfg, accountDB); err != nil {
+			return code, err
+		}
+		sessions.AddCompletedStage(sessionID, req.Auth.Type)
+
+	case authtypes.LoginTypeRegistrationToken:
+		// The token is used up once the account is created
+		if code, err := validateRegistrationToken(ctx, req.Auth.Token, sessionID, accountDB); err != nil {
+			return code, err
+		}
+		sessions.AddCompletedStage(sessionID, authtypes.LoginTypeRegistrationToken)
+
 	case authtypes.LoginTypeDummy:
 		// there is nothing to do
 		// Add Dummy to the list of completed registration stages
@@ -474,8 +568,28 @@ func checkAndCompleteFlow(
 ) (int, core.Coder) {
 	if checkFlowCompleted(flow, cfg.Derived.Registration.Flows) {
 		// This flow was completed, registration can continue
-		return completeRegistration(ctx, cfg, accountDB, deviceDB,
+		token := sessions.GetToken(sessionID)
+		if token != "" {
+			ok, err := accountDB.UseRegistrationToken(ctx, token, time.Now().UnixNano()/1000000)
+			if err != nil {
+				return httputil.LogThenErrorCtx(ctx, err)
+			}
+			if !ok {
+				return http.StatusUnauthorized, jsonerror.Forbidden("Invalid registration token")
+			}
+		}
+		code, resp := completeRegistration(ctx, cfg, accountDB, deviceDB,
 			r.Username, r.Password, "", r.InitialDisplayName, idg)
+		if code != http.StatusOK {
+			if token != "" {
+				if err := accountDB.ReleaseRegistrationToken(ctx, token); err != nil {
+					log.Errorf("release registration token error %v", err)
+				}
+			}
+			return code, resp
+		}
+		finishRegistrationSession(ctx, sessionID, resp.(*external.RegisterResponse).UserID, accountDB)
+		return code, resp
 	}
 
 	// There are still more stages to complete.
@@ -484,6 +598,75 @@ func checkAndCompleteFlow(
 		cfg.Derived.Registration.Flows, cfg.Derived.Registration.Params)
 }
 
+// validateThreePIDStage checks the m.login.email.identity or m.login.msisdn
+// stage, the identifier must be validated and not used by another account
+func validateThreePIDStage(
+	ctx context.Context,
+	req *external.PostRegisterRequest,
+	sessionID string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	medium := authtypes.MediumEmail
+	if req.Auth.Type == authtypes.LoginTypeMSISDN {
+		medium = authtypes.MediumMSISDN
+	}
+	creds := req.Auth.ThreePIDCreds
+	if creds.Sid == "" {
+		creds = req.Auth.ThreePIDCredsOld
+	}
+	session, err := threepid.ValidatedSession(ctx, accountDB, cfg, medium, creds.Sid, creds.ClientSecret)
+	if err != nil {
+		return threePIDError(err, http.StatusUnauthorized)
+	}
+	owner, err := accountDB.GetThreePIDUser(ctx, session.Medium, session.Address)
+	if err != nil {
+		return httputil.LogThenErrorCtx(ctx, err)
+	}
+	if owner != "" {
+		return http.StatusBadRequest, jsonerror.ThreePIDInUse("Third party identifier is already in use")
+	}
+	sessions.AddThreePID(sessionID, session)
+	return http.StatusOK, nil
+}
+
+// validateRegistrationToken checks the m.login.registration_token stage, the
+// use is only taken when the registration completes so abandoned sessions
+// don't use up a limited token
+func validateRegistrationToken(
+	ctx context.Context,
+	token string,
+	sessionID string,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	if sessions.GetToken(sessionID) != "" {
+		return http.StatusOK, nil
+	}
+	if token == "" {
+		return http.StatusBadRequest, jsonerror.MissingParam("token is missing")
+	}
+	t, err := accountDB.GetRegistrationToken(ctx, token)
+	if err != nil {
+		return httputil.LogThenErrorCtx(ctx, err)
+	}
+	if t == nil || !t.Valid(time.Now().UnixNano()/1000000) {
+		return http.StatusUnauthorized, jsonerror.Forbidden("Invalid registration token")
+	}
+	sessions.SetToken(sessionID, token)
+	return http.StatusOK, nil
+}
+
+// finishRegistrationSession binds the identifiers validated during the
+// registration to the new account
+func finishRegistrationSession(ctx context.Context, sessionID, userID string, accountDB model.AccountsDatabase) {
+	for _, session := range sessions.GetThreePIDs(sessionID) {
+		if code, _ := bindThreePID(ctx, accountDB, userID, session); code != http.StatusOK {
+			log.Warnf("registration of %s could not bind 3pid %s %s", userID, session.Medium, session.Address)
+		}
+	}
+	sessions.Delete(sessionID)
+}
+
 // LegacyRegister process register requests from the legacy v1 API
 func LegacyRegister(
 	ctx context.Context,
@@ -524,6 +707,10 @@ func LegacyRegister(
 
 		return completeRegistration(ctx, cfg, accountDB, deviceDB, req.Username, req.Password, "", "", idg)
 	case authtypes.LoginTypeDummy:
+		// the legacy API has no stages to check a token or an identifier
+		if cfg.Matrix.RegistrationRequiresToken || len(cfg.Matrix.RegistrationRequires3PID) > 0 {
+			return http.StatusForbidden, jsonerror.Forbidden("Registration requires the r0 API")
+		}
 		// there is nothing to do
 		return completeRegistration(ctx, cfg, accountDB, deviceDB, req.Username, req.Password, "", "", idg)
 	default:
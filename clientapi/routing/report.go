@@ -0,0 +1,145 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/common/uid"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/roomservertypes"
+	"github.com/finogeeks/ligase/model/service/roomserverapi"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+const (
+	reportMinScore     = -100
+	reportMaxScore     = 0
+	reportMaxReasonLen = 4096
+)
+
+// ReportEvent implements POST /rooms/{roomId}/report/{eventId}
+func ReportEvent(
+	ctx context.Context,
+	req *external.PostRoomReportRequest,
+	userID string,
+	cfg config.Dendrite,
+	roomDB model.RoomServerDatabase,
+	rpcCli roomserverapi.RoomserverRPCAPI,
+	idg *uid.UidGenerator,
+) (int, core.Coder) {
+	if req.Score != nil && (*req.Score < reportMinScore || *req.Score > reportMaxScore) {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("score must be between -100 and 0")
+	}
+	if len(req.Reason) > reportMaxReasonLen {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("reason is too long")
+	}
+
+	// members can only report what they can see, the same answer is given
+	// for an unknown event so the reporter can't probe the room
+	notFound := jsonerror.NotFound("Unable to report event: it does not exist or you aren't able to see it.")
+	var stateRes roomserverapi.QueryRoomStateResponse
+	stateReq := roomserverapi.QueryRoomStateRequest{RoomID: req.RoomID}
+	if err := rpcCli.QueryRoomState(ctx, &stateReq, &stateRes); err != nil {
+		return http.StatusNotFound, notFound
+	}
+	if _, ok := stateRes.Join[userID]; !ok {
+		return http.StatusNotFound, notFound
+	}
+	var eventRes roomserverapi.QueryRoomEventByIDResponse
+	eventReq := roomserverapi.QueryRoomEventByIDRequest{EventID: req.EventID, RoomID: req.RoomID}
+	if err := rpcCli.QueryRoomEventByID(ctx, &eventReq, &eventRes); err != nil || eventRes.Event == nil {
+		return http.StatusNotFound, notFound
+	}
+
+	id, err := idg.Next()
+	if err != nil {
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to create report id")
+	}
+	report := &roomservertypes.EventReport{
+		ID:         id,
+		RoomID:     req.RoomID,
+		EventID:    req.EventID,
+		UserID:     userID,
+		Sender:     eventRes.Event.Sender(),
+		Reason:     req.Reason,
+		Score:      req.Score,
+		EventJSON:  eventRes.Event.JSON(),
+		ReceivedTs: time.Now().UnixNano() / 1000000,
+	}
+	if err := roomDB.InsertEventReport(ctx, report); err != nil {
+		log.Errorf("report event %s room %s user %s error %v", req.EventID, req.RoomID, userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to save report")
+	}
+	score := "none"
+	if req.Score != nil {
+		score = strconv.FormatInt(*req.Score, 10)
+	}
+	log.Infof("report %d event %s room %s user %s score %s", id, req.EventID, req.RoomID, userID, score)
+
+	if cfg.EventReport.WebhookURL != "" {
+		go forwardEventReport(&cfg, eventReportInfo(report, true))
+	}
+	return http.StatusOK, nil
+}
+
+func eventReportInfo(report *roomservertypes.EventReport, withEvent bool) external.EventReportInfo {
+	info := external.EventReportInfo{
+		ID:         report.ID,
+		RoomID:     report.RoomID,
+		EventID:    report.EventID,
+		UserID:     report.UserID,
+		Sender:     report.Sender,
+		Reason:     report.Reason,
+		Score:      report.Score,
+		ReceivedTs: report.ReceivedTs,
+		Resolved:   report.Resolved,
+		ResolvedBy: report.ResolvedBy,
+		ResolvedTs: report.ResolvedTs,
+		Note:       report.Note,
+	}
+	if withEvent {
+		info.EventJSON = report.EventJSON
+	}
+	return info
+}
+
+// forwardEventReport posts a new report to the moderation webhook. The report
+// is already queued, a failure is only logged.
+func forwardEventReport(cfg *config.Dendrite, info external.EventReportInfo) {
+	body, err := json.Marshal(info)
+	if err != nil {
+		log.Errorf("forward event report %d marshal error %v", info.ID, err)
+		return
+	}
+	client := &http.Client{Timeout: time.Duration(cfg.EventReport.WebhookTimeout) * time.Millisecond}
+	resp, err := client.Post(cfg.EventReport.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("forward event report %d error %v", info.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Errorf("forward event report %d webhook status %d", info.ID, resp.StatusCode)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/uid"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/model/roomservertypes"
+	"github.com/finogeeks/ligase/model/service/roomserverapi"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+type fakeAccounts struct {
+	model.AccountsDatabase
+	admins map[string]bool
+}
+
+func (f *fakeAccounts) GetAccount(ctx context.Context, userID string) (*authtypes.Account, error) {
+	return &authtypes.Account{UserID: userID, IsAdmin: f.admins[userID]}, nil
+}
+
+// fakeRoomDB keeps the event reports in memory
+type fakeRoomDB struct {
+	model.RoomServerDatabase
+	reports map[int64]*roomservertypes.EventReport
+}
+
+func newFakeRoomDB() *fakeRoomDB {
+	return &fakeRoomDB{reports: map[int64]*roomservertypes.EventReport{}}
+}
+
+func (f *fakeRoomDB) InsertEventReport(ctx context.Context, report *roomservertypes.EventReport) error {
+	r := *report
+	f.reports[r.ID] = &r
+	return nil
+}
+
+func (f *fakeRoomDB) GetEventReport(ctx context.Context, id int64) (*roomservertypes.EventReport, error) {
+	return f.reports[id], nil
+}
+
+func (f *fakeRoomDB) GetEventReports(
+	ctx context.Context, filter *roomservertypes.EventReportFilter, limit, offset int,
+) ([]*roomservertypes.EventReport, int, error) {
+	matched := []*roomservertypes.EventReport{}
+	for _, r := range f.reports {
+		if (filter.RoomID == "" || filter.RoomID == r.RoomID) &&
+			(filter.UserID == "" || filter.UserID == r.UserID) &&
+			(filter.Resolved == nil || *filter.Resolved == r.Resolved) {
+			matched = append(matched, r)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+	total := len(matched)
+	if offset > total {
+		offset = total
+	}
+	matched = matched[offset:]
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched, total, nil
+}
+
+func (f *fakeRoomDB) ResolveEventReport(ctx context.Context, id int64, resolved bool, resolvedBy string, ts int64) (bool, error) {
+	r, ok := f.reports[id]
+	if !ok {
+		return false, nil
+	}
+	r.Resolved, r.ResolvedBy, r.ResolvedTs = resolved, resolvedBy, ts
+	return true, nil
+}
+
+func (f *fakeRoomDB) SetEventReportNote(ctx context.Context, id int64, note string) (bool, error) {
+	r, ok := f.reports[id]
+	if !ok {
+		return false, nil
+	}
+	r.Note = note
+	return true, nil
+}
+
+// fakeRoomserver answers for one room with its joined members and events
+type fakeRoomserver struct {
+	roomserverapi.RoomserverRPCAPI
+	roomID  string
+	members []string
+	events  map[string]*gomatrixserverlib.Event
+}
+
+func (f *fakeRoomserver) QueryRoomState(
+	ctx context.Context, req *roomserverapi.QueryRoomStateRequest, resp *roomserverapi.QueryRoomStateResponse,
+) error {
+	if req.RoomID != f.roomID {
+		return errors.New("room not found")
+	}
+	resp.RoomID = f.roomID
+	resp.RoomExists = true
+	resp.Join = map[string]*gomatrixserverlib.Event{}
+	for _, m := range f.members {
+		resp.Join[m] = nil
+	}
+	return nil
+}
+
+func (f *fakeRoomserver) QueryRoomEventByID(
+	ctx context.Context, req *roomserverapi.QueryRoomEventByIDRequest, resp *roomserverapi.QueryRoomEventByIDResponse,
+) error {
+	if req.RoomID != f.roomID {
+		return errors.New("room not found")
+	}
+	resp.EventID, resp.RoomID = req.EventID, req.RoomID
+	resp.Event = f.events[req.EventID]
+	return nil
+}
+
+func newReportTest(t *testing.T) (*fakeRoomserver, *fakeRoomDB, *uid.UidGenerator) {
+	ev, err := gomatrixserverlib.NewEventFromTrustedJSON([]byte(`{"event_id":"$spam:test","room_id":"!room:test",`+
+		`"sender":"@spammer:test","type":"m.room.message","origin_server_ts":1,"content":{"body":"buy now"}}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &fakeRoomserver{
+		roomID:  "!room:test",
+		members: []string{"@alice:test", "@spammer:test"},
+		events:  map[string]*gomatrixserverlib.Event{"$spam:test": &ev},
+	}
+	idg, _ := uid.NewDefaultIdGenerator(0)
+	return rs, newFakeRoomDB(), idg
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestReportEventValidation(t *testing.T) {
+	rs, db, idg := newReportTest(t)
+	cases := []external.PostRoomReportRequest{
+		{RoomID: "!room:test", EventID: "$spam:test", Score: int64Ptr(1)},
+		{RoomID: "!room:test", EventID: "$spam:test", Score: int64Ptr(-101)},
+		{RoomID: "!room:test", EventID: "$spam:test", Reason: strings.Repeat("x", reportMaxReasonLen+1)},
+	}
+	for i := range cases {
+		if code, _ := ReportEvent(context.Background(), &cases[i], "@alice:test", config.Dendrite{}, db, rs, idg); code != http.StatusBadRequest {
+			t.Errorf("case %d: got %d, want 400", i, code)
+		}
+	}
+	if len(db.reports) != 0 {
+		t.Fatalf("invalid reports were saved: %d", len(db.reports))
+	}
+}
+
+func TestReportEventNotVisible(t *testing.T) {
+	rs, db, idg := newReportTest(t)
+	cases := []struct {
+		user string
+		req  external.PostRoomReportRequest
+	}{
+		// not in the room
+		{"@mallory:test", external.PostRoomReportRequest{RoomID: "!room:test", EventID: "$spam:test"}},
+		// unknown event, same answer
+		{"@alice:test", external.PostRoomReportRequest{RoomID: "!room:test", EventID: "$missing:test"}},
+		// unknown room
+		{"@alice:test", external.PostRoomReportRequest{RoomID: "!other:test", EventID: "$spam:test"}},
+	}
+	for i, c := range cases {
+		if code, _ := ReportEvent(context.Background(), &c.req, c.user, config.Dendrite{}, db, rs, idg); code != http.StatusNotFound {
+			t.Errorf("case %d: got %d, want 404", i, code)
+		}
+	}
+	if len(db.reports) != 0 {
+		t.Fatalf("reports were saved: %d", len(db.reports))
+	}
+}
+
+func TestReportEventQueued(t *testing.T) {
+	rs, db, idg := newReportTest(t)
+	req := &external.PostRoomReportRequest{RoomID: "!room:test", EventID: "$spam:test", Score: int64Ptr(-100), Reason: "spam"}
+	if code, resp := ReportEvent(context.Background(), req, "@alice:test", config.Dendrite{}, db, rs, idg); code != http.StatusOK {
+		t.Fatalf("got %d %v", code, resp)
+	}
+	if len(db.reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(db.reports))
+	}
+	for _, r := range db.reports {
+		if r.UserID != "@alice:test" || r.Sender != "@spammer:test" || r.Reason != "spam" || *r.Score != -100 {
+			t.Fatalf("unexpected report %+v", r)
+		}
+		if !strings.Contains(string(r.EventJSON), "buy now") {
+			t.Fatalf("the reported event is not kept: %s", r.EventJSON)
+		}
+	}
+}
+
+func TestAdminEventReportQueue(t *testing.T) {
+	rs, db, idg := newReportTest(t)
+	ctx := context.Background()
+	cfg := config.Dendrite{}
+	accounts := &fakeAccounts{admins: map[string]bool{"@admin:test": true}}
+	for _, reason := range []string{"spam", "abuse", "scam"} {
+		req := &external.PostRoomReportRequest{RoomID: "!room:test", EventID: "$spam:test", Reason: reason}
+		if code, _ := ReportEvent(ctx, req, "@alice:test", cfg, db, rs, idg); code != http.StatusOK {
+			t.Fatalf("report %s: got %d", reason, code)
+		}
+	}
+
+	if code, _ := GetAdminEventReports(ctx, &external.GetAdminEventReportsRequest{}, "@alice:test", cfg, accounts, db); code != http.StatusForbidden {
+		t.Fatalf("non admin listed reports: %d", code)
+	}
+	if code, _ := GetAdminEventReports(ctx, &external.GetAdminEventReportsRequest{Resolved: "maybe"}, "@admin:test", cfg, accounts, db); code != http.StatusBadRequest {
+		t.Fatalf("bad resolved filter: got %d", code)
+	}
+
+	code, resp := GetAdminEventReports(ctx, &external.GetAdminEventReportsRequest{Limit: 2}, "@admin:test", cfg, accounts, db)
+	if code != http.StatusOK {
+		t.Fatalf("list: got %d", code)
+	}
+	page := resp.(*external.GetAdminEventReportsResponse)
+	if page.Total != 3 || len(page.EventReports) != 2 || page.NextToken != "2" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	if page.EventReports[0].EventJSON != nil {
+		t.Fatal("the list must not carry the event content")
+	}
+	first := page.EventReports[0].ID
+
+	resolve := &external.PostAdminEventReportResolveRequest{ReportID: first}
+	if code, _ := AdminEventReportResolve(ctx, resolve, "@admin:test", cfg, accounts, db); code != http.StatusOK {
+		t.Fatalf("resolve: got %d", code)
+	}
+	_, resp = GetAdminEventReports(ctx, &external.GetAdminEventReportsRequest{Resolved: "false"}, "@admin:test", cfg, accounts, db)
+	if open := resp.(*external.GetAdminEventReportsResponse); open.Total != 2 {
+		t.Fatalf("got %d open reports, want 2", open.Total)
+	}
+
+	note := &external.PutAdminEventReportNoteRequest{ReportID: first, Note: "banned the sender"}
+	if code, _ := PutAdminEventReportNote(ctx, note, "@admin:test", cfg, accounts, db); code != http.StatusOK {
+		t.Fatalf("note: got %d", code)
+	}
+	code, resp = GetAdminEventReport(ctx, &external.AdminEventReportRequest{ReportID: first}, "@admin:test", cfg, accounts, db)
+	if code != http.StatusOK {
+		t.Fatalf("get: got %d", code)
+	}
+	info := resp.(*external.EventReportInfo)
+	if !info.Resolved || info.ResolvedBy != "@admin:test" || info.Note != "banned the sender" || info.EventJSON == nil {
+		t.Fatalf("unexpected report %+v", info)
+	}
+
+	// reopening clears who resolved it
+	reopen := false
+	resolve.Resolved = &reopen
+	AdminEventReportResolve(ctx, resolve, "@admin:test", cfg, accounts, db)
+	if r := db.reports[first]; r.Resolved || r.ResolvedBy != "" || r.ResolvedTs != 0 {
+		t.Fatalf("reopened report %+v", r)
+	}
+
+	missing := int64(-1)
+	if code, _ := GetAdminEventReport(ctx, &external.AdminEventReportRequest{ReportID: missing}, "@admin:test", cfg, accounts, db); code != http.StatusNotFound {
+		t.Fatalf("get missing: got %d", code)
+	}
+	if code, _ := AdminEventReportResolve(ctx, &external.PostAdminEventReportResolveRequest{ReportID: missing}, "@admin:test", cfg, accounts, db); code != http.StatusNotFound {
+		t.Fatalf("resolve missing: got %d", code)
+	}
+}
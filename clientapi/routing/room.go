@@ -27,8 +27,10 @@ import (
 
 	"github.com/finogeeks/ligase/clientapi/httputil"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/jsonerror"
 	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
 	"github.com/finogeeks/ligase/model/service"
 	"github.com/finogeeks/ligase/model/service/roomserverapi"
 	"github.com/finogeeks/ligase/plugins/message/external"
@@ -208,7 +210,21 @@ func DismissRoom(
 	cache service.Cache,
 	idg *uid.UidGenerator,
 	complexCache *common.ComplexCache,
-) (int, core.Coder) {
+) (code int, resp core.Coder) {
+	defer func() {
+		ev := &authtypes.AuditEvent{
+			Type:     authtypes.AuditRoomDismiss,
+			UserID:   ownerID,
+			DeviceID: deviceID,
+			RoomID:   roomID,
+			Success:  code == http.StatusOK,
+		}
+		if e, ok := resp.(*jsonerror.MatrixError); ok {
+			ev.Details = map[string]string{"error": e.Err}
+		}
+		audit.Emit(ctx, ev)
+	}()
+
 	var queryRes roomserverapi.QueryRoomStateResponse
 	var queryReq roomserverapi.QueryRoomStateRequest
 	queryReq.RoomID = roomID
@@ -0,0 +1,259 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/finogeeks/ligase/clientapi/sso"
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+const (
+	casTicketPath = "/_matrix/client/r0/login/cas/ticket"
+	samlACSPath   = "/_matrix/client/r0/login/saml2/authn_response"
+	maxUserIDLen  = 255
+)
+
+var (
+	samlOnce sync.Once
+	samlSP   *sso.SAMLServiceProvider
+	samlErr  error
+)
+
+func samlServiceProvider(cfg *config.Dendrite, cache service.Cache) (*sso.SAMLServiceProvider, error) {
+	samlOnce.Do(func() {
+		cert, err := sso.LoadCertificate(cfg.SSO.SAML.IdPCertificate)
+		if err != nil {
+			samlErr = fmt.Errorf("failed to load the identity provider certificate: %v", err)
+			return
+		}
+		samlSP = &sso.SAMLServiceProvider{
+			EntityID:    cfg.SSO.SAML.SPEntityID,
+			ACSURL:      strings.TrimRight(cfg.SSO.PublicBaseURL, "/") + samlACSPath,
+			IdPSSOURL:   cfg.SSO.SAML.IdPSSOURL,
+			IdPEntityID: cfg.SSO.SAML.IdPEntityID,
+			IdPCert:     cert,
+			Store:       cache,
+		}
+	})
+	return samlSP, samlErr
+}
+
+func casClient(cfg *config.Dendrite) *sso.CASClient {
+	return sso.NewCASClient(cfg.SSO.CAS.ServerURL, cfg.SSO.CAS.RequiredAttributes)
+}
+
+// casService is the url the CAS server sends the browser back to, tickets
+// are validated against the same url
+func casService(cfg *config.Dendrite, redirectURL string) string {
+	return strings.TrimRight(cfg.SSO.PublicBaseURL, "/") + casTicketPath + "?" +
+		url.Values{"redirectUrl": {redirectURL}}.Encode()
+}
+
+// SSORedirect implements GET /login/sso/redirect and /login/cas/redirect
+func SSORedirect(ctx context.Context, redirectURL string, cfg *config.Dendrite, cache service.Cache) (int, core.Coder) {
+	if cfg.SSO.Provider == "" {
+		return http.StatusNotFound, jsonerror.NotFound("Single sign-on is not enabled")
+	}
+	if !sso.ClientRedirectAllowed(cfg.SSO.ClientWhitelist, redirectURL) {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("redirectUrl is not allowed")
+	}
+
+	var location string
+	switch cfg.SSO.Provider {
+	case sso.ProviderCAS:
+		location = casClient(cfg).LoginURL(casService(cfg, redirectURL))
+	case sso.ProviderSAML:
+		sp, err := samlServiceProvider(cfg, cache)
+		if err != nil {
+			log.Errorf("SSORedirect %v", err)
+			return http.StatusInternalServerError, jsonerror.Unknown("Single sign-on is misconfigured")
+		}
+		location, err = sp.AuthnRequestURL(redirectURL)
+		if err != nil {
+			return http.StatusInternalServerError, jsonerror.Unknown("Failed to build the authentication request")
+		}
+	}
+	return http.StatusFound, &external.SSORedirectResponse{Location: location}
+}
+
+// CASTicket implements GET /login/cas/ticket
+func CASTicket(
+	ctx context.Context,
+	req *external.GetCasLoginTickerRequest,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if cfg.SSO.Provider != sso.ProviderCAS {
+		return http.StatusNotFound, jsonerror.NotFound("CAS login is not enabled")
+	}
+	if !sso.ClientRedirectAllowed(cfg.SSO.ClientWhitelist, req.RedirectURL) {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("redirectUrl is not allowed")
+	}
+	id, err := casClient(cfg).ValidateTicket(ctx, req.Ticket, casService(cfg, req.RedirectURL))
+	if err != nil {
+		log.Warnf("CASTicket validate ticket err:%v", err)
+		return http.StatusForbidden, jsonerror.Forbidden("CAS ticket is invalid")
+	}
+	return completeSSO(ctx, id, req.RedirectURL, cfg, accountDB, cache)
+}
+
+// SAMLAuthnResponse implements POST /login/saml2/authn_response, the
+// assertion consumer service the identity provider posts to
+func SAMLAuthnResponse(
+	ctx context.Context,
+	req *external.PostSAMLAuthnResponseRequest,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	if cfg.SSO.Provider != sso.ProviderSAML {
+		return http.StatusNotFound, jsonerror.NotFound("SAML login is not enabled")
+	}
+	if !sso.ClientRedirectAllowed(cfg.SSO.ClientWhitelist, req.RelayState) {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("RelayState is not an allowed redirectUrl")
+	}
+	sp, err := samlServiceProvider(cfg, cache)
+	if err != nil {
+		log.Errorf("SAMLAuthnResponse %v", err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Single sign-on is misconfigured")
+	}
+	id, err := sp.ParseResponse(req.SAMLResponse)
+	if err != nil {
+		log.Warnf("SAMLAuthnResponse parse response err:%v", err)
+		return http.StatusForbidden, jsonerror.Forbidden("SAML response is invalid")
+	}
+	return completeSSO(ctx, id, req.RelayState, cfg, accountDB, cache)
+}
+
+// ssoIdP names the identity provider the subjects of the identities belong to
+func ssoIdP(cfg *config.Dendrite) string {
+	if cfg.SSO.Provider == sso.ProviderCAS {
+		return cfg.SSO.CAS.ServerURL
+	}
+	if cfg.SSO.SAML.IdPEntityID != "" {
+		return cfg.SSO.SAML.IdPEntityID
+	}
+	return cfg.SSO.SAML.IdPSSOURL
+}
+
+// completeSSO logs the identity into the account linked to it, or creates
+// and links the account of a new user, and sends the browser back to the
+// client with a m.login.token. An existing account is never taken over
+// because an identity maps to its user id, it has to be linked by an
+// operator first.
+func completeSSO(
+	ctx context.Context,
+	id *sso.Identity,
+	redirectURL string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+	cache service.Cache,
+) (int, core.Coder) {
+	idp := ssoIdP(cfg)
+	if id.Subject == "" {
+		return http.StatusForbidden, jsonerror.Forbidden("Identity has no subject")
+	}
+	userID, err := accountDB.GetSSOIdentityUser(ctx, idp, id.Subject)
+	if err != nil {
+		log.Errorf("completeSSO get sso identity idp:%s subject:%s err:%v", idp, id.Subject, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to get sso identity: " + err.Error())
+	}
+	linked := userID != ""
+	if !linked {
+		localpart, err := id.Localpart(cfg.SSO.LocalpartAttribute)
+		if err != nil {
+			log.Warnf("completeSSO map localpart err:%v", err)
+			return http.StatusForbidden, jsonerror.Forbidden("Unable to map the identity to a user")
+		}
+		userID = fmt.Sprintf("@%s:%s", localpart, cfg.Matrix.ServerName[0])
+		if len(userID) > maxUserIDLen {
+			return http.StatusForbidden, jsonerror.InvalidUsername("User ID is too long")
+		}
+	}
+	if exclusive := config.GetReloadable().ExclusiveApplicationServicesUsernameRegexp; exclusive != nil &&
+		exclusive.MatchString(userID) {
+		return http.StatusForbidden, jsonerror.ASExclusive("User ID is reserved by an application service")
+	}
+
+	// single sign-on accounts are counted against the licensed users like
+	// accounts logging in on a real device
+	account, allow, err := checkCreateAccount(*cfg, accountDB, userID, authtypes.LoginTypeSSO)
+	if err != nil {
+		return http.StatusInternalServerError, jsonerror.Unknown("failed to check create account: " + err.Error())
+	}
+	if !linked && account != nil {
+		log.Warnf("completeSSO identity idp:%s subject:%s maps to the existing account %s which is not linked to it", idp, id.Subject, userID)
+		return http.StatusForbidden, jsonerror.Forbidden("The account exists and is not linked to this identity")
+	}
+	if !allow {
+		return http.StatusForbidden, jsonerror.Unknown(fmt.Sprintf("account has to max count: %d", cfg.LicenseItem.TotalUsers))
+	}
+	if account != nil && account.Locked {
+		return http.StatusForbidden, jsonerror.UserLocked("This account has been locked")
+	}
+	if account == nil {
+		if linked {
+			log.Warnf("completeSSO account %s linked to idp:%s subject:%s does not exist", userID, idp, id.Subject)
+			return http.StatusForbidden, jsonerror.Forbidden("The linked account does not exist")
+		}
+		displayName := ""
+		if cfg.SSO.DisplayNameAttribute != "" {
+			displayName = id.Attribute(cfg.SSO.DisplayNameAttribute)
+		}
+		if _, err := accountDB.CreateAccountWithCheck(ctx, nil, userID, "", "actual", displayName); err != nil {
+			return http.StatusInternalServerError, jsonerror.Unknown("failed to create account: " + err.Error())
+		}
+		// a concurrent login may have linked the subject meanwhile, only
+		// the first link counts
+		ok, err := accountDB.InsertSSOIdentity(ctx, idp, id.Subject, userID)
+		if err != nil {
+			return http.StatusInternalServerError, jsonerror.Unknown("failed to link sso identity: " + err.Error())
+		}
+		if !ok {
+			return http.StatusConflict, jsonerror.Unknown("The identity was linked concurrently, try again")
+		}
+		log.Infof("sso created account %s for idp:%s subject:%s", userID, idp, id.Subject)
+	}
+
+	token, err := common.BuildRandomURLEncString()
+	if err != nil {
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to generate login token")
+	}
+	if err := cache.SetLoginToken(token, userID, cfg.SSO.LoginTokenLifetime); err != nil {
+		log.Errorf("completeSSO store login token user:%s err:%v", userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to store login token")
+	}
+	location, err := sso.WithLoginToken(redirectURL, token)
+	if err != nil {
+		return http.StatusBadRequest, jsonerror.InvalidArgumentValue("redirectUrl is invalid")
+	}
+	return http.StatusFound, &external.SSORedirectResponse{Location: location}
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/finogeeks/ligase/appservice/query"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/plugins/message/external"
+)
+
+// GetThirdPartyProtocols implements GET /thirdparty/protocols
+func GetThirdPartyProtocols(ctx context.Context, cfg *config.Dendrite) (int, core.Coder) {
+	res := query.GetProtocols(ctx, cfg)
+	return http.StatusOK, &res
+}
+
+// GetThirdPartyProtocol implements GET /thirdparty/protocol/{protocol}
+func GetThirdPartyProtocol(
+	ctx context.Context, req *external.GetThirdPartyProtocalByNameRequest, cfg *config.Dendrite,
+) (int, core.Coder) {
+	p, ok := query.GetProtocol(ctx, cfg, req.Protocol)
+	if !ok {
+		return http.StatusNotFound, jsonerror.NotFound("The protocol is unknown")
+	}
+	res := external.GetThirdPartyProtocalByNameResponse(*p)
+	return http.StatusOK, &res
+}
+
+// GetThirdPartyLocationsByProtocol implements GET /thirdparty/location/{protocol}
+func GetThirdPartyLocationsByProtocol(
+	ctx context.Context, req *external.GetThirdPartyLocationByProtocolRequest, cfg *config.Dendrite,
+) (int, core.Coder) {
+	if !handlesProtocol(cfg, req.Protocol) {
+		return http.StatusNotFound, jsonerror.NotFound("The protocol is unknown")
+	}
+	res := external.GetThirdPartyLocationByProtocolResponse(query.QueryLocations(ctx, cfg, req.Protocol, req.Fields))
+	return http.StatusOK, &res
+}
+
+// GetThirdPartyUsersByProtocol implements GET /thirdparty/user/{protocol}
+func GetThirdPartyUsersByProtocol(
+	ctx context.Context, req *external.GetThirdPartyUserByProtocolRequest, cfg *config.Dendrite,
+) (int, core.Coder) {
+	if !handlesProtocol(cfg, req.Protocol) {
+		return http.StatusNotFound, jsonerror.NotFound("The protocol is unknown")
+	}
+	res := external.GetThirdPartyUserByProtocolResponse(query.QueryUsers(ctx, cfg, req.Protocol, req.Fields))
+	return http.StatusOK, &res
+}
+
+// GetThirdPartyLocationsByAlias implements GET /thirdparty/location
+func GetThirdPartyLocationsByAlias(
+	ctx context.Context, req *external.GetThirdPartyLocationRequest, cfg *config.Dendrite,
+) (int, core.Coder) {
+	if req.Alias == "" {
+		return http.StatusBadRequest, jsonerror.MissingArgument("alias is required")
+	}
+	res := external.GetThirdPartyLocationResponse(query.LocationsByAlias(ctx, cfg, req.Alias))
+	return http.StatusOK, &res
+}
+
+// GetThirdPartyUsersByID implements GET /thirdparty/user
+func GetThirdPartyUsersByID(
+	ctx context.Context, req *external.GetThirdPartyUserRequest, cfg *config.Dendrite,
+) (int, core.Coder) {
+	if req.UserID == "" {
+		return http.StatusBadRequest, jsonerror.MissingArgument("userid is required")
+	}
+	res := external.GetThirdPartyUserResponse(query.UsersByID(ctx, cfg, req.UserID))
+	return http.StatusOK, &res
+}
+
+func handlesProtocol(cfg *config.Dendrite, protocol string) bool {
+	for _, p := range query.Protocols(cfg) {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
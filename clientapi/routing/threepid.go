@@ -18,30 +18,231 @@
 package routing
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/finogeeks/ligase/clientapi/sso"
+	"github.com/finogeeks/ligase/clientapi/threepid"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
 	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
 	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
 )
 
 // RequestEmailToken implements:
 //     POST /account/3pid/email/requestToken
 //     POST /register/email/requestToken
-func RequestEmailToken() (int, core.Coder) {
-	return http.StatusOK, &external.PostAccount3PIDEmailResponse{}
+func RequestEmailToken(
+	ctx context.Context,
+	req *external.PostAccount3PIDEmailRequest,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	address, err := threepid.NormalizeEmail(req.Email)
+	if err != nil {
+		return http.StatusBadRequest, jsonerror.InvalidParam("Invalid email address")
+	}
+	sendAttempt, err := strconv.Atoi(req.SendAttempt)
+	if err != nil {
+		return http.StatusBadRequest, jsonerror.InvalidParam("send_attempt must be an integer")
+	}
+	sid, code, resp := requestThreePIDToken(ctx, cfg, accountDB, &threepid.TokenRequest{
+		Medium:       authtypes.MediumEmail,
+		Address:      address,
+		ClientSecret: req.ClientSecret,
+		SendAttempt:  sendAttempt,
+		NextLink:     req.NextLink,
+		Path:         req.Path,
+	})
+	if resp != nil {
+		return code, resp
+	}
+	return http.StatusOK, &external.PostAccount3PIDEmailResponse{Sid: sid}
+}
+
+// RequestMSISDNToken implements:
+//     POST /account/3pid/msisdn/requestToken
+//     POST /register/msisdn/requestToken
+func RequestMSISDNToken(
+	ctx context.Context,
+	req *external.PostAccount3PIDMsisdnRequest,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	address, err := threepid.NormalizeMSISDN(req.Country, req.PhoneNumber)
+	if err != nil {
+		return http.StatusBadRequest, jsonerror.InvalidParam("Invalid phone number")
+	}
+	sendAttempt, err := strconv.Atoi(req.SendAttempt)
+	if err != nil {
+		return http.StatusBadRequest, jsonerror.InvalidParam("send_attempt must be an integer")
+	}
+	sid, code, resp := requestThreePIDToken(ctx, cfg, accountDB, &threepid.TokenRequest{
+		Medium:       authtypes.MediumMSISDN,
+		Address:      address,
+		ClientSecret: req.ClientSecret,
+		SendAttempt:  sendAttempt,
+		NextLink:     req.NextLink,
+		Path:         req.Path,
+	})
+	if resp != nil {
+		return code, resp
+	}
+	return http.StatusOK, &external.PostAccount3PIDMsisdnResponse{
+		Sid:       sid,
+		SubmitURL: strings.TrimRight(cfg.ThreePID.PublicBaseURL, "/") + "/_matrix/client/r0/" + req.Path + "/msisdn/submitToken",
+	}
+}
+
+func requestThreePIDToken(
+	ctx context.Context,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+	req *threepid.TokenRequest,
+) (string, int, core.Coder) {
+	// registering needs an unused identifier, adding one to an account too
+	owner, err := accountDB.GetThreePIDUser(ctx, req.Medium, req.Address)
+	if err != nil {
+		log.Errorf("get owner of 3pid %s %s error %v", req.Medium, req.Address, err)
+		return "", http.StatusInternalServerError, jsonerror.Unknown("Failed to check third party identifier")
+	}
+	if owner != "" {
+		return "", http.StatusBadRequest, jsonerror.ThreePIDInUse("Third party identifier is already in use")
+	}
+	sid, err := threepid.RequestToken(ctx, accountDB, cfg, req)
+	if err != nil {
+		code, resp := threePIDError(err, http.StatusBadRequest)
+		return "", code, resp
+	}
+	return sid, 0, nil
+}
+
+// SubmitThreePIDToken implements:
+//     GET|POST /account/3pid/{medium}/submitToken
+//     GET|POST /register/{medium}/submitToken
+func SubmitThreePIDToken(
+	ctx context.Context,
+	req *external.Post3PIDSubmitTokenRequest,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	session, err := threepid.SubmitToken(ctx, accountDB, cfg, req.Sid, req.ClientSecret, req.Token)
+	if err != nil {
+		return threePIDError(err, http.StatusBadRequest)
+	}
+	if session.Medium != req.Medium {
+		return http.StatusBadRequest, jsonerror.ThreePIDAuthFailed(threepid.ErrSessionNotFound.Error())
+	}
+	if req.Redirect && session.NextLink != "" && sso.ClientRedirectAllowed(nil, session.NextLink) {
+		return http.StatusFound, &external.SSORedirectResponse{Location: session.NextLink}
+	}
+	return http.StatusOK, &external.Post3PIDSubmitTokenResponse{Success: true}
 }
 
 // CheckAndSave3PIDAssociation implements POST /account/3pid
-func CheckAndSave3PIDAssociation() (int, core.Coder) {
+func CheckAndSave3PIDAssociation(
+	ctx context.Context,
+	req *external.PostAccount3PIDRequest,
+	userID string,
+	cfg *config.Dendrite,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	creds := req.ThreePIDCreds
+	if creds.Sid == "" {
+		creds = req.ThreePIDCredsOld
+	}
+	session, err := threepid.ValidatedSession(ctx, accountDB, cfg, "", creds.Sid, creds.ClientSecret)
+	if err != nil {
+		return threePIDError(err, http.StatusBadRequest)
+	}
+	return bindThreePID(ctx, accountDB, userID, session)
+}
+
+// bindThreePID adds the identifier validated in session to the account
+func bindThreePID(
+	ctx context.Context, accountDB model.AccountsDatabase, userID string, session *authtypes.ThreePIDSession,
+) (int, core.Coder) {
+	inserted, err := accountDB.InsertThreePID(ctx, &authtypes.ThreePID{
+		Medium:      session.Medium,
+		Address:     session.Address,
+		UserID:      userID,
+		ValidatedTs: session.ValidatedTs,
+		AddedTs:     time.Now().UnixNano() / 1000000,
+	})
+	if err != nil {
+		log.Errorf("bind 3pid %s %s to %s error %v", session.Medium, session.Address, userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to add third party identifier")
+	}
+	if !inserted {
+		owner, err := accountDB.GetThreePIDUser(ctx, session.Medium, session.Address)
+		if err != nil || owner != userID {
+			return http.StatusBadRequest, jsonerror.ThreePIDInUse("Third party identifier is already in use")
+		}
+	}
+	log.Infof("bound 3pid %s %s to %s", session.Medium, session.Address, userID)
 	return http.StatusOK, nil
 }
 
 // GetAssociated3PIDs implements GET /account/3pid
-func GetAssociated3PIDs() (int, core.Coder) {
-	return http.StatusOK, &external.GetThreePIDsResponse{[]external.ThreePID{}}
+func GetAssociated3PIDs(
+	ctx context.Context,
+	userID string,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	threepids, err := accountDB.GetThreePIDsByUser(ctx, userID)
+	if err != nil {
+		log.Errorf("get 3pids of %s error %v", userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to get third party identifiers")
+	}
+	resp := &external.GetThreePIDsResponse{ThreePIDs: []external.ThreePID{}}
+	for _, t := range threepids {
+		resp.ThreePIDs = append(resp.ThreePIDs, external.ThreePID{
+			Medium:      t.Medium,
+			Address:     t.Address,
+			ValidatedAt: t.ValidatedTs,
+			AddedAt:     t.AddedTs,
+		})
+	}
+	return http.StatusOK, resp
 }
 
 // Forget3PID implements POST /account/3pid/delete
-func Forget3PID() (int, core.Coder) {
+func Forget3PID(
+	ctx context.Context,
+	req *external.PostAccount3PIDDelRequest,
+	userID string,
+	accountDB model.AccountsDatabase,
+) (int, core.Coder) {
+	deleted, err := accountDB.DeleteThreePID(ctx, userID, req.Medium, req.Address)
+	if err != nil {
+		log.Errorf("delete 3pid %s %s of %s error %v", req.Medium, req.Address, userID, err)
+		return http.StatusInternalServerError, jsonerror.Unknown("Failed to delete third party identifier")
+	}
+	if !deleted {
+		return http.StatusNotFound, jsonerror.ThreePIDNotFound("Third party identifier is not bound to this account")
+	}
+	log.Infof("unbound 3pid %s %s from %s", req.Medium, req.Address, userID)
 	return http.StatusOK, nil
 }
+
+// threePIDError maps the validation errors, sessions that cannot be used
+// are reported with authCode
+func threePIDError(err error, authCode int) (int, core.Coder) {
+	switch err {
+	case threepid.ErrMediumDisabled:
+		return http.StatusBadRequest, jsonerror.ThreePIDMediumNotSupported(err.Error())
+	case threepid.ErrInvalidAddress, threepid.ErrInvalidSecret:
+		return http.StatusBadRequest, jsonerror.InvalidParam(err.Error())
+	case threepid.ErrSessionNotFound, threepid.ErrSessionExpired,
+		threepid.ErrTokenIncorrect, threepid.ErrSessionNotActive:
+		return authCode, jsonerror.ThreePIDAuthFailed(err.Error())
+	}
+	log.Errorf("3pid validation error %v", err)
+	return http.StatusInternalServerError, jsonerror.Unknown("Failed to validate third party identifier")
+}
@@ -63,7 +63,7 @@ func GetUserInfo(
 
 	if user_info == nil || user_info.UserID == "" {
 		domain, _ := utils.DomainFromID(userID)
-		if !common.CheckValidDomain(domain, cfg.Matrix.ServerName) {
+		if !common.IsLocalDomain(domain) {
 			resp, err := federation.LookupUserInfo(domain, userID)
 			if err != nil {
 				log.Errorf("get user_info from federation error %v", err)
@@ -34,8 +34,8 @@ import (
 
 // RequestTurnServer implements:
 //     GET /voip/turnServer
-func RequestTurnServer(ctx context.Context, userID string, cfg config.Dendrite) (int, core.Coder) {
-	turnConfig := cfg.TURN
+func RequestTurnServer(ctx context.Context, userID string) (int, core.Coder) {
+	turnConfig := config.GetReloadable().TURN
 
 	// TODO Guest Support
 	if len(turnConfig.URIs) == 0 || turnConfig.UserLifetime == "" {
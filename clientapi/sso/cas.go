@@ -0,0 +1,129 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sso
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const casTimeout = time.Second * 10
+
+// CASClient validates service tickets with the CAS 2.0 protocol, attributes
+// are read from the CAS 3.0 cas:attributes extension
+type CASClient struct {
+	serverURL  string
+	required   map[string]string
+	httpClient *http.Client
+}
+
+func NewCASClient(serverURL string, required map[string]string) *CASClient {
+	return &CASClient{
+		serverURL:  strings.TrimRight(serverURL, "/"),
+		required:   required,
+		httpClient: &http.Client{Timeout: casTimeout},
+	}
+}
+
+// LoginURL returns the CAS login page which sends the browser back to
+// service with a ticket
+func (c *CASClient) LoginURL(service string) string {
+	return c.serverURL + "/login?" + url.Values{"service": {service}}.Encode()
+}
+
+type casServiceResponse struct {
+	Success *struct {
+		User       string `xml:"user"`
+		Attributes struct {
+			Values []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"attributes"`
+	} `xml:"authenticationSuccess"`
+	Failure *struct {
+		Code    string `xml:"code,attr"`
+		Message string `xml:",chardata"`
+	} `xml:"authenticationFailure"`
+}
+
+// ValidateTicket asks the CAS server who the ticket was issued to. service
+// must be the url the ticket was issued for.
+func (c *CASClient) ValidateTicket(ctx context.Context, ticket, service string) (*Identity, error) {
+	if ticket == "" {
+		return nil, fmt.Errorf("missing ticket")
+	}
+	address := c.serverURL + "/serviceValidate?" + url.Values{
+		"ticket":  {ticket},
+		"service": {service},
+	}.Encode()
+	req, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cas server returned status %d", resp.StatusCode)
+	}
+
+	var res casServiceResponse
+	if err := xml.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("invalid cas response: %v", err)
+	}
+	if res.Failure != nil {
+		return nil, fmt.Errorf("cas rejected the ticket: %s %s", res.Failure.Code, strings.TrimSpace(res.Failure.Message))
+	}
+	if res.Success == nil || strings.TrimSpace(res.Success.User) == "" {
+		return nil, fmt.Errorf("cas response has no user")
+	}
+
+	id := &Identity{
+		Subject:    strings.TrimSpace(res.Success.User),
+		Attributes: make(map[string][]string),
+	}
+	for _, v := range res.Success.Attributes.Values {
+		name := v.XMLName.Local
+		id.Attributes[name] = append(id.Attributes[name], strings.TrimSpace(v.Value))
+	}
+	for name, value := range c.required {
+		if !contains(id.Attributes[name], value) {
+			return nil, fmt.Errorf("cas user %s lacks the required attribute %s", id.Subject, name)
+		}
+	}
+	return id, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// FakeIdP is an in-process identity provider speaking CAS under /cas and
+// SAML2 under /saml. Every login succeeds as the user set with SetUser. It
+// is meant for tests and local development.
+type FakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	cert   *x509.Certificate
+
+	mu      sync.Mutex
+	user    string
+	attrs   map[string][]string
+	tickets map[string]string
+}
+
+func NewFakeIdP() (*FakeIdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour * 24 * 365),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &FakeIdP{
+		key:     key,
+		cert:    cert,
+		user:    "alice",
+		attrs:   make(map[string][]string),
+		tickets: make(map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cas/login", p.handleCASLogin)
+	mux.HandleFunc("/cas/serviceValidate", p.handleCASValidate)
+	mux.HandleFunc("/saml/sso", p.handleSAMLLogin)
+	p.server = httptest.NewServer(mux)
+	return p, nil
+}
+
+func (p *FakeIdP) Close() {
+	p.server.Close()
+}
+
+// CASURL returns the base url to configure as the CAS server
+func (p *FakeIdP) CASURL() string {
+	return p.server.URL + "/cas"
+}
+
+// SAMLSSOURL returns the url AuthnRequests are sent to
+func (p *FakeIdP) SAMLSSOURL() string {
+	return p.server.URL + "/saml/sso"
+}
+
+// EntityID returns the issuer of the SAML assertions
+func (p *FakeIdP) EntityID() string {
+	return p.server.URL + "/saml"
+}
+
+// Certificate returns the certificate SAML responses are signed with
+func (p *FakeIdP) Certificate() *x509.Certificate {
+	return p.cert
+}
+
+// SetUser sets who the next logins are for
+func (p *FakeIdP) SetUser(user string, attrs map[string][]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = user
+	p.attrs = attrs
+}
+
+// IssueTicket returns a CAS service ticket for service, like the login page
+// would have after the user signed in
+func (p *FakeIdP) IssueTicket(service string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ticket := "ST-" + randomHex(16)
+	p.tickets[ticket] = service
+	return ticket
+}
+
+func (p *FakeIdP) handleCASLogin(w http.ResponseWriter, req *http.Request) {
+	service := req.URL.Query().Get("service")
+	u, err := url.Parse(service)
+	if err != nil || service == "" {
+		http.Error(w, "invalid service", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	q.Set("ticket", p.IssueTicket(service))
+	u.RawQuery = q.Encode()
+	http.Redirect(w, req, u.String(), http.StatusFound)
+}
+
+func (p *FakeIdP) handleCASValidate(w http.ResponseWriter, req *http.Request) {
+	ticket := req.URL.Query().Get("ticket")
+	service := req.URL.Query().Get("service")
+
+	p.mu.Lock()
+	issued, ok := p.tickets[ticket]
+	delete(p.tickets, ticket)
+	user, attrs := p.user, p.attrs
+	p.mu.Unlock()
+
+	var b bytes.Buffer
+	b.WriteString(`<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">`)
+	if !ok || issued != service {
+		b.WriteString(`<cas:authenticationFailure code="INVALID_TICKET">ticket not recognized</cas:authenticationFailure>`)
+	} else {
+		b.WriteString(`<cas:authenticationSuccess><cas:user>`)
+		xml.EscapeText(&b, []byte(user))
+		b.WriteString(`</cas:user><cas:attributes>`)
+		for _, name := range sortedKeys(attrs) {
+			for _, v := range attrs[name] {
+				b.WriteString(`<cas:` + name + `>`)
+				xml.EscapeText(&b, []byte(v))
+				b.WriteString(`</cas:` + name + `>`)
+			}
+		}
+		b.WriteString(`</cas:attributes></cas:authenticationSuccess>`)
+	}
+	b.WriteString(`</cas:serviceResponse>`)
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write(b.Bytes())
+}
+
+// handleSAMLLogin answers an AuthnRequest with a page posting the signed
+// response to the service provider
+func (p *FakeIdP) handleSAMLLogin(w http.ResponseWriter, req *http.Request) {
+	acs, requestID, issuer, err := readAuthnRequest(req.URL.Query().Get("SAMLRequest"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := p.SAMLResponse(acs, issuer, requestID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<html><body onload="document.forms[0].submit()"><form method="post" action="%s">`+
+		`<input type="hidden" name="SAMLResponse" value="%s"/><input type="hidden" name="RelayState" value="%s"/>`+
+		`</form></body></html>`,
+		html.EscapeString(acs), html.EscapeString(resp), html.EscapeString(req.URL.Query().Get("RelayState")))
+}
+
+func readAuthnRequest(encoded string) (acs, id, issuer string, err error) {
+	deflated, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", "", errors.New("SAMLRequest is not base64")
+	}
+	data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		return "", "", "", errors.New("SAMLRequest is not deflated")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil || doc.Root() == nil || !isElement(doc.Root(), nsSAMLP, "AuthnRequest") {
+		return "", "", "", errors.New("SAMLRequest is not an AuthnRequest")
+	}
+	req := doc.Root()
+	if i := childElement(req, nsSAML, "Issuer"); i != nil {
+		issuer = strings.TrimSpace(i.Text())
+	}
+	return req.SelectAttrValue("AssertionConsumerServiceURL", ""), req.SelectAttrValue("ID", ""), issuer, nil
+}
+
+// SAMLResponse returns a base64 encoded response for the current user whose
+// assertion is signed, like it would be posted to acs
+func (p *FakeIdP) SAMLResponse(acs, audience, inResponseTo string) (string, error) {
+	p.mu.Lock()
+	user, attrs := p.user, p.attrs
+	p.mu.Unlock()
+
+	now := time.Now().UTC()
+	expires := now.Add(time.Minute * 5).Format(time.RFC3339)
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", nsSAML)
+	assertion.CreateAttr("ID", "_"+randomHex(16))
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+	assertion.CreateElement("saml:Issuer").SetText(p.EntityID())
+	subject := assertion.CreateElement("saml:Subject")
+	subject.CreateElement("saml:NameID").SetText(user)
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", cmBearer)
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	data.CreateAttr("NotOnOrAfter", expires)
+	data.CreateAttr("Recipient", acs)
+	if inResponseTo != "" {
+		data.CreateAttr("InResponseTo", inResponseTo)
+	}
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", now.Add(-time.Minute).Format(time.RFC3339))
+	conditions.CreateAttr("NotOnOrAfter", expires)
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(audience)
+	statement := assertion.CreateElement("saml:AttributeStatement")
+	for _, name := range sortedKeys(attrs) {
+		attr := statement.CreateElement("saml:Attribute")
+		attr.CreateAttr("Name", name)
+		for _, v := range attrs[name] {
+			attr.CreateElement("saml:AttributeValue").SetText(v)
+		}
+	}
+
+	ctx, err := dsig.NewSigningContext(p.key, [][]byte{p.cert.Raw})
+	if err != nil {
+		return "", err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	sig, err := ctx.ConstructSignature(assertion, true)
+	if err != nil {
+		return "", err
+	}
+	// the schema wants the signature right after the issuer
+	assertion.InsertChildAt(1, sig)
+
+	doc := etree.NewDocument()
+	resp := doc.CreateElement("samlp:Response")
+	resp.CreateAttr("xmlns:samlp", nsSAMLP)
+	resp.CreateAttr("xmlns:saml", nsSAML)
+	resp.CreateAttr("ID", "_"+randomHex(16))
+	resp.CreateAttr("Version", "2.0")
+	resp.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+	resp.CreateAttr("Destination", acs)
+	if inResponseTo != "" {
+		resp.CreateAttr("InResponseTo", inResponseTo)
+	}
+	resp.CreateElement("saml:Issuer").SetText(p.EntityID())
+	resp.CreateElement("samlp:Status").CreateElement("samlp:StatusCode").CreateAttr("Value", statusOK)
+	resp.AddChild(assertion)
+
+	out, err := doc.WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,405 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+const (
+	nsSAML      = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLP     = "urn:oasis:names:tc:SAML:2.0:protocol"
+	statusOK    = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	bindingPOST = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	cmBearer    = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// tolerated difference between our clock and the identity provider's
+	clockSkew = time.Minute * 3
+	// how long the user may take to sign in at the identity provider
+	requestLifetime = time.Minute * 15
+)
+
+// SAMLStore remembers the AuthnRequests sent and the assertions accepted, it
+// must be shared by every server the identity provider may post to. Expiries
+// are in milliseconds.
+type SAMLStore interface {
+	AddSAMLRequest(id string, expire int64) error
+	// TakeSAMLRequest tells if the request id was sent and not answered
+	// yet, it is true once only
+	TakeSAMLRequest(id string) (bool, error)
+	// AddSAMLAssertion returns false if the assertion id was already added
+	AddSAMLAssertion(id string, expire int64) (bool, error)
+}
+
+// SAMLServiceProvider sends AuthnRequests with the HTTP-Redirect binding and
+// accepts signed responses with the HTTP-POST binding. A response must answer
+// a request it sent and its assertion is accepted once.
+type SAMLServiceProvider struct {
+	EntityID    string
+	ACSURL      string
+	IdPSSOURL   string
+	IdPEntityID string
+	IdPCert     *x509.Certificate
+	Store       SAMLStore
+
+	// Now returns the current time, responses are checked against it
+	Now func() time.Time
+}
+
+// LoadCertificate reads a PEM encoded certificate
+func LoadCertificate(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s has no pem certificate", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func (sp *SAMLServiceProvider) now() time.Time {
+	if sp.Now != nil {
+		return sp.Now()
+	}
+	return time.Now()
+}
+
+// AuthnRequestURL returns the identity provider url which starts a login,
+// relayState comes back unchanged with the response
+func (sp *SAMLServiceProvider) AuthnRequestURL(relayState string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	requestID := "_" + hex.EncodeToString(id)
+
+	doc := etree.NewDocument()
+	req := doc.CreateElement("samlp:AuthnRequest")
+	req.CreateAttr("xmlns:samlp", nsSAMLP)
+	req.CreateAttr("xmlns:saml", nsSAML)
+	req.CreateAttr("ID", requestID)
+	req.CreateAttr("Version", "2.0")
+	req.CreateAttr("IssueInstant", sp.now().UTC().Format(time.RFC3339))
+	req.CreateAttr("Destination", sp.IdPSSOURL)
+	req.CreateAttr("AssertionConsumerServiceURL", sp.ACSURL)
+	req.CreateAttr("ProtocolBinding", bindingPOST)
+	req.CreateElement("saml:Issuer").SetText(sp.EntityID)
+	req.CreateElement("samlp:NameIDPolicy").CreateAttr("AllowCreate", "true")
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	w.Write(data)
+	w.Close()
+
+	if err := sp.Store.AddSAMLRequest(requestID, int64(requestLifetime/time.Millisecond)); err != nil {
+		return "", err
+	}
+	params := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(deflated.Bytes())}}
+	if relayState != "" {
+		params.Set("RelayState", relayState)
+	}
+	sep := "?"
+	if strings.Contains(sp.IdPSSOURL, "?") {
+		sep = "&"
+	}
+	return sp.IdPSSOURL + sep + params.Encode(), nil
+}
+
+// ParseResponse checks the base64 encoded SAMLResponse posted by the browser
+// and returns the identity of its assertion. Either the assertion or the
+// whole response must be signed by the identity provider, the response must
+// answer a pending AuthnRequest and the assertion must not have been used.
+func (sp *SAMLServiceProvider) ParseResponse(encoded string) (*Identity, error) {
+	data, err := base64.StdEncoding.DecodeString(stripSpace(encoded))
+	if err != nil {
+		return nil, errors.New("SAMLResponse is not base64")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("invalid SAMLResponse: %v", err)
+	}
+	for _, token := range doc.Child {
+		if _, ok := token.(*etree.Directive); ok {
+			return nil, errors.New("SAMLResponse has a DOCTYPE")
+		}
+	}
+	resp := doc.Root()
+	if resp == nil || !isElement(resp, nsSAMLP, "Response") {
+		return nil, errors.New("SAMLResponse is not a saml2 response")
+	}
+	if dest := resp.SelectAttrValue("Destination", ""); dest != "" && dest != sp.ACSURL {
+		return nil, fmt.Errorf("response is meant for %s", dest)
+	}
+	inResponseTo := resp.SelectAttrValue("InResponseTo", "")
+	if inResponseTo == "" {
+		return nil, errors.New("unsolicited responses are not accepted")
+	}
+	status := childElement(resp, nsSAMLP, "Status")
+	if status == nil {
+		return nil, errors.New("response has no status")
+	}
+	if code := childElement(status, nsSAMLP, "StatusCode"); code == nil || code.SelectAttrValue("Value", "") != statusOK {
+		return nil, errors.New("identity provider refused the login")
+	}
+	if len(childElements(resp, nsSAML, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := childElements(resp, nsSAML, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("response must have exactly one assertion, got %d", len(assertions))
+	}
+
+	// the assertion is read from the verified element, anything outside of
+	// it is untrusted
+	assertion, err := sp.verifyAssertion(resp, assertions[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+	id, expires, err := sp.checkAssertion(assertion, inResponseTo)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := sp.Store.TakeSAMLRequest(inResponseTo)
+	if err != nil {
+		return nil, err
+	}
+	if !pending {
+		return nil, errors.New("response does not answer a pending request")
+	}
+	// the assertion can be replayed until it expires
+	ttl := expires.Add(clockSkew).Sub(sp.now())
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	fresh, err := sp.Store.AddSAMLAssertion(assertion.SelectAttrValue("ID", ""), int64(ttl/time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, errors.New("assertion was already used")
+	}
+	return id, nil
+}
+
+// verifyAssertion returns the signed copy of the assertion, signed itself or
+// as a part of the response
+func (sp *SAMLServiceProvider) verifyAssertion(resp, assertion *etree.Element) (*etree.Element, error) {
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: []*x509.Certificate{sp.IdPCert},
+	})
+	if sp.Now != nil {
+		ctx.Clock = dsig.NewFakeClockAt(sp.now())
+	}
+
+	// the assertion is signed apart from the namespaces the response declares
+	nsCtx, err := etreeutils.NSBuildParentContext(assertion)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := etreeutils.NSDetatch(nsCtx, assertion)
+	if err != nil {
+		return nil, err
+	}
+	signed, err := ctx.Validate(detached)
+	if err == nil {
+		return signed, nil
+	}
+	if err != dsig.ErrMissingSignature {
+		return nil, err
+	}
+
+	signed, err = ctx.Validate(resp)
+	if err != nil {
+		return nil, err
+	}
+	assertions := childElements(signed, nsSAML, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("signed response has no assertion")
+	}
+	return assertions[0], nil
+}
+
+// checkAssertion returns the identity of the assertion and when it expires
+func (sp *SAMLServiceProvider) checkAssertion(assertion *etree.Element, inResponseTo string) (*Identity, time.Time, error) {
+	now := sp.now()
+	if assertion.SelectAttrValue("ID", "") == "" {
+		return nil, time.Time{}, errors.New("assertion has no ID")
+	}
+	if sp.IdPEntityID != "" {
+		issuer := childElement(assertion, nsSAML, "Issuer")
+		if issuer == nil || strings.TrimSpace(issuer.Text()) != sp.IdPEntityID {
+			return nil, time.Time{}, errors.New("assertion was issued by another identity provider")
+		}
+	}
+
+	var expires time.Time
+	if conditions := childElement(assertion, nsSAML, "Conditions"); conditions != nil {
+		notOnOrAfter, err := checkWindow(conditions, now)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		expires = notOnOrAfter
+		for _, restriction := range childElements(conditions, nsSAML, "AudienceRestriction") {
+			ok := false
+			for _, audience := range childElements(restriction, nsSAML, "Audience") {
+				if strings.TrimSpace(audience.Text()) == sp.EntityID {
+					ok = true
+				}
+			}
+			if !ok {
+				return nil, time.Time{}, errors.New("assertion is meant for another service provider")
+			}
+		}
+	}
+
+	subject := childElement(assertion, nsSAML, "Subject")
+	if subject == nil {
+		return nil, time.Time{}, errors.New("assertion has no subject")
+	}
+	// the web browser sso profile requires the confirmation data to expire
+	// and to name the request it answers, if any
+	var confirmed time.Time
+	for _, confirmation := range childElements(subject, nsSAML, "SubjectConfirmation") {
+		if confirmation.SelectAttrValue("Method", "") != cmBearer {
+			continue
+		}
+		data := childElement(confirmation, nsSAML, "SubjectConfirmationData")
+		if data == nil || data.SelectAttr("NotOnOrAfter") == nil {
+			continue
+		}
+		notOnOrAfter, err := checkWindow(data, now)
+		if err != nil {
+			continue
+		}
+		if r := data.SelectAttrValue("Recipient", ""); r != "" && r != sp.ACSURL {
+			continue
+		}
+		if r := data.SelectAttrValue("InResponseTo", ""); r != "" && r != inResponseTo {
+			continue
+		}
+		if notOnOrAfter.After(confirmed) {
+			confirmed = notOnOrAfter
+		}
+	}
+	if confirmed.IsZero() {
+		return nil, time.Time{}, errors.New("assertion has no valid bearer subject confirmation")
+	}
+	if expires.IsZero() || confirmed.Before(expires) {
+		expires = confirmed
+	}
+
+	id := &Identity{Attributes: make(map[string][]string)}
+	if nameID := childElement(subject, nsSAML, "NameID"); nameID != nil {
+		id.Subject = strings.TrimSpace(nameID.Text())
+	}
+	for _, statement := range childElements(assertion, nsSAML, "AttributeStatement") {
+		for _, attr := range childElements(statement, nsSAML, "Attribute") {
+			name := attr.SelectAttrValue("Name", "")
+			for _, value := range childElements(attr, nsSAML, "AttributeValue") {
+				id.Attributes[name] = append(id.Attributes[name], strings.TrimSpace(value.Text()))
+			}
+			if friendly := attr.SelectAttrValue("FriendlyName", ""); friendly != "" && friendly != name {
+				id.Attributes[friendly] = id.Attributes[name]
+			}
+		}
+	}
+	return id, expires, nil
+}
+
+// checkWindow checks the NotBefore and NotOnOrAfter attributes of el, it
+// returns NotOnOrAfter or the zero time when there is none
+func checkWindow(el *etree.Element, now time.Time) (time.Time, error) {
+	if v := el.SelectAttrValue("NotBefore", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid NotBefore %s", v)
+		}
+		if now.Add(clockSkew).Before(t) {
+			return time.Time{}, errors.New("assertion is not valid yet")
+		}
+	}
+	var notOnOrAfter time.Time
+	if v := el.SelectAttrValue("NotOnOrAfter", ""); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid NotOnOrAfter %s", v)
+		}
+		if !now.Add(-clockSkew).Before(t) {
+			return time.Time{}, errors.New("assertion has expired")
+		}
+		notOnOrAfter = t
+	}
+	return notOnOrAfter, nil
+}
+
+func isElement(el *etree.Element, space, local string) bool {
+	return el.Tag == local && el.NamespaceURI() == space
+}
+
+// childElement returns the first child of el named local in the namespace
+// space
+func childElement(el *etree.Element, space, local string) *etree.Element {
+	for _, c := range el.ChildElements() {
+		if isElement(c, space, local) {
+			return c
+		}
+	}
+	return nil
+}
+
+func childElements(el *etree.Element, space, local string) []*etree.Element {
+	var elements []*etree.Element
+	for _, c := range el.ChildElements() {
+		if isElement(c, space, local) {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
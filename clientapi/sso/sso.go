@@ -0,0 +1,109 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package sso implements the identity provider side of single sign-on: CAS
+// ticket validation and SAML2 responses. The client api turns the identity
+// into an account and a one-time m.login.token.
+package sso
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/finogeeks/ligase/skunkworks/gomatrix"
+)
+
+const (
+	ProviderCAS  = "cas"
+	ProviderSAML = "saml"
+)
+
+// Identity is what the identity provider asserted about the user
+type Identity struct {
+	// The CAS user or the SAML NameID
+	Subject    string
+	Attributes map[string][]string
+}
+
+// Attribute returns the first value of the attribute name, or the subject if
+// name is empty
+func (id *Identity) Attribute(name string) string {
+	if name == "" {
+		return id.Subject
+	}
+	if v := id.Attributes[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Localpart maps the attribute name to a valid user id localpart
+func (id *Identity) Localpart(name string) (string, error) {
+	value := id.Attribute(name)
+	if value == "" {
+		if name == "" {
+			return "", errors.New("identity provider returned no user")
+		}
+		return "", fmt.Errorf("identity provider returned no %s attribute", name)
+	}
+	return MapLocalpart(value), nil
+}
+
+// MapLocalpart encodes s into a valid user id localpart. Upper case
+// characters are escaped with _ and the others are hex encoded as =xx, so the
+// mapping is reversible and distinct identities never share an account.
+func MapLocalpart(s string) string {
+	return gomatrix.EncodeUserLocalpart(s)
+}
+
+// ClientRedirectAllowed returns a bool on whether the client may be sent
+// back to redirectURL with a login token. The url must have the scheme and
+// the host of a whitelisted url and start with its path, nothing is allowed
+// if whitelist is empty.
+func ClientRedirectAllowed(whitelist []string, redirectURL string) bool {
+	u, err := url.Parse(redirectURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	for _, allowed := range whitelist {
+		w, err := url.Parse(allowed)
+		if err != nil || w.Host == "" {
+			continue
+		}
+		if !strings.EqualFold(u.Scheme, w.Scheme) || !strings.EqualFold(u.Host, w.Host) {
+			continue
+		}
+		// the path matches whole segments, /app doesn't allow /apple
+		prefix := strings.TrimSuffix(w.Path, "/")
+		if prefix == "" || u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLoginToken appends the loginToken query parameter to the client's
+// redirect url
+func WithLoginToken(redirectURL, token string) (string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("loginToken", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,341 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testService = "https://matrix.example.org/_matrix/client/r0/login/cas/ticket?redirectUrl=x"
+	testACS     = "https://matrix.example.org/_matrix/client/r0/login/saml2/authn_response"
+	testSP      = "https://matrix.example.org"
+)
+
+func newFakeIdP(t *testing.T) *FakeIdP {
+	idp, err := NewFakeIdP()
+	if err != nil {
+		t.Fatalf("NewFakeIdP: %v", err)
+	}
+	return idp
+}
+
+type memSAMLStore struct {
+	requests   map[string]bool
+	assertions map[string]bool
+}
+
+func (s *memSAMLStore) AddSAMLRequest(id string, expire int64) error {
+	s.requests[id] = true
+	return nil
+}
+
+func (s *memSAMLStore) TakeSAMLRequest(id string) (bool, error) {
+	ok := s.requests[id]
+	delete(s.requests, id)
+	return ok, nil
+}
+
+func (s *memSAMLStore) AddSAMLAssertion(id string, expire int64) (bool, error) {
+	if s.assertions[id] {
+		return false, nil
+	}
+	s.assertions[id] = true
+	return true, nil
+}
+
+func newSP(idp *FakeIdP) *SAMLServiceProvider {
+	return &SAMLServiceProvider{
+		EntityID:    testSP,
+		ACSURL:      testACS,
+		IdPSSOURL:   idp.SAMLSSOURL(),
+		IdPEntityID: idp.EntityID(),
+		IdPCert:     idp.Certificate(),
+		Store:       &memSAMLStore{requests: make(map[string]bool), assertions: make(map[string]bool)},
+	}
+}
+
+// newRequest sends an AuthnRequest and returns its id
+func newRequest(t *testing.T, sp *SAMLServiceProvider) string {
+	login, err := sp.AuthnRequestURL("")
+	if err != nil {
+		t.Fatalf("AuthnRequestURL: %v", err)
+	}
+	u, _ := url.Parse(login)
+	_, id, _, err := readAuthnRequest(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("readAuthnRequest: %v", err)
+	}
+	return id
+}
+
+func TestCASLogin(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	idp.SetUser("Alice", map[string][]string{"uid": {"alice.w"}, "group": {"staff"}})
+	client := NewCASClient(idp.CASURL(), map[string]string{"group": "staff"})
+
+	// the login page sends the browser back to the service with a ticket
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(client.LoginURL(testService))
+	if err != nil {
+		t.Fatalf("login page: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("login page returned %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	ticket := location.Query().Get("ticket")
+	if ticket == "" {
+		t.Fatalf("no ticket in %s", location)
+	}
+
+	id, err := client.ValidateTicket(context.Background(), ticket, testService)
+	if err != nil {
+		t.Fatalf("ValidateTicket: %v", err)
+	}
+	if id.Subject != "Alice" || id.Attribute("uid") != "alice.w" {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+	if lp, _ := id.Localpart(""); lp != "_alice" {
+		t.Fatalf("localpart = %s", lp)
+	}
+
+	if _, err := client.ValidateTicket(context.Background(), ticket, testService); err == nil {
+		t.Fatal("ticket was accepted twice")
+	}
+}
+
+func TestCASRejects(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	idp.SetUser("bob", map[string][]string{"group": {"guest"}})
+
+	client := NewCASClient(idp.CASURL(), map[string]string{"group": "staff"})
+	if _, err := client.ValidateTicket(context.Background(), idp.IssueTicket(testService), testService); err == nil {
+		t.Fatal("user without the required attribute was accepted")
+	}
+
+	client = NewCASClient(idp.CASURL(), nil)
+	if _, err := client.ValidateTicket(context.Background(), idp.IssueTicket(testService), testService+"&other"); err == nil {
+		t.Fatal("ticket was accepted for another service")
+	}
+	if _, err := client.ValidateTicket(context.Background(), "ST-unknown", testService); err == nil {
+		t.Fatal("unknown ticket was accepted")
+	}
+}
+
+func TestSAMLResponse(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	idp.SetUser("alice@example.org", map[string][]string{"uid": {"alice"}, "displayName": {"Alice W"}})
+	sp := newSP(idp)
+
+	resp, err := idp.SAMLResponse(testACS, testSP, newRequest(t, sp))
+	if err != nil {
+		t.Fatalf("SAMLResponse: %v", err)
+	}
+	id, err := sp.ParseResponse(resp)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if id.Subject != "alice@example.org" || id.Attribute("uid") != "alice" || id.Attribute("displayName") != "Alice W" {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+	if lp, _ := id.Localpart(""); lp != "alice=40example.org" {
+		t.Fatalf("localpart = %s", lp)
+	}
+}
+
+var formValue = regexp.MustCompile(`name="(SAMLResponse|RelayState)" value="([^"]*)"`)
+
+func TestSAMLRedirectFlow(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	sp := newSP(idp)
+
+	login, err := sp.AuthnRequestURL("https://client.example.org/done")
+	if err != nil {
+		t.Fatalf("AuthnRequestURL: %v", err)
+	}
+	resp, err := http.Get(login)
+	if err != nil {
+		t.Fatalf("sso page: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("sso page returned %d %s", resp.StatusCode, body)
+	}
+
+	form := make(map[string]string)
+	for _, m := range formValue.FindAllStringSubmatch(string(body), -1) {
+		form[m[1]] = html.UnescapeString(m[2])
+	}
+	if form["RelayState"] != "https://client.example.org/done" {
+		t.Fatalf("RelayState = %q", form["RelayState"])
+	}
+	id, err := sp.ParseResponse(form["SAMLResponse"])
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if id.Subject != "alice" {
+		t.Fatalf("subject = %s", id.Subject)
+	}
+}
+
+func TestSAMLRejects(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	other := newFakeIdP(t)
+	defer other.Close()
+	sp := newSP(idp)
+
+	tamper := func(resp, old, new string) string {
+		data, _ := base64.StdEncoding.DecodeString(resp)
+		return base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(data), old, new, 1)))
+	}
+
+	resp, _ := idp.SAMLResponse(testACS, testSP, newRequest(t, sp))
+	if _, err := sp.ParseResponse(tamper(resp, "<saml:NameID>alice<", "<saml:NameID>admin<")); err == nil {
+		t.Error("tampered NameID was accepted")
+	}
+
+	resp, _ = idp.SAMLResponse(testACS, "https://other.example.org", newRequest(t, sp))
+	if _, err := sp.ParseResponse(resp); err == nil {
+		t.Error("assertion for another audience was accepted")
+	}
+
+	resp, _ = idp.SAMLResponse("https://other.example.org/acs", testSP, newRequest(t, sp))
+	if _, err := sp.ParseResponse(resp); err == nil {
+		t.Error("response for another destination was accepted")
+	}
+
+	resp, _ = idp.SAMLResponse(testACS, testSP, newRequest(t, sp))
+	expired := *sp
+	expired.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := expired.ParseResponse(resp); err == nil {
+		t.Error("expired assertion was accepted")
+	}
+
+	// only the certificate tells the identity providers apart
+	resp, _ = other.SAMLResponse(testACS, testSP, newRequest(t, sp))
+	anyIssuer := *sp
+	anyIssuer.IdPEntityID = ""
+	if _, err := anyIssuer.ParseResponse(resp); err == nil {
+		t.Error("assertion signed by another identity provider was accepted")
+	}
+}
+
+func TestSAMLRejectsReplay(t *testing.T) {
+	idp := newFakeIdP(t)
+	defer idp.Close()
+	sp := newSP(idp)
+
+	resp, _ := idp.SAMLResponse(testACS, testSP, "")
+	if _, err := sp.ParseResponse(resp); err == nil {
+		t.Error("unsolicited response was accepted")
+	}
+	resp, _ = idp.SAMLResponse(testACS, testSP, "_unknown")
+	if _, err := sp.ParseResponse(resp); err == nil {
+		t.Error("response to an unknown request was accepted")
+	}
+
+	requestID := newRequest(t, sp)
+	resp, _ = idp.SAMLResponse(testACS, testSP, requestID)
+	if _, err := sp.ParseResponse(resp); err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if _, err := sp.ParseResponse(resp); err == nil {
+		t.Error("response was accepted twice")
+	}
+	resp, _ = idp.SAMLResponse(testACS, testSP, requestID)
+	if _, err := sp.ParseResponse(resp); err == nil {
+		t.Error("request was answered twice")
+	}
+
+	// the assertion is refused even while its request is pending again
+	requestID = newRequest(t, sp)
+	resp, _ = idp.SAMLResponse(testACS, testSP, requestID)
+	if _, err := sp.ParseResponse(resp); err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	sp.Store.AddSAMLRequest(requestID, 1000)
+	if _, err := sp.ParseResponse(resp); err == nil {
+		t.Error("assertion was accepted twice")
+	}
+}
+
+func TestMapLocalpart(t *testing.T) {
+	cases := map[string]string{
+		"alice":             "alice",
+		"Alice":             "_alice",
+		"ALICE":             "_a_l_i_c_e",
+		"bob.smith_1-2":     "bob.smith__1-2",
+		"carol@example.org": "carol=40example.org",
+		"dave:x=y":          "dave=3ax=3dy",
+	}
+	for in, want := range cases {
+		if got := MapLocalpart(in); got != want {
+			t.Errorf("MapLocalpart(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestClientRedirectAllowed(t *testing.T) {
+	if ClientRedirectAllowed(nil, "https://client.example.org/") {
+		t.Error("url allowed without a whitelist")
+	}
+	whitelist := []string{"https://client.example.org", "https://web.example.org/app/"}
+	allowed := []string{
+		"https://client.example.org",
+		"https://client.example.org/#/login",
+		"https://CLIENT.example.org/done?x=1",
+		"https://web.example.org/app",
+		"https://web.example.org/app/login",
+	}
+	for _, u := range allowed {
+		if !ClientRedirectAllowed(whitelist, u) {
+			t.Errorf("%s refused", u)
+		}
+	}
+	refused := []string{
+		"javascript:alert(1)",
+		"http://client.example.org/",
+		"https://client.example.org.evil.com/",
+		"https://client.example.org:8443/",
+		"https://client.example.org@evil.com/",
+		"https://evil.example.org/",
+		"https://web.example.org/apple",
+		"https://web.example.org/",
+	}
+	for _, u := range refused {
+		if ClientRedirectAllowed(whitelist, u) {
+			t.Errorf("%s allowed", u)
+		}
+	}
+}
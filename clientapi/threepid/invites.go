@@ -220,7 +220,7 @@ func queryIDServerStoreInvite(
 
 	var profile *authtypes.Profile
 	profile = &authtypes.Profile{}
-	if common.CheckValidDomain(serverName, cfg.Matrix.ServerName) {
+	if common.IsLocalDomain(serverName) {
 		displayName, avatarURL, _ := complexCache.GetProfileByUserID(ctx, userID)
 
 		profile.UserID = userID
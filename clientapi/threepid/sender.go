@@ -0,0 +1,116 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package threepid
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+const (
+	SenderSMTP  = "smtp"
+	SenderLog   = "log"
+	GatewayHTTP = "http"
+	GatewayLog  = "log"
+)
+
+// EmailSender delivers the validation emails
+type EmailSender interface {
+	SendEmail(ctx context.Context, to, subject, body string) error
+}
+
+// SMSSender delivers the validation text messages, to is the msisdn digits
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, text string) error
+}
+
+var regSenderMu sync.RWMutex
+var newEmailSender = make(map[string]func(cfg *config.Dendrite) (EmailSender, error))
+var newSMSSender = make(map[string]func(cfg *config.Dendrite) (SMSSender, error))
+
+func RegisterEmailSender(name string, f func(cfg *config.Dendrite) (EmailSender, error)) {
+	regSenderMu.Lock()
+	defer regSenderMu.Unlock()
+
+	if f == nil {
+		log.Panicf("email sender Register: %s func nil", name)
+	}
+	if _, ok := newEmailSender[name]; ok {
+		log.Panicf("email sender Register: %s already registered", name)
+	}
+	newEmailSender[name] = f
+}
+
+func RegisterSMSSender(name string, f func(cfg *config.Dendrite) (SMSSender, error)) {
+	regSenderMu.Lock()
+	defer regSenderMu.Unlock()
+
+	if f == nil {
+		log.Panicf("sms sender Register: %s func nil", name)
+	}
+	if _, ok := newSMSSender[name]; ok {
+		log.Panicf("sms sender Register: %s already registered", name)
+	}
+	newSMSSender[name] = f
+}
+
+// GetEmailSender builds the sender configured in threepid.email.sender
+func GetEmailSender(cfg *config.Dendrite) (EmailSender, error) {
+	regSenderMu.RLock()
+	f := newEmailSender[cfg.ThreePID.Email.Sender]
+	regSenderMu.RUnlock()
+	if f == nil {
+		return nil, errors.New("unknown email sender " + cfg.ThreePID.Email.Sender)
+	}
+	return f(cfg)
+}
+
+// GetSMSSender builds the gateway configured in threepid.msisdn.gateway
+func GetSMSSender(cfg *config.Dendrite) (SMSSender, error) {
+	regSenderMu.RLock()
+	f := newSMSSender[cfg.ThreePID.MSISDN.Gateway]
+	regSenderMu.RUnlock()
+	if f == nil {
+		return nil, errors.New("unknown sms gateway " + cfg.ThreePID.MSISDN.Gateway)
+	}
+	return f(cfg)
+}
+
+func init() {
+	RegisterEmailSender(SenderLog, func(cfg *config.Dendrite) (EmailSender, error) {
+		return logSender{}, nil
+	})
+	RegisterSMSSender(GatewayLog, func(cfg *config.Dendrite) (SMSSender, error) {
+		return logSender{}, nil
+	})
+}
+
+// logSender writes the messages to the log instead of sending them, for
+// local development
+type logSender struct{}
+
+func (logSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	log.Infof("threepid email to:%s subject:%s\n%s", to, subject, body)
+	return nil
+}
+
+func (logSender) SendSMS(ctx context.Context, to, text string) error {
+	log.Infof("threepid sms to:%s text:%s", to, text)
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package threepid
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+)
+
+const smsTimeout = time.Second * 10
+
+func init() {
+	RegisterSMSSender(GatewayHTTP, NewHTTPSMSSender)
+}
+
+type smsRequest struct {
+	To   string `json:"to"`
+	From string `json:"from,omitempty"`
+	Text string `json:"text"`
+}
+
+// HTTPSMSSender posts the text messages as json to an SMS gateway, any 2xx
+// status means the gateway accepted the message
+type HTTPSMSSender struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+func NewHTTPSMSSender(cfg *config.Dendrite) (SMSSender, error) {
+	return &HTTPSMSSender{
+		url:    cfg.ThreePID.MSISDN.URL,
+		token:  cfg.ThreePID.MSISDN.Token,
+		from:   cfg.ThreePID.MSISDN.From,
+		client: &http.Client{Timeout: smsTimeout},
+	}, nil
+}
+
+func (s *HTTPSMSSender) SendSMS(ctx context.Context, to, text string) error {
+	body, err := json.Marshal(smsRequest{To: "+" + to, From: s.from, Text: text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("sms gateway responded with status %d: %s", resp.StatusCode, string(b))
+	}
+	return nil
+}
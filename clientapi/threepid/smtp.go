@@ -0,0 +1,148 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package threepid
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+)
+
+const smtpTimeout = time.Second * 30
+
+func init() {
+	RegisterEmailSender(SenderSMTP, NewSMTPSender)
+}
+
+// SMTPSender submits the emails to an SMTP relay, upgrading the connection
+// with STARTTLS when the relay offers it
+type SMTPSender struct {
+	addr       string
+	host       string
+	username   string
+	password   string
+	requireTLS bool
+	from       *mail.Address
+	tlsConfig  *tls.Config
+}
+
+func NewSMTPSender(cfg *config.Dendrite) (EmailSender, error) {
+	from, err := mail.ParseAddress(cfg.ThreePID.Email.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threepid.email.from: %v", err)
+	}
+	c := cfg.ThreePID.Email.SMTP
+	return &SMTPSender{
+		addr:       net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		host:       c.Host,
+		username:   c.Username,
+		password:   c.Password,
+		requireTLS: c.RequireTLS,
+		from:       from,
+		tlsConfig:  &tls.Config{ServerName: c.Host},
+	}, nil
+}
+
+func (s *SMTPSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return err
+	}
+	msg, err := buildMessage(s.from, rcpt, subject, body)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(s.tlsConfig); err != nil {
+			return err
+		}
+	} else if s.requireTLS {
+		return errors.New("smtp server does not support STARTTLS")
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(rcpt.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage returns a quoted-printable text/plain message
+func buildMessage(from, to *mail.Address, subject, body string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("From: " + from.String() + "\r\n")
+	b.WriteString("To: " + to.String() + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(&b)
+	body = strings.Replace(body, "\r\n", "\n", -1)
+	if _, err := w.Write([]byte(strings.Replace(body, "\n", "\r\n", -1))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	b.WriteString("\r\n")
+	return b.Bytes(), nil
+}
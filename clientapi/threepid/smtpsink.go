@@ -0,0 +1,188 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package threepid
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SinkMessage is an email the sink accepted
+type SinkMessage struct {
+	From string
+	To   []string
+	// The message as sent, headers included
+	Data []byte
+}
+
+// Body returns the decoded body of a single part message
+func (m SinkMessage) Body() string {
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	body, _ := ioutil.ReadAll(msg.Body)
+	if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body, _ = ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+	}
+	return string(body)
+}
+
+// SMTPSink is an in-process SMTP server which keeps every email it receives
+// instead of delivering it. It speaks plain SMTP without TLS or AUTH and is
+// meant for tests and local development.
+type SMTPSink struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []SinkMessage
+}
+
+func NewSMTPSink() (*SMTPSink, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SMTPSink{listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Host and Port return the address to configure as threepid.email.smtp
+func (s *SMTPSink) Host() string {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host
+}
+
+func (s *SMTPSink) Port() int {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+func (s *SMTPSink) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *SMTPSink) Messages() []SinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]SinkMessage, len(s.messages))
+	copy(res, s.messages)
+	return res
+}
+
+func (s *SMTPSink) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *SMTPSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 ligase smtp sink")
+	var msg SinkMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(line)
+		if i := strings.IndexByte(verb, ' '); i >= 0 {
+			verb = verb[:i]
+		}
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 ligase")
+		case "MAIL":
+			msg = SinkMessage{From: pathArg(line)}
+			reply("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, pathArg(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := readData(r)
+			if err != nil {
+				return
+			}
+			msg.Data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// pathArg returns the address of "MAIL FROM:<a>" or "RCPT TO:<a>"
+func pathArg(line string) string {
+	start := strings.IndexByte(line, '<')
+	end := strings.LastIndexByte(line, '>')
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// readData reads a dot terminated message and undoes the dot stuffing
+func readData(r *bufio.Reader) ([]byte, error) {
+	var b bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return b.Bytes(), nil
+		}
+		if strings.HasPrefix(line, ".") {
+			line = line[1:]
+		}
+		b.WriteString(line)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package threepid
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/authtypes"
+	util "github.com/finogeeks/ligase/skunkworks/gomatrixutil"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+const (
+	sessionIDLength  = 24
+	emailTokenLength = 32
+	smsCodeDigits    = 6
+
+	// how often expired validation sessions are removed
+	pruneInterval = time.Hour
+)
+
+// SessionDatabase is the part of the accounts database the validation
+// sessions are kept in
+type SessionDatabase interface {
+	InsertThreePIDSession(ctx context.Context, session *authtypes.ThreePIDSession) error
+	GetThreePIDSession(ctx context.Context, sessionID string) (*authtypes.ThreePIDSession, error)
+	GetThreePIDSessionBySecret(ctx context.Context, clientSecret, medium, address string) (*authtypes.ThreePIDSession, error)
+	UpdateThreePIDSessionAttempt(ctx context.Context, sessionID string, sendAttempt int, token string, createdTs int64) error
+	ValidateThreePIDSession(ctx context.Context, sessionID string, validatedTs int64) error
+	DeleteThreePIDSessionsBefore(ctx context.Context, ts int64) error
+}
+
+var (
+	ErrInvalidAddress   = errors.New("invalid address")
+	ErrInvalidSecret    = errors.New("client_secret must be 1 to 255 characters of [0-9a-zA-Z.=_-]")
+	ErrMediumDisabled   = errors.New("validation of this medium is not enabled")
+	ErrSessionNotFound  = errors.New("unknown validation session")
+	ErrSessionExpired   = errors.New("validation session has expired")
+	ErrTokenIncorrect   = errors.New("token is incorrect")
+	ErrSessionNotActive = errors.New("validation session has not been validated")
+)
+
+var clientSecretRegex = regexp.MustCompile(`^[0-9a-zA-Z.=_\-]{1,255}$`)
+
+// TokenRequest asks to send a validation token to Address
+type TokenRequest struct {
+	Medium string
+	// Normalized with NormalizeEmail or NormalizeMSISDN
+	Address      string
+	ClientSecret string
+	SendAttempt  int
+	NextLink     string
+	// "register" or "account/3pid", the email link points back there
+	Path string
+}
+
+var (
+	pruneMu   sync.Mutex
+	lastPrune time.Time
+)
+
+func nowMS() int64 {
+	return time.Now().UnixNano() / 1000000
+}
+
+// RequestToken creates or resumes the validation session of the request and
+// sends it a token. Repeating a send_attempt returns the same session
+// without sending again.
+func RequestToken(
+	ctx context.Context, db SessionDatabase, cfg *config.Dendrite, req *TokenRequest,
+) (string, error) {
+	if !cfg.ThreePIDEnabled(req.Medium) {
+		return "", ErrMediumDisabled
+	}
+	if !clientSecretRegex.MatchString(req.ClientSecret) {
+		return "", ErrInvalidSecret
+	}
+	now := nowMS()
+	pruneSessions(ctx, db, cfg, now)
+
+	session, err := db.GetThreePIDSessionBySecret(ctx, req.ClientSecret, req.Medium, req.Address)
+	if err != nil {
+		return "", err
+	}
+	if session != nil && (session.ValidatedTs != 0 || req.SendAttempt <= session.SendAttempt) &&
+		now-session.CreatedTs < cfg.ThreePID.SessionLifetime {
+		return session.SessionID, nil
+	}
+
+	token, err := newToken(req.Medium)
+	if err != nil {
+		return "", err
+	}
+	if session == nil {
+		session = &authtypes.ThreePIDSession{
+			SessionID:    util.RandomString(sessionIDLength),
+			ClientSecret: req.ClientSecret,
+			Medium:       req.Medium,
+			Address:      req.Address,
+			Token:        token,
+			SendAttempt:  req.SendAttempt,
+			NextLink:     req.NextLink,
+			CreatedTs:    now,
+		}
+		err = db.InsertThreePIDSession(ctx, session)
+	} else {
+		session.Token = token
+		err = db.UpdateThreePIDSessionAttempt(ctx, session.SessionID, req.SendAttempt, token, now)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := sendToken(ctx, cfg, session, req.Path); err != nil {
+		return "", err
+	}
+	return session.SessionID, nil
+}
+
+func sendToken(ctx context.Context, cfg *config.Dendrite, session *authtypes.ThreePIDSession, path string) error {
+	serverName := ""
+	if len(cfg.Matrix.ServerName) > 0 {
+		serverName = cfg.Matrix.ServerName[0]
+	}
+	if session.Medium == authtypes.MediumMSISDN {
+		sender, err := GetSMSSender(cfg)
+		if err != nil {
+			return err
+		}
+		text := fmt.Sprintf("Your %s validation code is %s", serverName, session.Token)
+		return sender.SendSMS(ctx, session.Address, text)
+	}
+
+	sender, err := GetEmailSender(cfg)
+	if err != nil {
+		return err
+	}
+	link := strings.TrimRight(cfg.ThreePID.PublicBaseURL, "/") + "/_matrix/client/r0/" + path +
+		"/email/submitToken?" + url.Values{
+		"sid":           {session.SessionID},
+		"client_secret": {session.ClientSecret},
+		"token":         {session.Token},
+	}.Encode()
+	body := fmt.Sprintf("A request was made to use this email address on %s.\n\n"+
+		"To confirm it, open this link:\n\n%s\n\n"+
+		"If you did not make this request, you can ignore this email.\n", serverName, link)
+	return sender.SendEmail(ctx, session.Address, cfg.ThreePID.Email.Subject, body)
+}
+
+// SubmitToken validates the session if token is the one sent to it
+func SubmitToken(
+	ctx context.Context, db SessionDatabase, cfg *config.Dendrite, sessionID, clientSecret, token string,
+) (*authtypes.ThreePIDSession, error) {
+	session, err := getSession(ctx, db, sessionID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(session.Token), []byte(strings.TrimSpace(token))) != 1 {
+		return nil, ErrTokenIncorrect
+	}
+	if session.ValidatedTs != 0 {
+		return session, nil
+	}
+	now := nowMS()
+	if now-session.CreatedTs >= cfg.ThreePID.SessionLifetime {
+		return nil, ErrSessionExpired
+	}
+	if err := db.ValidateThreePIDSession(ctx, sessionID, now); err != nil {
+		return nil, err
+	}
+	session.ValidatedTs = now
+	return session, nil
+}
+
+// ValidatedSession returns the session if its token was submitted recently
+// enough to bind the address, and it is of medium unless medium is empty
+func ValidatedSession(
+	ctx context.Context, db SessionDatabase, cfg *config.Dendrite, medium, sessionID, clientSecret string,
+) (*authtypes.ThreePIDSession, error) {
+	session, err := getSession(ctx, db, sessionID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if medium != "" && session.Medium != medium {
+		return nil, ErrSessionNotFound
+	}
+	if session.ValidatedTs == 0 {
+		return nil, ErrSessionNotActive
+	}
+	if nowMS()-session.ValidatedTs >= cfg.ThreePID.SessionLifetime {
+		return nil, ErrSessionExpired
+	}
+	return session, nil
+}
+
+func getSession(ctx context.Context, db SessionDatabase, sessionID, clientSecret string) (*authtypes.ThreePIDSession, error) {
+	if sessionID == "" || clientSecret == "" {
+		return nil, ErrSessionNotFound
+	}
+	session, err := db.GetThreePIDSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || subtle.ConstantTimeCompare([]byte(session.ClientSecret), []byte(clientSecret)) != 1 {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// pruneSessions removes the sessions nobody can use anymore, at most once
+// per pruneInterval
+func pruneSessions(ctx context.Context, db SessionDatabase, cfg *config.Dendrite, now int64) {
+	pruneMu.Lock()
+	if time.Since(lastPrune) < pruneInterval {
+		pruneMu.Unlock()
+		return
+	}
+	lastPrune = time.Now()
+	pruneMu.Unlock()
+
+	// a session validated at the end of its lifetime may be used for one
+	// more lifetime
+	if err := db.DeleteThreePIDSessionsBefore(ctx, now-2*cfg.ThreePID.SessionLifetime); err != nil {
+		log.Warnf("prune threepid sessions err:%v", err)
+	}
+}
+
+func newToken(medium string) (string, error) {
+	if medium == authtypes.MediumEmail {
+		return util.RandomString(emailTokenLength), nil
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", smsCodeDigits, n.Int64()), nil
+}
+
+// NormalizeEmail returns the lowercase address, which must be a bare
+// address without a display name
+func NormalizeEmail(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return "", ErrInvalidAddress
+	}
+	return strings.ToLower(address), nil
+}
+
+// NormalizeMSISDN returns the international number without "+", country is
+// the ISO 3166-1 alpha-2 code of a national phone number
+func NormalizeMSISDN(country, number string) (string, error) {
+	var digits strings.Builder
+	number = strings.TrimSpace(number)
+	international := strings.HasPrefix(number, "+")
+	for i, c := range number {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == '+' && i == 0, c == ' ', c == '-', c == '.', c == '(', c == ')':
+		default:
+			return "", ErrInvalidAddress
+		}
+	}
+	msisdn := digits.String()
+	if !international && strings.HasPrefix(msisdn, "00") {
+		international = true
+		msisdn = msisdn[2:]
+	}
+	if !international {
+		code, ok := countryCallingCodes[strings.ToUpper(country)]
+		if !ok {
+			return "", ErrInvalidAddress
+		}
+		msisdn = code + strings.TrimLeft(msisdn, "0")
+	}
+	if len(msisdn) < 8 || len(msisdn) > 15 || msisdn[0] == '0' {
+		return "", ErrInvalidAddress
+	}
+	return msisdn, nil
+}
+
+var countryCallingCodes = map[string]string{
+	"AE": "971", "AR": "54", "AT": "43", "AU": "61", "BE": "32", "BR": "55",
+	"CA": "1", "CH": "41", "CN": "86", "CZ": "420", "DE": "49", "DK": "45",
+	"EG": "20", "ES": "34", "FI": "358", "FR": "33", "GB": "44", "GR": "30",
+	"HK": "852", "ID": "62", "IE": "353", "IL": "972", "IN": "91", "IT": "39",
+	"JP": "81", "KR": "82", "MO": "853", "MX": "52", "MY": "60", "NL": "31",
+	"NO": "47", "NZ": "64", "PH": "63", "PL": "48", "PT": "351", "RU": "7",
+	"SA": "966", "SE": "46", "SG": "65", "TH": "66", "TR": "90", "TW": "886",
+	"UA": "380", "US": "1", "VN": "84", "ZA": "27",
+}
@@ -0,0 +1,289 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package threepid
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/authtypes"
+)
+
+// fakeSessionDB keeps the validation sessions in memory
+type fakeSessionDB struct {
+	mu       sync.Mutex
+	sessions map[string]authtypes.ThreePIDSession
+}
+
+func newFakeSessionDB() *fakeSessionDB {
+	return &fakeSessionDB{sessions: make(map[string]authtypes.ThreePIDSession)}
+}
+
+func (d *fakeSessionDB) InsertThreePIDSession(ctx context.Context, session *authtypes.ThreePIDSession) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessions[session.SessionID] = *session
+	return nil
+}
+
+func (d *fakeSessionDB) GetThreePIDSession(ctx context.Context, sessionID string) (*authtypes.ThreePIDSession, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.sessions[sessionID]; ok {
+		return &s, nil
+	}
+	return nil, nil
+}
+
+func (d *fakeSessionDB) GetThreePIDSessionBySecret(ctx context.Context, clientSecret, medium, address string) (*authtypes.ThreePIDSession, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.sessions {
+		if s.ClientSecret == clientSecret && s.Medium == medium && s.Address == address {
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *fakeSessionDB) UpdateThreePIDSessionAttempt(ctx context.Context, sessionID string, sendAttempt int, token string, createdTs int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.sessions[sessionID]
+	s.SendAttempt, s.Token, s.CreatedTs = sendAttempt, token, createdTs
+	d.sessions[sessionID] = s
+	return nil
+}
+
+func (d *fakeSessionDB) ValidateThreePIDSession(ctx context.Context, sessionID string, validatedTs int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.sessions[sessionID]
+	s.ValidatedTs = validatedTs
+	d.sessions[sessionID] = s
+	return nil
+}
+
+func (d *fakeSessionDB) DeleteThreePIDSessionsBefore(ctx context.Context, ts int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, s := range d.sessions {
+		if s.CreatedTs < ts {
+			delete(d.sessions, id)
+		}
+	}
+	return nil
+}
+
+// fakeSMS records the text messages instead of sending them
+type fakeSMS struct {
+	mu   sync.Mutex
+	sent map[string]string
+}
+
+func (f *fakeSMS) SendSMS(ctx context.Context, to, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent[to] = text
+	return nil
+}
+
+var testSMS = &fakeSMS{sent: make(map[string]string)}
+
+func init() {
+	RegisterSMSSender("test", func(cfg *config.Dendrite) (SMSSender, error) {
+		return testSMS, nil
+	})
+}
+
+func newTestConfig(t *testing.T) (*config.Dendrite, *SMTPSink) {
+	sink, err := NewSMTPSink()
+	if err != nil {
+		t.Fatalf("NewSMTPSink: %v", err)
+	}
+	cfg := &config.Dendrite{}
+	cfg.Matrix.ServerName = []string{"example.org"}
+	cfg.ThreePID.SessionLifetime = 3600000
+	cfg.ThreePID.PublicBaseURL = "https://matrix.example.org"
+	cfg.ThreePID.Email.Sender = SenderSMTP
+	cfg.ThreePID.Email.From = "Matrix <noreply@example.org>"
+	cfg.ThreePID.Email.Subject = "Validate your email address"
+	cfg.ThreePID.Email.SMTP.Host = sink.Host()
+	cfg.ThreePID.Email.SMTP.Port = sink.Port()
+	cfg.ThreePID.MSISDN.Gateway = "test"
+	return cfg, sink
+}
+
+func TestSMTPSender(t *testing.T) {
+	cfg, sink := newTestConfig(t)
+	defer sink.Close()
+
+	sender, err := GetEmailSender(cfg)
+	if err != nil {
+		t.Fatalf("GetEmailSender: %v", err)
+	}
+	body := "héllo\nthis line is long enough to be wrapped by the quoted-printable encoding of the message body"
+	if err := sender.SendEmail(context.Background(), "alice@example.org", "Hi", body); err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+	msgs := sink.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("sink got %d messages", len(msgs))
+	}
+	if msgs[0].From != "noreply@example.org" || len(msgs[0].To) != 1 || msgs[0].To[0] != "alice@example.org" {
+		t.Fatalf("unexpected envelope %s %v", msgs[0].From, msgs[0].To)
+	}
+	if got := strings.Replace(msgs[0].Body(), "\r\n", "\n", -1); strings.TrimRight(got, "\n") != body {
+		t.Fatalf("body = %q", got)
+	}
+}
+
+var linkRegex = regexp.MustCompile(`https://\S+`)
+
+func TestEmailValidation(t *testing.T) {
+	cfg, sink := newTestConfig(t)
+	defer sink.Close()
+	db := newFakeSessionDB()
+	ctx := context.Background()
+
+	req := &TokenRequest{
+		Medium:       authtypes.MediumEmail,
+		Address:      "alice@example.org",
+		ClientSecret: "secret",
+		SendAttempt:  1,
+		Path:         "register",
+	}
+	sid, err := RequestToken(ctx, db, cfg, req)
+	if err != nil {
+		t.Fatalf("RequestToken: %v", err)
+	}
+	// the same attempt is not sent again
+	if again, err := RequestToken(ctx, db, cfg, req); err != nil || again != sid {
+		t.Fatalf("repeated RequestToken returned %s %v", again, err)
+	}
+	msgs := sink.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("sink got %d messages", len(msgs))
+	}
+
+	link, err := url.Parse(linkRegex.FindString(msgs[0].Body()))
+	if err != nil || link.Path != "/_matrix/client/r0/register/email/submitToken" {
+		t.Fatalf("unexpected link in %q", msgs[0].Body())
+	}
+	query := link.Query()
+	if query.Get("sid") != sid || query.Get("client_secret") != "secret" {
+		t.Fatalf("unexpected link %s", link)
+	}
+
+	if _, err := ValidatedSession(ctx, db, cfg, authtypes.MediumEmail, sid, "secret"); err != ErrSessionNotActive {
+		t.Fatalf("session usable before validation: %v", err)
+	}
+	if _, err := SubmitToken(ctx, db, cfg, sid, "secret", "wrong"); err != ErrTokenIncorrect {
+		t.Fatalf("wrong token: %v", err)
+	}
+	if _, err := SubmitToken(ctx, db, cfg, sid, "other", query.Get("token")); err != ErrSessionNotFound {
+		t.Fatalf("wrong client secret: %v", err)
+	}
+	if _, err := SubmitToken(ctx, db, cfg, sid, "secret", query.Get("token")); err != nil {
+		t.Fatalf("SubmitToken: %v", err)
+	}
+
+	session, err := ValidatedSession(ctx, db, cfg, authtypes.MediumEmail, sid, "secret")
+	if err != nil || session.Address != "alice@example.org" {
+		t.Fatalf("ValidatedSession: %+v %v", session, err)
+	}
+	if _, err := ValidatedSession(ctx, db, cfg, authtypes.MediumMSISDN, sid, "secret"); err != ErrSessionNotFound {
+		t.Fatalf("email session used as msisdn: %v", err)
+	}
+
+	// a validated session is not sent a new token
+	req.SendAttempt = 2
+	if again, err := RequestToken(ctx, db, cfg, req); err != nil || again != sid || len(sink.Messages()) != 1 {
+		t.Fatalf("RequestToken after validation returned %s %v", again, err)
+	}
+}
+
+func TestMSISDNValidation(t *testing.T) {
+	cfg, sink := newTestConfig(t)
+	defer sink.Close()
+	db := newFakeSessionDB()
+	ctx := context.Background()
+
+	req := &TokenRequest{
+		Medium:       authtypes.MediumMSISDN,
+		Address:      "447700900123",
+		ClientSecret: "secret",
+		SendAttempt:  1,
+		Path:         "account/3pid",
+	}
+	sid, err := RequestToken(ctx, db, cfg, req)
+	if err != nil {
+		t.Fatalf("RequestToken: %v", err)
+	}
+	// a new attempt sends a new code to the same session
+	req.SendAttempt = 2
+	if again, err := RequestToken(ctx, db, cfg, req); err != nil || again != sid {
+		t.Fatalf("resend returned %s %v", again, err)
+	}
+	text := testSMS.sent[req.Address]
+	code := text[strings.LastIndex(text, " ")+1:]
+	if len(code) != smsCodeDigits {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if _, err := SubmitToken(ctx, db, cfg, sid, "secret", code); err != nil {
+		t.Fatalf("SubmitToken: %v", err)
+	}
+	if _, err := ValidatedSession(ctx, db, cfg, "", sid, "secret"); err != nil {
+		t.Fatalf("ValidatedSession: %v", err)
+	}
+
+	cfg.ThreePID.MSISDN.Gateway = ""
+	if _, err := RequestToken(ctx, db, cfg, req); err != ErrMediumDisabled {
+		t.Fatalf("disabled medium: %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	msisdns := []struct{ country, number, want string }{
+		{"GB", "07700 900123", "447700900123"},
+		{"", "+44 7700 900123", "447700900123"},
+		{"", "0044 (7700) 900-123", "447700900123"},
+		{"us", "(201) 555-0123", "12015550123"},
+	}
+	for _, c := range msisdns {
+		if got, err := NormalizeMSISDN(c.country, c.number); err != nil || got != c.want {
+			t.Errorf("NormalizeMSISDN(%q, %q) = %q %v, want %q", c.country, c.number, got, err, c.want)
+		}
+	}
+	for _, bad := range []string{"12345", "+44 7700 abc", ""} {
+		if _, err := NormalizeMSISDN("", bad); err == nil {
+			t.Errorf("NormalizeMSISDN accepted %q", bad)
+		}
+	}
+
+	if got, err := NormalizeEmail(" Alice@Example.ORG "); err != nil || got != "alice@example.org" {
+		t.Errorf("NormalizeEmail = %q %v", got, err)
+	}
+	for _, bad := range []string{"Alice <alice@example.org>", "alice", "alice@"} {
+		if _, err := NormalizeEmail(bad); err == nil {
+			t.Errorf("NormalizeEmail accepted %q", bad)
+		}
+	}
+}
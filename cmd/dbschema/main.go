@@ -0,0 +1,86 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// dbschema shows or applies the pending schema migrations of the databases:
+//
+//	dbschema --config dendrite.yaml status
+//	dbschema --config dendrite.yaml --db accounts,roomserver up
+//
+// The servers apply them when they start too, running dbschema up first
+// keeps long migrations out of the startup.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	_ "github.com/finogeeks/ligase/storage/implements"
+	_ "github.com/lib/pq"
+)
+
+var dbs = flag.String("db", "", "The databases, comma separated, defaults to all")
+
+func main() {
+	basecomponent.ParseMonolithFlags()
+	cfg := config.GetConfig()
+
+	cmd := flag.Arg(0)
+	if cmd != "status" && cmd != "up" {
+		log.Fatal("usage: dbschema --config dendrite.yaml [--db name,...] status|up")
+	}
+	names := common.MigrationNames()
+	if *dbs != "" {
+		names = strings.Split(*dbs, ",")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tVERSION\tDESCRIPTION\tAPPLIED")
+	for _, name := range names {
+		driver, _, address, _, _, _ := cfg.GetDBConfig(name)
+		if address == "" {
+			log.Fatalf("no database configured for %s", name)
+		}
+		db, err := sql.Open(driver, address)
+		if err != nil {
+			log.Fatalf("open %s db err:%v", name, err)
+		}
+		if cmd == "up" {
+			if err = common.Migrate(db, driver, name); err != nil {
+				log.Fatalf("migrate %s db err:%v", name, err)
+			}
+		}
+		states, err := common.MigrationStatus(db, name)
+		if err != nil {
+			log.Fatalf("read %s db migrations err:%v", name, err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != 0 {
+				applied = time.Unix(0, state.AppliedAt*int64(time.Millisecond)).Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", name, state.Version, state.Description, applied)
+		}
+		db.Close() // nolint: errcheck
+	}
+	w.Flush() // nolint: errcheck
+}
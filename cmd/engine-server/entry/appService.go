@@ -18,6 +18,7 @@ import (
 	"github.com/finogeeks/ligase/appservice"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/uid"
 )
 
 func StartAppService(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
@@ -25,8 +26,13 @@ func StartAppService(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	kafka := base.Cfg.Kafka
 
 	addConsumer(transportMultiplexer, kafka.Consumer.OutputRoomEventAppservice, base.Cfg.MultiInstance.Instance)
+	addConsumer(transportMultiplexer, kafka.Consumer.OutputProfileAppservice, base.Cfg.MultiInstance.Instance)
 
 	transportMultiplexer.PreStart()
 
-	appservice.SetupApplicationServiceComponent(base)
+	idg, _ := uid.NewDefaultIdGenerator(base.Cfg.Matrix.InstanceId)
+	rpcClient := common.NewRpcClient(base.Cfg.Nats.Uri, idg)
+	rpcClient.Start(false)
+
+	appservice.SetupApplicationServiceComponent(base, rpcClient)
 }
@@ -17,6 +17,7 @@ package entry
 import (
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/health"
 )
 
 func StartCacheLoader(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
@@ -44,6 +45,8 @@ func StartCacheLoader(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	e2eDB := base.CreateEncryptApiDB()
 	presenceDB := base.CreatePresenceDB()
 
+	health.Begin("cache_loader")
+	defer health.Finish("cache_loader")
 	roomDB.RecoverCache()
 	accountDB.RecoverCache()
 	deviceDB.RecoverCache()
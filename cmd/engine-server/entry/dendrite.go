@@ -41,6 +41,9 @@ func StartClientAPIServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	addProducer(transportMultiplexer, kafka.Producer.OutputProfileData)
 	addProducer(transportMultiplexer, kafka.Producer.DBUpdates)
 	addProducer(transportMultiplexer, kafka.Producer.OutputRoomFedEvent)
+	if base.Cfg.Audit.Kafka {
+		addProducer(transportMultiplexer, kafka.Producer.Audit)
+	}
 
 	addConsumer(transportMultiplexer, kafka.Consumer.InputRoomEvent, base.Cfg.MultiInstance.Instance)
 
@@ -186,6 +189,7 @@ func StartFixDBServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 func StartBgMgr(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	deviceDB := base.CreateDeviceDB()
 	syncDB := base.CreateSyncDB()
+	roomDB := base.CreateRoomDB()
 	encryptDB := base.CreateEncryptApiDB()
 	cache := base.PrepareCache()
 	idg, _ := uid.NewDefaultIdGenerator(base.Cfg.Matrix.InstanceId)
@@ -193,5 +197,5 @@ func StartBgMgr(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	rpcClient.Start(true)
 	tokenFilter := filter.GetFilterMng().Register("device", deviceDB)
 	tokenFilter.Load()
-	bgmgr.SetupBgMgrComponent(deviceDB, cache, encryptDB, syncDB, rpcClient, tokenFilter, base.Cfg.DeviceMng.ScanUnActive, base.Cfg.DeviceMng.KickUnActive)
+	bgmgr.SetupBgMgrComponent(base.Cfg, deviceDB, cache, encryptDB, syncDB, roomDB, rpcClient, tokenFilter, base.Cfg.DeviceMng.ScanUnActive, base.Cfg.DeviceMng.KickUnActive)
 }
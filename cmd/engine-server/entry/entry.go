@@ -41,6 +41,7 @@ import (
 	"github.com/finogeeks/ligase/common/basecomponent"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/encryption"
+	"github.com/finogeeks/ligase/common/health"
 	"github.com/finogeeks/ligase/common/lifecycle"
 	"github.com/finogeeks/ligase/core"
 	_ "github.com/finogeeks/ligase/plugins"
@@ -173,6 +174,10 @@ func checkProcName(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 		usage()
 	}
 
+	if base.Cfg.InProcess() && *cmd.procName != "monolith-server" {
+		log.Fatalf("%s cannot run with nats, kafka or redis in process, only the monolith-server can", *cmd.procName)
+	}
+
 	switch *cmd.procName {
 	case "cache-loader":
 		StartCacheLoader(base, cmd)
@@ -344,27 +349,39 @@ func addConsumer(mult core.IMultiplexer, conf config.ConsumerConf, instance uint
 	}
 }
 
+// addConfigReloadConsumer subscribes to the config reloads broadcast by
+// the admin api, in a group of its own for each kind of server
+func addConfigReloadConsumer(base *basecomponent.BaseDendrite, procName string) {
+	conf := base.Cfg.Kafka.Consumer.SettingUpdateReload
+	if conf.Topic == "" {
+		return
+	}
+	conf.Group = conf.Group + "-" + procName
+	addConsumer(common.GetTransportMultiplexer(), conf, base.Cfg.MultiInstance.Instance)
+	common.NewConfigReloadConsumer(conf.Underlying, conf.Name)
+}
+
 func handleSignalUSR2() {
 	cfg := config.GetConfig()
-	logCfg := new(log.LogConfig)
+	level := "debug"
 	if cfg.Log.Signaled {
 		cfg.Log.Signaled = false
-		logCfg.Level = cfg.Log.Level
+		level = config.GetReloadable().LogLevel
 	} else {
 		cfg.Log.Signaled = true
-		logCfg.Level = "debug"
 	}
-	logCfg.Files = cfg.Log.Files
-	logCfg.WriteToStdout = cfg.Log.WriteToStdout
-	logCfg.ZapConfig.MaxSize = cfg.Log.ZapConfig.MaxSize
-	logCfg.ZapConfig.MaxBackups = cfg.Log.ZapConfig.MaxBackups
-	logCfg.ZapConfig.MaxAge = cfg.Log.ZapConfig.MaxAge
-	logCfg.ZapConfig.LocalTime = cfg.Log.ZapConfig.LocalTime
-	logCfg.ZapConfig.Compress = cfg.Log.ZapConfig.Compress
-	logCfg.ZapConfig.JsonFormat = cfg.Log.ZapConfig.JsonFormat
-	logCfg.ZapConfig.BtEnabled = cfg.Log.ZapConfig.BtEnabled
-	logCfg.ZapConfig.BtLevel = cfg.Log.ZapConfig.BtLevel
-	log.Setup(logCfg)
+	log.Setup(cfg.LogConfig(level))
+}
+
+// handleSignalHUP reloads the config file of this server, the admin api
+// reloads the one of every server
+func handleSignalHUP() {
+	cur, changed, err := config.Reload()
+	if err != nil {
+		log.Errorf("reload config err:%v", err)
+	} else if !changed {
+		log.Infof("config unchanged, digest %s", cur.Digest)
+	}
 }
 
 func handleSignal() {
@@ -378,6 +395,8 @@ func handleSignal() {
 				os.Exit(0)
 			case syscall.SIGUSR2:
 				handleSignalUSR2()
+			case syscall.SIGHUP:
+				handleSignalHUP()
 			default:
 				log.Println("other", s)
 			}
@@ -426,10 +445,15 @@ func Entry() {
 
 	handleSignal()
 	loadDefault(base, cmdLine)
+	// the probes are served with the api, and on the monitor port of the
+	// servers without one
+	health.Handle(http.DefaultServeMux)
+	health.Begin("startup")
 	decodeLicense(base.Cfg)
 	encryption.Init(base.Cfg.LicenseItem.Encryption, base.Cfg.LicenseItem.Secret, base.Cfg.Encryption.Mirror)
 	setUpTransport(base, cmdLine)
 	checkProcName(base, cmdLine)
+	addConfigReloadConsumer(base, *cmdLine.procName)
 
 	transportMultiplexer := common.GetTransportMultiplexer()
 	transportMultiplexer.Start()
@@ -454,5 +478,6 @@ func Entry() {
 	if err := lifecycle.RunAfterStartup(); err != nil {
 		panic(err)
 	}
+	health.Finish("startup")
 	select {}
 }
@@ -62,6 +62,9 @@ func StartFrontServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	addProducer(transportMultiplexer, kafka.Producer.SettingUpdate)
 	addProducer(transportMultiplexer, kafka.Producer.UserInfoUpdate)
 	addProducer(transportMultiplexer, kafka.Producer.DismissRoom)
+	if base.Cfg.Audit.Kafka {
+		addProducer(transportMultiplexer, kafka.Producer.Audit)
+	}
 	addConsumer(transportMultiplexer, kafka.Consumer.OutputRoomEventPublicRooms, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.InputRoomEvent, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.DismissRoom, base.Cfg.MultiInstance.Instance)
@@ -116,7 +119,7 @@ func StartFrontServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	clientapi.SetupClientAPIComponent(base, deviceDB, cache, accountDB, newFederation, &keyRing, rsRpcCli, encryptDB, syncDB, presenceDB, roomDB, rpcClient, tokenFilter, idg, complexCache, serverConfDB)
 	publicRoomsDB := base.CreatePublicRoomApiDB()
 	publicroomsapi.SetupPublicRoomsAPIComponent(base, rpcClient, rsRpcCli, publicRoomsDB)
-	bgmgr.SetupBgMgrComponent(deviceDB, cache, encryptDB, syncDB, rpcClient, tokenFilter, base.Cfg.DeviceMng.ScanUnActive, base.Cfg.DeviceMng.KickUnActive)
+	bgmgr.SetupBgMgrComponent(base.Cfg, deviceDB, cache, encryptDB, syncDB, roomDB, rpcClient, tokenFilter, base.Cfg.DeviceMng.ScanUnActive, base.Cfg.DeviceMng.KickUnActive)
 	rcsserver.SetupRCSServerComponent(base, rpcClient)
 }
 
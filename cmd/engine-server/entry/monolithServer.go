@@ -109,6 +109,9 @@ func StartMonolithServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	addProducer(transportMultiplexer, kafka.Producer.SettingUpdate)
 	addProducer(transportMultiplexer, kafka.Producer.UserInfoUpdate)
 	addProducer(transportMultiplexer, kafka.Producer.DismissRoom)
+	if base.Cfg.Audit.Kafka {
+		addProducer(transportMultiplexer, kafka.Producer.Audit)
+	}
 	addConsumer(transportMultiplexer, kafka.Consumer.InputRoomEvent, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.OutputRoomEventPublicRooms, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.OutputRoomEventAppservice, base.Cfg.MultiInstance.Instance)
@@ -118,6 +121,7 @@ func StartMonolithServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	addConsumer(transportMultiplexer, kafka.Consumer.OutputClientData, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.OutputProfileSyncServer, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.OutputProfileSyncAggregate, base.Cfg.MultiInstance.Instance)
+	addConsumer(transportMultiplexer, kafka.Consumer.OutputProfileAppservice, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.CacheUpdates, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.DBUpdates, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.FedBridgeOutRes, base.Cfg.MultiInstance.Instance)
@@ -186,7 +190,7 @@ func StartMonolithServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 
 	publicRoomsDB := base.CreatePublicRoomApiDB()
 	publicroomsapi.SetupPublicRoomsAPIComponent(base, rpcClient, rsRpcCli, publicRoomsDB)
-	appservice.SetupApplicationServiceComponent(base)
+	appservice.SetupApplicationServiceComponent(base, rpcClient)
 	StartCacheLoader(base, cmd)
 	//pushDB := base.CreatePushApiDB()
 	//roomServerDB := base.CreateRoomDB()
@@ -195,6 +199,6 @@ func StartMonolithServer(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	syncwriter.SetupSyncWriterComponent(base)
 	syncaggregate.SetupSyncAggregateComponent(base, cache, rpcClient, idg, complexCache)
 	proxy.SetupProxy(base, cache, rpcClient, rsRpcCli, newTokenFilter)
-	bgmgr.SetupBgMgrComponent(deviceDB, cache, encryptDB, syncDB, rpcClient, tokenFilter, base.Cfg.DeviceMng.ScanUnActive, base.Cfg.DeviceMng.KickUnActive)
+	bgmgr.SetupBgMgrComponent(base.Cfg, deviceDB, cache, encryptDB, syncDB, roomDB, rpcClient, tokenFilter, base.Cfg.DeviceMng.ScanUnActive, base.Cfg.DeviceMng.KickUnActive)
 	rcsserver.SetupRCSServerComponent(base, rpcClient)
 }
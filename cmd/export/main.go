@@ -0,0 +1,83 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// export writes the complete history of a room for compliance, signed by the
+// server key:
+//
+//	export --config dendrite.yaml --room '!room:domain' --format jsonl --out room.jsonl
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/encryption"
+	"github.com/finogeeks/ligase/compliance"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	_ "github.com/finogeeks/ligase/storage/implements"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+var (
+	roomID = flag.String("room", "", "The room to export")
+	fromTs = flag.Int64("from-ts", 0, "Export the events sent from this timestamp in milliseconds")
+	toTs   = flag.Int64("to-ts", 0, "Export the events sent before this timestamp in milliseconds, defaults to now")
+	format = flag.String("format", compliance.FormatJSONL, "json, jsonl or eml")
+	out    = flag.String("out", "", "The file to write, defaults to stdout")
+)
+
+func main() {
+	basecomponent.ParseMonolithFlags()
+	cfg := config.GetConfig()
+	if *roomID == "" {
+		log.Fatal("--room must be supplied")
+	}
+	if *toTs <= 0 {
+		*toTs = time.Now().UnixNano() / 1000000
+	}
+
+	if err := json.Unmarshal([]byte(encryption.DecryptLicense(cfg.License)), &cfg.LicenseItem); err != nil {
+		log.Fatalf("decode license err:%v", err)
+	}
+	encryption.Init(cfg.LicenseItem.Encryption, cfg.LicenseItem.Secret, cfg.Encryption.Mirror)
+
+	db, err := common.GetDBInstance("syncapi", cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to sync db err:%v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("create %s err:%v", *out, err)
+		}
+		defer f.Close() // nolint: errcheck
+		w = f
+	}
+
+	exporter := compliance.NewExporter(cfg, db.(model.SyncAPIDatabase))
+	count, err := exporter.Export(context.Background(), w, *roomID, *fromTs, *toTs, *format)
+	if err != nil {
+		log.Fatalf("export room %s err:%v", *roomID, err)
+	}
+	log.Infof("exported %d events of room %s", count, *roomID)
+}
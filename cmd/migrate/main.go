@@ -0,0 +1,119 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// migrate imports a Synapse homeserver into ligase, driven by the migration
+// section of the config:
+//
+//	migrate --config dendrite.yaml --media-out media.jsonl
+//
+// The roomserver must be running, room history is replayed through it. Run
+// the cache-loader once the migration is done. Stopping and starting the tool
+// again continues where it stopped.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/encryption"
+	"github.com/finogeeks/ligase/common/uid"
+	"github.com/finogeeks/ligase/migration"
+	"github.com/finogeeks/ligase/roomserver/rpc"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	_ "github.com/finogeeks/ligase/storage/implements"
+	"github.com/finogeeks/ligase/storage/model"
+	_ "github.com/lib/pq"
+)
+
+var (
+	batchSize = flag.Int("batch-size", 50, "The number of room events sent to the roomserver at once")
+	mediaOut  = flag.String("media-out", "", "The file to write the synapse media references to, media is skipped if empty")
+)
+
+func main() {
+	basecomponent.ParseMonolithFlags()
+	cfg := config.GetConfig()
+	if cfg.Migration.SynapseDB == "" {
+		log.Fatal("migration.synapse_db must be supplied")
+	}
+
+	if err := json.Unmarshal([]byte(encryption.DecryptLicense(cfg.License)), &cfg.LicenseItem); err != nil {
+		log.Fatalf("decode license err:%v", err)
+	}
+	encryption.Init(cfg.LicenseItem.Encryption, cfg.LicenseItem.Secret, cfg.Encryption.Mirror)
+
+	// write straight to the databases, there is no persist server behind us
+	cfg.Database.UseSync = true
+	if cfg.Migration.GoAccountDB != "" {
+		cfg.Database.Account.Addresses = cfg.Migration.GoAccountDB
+	}
+	if cfg.Migration.GoRoomDB != "" {
+		cfg.Database.RoomServer.Addresses = cfg.Migration.GoRoomDB
+	}
+	// always use the rpc topic so failed batches are reported
+	cfg.Kafka.Producer.InputRoomEvent.Underlying = "nats"
+
+	synapse, err := sql.Open("postgres", cfg.Migration.SynapseDB)
+	if err != nil {
+		log.Fatalf("failed to open synapse db err:%v", err)
+	}
+	if err := synapse.Ping(); err != nil {
+		log.Fatalf("failed to connect to synapse db err:%v", err)
+	}
+
+	accountDB, err := common.GetDBInstance("accounts", cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to accounts db err:%v", err)
+	}
+	deviceDB, err := common.GetDBInstance("devices", cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to devices db err:%v", err)
+	}
+	roomDB, err := common.GetDBInstance("roomserver", cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to room server db err:%v", err)
+	}
+	pushDB, err := common.GetDBInstance("pushapi", cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to push api db err:%v", err)
+	}
+
+	idg, _ := uid.NewIdGenerator(0, 0)
+	rpcCli := common.NewRpcClient(cfg.Nats.Uri, idg)
+	rpcCli.Start(true)
+	rsRpcCli := rpc.NewRoomserverRpcClient(cfg, rpcCli, nil, nil, nil)
+
+	migrator, err := migration.NewMigrator(
+		cfg, synapse,
+		accountDB.(model.AccountsDatabase),
+		deviceDB.(model.DeviceDatabase),
+		roomDB.(model.RoomServerDatabase),
+		pushDB.(model.PushAPIDatabase),
+		rsRpcCli,
+	)
+	if err != nil {
+		log.Fatalf("failed to prepare migration err:%v", err)
+	}
+	migrator.SetBatchSize(*batchSize)
+	migrator.SetMediaOut(*mediaOut)
+	if err := migrator.Run(context.Background()); err != nil {
+		log.Fatalf("migration stopped, run again to resume err:%v", err)
+	}
+	log.Infof("migration done, run the cache-loader to refresh the caches")
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const clientPrefix = "/_matrix/client/r0"
+
+// The sync filters, the initial sync only needs the next batch
+const (
+	initialSyncFilter = `{"room":{"timeline":{"limit":1}}}`
+	syncFilter        = `{"room":{"timeline":{"limit":100}}}`
+)
+
+type user struct {
+	server    *ScenarioServer
+	serverIdx int
+	localpart string
+	userID    string
+	token     string
+}
+
+// matrixClient does the client api requests, recording their latency by
+// endpoint
+type matrixClient struct {
+	http *http.Client
+	// the syncs wait up to sync_timeout on the server before the response
+	syncHTTP *http.Client
+	rec      *recorder
+}
+
+func newMatrixClient(sc *Scenario, rec *recorder) *matrixClient {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: sc.MaxInFlight + sc.SyncConcurrency,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &matrixClient{
+		http:     &http.Client{Transport: transport, Timeout: sc.RequestTimeout},
+		syncHTTP: &http.Client{Transport: transport, Timeout: sc.SyncTimeout + sc.RequestTimeout},
+		rec:      rec,
+	}
+}
+
+// do sends body as json and decodes the response into out. The request is
+// recorded as endpoint, an error is returned for a status other than 2xx.
+func (c *matrixClient) do(
+	ctx context.Context, cli *http.Client, endpoint, method, target, token string, body, out interface{},
+) error {
+	var reader *bytes.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	res, err := cli.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.rec.record(endpoint, time.Since(start), 0)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	c.rec.record(endpoint, time.Since(start), res.StatusCode)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		if len(data) > 200 {
+			data = data[:200]
+		}
+		return fmt.Errorf("%s %s: %d %s", method, endpoint, res.StatusCode, string(data))
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func (c *matrixClient) login(ctx context.Context, u *user) error {
+	req := passwordRequest{
+		Type:     "m.login.password",
+		User:     u.localpart,
+		Password: u.server.Password,
+		DeviceID: "stress_" + u.localpart,
+	}
+	var resp loginResponse
+	if err := c.do(ctx, c.http, "login", http.MethodPost, u.server.URL+clientPrefix+"/login", "", &req, &resp); err != nil {
+		return err
+	}
+	u.userID = resp.UserID
+	u.token = resp.AccessToken
+	return nil
+}
+
+func (c *matrixClient) createRoom(ctx context.Context, u *user, name string) (string, error) {
+	req := createRoomRequest{
+		Name:            name,
+		Preset:          "public_chat",
+		CreationContent: map[string]interface{}{"m.federate": true},
+	}
+	var resp struct {
+		RoomID string `json:"room_id"`
+	}
+	err := c.do(ctx, c.http, "create_room", http.MethodPost, u.server.URL+clientPrefix+"/createRoom", u.token, &req, &resp)
+	return resp.RoomID, err
+}
+
+// join joins roomID through serverName, the server of its creator
+func (c *matrixClient) join(ctx context.Context, u *user, roomID, serverName string) error {
+	path := clientPrefix + "/join/" + url.PathEscape(roomID)
+	if serverName != u.server.ServerName {
+		path += "?server_name=" + url.QueryEscape(serverName)
+	}
+	return c.do(ctx, c.http, "join", http.MethodPost, u.server.URL+path, u.token, struct{}{}, nil)
+}
+
+type messageContent struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+	// Finds the message in the syncs, to measure its delivery latency
+	StressID string `json:"stress_id,omitempty"`
+}
+
+func (c *matrixClient) send(ctx context.Context, u *user, roomID, txnID string, content *messageContent) (string, error) {
+	path := clientPrefix + "/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + url.PathEscape(txnID)
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	err := c.do(ctx, c.http, "send", http.MethodPut, u.server.URL+path, u.token, content, &resp)
+	return resp.EventID, err
+}
+
+func (c *matrixClient) typing(ctx context.Context, u *user, roomID string) error {
+	path := clientPrefix + "/rooms/" + url.PathEscape(roomID) + "/typing/" + url.PathEscape(u.userID)
+	req := map[string]interface{}{"typing": true, "timeout": 5000}
+	return c.do(ctx, c.http, "typing", http.MethodPut, u.server.URL+path, u.token, req, nil)
+}
+
+func (c *matrixClient) receipt(ctx context.Context, u *user, roomID, eventID string) error {
+	path := clientPrefix + "/rooms/" + url.PathEscape(roomID) + "/receipt/m.read/" + url.PathEscape(eventID)
+	return c.do(ctx, c.http, "receipt", http.MethodPost, u.server.URL+path, u.token, struct{}{}, nil)
+}
+
+type syncEvent struct {
+	EventID string         `json:"event_id"`
+	Type    string         `json:"type"`
+	Sender  string         `json:"sender"`
+	Content messageContent `json:"content"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []syncEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+// sync does a /sync since since, the initial one when since is empty
+func (c *matrixClient) sync(ctx context.Context, u *user, since string, timeout time.Duration) (*syncResponse, error) {
+	endpoint, filter := "sync", syncFilter
+	query := url.Values{}
+	if since == "" {
+		endpoint, filter = "initial_sync", initialSyncFilter
+	} else {
+		query.Set("since", since)
+		query.Set("timeout", strconv.FormatInt(int64(timeout/time.Millisecond), 10))
+	}
+	query.Set("filter", filter)
+	var resp syncResponse
+	err := c.do(ctx, c.syncHTTP, endpoint, http.MethodGet, u.server.URL+clientPrefix+"/sync?"+query.Encode(), u.token, nil, &resp)
+	return &resp, err
+}
@@ -24,6 +24,7 @@ import (
 )
 
 type passwordRequest struct {
+	Type               string  `json:"type,omitempty"`
 	User               string  `json:"user"`
 	Password           string  `json:"password"`
 	DeviceID           string  `json:"device_id"`
@@ -30,7 +30,12 @@ var host = flag.String("host", "127.0.0.1", "Name for the server")
 var port = flag.Int("port", 8008, "port")
 var domain = flag.String("domain", "dendrite", "domain of server")
 var loop = flag.Int("loop", 100, "loop")
-var cmd = flag.String("cmd", "login", "cmd")
+var cmd = flag.String("cmd", "login", "cmd: login, createroom, invite or scenario")
+var scenario = flag.String("scenario", "", "scenario yaml of cmd scenario, see scenarios/")
+var report = flag.String("report", "report.json", "json report written by cmd scenario")
+var label = flag.String("label", "", "label of the build, put in the report")
+var baseline = flag.String("baseline", "", "report of an earlier build to compare with")
+var maxRegression = flag.Float64("max-regression", 0, "fail when a p99 grows more than this percent over the baseline, 0 never fails")
 var wg sync.WaitGroup
 
 var sucess uint32
@@ -65,6 +70,9 @@ func main() {
 		}
 	} else if *cmd == "invite" {
 		invite()
+	} else if *cmd == "scenario" {
+		runScenario()
+		return
 	}
 
 	wg.Wait()
@@ -121,3 +129,35 @@ func invite() {
 		}(i)
 	}
 }
+
+func runScenario() {
+	sc, err := loadScenario(*scenario)
+	if err != nil {
+		fmt.Println("scenario:", err)
+		os.Exit(1)
+	}
+	res, err := newRunner(sc).run(*label)
+	if err != nil {
+		fmt.Println("scenario:", err)
+		os.Exit(1)
+	}
+	if err = res.write(*report); err != nil {
+		fmt.Println("scenario: write report error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("scenario:%s use: %.1fs, messages/s: %.1f, lost deliveries: %d, report: %s\n",
+		sc.Name, res.Duration, res.MessagesPerSecond, res.LostDeliveries, *report)
+
+	if *baseline == "" {
+		return
+	}
+	base, err := readReport(*baseline)
+	if err != nil {
+		fmt.Println("scenario: read baseline error", err)
+		os.Exit(1)
+	}
+	if regressions := compareReports(base, res, *maxRegression); len(regressions) > 0 {
+		fmt.Printf("p99 regressed more than %.1f%%: %v\n", *maxRegression, regressions)
+		os.Exit(2)
+	}
+}
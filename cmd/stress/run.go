@@ -0,0 +1,362 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type room struct {
+	id      string
+	members []*user
+
+	mu        sync.Mutex
+	lastEvent string
+}
+
+func (r *room) setLastEvent(eventID string) {
+	r.mu.Lock()
+	r.lastEvent = eventID
+	r.mu.Unlock()
+}
+
+func (r *room) getLastEvent() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastEvent
+}
+
+// sentMessage is a message waiting for its arrival in the syncs
+type sentMessage struct {
+	at        time.Time
+	serverIdx int
+}
+
+type runner struct {
+	sc  *Scenario
+	cli *matrixClient
+	rec *recorder
+
+	users   []*user
+	rooms   []*room
+	syncing map[*user]bool
+
+	delivery    *endpointStats
+	fedDelivery *endpointStats
+	sent        sync.Map
+	expected    int64
+	delivered   int64
+	messages    int64
+	dropped     int64
+	txnSeq      int64
+	runID       string
+
+	inFlight chan struct{}
+	load     sync.WaitGroup
+}
+
+func newRunner(sc *Scenario) *runner {
+	rec := newRecorder()
+	r := &runner{
+		sc:          sc,
+		cli:         newMatrixClient(sc, rec),
+		rec:         rec,
+		syncing:     map[*user]bool{},
+		delivery:    newEndpointStats(),
+		fedDelivery: newEndpointStats(),
+		runID:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		inFlight:    make(chan struct{}, sc.MaxInFlight),
+	}
+	for i := range sc.Servers {
+		srv := &sc.Servers[i]
+		for n := 0; n < srv.Users; n++ {
+			r.users = append(r.users, &user{
+				server:    srv,
+				serverIdx: i,
+				localpart: srv.UserPrefix + strconv.Itoa(n),
+			})
+		}
+	}
+	return r
+}
+
+// parallel runs f on every index below n, max_in_flight at a time, and
+// returns the first error
+func (r *runner) parallel(n int, f func(i int) error) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		r.inFlight <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-r.inFlight
+				wg.Done()
+			}()
+			if err := f(i); err != nil {
+				once.Do(func() { first = err })
+			}
+		}(i)
+	}
+	wg.Wait()
+	return first
+}
+
+// setup logs the users in, then creates the rooms and joins their members
+func (r *runner) setup(ctx context.Context) error {
+	err := r.parallel(len(r.users), func(i int) error {
+		u := r.users[i]
+		if err := r.cli.login(ctx, u); err != nil {
+			return fmt.Errorf("login of %s on %s: %v", u.localpart, u.server.URL, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d users logged in\n", len(r.users))
+
+	r.rooms = make([]*room, r.sc.Rooms)
+	err = r.parallel(r.sc.Rooms, func(i int) error {
+		members := r.sc.members(i, len(r.users))
+		creator := r.users[members[0]]
+		roomID, err := r.cli.createRoom(ctx, creator, fmt.Sprintf("stress %s %d", r.runID, i))
+		if err != nil {
+			return fmt.Errorf("create room %d by %s: %v", i, creator.userID, err)
+		}
+		rm := &room{id: roomID, members: []*user{creator}}
+		for _, idx := range members[1:] {
+			u := r.users[idx]
+			if err := r.cli.join(ctx, u, roomID, creator.server.ServerName); err != nil {
+				// the room goes on without this member, the join errors
+				// are in the report
+				fmt.Printf("join %s to %s: %v\n", u.userID, roomID, err)
+				continue
+			}
+			rm.members = append(rm.members, u)
+		}
+		r.rooms[i] = rm
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d rooms created\n", len(r.rooms))
+	return nil
+}
+
+// startSyncs runs the sync loops of sync_concurrency users, spread over
+// all the users, until ctx is done. It returns once the initial syncs are
+// done, so no message is sent before they listen.
+func (r *runner) startSyncs(ctx context.Context, done *sync.WaitGroup) {
+	var initial sync.WaitGroup
+	n := r.sc.SyncConcurrency
+	for i := 0; i < n; i++ {
+		u := r.users[i*len(r.users)/n]
+		r.syncing[u] = true
+	}
+	for u := range r.syncing {
+		initial.Add(1)
+		done.Add(1)
+		go func(u *user) {
+			defer done.Done()
+			since, first := "", true
+			for ctx.Err() == nil {
+				resp, err := r.cli.sync(ctx, u, since, r.sc.SyncTimeout)
+				if first {
+					first = false
+					initial.Done()
+					if err != nil {
+						fmt.Printf("initial sync of %s: %v\n", u.userID, err)
+						return
+					}
+				}
+				if err != nil {
+					// no busy loop on a failing server
+					select {
+					case <-ctx.Done():
+					case <-time.After(time.Second):
+					}
+					continue
+				}
+				r.onSync(u, resp)
+				since = resp.NextBatch
+			}
+		}(u)
+	}
+	initial.Wait()
+}
+
+// onSync records the delivery of the messages of the other users
+func (r *runner) onSync(u *user, resp *syncResponse) {
+	now := time.Now()
+	for _, joined := range resp.Rooms.Join {
+		for _, ev := range joined.Timeline.Events {
+			if ev.Type != "m.room.message" || ev.Content.StressID == "" || ev.Sender == u.userID {
+				continue
+			}
+			v, ok := r.sent.Load(ev.Content.StressID)
+			if !ok {
+				continue
+			}
+			msg := v.(*sentMessage)
+			if msg.serverIdx == u.serverIdx {
+				r.delivery.observe(now.Sub(msg.at))
+			} else {
+				r.fedDelivery.observe(now.Sub(msg.at))
+			}
+			atomic.AddInt64(&r.delivered, 1)
+		}
+	}
+}
+
+// pick returns a random room and one of its members
+func (r *runner) pick() (*room, *user) {
+	rm := r.rooms[rand.Intn(len(r.rooms))]
+	return rm, rm.members[rand.Intn(len(rm.members))]
+}
+
+func (r *runner) sendMessage(ctx context.Context) {
+	rm, u := r.pick()
+	seq := atomic.AddInt64(&r.txnSeq, 1)
+	stressID := r.runID + "." + strconv.FormatInt(seq, 10)
+
+	expected := int64(0)
+	for _, m := range rm.members {
+		if m != u && r.syncing[m] {
+			expected++
+		}
+	}
+	// stored before sending, the message can arrive before the response
+	r.sent.Store(stressID, &sentMessage{at: time.Now(), serverIdx: u.serverIdx})
+	atomic.AddInt64(&r.expected, expected)
+
+	eventID, err := r.cli.send(ctx, u, rm.id, stressID, &messageContent{
+		MsgType:  "m.text",
+		Body:     "stress message " + stressID,
+		StressID: stressID,
+	})
+	if err != nil {
+		atomic.AddInt64(&r.expected, -expected)
+		return
+	}
+	atomic.AddInt64(&r.messages, 1)
+	rm.setLastEvent(eventID)
+}
+
+func (r *runner) sendTyping(ctx context.Context) {
+	rm, u := r.pick()
+	r.cli.typing(ctx, u, rm.id) // nolint: errcheck
+}
+
+func (r *runner) sendReceipt(ctx context.Context) {
+	rm, u := r.pick()
+	if eventID := rm.getLastEvent(); eventID != "" {
+		r.cli.receipt(ctx, u, rm.id, eventID) // nolint: errcheck
+	}
+}
+
+// generate calls action rate times per second until stop is closed. A tick
+// finding max_in_flight requests pending is dropped, not delayed, so a slow
+// server does not lower the rate asked.
+func (r *runner) generate(ctx context.Context, stop chan struct{}, rate float64, action func(context.Context)) {
+	if rate <= 0 {
+		return
+	}
+	r.load.Add(1)
+	go func() {
+		defer r.load.Done()
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				select {
+				case r.inFlight <- struct{}{}:
+					r.load.Add(1)
+					go func() {
+						defer func() {
+							<-r.inFlight
+							r.load.Done()
+						}()
+						action(ctx)
+					}()
+				default:
+					atomic.AddInt64(&r.dropped, 1)
+				}
+			}
+		}
+	}()
+}
+
+// run does the scenario and returns its report
+func (r *runner) run(label string) (*Report, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := r.setup(ctx); err != nil {
+		return nil, err
+	}
+
+	var syncs sync.WaitGroup
+	r.startSyncs(ctx, &syncs)
+	fmt.Printf("%d users syncing, running %s\n", len(r.syncing), r.sc.Duration)
+
+	report := &Report{
+		Scenario:  r.sc.Name,
+		Label:     label,
+		StartedAt: time.Now(),
+		Users:     len(r.users),
+		Rooms:     len(r.rooms),
+	}
+	stop := make(chan struct{})
+	r.generate(ctx, stop, r.sc.MessageRate, r.sendMessage)
+	r.generate(ctx, stop, r.sc.TypingRate, r.sendTyping)
+	r.generate(ctx, stop, r.sc.ReceiptRate, r.sendReceipt)
+	time.Sleep(r.sc.Duration)
+	close(stop)
+	report.Duration = time.Since(report.StartedAt).Seconds()
+	r.load.Wait()
+
+	// wait for the messages in flight, at most drain
+	deadline := time.Now().Add(r.sc.Drain)
+	for time.Now().Before(deadline) && atomic.LoadInt64(&r.delivered) < atomic.LoadInt64(&r.expected) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cancel()
+	syncs.Wait()
+
+	report.Endpoints = r.rec.stats()
+	report.Delivery = r.delivery.stats()
+	report.FederationDelivery = r.fedDelivery.stats()
+	report.ExpectedDeliveries = atomic.LoadInt64(&r.expected)
+	report.LostDeliveries = report.ExpectedDeliveries - atomic.LoadInt64(&r.delivered)
+	if report.LostDeliveries < 0 {
+		// a message the server sent twice
+		report.LostDeliveries = 0
+	}
+	report.MessagesPerSecond = float64(atomic.LoadInt64(&r.messages)) / report.Duration
+	report.Dropped = atomic.LoadInt64(&r.dropped)
+	return report, nil
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Scenario describes a load run, see scenarios/*.yaml
+type Scenario struct {
+	Name string `yaml:"name"`
+	// The servers and their users. A room is created by its first member,
+	// the members on the other servers join over federation.
+	Servers []ScenarioServer `yaml:"servers"`
+	Rooms   int              `yaml:"rooms"`
+	// Users joined to each room, picked over all the users of all the
+	// servers, every user joins every room when 0
+	MembersPerRoom int `yaml:"members_per_room"`
+
+	// How long the load runs, then how long the syncs keep waiting for the
+	// messages in flight
+	Duration time.Duration `yaml:"duration"`
+	Drain    time.Duration `yaml:"drain"`
+
+	// Messages, typing notifications and read receipts sent per second, by
+	// random members of random rooms
+	MessageRate float64 `yaml:"message_rate"`
+	TypingRate  float64 `yaml:"typing_rate"`
+	ReceiptRate float64 `yaml:"receipt_rate"`
+	// Users running a /sync loop, spread over the servers. The delivery
+	// latency is measured on them.
+	SyncConcurrency int           `yaml:"sync_concurrency"`
+	SyncTimeout     time.Duration `yaml:"sync_timeout"`
+
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// Requests in flight at most, the ticks over it are counted as dropped
+	MaxInFlight int `yaml:"max_in_flight"`
+}
+
+// ScenarioServer is a homeserver and the users logging in to it
+type ScenarioServer struct {
+	// http(s)://host:port of the client api
+	URL        string `yaml:"url"`
+	ServerName string `yaml:"server_name"`
+	// Users <user_prefix><n>, n from 0, all with password
+	Users      int    `yaml:"users"`
+	UserPrefix string `yaml:"user_prefix"`
+	Password   string `yaml:"password"`
+}
+
+func loadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	if err = yaml.UnmarshalStrict(data, &s); err != nil {
+		return nil, err
+	}
+	s.setDefaults()
+	if err = s.check(); err != nil {
+		return nil, fmt.Errorf("scenario %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+func (s *Scenario) setDefaults() {
+	if s.Drain == 0 {
+		s.Drain = 10 * time.Second
+	}
+	if s.SyncTimeout == 0 {
+		s.SyncTimeout = 30 * time.Second
+	}
+	if s.RequestTimeout == 0 {
+		s.RequestTimeout = 30 * time.Second
+	}
+	if s.MaxInFlight == 0 {
+		s.MaxInFlight = 1000
+	}
+	for i := range s.Servers {
+		srv := &s.Servers[i]
+		srv.URL = strings.TrimSuffix(srv.URL, "/")
+		if srv.UserPrefix == "" {
+			srv.UserPrefix = "test"
+		}
+	}
+}
+
+func (s *Scenario) check() error {
+	if len(s.Servers) == 0 {
+		return errors.New("no servers")
+	}
+	users := 0
+	for i, srv := range s.Servers {
+		if srv.URL == "" || srv.ServerName == "" {
+			return fmt.Errorf("servers[%d] needs url and server_name", i)
+		}
+		if srv.Users <= 0 {
+			return fmt.Errorf("servers[%d] has no users", i)
+		}
+		users += srv.Users
+	}
+	if s.Rooms <= 0 {
+		return errors.New("rooms must be positive")
+	}
+	if s.MembersPerRoom < 0 || s.MembersPerRoom > users {
+		return fmt.Errorf("members_per_room must be between 0 and the %d users", users)
+	}
+	if s.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if s.MessageRate < 0 || s.TypingRate < 0 || s.ReceiptRate < 0 {
+		return errors.New("rates must not be negative")
+	}
+	if s.SyncConcurrency < 0 || s.SyncConcurrency > users {
+		return fmt.Errorf("sync_concurrency must be between 0 and the %d users", users)
+	}
+	return nil
+}
+
+// members returns the indexes in users of the members of room. They are
+// spread over all the users so the rooms mix the users of every server, and
+// the next room starts one user further.
+func (s *Scenario) members(room, users int) []int {
+	n := s.MembersPerRoom
+	if n == 0 {
+		n = users
+	}
+	stride := users / n
+	members := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		members = append(members, (room+i*stride)%users)
+	}
+	return members
+}
@@ -0,0 +1,248 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadScenarios(t *testing.T) {
+	paths, _ := filepath.Glob("scenarios/*.yaml")
+	if len(paths) == 0 {
+		t.Fatal("no scenarios")
+	}
+	for _, path := range paths {
+		sc, err := loadScenario(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		users := 0
+		for _, srv := range sc.Servers {
+			users += srv.Users
+		}
+		for room := 0; room < sc.Rooms; room++ {
+			members := sc.members(room, users)
+			dup := map[int]bool{}
+			for _, m := range members {
+				if dup[m] {
+					t.Fatalf("%s: room %d has user %d twice", path, room, m)
+				}
+				dup[m] = true
+			}
+		}
+		if sc.Drain != 10*time.Second || sc.MaxInFlight != 1000 {
+			t.Fatalf("%s: defaults not set, %+v", path, sc)
+		}
+	}
+}
+
+func TestScenarioCheck(t *testing.T) {
+	cases := map[string]string{
+		"no servers":       "rooms: 1\nduration: 1s\n",
+		"no users":         "servers: [{url: http://a, server_name: a}]\nrooms: 1\nduration: 1s\n",
+		"too many members": "servers: [{url: http://a, server_name: a, users: 2}]\nrooms: 1\nmembers_per_room: 3\nduration: 1s\n",
+		"no duration":      "servers: [{url: http://a, server_name: a, users: 2}]\nrooms: 1\n",
+		"unknown field":    "servers: [{url: http://a, server_name: a, users: 2}]\nrooms: 1\nduration: 1s\nmessages: 3\n",
+	}
+	dir, err := ioutil.TempDir("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range cases {
+		path := filepath.Join(dir, strings.Replace(name, " ", "_", -1)+".yaml")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadScenario(path); err == nil {
+			t.Fatalf("%s: loaded", name)
+		}
+	}
+}
+
+func TestCompareReports(t *testing.T) {
+	base := &Report{
+		Endpoints: map[string]Stats{"send": {Count: 10, P99: 10}, "sync": {Count: 10, P99: 100}},
+		Delivery:  Stats{Count: 10, P99: 50},
+	}
+	r := &Report{
+		Endpoints: map[string]Stats{"send": {Count: 10, P99: 11}, "sync": {Count: 10, P99: 200}},
+		Delivery:  Stats{Count: 10, P99: 80},
+	}
+	regressions := compareReports(base, r, 20)
+	if strings.Join(regressions, ",") != "delivery,sync" {
+		t.Fatalf("regressions %v", regressions)
+	}
+	if regressions = compareReports(base, r, 0); len(regressions) != 0 {
+		t.Fatalf("regressions %v without a max", regressions)
+	}
+}
+
+type fakeEvent struct {
+	roomID string
+	event  syncEvent
+}
+
+// fakeHomeservers is the client api of servers sharing their rooms, as
+// federated servers do
+type fakeHomeservers struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	rooms   map[string]map[string]bool
+	events  []fakeEvent
+}
+
+func newFakeHomeservers() *fakeHomeservers {
+	return &fakeHomeservers{changed: make(chan struct{}), rooms: map[string]map[string]bool{}}
+}
+
+func (f *fakeHomeservers) handler(serverName string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, clientPrefix)
+		userID := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		var resp interface{} = struct{}{}
+		switch {
+		case path == "/login":
+			var login passwordRequest
+			json.NewDecoder(req.Body).Decode(&login) // nolint: errcheck
+			userID = "@" + login.User + ":" + serverName
+			resp = loginResponse{UserID: userID, AccessToken: userID}
+		case path == "/createRoom":
+			f.mu.Lock()
+			roomID := "!" + strconv.Itoa(len(f.rooms)) + ":" + serverName
+			f.rooms[roomID] = map[string]bool{userID: true}
+			f.mu.Unlock()
+			resp = map[string]string{"room_id": roomID}
+		case strings.HasPrefix(path, "/join/"):
+			f.mu.Lock()
+			f.rooms[strings.TrimPrefix(path, "/join/")][userID] = true
+			f.mu.Unlock()
+		case strings.Contains(path, "/send/"):
+			var content messageContent
+			json.NewDecoder(req.Body).Decode(&content) // nolint: errcheck
+			roomID := strings.Split(strings.TrimPrefix(path, "/rooms/"), "/")[0]
+			f.mu.Lock()
+			eventID := "$" + strconv.Itoa(len(f.events))
+			f.events = append(f.events, fakeEvent{roomID, syncEvent{
+				EventID: eventID, Type: "m.room.message", Sender: userID, Content: content,
+			}})
+			close(f.changed)
+			f.changed = make(chan struct{})
+			f.mu.Unlock()
+			resp = map[string]string{"event_id": eventID}
+		case path == "/sync":
+			resp = f.sync(userID, req)
+		}
+		json.NewEncoder(w).Encode(resp) // nolint: errcheck
+	})
+}
+
+func (f *fakeHomeservers) sync(userID string, req *http.Request) *syncResponse {
+	since, _ := strconv.Atoi(req.URL.Query().Get("since"))
+	initial := req.URL.Query().Get("since") == ""
+	timeout, _ := strconv.Atoi(req.URL.Query().Get("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Millisecond)
+	resp := &syncResponse{}
+	for {
+		f.mu.Lock()
+		resp.NextBatch = strconv.Itoa(len(f.events))
+		changed := f.changed
+		found := false
+		if !initial {
+			for _, ev := range f.events[since:] {
+				if !f.rooms[ev.roomID][userID] {
+					continue
+				}
+				if resp.Rooms.Join == nil {
+					resp.Rooms.Join = map[string]struct {
+						Timeline struct {
+							Events []syncEvent `json:"events"`
+						} `json:"timeline"`
+					}{}
+				}
+				joined := resp.Rooms.Join[ev.roomID]
+				joined.Timeline.Events = append(joined.Timeline.Events, ev.event)
+				resp.Rooms.Join[ev.roomID] = joined
+				found = true
+			}
+		}
+		f.mu.Unlock()
+		if initial || found {
+			return resp
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return resp
+		case <-req.Context().Done():
+			return resp
+		}
+	}
+}
+
+func TestRunScenario(t *testing.T) {
+	fake := newFakeHomeservers()
+	a := httptest.NewServer(fake.handler("a"))
+	defer a.Close()
+	b := httptest.NewServer(fake.handler("b"))
+	defer b.Close()
+
+	sc := &Scenario{
+		Name: "test",
+		Servers: []ScenarioServer{
+			{URL: a.URL, ServerName: "a", Users: 4},
+			{URL: b.URL, ServerName: "b", Users: 4},
+		},
+		Rooms:           2,
+		MembersPerRoom:  4,
+		Duration:        500 * time.Millisecond,
+		Drain:           5 * time.Second,
+		MessageRate:     40,
+		TypingRate:      10,
+		ReceiptRate:     10,
+		SyncConcurrency: 8,
+		SyncTimeout:     time.Second,
+	}
+	sc.setDefaults()
+	if err := sc.check(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := newRunner(sc).run("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Endpoints["send"].Count == 0 || report.Endpoints["send"].Errors != 0 {
+		t.Fatalf("send stats %+v", report.Endpoints["send"])
+	}
+	if report.ExpectedDeliveries == 0 || report.LostDeliveries != 0 {
+		t.Fatalf("expected %d deliveries, lost %d", report.ExpectedDeliveries, report.LostDeliveries)
+	}
+	if report.Delivery.Count == 0 || report.FederationDelivery.Count == 0 {
+		t.Fatalf("delivery %+v federation delivery %+v", report.Delivery, report.FederationDelivery)
+	}
+	if report.Delivery.Count+report.FederationDelivery.Count != report.ExpectedDeliveries {
+		t.Fatalf("%d deliveries recorded, %d expected", report.Delivery.Count+report.FederationDelivery.Count, report.ExpectedDeliveries)
+	}
+}
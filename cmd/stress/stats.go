@@ -0,0 +1,236 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// latencies are recorded in microseconds, up to an hour
+const (
+	histMin     = 1
+	histMax     = int64(time.Hour / time.Microsecond)
+	histSigfigs = 3
+)
+
+// endpointStats is the latency histogram and outcomes of one endpoint
+type endpointStats struct {
+	mu       sync.Mutex
+	hist     *hdrhistogram.Histogram
+	errors   int64
+	statuses map[string]int64
+}
+
+func newEndpointStats() *endpointStats {
+	return &endpointStats{
+		hist:     hdrhistogram.New(histMin, histMax, histSigfigs),
+		statuses: map[string]int64{},
+	}
+}
+
+// observe adds a latency without an outcome
+func (e *endpointStats) observe(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hist.RecordValue(int64(d / time.Microsecond)) // nolint: errcheck
+}
+
+// record adds a request that took d, status is 0 when no response came back
+func (e *endpointStats) record(d time.Duration, status int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hist.RecordValue(int64(d / time.Microsecond)) // nolint: errcheck
+	if status == 0 {
+		e.errors++
+		e.statuses["error"]++
+		return
+	}
+	if status < 200 || status > 299 {
+		e.errors++
+	}
+	e.statuses[strconv.Itoa(status)]++
+}
+
+// Stats is the summary of an endpointStats in the report, in milliseconds
+type Stats struct {
+	Count    int64            `json:"count"`
+	Errors   int64            `json:"errors"`
+	Statuses map[string]int64 `json:"statuses,omitempty"`
+	Min      float64          `json:"min_ms"`
+	Mean     float64          `json:"mean_ms"`
+	P50      float64          `json:"p50_ms"`
+	P90      float64          `json:"p90_ms"`
+	P99      float64          `json:"p99_ms"`
+	P999     float64          `json:"p999_ms"`
+	Max      float64          `json:"max_ms"`
+}
+
+func ms(us int64) float64 {
+	return float64(us) / 1000
+}
+
+func (e *endpointStats) stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := Stats{
+		Count:  e.hist.TotalCount(),
+		Errors: e.errors,
+	}
+	if len(e.statuses) > 0 {
+		s.Statuses = make(map[string]int64, len(e.statuses))
+		for k, v := range e.statuses {
+			s.Statuses[k] = v
+		}
+	}
+	if s.Count == 0 {
+		return s
+	}
+	s.Min = ms(e.hist.Min())
+	s.Mean = e.hist.Mean() / 1000
+	s.P50 = ms(e.hist.ValueAtQuantile(50))
+	s.P90 = ms(e.hist.ValueAtQuantile(90))
+	s.P99 = ms(e.hist.ValueAtQuantile(99))
+	s.P999 = ms(e.hist.ValueAtQuantile(99.9))
+	s.Max = ms(e.hist.Max())
+	return s
+}
+
+// recorder holds the stats of all the endpoints, by name
+type recorder struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointStats
+}
+
+func newRecorder() *recorder {
+	return &recorder{endpoints: map[string]*endpointStats{}}
+}
+
+func (r *recorder) get(name string) *endpointStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.endpoints[name]
+	if !ok {
+		e = newEndpointStats()
+		r.endpoints[name] = e
+	}
+	return e
+}
+
+func (r *recorder) record(name string, d time.Duration, status int) {
+	r.get(name).record(d, status)
+}
+
+func (r *recorder) stats() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]Stats, len(r.endpoints))
+	for name, e := range r.endpoints {
+		stats[name] = e.stats()
+	}
+	return stats
+}
+
+// Report is the result of a scenario run, written as json so the runs of
+// two builds can be compared
+type Report struct {
+	Scenario  string    `json:"scenario"`
+	Label     string    `json:"label,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	// Seconds the load ran, without setup and drain
+	Duration float64 `json:"duration_s"`
+	Users    int     `json:"users"`
+	Rooms    int     `json:"rooms"`
+	// Latency of the requests, by endpoint
+	Endpoints map[string]Stats `json:"endpoints"`
+	// Latency from sending a message to its arrival in the /sync of another
+	// member, on the same server and on another one
+	Delivery           Stats `json:"delivery"`
+	FederationDelivery Stats `json:"federation_delivery"`
+	// Arrivals expected in the syncs, and the ones missing after the drain
+	ExpectedDeliveries int64 `json:"expected_deliveries"`
+	LostDeliveries     int64 `json:"lost_deliveries"`
+	// Messages sent successfully per second, and the ticks dropped as
+	// max_in_flight requests were pending
+	MessagesPerSecond float64 `json:"messages_per_second"`
+	Dropped           int64   `json:"dropped"`
+}
+
+func (r *Report) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func readReport(path string) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// compareReports prints the p50 and p99 of every endpoint of base and r,
+// and returns the ones whose p99 grew more than maxRegression percent. The
+// delivery latencies are compared as the endpoints "delivery" and
+// "federation_delivery".
+func compareReports(base, r *Report, maxRegression float64) []string {
+	baseStats := map[string]Stats{"delivery": base.Delivery, "federation_delivery": base.FederationDelivery}
+	for name, s := range base.Endpoints {
+		baseStats[name] = s
+	}
+	stats := map[string]Stats{"delivery": r.Delivery, "federation_delivery": r.FederationDelivery}
+	for name, s := range r.Endpoints {
+		stats[name] = s
+	}
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%-22s %12s %12s %12s %12s %8s\n", "endpoint", "base p50", "p50", "base p99", "p99", "p99 +%")
+	regressions := []string{}
+	for _, name := range names {
+		s, b := stats[name], baseStats[name]
+		if s.Count == 0 || b.Count == 0 {
+			continue
+		}
+		growth := 0.0
+		if b.P99 > 0 {
+			growth = (s.P99 - b.P99) / b.P99 * 100
+		}
+		fmt.Printf("%-22s %12.2f %12.2f %12.2f %12.2f %8.1f\n", name, b.P50, s.P50, b.P99, s.P99, growth)
+		if maxRegression > 0 && growth > maxRegression {
+			regressions = append(regressions, name)
+		}
+	}
+	fmt.Printf("messages per second: base %.1f, now %.1f\n", base.MessagesPerSecond, r.MessagesPerSecond)
+	return regressions
+}
@@ -60,7 +60,7 @@ func SetAPIProcessor(p APIProcessor) {
 	}
 	prefix := p.GetPrefix()
 	for _, v := range prefix {
-		if v != "r0" && v != "v1" && v != "inr0" && v != "sys" && v != "unstable" && v != "mediaR0" && v != "mediaV1" && v != "fedV1" {
+		if v != "r0" && v != "v1" && v != "inr0" && v != "sys" && v != "unstable" && v != "mediaR0" && v != "mediaV1" && v != "fedV1" && v != "clientV1" && v != "admin" {
 			log.Panicf("invalid prefix type %s for [%s]", v, p.GetRoute())
 			return
 		}
@@ -326,6 +326,9 @@ func (c *APIConsumer) process(ctx context.Context, input *internals.InputMsg) (*
 		output.MsgType = input.MsgType
 	}
 	output.Code = code
+	if h, ok := resp.(core.HeaderCoder); ok {
+		output.Headers, _ = json.Marshal(h.Headers())
+	}
 	var err error
 	if resp != nil {
 		output.Body, err = resp.Encode()
@@ -0,0 +1,113 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package audit records the security relevant actions, logins, logouts,
+// password changes, device deletions, room dismissals, power levels, bans,
+// kicks, key uploads and the admin api, as typed events. The events go to
+// the hash chained table of the accounts database and/or to the kafka audit
+// topic, as configured in the audit section.
+package audit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+var (
+	cfg       *config.Dendrite
+	accountDB model.AccountsDatabase
+)
+
+// the details never hold a value whose key contains one of these
+var secretKeys = []string{"token", "password", "secret"}
+
+// Init sets where the events are sent, Emit only logs them before
+func Init(c *config.Dendrite, db model.AccountsDatabase) {
+	cfg = c
+	accountDB = db
+}
+
+// Emit records ev. Ts is set when zero. A failure is logged, it never fails
+// the action audited.
+func Emit(ctx context.Context, ev *authtypes.AuditEvent) {
+	if ev.Ts == 0 {
+		ev.Ts = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	scrub(ev)
+
+	if cfg == nil || (!cfg.Audit.Table && !cfg.Audit.Kafka) {
+		log.Infow("audit", log.KeysAndValues{"type", ev.Type, "user_id", ev.UserID, "device_id", ev.DeviceID,
+			"ip", ev.IP, "target", ev.Target, "room_id", ev.RoomID, "success", ev.Success})
+		return
+	}
+	if cfg.Audit.Table && accountDB != nil {
+		if err := accountDB.InsertAuditEvent(ctx, ev); err != nil {
+			log.Errorf("audit: store %s event of %s error %v", ev.Type, ev.UserID, err)
+		}
+	}
+	if cfg.Audit.Kafka {
+		if err := publish(ctx, ev); err != nil {
+			log.Errorf("audit: publish %s event of %s error %v", ev.Type, ev.UserID, err)
+		}
+	}
+}
+
+// scrub drops the details that could hold a credential
+func scrub(ev *authtypes.AuditEvent) {
+	for k := range ev.Details {
+		lower := strings.ToLower(k)
+		for _, secret := range secretKeys {
+			if strings.Contains(lower, secret) {
+				delete(ev.Details, k)
+				break
+			}
+		}
+	}
+}
+
+func publish(ctx context.Context, ev *authtypes.AuditEvent) error {
+	producer := cfg.Kafka.Producer.Audit
+	span, _ := common.StartSpanFromContext(ctx, producer.Name)
+	defer span.Finish()
+	common.ExportMetricsBeforeSending(span, producer.Name, producer.Underlying)
+	return common.GetTransportMultiplexer().SendWithRetry(
+		producer.Underlying,
+		producer.Name,
+		&core.TransportPubMsg{
+			Keys:    []byte(ev.UserID),
+			Obj:     ev,
+			Headers: common.InjectSpanToHeaderForSending(span),
+		})
+}
+
+// IsAuditor reports whether userID is one of the configured auditors
+func IsAuditor(userID string) bool {
+	if cfg == nil {
+		return false
+	}
+	for _, auditor := range cfg.Audit.Auditors {
+		if auditor == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+type testAccountDB struct {
+	model.AccountsDatabase
+	events []authtypes.AuditEvent
+	err    error
+}
+
+func (d *testAccountDB) InsertAuditEvent(ctx context.Context, ev *authtypes.AuditEvent) error {
+	if d.err != nil {
+		return d.err
+	}
+	d.events = append(d.events, *ev)
+	return nil
+}
+
+func TestEmit(t *testing.T) {
+	defer Init(nil, nil)
+	ctx := context.Background()
+	db := &testAccountDB{}
+	cfg := &config.Dendrite{}
+	cfg.Audit.Auditors = []string{"@auditor:x"}
+
+	// only logged
+	Init(cfg, db)
+	Emit(ctx, &authtypes.AuditEvent{Type: authtypes.AuditLogin, UserID: "@alice:x", Success: true})
+	if len(db.events) != 0 {
+		t.Fatalf("stored without audit.table: %+v", db.events)
+	}
+
+	cfg.Audit.Table = true
+	Emit(ctx, &authtypes.AuditEvent{
+		Type:    authtypes.AuditLogin,
+		UserID:  "@alice:x",
+		Success: false,
+		Details: map[string]string{"login_type": "m.login.token", "access_token": "t", "Password": "p", "client_secret": "s"},
+	})
+	if len(db.events) != 1 {
+		t.Fatalf("stored %+v", db.events)
+	}
+	ev := db.events[0]
+	if ev.Ts == 0 || len(ev.Details) != 1 || ev.Details["login_type"] != "m.login.token" {
+		t.Fatalf("stored %+v", ev)
+	}
+
+	// a failing sink never fails the caller
+	db.err = errors.New("database is down")
+	Emit(ctx, &authtypes.AuditEvent{Type: authtypes.AuditLogout, UserID: "@alice:x", Success: true})
+
+	if !IsAuditor("@auditor:x") || IsAuditor("@alice:x") {
+		t.Fatalf("auditors %v", cfg.Audit.Auditors)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	util "github.com/finogeeks/ligase/skunkworks/gomatrixutil"
 	"github.com/finogeeks/ligase/skunkworks/log"
@@ -36,7 +37,10 @@ import (
 )
 
 func VerifyToken(token string, requestURI string, cache service.Cache, cfg config.Dendrite, devFilter *filter.SimpleFilter) (*authtypes.Device, *util.JSONResponse) {
-	device, guest, _ := ExtractToken(cfg.Macaroon.Key, cfg.Macaroon.Id, cfg.Macaroon.Loc, token)
+	device, guest, expireTs, _ := ExtractExpiringToken(cfg.Macaroon.Key, cfg.Macaroon.Id, cfg.Macaroon.Loc, token)
+	if resErr := checkTokenExpired(device, expireTs, requestURI); resErr != nil {
+		return nil, resErr
+	}
 
 	if device != nil && device.ID == "" && guest == false {
 		userId := device.UserID
@@ -60,7 +64,10 @@ func VerifyToken(token string, requestURI string, cache service.Cache, cfg confi
 			}
 			return nil, resErr
 		}
-		device, _, _ = ExtractToken(cfg.Macaroon.Key, cfg.Macaroon.Id, cfg.Macaroon.Loc, migToken)
+		device, _, expireTs, _ = ExtractExpiringToken(cfg.Macaroon.Key, cfg.Macaroon.Id, cfg.Macaroon.Loc, migToken)
+		if resErr := checkTokenExpired(device, expireTs, requestURI); resErr != nil {
+			return nil, resErr
+		}
 		if device == nil || device.ID == "" {
 			log.Infof("guest token invalid:%s", migToken)
 		}
@@ -68,6 +75,15 @@ func VerifyToken(token string, requestURI string, cache service.Cache, cfg confi
 			device.IsHuman = true
 		}
 	}
+	// tokens imported from another homeserver map to a ligase token
+	if device == nil && token != "" && cfg.Migration.AcceptTokens {
+		if migToken, err := cache.GetMigTokenByToken(token); err == nil && migToken != "" {
+			device, _, expireTs, _ = ExtractExpiringToken(cfg.Macaroon.Key, cfg.Macaroon.Id, cfg.Macaroon.Loc, migToken)
+			if resErr := checkTokenExpired(device, expireTs, requestURI); resErr != nil {
+				return nil, resErr
+			}
+		}
+	}
 	//device = cache.GetDeviceByToken(token)
 	if device == nil {
 		log.Infof("invalid token device is nil,req: %s", requestURI)
@@ -106,6 +122,19 @@ func VerifyToken(token string, requestURI string, cache service.Cache, cfg confi
 	return device, nil
 }
 
+// checkTokenExpired soft logs out the device once its token has expired, an
+// expireTs of 0 never expires
+func checkTokenExpired(device *authtypes.Device, expireTs int64, requestURI string) *util.JSONResponse {
+	if device == nil || expireTs <= 0 || time.Now().UnixNano()/int64(time.Millisecond) < expireTs {
+		return nil
+	}
+	log.Infof("expired token user:%s device:%s, req:%s", device.UserID, device.ID, requestURI)
+	return &util.JSONResponse{
+		Code: 401,
+		JSON: jsonerror.SoftLogout("Access token has expired"),
+	}
+}
+
 func filterTokenCheck(userId string) bool {
 	return strings.Contains(userId, "-qq:") || strings.Contains(userId, "-bot:") || strings.Contains(userId, "@qq_")
 }
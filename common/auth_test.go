@@ -0,0 +1,71 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/model/service"
+)
+
+// migTokenCache maps imported tokens to ligase tokens
+type migTokenCache struct {
+	service.Cache
+	tokens map[string]string
+}
+
+func (c *migTokenCache) GetMigTokenByToken(token string) (string, error) {
+	return c.tokens[token], nil
+}
+
+func TestVerifyMigratedTokenExpiry(t *testing.T) {
+	cfg := config.Dendrite{}
+	cfg.Macaroon.Key = "key"
+	cfg.Macaroon.Id = "id"
+	cfg.Macaroon.Loc = "loc"
+	cfg.Migration.AcceptTokens = true
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	build := func(deviceID string, expireTs int64) string {
+		token, err := BuildExpiringToken(cfg.Macaroon.Key, cfg.Macaroon.Id, cfg.Macaroon.Loc, "@alice:test", "", false, deviceID, "actual", true, expireTs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// a token without a device id resolves through the migrated token too
+	noDevice := build("", 0)
+	cache := &migTokenCache{tokens: map[string]string{
+		"imported-valid":   build("DEVICE", now+60000),
+		"imported-expired": build("DEVICE", now-1000),
+		noDevice:           build("DEVICE", now-1000),
+	}}
+
+	if device, resErr := VerifyToken("imported-valid", "/sync", cache, cfg, nil); resErr != nil || device.ID != "DEVICE" {
+		t.Fatalf("valid migrated token refused: %v", resErr)
+	}
+	for _, token := range []string{"imported-expired", noDevice} {
+		device, resErr := VerifyToken(token, "/sync", cache, cfg, nil)
+		if device != nil || resErr == nil || resErr.Code != 401 {
+			t.Fatalf("expired migrated token accepted")
+		}
+		if e, ok := resErr.JSON.(*jsonerror.UnknownTokenError); !ok || !e.SoftLogout {
+			t.Fatalf("expired migrated token did not soft log out: %v", resErr.JSON)
+		}
+	}
+}
@@ -59,25 +59,10 @@ type BaseDendrite struct {
 // The componentName is used for logging purposes, and should be a friendly name
 // of the compontent running, e.g. "SyncAPI"
 func NewBaseDendrite(cfg *config.Dendrite, componentName string) *BaseDendrite {
-	logCfg := new(log.LogConfig)
-	logCfg.Level = cfg.Log.Level
-	logCfg.Files = cfg.Log.Files
-	/*for idx,f := range logCfg.Files {
-		fs := strings.Split(f,"/")
-		ls := len(fs)
-		logCfg.Files[idx] = "/Users/chenzr/workspace/code/finochat/" + fs[ls-3] +  "/log/" + componentName + ".log"
-	}*/
-	logCfg.WriteToStdout = cfg.Log.WriteToStdout
-	logCfg.ZapConfig.MaxSize = cfg.Log.ZapConfig.MaxSize
-	logCfg.ZapConfig.MaxBackups = cfg.Log.ZapConfig.MaxBackups
-	logCfg.ZapConfig.MaxAge = cfg.Log.ZapConfig.MaxAge
-	logCfg.ZapConfig.LocalTime = cfg.Log.ZapConfig.LocalTime
-	logCfg.ZapConfig.Compress = cfg.Log.ZapConfig.Compress
-	logCfg.ZapConfig.JsonFormat = cfg.Log.ZapConfig.JsonFormat
-	logCfg.ZapConfig.BtEnabled = cfg.Log.ZapConfig.BtEnabled
-	logCfg.ZapConfig.BtLevel = cfg.Log.ZapConfig.BtLevel
-	logCfg.ZapConfig.FieldSeparator = cfg.Log.ZapConfig.FieldSeparator
-	log.Setup(logCfg)
+	log.Setup(cfg.LogConfig(cfg.Log.Level))
+	config.OnReload(func(prev, cur *config.Reloadable) {
+		applyReload(cfg, prev, cur)
+	})
 
 	//add pid-file
 	logDir := os.Getenv("LOG_DIR")
@@ -218,7 +203,7 @@ func (b *BaseDendrite) PrepareCache() service.Cache {
 		return b.RedisCache
 	}
 	b.RedisCache = &cache.RedisCache{}
-	err := b.RedisCache.Prepare(b.Cfg.Redis.Uris)
+	err := b.RedisCache.Prepare(b.Cfg.Redis)
 	if err != nil {
 		log.Panicf("failed to connect to redis cache err:%v", err)
 	}
@@ -0,0 +1,35 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package basecomponent
+
+import (
+	"reflect"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/domain"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+// applyReload applies the reloaded log level and domains, the other
+// reloadable values are read from config.GetReloadable where they are used
+func applyReload(cfg *config.Dendrite, prev, cur *config.Reloadable) {
+	// SIGUSR2 switched to debug, it stays until the next SIGUSR2
+	if cur.LogLevel != prev.LogLevel && !cfg.Log.Signaled {
+		log.Setup(cfg.LogConfig(cur.LogLevel))
+	}
+	if !reflect.DeepEqual(cur.ServerName, prev.ServerName) && domain.DomainMngInsance != nil {
+		domain.DomainMngInsance.SetDomains(cur.ServerName)
+	}
+}
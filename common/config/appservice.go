@@ -52,10 +52,30 @@ type ApplicationService struct {
 	// Localpart of application service user
 	SenderLocalpart string `yaml:"sender_localpart"`
 	InterestedAll   bool   `yaml:"interested_all"`
+	// Whether typing notifications, receipts and presence should be pushed
+	// to the application service along with room events (MSC2409)
+	ReceiveEphemeral bool `yaml:"receive_ephemeral"`
+	// Unstable MSC2409 spelling of receive_ephemeral, kept for bridges that
+	// still write it into their registration files
+	PushEphemeral bool `yaml:"de.sorunome.msc2409.push_ephemeral"`
 	// Information about an application service's namespaces
 	NamespaceMap map[string][]ApplicationServiceNamespace `yaml:"namespaces"`
+	// Maximum number of events sent to the application service in one
+	// transaction. Defaults to 50.
+	TransactionBatchSize int `yaml:"transaction_batch_size"`
+	// Seconds to wait for the application service to accept a transaction.
+	// Defaults to 60.
+	TransactionTimeout int `yaml:"transaction_timeout"`
+	// Third party protocols the application service can look up users and
+	// locations for
+	Protocols []string `yaml:"protocols"`
 }
 
+const (
+	defaultTransactionBatchSize = 50
+	defaultTransactionTimeout   = 60
+)
+
 // loadAppservices iterates through all application service config files
 // and loads their data into the config object for later access.
 func loadAppservices(config *Dendrite) error {
@@ -80,6 +100,13 @@ func loadAppservices(config *Dendrite) error {
 			return err
 		}
 
+		if appservice.TransactionBatchSize <= 0 {
+			appservice.TransactionBatchSize = defaultTransactionBatchSize
+		}
+		if appservice.TransactionTimeout <= 0 {
+			appservice.TransactionTimeout = defaultTransactionTimeout
+		}
+
 		// Append the parsed application service to the global config
 		config.Derived.ApplicationServices = append(
 			config.Derived.ApplicationServices, appservice)
@@ -249,3 +276,26 @@ func (a *ApplicationService) IsInterestedInRoomAlias(
 
 	return false
 }
+
+// IsInterestedInAnyRoomAlias returns a bool on whether an application service
+// has registered any room alias namespace at all
+func (a *ApplicationService) IsInterestedInAnyRoomAlias() bool {
+	return len(a.NamespaceMap["aliases"]) > 0
+}
+
+// HandlesProtocol returns a bool on whether an application service has
+// declared the given third party protocol
+func (a *ApplicationService) HandlesProtocol(protocol string) bool {
+	for _, p := range a.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// WantsEphemeralEvents returns a bool on whether an application service has
+// asked for ephemeral events to be pushed in its transactions
+func (a *ApplicationService) WantsEphemeralEvents() bool {
+	return a.ReceiveEphemeral || a.PushEphemeral
+}
@@ -19,9 +19,7 @@ package config
 
 import (
 	"bytes"
-	"crypto/rand"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"io"
@@ -116,6 +114,11 @@ type Dendrite struct {
 		// If set disables new users from registering (except via shared
 		// secrets)
 		RegistrationDisabled bool `yaml:"registration_disabled"`
+		// Third party identifiers every registration must validate, "email"
+		// and/or "msisdn"
+		RegistrationRequires3PID []string `yaml:"registration_requires_3pid"`
+		// If set only users holding a registration token may register
+		RegistrationRequiresToken bool `yaml:"registration_requires_token"`
 		ServerFromDB         bool `yaml:"server_from_db"`
 	} `yaml:"matrix"`
 
@@ -162,6 +165,7 @@ type Dendrite struct {
 			SettingUpdate      ProducerConf `yaml:"setting_update"`
 			UserInfoUpdate     ProducerConf `yaml:"user_info_update"`
 			DismissRoom        ProducerConf `yaml:"dismiss_room"`
+			Audit              ProducerConf `yaml:"audit"`
 		} `yaml:"producers"`
 		Consumer struct {
 			OutputRoomEventPublicRooms   ConsumerConf `yaml:"output_room_event_publicroom"`    // OutputRoomEventPublicRooms "public-rooms",
@@ -174,6 +178,7 @@ type Dendrite struct {
 			OutputClientData           ConsumerConf `yaml:"output_client_data"`           // OutputClientData "sync-api"
 			OutputProfileSyncAggregate ConsumerConf `yaml:"output_profile_syncaggregate"` // OutputClientData "sync-api"
 			OutputProfileSyncServer    ConsumerConf `yaml:"output_profile_syncserver"`    // OutputClientData "sync-api"
+			OutputProfileAppservice    ConsumerConf `yaml:"output_profile_appservice"`    // OutputProfileData applicationService
 			CacheUpdates               ConsumerConf `yaml:"cache_updates"`                // DBUpdates persist-cache
 			DBUpdates                  ConsumerConf `yaml:"db_updates"`                   // DBUpdates persist-db
 			FedBridgeOut               ConsumerConf `yaml:"fed_bridge_out"`
@@ -183,6 +188,7 @@ type Dendrite struct {
 			SettingUpdateSyncAggregate ConsumerConf `yaml:"setting_update_syncaggregate"`
 			SetttngUpdateProxy         ConsumerConf `yaml:"setting_update_proxy"`
 			SettingUpdateContent       ConsumerConf `yaml:"setting_update_content"`
+			SettingUpdateReload        ConsumerConf `yaml:"setting_update_reload"` // group suffixed with the server name
 			DownloadMedia              ConsumerConf `yaml:"download_media"`
 			DismissRoom                ConsumerConf `yaml:"dismiss_room"`
 		} `yaml:"consumers"`
@@ -216,10 +222,8 @@ type Dendrite struct {
 		ProxyRCSServerApiTopic     string `yaml:"proxy_rcsserver_api_topic"`
 	} `yaml:"rpc"`
 
-	Redis struct {
-		Uris []string `yaml:"uris"`
-	} `yaml:"redis"`
-	Nats struct {
+	Redis RedisConf `yaml:"redis"`
+	Nats  struct {
 		Uri string `yaml:"uri"`
 	} `yaml:"nats"`
 	// Postgres Config
@@ -265,24 +269,7 @@ type Dendrite struct {
 	} `yaml:"database"`
 
 	// TURN Server Config
-	TURN struct {
-		// TODO Guest Support
-		// Whether or not guests can request TURN credentials
-		//AllowGuests bool `yaml:"turn_allow_guests"`
-		// How long the authorization should last
-		UserLifetime string `yaml:"turn_user_lifetime"`
-		// The list of TURN URIs to pass to clients
-		URIs []string `yaml:"turn_uris"`
-
-		// Authorization via Shared Secret
-		// The shared secret from coturn
-		SharedSecret string `yaml:"turn_shared_secret"`
-
-		// Authorization via Static Username & Password
-		// Hardcoded Username and Password
-		Username string `yaml:"turn_username"`
-		Password string `yaml:"turn_password"`
-	} `yaml:"turn"`
+	TURN TURNConf `yaml:"turn"`
 
 	// The internal addresses the components will listen on.
 	// These should not be exposed externally as they expose metrics and debugging APIs.
@@ -300,6 +287,9 @@ type Dendrite struct {
 	Tracing struct {
 		// The config for the jaeger opentracing reporter.
 		Jaeger jaegerconfig.Configuration `yaml:"jaeger"`
+		// The config for the opentelemetry OTLP exporter, used instead of
+		// jaeger when an endpoint is set.
+		OTLP OTLPConf `yaml:"otlp"`
 	} `yaml:"tracing"`
 
 	// Application Services
@@ -312,15 +302,93 @@ type Dendrite struct {
 	Authorization struct {
 		// Configuration for login authorize mode
 		AuthorizeMode string `yaml:"login_authorize_mode"`
-		AuthorizeCode string `yaml:"login_authorize_code"`
+		// Lifetime in milliseconds of access tokens issued to clients that
+		// asked for a refresh token, 0 disables refresh tokens
+		AccessTokenLifetime int64 `yaml:"access_token_lifetime_ms"`
+		// Lifetime in milliseconds of refresh tokens, 0 means they only end
+		// when used or when the device logs out
+		RefreshTokenLifetime int64 `yaml:"refresh_token_lifetime_ms"`
+		// Lifetime in milliseconds of the OpenID tokens handed to widgets and
+		// integration managers
+		OpenIDTokenLifetime int64 `yaml:"openid_token_lifetime_ms"`
+		// Users always allowed to call the /_ligase/admin api, more admins
+		// are granted through the admin flag of their account
+		AdminUsers []string `yaml:"admin_users"`
 	} `yaml:"authorization"`
 
-	PushService struct {
-		// Configuration for push service
-		RemoveFailTimes      int    `yaml:"remove_fail_times"`
-		PushServerUrl        string `yaml:"push_server_url"`
-		AndroidPushServerUrl string `yaml:"android_push_server_url"`
-	} `yaml:"push_service"`
+	PushService PushServiceConf `yaml:"push_service"`
+
+	EventReport struct {
+		// New event reports are posted there as json, nothing is sent if empty
+		WebhookURL string `yaml:"webhook_url"`
+		// In milliseconds
+		WebhookTimeout int `yaml:"webhook_timeout_ms"`
+	} `yaml:"event_report"`
+
+	// Single sign-on through a CAS server or a SAML2 identity provider,
+	// advertised as m.login.sso on GET /login
+	SSO struct {
+		// "cas" or "saml", empty disables single sign-on
+		Provider string `yaml:"provider"`
+		// Public base url of the client api, the identity provider sends the
+		// browser back there
+		PublicBaseURL string `yaml:"public_base_url"`
+		// Attribute the localpart is taken from, the CAS user or the SAML
+		// NameID if empty
+		LocalpartAttribute   string `yaml:"localpart_attribute"`
+		DisplayNameAttribute string `yaml:"displayname_attribute"`
+		// Urls of the clients allowed to receive login tokens, a redirectUrl
+		// must have the scheme and host of one and start with its path
+		ClientWhitelist []string `yaml:"client_whitelist"`
+		// Lifetime in milliseconds of the m.login.token exchanged on /login
+		LoginTokenLifetime int64 `yaml:"login_token_lifetime_ms"`
+		CAS                struct {
+			ServerURL string `yaml:"server_url"`
+			// Attributes the CAS server must return with these values
+			RequiredAttributes map[string]string `yaml:"required_attributes"`
+		} `yaml:"cas"`
+		SAML struct {
+			// AuthnRequests are sent there with the HTTP-Redirect binding
+			IdPSSOURL   string `yaml:"idp_sso_url"`
+			IdPEntityID string `yaml:"idp_entity_id"`
+			// PEM file of the certificate the identity provider signs with
+			IdPCertificate string `yaml:"idp_certificate"`
+			// Defaults to public_base_url
+			SPEntityID string `yaml:"sp_entity_id"`
+		} `yaml:"saml"`
+	} `yaml:"sso"`
+
+	// Built-in validation of third party identifiers, the server sends the
+	// tokens itself instead of an identity server
+	ThreePID struct {
+		// Lifetime in milliseconds of a validation session
+		SessionLifetime int64 `yaml:"session_lifetime_ms"`
+		// Public base url of the client api, email links point there
+		PublicBaseURL string `yaml:"public_base_url"`
+		Email         struct {
+			// "smtp" or "log", empty disables email validation
+			Sender  string `yaml:"sender"`
+			From    string `yaml:"from"`
+			Subject string `yaml:"subject"`
+			SMTP    struct {
+				Host     string `yaml:"host"`
+				Port     int    `yaml:"port"`
+				Username string `yaml:"username"`
+				Password string `yaml:"password"`
+				// Refuse to send if the server does not offer STARTTLS
+				RequireTLS bool `yaml:"require_tls"`
+			} `yaml:"smtp"`
+		} `yaml:"email"`
+		MSISDN struct {
+			// "http" or "log", empty disables msisdn validation
+			Gateway string `yaml:"gateway"`
+			// The http gateway posts {"to", "from", "text"} there
+			URL string `yaml:"url"`
+			// Sent as a bearer token to the http gateway
+			Token string `yaml:"token"`
+			From  string `yaml:"from"`
+		} `yaml:"msisdn"`
+	} `yaml:"threepid"`
 
 	Log struct {
 		Signaled       bool
@@ -373,6 +441,7 @@ type Dendrite struct {
 		DomainName          string   `yaml:"domain_name"`
 		UpdateAvatar        bool     `yaml:"update_avatar"`
 		ProcessDevice       bool     `yaml:"process_device"`
+		AcceptTokens        bool     `yaml:"accept_tokens"`
 		AppendWhenRoomExist bool     `yaml:"append_when_room_exist"`
 		SynapseDB           string   `yaml:"synapse_db"`
 		GoRoomDB            string   `yaml:"go_room_db"`
@@ -439,6 +508,22 @@ type Dendrite struct {
 		Total           uint32 `yaml:"total"`
 		MultiWrite      bool   `yaml:"multi_write"`
 		SyncServerTotal uint32 `yaml:"sync_server_total"`
+		// Assign rooms to the syncservers that are up with consistent
+		// hashing instead of hash modulo sync_server_total, syncservers
+		// can then be added or removed without a restart
+		SyncServerSharding struct {
+			Enable bool `yaml:"enable"`
+			// "consistent" or "consistent-boundedload"
+			Selector string `yaml:"selector"`
+			// How often a syncserver announces itself, in milliseconds
+			Heartbeat int64 `yaml:"heartbeat_ms"`
+			// A syncserver not heard of for that long leaves the ring
+			MemberTTL int64 `yaml:"member_ttl_ms"`
+			// How long an old owner keeps the rooms it handed off
+			HandoffGrace int64 `yaml:"handoff_grace_ms"`
+			// Time a new syncserver may spend preloading its rooms
+			PreloadTimeout int64 `yaml:"preload_timeout_ms"`
+		} `yaml:"sync_server_sharding"`
 	} `yaml:"multi_instance"`
 
 	DeviceMng struct {
@@ -446,6 +531,19 @@ type Dendrite struct {
 		KickUnActive int64 `yaml:"kick_unactive"`
 	} `yaml:"device_mng"`
 
+	// Retention of room history, rooms set their own with m.room.retention.
+	// All durations are in milliseconds, 0 means unbounded.
+	Retention struct {
+		Enabled bool `yaml:"enabled"`
+		// Policy of the rooms which have no m.room.retention state
+		DefaultMinLifetime int64 `yaml:"default_min_lifetime"`
+		DefaultMaxLifetime int64 `yaml:"default_max_lifetime"`
+		// Bounds the max_lifetime a room can ask for
+		AllowedLifetimeMin int64 `yaml:"allowed_lifetime_min"`
+		AllowedLifetimeMax int64 `yaml:"allowed_lifetime_max"`
+		ScanInterval       int64 `yaml:"scan_interval"`
+	} `yaml:"retention"`
+
 	StateMgr struct {
 		StateNotify     bool  `yaml:"state_notify"`
 		StateOffline    int64 `yaml:"state_offline"`
@@ -476,6 +574,13 @@ type Dendrite struct {
 		RoomStateExt DistLockConf `yaml:"room_state_ext"`
 	} `yaml:"dist_lock_custom"`
 
+	// Token bucket limits applied by the proxy before a request is handed to
+	// the backends. Buckets live in redis so they are shared by all proxies.
+	RateLimit RateLimitsConf `yaml:"rate_limit"`
+
+	// Log of the security relevant actions, see the audit package
+	Audit AuditConf `yaml:"audit"`
+
 	TokenExpire int64 `yaml:"token_expire"`
 	UtlExpire int64 `yaml:"utl_expire"`
 	LatestToken int `yaml:"latest_token"`
@@ -486,6 +591,67 @@ type Dendrite struct {
 	LicenseItem LicenseConf
 }
 
+// TURNConf is the TURN server handed to the clients
+type TURNConf struct {
+	// TODO Guest Support
+	// Whether or not guests can request TURN credentials
+	//AllowGuests bool `yaml:"turn_allow_guests"`
+	// How long the authorization should last
+	UserLifetime string `yaml:"turn_user_lifetime"`
+	// The list of TURN URIs to pass to clients
+	URIs []string `yaml:"turn_uris"`
+
+	// Authorization via Shared Secret
+	// The shared secret from coturn
+	SharedSecret string `yaml:"turn_shared_secret"`
+
+	// Authorization via Static Username & Password
+	// Hardcoded Username and Password
+	Username string `yaml:"turn_username"`
+	Password string `yaml:"turn_password"`
+}
+
+// PushServiceConf is where the push sender posts notifications
+type PushServiceConf struct {
+	// Configuration for push service
+	RemoveFailTimes      int    `yaml:"remove_fail_times"`
+	PushServerUrl        string `yaml:"push_server_url"`
+	AndroidPushServerUrl string `yaml:"android_push_server_url"`
+	// Push gateway backend, "legacy" (default) or "matrix"
+	Backend string `yaml:"backend"`
+	// Gateway used by the matrix backend for pushers without data.url
+	GatewayUrl string `yaml:"gateway_url"`
+}
+
+// RateLimitsConf are the token buckets of the proxy
+type RateLimitsConf struct {
+	Enable bool `yaml:"enable"`
+	// users that are never limited besides the server admins
+	ExemptUsers []string `yaml:"exempt_users"`
+	// refuse the limited requests when the buckets cannot be read, instead
+	// of letting them through
+	FailClosed bool `yaml:"fail_closed"`
+	// addresses or cidrs of the reverse proxies whose X-Forwarded-For is
+	// trusted, unauthenticated requests are limited by the peer address
+	// otherwise
+	TrustedProxies []string      `yaml:"trusted_proxies"`
+	SendMessage    RateLimitConf `yaml:"send_message"`
+	Login          RateLimitConf `yaml:"login"`
+	Register       RateLimitConf `yaml:"register"`
+	MediaUpload    RateLimitConf `yaml:"media_upload"`
+	Join           RateLimitConf `yaml:"join"`
+}
+
+// AuditConf is where the audit events are sent, and who may read them
+type AuditConf struct {
+	// Append the events to the hash chained table of the accounts database
+	Table bool `yaml:"table"`
+	// Publish the events on the kafka audit producer
+	Kafka bool `yaml:"kafka"`
+	// Users allowed to query the audit log besides the server admins
+	Auditors []string `yaml:"auditors"`
+}
+
 type LicenseConf struct {
 	OrganName   string `json:"organ_name"`
 	ExpireTime  int64  `json:"expire_time"`
@@ -564,12 +730,35 @@ type DataBaseConf struct {
 	Addresses string `yaml:"addresses"`
 }
 
+type RedisConf struct {
+	Uris []string `yaml:"uris"`
+	// How the uris are used:
+	//   replica: the uris serve the same data, any of them takes a command
+	//   shard: the keys are spread over the uris by hash slot
+	//   sentinel: the uris are sentinels that tell the master of master_name
+	//   cluster: the uris are seed nodes of a redis cluster
+	//   memory: no redis, the keys are kept in the monolith-server process
+	Mode     string `yaml:"mode"`
+	Sentinel struct {
+		MasterName string `yaml:"master_name"`
+		// Password of the master, the sentinel passwords go in the uris
+		Password string `yaml:"password"`
+	} `yaml:"sentinel"`
+}
+
 type DistLockConf struct {
 	Timeout int  `yaml:"timeout"`
 	Wait    int  `yaml:"wait"`
 	Force   bool `yaml:"force"`
 }
 
+// RateLimitConf is a token bucket refilled with PerSecond tokens every second
+// and holding at most Burst tokens. A zero PerSecond disables the limit.
+type RateLimitConf struct {
+	PerSecond float64 `yaml:"per_second"`
+	Burst     int     `yaml:"burst"`
+}
+
 // A Path on the filesystem.
 type Path string
 
@@ -588,6 +777,7 @@ func GetConfig() *Dendrite {
 
 func SetConfig(cfg *Dendrite) {
 	config = cfg
+	reloadable.Store(newReloadable(cfg, ""))
 }
 
 // Load a yaml config file for a server run as multiple processes.
@@ -606,6 +796,7 @@ func Load(configPath string) error {
 	// Pass the current working directory and ioutil.ReadFile so that they can
 	// be mocked in the tests
 	monolithic := false
+	loadedPath, loadedMonolithic = configPath, monolithic
 	return loadConfig(basePath, configData, ioutil.ReadFile, monolithic)
 }
 
@@ -625,6 +816,7 @@ func LoadMonolithic(configPath string) error {
 	// Pass the current working directory and ioutil.ReadFile so that they can
 	// be mocked in the tests
 	monolithic := true
+	loadedPath, loadedMonolithic = configPath, monolithic
 	return loadConfig(basePath, configData, ioutil.ReadFile, monolithic)
 }
 
@@ -640,16 +832,47 @@ func loadConfig(
 	readFile func(string) ([]byte, error),
 	monolithic bool,
 ) error {
-	var err error
-	config = new(Dendrite)
-	if err = yaml.Unmarshal(configData, config); err != nil {
+	cfg, err := parseConfig(basePath, configData, readFile, monolithic)
+	if err != nil {
 		return err
 	}
+	config = cfg
+
+	for _, val := range config.EventSkip.Items {
+		gomatrixserverlib.AddSkipItem(val.Patten, val.IsReg)
+	}
+
+	adapter.SetKafkaEnableIdempotence(config.Kafka.CommonCfg.EnableIdempotence)
+	adapter.SetKafkaForceAsyncSend(config.Kafka.CommonCfg.ForceAsyncSend)
+	adapter.SetKafkaReplicaFactor(config.Kafka.CommonCfg.ReplicaFactor)
+	adapter.SetKafkaNumPartitions(config.Kafka.CommonCfg.NumPartitions)
+	adapter.SetKafkaNumProducers(config.Kafka.CommonCfg.NumProducers)
+	adapter.SetDistLockItemCfg("instance", config.DistLockCustom.Instance.Timeout, config.DistLockCustom.Instance.Wait, config.DistLockCustom.Instance.Force)
+	adapter.SetDistLockItemCfg("room_state", config.DistLockCustom.RoomState.Timeout, config.DistLockCustom.RoomState.Wait, config.DistLockCustom.RoomState.Force)
+	adapter.SetDistLockItemCfg("room_state_ext", config.DistLockCustom.RoomStateExt.Timeout, config.DistLockCustom.RoomStateExt.Wait, config.DistLockCustom.RoomStateExt.Force)
+	adapter.SetDebugLevel(config.DebugLevel)
+	adapter.SetCacheCfg(config.TokenExpire, config.UtlExpire, config.LatestToken)
+	config.parseLicense()
+	reloadable.Store(newReloadable(config, digest(configData)))
+	return nil
+}
+
+// parseConfig reads and checks a config, without applying it
+func parseConfig(
+	basePath string,
+	configData []byte,
+	readFile func(string) ([]byte, error),
+	monolithic bool,
+) (*Dendrite, error) {
+	config := new(Dendrite)
+	if err := yaml.Unmarshal(configData, config); err != nil {
+		return nil, err
+	}
 
 	config.setDefaults()
 
-	if err = config.check(monolithic); err != nil {
-		return err
+	if err := config.check(monolithic); err != nil {
+		return nil, err
 	}
 
 	/*
@@ -679,40 +902,34 @@ func loadConfig(
 	*/
 
 	// Generate data from config options
-	err = config.derive()
-	if err != nil {
-		return err
-	}
-
-	for _, val := range config.EventSkip.Items {
-		gomatrixserverlib.AddSkipItem(val.Patten, val.IsReg)
-	}
-
-	if config.Authorization.AuthorizeCode == "" {
-		b := make([]byte, 15)
-		rand.Read(b)
-		config.Authorization.AuthorizeCode = base64.RawURLEncoding.EncodeToString(b)
-		fmt.Printf("loadConfig build default auth code:%s.", config.Authorization.AuthorizeCode)
-
+	if err := config.derive(); err != nil {
+		return nil, err
 	}
-	adapter.SetKafkaEnableIdempotence(config.Kafka.CommonCfg.EnableIdempotence)
-	adapter.SetKafkaForceAsyncSend(config.Kafka.CommonCfg.ForceAsyncSend)
-	adapter.SetKafkaReplicaFactor(config.Kafka.CommonCfg.ReplicaFactor)
-	adapter.SetKafkaNumPartitions(config.Kafka.CommonCfg.NumPartitions)
-	adapter.SetKafkaNumProducers(config.Kafka.CommonCfg.NumProducers)
-	adapter.SetDistLockItemCfg("instance", config.DistLockCustom.Instance.Timeout, config.DistLockCustom.Instance.Wait, config.DistLockCustom.Instance.Force)
-	adapter.SetDistLockItemCfg("room_state", config.DistLockCustom.RoomState.Timeout, config.DistLockCustom.RoomState.Wait, config.DistLockCustom.RoomState.Force)
-	adapter.SetDistLockItemCfg("room_state_ext", config.DistLockCustom.RoomStateExt.Timeout, config.DistLockCustom.RoomStateExt.Wait, config.DistLockCustom.RoomStateExt.Force)
-	adapter.SetDebugLevel(config.DebugLevel)
-	adapter.SetCacheCfg(config.TokenExpire, config.UtlExpire, config.LatestToken)
-	config.parseLicense()
-	return nil
+	return config, nil
 }
 
 func (config *Dendrite) parseLicense() {
 
 }
 
+// LogConfig returns the log setup of the config, logging at level
+func (config *Dendrite) LogConfig(level string) *log.LogConfig {
+	logCfg := new(log.LogConfig)
+	logCfg.Level = level
+	logCfg.Files = config.Log.Files
+	logCfg.WriteToStdout = config.Log.WriteToStdout
+	logCfg.ZapConfig.MaxSize = config.Log.ZapConfig.MaxSize
+	logCfg.ZapConfig.MaxBackups = config.Log.ZapConfig.MaxBackups
+	logCfg.ZapConfig.MaxAge = config.Log.ZapConfig.MaxAge
+	logCfg.ZapConfig.LocalTime = config.Log.ZapConfig.LocalTime
+	logCfg.ZapConfig.Compress = config.Log.ZapConfig.Compress
+	logCfg.ZapConfig.JsonFormat = config.Log.ZapConfig.JsonFormat
+	logCfg.ZapConfig.BtEnabled = config.Log.ZapConfig.BtEnabled
+	logCfg.ZapConfig.BtLevel = config.Log.ZapConfig.BtLevel
+	logCfg.ZapConfig.FieldSeparator = config.Log.ZapConfig.FieldSeparator
+	return logCfg
+}
+
 func (config *Dendrite) GetDBConfig(name string) (driver string, createAddr string, addr string, persistUnderlying string, persistName string, async bool) {
 	switch name {
 	case "accounts":
@@ -753,16 +970,39 @@ func (config *Dendrite) derive() error {
 
 	config.Derived.Registration.Params = make(map[string]interface{})
 
-	// TODO: Add email auth type
-	// TODO: Add MSISDN auth type
-
+	var stages []string
 	if config.Matrix.RecaptchaEnabled {
 		config.Derived.Registration.Params[authtypes.LoginTypeRecaptcha] = map[string]string{"public_key": config.Matrix.RecaptchaPublicKey}
+		stages = append(stages, authtypes.LoginTypeRecaptcha)
+	}
+	if config.Matrix.RegistrationRequiresToken {
+		stages = append(stages, authtypes.LoginTypeRegistrationToken)
+	}
+
+	if len(config.Matrix.RegistrationRequires3PID) > 0 {
+		flow := append([]string{}, stages...)
+		for _, medium := range config.Matrix.RegistrationRequires3PID {
+			flow = append(flow, threePIDStage(medium))
+		}
 		config.Derived.Registration.Flows = append(config.Derived.Registration.Flows,
-			external.AuthFlow{Stages: []string{authtypes.LoginTypeRecaptcha}})
+			external.AuthFlow{Stages: flow})
 	} else {
+		if len(stages) == 0 {
+			stages = []string{authtypes.LoginTypeDummy}
+		}
 		config.Derived.Registration.Flows = append(config.Derived.Registration.Flows,
-			external.AuthFlow{Stages: []string{authtypes.LoginTypeDummy}})
+			external.AuthFlow{Stages: stages})
+		// validating an identifier is optional, it gets bound to the account
+		for _, medium := range []string{"email", "msisdn"} {
+			if config.ThreePIDEnabled(medium) {
+				flow := append([]string{}, stages...)
+				if len(flow) == 1 && flow[0] == authtypes.LoginTypeDummy {
+					flow = flow[:0]
+				}
+				config.Derived.Registration.Flows = append(config.Derived.Registration.Flows,
+					external.AuthFlow{Stages: append(flow, threePIDStage(medium))})
+			}
+		}
 	}
 
 	// Load application service configuration files
@@ -773,6 +1013,42 @@ func (config *Dendrite) derive() error {
 	return nil
 }
 
+// ThreePIDEnabled tells if the server validates identifiers of medium
+func (config *Dendrite) ThreePIDEnabled(medium string) bool {
+	switch medium {
+	case "email":
+		return config.ThreePID.Email.Sender != ""
+	case "msisdn":
+		return config.ThreePID.MSISDN.Gateway != ""
+	}
+	return false
+}
+
+// InProcessNatsURI as nats.uri hands the rpcs to the handlers of the
+// monolith-server process, without nats
+const InProcessNatsURI = "inproc://"
+
+// InProcess tells if nats, kafka or redis are stood in for in process, the
+// monolith-server can then run without them
+func (config *Dendrite) InProcess() bool {
+	if config.Nats.Uri == InProcessNatsURI || config.Redis.Mode == "memory" {
+		return true
+	}
+	for _, t := range config.TransportConfs {
+		if t.Underlying == "memory" {
+			return true
+		}
+	}
+	return false
+}
+
+func threePIDStage(medium string) string {
+	if medium == "msisdn" {
+		return authtypes.LoginTypeMSISDN
+	}
+	return authtypes.LoginTypeEmail
+}
+
 // setDefaults sets default config values if they are not explicitly set.
 func (config *Dendrite) setDefaults() {
 	if config.Matrix.KeyValidityPeriod == 0 {
@@ -790,6 +1066,44 @@ func (config *Dendrite) setDefaults() {
 	if config.DeviceMng.KickUnActive == 0 {
 		config.DeviceMng.KickUnActive = 2592000000 //30 day
 	}
+
+	if config.Authorization.OpenIDTokenLifetime == 0 {
+		config.Authorization.OpenIDTokenLifetime = 3600000 //1 hour
+	}
+
+	if config.SSO.LoginTokenLifetime == 0 {
+		config.SSO.LoginTokenLifetime = 120000 //2 minutes
+	}
+	if config.SSO.SAML.SPEntityID == "" {
+		config.SSO.SAML.SPEntityID = config.SSO.PublicBaseURL
+	}
+
+	if config.ThreePID.SessionLifetime == 0 {
+		config.ThreePID.SessionLifetime = 3600000 //1 hour
+	}
+	if config.ThreePID.Email.Subject == "" {
+		config.ThreePID.Email.Subject = "Validate your email address"
+	}
+	if config.ThreePID.Email.SMTP.Port == 0 {
+		config.ThreePID.Email.SMTP.Port = 25
+	}
+
+	sharding := &config.MultiInstance.SyncServerSharding
+	if sharding.Selector == "" {
+		sharding.Selector = "consistent"
+	}
+	if sharding.Heartbeat == 0 {
+		sharding.Heartbeat = 1000
+	}
+	if sharding.MemberTTL == 0 {
+		sharding.MemberTTL = 5 * sharding.Heartbeat
+	}
+	if sharding.HandoffGrace == 0 {
+		sharding.HandoffGrace = 10000
+	}
+	if sharding.PreloadTimeout == 0 {
+		sharding.PreloadTimeout = 300000
+	}
 }
 
 // Error returns a string detailing how many errors were contained within an
@@ -859,6 +1173,64 @@ func (config *Dendrite) check(monolithic bool) error {
 		checkNotEmpty("listen.room_server", string(config.Listen.RoomServer))
 	}
 
+	switch config.SSO.Provider {
+	case "":
+	case "cas":
+		checkNotEmpty("sso.public_base_url", config.SSO.PublicBaseURL)
+		checkNotEmpty("sso.cas.server_url", config.SSO.CAS.ServerURL)
+		checkNotZero("sso.client_whitelist", int64(len(config.SSO.ClientWhitelist)))
+	case "saml":
+		checkNotEmpty("sso.public_base_url", config.SSO.PublicBaseURL)
+		checkNotEmpty("sso.saml.idp_sso_url", config.SSO.SAML.IdPSSOURL)
+		checkNotEmpty("sso.saml.idp_certificate", config.SSO.SAML.IdPCertificate)
+		checkNotZero("sso.client_whitelist", int64(len(config.SSO.ClientWhitelist)))
+	default:
+		problems = append(problems, fmt.Sprintf("invalid value for config key %q: %s", "sso.provider", config.SSO.Provider))
+	}
+
+	switch config.ThreePID.Email.Sender {
+	case "", "log":
+	case "smtp":
+		checkNotEmpty("threepid.email.smtp.host", config.ThreePID.Email.SMTP.Host)
+	default:
+		problems = append(problems, fmt.Sprintf("invalid value for config key %q: %s", "threepid.email.sender", config.ThreePID.Email.Sender))
+	}
+	if config.ThreePID.Email.Sender != "" {
+		checkNotEmpty("threepid.email.from", config.ThreePID.Email.From)
+		checkNotEmpty("threepid.public_base_url", config.ThreePID.PublicBaseURL)
+	}
+	switch config.ThreePID.MSISDN.Gateway {
+	case "", "log":
+	case "http":
+		checkNotEmpty("threepid.msisdn.url", config.ThreePID.MSISDN.URL)
+	default:
+		problems = append(problems, fmt.Sprintf("invalid value for config key %q: %s", "threepid.msisdn.gateway", config.ThreePID.MSISDN.Gateway))
+	}
+	for _, medium := range config.Matrix.RegistrationRequires3PID {
+		if !config.ThreePIDEnabled(medium) {
+			problems = append(problems, fmt.Sprintf("registration requires %s but threepid validation of it is not configured", medium))
+		}
+	}
+
+	switch config.Redis.Mode {
+	case "", "replica", "shard", "cluster", "memory":
+	case "sentinel":
+		checkNotEmpty("redis.sentinel.master_name", config.Redis.Sentinel.MasterName)
+	default:
+		problems = append(problems, fmt.Sprintf("invalid value for config key %q: %s", "redis.mode", config.Redis.Mode))
+	}
+
+	if sharding := config.MultiInstance.SyncServerSharding; sharding.Enable {
+		switch sharding.Selector {
+		case "consistent", "consistent-boundedload":
+		default:
+			problems = append(problems, fmt.Sprintf("invalid value for config key %q: %s", "multi_instance.sync_server_sharding.selector", sharding.Selector))
+		}
+		if sharding.MemberTTL <= sharding.Heartbeat {
+			problems = append(problems, "multi_instance.sync_server_sharding.member_ttl_ms must be longer than heartbeat_ms")
+		}
+	}
+
 	if problems != nil {
 		return Error{problems}
 	}
@@ -927,6 +1299,9 @@ func (config *Dendrite) RoomServerURL() string {
 
 // SetupTracing configures the opentracing using the supplied configuration.
 func (config *Dendrite) SetupTracing(serviceName string) (closer io.Closer, err error) {
+	if config.Tracing.OTLP.Endpoint != "" {
+		return config.Tracing.OTLP.setup(serviceName)
+	}
 	return config.Tracing.Jaeger.InitGlobalTracer(
 		serviceName,
 		jaegerconfig.Logger(Logger{}),
@@ -0,0 +1,162 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/finogeeks/ligase/skunkworks/log"
+)
+
+// Reloadable is the part of the config a running server applies when the
+// config file is reloaded. Readers get it from GetReloadable on every use
+// instead of keeping a copy, the other values need a restart.
+type Reloadable struct {
+	// sha256 of the config file the values were read from
+	Digest string
+
+	LogLevel    string
+	ServerName  []string
+	PushService PushServiceConf
+	RateLimit   RateLimitsConf
+	TURN        TURNConf
+
+	ApplicationServices                        []ApplicationService
+	ExclusiveApplicationServicesUsernameRegexp *regexp.Regexp
+}
+
+var (
+	reloadable atomic.Value
+
+	reloadMu         sync.Mutex
+	reloadHooks      []func(prev, cur *Reloadable)
+	loadedPath       string
+	loadedMonolithic bool
+)
+
+func newReloadable(cfg *Dendrite, digest string) *Reloadable {
+	return &Reloadable{
+		Digest:              digest,
+		LogLevel:            cfg.Log.Level,
+		ServerName:          cfg.Matrix.ServerName,
+		PushService:         cfg.PushService,
+		RateLimit:           cfg.RateLimit,
+		TURN:                cfg.TURN,
+		ApplicationServices: cfg.Derived.ApplicationServices,
+		ExclusiveApplicationServicesUsernameRegexp: cfg.Derived.ExclusiveApplicationServicesUsernameRegexp,
+	}
+}
+
+func digest(configData []byte) string {
+	sum := sha256.Sum256(configData)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetReloadable returns the reloadable values in use
+func GetReloadable() *Reloadable {
+	if r, ok := reloadable.Load().(*Reloadable); ok {
+		return r
+	}
+	return &Reloadable{}
+}
+
+// OnReload registers f to apply the values of a reload, it is called with
+// the previous and the new values after they are swapped
+func OnReload(f func(prev, cur *Reloadable)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, f)
+}
+
+// Reload reads the config file loaded at startup again. The new config is
+// checked like at startup, then its reloadable values replace the ones in
+// use. changed is false when the file is the one already applied.
+func Reload() (cur *Reloadable, changed bool, err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	prev := GetReloadable()
+	if loadedPath == "" || config == nil {
+		return prev, false, errors.New("the config was not loaded from a file")
+	}
+	configData, err := ioutil.ReadFile(loadedPath)
+	if err != nil {
+		return prev, false, err
+	}
+	if digest(configData) == prev.Digest {
+		return prev, false, nil
+	}
+	basePath, err := filepath.Abs(".")
+	if err != nil {
+		return prev, false, err
+	}
+	cfg, err := parseConfig(basePath, configData, ioutil.ReadFile, loadedMonolithic)
+	if err != nil {
+		return prev, false, err
+	}
+	// the first server name is the one of the keys and the ids generated
+	if len(cfg.Matrix.ServerName) == 0 || len(prev.ServerName) == 0 || cfg.Matrix.ServerName[0] != prev.ServerName[0] {
+		return prev, false, fmt.Errorf("matrix.server_name must keep %v first, changing it needs a restart", prev.ServerName)
+	}
+	for _, section := range restartSections(config, cfg) {
+		log.Warnf("config reload: %s changed, it is applied at the next restart", section)
+	}
+
+	cur = newReloadable(cfg, digest(configData))
+	reloadable.Store(cur)
+	for _, f := range reloadHooks {
+		f(prev, cur)
+	}
+	log.Infof("config reloaded from %s, digest %s", loadedPath, cur.Digest)
+	return cur, true, nil
+}
+
+// restartSections returns the yaml sections of the config that differ
+// outside of the reloadable values
+func restartSections(running, loaded *Dendrite) []string {
+	a, b := *running, *loaded
+	a.Matrix.ServerName = b.Matrix.ServerName
+	a.Log.Level, a.Log.Signaled = b.Log.Level, b.Log.Signaled
+	// the backend picks the gateway at startup
+	a.PushService = PushServiceConf{Backend: a.PushService.Backend}
+	b.PushService = PushServiceConf{Backend: b.PushService.Backend}
+	a.RateLimit = b.RateLimit
+	a.TURN = b.TURN
+	a.ApplicationServices = b.ApplicationServices
+
+	var sections []string
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("yaml")
+		if name == "" || name == "-" {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			sections = append(sections, name)
+		}
+	}
+	return sections
+}
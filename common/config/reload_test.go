@@ -0,0 +1,118 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const reloadTestConfig = `
+version: 0
+matrix:
+  server_name: [%s]
+media:
+  upload_url: %s
+  download_url: http://media/download
+  thumbnail_url: http://media/thumbnail
+log:
+  level: %s
+turn:
+  turn_user_lifetime: %s
+  turn_uris: ["turn:turn.example.org?transport=udp"]
+rate_limit:
+  enable: true
+  login:
+    per_second: %d
+    burst: 3
+`
+
+func writeReloadTestConfig(t *testing.T, path, serverNames, uploadURL, level, lifetime string, perSecond int) {
+	data := fmt.Sprintf(reloadTestConfig, serverNames, uploadURL, level, lifetime, perSecond)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloadTestConfig(t, path, "a.org", "http://media/upload", "info", "1h", 1)
+	if err := LoadMonolithic(path); err != nil {
+		t.Fatal(err)
+	}
+	var reloaded []*Reloadable
+	OnReload(func(prev, cur *Reloadable) {
+		reloaded = append(reloaded, cur)
+	})
+	loaded := GetReloadable()
+
+	if cur, changed, err := Reload(); err != nil || changed || cur != loaded {
+		t.Fatalf("reload of the same file = %v, %v", changed, err)
+	}
+
+	writeReloadTestConfig(t, path, "a.org, b.org", "http://media/upload", "debug", "1h", 5)
+	cur, changed, err := Reload()
+	if err != nil || !changed {
+		t.Fatalf("reload = %v, %v", changed, err)
+	}
+	if GetReloadable() != cur || len(reloaded) != 1 || reloaded[0] != cur {
+		t.Fatalf("reloaded values not swapped")
+	}
+	if cur.LogLevel != "debug" || cur.RateLimit.Login.PerSecond != 5 || !reflect.DeepEqual(cur.ServerName, []string{"a.org", "b.org"}) {
+		t.Fatalf("reloaded %+v", cur)
+	}
+	if cur.ExclusiveApplicationServicesUsernameRegexp == nil {
+		t.Fatalf("appservice regexps not set up")
+	}
+	// the values read at startup stay
+	if GetConfig().Log.Level != "info" {
+		t.Fatalf("startup config changed")
+	}
+
+	// a config failing the checks is not applied
+	writeReloadTestConfig(t, path, "a.org", "http://media/upload", "info", "soon", 1)
+	if _, _, err = Reload(); err == nil || GetReloadable() != cur {
+		t.Fatalf("invalid config reloaded, err %v", err)
+	}
+	writeReloadTestConfig(t, path, "b.org", "http://media/upload", "info", "1h", 1)
+	if _, _, err = Reload(); err == nil || GetReloadable() != cur {
+		t.Fatalf("first server name changed, err %v", err)
+	}
+}
+
+func TestRestartSections(t *testing.T) {
+	dir := t.TempDir()
+	running, loaded := filepath.Join(dir, "running.yaml"), filepath.Join(dir, "loaded.yaml")
+	writeReloadTestConfig(t, running, "a.org", "http://media/upload", "info", "1h", 1)
+	writeReloadTestConfig(t, loaded, "a.org, b.org", "http://media2/upload", "debug", "2h", 5)
+
+	parse := func(path string) *Dendrite {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := parseConfig(dir, data, ioutil.ReadFile, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+	if sections := restartSections(parse(running), parse(loaded)); !reflect.DeepEqual(sections, []string{"media"}) {
+		t.Fatalf("restart sections = %v", sections)
+	}
+}
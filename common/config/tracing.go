@@ -0,0 +1,104 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/otel"
+	otbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// OTLPConf is where the spans are exported with the OTLP http protocol
+type OTLPConf struct {
+	// host:port of the collector, tracing goes to jaeger when empty
+	Endpoint string `yaml:"endpoint"`
+	// Path of the traces, /v1/traces when empty
+	URLPath string `yaml:"url_path"`
+	// Plain http instead of https
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	// Fraction of the traces kept, all when 0
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+func (c *OTLPConf) setup(serviceName string) (io.Closer, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.Endpoint)}
+	if c.URLPath != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(c.URLPath))
+	}
+	if c.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(c.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(c.Headers))
+	}
+	// the exporter connects lazily, a collector down does not stop the server
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if c.SampleRatio > 0 && c.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(c.SampleRatio)
+	}
+	return SetupOTelTracer(serviceName,
+		sdktrace.WithBatcher(exporter),
+		// the servers down a trace keep the choice of the first one
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	), nil
+}
+
+// SetupOTelTracer makes opentelemetry the global opentracing tracer, through
+// the bridge, so the spans of common.StartSpanFromContext and the others are
+// exported as configured by opts. Span contexts are propagated as w3c trace
+// context and baggage. Closing the closer flushes the spans left.
+func SetupOTelTracer(serviceName string, opts ...sdktrace.TracerProviderOption) io.Closer {
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	}, opts...)
+	provider := sdktrace.NewTracerProvider(opts...)
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	bridge, wrapper := otbridge.NewTracerPair(provider.Tracer(serviceName))
+	bridge.SetTextMapPropagator(propagator)
+	opentracing.SetGlobalTracer(bridge)
+	otel.SetTracerProvider(wrapper)
+	otel.SetTextMapPropagator(propagator)
+
+	return tracerCloser{provider}
+}
+
+type tracerCloser struct {
+	provider *sdktrace.TracerProvider
+}
+
+func (c tracerCloser) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.provider.Shutdown(ctx)
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/plugins/message/external"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+// ConfigReloadKey is the setting update telling the instances to reload
+// their config file, its content is the digest of the file reloaded
+const ConfigReloadKey = "im.config.reload"
+
+// BroadcastConfigReload tells every instance to reload its config file
+func BroadcastConfigReload(ctx context.Context, digest string) error {
+	producer := config.GetConfig().Kafka.Producer.SettingUpdate
+	if _, ok := GetTransportMultiplexer().GetChannel(producer.Underlying, producer.Name); !ok {
+		return fmt.Errorf("no %s producer to broadcast the config reload", producer.Name)
+	}
+	span, _ := StartSpanFromContext(ctx, producer.Name)
+	defer span.Finish()
+	ExportMetricsBeforeSending(span, producer.Name, producer.Underlying)
+	return GetTransportMultiplexer().SendWithRetry(
+		producer.Underlying,
+		producer.Name,
+		&core.TransportPubMsg{
+			Keys:    []byte{},
+			Obj:     &external.ReqPutSettingRequest{SettingKey: ConfigReloadKey, Content: digest},
+			Headers: InjectSpanToHeaderForSending(span),
+		})
+}
+
+// ConfigReloadConsumer reloads the config file when another instance
+// broadcasts a reload
+type ConfigReloadConsumer struct{}
+
+func NewConfigReloadConsumer(underlying, name string) *ConfigReloadConsumer {
+	val, ok := GetTransportMultiplexer().GetChannel(underlying, name)
+	if ok {
+		channel := val.(core.IChannel)
+		c := &ConfigReloadConsumer{}
+		channel.SetHandler(c)
+
+		return c
+	}
+
+	return nil
+}
+
+func (c *ConfigReloadConsumer) Start() error {
+	return nil
+}
+
+func (c *ConfigReloadConsumer) OnMessage(ctx context.Context, topic string, partition int32, data []byte, rawMsg interface{}) {
+	var req external.ReqPutSettingRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.Errorf("ConfigReloadConsumer unmarshal error %v", err)
+		return
+	}
+	if req.SettingKey != ConfigReloadKey {
+		return
+	}
+	cur, _, err := config.Reload()
+	if err != nil {
+		log.Errorf("ConfigReloadConsumer reload config error %v", err)
+		return
+	}
+	if cur.Digest != req.Content {
+		log.Warnf("ConfigReloadConsumer config digest %s differs from the one broadcast %s", cur.Digest, req.Content)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"log"
 	"sync"
 
+	"github.com/finogeeks/ligase/common/health"
 	"github.com/finogeeks/ligase/core"
 	mon "github.com/finogeeks/ligase/skunkworks/monitor/go-client/monitor"
 	"github.com/finogeeks/ligase/storage/model"
@@ -28,12 +29,16 @@ var (
 	regMu      sync.RWMutex
 	dbMap      sync.Map
 	newHandler = make(map[string]func(string, string, string, string, string, bool) (interface{}, error))
+	migrations = make(map[string][]Migration)
 	gauge      mon.LabeledGauge
 	once       sync.Once
 )
 
 //can't use skunkworks log
-func Register(name string, f func(string, string, string, string, string, bool) (interface{}, error)) {
+// Register records the constructor of the database name and its schema
+// migrations, in ascending version order. The constructor applies them with
+// Migrate.
+func Register(name string, f func(string, string, string, string, string, bool) (interface{}, error), ms ...Migration) {
 	regMu.Lock()
 	defer regMu.Unlock()
 
@@ -46,7 +51,14 @@ func Register(name string, f func(string, string, string, string, string, bool)
 		log.Panicf("DatabaseMng Register: %s already registered\n", name)
 	}
 
+	for i := range ms {
+		if ms[i].Version <= 0 || (i > 0 && ms[i].Version <= ms[i-1].Version) {
+			log.Panicf("DatabaseMng Register: %s migration %d out of order\n", name, ms[i].Version)
+		}
+	}
+
 	newHandler[name] = f
+	migrations[name] = ms
 }
 
 func GetDBInstance(name string, cfg core.IConfig) (interface{}, error) {
@@ -69,6 +81,7 @@ func GetDBInstance(name string, cfg core.IConfig) (interface{}, error) {
 
 	dbMon := val.(model.DBMonitor)
 	dbMon.SetGauge(GetGaugeInstance())
+	health.Register("db:"+name, dbMon.Ping)
 
 	return val, err
 }
@@ -31,6 +31,7 @@ var FirstDomain string
 type DomainMng struct {
 	cache        service.Cache
 	servernameDB model.ConfigDatabase
+	domainsMu    sync.RWMutex
 	domains      []string
 	fromDb       bool
 	idg          *uid.UidGenerator
@@ -58,6 +59,8 @@ func GetDomainMngInstance(
 
 func (dm *DomainMng) GetDomain() []string {
 	if !dm.fromDb {
+		dm.domainsMu.RLock()
+		defer dm.domainsMu.RUnlock()
 		return dm.domains
 	}
 	domains, err := dm.cache.GetDomains()
@@ -69,12 +72,16 @@ func (dm *DomainMng) GetDomain() []string {
 		if err != nil {
 			log.Errorf("get domains from database err:%v", err)
 			//use last domains
+			dm.domainsMu.RLock()
+			defer dm.domainsMu.RUnlock()
 			return dm.domains
 		} else {
 			//db is empty too
 			flag := false
 			if len(domains) <= 0 {
+				dm.domainsMu.RLock()
 				domains = dm.domains
+				dm.domainsMu.RUnlock()
 				flag = true
 			}
 			log.Info("recover domains to cache and recover database if empty")
@@ -89,14 +96,30 @@ func (dm *DomainMng) GetDomain() []string {
 		}
 	}
 	//update to lastest
+	dm.domainsMu.Lock()
 	dm.domains = domains
+	dm.domainsMu.Unlock()
 	adapter.SetDomainCfg(domains)
 	return domains
 }
 
+// SetDomains replaces the domains of the config after a reload, the
+// domains read from the database are managed there
+func (dm *DomainMng) SetDomains(domains []string) {
+	if dm.fromDb {
+		log.Warnf("domains are read from the database, the reloaded server_name is ignored")
+		return
+	}
+	dm.domainsMu.Lock()
+	dm.domains = domains
+	dm.domainsMu.Unlock()
+	adapter.SetDomainCfg(domains)
+	log.Infof("domains reloaded: %v", domains)
+}
+
 func CheckValidDomain(domain string, domains []string) bool {
 	checkDomains := []string{}
-	if DomainMngInsance == nil || !DomainMngInsance.fromDb {
+	if DomainMngInsance == nil {
 		checkDomains = domains
 	} else {
 		checkDomains = DomainMngInsance.GetDomain()
@@ -81,6 +81,13 @@ type HistoryVisibilityContent struct {
 	HistoryVisibility string `json:"history_visibility"`
 }
 
+// RetentionContent is the event content for m.room.retention, the lifetimes are
+// in milliseconds
+type RetentionContent struct {
+	MinLifetime *int64 `json:"min_lifetime,omitempty"`
+	MaxLifetime *int64 `json:"max_lifetime,omitempty"`
+}
+
 type VisibilityContent struct {
 	Visibility string `json:"visibility"`
 }
@@ -0,0 +1,151 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package health serves the liveness and readiness of a server. /healthz
+// answers as long as the process serves http, /readyz checks the
+// dependencies registered by the databases, caches and transports the
+// server opened, and the startup tasks still running:
+//
+//	{"status":"unavailable","checks":{"db:accounts":"ok","redis":"dial tcp: i/o timeout","startup":"pending"}}
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check returns an error when the dependency can't be used
+type Check func(ctx context.Context) error
+
+// CheckTimeout bounds the checks of a /readyz request
+var CheckTimeout = 3 * time.Second
+
+var (
+	mu      sync.RWMutex
+	checks  = make(map[string]Check)
+	pending = make(map[string]bool)
+)
+
+// Register adds the check of a dependency, a check registered again with
+// the same name replaces the previous one
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// Begin marks a startup task running, the server is not ready until it
+// is finished
+func Begin(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	pending[name] = true
+}
+
+// Finish marks a startup task finished
+func Finish(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(pending, name)
+}
+
+// Status is the body of /readyz
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Ready runs the checks, the server is ready when all of them pass and
+// no startup task is pending
+func Ready(ctx context.Context) (bool, Status) {
+	mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fns := make([]Check, len(names))
+	for i, name := range names {
+		fns[i] = checks[name]
+	}
+	status := Status{Status: "ok", Checks: make(map[string]string, len(names)+len(pending))}
+	for name := range pending {
+		status.Checks[name] = "pending"
+	}
+	mu.RUnlock()
+
+	// a check ignoring ctx is reported as timed out all the same
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+	type result struct {
+		i   int
+		err error
+	}
+	results := make(chan result, len(fns))
+	for i, fn := range fns {
+		go func(i int, fn Check) {
+			results <- result{i, fn(ctx)}
+		}(i, fn)
+	}
+	errs := make([]error, len(fns))
+	for i := range errs {
+		errs[i] = context.DeadlineExceeded
+	}
+	for n := 0; n < len(fns); n++ {
+		select {
+		case r := <-results:
+			errs[r.i] = r.err
+		case <-ctx.Done():
+			n = len(fns)
+		}
+	}
+
+	ready := len(status.Checks) == 0
+	for i, name := range names {
+		if errs[i] != nil {
+			status.Checks[name] = errs[i].Error()
+			ready = false
+		} else {
+			status.Checks[name] = "ok"
+		}
+	}
+	if !ready {
+		status.Status = "unavailable"
+	}
+	return ready, status
+}
+
+// Handle registers /healthz and /readyz on mux
+func Handle(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", serveHealthz)
+	mux.HandleFunc("/readyz", serveReadyz)
+}
+
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n")) // nolint: errcheck
+}
+
+func serveReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, status := Ready(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status) // nolint: errcheck
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func readyz(t *testing.T, mux *http.ServeMux) (int, Status) {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	var status Status
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("readyz body %q: %v", w.Body.String(), err)
+	}
+	return w.Code, status
+}
+
+func TestReadyz(t *testing.T) {
+	mux := http.NewServeMux()
+	Handle(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("healthz = %d", w.Code)
+	}
+
+	var dbErr error
+	Register("db", func(ctx context.Context) error { return dbErr })
+	Begin("startup")
+	code, status := readyz(t, mux)
+	if code != http.StatusServiceUnavailable || status.Checks["startup"] != "pending" || status.Checks["db"] != "ok" {
+		t.Fatalf("readyz while starting = %d %+v", code, status)
+	}
+
+	Finish("startup")
+	if code, status = readyz(t, mux); code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("readyz = %d %+v", code, status)
+	}
+
+	dbErr = errors.New("connection refused")
+	if code, status = readyz(t, mux); code != http.StatusServiceUnavailable || status.Checks["db"] != "connection refused" {
+		t.Fatalf("readyz with db down = %d %+v", code, status)
+	}
+	dbErr = nil
+
+	// a hanging dependency is reported once the checks time out
+	defer func(timeout time.Duration) { CheckTimeout = timeout }(CheckTimeout)
+	CheckTimeout = 10 * time.Millisecond
+	hang := make(chan struct{})
+	defer close(hang)
+	Register("redis", func(ctx context.Context) error {
+		<-hang
+		return nil
+	})
+	if code, status = readyz(t, mux); code != http.StatusServiceUnavailable || status.Checks["redis"] != context.DeadlineExceeded.Error() {
+		t.Fatalf("readyz with redis hanging = %d %+v", code, status)
+	}
+}
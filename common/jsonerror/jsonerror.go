@@ -103,6 +103,22 @@ func UnknownToken(msg string) *MatrixError {
 	return &MatrixError{ErrCode: "M_UNKNOWN_TOKEN", Err: msg}
 }
 
+// UnknownTokenError is an M_UNKNOWN_TOKEN error which may tell the client to
+// soft logout, i.e. to refresh or log in again without dropping its data
+type UnknownTokenError struct {
+	MatrixError
+	SoftLogout bool `json:"soft_logout"`
+}
+
+// SoftLogout is an error when the client supplies an access token which has
+// expired and can be replaced by using its refresh token
+func SoftLogout(msg string) *UnknownTokenError {
+	return &UnknownTokenError{
+		MatrixError: MatrixError{ErrCode: "M_UNKNOWN_TOKEN", Err: msg},
+		SoftLogout:  true,
+	}
+}
+
 func PwdChangeKick(msg string) *MatrixError {
 	return &MatrixError{ErrCode: "M_PWD_CHANGE_KICK", Err: msg}
 }
@@ -125,6 +141,12 @@ func UserInUse(msg string) *MatrixError {
 	return &MatrixError{ErrCode: "M_USER_IN_USE", Err: msg}
 }
 
+// UserLocked is an error returned when a server admin locked the account the
+// client tries to use
+func UserLocked(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_USER_LOCKED", Err: msg}
+}
+
 // ASExclusive is an error returned when an application service tries to
 // register an username that is outside of its registered namespace, or if a
 // user attempts to register a username within an exclusive namespace
@@ -132,6 +154,35 @@ func ASExclusive(msg string) *MatrixError {
 	return &MatrixError{ErrCode: "M_EXCLUSIVE", Err: msg}
 }
 
+// ThreePIDInUse is an error returned when the third party identifier is
+// already bound to an account
+func ThreePIDInUse(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_THREEPID_IN_USE", Err: msg}
+}
+
+// ThreePIDNotFound is an error returned when no account has the third party
+// identifier
+func ThreePIDNotFound(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_THREEPID_NOT_FOUND", Err: msg}
+}
+
+// ThreePIDAuthFailed is an error returned when a validation session is
+// unknown, expired or not validated yet
+func ThreePIDAuthFailed(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_THREEPID_AUTH_FAILED", Err: msg}
+}
+
+// ThreePIDMediumNotSupported is an error returned when the server does not
+// validate identifiers of the medium
+func ThreePIDMediumNotSupported(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_THREEPID_MEDIUM_NOT_SUPPORTED", Err: msg}
+}
+
+// InvalidParam is an error returned when a parameter has the wrong format
+func InvalidParam(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_INVALID_PARAM", Err: msg}
+}
+
 // GuestAccessForbidden is an error which is returned when the client is
 // forbidden from accessing a resource as a guest.
 func GuestAccessForbidden(msg string) *MatrixError {
@@ -152,6 +203,30 @@ func LimitExceeded(msg string, retryAfterMS int64) *LimitExceededError {
 	}
 }
 
+// URLNotSet is an error when the application service to reach has no url
+// configured
+func URLNotSet(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_URL_NOT_SET", Err: msg}
+}
+
+// ConnectionFailed is an error when the homeserver could not connect to an
+// application service
+func ConnectionFailed(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_CONNECTION_FAILED", Err: msg}
+}
+
+// ConnectionTimeout is an error when an application service did not answer
+// in time
+func ConnectionTimeout(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_CONNECTION_TIMEOUT", Err: msg}
+}
+
+// BadStatus is an error when an application service answered with a
+// non-2xx status code
+func BadStatus(msg string) *MatrixError {
+	return &MatrixError{ErrCode: "M_BAD_STATUS", Err: msg}
+}
+
 // NotTrusted is an error which is returned when the client asks the server to
 // proxy a request (e.g. 3PID association) to a server that isn't trusted
 func NotTrusted(serverName string) *MatrixError {
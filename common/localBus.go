@@ -0,0 +1,206 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/go-nats"
+)
+
+// Subscription is a subscription to nats or to a LocalBus
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// LocalBus passes messages between the components of one process, in place
+// of nats. Subjects are matched exactly, the subscribers of a queue group
+// share the messages, and a subscription gets its messages in order on a
+// goroutine of its own, as with nats.
+type LocalBus struct {
+	mu    sync.RWMutex
+	subs  map[string][]*localSub
+	next  uint64
+	inbox uint64
+}
+
+type localSub struct {
+	bus     *LocalBus
+	subject string
+	queue   string
+	cb      nats.MsgHandler
+	// set for the inbox of a request, which takes the first reply only
+	reply chan *nats.Msg
+
+	mu      sync.Mutex
+	pending []*nats.Msg
+	signal  chan struct{}
+	closed  bool
+}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{subs: make(map[string][]*localSub)}
+}
+
+func (b *LocalBus) IsConnected() bool {
+	return true
+}
+
+func (b *LocalBus) Subscribe(subject string, cb nats.MsgHandler) (Subscription, error) {
+	return b.QueueSubscribe(subject, "", cb)
+}
+
+func (b *LocalBus) QueueSubscribe(subject, queue string, cb nats.MsgHandler) (Subscription, error) {
+	sub := &localSub{bus: b, subject: subject, queue: queue, cb: cb, signal: make(chan struct{}, 1)}
+	b.add(sub)
+	go sub.run()
+	return sub, nil
+}
+
+func (b *LocalBus) add(sub *localSub) {
+	b.mu.Lock()
+	b.subs[sub.subject] = append(b.subs[sub.subject], sub)
+	b.mu.Unlock()
+}
+
+func (b *LocalBus) remove(sub *localSub) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.subs[sub.subject]
+	for i, s := range subs {
+		if s == sub {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(b.subs, sub.subject)
+	} else {
+		b.subs[sub.subject] = subs
+	}
+}
+
+// Publish hands data to every subscriber of subject, and to one subscriber
+// of each queue group
+func (b *LocalBus) Publish(subject string, data []byte) error {
+	b.publish(subject, "", data)
+	return nil
+}
+
+func (b *LocalBus) publish(subject, reply string, data []byte) int {
+	b.mu.RLock()
+	subs := b.subs[subject]
+	var groups map[string][]*localSub
+	targets := make([]*localSub, 0, len(subs))
+	for _, sub := range subs {
+		if sub.queue == "" {
+			targets = append(targets, sub)
+			continue
+		}
+		if groups == nil {
+			groups = make(map[string][]*localSub)
+		}
+		groups[sub.queue] = append(groups[sub.queue], sub)
+	}
+	b.mu.RUnlock()
+	for _, members := range groups {
+		n := atomic.AddUint64(&b.next, 1)
+		targets = append(targets, members[n%uint64(len(members))])
+	}
+
+	for _, sub := range targets {
+		// every subscriber gets a message of its own, the handlers strip
+		// the tracing header from msg.Data
+		sub.deliver(&nats.Msg{Subject: subject, Reply: reply, Data: data})
+	}
+	return len(targets)
+}
+
+// Request publishes data with an inbox for the reply, and waits for it
+func (b *LocalBus) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	inbox := &localSub{
+		bus:     b,
+		subject: "_INBOX." + strconv.FormatUint(atomic.AddUint64(&b.inbox, 1), 10),
+		reply:   make(chan *nats.Msg, 1),
+	}
+	b.add(inbox)
+	defer b.remove(inbox)
+
+	if b.publish(subject, inbox.subject, data) == 0 {
+		return nil, fmt.Errorf("nats: no subscribers on %s", subject)
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-inbox.reply:
+		return msg, nil
+	case <-timer.C:
+		return nil, nats.ErrTimeout
+	}
+}
+
+func (s *localSub) deliver(msg *nats.Msg) {
+	if s.reply != nil {
+		select {
+		case s.reply <- msg:
+		default:
+		}
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.pending = append(s.pending, msg)
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+	s.mu.Unlock()
+}
+
+func (s *localSub) run() {
+	for range s.signal {
+		for {
+			s.mu.Lock()
+			if s.closed || len(s.pending) == 0 {
+				s.pending = nil
+				s.mu.Unlock()
+				break
+			}
+			msg := s.pending[0]
+			s.pending[0] = nil
+			s.pending = s.pending[1:]
+			s.mu.Unlock()
+			s.cb(msg)
+		}
+	}
+}
+
+func (s *localSub) Unsubscribe() error {
+	s.bus.remove(s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed && s.reply == nil {
+		s.closed = true
+		close(s.signal)
+	}
+	return nil
+}
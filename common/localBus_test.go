@@ -0,0 +1,98 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/nats-io/go-nats"
+)
+
+func TestLocalBusQueueGroups(t *testing.T) {
+	bus := NewLocalBus()
+	var mu sync.Mutex
+	got := map[string]int{}
+	var wg sync.WaitGroup
+	count := func(name string) nats.MsgHandler {
+		return func(msg *nats.Msg) {
+			mu.Lock()
+			got[name]++
+			mu.Unlock()
+			wg.Done()
+		}
+	}
+	bus.QueueSubscribe("topic", "grp", count("grp1"))
+	bus.QueueSubscribe("topic", "grp", count("grp2"))
+	bus.Subscribe("topic", count("all"))
+	sub, _ := bus.Subscribe("topic", count("gone"))
+	sub.Unsubscribe()
+
+	wg.Add(20)
+	for i := 0; i < 10; i++ {
+		bus.Publish("topic", []byte("x"))
+	}
+	wg.Wait()
+	if got["all"] != 10 || got["grp1"]+got["grp2"] != 10 || got["grp1"] == 0 || got["grp2"] == 0 || got["gone"] != 0 {
+		t.Fatalf("deliveries %v", got)
+	}
+}
+
+func TestLocalBusOrder(t *testing.T) {
+	bus := NewLocalBus()
+	done := make(chan struct{})
+	next := byte(0)
+	bus.Subscribe("topic", func(msg *nats.Msg) {
+		if msg.Data[0] != next {
+			t.Errorf("got %d, want %d", msg.Data[0], next)
+		}
+		if next++; next == 100 {
+			close(done)
+		}
+	})
+	for i := 0; i < 100; i++ {
+		bus.Publish("topic", []byte{byte(i)})
+	}
+	<-done
+}
+
+func TestLocalBusRequest(t *testing.T) {
+	bus := NewLocalBus()
+	if _, err := bus.Request("none", nil, time.Second); err == nil {
+		t.Fatal("request without subscribers")
+	}
+	bus.Subscribe("slow", func(msg *nats.Msg) {})
+	if _, err := bus.Request("slow", nil, 10*time.Millisecond); err != nats.ErrTimeout {
+		t.Fatalf("request without a reply: %v", err)
+	}
+}
+
+func TestInProcessRpcClient(t *testing.T) {
+	client := NewRpcClient(config.InProcessNatsURI, nil)
+	client.Start(false)
+	if !client.InProcess() {
+		t.Fatal("not in process")
+	}
+	client.ReplyGrpWithContext("TestInProcessRpcClient", "grp", func(ctx context.Context, msg *nats.Msg) {
+		client.Pub(msg.Reply, append([]byte("re:"), msg.Data...))
+	})
+	data, err := client.RequestWithContext(context.Background(), "TestInProcessRpcClient", []byte("ping"), 1000)
+	if err != nil || string(data) != "re:ping" {
+		t.Fatalf("reply %q %v", data, err)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/lib/pq"
+)
+
+// Migration is a schema change of a database, applied once. Migrations are
+// never edited once released, a change of schema is a new migration. The
+// first migration of a database is its initial schema, which only creates
+// what does not exist yet, so databases older than the migrations adopt it.
+type Migration struct {
+	Version     int64
+	Description string
+	Up          string
+}
+
+// MigrationState is a migration of a database, AppliedAt is 0 while it is
+// pending
+type MigrationState struct {
+	Migration
+	AppliedAt int64
+}
+
+const migrationsSchema = `
+-- The schema migrations applied to the databases
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    -- The name the database is registered with
+    name TEXT NOT NULL,
+    version BIGINT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    -- When the migration was applied, in milliseconds
+    applied_at BIGINT NOT NULL,
+    PRIMARY KEY(name, version)
+);
+`
+
+const selectMigrationsSQL = "" +
+	"SELECT version, applied_at FROM schema_migrations WHERE name = $1"
+
+const insertMigrationSQL = "" +
+	"INSERT INTO schema_migrations(name, version, description, applied_at) VALUES ($1, $2, $3, $4)"
+
+// migrationLockKey is the advisory lock held while migrating, the databases
+// may share a postgres database so there is a single one
+const migrationLockKey = 0x6c6967617365
+
+// MigrationNames returns the registered databases, sorted
+func MigrationNames() []string {
+	regMu.RLock()
+	defer regMu.RUnlock()
+	names := make([]string, 0, len(newHandler))
+	for name := range newHandler {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Migrate applies the pending migrations of the database name. Instances
+// starting together wait on an advisory lock, then find the migrations
+// applied by the first one. A sqlite file has a single writer.
+func Migrate(db *sql.DB, driver, name string) error {
+	ctx := context.Background()
+	// the lock belongs to the session, everything runs on the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() // nolint: errcheck
+
+	if driver != SQLiteDriver {
+		if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey) // nolint: errcheck
+	}
+
+	if _, err = conn.ExecContext(ctx, migrationsSchema); err != nil {
+		return err
+	}
+	states, err := migrationStates(ctx, conn, name)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if state.AppliedAt != 0 {
+			continue
+		}
+		if err = applyMigration(ctx, conn, name, state.Migration); err != nil {
+			return fmt.Errorf("migrate %s to version %d: %v", name, state.Version, err)
+		}
+		log.Infof("migrated %s to version %d, %s", name, state.Version, state.Description)
+	}
+	return nil
+}
+
+// MigrationStatus returns the migrations of the database name, applied or not
+func MigrationStatus(db *sql.DB, name string) ([]MigrationState, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // nolint: errcheck
+	return migrationStates(ctx, conn, name)
+}
+
+func migrationStates(ctx context.Context, conn *sql.Conn, name string) ([]MigrationState, error) {
+	applied := make(map[int64]int64)
+	rows, err := conn.QueryContext(ctx, selectMigrationsSQL, name)
+	if err != nil {
+		// nothing was ever migrated
+		if pqErr, ok := err.(*pq.Error); !ok || pqErr.Code != "42P01" {
+			return nil, err
+		}
+	} else {
+		defer rows.Close() // nolint: errcheck
+		for rows.Next() {
+			var version, appliedAt int64
+			if err = rows.Scan(&version, &appliedAt); err != nil {
+				return nil, err
+			}
+			applied[version] = appliedAt
+		}
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	regMu.RLock()
+	ms := migrations[name]
+	regMu.RUnlock()
+	states := make([]MigrationState, 0, len(ms))
+	for _, m := range ms {
+		states = append(states, MigrationState{Migration: m, AppliedAt: applied[m.Version]})
+		delete(applied, m.Version)
+	}
+	for version := range applied {
+		log.Warnf("%s schema version %d is unknown, the database was migrated by a newer release", name, version)
+	}
+	return states, nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, name string, m Migration) error {
+	txn, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = txn.ExecContext(ctx, m.Up); err == nil {
+		_, err = txn.ExecContext(ctx, insertMigrationSQL, name, m.Version, m.Description, time.Now().UnixNano()/1000000)
+	}
+	if err != nil {
+		txn.Rollback() // nolint: errcheck
+		return err
+	}
+	return txn.Commit()
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package purge deletes the history of a room, for the admin purge api and
+// the retention policies.
+package purge
+
+import (
+	"context"
+	"errors"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/model/types"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const batchSize = 500
+
+// ErrRoomLegalHold is returned when purging a room which is under legal hold
+var ErrRoomLegalHold = errors.New("room is under legal hold")
+
+// RoomEventsBefore deletes the events of roomID sent before ts from the
+// sync and roomserver storage. State events, the events sent by users under
+// legal hold and the latest messages, which the room summary points to, are
+// kept. progress, if not nil, is called with the running count after every
+// batch.
+func RoomEventsBefore(
+	ctx context.Context,
+	roomDB model.RoomServerDatabase,
+	syncDB model.SyncAPIDatabase,
+	cache service.Cache,
+	rpcClient *common.RpcClient,
+	roomID string,
+	ts int64,
+	progress func(deleted int64),
+) (int64, error) {
+	held, err := syncDB.GetLegalHoldTargets(ctx, []string{roomID})
+	if err != nil {
+		return 0, err
+	}
+	if held[roomID] {
+		return 0, ErrRoomLegalHold
+	}
+	maxPos, err := syncDB.SelectRoomMaxStream(ctx, roomID)
+	if err != nil {
+		return 0, err
+	}
+	keep := map[string]bool{}
+	if ext, err := cache.GetRoomStateExt(roomID); err == nil && ext != nil {
+		keep[ext.PreMsgId] = true
+		keep[ext.LastMsgId] = true
+	}
+
+	var deleted int64
+	// backfilled events have negative stream positions
+	var fromPos int64 = -1 << 62
+	for {
+		eventIDs, senders, lastPos, scanned, err := syncDB.SelectRoomPurgeEvents(ctx, roomID, ts, fromPos, maxPos, batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		heldSenders, err := syncDB.GetLegalHoldTargets(ctx, senders)
+		if err != nil {
+			return deleted, err
+		}
+		purge := make([]string, 0, len(eventIDs))
+		for i, eventID := range eventIDs {
+			if !keep[eventID] && !heldSenders[senders[i]] {
+				purge = append(purge, eventID)
+			}
+		}
+		if len(purge) > 0 {
+			if err := syncDB.DeleteRoomEvents(ctx, roomID, purge); err != nil {
+				return deleted, err
+			}
+			if _, err := roomDB.PurgeEvents(ctx, purge); err != nil {
+				return deleted, err
+			}
+			deleted += int64(len(purge))
+			if progress != nil {
+				progress(deleted)
+			}
+		}
+		if scanned < batchSize {
+			break
+		}
+		fromPos = lastPos
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	if err := cache.DelRoomState(roomID); err != nil {
+		log.Errorf("purge room %s del room state cache error %v", roomID, err)
+	}
+	bytes, _ := json.Marshal(types.RoomHistoryPurgeContent{RoomID: roomID})
+	rpcClient.Pub(types.RoomHistoryPurgeTopicDef, bytes)
+	return deleted, nil
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package redispool
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/gomodule/redigo/redis"
+)
+
+// clusterRouter follows the slot map of a redis cluster
+type clusterRouter struct {
+	seeds    []string
+	password string
+
+	mu         sync.RWMutex
+	slots      []string
+	refreshing int32
+}
+
+func newClusterRouter(conf config.RedisConf) (*clusterRouter, error) {
+	if len(conf.Uris) == 0 {
+		return nil, errors.New("redispool: no redis cluster uris")
+	}
+	r := &clusterRouter{slots: make([]string, slotCount)}
+	for _, uri := range conf.Uris {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+		r.seeds = append(r.seeds, u.Host)
+		if pwd, ok := u.User.Password(); ok && r.password == "" {
+			r.password = pwd
+		}
+	}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// nodes returns the seeds and the nodes of the slot map
+func (r *clusterRouter) nodes() []string {
+	seen := make(map[string]bool)
+	var nodes []string
+	r.mu.RLock()
+	for _, addr := range append(append([]string{}, r.seeds...), r.slots...) {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			nodes = append(nodes, addr)
+		}
+	}
+	r.mu.RUnlock()
+	return nodes
+}
+
+// refresh loads the slot map from the first node answering
+func (r *clusterRouter) refresh() error {
+	var lastErr error
+	for _, addr := range r.nodes() {
+		slots, err := r.clusterSlots(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r.mu.Lock()
+		r.slots = slots
+		r.mu.Unlock()
+		return nil
+	}
+	log.Errorf("redispool cluster refresh slots error %v", lastErr)
+	return lastErr
+}
+
+func (r *clusterRouter) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&r.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&r.refreshing, 0)
+		r.refresh()
+	}()
+}
+
+func (r *clusterRouter) clusterSlots(addr string) ([]string, error) {
+	conn, err := r.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// 1) 1) start 2) end 3) 1) ip 2) port 3) id, then the replicas
+	ranges, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	slots := make([]string, slotCount)
+	for _, item := range ranges {
+		fields, err := redis.Values(item, nil)
+		if err != nil || len(fields) < 3 {
+			return nil, errors.New("redispool: invalid CLUSTER SLOTS reply")
+		}
+		start, _ := redis.Int(fields[0], nil)
+		end, _ := redis.Int(fields[1], nil)
+		master, err := redis.Values(fields[2], nil)
+		if err != nil || len(master) < 2 {
+			return nil, errors.New("redispool: invalid CLUSTER SLOTS reply")
+		}
+		ip, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+		if ip == "" {
+			// the node asked
+			ip = host
+		}
+		node := net.JoinHostPort(ip, strconv.Itoa(port))
+		for slot := start; slot <= end && slot < slotCount; slot++ {
+			slots[slot] = node
+		}
+	}
+	return slots, nil
+}
+
+func (r *clusterRouter) addr(key string) (string, error) {
+	if key != "" {
+		r.mu.RLock()
+		addr := r.slots[Slot(key)]
+		r.mu.RUnlock()
+		if addr != "" {
+			return addr, nil
+		}
+		// an uncovered slot, the node asked redirects if it knows better
+		r.refreshAsync()
+	}
+	return r.seeds[0], nil
+}
+
+func (r *clusterRouter) dial(addr string) (redis.Conn, error) {
+	var opts []redis.DialOption
+	if r.password != "" {
+		opts = append(opts, redis.DialPassword(r.password))
+	}
+	return redis.Dial("tcp", addr, opts...)
+}
+
+func (r *clusterRouter) moved(slot int, addr string) {
+	if slot < 0 || slot >= slotCount {
+		return
+	}
+	r.mu.Lock()
+	r.slots[slot] = addr
+	r.mu.Unlock()
+	// a MOVED seldom comes alone, resharding moves ranges of slots
+	r.refreshAsync()
+}
+
+func (r *clusterRouter) failed(addr string) {
+	r.refreshAsync()
+}
+
+// masters returns the nodes of the slot map sorted, the order of the nodes a
+// SCAN walks must not depend on the slots they serve
+func (r *clusterRouter) masters() []string {
+	seen := make(map[string]bool)
+	var masters []string
+	r.mu.RLock()
+	for _, addr := range r.slots {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			masters = append(masters, addr)
+		}
+	}
+	r.mu.RUnlock()
+	if len(masters) == 0 {
+		return r.seeds[:1]
+	}
+	sort.Strings(masters)
+	return masters
+}
+
+func (r *clusterRouter) crossSlot() bool {
+	return false
+}
@@ -0,0 +1,750 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package redispool
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ScriptFunc runs a lua script of the code in the memory store. call runs a
+// command as redis.call does, the store stays locked for the whole script.
+// The replies are the ones of redis: int64 for numbers, nil for false.
+type ScriptFunc func(call func(cmd string, args ...interface{}) (interface{}, error), keys, args []string) (interface{}, error)
+
+var (
+	scriptsMu sync.RWMutex
+	scripts   = map[string]ScriptFunc{}
+)
+
+// RegisterScript gives the go version of the lua script src, the memory
+// store runs it for EVAL and EVALSHA of src
+func RegisterScript(src string, f ScriptFunc) {
+	sum := sha1.Sum([]byte(src))
+	scriptsMu.Lock()
+	scripts[hex.EncodeToString(sum[:])] = f
+	scriptsMu.Unlock()
+}
+
+type memEntry struct {
+	// string, map[string]string for a hash or map[string]struct{} for a set
+	val interface{}
+	// zero when the key does not expire
+	expire time.Time
+}
+
+// memStore keeps the keys in maps with their ttl, in place of redis for a
+// server running on its own. The pools of a process share one store.
+type memStore struct {
+	mu   sync.Mutex
+	data map[string]*memEntry
+}
+
+var (
+	memoryOnce  sync.Once
+	memoryStore *memStore
+)
+
+func getMemoryStore() *memStore {
+	memoryOnce.Do(func() {
+		memoryStore = &memStore{data: make(map[string]*memEntry)}
+		go memoryStore.sweep(time.Minute)
+	})
+	return memoryStore
+}
+
+// sweep drops the expired keys nobody reads again
+func (s *memStore) sweep(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+		s.mu.Lock()
+		for key, e := range s.data {
+			if !e.expire.IsZero() && !now.Before(e.expire) {
+				delete(s.data, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+var (
+	errWrongType = redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errSyntax    = redis.Error("ERR syntax error")
+	errNotInt    = redis.Error("ERR value is not an integer or out of range")
+)
+
+// minArgs are the arguments the commands need at least
+var minArgs = map[string]int{
+	"GET": 1, "SET": 2, "SETEX": 3, "GETSET": 2, "DEL": 1, "EXISTS": 1, "EXPIRE": 2, "PEXPIRE": 2,
+	"TTL": 1, "PTTL": 1, "INCR": 1, "DECR": 1, "INCRBY": 2, "DECRBY": 2,
+	"HGET": 2, "HSET": 3, "HMSET": 3, "HMGET": 2, "HGETALL": 1, "HDEL": 2, "HEXISTS": 2, "HINCRBY": 3, "HLEN": 1, "HSCAN": 2,
+	"SADD": 2, "SREM": 2, "SMEMBERS": 1, "SISMEMBER": 2, "SCARD": 1, "SCAN": 1, "KEYS": 1, "EVAL": 2, "EVALSHA": 2,
+}
+
+func errArgs(cmd string) error {
+	return redis.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
+
+// get returns the live entry of key, nil when there is none
+func (s *memStore) get(key string) *memEntry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expire.IsZero() && !time.Now().Before(e.expire) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+func (s *memStore) str(key string) (string, bool, error) {
+	e := s.get(key)
+	if e == nil {
+		return "", false, nil
+	}
+	v, ok := e.val.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return v, true, nil
+}
+
+// hash returns the hash at key, created when create is set
+func (s *memStore) hash(key string, create bool) (map[string]string, error) {
+	e := s.get(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		h := make(map[string]string)
+		s.data[key] = &memEntry{val: h}
+		return h, nil
+	}
+	h, ok := e.val.(map[string]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func (s *memStore) set(key string, create bool) (map[string]struct{}, error) {
+	e := s.get(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		m := make(map[string]struct{})
+		s.data[key] = &memEntry{val: m}
+		return m, nil
+	}
+	m, ok := e.val.(map[string]struct{})
+	if !ok {
+		return nil, errWrongType
+	}
+	return m, nil
+}
+
+// drop removes the hashes and sets left empty, as redis does
+func (s *memStore) drop(key string) {
+	e, ok := s.data[key]
+	if !ok {
+		return
+	}
+	switch v := e.val.(type) {
+	case map[string]string:
+		if len(v) == 0 {
+			delete(s.data, key)
+		}
+	case map[string]struct{}:
+		if len(v) == 0 {
+			delete(s.data, key)
+		}
+	}
+}
+
+func (s *memStore) do(cmd string, args []interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exec(cmd, args)
+}
+
+func (s *memStore) exec(cmd string, rawArgs []interface{}) (interface{}, error) {
+	args := make([]string, len(rawArgs))
+	for i, arg := range rawArgs {
+		args[i] = argString(arg)
+	}
+	cmd = strings.ToUpper(cmd)
+	if len(args) < minArgs[cmd] {
+		return nil, errArgs(cmd)
+	}
+
+	switch cmd {
+	case "PING":
+		return "PONG", nil
+	case "SELECT", "AUTH":
+		return "OK", nil
+	case "TIME":
+		now := time.Now()
+		return []interface{}{
+			[]byte(strconv.FormatInt(now.Unix(), 10)),
+			[]byte(strconv.Itoa(now.Nanosecond() / 1000)),
+		}, nil
+	case "DBSIZE":
+		n := int64(0)
+		for key := range s.data {
+			if s.get(key) != nil {
+				n++
+			}
+		}
+		return n, nil
+
+	case "GET":
+		v, ok, err := s.str(args[0])
+		if err != nil || !ok {
+			return nil, err
+		}
+		return []byte(v), nil
+	case "SET":
+		return s.setString(args)
+	case "SETEX":
+		secs, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errNotInt
+		}
+		s.data[args[0]] = &memEntry{val: args[2], expire: time.Now().Add(time.Duration(secs) * time.Second)}
+		return "OK", nil
+	case "GETSET":
+		v, ok, err := s.str(args[0])
+		if err != nil {
+			return nil, err
+		}
+		s.data[args[0]] = &memEntry{val: args[1]}
+		if !ok {
+			return nil, nil
+		}
+		return []byte(v), nil
+	case "DEL":
+		n := int64(0)
+		for _, key := range args {
+			if s.get(key) != nil {
+				delete(s.data, key)
+				n++
+			}
+		}
+		return n, nil
+	case "EXISTS":
+		n := int64(0)
+		for _, key := range args {
+			if s.get(key) != nil {
+				n++
+			}
+		}
+		return n, nil
+	case "EXPIRE", "PEXPIRE":
+		d, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errNotInt
+		}
+		e := s.get(args[0])
+		if e == nil {
+			return int64(0), nil
+		}
+		unit := time.Second
+		if cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		if d <= 0 {
+			delete(s.data, args[0])
+		} else {
+			e.expire = time.Now().Add(time.Duration(d) * unit)
+		}
+		return int64(1), nil
+	case "TTL", "PTTL":
+		e := s.get(args[0])
+		if e == nil {
+			return int64(-2), nil
+		}
+		if e.expire.IsZero() {
+			return int64(-1), nil
+		}
+		left := time.Until(e.expire)
+		if cmd == "TTL" {
+			return int64((left + time.Second - 1) / time.Second), nil
+		}
+		return int64(left / time.Millisecond), nil
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		by := int64(1)
+		if len(args) > 1 {
+			var err error
+			if by, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return nil, errNotInt
+			}
+		}
+		if cmd == "DECR" || cmd == "DECRBY" {
+			by = -by
+		}
+		v, ok, err := s.str(args[0])
+		if err != nil {
+			return nil, err
+		}
+		n := int64(0)
+		if ok {
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, errNotInt
+			}
+		}
+		n += by
+		if e := s.get(args[0]); e != nil {
+			e.val = strconv.FormatInt(n, 10)
+		} else {
+			s.data[args[0]] = &memEntry{val: strconv.FormatInt(n, 10)}
+		}
+		return n, nil
+
+	case "HGET":
+		h, err := s.hash(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := h[args[1]]; ok {
+			return []byte(v), nil
+		}
+		return nil, nil
+	case "HSET", "HMSET":
+		if len(args)%2 != 1 {
+			return nil, errArgs(cmd)
+		}
+		h, err := s.hash(args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(0)
+		for i := 1; i < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				n++
+			}
+			h[args[i]] = args[i+1]
+		}
+		if cmd == "HMSET" {
+			return "OK", nil
+		}
+		return n, nil
+	case "HMGET":
+		h, err := s.hash(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		reply := make([]interface{}, len(args)-1)
+		for i, field := range args[1:] {
+			if v, ok := h[field]; ok {
+				reply[i] = []byte(v)
+			}
+		}
+		return reply, nil
+	case "HGETALL":
+		h, err := s.hash(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		return flatHash(h, nil), nil
+	case "HDEL":
+		h, err := s.hash(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(0)
+		for _, field := range args[1:] {
+			if _, ok := h[field]; ok {
+				delete(h, field)
+				n++
+			}
+		}
+		s.drop(args[0])
+		return n, nil
+	case "HEXISTS":
+		h, err := s.hash(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := h[args[1]]; ok {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case "HINCRBY":
+		by, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return nil, errNotInt
+		}
+		h, err := s.hash(args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(0)
+		if v, ok := h[args[1]]; ok {
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, redis.Error("ERR hash value is not an integer")
+			}
+		}
+		n += by
+		h[args[1]] = strconv.FormatInt(n, 10)
+		return n, nil
+	case "HLEN":
+		h, err := s.hash(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		return int64(len(h)), nil
+	case "HSCAN":
+		h, err := s.hash(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		match, err := scanMatch(args[2:])
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{[]byte("0"), flatHash(h, match)}, nil
+
+	case "SADD":
+		m, err := s.set(args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(0)
+		for _, member := range args[1:] {
+			if _, ok := m[member]; !ok {
+				m[member] = struct{}{}
+				n++
+			}
+		}
+		return n, nil
+	case "SREM":
+		m, err := s.set(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		n := int64(0)
+		for _, member := range args[1:] {
+			if _, ok := m[member]; ok {
+				delete(m, member)
+				n++
+			}
+		}
+		s.drop(args[0])
+		return n, nil
+	case "SMEMBERS":
+		m, err := s.set(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		members := make([]string, 0, len(m))
+		for member := range m {
+			members = append(members, member)
+		}
+		return bulks(members), nil
+	case "SISMEMBER":
+		m, err := s.set(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[args[1]]; ok {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case "SCARD":
+		m, err := s.set(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		return int64(len(m)), nil
+
+	case "SCAN", "KEYS":
+		var match *regexp.Regexp
+		var err error
+		if cmd == "KEYS" {
+			match, err = globRegexp(args[0])
+		} else {
+			match, err = scanMatch(args[1:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{}
+		for key := range s.data {
+			if s.get(key) != nil && (match == nil || match.MatchString(key)) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		if cmd == "KEYS" {
+			return bulks(keys), nil
+		}
+		// the whole keyspace in one step, the cursor is back to 0
+		return []interface{}{[]byte("0"), bulks(keys)}, nil
+
+	case "EVAL", "EVALSHA":
+		return s.eval(cmd, args)
+	}
+	return nil, redis.Error(fmt.Sprintf("ERR unknown command '%s' in the memory store", strings.ToLower(cmd)))
+}
+
+// setString is SET key value [EX seconds|PX milliseconds] [NX|XX]
+func (s *memStore) setString(args []string) (interface{}, error) {
+	var expire time.Time
+	nx, xx := false, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			d, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || d <= 0 {
+				return nil, redis.Error("ERR invalid expire time in set")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expire = time.Now().Add(time.Duration(d) * unit)
+			i++
+		default:
+			return nil, errSyntax
+		}
+	}
+	exists := s.get(args[0]) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil, nil
+	}
+	s.data[args[0]] = &memEntry{val: args[1], expire: expire}
+	return "OK", nil
+}
+
+// eval runs a registered script, EVAL script|sha numkeys key... arg...
+func (s *memStore) eval(cmd string, args []string) (interface{}, error) {
+	sha := args[0]
+	if cmd == "EVAL" {
+		sum := sha1.Sum([]byte(args[0]))
+		sha = hex.EncodeToString(sum[:])
+	}
+	scriptsMu.RLock()
+	f, ok := scripts[sha]
+	scriptsMu.RUnlock()
+	if !ok {
+		if cmd == "EVALSHA" {
+			return nil, redis.Error("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return nil, redis.Error("ERR the memory store only runs the registered scripts")
+	}
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+		return nil, redis.Error("ERR Number of keys can't be greater than number of args")
+	}
+	keys, argv := args[2:2+numKeys], args[2+numKeys:]
+	return f(func(cmd string, args ...interface{}) (interface{}, error) {
+		return s.exec(cmd, args)
+	}, keys, argv)
+}
+
+// scanMatch returns the MATCH pattern of the SCAN options, nil for any
+func scanMatch(opts []string) (*regexp.Regexp, error) {
+	var match *regexp.Regexp
+	for i := 0; i < len(opts); i += 2 {
+		if i+1 >= len(opts) {
+			return nil, errSyntax
+		}
+		switch strings.ToUpper(opts[i]) {
+		case "MATCH":
+			var err error
+			if match, err = globRegexp(opts[i+1]); err != nil {
+				return nil, err
+			}
+		case "COUNT":
+		default:
+			return nil, errSyntax
+		}
+	}
+	return match, nil
+}
+
+// globRegexp turns a redis glob pattern into a regexp
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString("(?s:.*)")
+		case '?':
+			b.WriteString("(?s:.)")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") {
+				class = "^" + regexp.QuoteMeta(class[1:])
+			} else {
+				class = regexp.QuoteMeta(class)
+			}
+			b.WriteString("[" + strings.Replace(class, `\-`, "-", -1) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, redis.Error("ERR invalid pattern " + pattern)
+	}
+	return re, nil
+}
+
+func flatHash(h map[string]string, match *regexp.Regexp) []interface{} {
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		if match == nil || match.MatchString(field) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	reply := make([]interface{}, 0, 2*len(fields))
+	for _, field := range fields {
+		reply = append(reply, []byte(field), []byte(h[field]))
+	}
+	return reply
+}
+
+func bulks(values []string) []interface{} {
+	reply := make([]interface{}, len(values))
+	for i, v := range values {
+		reply[i] = []byte(v)
+	}
+	return reply
+}
+
+// argString formats an argument as redigo writes it to redis
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	case redis.Argument:
+		return argString(v.RedisArg())
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// memConn is a connection of a pool to the memory store. The commands sent
+// run at once, their replies wait for Receive or the next Do.
+type memConn struct {
+	store   *memStore
+	pending []memReply
+}
+
+type memReply struct {
+	reply interface{}
+	err   error
+}
+
+func (c *memConn) Close() error {
+	c.pending = nil
+	return nil
+}
+
+func (c *memConn) Err() error {
+	return nil
+}
+
+func (c *memConn) Send(cmd string, args ...interface{}) error {
+	reply, err := c.store.do(cmd, args)
+	c.pending = append(c.pending, memReply{reply, err})
+	return nil
+}
+
+func (c *memConn) Flush() error {
+	return nil
+}
+
+func (c *memConn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, redis.Error("ERR no pending reply")
+	}
+	r := c.pending[0]
+	c.pending = c.pending[1:]
+	return r.reply, r.err
+}
+
+// Do returns the reply of cmd, and the first error of the commands sent
+// before it, as redigo does
+func (c *memConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	pending := c.pending
+	c.pending = nil
+	if cmd == "" {
+		replies := make([]interface{}, len(pending))
+		for i, r := range pending {
+			if r.err != nil {
+				replies[i] = r.err
+			} else {
+				replies[i] = r.reply
+			}
+		}
+		return replies, nil
+	}
+	reply, err := c.store.do(cmd, args)
+	for _, r := range pending {
+		if r.err != nil {
+			return reply, r.err
+		}
+	}
+	return reply, err
+}
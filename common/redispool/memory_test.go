@@ -0,0 +1,143 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package redispool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/gomodule/redigo/redis"
+)
+
+func newMemoryConn() redis.Conn {
+	return &memConn{store: &memStore{data: make(map[string]*memEntry)}}
+}
+
+func TestMemoryStrings(t *testing.T) {
+	c := newMemoryConn()
+	if v, err := c.Do("GET", "a"); v != nil || err != nil {
+		t.Fatalf("GET missing key: %v %v", v, err)
+	}
+	if _, err := c.Do("SET", "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := redis.Int(c.Do("INCR", "a")); v != 2 {
+		t.Fatalf("INCR: %d", v)
+	}
+	if v, _ := c.Do("SET", "a", "x", "NX"); v != nil {
+		t.Fatalf("SET NX of an existing key: %v", v)
+	}
+	if v, _ := redis.String(c.Do("GETSET", "a", "b")); v != "2" {
+		t.Fatalf("GETSET: %s", v)
+	}
+	if _, err := c.Do("HGET", "a", "f"); err != errWrongType {
+		t.Fatalf("HGET of a string: %v", err)
+	}
+	if n, _ := redis.Int(c.Do("DEL", "a", "b")); n != 1 {
+		t.Fatalf("DEL: %d", n)
+	}
+}
+
+func TestMemoryExpire(t *testing.T) {
+	c := newMemoryConn()
+	c.Do("SET", "lock", "token", "PX", 20, "NX")
+	if ttl, _ := redis.Int(c.Do("TTL", "lock")); ttl != 1 {
+		t.Fatalf("TTL: %d", ttl)
+	}
+	c.Do("HMSET", "h", "a", 1)
+	c.Do("EXPIRE", "h", 100)
+	time.Sleep(30 * time.Millisecond)
+	if n, _ := redis.Int(c.Do("EXISTS", "lock", "h")); n != 1 {
+		t.Fatalf("EXISTS after the expiry of one key: %d", n)
+	}
+	if ttl, _ := redis.Int(c.Do("TTL", "missing")); ttl != -2 {
+		t.Fatalf("TTL of a missing key: %d", ttl)
+	}
+}
+
+func TestMemoryHashesAndSets(t *testing.T) {
+	c := newMemoryConn()
+	c.Send("HMSET", redis.Args{}.Add("dev").AddFlat(map[string]string{"user_id": "@a:b", "did": "D"})...)
+	c.Send("HINCRBY", "dev", "n", 3)
+	c.Send("SADD", "s", "x", "y")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.Receive(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields, err := redis.StringMap(c.Do("HGETALL", "dev"))
+	if err != nil || fields["user_id"] != "@a:b" || fields["n"] != "3" {
+		t.Fatalf("HGETALL: %v %v", fields, err)
+	}
+	values, _ := redis.Strings(c.Do("HMGET", "dev", "did", "none"))
+	if values[0] != "D" || values[1] != "" {
+		t.Fatalf("HMGET: %v", values)
+	}
+	c.Do("HDEL", "dev", "user_id", "did", "n")
+	if n, _ := redis.Int(c.Do("EXISTS", "dev")); n != 0 {
+		t.Fatalf("empty hash kept")
+	}
+	members, _ := redis.Strings(c.Do("SMEMBERS", "s"))
+	if len(members) != 2 {
+		t.Fatalf("SMEMBERS: %v", members)
+	}
+
+	c.Do("SET", "fedsend:1", "a")
+	c.Do("SET", "fedsend:2", "a")
+	c.Do("SET", "other", "a")
+	reply, err := redis.Values(c.Do("SCAN", 0, "MATCH", "fedsend:*", "COUNT", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursor uint64
+	var keys []string
+	if _, err = redis.Scan(reply, &cursor, &keys); err != nil || cursor != 0 || len(keys) != 2 {
+		t.Fatalf("SCAN: %d %v %v", cursor, keys, err)
+	}
+}
+
+func TestMemoryScript(t *testing.T) {
+	const src = `return redis.call('INCRBY', KEYS[1], ARGV[1])`
+	RegisterScript(src, func(call func(string, ...interface{}) (interface{}, error), keys, args []string) (interface{}, error) {
+		return call("INCRBY", keys[0], args[0])
+	})
+	c := newMemoryConn()
+	script := redis.NewScript(1, src)
+	if n, err := redis.Int(script.Do(c, "n", 5)); n != 5 || err != nil {
+		t.Fatalf("script: %d %v", n, err)
+	}
+	if _, err := redis.NewScript(0, "return 1").Do(c); err == nil {
+		t.Fatalf("unregistered script ran")
+	}
+}
+
+func TestMemoryPoolShared(t *testing.T) {
+	a, err := NewPool(config.RedisConf{Mode: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewPool(config.RedisConf{Mode: "memory"})
+	ca, cb := a.Get(), b.Get()
+	defer ca.Close()
+	defer cb.Close()
+	ca.Do("SET", "shared", "v")
+	if v, _ := redis.String(cb.Do("GET", "shared")); v != "v" {
+		t.Fatalf("pools do not share the store")
+	}
+}
@@ -0,0 +1,577 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package redispool builds the redis pools of the servers. Apart from the
+// replica mode, a connection of the pool sends every command to the node
+// serving its key, so the callers keep using one redis.Conn whatever the
+// deployment. SCAN and KEYS walk every master, DEL, UNLINK, EXISTS, TOUCH,
+// MGET and MSET are split by node. The other commands without a key, SCRIPT
+// LOAD for instance, go to a single node and EVAL goes to the node of its
+// first key.
+package redispool
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/gomodule/redigo/redis"
+)
+
+const maxRedirects = 5
+
+// a SCAN cursor of several masters holds the index of the master scanned in
+// its high bits and the cursor of that master in the others
+const (
+	scanNodeShift = 48
+	scanNodeMask  = 1<<scanNodeShift - 1
+)
+
+// router tells which node serves a key
+type router interface {
+	// addr returns the node that serves key, key is empty for the commands
+	// without one
+	addr(key string) (string, error)
+	dial(addr string) (redis.Conn, error)
+	// moved records that the node at addr serves slot now
+	moved(slot int, addr string)
+	// failed tells that the connection to addr broke or reached a replica
+	failed(addr string)
+	// masters returns every node serving keys, always in the same order
+	masters() []string
+	// crossSlot tells if a multi-key command may hold keys of different
+	// slots served by the same node, a redis cluster refuses them
+	crossSlot() bool
+}
+
+// NewPool returns the pool of the redis deployment described by conf
+func NewPool(conf config.RedisConf) (*redis.Pool, error) {
+	var r router
+	var err error
+	switch conf.Mode {
+	case "", "replica":
+		return newPool(func() (redis.Conn, error) {
+			if len(conf.Uris) == 0 {
+				return nil, errors.New("redispool: no redis uris")
+			}
+			return redis.DialURL(conf.Uris[rand.Intn(len(conf.Uris))])
+		}), nil
+	case "shard":
+		if len(conf.Uris) == 0 {
+			return nil, errors.New("redispool: no redis uris")
+		}
+		r = &shardRouter{uris: conf.Uris}
+	case "sentinel":
+		r, err = newSentinelRouter(conf)
+	case "cluster":
+		r, err = newClusterRouter(conf)
+	case "memory":
+		log.Infof("redispool memory mode, the keys are kept in process")
+		store := getMemoryStore()
+		return newPool(func() (redis.Conn, error) {
+			return &memConn{store: store}, nil
+		}), nil
+	default:
+		err = fmt.Errorf("redispool: unknown mode %s", conf.Mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("redispool %s mode with %v", conf.Mode, conf.Uris)
+	return newPool(func() (redis.Conn, error) {
+		return &routedConn{r: r, conns: make(map[string]redis.Conn)}, nil
+	}), nil
+}
+
+func newPool(dial func() (redis.Conn, error)) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     200,
+		MaxActive:   200,
+		Wait:        true,
+		IdleTimeout: 240 * time.Second,
+		Dial:        dial,
+	}
+}
+
+var errClosed = errors.New("redispool: connection closed")
+
+// cmdPart is the share of a command sent to one node, keys are the indexes
+// of the keys of the command it holds
+type cmdPart struct {
+	addr string
+	conn redis.Conn
+	args []interface{}
+	keys []int
+}
+
+// mergeFunc builds the reply of a command sent in several parts, or to
+// several nodes, from the replies of the parts
+type mergeFunc func(replies []interface{}) (interface{}, error)
+
+type pendingCmd struct {
+	cmd   string
+	parts []cmdPart
+	merge mergeFunc
+}
+
+// routedConn holds a connection per node it sent commands to
+type routedConn struct {
+	r       router
+	conns   map[string]redis.Conn
+	pending []pendingCmd
+	closed  bool
+}
+
+func (c *routedConn) Close() error {
+	var err error
+	for addr, conn := range c.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(c.conns, addr)
+	}
+	c.pending = nil
+	c.closed = true
+	return err
+}
+
+// Err tells the pool to drop the connection rather than reuse it, once it is
+// closed or one of its node connections broke
+func (c *routedConn) Err() error {
+	if c.closed {
+		return errClosed
+	}
+	for _, conn := range c.conns {
+		if err := conn.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *routedConn) conn(addr string) (redis.Conn, error) {
+	if c.closed {
+		return nil, errClosed
+	}
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := c.r.dial(addr)
+	if err != nil {
+		c.r.failed(addr)
+		return nil, err
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+// fail drops the connection to addr if it is unusable
+func (c *routedConn) fail(addr string, conn redis.Conn, err error) error {
+	if conn.Err() != nil || isReadOnly(err) {
+		conn.Close()
+		if c.conns[addr] == conn {
+			delete(c.conns, addr)
+		}
+		c.r.failed(addr)
+	}
+	return err
+}
+
+func (c *routedConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	var pendingErr error
+	if len(c.pending) > 0 {
+		if err := c.Flush(); err != nil {
+			return nil, err
+		}
+		for len(c.pending) > 0 {
+			if _, err := c.Receive(); err != nil && pendingErr == nil {
+				pendingErr = err
+			}
+		}
+	}
+	if cmd == "" {
+		return nil, pendingErr
+	}
+
+	parts, merge, err := c.route(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(parts))
+	for i, part := range parts {
+		reply, e := c.run(part.addr, false, cmd, part.args)
+		if e != nil && err == nil {
+			err = e
+		}
+		replies[i] = reply
+	}
+	reply, err := c.reply(replies, merge, err)
+	if err == nil {
+		err = pendingErr
+	}
+	return reply, err
+}
+
+// reply merges the replies of the parts of a command, err is the first error
+// of the parts
+func (c *routedConn) reply(replies []interface{}, merge mergeFunc, err error) (interface{}, error) {
+	if merge == nil {
+		return replies[0], err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return merge(replies)
+}
+
+// run executes the command on addr and follows the redirections
+func (c *routedConn) run(addr string, asking bool, cmd string, args []interface{}) (interface{}, error) {
+	for i := 0; ; i++ {
+		conn, err := c.conn(addr)
+		if err != nil {
+			return nil, err
+		}
+		if asking {
+			if _, err := conn.Do("ASKING"); err != nil {
+				return nil, c.fail(addr, conn, err)
+			}
+		}
+		reply, err := conn.Do(cmd, args...)
+		if err == nil {
+			return reply, nil
+		}
+		next, ok := c.redirect(err)
+		if !ok || i >= maxRedirects {
+			return reply, c.fail(addr, conn, err)
+		}
+		addr, asking = next.addr, next.ask
+	}
+}
+
+func (c *routedConn) Send(cmd string, args ...interface{}) error {
+	parts, merge, err := c.route(cmd, args)
+	if err != nil {
+		return err
+	}
+	for i := range parts {
+		part := &parts[i]
+		if part.conn, err = c.conn(part.addr); err == nil {
+			if err = part.conn.Send(cmd, part.args...); err != nil {
+				err = c.fail(part.addr, part.conn, err)
+			}
+		}
+		if err != nil {
+			if i > 0 {
+				// the parts already sent still have replies, they are read
+				// with the error as the reply of the command
+				sendErr := err
+				c.pending = append(c.pending, pendingCmd{cmd: cmd, parts: parts[:i], merge: func([]interface{}) (interface{}, error) {
+					return nil, sendErr
+				}})
+			}
+			return err
+		}
+	}
+	c.pending = append(c.pending, pendingCmd{cmd: cmd, parts: parts, merge: merge})
+	return nil
+}
+
+func (c *routedConn) Flush() error {
+	flushed := make(map[redis.Conn]bool)
+	for _, p := range c.pending {
+		for _, part := range p.parts {
+			if flushed[part.conn] {
+				continue
+			}
+			flushed[part.conn] = true
+			if err := part.conn.Flush(); err != nil {
+				return c.fail(part.addr, part.conn, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Receive returns the reply of the oldest command sent
+func (c *routedConn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("redispool: no pending reply")
+	}
+	p := c.pending[0]
+	c.pending = c.pending[1:]
+	var err error
+	replies := make([]interface{}, len(p.parts))
+	for i, part := range p.parts {
+		reply, e := part.conn.Receive()
+		if e != nil {
+			if next, ok := c.redirect(e); ok {
+				reply, e = c.run(next.addr, next.ask, p.cmd, part.args)
+			} else {
+				e = c.fail(part.addr, part.conn, e)
+			}
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+		replies[i] = reply
+	}
+	return c.reply(replies, p.merge, err)
+}
+
+type redirection struct {
+	slot int
+	addr string
+	ask  bool
+}
+
+// redirect parses a MOVED or ASK error, MOVED ones update the router
+func (c *routedConn) redirect(err error) (redirection, bool) {
+	e, ok := err.(redis.Error)
+	if !ok {
+		return redirection{}, false
+	}
+	// MOVED 3999 127.0.0.1:6381
+	fields := strings.Fields(string(e))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return redirection{}, false
+	}
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return redirection{}, false
+	}
+	next := redirection{slot: slot, addr: fields[2], ask: fields[0] == "ASK"}
+	if !next.ask {
+		c.r.moved(slot, next.addr)
+	}
+	return next, true
+}
+
+func isReadOnly(err error) bool {
+	e, ok := err.(redis.Error)
+	return ok && strings.HasPrefix(string(e), "READONLY")
+}
+
+// route splits the command into the parts to send, merge is nil when there is
+// a single part whose reply is the one of the command
+func (c *routedConn) route(cmd string, args []interface{}) ([]cmdPart, mergeFunc, error) {
+	switch strings.ToUpper(cmd) {
+	case "SCAN":
+		return c.routeScan(args)
+	case "KEYS":
+		return c.routeKeys(args)
+	case "DEL", "UNLINK", "EXISTS", "TOUCH":
+		return c.routeMulti(cmd, args, 1, sumReplies)
+	case "MGET":
+		return c.routeMulti(cmd, args, 1, nil)
+	case "MSET":
+		return c.routeMulti(cmd, args, 2, func(parts []cmdPart, replies []interface{}) (interface{}, error) {
+			return "OK", nil
+		})
+	}
+	addr, err := c.r.addr(commandKey(cmd, args))
+	if err != nil {
+		return nil, nil, err
+	}
+	return []cmdPart{{addr: addr, args: args}}, nil, nil
+}
+
+func (c *routedConn) mastersOf() ([]string, error) {
+	masters := c.r.masters()
+	if len(masters) == 0 {
+		return nil, errors.New("redispool: no master")
+	}
+	return masters, nil
+}
+
+// routeScan sends the SCAN to the master its cursor points to, the cursor
+// returned moves to the next master once one is done
+func (c *routedConn) routeScan(args []interface{}) ([]cmdPart, mergeFunc, error) {
+	masters, err := c.mastersOf()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(masters) == 1 || len(args) == 0 {
+		return []cmdPart{{addr: masters[0], args: args}}, nil, nil
+	}
+	cursor, err := strconv.ParseUint(keyString(args[0]), 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("redispool: invalid scan cursor %v", args[0])
+	}
+	node := int(cursor >> scanNodeShift)
+	if node >= len(masters) {
+		return nil, nil, fmt.Errorf("redispool: invalid scan cursor %d", cursor)
+	}
+	nodeArgs := append([]interface{}{cursor & scanNodeMask}, args[1:]...)
+	merge := func(replies []interface{}) (interface{}, error) {
+		values, err := redis.Values(replies[0], nil)
+		if err != nil || len(values) != 2 {
+			return nil, fmt.Errorf("redispool: unexpected scan reply %v", replies[0])
+		}
+		next, err := redis.Uint64(values[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if next > scanNodeMask {
+			return nil, fmt.Errorf("redispool: scan cursor %d of %s out of range", next, masters[node])
+		}
+		if next == 0 {
+			if node+1 < len(masters) {
+				next = uint64(node+1) << scanNodeShift
+			}
+		} else {
+			next |= uint64(node) << scanNodeShift
+		}
+		return []interface{}{[]byte(strconv.FormatUint(next, 10)), values[1]}, nil
+	}
+	return []cmdPart{{addr: masters[node], args: nodeArgs}}, merge, nil
+}
+
+// routeKeys sends the KEYS to every master
+func (c *routedConn) routeKeys(args []interface{}) ([]cmdPart, mergeFunc, error) {
+	masters, err := c.mastersOf()
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := make([]cmdPart, len(masters))
+	for i, addr := range masters {
+		parts[i] = cmdPart{addr: addr, args: args}
+	}
+	if len(parts) == 1 {
+		return parts, nil, nil
+	}
+	return parts, func(replies []interface{}) (interface{}, error) {
+		var keys []interface{}
+		for _, reply := range replies {
+			values, err := redis.Values(reply, nil)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, values...)
+		}
+		return keys, nil
+	}, nil
+}
+
+// routeMulti groups the keys of a multi-key command by node, or by slot in a
+// redis cluster, step is the number of arguments of a key. merge builds the
+// reply from the ones of the groups, the keys are put back in their order
+// when it is nil
+func (c *routedConn) routeMulti(cmd string, args []interface{}, step int,
+	merge func(parts []cmdPart, replies []interface{}) (interface{}, error)) ([]cmdPart, mergeFunc, error) {
+	if len(args) == 0 || len(args)%step != 0 {
+		addr, err := c.r.addr(commandKey(cmd, args))
+		if err != nil {
+			return nil, nil, err
+		}
+		return []cmdPart{{addr: addr, args: args}}, nil, nil
+	}
+	var parts []cmdPart
+	groups := make(map[string]int)
+	for i := 0; i < len(args); i += step {
+		key := keyString(args[i])
+		addr, err := c.r.addr(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		group := addr
+		if !c.r.crossSlot() {
+			group += "/" + strconv.Itoa(Slot(key))
+		}
+		n, ok := groups[group]
+		if !ok {
+			n = len(parts)
+			groups[group] = n
+			parts = append(parts, cmdPart{addr: addr})
+		}
+		parts[n].args = append(parts[n].args, args[i:i+step]...)
+		parts[n].keys = append(parts[n].keys, i/step)
+	}
+	if len(parts) == 1 {
+		parts[0].args = args
+		return parts, nil, nil
+	}
+	if merge == nil {
+		merge = orderReplies(len(args) / step)
+	}
+	return parts, func(replies []interface{}) (interface{}, error) {
+		return merge(parts, replies)
+	}, nil
+}
+
+func sumReplies(parts []cmdPart, replies []interface{}) (interface{}, error) {
+	var sum int64
+	for _, reply := range replies {
+		n, err := redis.Int64(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		sum += n
+	}
+	return sum, nil
+}
+
+// orderReplies puts the values replied by the parts back in the order of the
+// keys of the command
+func orderReplies(count int) func(parts []cmdPart, replies []interface{}) (interface{}, error) {
+	return func(parts []cmdPart, replies []interface{}) (interface{}, error) {
+		values := make([]interface{}, count)
+		for i, reply := range replies {
+			partValues, err := redis.Values(reply, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(partValues) != len(parts[i].keys) {
+				return nil, fmt.Errorf("redispool: %d values for %d keys", len(partValues), len(parts[i].keys))
+			}
+			for j, key := range parts[i].keys {
+				values[key] = partValues[j]
+			}
+		}
+		return values, nil
+	}
+}
+
+// commandKey returns the key that routes the command
+func commandKey(cmd string, args []interface{}) string {
+	switch strings.ToUpper(cmd) {
+	case "EVAL", "EVALSHA":
+		// EVALSHA sha numkeys key...
+		if len(args) < 3 || keyString(args[1]) == "0" {
+			return ""
+		}
+		return keyString(args[2])
+	case "PING", "INFO", "SCAN", "SCRIPT", "MULTI", "EXEC", "DISCARD", "TIME", "DBSIZE", "RANDOMKEY", "KEYS":
+		return ""
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return keyString(args[0])
+}
+
+func keyString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
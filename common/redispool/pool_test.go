@@ -0,0 +1,385 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package redispool
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// fakeNode is a redis node knowing GET, SET, DEL, MGET, MSET, KEYS and a
+// SCAN returning one key at a time
+type fakeNode struct {
+	data map[string]string
+	// errors answered for keys, MOVED and ASK redirections
+	redirect map[string]string
+	// keys imported from another node, served after ASKING only
+	importing map[string]bool
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		data:      make(map[string]string),
+		redirect:  make(map[string]string),
+		importing: make(map[string]bool),
+	}
+}
+
+func (n *fakeNode) exec(cmd string, args []interface{}, asking bool) (interface{}, error) {
+	key := keyString(args[0])
+	if r, ok := n.redirect[key]; ok {
+		return nil, redis.Error(r)
+	}
+	if n.importing[key] && !asking {
+		return nil, redis.Error("MOVED 0 elsewhere:6379")
+	}
+	switch strings.ToUpper(cmd) {
+	case "GET":
+		if v, ok := n.data[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, nil
+	case "SET":
+		n.data[key] = keyString(args[1])
+		return "OK", nil
+	case "DEL":
+		var count int64
+		for _, arg := range args {
+			if _, ok := n.data[keyString(arg)]; ok {
+				delete(n.data, keyString(arg))
+				count++
+			}
+		}
+		return count, nil
+	case "MGET":
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			if v, ok := n.data[keyString(arg)]; ok {
+				values[i] = []byte(v)
+			}
+		}
+		return values, nil
+	case "MSET":
+		for i := 0; i+1 < len(args); i += 2 {
+			n.data[keyString(args[i])] = keyString(args[i+1])
+		}
+		return "OK", nil
+	case "KEYS":
+		var keys []interface{}
+		for _, k := range n.keys() {
+			keys = append(keys, []byte(k))
+		}
+		return keys, nil
+	case "SCAN":
+		cursor, err := strconv.Atoi(key)
+		keys := n.keys()
+		if err != nil || cursor > len(keys) {
+			return nil, redis.Error("ERR invalid cursor")
+		}
+		if cursor == len(keys) {
+			return []interface{}{[]byte("0"), []interface{}{}}, nil
+		}
+		next := cursor + 1
+		if next == len(keys) {
+			next = 0
+		}
+		return []interface{}{[]byte(strconv.Itoa(next)), []interface{}{[]byte(keys[cursor])}}, nil
+	}
+	return nil, redis.Error("ERR unknown command " + cmd)
+}
+
+func (n *fakeNode) keys() []string {
+	var keys []string
+	for k := range n.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type fakeReply struct {
+	reply interface{}
+	err   error
+}
+
+type fakeConn struct {
+	node   *fakeNode
+	asking bool
+	queue  []fakeReply
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "ASKING" {
+		c.asking = true
+		return "OK", nil
+	}
+	reply, err := c.node.exec(cmd, args, c.asking)
+	c.asking = false
+	return reply, err
+}
+
+func (c *fakeConn) Send(cmd string, args ...interface{}) error {
+	reply, err := c.Do(cmd, args...)
+	c.queue = append(c.queue, fakeReply{reply, err})
+	return nil
+}
+
+func (c *fakeConn) Receive() (interface{}, error) {
+	if len(c.queue) == 0 {
+		return nil, errors.New("no reply")
+	}
+	r := c.queue[0]
+	c.queue = c.queue[1:]
+	return r.reply, r.err
+}
+
+// fakeRouter sends the keys to routes[key], or to node "a"
+type fakeRouter struct {
+	nodes  map[string]*fakeNode
+	routes map[string]string
+	moves  []string
+}
+
+func (r *fakeRouter) addr(key string) (string, error) {
+	if addr, ok := r.routes[key]; ok {
+		return addr, nil
+	}
+	return "a", nil
+}
+
+func (r *fakeRouter) dial(addr string) (redis.Conn, error) {
+	node, ok := r.nodes[addr]
+	if !ok {
+		return nil, errors.New("no node " + addr)
+	}
+	return &fakeConn{node: node}, nil
+}
+
+func (r *fakeRouter) moved(slot int, addr string) {
+	r.moves = append(r.moves, addr)
+}
+
+func (r *fakeRouter) failed(addr string) {}
+
+func (r *fakeRouter) masters() []string {
+	return []string{"a", "b"}
+}
+
+func (r *fakeRouter) crossSlot() bool {
+	return true
+}
+
+func newTestConn() (*routedConn, *fakeRouter) {
+	r := &fakeRouter{
+		nodes:  map[string]*fakeNode{"a": newFakeNode(), "b": newFakeNode()},
+		routes: make(map[string]string),
+	}
+	return &routedConn{r: r, conns: make(map[string]redis.Conn)}, r
+}
+
+func TestSlot(t *testing.T) {
+	if got := Slot("123456789"); got != 0x31C3 {
+		t.Fatalf("Slot(123456789) = %d, want %d", got, 0x31C3)
+	}
+	if Slot("{user1000}.following") != Slot("{user1000}.followers") {
+		t.Fatal("keys with the same hash tag are in different slots")
+	}
+	// an empty tag hashes the whole key
+	if Slot("foo{}{bar}") == Slot("") {
+		t.Fatal("empty hash tag used")
+	}
+	if Slot("foo{{bar}}zap") != Slot("{bar") {
+		t.Fatal("hash tag does not stop at the first }")
+	}
+}
+
+func TestCommandKey(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		args []interface{}
+		want string
+	}{
+		{"GET", []interface{}{"k"}, "k"},
+		{"hmset", []interface{}{[]byte("k"), "f", 1}, "k"},
+		{"EVALSHA", []interface{}{"sha", 1, "k", "arg"}, "k"},
+		{"EVAL", []interface{}{"script", 0, "arg"}, ""},
+		{"SCAN", []interface{}{0, "match", "k*"}, ""},
+		{"PING", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := commandKey(tt.cmd, tt.args); got != tt.want {
+			t.Errorf("commandKey(%s, %v) = %q, want %q", tt.cmd, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRoutedConnMoved(t *testing.T) {
+	c, r := newTestConn()
+	r.nodes["a"].redirect["k"] = "MOVED 7 b"
+	r.nodes["b"].data["k"] = "v"
+
+	v, err := redis.String(c.Do("GET", "k"))
+	if err != nil || v != "v" {
+		t.Fatalf("GET k = %q, %v", v, err)
+	}
+	if len(r.moves) != 1 || r.moves[0] != "b" {
+		t.Fatalf("moves = %v, want [b]", r.moves)
+	}
+}
+
+func TestRoutedConnAsk(t *testing.T) {
+	c, r := newTestConn()
+	r.nodes["a"].redirect["k"] = "ASK 7 b"
+	r.nodes["b"].importing["k"] = true
+	r.nodes["b"].data["k"] = "v"
+
+	v, err := redis.String(c.Do("GET", "k"))
+	if err != nil || v != "v" {
+		t.Fatalf("GET k = %q, %v", v, err)
+	}
+	if len(r.moves) != 0 {
+		t.Fatalf("ASK updated the router: %v", r.moves)
+	}
+}
+
+func TestRoutedConnPipeline(t *testing.T) {
+	c, r := newTestConn()
+	r.routes["k2"] = "b"
+	r.routes["k3"] = "b"
+	// k3 moved back to a
+	r.nodes["b"].redirect["k3"] = "MOVED 7 a"
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		if err := c.Send("SET", key, key+"v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if reply, err := c.Receive(); err != nil || reply != "OK" {
+			t.Fatalf("reply %d = %v, %v", i, reply, err)
+		}
+	}
+	if r.nodes["a"].data["k1"] != "k1v" || r.nodes["b"].data["k2"] != "k2v" || r.nodes["a"].data["k3"] != "k3v" {
+		t.Fatalf("keys on the wrong nodes a:%v b:%v", r.nodes["a"].data, r.nodes["b"].data)
+	}
+
+	// Do drains what was sent before
+	c.Send("SET", "k4", "v")
+	if _, err := c.Do(""); err != nil || len(c.pending) != 0 {
+		t.Fatalf("Do(\"\") left %d pending, %v", len(c.pending), err)
+	}
+}
+
+func TestRoutedConnScan(t *testing.T) {
+	c, r := newTestConn()
+	r.nodes["a"].data["k1"] = "v"
+	r.nodes["a"].data["k2"] = "v"
+	r.nodes["b"].data["k3"] = "v"
+
+	var keys []string
+	var cursor uint64
+	for i := 0; ; i++ {
+		if i > 10 {
+			t.Fatal("SCAN does not end")
+		}
+		values, err := redis.Values(c.Do("SCAN", cursor, "match", "k*", "count", 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page []string
+		if _, err := redis.Scan(values, &cursor, &page); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, page...)
+		if cursor == 0 {
+			break
+		}
+	}
+	if strings.Join(keys, ",") != "k1,k2,k3" {
+		t.Fatalf("SCAN returned %v, want the keys of both nodes", keys)
+	}
+
+	if _, err := c.Do("SCAN", uint64(2)<<scanNodeShift); err == nil {
+		t.Fatal("SCAN accepted a cursor of an unknown node")
+	}
+
+	all, err := redis.Strings(c.Do("KEYS", "k*"))
+	if err != nil || strings.Join(all, ",") != "k1,k2,k3" {
+		t.Fatalf("KEYS = %v, %v", all, err)
+	}
+}
+
+func TestRoutedConnMultiKey(t *testing.T) {
+	c, r := newTestConn()
+	r.routes["k2"] = "b"
+	r.routes["k4"] = "b"
+
+	if reply, err := c.Do("MSET", "k1", "v1", "k2", "v2", "k3", "v3"); err != nil || reply != "OK" {
+		t.Fatalf("MSET = %v, %v", reply, err)
+	}
+	if r.nodes["a"].data["k1"] != "v1" || r.nodes["b"].data["k2"] != "v2" || r.nodes["a"].data["k3"] != "v3" {
+		t.Fatalf("keys on the wrong nodes a:%v b:%v", r.nodes["a"].data, r.nodes["b"].data)
+	}
+
+	values, err := redis.Values(c.Do("MGET", "k1", "k2", "k4", "k3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := redis.Strings(values, nil)
+	if strings.Join(got, ",") != "v1,v2,,v3" {
+		t.Fatalf("MGET = %q, want the values in the order of the keys", got)
+	}
+
+	// a pipelined DEL is merged too
+	if err := c.Send("DEL", "k1", "k2", "k4"); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	if n, err := redis.Int(c.Receive()); err != nil || n != 2 {
+		t.Fatalf("DEL = %d, %v, want 2", n, err)
+	}
+	if len(r.nodes["b"].data) != 0 {
+		t.Fatalf("DEL left %v on b", r.nodes["b"].data)
+	}
+}
+
+func TestRoutedConnErr(t *testing.T) {
+	c, _ := newTestConn()
+	if _, err := c.Do("SET", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("Err() = %v before Close", err)
+	}
+	c.Close()
+	if c.Err() == nil {
+		t.Fatal("Err() = nil after Close")
+	}
+	if _, err := c.Do("GET", "k"); err == nil {
+		t.Fatal("Do succeeded after Close")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package redispool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/gomodule/redigo/redis"
+)
+
+const sentinelTimeout = time.Second
+
+// sentinelRouter sends every command to the master the sentinels elected
+type sentinelRouter struct {
+	sentinels  []string
+	masterName string
+	password   string
+
+	mu        sync.RWMutex
+	master    string
+	resolving int32
+}
+
+func newSentinelRouter(conf config.RedisConf) (*sentinelRouter, error) {
+	if len(conf.Uris) == 0 {
+		return nil, errors.New("redispool: no redis sentinel uris")
+	}
+	r := &sentinelRouter{
+		sentinels:  conf.Uris,
+		masterName: conf.Sentinel.MasterName,
+		password:   conf.Sentinel.Password,
+	}
+	if err := r.resolve(); err != nil {
+		return nil, err
+	}
+	// a failover may also go unnoticed, the old master turning replica
+	// still answers the reads
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for range t.C {
+			r.resolve()
+		}
+	}()
+	return r, nil
+}
+
+// resolve asks the sentinels for the master
+func (r *sentinelRouter) resolve() error {
+	var lastErr error
+	for _, uri := range r.sentinels {
+		master, err := r.askSentinel(uri)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r.mu.Lock()
+		if r.master != master {
+			log.Infof("redispool sentinel master of %s is %s, was %s", r.masterName, master, r.master)
+			r.master = master
+		}
+		r.mu.Unlock()
+		return nil
+	}
+	log.Errorf("redispool sentinel resolve master of %s error %v", r.masterName, lastErr)
+	return lastErr
+}
+
+func (r *sentinelRouter) askSentinel(uri string) (string, error) {
+	conn, err := redis.DialURL(uri,
+		redis.DialConnectTimeout(sentinelTimeout),
+		redis.DialReadTimeout(sentinelTimeout),
+		redis.DialWriteTimeout(sentinelTimeout),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	addr, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", r.masterName))
+	if err != nil {
+		return "", err
+	}
+	if len(addr) != 2 {
+		return "", fmt.Errorf("sentinel %s does not know master %s", uri, r.masterName)
+	}
+	return net.JoinHostPort(addr[0], addr[1]), nil
+}
+
+func (r *sentinelRouter) addr(key string) (string, error) {
+	r.mu.RLock()
+	master := r.master
+	r.mu.RUnlock()
+	if master == "" {
+		return "", fmt.Errorf("redispool: no master for %s", r.masterName)
+	}
+	return master, nil
+}
+
+// dial connects to addr if it still is the master
+func (r *sentinelRouter) dial(addr string) (redis.Conn, error) {
+	var opts []redis.DialOption
+	if r.password != "" {
+		opts = append(opts, redis.DialPassword(r.password))
+	}
+	conn, err := redis.Dial("tcp", addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	role, err := redis.Values(conn.Do("ROLE"))
+	if err == nil && len(role) > 0 {
+		if s, _ := redis.String(role[0], nil); s != "master" {
+			err = fmt.Errorf("redispool: %s is a %s", addr, s)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (r *sentinelRouter) moved(slot int, addr string) {}
+
+func (r *sentinelRouter) failed(addr string) {
+	if !atomic.CompareAndSwapInt32(&r.resolving, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&r.resolving, 0)
+		r.resolve()
+	}()
+}
+
+func (r *sentinelRouter) masters() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.master == "" {
+		return nil
+	}
+	return []string{r.master}
+}
+
+func (r *sentinelRouter) crossSlot() bool {
+	return true
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package redispool
+
+import (
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const slotCount = 16384
+
+// Slot returns the redis cluster hash slot of key. Only the part between
+// the first { and the next } is hashed when it is not empty, so keys sharing
+// a {tag} share a slot.
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % slotCount)
+}
+
+// crc16 is the CRC-16/XMODEM redis cluster uses
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// shardRouter spreads the slots over a static list of nodes
+type shardRouter struct {
+	uris []string
+}
+
+func (r *shardRouter) addr(key string) (string, error) {
+	if key == "" {
+		return r.uris[0], nil
+	}
+	return r.uris[Slot(key)%len(r.uris)], nil
+}
+
+func (r *shardRouter) dial(addr string) (redis.Conn, error) {
+	return redis.DialURL(addr)
+}
+
+func (r *shardRouter) moved(slot int, addr string) {}
+
+func (r *shardRouter) failed(addr string) {}
+
+func (r *shardRouter) masters() []string {
+	return r.uris
+}
+
+func (r *shardRouter) crossSlot() bool {
+	return true
+}
@@ -29,6 +29,8 @@ import (
 
 	bt "bytes"
 
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/health"
 	"github.com/finogeeks/ligase/common/uid"
 	log "github.com/finogeeks/ligase/skunkworks/log"
 	jsoniter "github.com/json-iterator/go"
@@ -37,13 +39,39 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// localRpcBus carries the rpcs of the clients started with the in-process
+// uri
+var localRpcBus = NewLocalBus()
+
 type RpcClient struct {
 	url  string
-	conn *nats.Conn
+	conn rpcConn
 	subs *sync.Map
 	idg  *uid.UidGenerator
 }
 
+// rpcConn is what RpcClient uses of a nats connection, a LocalBus stands in
+// for it in process
+type rpcConn interface {
+	Publish(subject string, data []byte) error
+	Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error)
+	Subscribe(subject string, cb nats.MsgHandler) (Subscription, error)
+	QueueSubscribe(subject, queue string, cb nats.MsgHandler) (Subscription, error)
+	IsConnected() bool
+}
+
+type natsConn struct {
+	*nats.Conn
+}
+
+func (c natsConn) Subscribe(subject string, cb nats.MsgHandler) (Subscription, error) {
+	return c.Conn.Subscribe(subject, cb)
+}
+
+func (c natsConn) QueueSubscribe(subject, queue string, cb nats.MsgHandler) (Subscription, error) {
+	return c.Conn.QueueSubscribe(subject, queue, cb)
+}
+
 type Result struct {
 	Index   int64  `json:"index"`
 	Success bool   `json:"success"`
@@ -59,7 +87,7 @@ type RpcCB interface {
 
 type rpcSubVal struct {
 	cb  RpcCB
-	sub *nats.Subscription
+	sub Subscription
 }
 
 func NewRpcClient(url string, idg *uid.UidGenerator) *RpcClient {
@@ -70,16 +98,24 @@ func NewRpcClient(url string, idg *uid.UidGenerator) *RpcClient {
 	return rpc
 }
 
-func (nc *RpcClient) Start(clean bool) {
-	conn, err := nats.Connect(nc.url)
-	if err != nil {
-		log.Fatalf("RpcClient: start fail %v", err)
-	}
+// InProcess tells if the rpcs are handed to the handlers of this process
+func (nc *RpcClient) InProcess() bool {
+	return nc.url == config.InProcessNatsURI
+}
 
-	nc.conn = conn
+func (nc *RpcClient) Start(clean bool) {
 	nc.subs = new(sync.Map)
-
-	nc.conn.SetReconnectHandler(nc.reconnectCb)
+	if nc.InProcess() {
+		nc.conn = localRpcBus
+	} else {
+		conn, err := nats.Connect(nc.url)
+		if err != nil {
+			log.Fatalf("RpcClient: start fail %v", err)
+		}
+		nc.conn = natsConn{conn}
+		conn.SetReconnectHandler(nc.reconnectCb)
+		health.Register("nats:rpc", nc.ping)
+	}
 
 	if clean {
 		go nc.clean()
@@ -92,7 +128,7 @@ func (nc *RpcClient) wrapGetCB(topic string, cb MsgHandlerWithContext) nats.MsgH
 
 func (nc *RpcClient) reconnectCb(conn *nats.Conn) {
 	log.Warn("RpcClient: reconnectCb triggered")
-	nc.conn = conn
+	nc.conn = natsConn{conn}
 	nc.url = conn.ConnectedUrl()
 
 	//re-sub
@@ -105,6 +141,13 @@ func (nc *RpcClient) reconnectCb(conn *nats.Conn) {
 	})
 }
 
+func (nc *RpcClient) ping(ctx context.Context) error {
+	if !nc.conn.IsConnected() {
+		return fmt.Errorf("nats %s is not connected", nc.url)
+	}
+	return nil
+}
+
 func (nc *RpcClient) clean() {
 	ticker := time.NewTimer(0)
 	for {
@@ -120,7 +163,6 @@ func (nc *RpcClient) clean() {
 	}
 }
 
-//TODO: is it necessary to add context/span/monitor like RequestWithContext for Pub()?
 func (nc *RpcClient) Pub(topic string, bytes []byte) {
 	err := nc.conn.Publish(topic, bytes)
 	if err != nil {
@@ -128,7 +170,6 @@ func (nc *RpcClient) Pub(topic string, bytes []byte) {
 	}
 }
 
-//TODO: is it necessary to add context/span/monitor like RequestWithContext for PubObj()?
 func (nc *RpcClient) PubObj(topic string, obj interface{}) {
 	bytes, _ := json.Marshal(obj)
 	err := nc.conn.Publish(topic, bytes)
@@ -137,6 +178,28 @@ func (nc *RpcClient) PubObj(topic string, obj interface{}) {
 	}
 }
 
+// PubWithContext publishes bytes with the span context of ctx, like
+// RequestWithContext the subscriber must parse it with ParseNatsData
+func (nc *RpcClient) PubWithContext(ctx context.Context, topic string, bytes []byte) {
+	span, _ := StartSpanFromContext(ctx, fmt.Sprintf("PubWithContext[%s]", topic))
+	defer span.Finish()
+	ExportMetricsBeforeSending(span, topic, "nats")
+	err := nc.conn.Publish(topic, WrapNatsData(InjectSpanToHeaderForSending(span), bytes))
+	if err != nil {
+		log.Errorf("rpc pub error %v topic:%s", err, topic)
+	}
+}
+
+// PubObjWithContext is PubWithContext of the json of obj
+func (nc *RpcClient) PubObjWithContext(ctx context.Context, topic string, obj interface{}) {
+	bytes, err := json.Marshal(obj)
+	if err != nil {
+		log.Errorf("rpc pub marshal error %v topic:%s", err, topic)
+		return
+	}
+	nc.PubWithContext(ctx, topic, bytes)
+}
+
 func (nc *RpcClient) SubRaw(cb RpcCB) {
 	topic := cb.GetTopic()
 	_, ok := nc.subs.Load(topic)
@@ -189,19 +252,31 @@ func (nc *RpcClient) RequestWithContext(ctx context.Context,
 	if header == nil {
 		return nc.Request(topic, bytes, timeout)
 	}
-	carrierStr, ok := header[SpanKey]
-	if !ok {
-		return nc.Request(topic, bytes, timeout)
-	}
-	carrier := []byte(carrierStr)
-	if len(carrier) > MaxSpanBytesLength {
-		return nc.Request(topic, bytes, timeout)
-	}
 
 	//log.Info("RequestWithContext, span: ", InjectSpanToHeader(span))
 	ExportMetricsBeforeSending(span, topic, "nats")
 
-	magicNum := Uint32ToBytes(0xF0F0F0F0)
+	msg, err := nc.conn.Request(topic, WrapNatsData(header, bytes), time.Duration(timeout)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.Data, nil
+}
+
+// WrapNatsData puts the span context headers before bytes, as nats has no
+// message headers. The data is left as is without headers, or when they are
+// longer than MaxSpanBytesLength.
+func WrapNatsData(header map[string]string, bytes []byte) []byte {
+	if len(header) == 0 {
+		return bytes
+	}
+	carrier, err := json.Marshal(CarrierFromHeader(header))
+	if err != nil || len(carrier) > MaxSpanBytesLength {
+		return bytes
+	}
+
+	magicNum := Uint32ToBytes(MagicNum)
 	headerLen := Uint32ToBytes(uint32(len(carrier)))
 
 	var buffer bt.Buffer
@@ -209,12 +284,7 @@ func (nc *RpcClient) RequestWithContext(ctx context.Context,
 	buffer.Write(headerLen)
 	buffer.Write(carrier)
 	buffer.Write(bytes)
-	msg, err := nc.conn.Request(topic, buffer.Bytes(), time.Duration(timeout)*time.Millisecond)
-	if err != nil {
-		return nil, err
-	}
-
-	return msg.Data, nil
+	return buffer.Bytes()
 }
 
 const MagicNum = 0xF0F0F0F0
@@ -276,7 +346,7 @@ func NatsWrapHandlerWithContext(metricName string, handler MsgHandlerWithContext
 			if err != nil {
 				span = opentracing.StartSpan(metricName)
 			} else {
-				span = opentracing.StartSpan(metricName, opentracing.FollowsFrom(clientContext))
+				span = opentracing.StartSpan(metricName, opentracing.ChildOf(clientContext))
 			}
 		}
 		defer span.Finish()
@@ -27,6 +27,10 @@ import (
 	"github.com/lib/pq"
 )
 
+// SQLiteDriver is the driver of the databases kept in a sqlite file, it is
+// registered by storage/sqlite
+const SQLiteDriver = "sqlite"
+
 // A Transaction is something that can be committed or rolledback.
 type Transaction interface {
 	// Commit the transaction
@@ -106,6 +110,10 @@ func (h *Hooks) After(ctx context.Context, query string, args ...interface{}) (c
 }
 
 func CreateDatabase(driver, addr, name string) error {
+	if driver == SQLiteDriver {
+		// the file is created when it is opened
+		return nil
+	}
 	db, err := sql.Open(driver, addr)
 	if err != nil {
 		return err
@@ -0,0 +1,204 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syncshard
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/model/types"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/nats-io/go-nats"
+)
+
+const handoffTimeout = 5000 // ms
+
+// Preloader is the room cache of a syncserver
+type Preloader interface {
+	// LoadedRooms returns the rooms held in memory
+	LoadedRooms() []string
+	// Preload loads the rooms before the syncserver serves them
+	Preload(ctx context.Context, roomIDs []string)
+	// Release drops the rooms another syncserver serves now
+	Release(roomIDs []string)
+}
+
+type handoffRequest struct {
+	Instance uint32 `json:"instance"`
+}
+
+type handoffResponse struct {
+	Rooms []string `json:"rooms"`
+}
+
+// Member announces a syncserver in the ring. It starts joining: it asks the
+// current owners for the loaded rooms that move to it and preloads them,
+// the owners keep serving them meanwhile. Then it becomes ready and the
+// rooms are routed to it.
+type Member struct {
+	ring      *Ring
+	rpcClient *common.RpcClient
+	preloader Preloader
+
+	mu           sync.Mutex
+	state        string
+	load         int64
+	releaseTimer *time.Timer
+}
+
+func NewMember(ring *Ring, rpcClient *common.RpcClient, preloader Preloader) *Member {
+	return &Member{
+		ring:      ring,
+		rpcClient: rpcClient,
+		preloader: preloader,
+		state:     StateJoining,
+	}
+}
+
+func handoffTopic(instance uint32) string {
+	return fmt.Sprintf("%s.%d", types.SyncServerHandoffTopicDef, instance)
+}
+
+func (m *Member) heartbeat() time.Duration {
+	return time.Duration(m.ring.cfg.MultiInstance.SyncServerSharding.Heartbeat) * time.Millisecond
+}
+
+func (m *Member) Start() {
+	if !m.ring.Enabled() {
+		return
+	}
+	m.rpcClient.Reply(handoffTopic(m.ring.instance), m.onHandoff)
+	m.ring.OnChange(m.scheduleRelease)
+	m.announce()
+	go func() {
+		t := time.NewTicker(m.heartbeat())
+		defer t.Stop()
+		for range t.C {
+			m.announce()
+		}
+	}()
+	go m.join()
+}
+
+// State returns StateJoining or StateReady
+func (m *Member) State() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+func (m *Member) announce() {
+	m.mu.Lock()
+	ann := Announcement{Instance: m.ring.instance, State: m.state, Load: m.load}
+	m.mu.Unlock()
+	m.rpcClient.PubObj(types.SyncServerMembershipTopicDef, ann)
+}
+
+func (m *Member) join() {
+	// hear from the other members before asking them for rooms
+	time.Sleep(2 * m.heartbeat())
+
+	start := time.Now()
+	var rooms []string
+	for _, peer := range m.ring.ReadyMembers() {
+		if peer == m.ring.instance {
+			continue
+		}
+		peerRooms, err := m.requestHandoff(peer)
+		if err != nil {
+			// the rooms of the peer are loaded on their first sync instead
+			log.Errorf("syncshard handoff from syncserver %d error %v", peer, err)
+			continue
+		}
+		for _, roomID := range peerRooms {
+			if owner, ok := m.ring.NextOwner(roomID); ok && owner == m.ring.instance {
+				rooms = append(rooms, roomID)
+			}
+		}
+	}
+
+	timeout := time.Duration(m.ring.cfg.MultiInstance.SyncServerSharding.PreloadTimeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	m.preloader.Preload(ctx, rooms)
+	cancel()
+
+	m.mu.Lock()
+	m.state = StateReady
+	m.load = int64(len(m.preloader.LoadedRooms()))
+	m.mu.Unlock()
+	m.announce()
+	log.Infof("syncshard syncserver %d ready, preloaded %d rooms spend:%v", m.ring.instance, len(rooms), time.Since(start))
+}
+
+func (m *Member) requestHandoff(peer uint32) ([]string, error) {
+	bytes, err := json.Marshal(handoffRequest{Instance: m.ring.instance})
+	if err != nil {
+		return nil, err
+	}
+	data, err := m.rpcClient.Request(handoffTopic(peer), bytes, handoffTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var resp handoffResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Rooms, nil
+}
+
+// onHandoff answers a joining member with the loaded rooms that move to it
+func (m *Member) onHandoff(msg *nats.Msg) {
+	var req handoffRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		log.Errorf("syncshard handoff request unmarshal error %v", err)
+		return
+	}
+	resp := handoffResponse{Rooms: []string{}}
+	for _, roomID := range m.preloader.LoadedRooms() {
+		if owner, ok := m.ring.NextOwner(roomID); ok && owner == req.Instance {
+			resp.Rooms = append(resp.Rooms, roomID)
+		}
+	}
+	log.Infof("syncshard syncserver %d hands %d rooms off to %d", m.ring.instance, len(resp.Rooms), req.Instance)
+	m.rpcClient.PubObj(msg.Reply, resp)
+}
+
+// scheduleRelease drops the rooms handed off once the grace period of the
+// last ring change is over
+func (m *Member) scheduleRelease() {
+	grace := time.Duration(m.ring.cfg.MultiInstance.SyncServerSharding.HandoffGrace)*time.Millisecond + m.heartbeat()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.releaseTimer != nil {
+		m.releaseTimer.Stop()
+	}
+	m.releaseTimer = time.AfterFunc(grace, m.release)
+}
+
+func (m *Member) release() {
+	var rooms []string
+	for _, roomID := range m.preloader.LoadedRooms() {
+		if !m.ring.IsRelated(roomID) {
+			rooms = append(rooms, roomID)
+		}
+	}
+	if len(rooms) > 0 {
+		m.preloader.Release(rooms)
+		log.Infof("syncshard syncserver %d released %d rooms", m.ring.instance, len(rooms))
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package syncshard assigns rooms to syncserver instances. Without sharding
+// a room belongs to hash(room) % sync_server_total, with it the rooms are
+// spread with consistent hashing over the syncservers that announce
+// themselves, so instances can come and go without a restart.
+package syncshard
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/model/types"
+	_ "github.com/finogeeks/ligase/plugins/selector"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nats-io/go-nats"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// Member states, a joining member preloads its rooms and does not serve
+// them yet
+const (
+	StateJoining = "joining"
+	StateReady   = "ready"
+)
+
+// Announcement is the heartbeat every syncserver publishes
+type Announcement struct {
+	Instance uint32 `json:"instance"`
+	State    string `json:"state"`
+	// Rooms loaded when the member became ready, the bounded load selector
+	// weighs the members with it
+	Load int64 `json:"load"`
+}
+
+type member struct {
+	state    string
+	load     int64
+	lastSeen time.Time
+}
+
+// Ring tells which syncserver owns a room
+type Ring struct {
+	cfg      *config.Dendrite
+	instance uint32
+	enabled  bool
+
+	mu      sync.RWMutex
+	members map[uint32]*member
+	// rings of the ready members, and of the ready and joining ones
+	serving core.ISelector
+	next    core.ISelector
+	// the serving ring before the last change, old owners keep their rooms
+	// up to date until previousUntil
+	previous      core.ISelector
+	previousUntil time.Time
+	signature     string
+	onChange      []func()
+}
+
+// NewRing returns the ring of the process, instance is the syncserver
+// instance of the process
+func NewRing(cfg *config.Dendrite, instance uint32) *Ring {
+	return &Ring{
+		cfg:      cfg,
+		instance: instance,
+		enabled:  cfg.MultiInstance.SyncServerSharding.Enable,
+		members:  make(map[uint32]*member),
+	}
+}
+
+// Enabled reports whether rooms are assigned by consistent hashing
+func (r *Ring) Enabled() bool {
+	return r.enabled
+}
+
+// Watch follows the announcements of the syncservers
+func (r *Ring) Watch(rpcClient *common.RpcClient) {
+	if !r.enabled {
+		return
+	}
+	rpcClient.Reply(types.SyncServerMembershipTopicDef, func(msg *nats.Msg) {
+		var ann Announcement
+		if err := json.Unmarshal(msg.Data, &ann); err != nil {
+			log.Errorf("syncshard announcement unmarshal error %v", err)
+			return
+		}
+		r.Observe(&ann, time.Now())
+	})
+	go func() {
+		t := time.NewTicker(time.Duration(r.cfg.MultiInstance.SyncServerSharding.Heartbeat) * time.Millisecond)
+		defer t.Stop()
+		for now := range t.C {
+			r.Expire(now)
+		}
+	}()
+}
+
+// OnChange registers f to be called after the members change
+func (r *Ring) OnChange(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onChange = append(r.onChange, f)
+}
+
+// Observe records an announcement received at now
+func (r *Ring) Observe(ann *Announcement, now time.Time) {
+	r.mu.Lock()
+	m, ok := r.members[ann.Instance]
+	if !ok {
+		m = &member{}
+		r.members[ann.Instance] = m
+	}
+	m.state = ann.State
+	m.load = ann.Load
+	m.lastSeen = now
+	changed := r.rebuild(now)
+	r.mu.Unlock()
+	if changed {
+		r.notify()
+	}
+}
+
+// Expire removes the members not heard of within the ttl
+func (r *Ring) Expire(now time.Time) {
+	ttl := time.Duration(r.cfg.MultiInstance.SyncServerSharding.MemberTTL) * time.Millisecond
+	r.mu.Lock()
+	for instance, m := range r.members {
+		if now.Sub(m.lastSeen) > ttl {
+			log.Warnf("syncshard syncserver %d expired, last seen %v", instance, m.lastSeen)
+			delete(r.members, instance)
+		}
+	}
+	changed := r.rebuild(now)
+	r.mu.Unlock()
+	if changed {
+		r.notify()
+	}
+}
+
+func (r *Ring) notify() {
+	r.mu.RLock()
+	fs := r.onChange
+	r.mu.RUnlock()
+	for _, f := range fs {
+		f()
+	}
+}
+
+// rebuild makes new rings if the members or their states changed
+func (r *Ring) rebuild(now time.Time) bool {
+	var ready, all []uint32
+	for instance, m := range r.members {
+		all = append(all, instance)
+		if m.state == StateReady {
+			ready = append(ready, instance)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i] < ready[j] })
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	signature := joinInstances(ready) + "/" + joinInstances(all)
+	if signature == r.signature {
+		return false
+	}
+	r.signature = signature
+
+	if r.serving != nil {
+		r.previous = r.serving
+		r.previousUntil = now.Add(time.Duration(r.cfg.MultiInstance.SyncServerSharding.HandoffGrace) * time.Millisecond)
+	}
+	r.serving = r.newSelector(ready)
+	r.next = r.newSelector(all)
+	log.Infof("syncshard ring changed, ready:%v members:%v", ready, all)
+	return true
+}
+
+func (r *Ring) newSelector(instances []uint32) core.ISelector {
+	if len(instances) == 0 {
+		return nil
+	}
+	sel, err := core.NewSelector(r.cfg.MultiInstance.SyncServerSharding.Selector, nil)
+	if err != nil {
+		log.Errorf("syncshard new selector error %v", err)
+		return nil
+	}
+	for _, instance := range instances {
+		sel.AddNode(strconv.FormatUint(uint64(instance), 10))
+	}
+	// the loads are the ones announced when the members became ready, so
+	// every process builds the same ring
+	if bounded, ok := sel.(interface{ UpdateLoad(string, int64) }); ok {
+		for _, instance := range instances {
+			bounded.UpdateLoad(strconv.FormatUint(uint64(instance), 10), r.members[instance].load)
+		}
+	}
+	return sel
+}
+
+func joinInstances(instances []uint32) string {
+	s := make([]string, len(instances))
+	for i, instance := range instances {
+		s[i] = strconv.FormatUint(uint64(instance), 10)
+	}
+	return strings.Join(s, ",")
+}
+
+func lookup(sel core.ISelector, roomID string) (uint32, bool) {
+	if sel == nil {
+		return 0, false
+	}
+	node, err := sel.GetNode(roomID)
+	if err != nil {
+		return 0, false
+	}
+	instance, err := strconv.ParseUint(node, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(instance), true
+}
+
+// Owner returns the syncserver instance that serves the room
+func (r *Ring) Owner(roomID string) uint32 {
+	if r.enabled {
+		r.mu.RLock()
+		instance, ok := lookup(r.serving, roomID)
+		r.mu.RUnlock()
+		if ok {
+			return instance
+		}
+	}
+	// no syncserver is ready yet
+	return common.GetSyncInstance(roomID, r.cfg.MultiInstance.SyncServerTotal)
+}
+
+// NextOwner returns the instance that serves the room once the joining
+// members are ready
+func (r *Ring) NextOwner(roomID string) (uint32, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return lookup(r.next, roomID)
+}
+
+// Serves reports whether this syncserver answers the requests about the room
+func (r *Ring) Serves(roomID string) bool {
+	if !r.enabled {
+		mi := r.cfg.MultiInstance
+		return common.IsRelatedRequest(roomID, mi.Instance, mi.Total, mi.MultiWrite)
+	}
+	return r.Owner(roomID) == r.instance
+}
+
+// IsRelated reports whether this syncserver keeps the room up to date: it
+// serves the room, it preloads the room to serve it next, or it handed the
+// room off recently and may still get requests routed with the old ring.
+func (r *Ring) IsRelated(roomID string) bool {
+	if !r.enabled {
+		mi := r.cfg.MultiInstance
+		return common.IsRelatedRequest(roomID, mi.Instance, mi.Total, mi.MultiWrite)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.serving == nil && r.next == nil {
+		return common.GetSyncInstance(roomID, r.cfg.MultiInstance.SyncServerTotal) == r.instance
+	}
+	if instance, ok := lookup(r.serving, roomID); ok && instance == r.instance {
+		return true
+	}
+	if instance, ok := lookup(r.next, roomID); ok && instance == r.instance {
+		return true
+	}
+	if time.Now().Before(r.previousUntil) {
+		if instance, ok := lookup(r.previous, roomID); ok && instance == r.instance {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRelatedSyncRequest reports whether a sync request sent to reqInstance
+// is for this syncserver
+func (r *Ring) IsRelatedSyncRequest(reqInstance uint32) bool {
+	if !r.enabled {
+		mi := r.cfg.MultiInstance
+		return common.IsRelatedSyncRequest(reqInstance, mi.Instance, mi.Total, mi.MultiWrite)
+	}
+	return reqInstance == r.instance
+}
+
+// ReadyMembers returns the instances serving rooms
+func (r *Ring) ReadyMembers() []uint32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ready []uint32
+	for instance, m := range r.members {
+		if m.state == StateReady {
+			ready = append(ready, instance)
+		}
+	}
+	return ready
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syncshard
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+)
+
+func testConfig(enable bool) *config.Dendrite {
+	cfg := new(config.Dendrite)
+	cfg.MultiInstance.Instance = 0
+	cfg.MultiInstance.Total = 2
+	cfg.MultiInstance.SyncServerTotal = 2
+	sharding := &cfg.MultiInstance.SyncServerSharding
+	sharding.Enable = enable
+	sharding.Selector = "consistent"
+	sharding.Heartbeat = 1000
+	sharding.MemberTTL = 5000
+	sharding.HandoffGrace = 10000
+	return cfg
+}
+
+func testRooms(n int) []string {
+	rooms := make([]string, n)
+	for i := range rooms {
+		rooms[i] = fmt.Sprintf("!room%d:test", i)
+	}
+	return rooms
+}
+
+func TestRingDisabled(t *testing.T) {
+	cfg := testConfig(false)
+	ring := NewRing(cfg, 0)
+	for _, roomID := range testRooms(50) {
+		if got, want := ring.Owner(roomID), common.GetSyncInstance(roomID, 2); got != want {
+			t.Fatalf("Owner(%s) = %d, want %d", roomID, got, want)
+		}
+		if got, want := ring.IsRelated(roomID), common.IsRelatedRequest(roomID, 0, 2, false); got != want {
+			t.Fatalf("IsRelated(%s) = %v, want %v", roomID, got, want)
+		}
+	}
+	if !ring.IsRelatedSyncRequest(0) || ring.IsRelatedSyncRequest(1) {
+		t.Fatal("IsRelatedSyncRequest does not follow the instance")
+	}
+}
+
+func TestRingHandoff(t *testing.T) {
+	cfg := testConfig(true)
+	now := time.Now()
+	ring := NewRing(cfg, 1)
+	changes := 0
+	ring.OnChange(func() { changes++ })
+
+	ring.Observe(&Announcement{Instance: 0, State: StateReady}, now)
+	ring.Observe(&Announcement{Instance: 1, State: StateJoining}, now)
+	if changes != 2 {
+		t.Fatalf("changes = %d, want 2", changes)
+	}
+
+	rooms := testRooms(200)
+	moving := 0
+	for _, roomID := range rooms {
+		if ring.Owner(roomID) != 0 || ring.Serves(roomID) {
+			t.Fatalf("joining member serves %s", roomID)
+		}
+		if next, _ := ring.NextOwner(roomID); next == 1 {
+			moving++
+			if !ring.IsRelated(roomID) {
+				t.Fatalf("joining member does not follow %s it preloads", roomID)
+			}
+		}
+	}
+	if moving == 0 || moving == len(rooms) {
+		t.Fatalf("%d of %d rooms move to the joining member", moving, len(rooms))
+	}
+
+	// the old owner keeps following the rooms it hands off for the grace
+	old := NewRing(cfg, 0)
+	old.Observe(&Announcement{Instance: 0, State: StateReady}, now)
+	old.Observe(&Announcement{Instance: 1, State: StateJoining}, now)
+	old.Observe(&Announcement{Instance: 1, State: StateReady}, now)
+	ring.Observe(&Announcement{Instance: 1, State: StateReady}, now)
+	for _, roomID := range rooms {
+		owner := ring.Owner(roomID)
+		if owner != old.Owner(roomID) {
+			t.Fatalf("members disagree on the owner of %s", roomID)
+		}
+		if owner == 1 && !old.IsRelated(roomID) {
+			t.Fatalf("old owner dropped %s within the grace", roomID)
+		}
+	}
+	old.previousUntil = now
+	for _, roomID := range rooms {
+		if ring.Owner(roomID) == 1 && old.IsRelated(roomID) {
+			t.Fatalf("old owner follows %s after the grace", roomID)
+		}
+	}
+}
+
+func TestRingExpire(t *testing.T) {
+	cfg := testConfig(true)
+	now := time.Now()
+	ring := NewRing(cfg, 0)
+	ring.Observe(&Announcement{Instance: 0, State: StateReady}, now.Add(4*time.Second))
+	ring.Observe(&Announcement{Instance: 1, State: StateReady}, now)
+
+	ring.Expire(now.Add(6 * time.Second))
+	if ready := ring.ReadyMembers(); len(ready) != 1 || ready[0] != 0 {
+		t.Fatalf("ReadyMembers() = %v, want [0]", ready)
+	}
+	for _, roomID := range testRooms(50) {
+		if !ring.Serves(roomID) {
+			t.Fatalf("remaining member does not serve %s", roomID)
+		}
+	}
+}
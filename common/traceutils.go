@@ -18,7 +18,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	mon "github.com/finogeeks/ligase/skunkworks/monitor/go-client/monitor"
@@ -59,21 +61,58 @@ func removeBaggageItemDeleted(carrier *opentracing.HTTPHeadersCarrier) {
 			delete(*carrier, k)
 		}
 	}
+	// w3c baggage has all the items in one header, key=value[;props],...
+	if v := http.Header(*carrier).Get("baggage"); v != "" {
+		items := []string{}
+		for _, item := range strings.Split(v, ",") {
+			kv := strings.SplitN(strings.SplitN(item, ";", 2)[0], "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[1]) == DeleteMark {
+				continue
+			}
+			items = append(items, item)
+		}
+		if len(items) == 0 {
+			http.Header(*carrier).Del("baggage")
+		} else {
+			http.Header(*carrier).Set("baggage", strings.Join(items, ","))
+		}
+	}
 }
 
+// SpanKey is the header the span context was json encoded under, before it
+// was sent as its own headers. Still read from the messages of the older
+// servers.
 const SpanKey = "span"
 
+// headerFromCarrier flattens an injected span context to message headers,
+// the keys in lower case as w3c trace context asks for
+func headerFromCarrier(carrier opentracing.HTTPHeadersCarrier) map[string]string {
+	header := make(map[string]string, len(carrier))
+	for k, v := range carrier {
+		header[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	return header
+}
+
+// CarrierFromHeader returns the span context carried by message headers
+func CarrierFromHeader(header map[string]string) opentracing.HTTPHeadersCarrier {
+	carrier := opentracing.HTTPHeadersCarrier(make(map[string][]string, len(header)))
+	for k, v := range header {
+		http.Header(carrier).Set(k, v)
+	}
+	return carrier
+}
+
+// InjectSpanToHeader returns the headers carrying the context of span, the
+// traceparent, tracestate and baggage of w3c trace context with the
+// opentelemetry tracer
 func InjectSpanToHeader(span opentracing.Span) map[string]string {
 	carrier := opentracing.HTTPHeadersCarrier(make(map[string][]string))
 	tracer := opentracing.GlobalTracer()
 	if err := tracer.Inject(span.Context(), opentracing.HTTPHeaders, carrier); err != nil {
 		return nil
 	}
-	carrierStr, err := json.Marshal(carrier)
-	if err != nil {
-		return nil
-	}
-	return map[string]string{SpanKey: string(carrierStr)}
+	return headerFromCarrier(carrier)
 }
 
 func InjectSpanToHeaderForSending(span opentracing.Span) map[string]string {
@@ -89,11 +128,7 @@ func InjectSpanToHeaderForSending(span opentracing.Span) map[string]string {
 		return nil
 	}
 	removeBaggageItemDeleted(&carrier)
-	carrierStr, err := json.Marshal(carrier)
-	if err != nil {
-		return nil
-	}
-	return map[string]string{SpanKey: string(carrierStr)}
+	return headerFromCarrier(carrier)
 }
 
 // export metric sob, som before sending, argument protocal can choose from: kafka|nats|http
@@ -114,27 +149,31 @@ func ExportMetricsBeforeSending(span opentracing.Span, metricName string, protoc
 }
 
 func extractSpanFromMsg(msg interface{}) (opentracing.SpanContext, error) {
+	var carrier opentracing.HTTPHeadersCarrier
 	switch e := msg.(type) {
 	case *kafka.Message:
-		for _, header := range e.Headers {
-			if header.Key == SpanKey {
-				var carrier opentracing.HTTPHeadersCarrier
-				err := json.Unmarshal(header.Value, &carrier)
-				if err != nil {
+		header := make(map[string]string, len(e.Headers))
+		for _, h := range e.Headers {
+			if h.Key == SpanKey {
+				if err := json.Unmarshal(h.Value, &carrier); err != nil {
 					return nil, err
 				}
-				tracer := opentracing.GlobalTracer()
-				// extract span from header
-				clientContext, err := tracer.Extract(opentracing.HTTPHeaders, carrier)
-				if err != nil {
-					return nil, err
-				} else {
-					return clientContext, nil
-				}
+				break
 			}
+			header[h.Key] = string(h.Value)
+		}
+		if carrier == nil {
+			carrier = CarrierFromHeader(header)
 		}
+	case opentracing.HTTPHeadersCarrier:
+		// parsed out of the nats data
+		carrier = e
 	}
-	return nil, errors.New("no span")
+	if len(carrier) == 0 {
+		return nil, errors.New("no span")
+	}
+	// extract span from header
+	return opentracing.GlobalTracer().Extract(opentracing.HTTPHeaders, carrier)
 }
 
 func StartSpanFromMsgAfterReceived(metricName string, msg interface{}) opentracing.Span {
@@ -145,17 +184,21 @@ func StartSpanFromMsgAfterReceived(metricName string, msg interface{}) opentraci
 	if err != nil {
 		span = opentracing.StartSpan(metricName)
 	} else {
-		span = opentracing.StartSpan(metricName, opentracing.FollowsFrom(clientContext))
+		span = opentracing.StartSpan(metricName, opentracing.ChildOf(clientContext))
 	}
 	if len(span.BaggageItem("sob")) == 0 {
 		span.SetBaggageItem("sob", nowStr)
 	}
 	span.SetBaggageItem("som", nowStr)
 
+	protocol := "kafka"
+	if _, ok := msg.(opentracing.HTTPHeadersCarrier); ok {
+		protocol = "nats"
+	}
 	if csStr := span.BaggageItem("cs"); len(csStr) != 0 {
 		cs, err := strconv.Atoi(csStr)
 		if err == nil {
-			cs2sr.WithLabelValues("kafka", metricName, "cs2sr").Observe(float64(now) - float64(cs))
+			cs2sr.WithLabelValues(protocol, metricName, "cs2sr").Observe(float64(now) - float64(cs))
 		}
 	}
 	return span
@@ -171,7 +214,7 @@ func SpanFromContext(ctx context.Context) opentracing.Span {
 	return opentracing.SpanFromContext(ctx)
 }
 
-// create a follow span from the span stored in context.Context
+// create a child span of the span stored in context.Context
 func StartSobSomSpan(ctx context.Context, operationName string) (opentracing.Span, context.Context) {
 	nowStr := fmt.Sprintf("%d", time.Now().UnixNano()/1e6)
 	span, ctx := StartSpanFromContext(ctx, operationName)
@@ -184,7 +227,7 @@ func StartSobSomSpan(ctx context.Context, operationName string) (opentracing.Spa
 	return span, ContextWithSpan(ctx, span)
 }
 
-// create a follow span from the span stored in context.Context
+// create a child span of the span stored in context.Context
 func StartSomSpan(ctx context.Context, operationName string) (opentracing.Span, context.Context) {
 	nowStr := fmt.Sprintf("%d", time.Now().UnixNano()/1e6)
 	span, ctx := StartSpanFromContext(ctx, operationName)
@@ -194,12 +237,13 @@ func StartSomSpan(ctx context.Context, operationName string) (opentracing.Span,
 	return span, ContextWithSpan(ctx, span)
 }
 
-// create a follow span from the span stored in context.Context
+// create a child span of the span stored in context.Context, so the spans of
+// all the servers a request goes through are in the same trace
 func StartSpanFromContext(ctx context.Context, operationName string,
 	opts ...opentracing.StartSpanOption) (opentracing.Span, context.Context) {
 	var span opentracing.Span
 	if parentSpan := SpanFromContext(ctx); parentSpan != nil {
-		opts = append(opts, opentracing.FollowsFrom(parentSpan.Context()))
+		opts = append(opts, opentracing.ChildOf(parentSpan.Context()))
 		span = opentracing.StartSpan(operationName, opts...)
 	} else {
 		span = opentracing.StartSpan(operationName, opts...)
@@ -0,0 +1,146 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/nats-io/go-nats"
+	"github.com/opentracing/opentracing-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func kafkaMsg(header map[string]string) *kafka.Message {
+	msg := &kafka.Message{Headers: []kafka.Header{{Key: "retries", Value: []byte("0")}}}
+	for k, v := range header {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return msg
+}
+
+// TestTraceAcrossHops follows a /send through the hops it takes, nats from
+// the proxy to the api server and the roomserver, kafka to the syncwriter
+// and the syncserver, nats again to the pushsender, all spans must be in
+// one trace
+func TestTraceAcrossHops(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	closer := config.SetupOTelTracer("test", sdktrace.WithSyncer(exporter))
+	defer func() {
+		closer.Close()
+		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	}()
+
+	// proxy, the http span then the request to the api server
+	httpSpan, ctx := StartSobSomSpan(context.Background(), "send")
+	reqSpan, _ := StartSpanFromContext(ctx, "RequestWithContext[clientapi]")
+	header := InjectSpanToHeaderForSending(reqSpan)
+	if header["traceparent"] == "" {
+		t.Fatalf("no w3c trace context in %v", header)
+	}
+	if header[SpanKey] != "" {
+		t.Fatalf("span context still json encoded in %v", header)
+	}
+	reqSpan.Finish()
+
+	// api server, through the nats framing
+	data, carrier := ParseNatsData(WrapNatsData(header, []byte("{}")))
+	if string(data) != "{}" || carrier == nil {
+		t.Fatalf("nats data %q carrier %v", data, carrier)
+	}
+	apiSpan := StartSpanFromMsgAfterReceived("clientapi", carrier)
+	if apiSpan.BaggageItem("sob") == "" || apiSpan.BaggageItem("cs") == "" {
+		t.Fatalf("baggage lost on nats")
+	}
+
+	// roomserver, sent on kafka
+	rsHeader := InjectSpanToHeaderForSending(apiSpan)
+	apiSpan.Finish()
+	rsSpan := StartSpanFromMsgAfterReceived("roomserver", kafkaMsg(rsHeader))
+	ctx = ContextWithSpan(context.Background(), rsSpan)
+	outSpan, _ := StartSpanFromContext(ctx, "output_room_event")
+	outHeader := InjectSpanToHeaderForSending(outSpan)
+	outSpan.Finish()
+	rsSpan.Finish()
+
+	// syncwriter and syncserver both read the output events
+	writerSpan := StartSpanFromMsgAfterReceived("syncwriter", kafkaMsg(outHeader))
+	writerSpan.Finish()
+	syncSpan := StartSpanFromMsgAfterReceived("syncserver", kafkaMsg(outHeader))
+	if syncSpan.BaggageItem("som") == DeleteMark {
+		t.Fatalf("deleted baggage item propagated")
+	}
+	ctx = ContextWithSpan(context.Background(), syncSpan)
+
+	// pushsender, published with the context
+	pubSpan, _ := StartSpanFromContext(ctx, "PubWithContext[pushdata-topic]")
+	msg := &nats.Msg{Data: WrapNatsData(InjectSpanToHeaderForSending(pubSpan), []byte("{}"))}
+	pubSpan.Finish()
+	syncSpan.Finish()
+	NatsWrapHandlerWithContext("pushsender", func(ctx context.Context, msg *nats.Msg) {
+		if string(msg.Data) != "{}" {
+			t.Fatalf("nats data %q", msg.Data)
+		}
+		pushSpan, _ := StartSomSpan(ctx, "push")
+		pushSpan.Finish()
+	})(msg)
+	httpSpan.Finish()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 10 {
+		t.Fatalf("exported %d spans", len(spans))
+	}
+	traceID := spans[0].SpanContext.TraceID()
+	ids := map[string]bool{}
+	for _, span := range spans {
+		ids[span.SpanContext.SpanID().String()] = true
+	}
+	for _, span := range spans {
+		if span.SpanContext.TraceID() != traceID {
+			t.Fatalf("span %s in trace %s, not %s", span.Name, span.SpanContext.TraceID(), traceID)
+		}
+		if span.Name == "send" {
+			continue
+		}
+		if !span.Parent.IsValid() || !ids[span.Parent.SpanID().String()] {
+			t.Fatalf("span %s has no parent in the trace", span.Name)
+		}
+	}
+}
+
+func TestExtractSpanFromOldHeader(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	closer := config.SetupOTelTracer("test", sdktrace.WithSyncer(exporter))
+	defer func() {
+		closer.Close()
+		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	}()
+
+	span := opentracing.StartSpan("old")
+	carrier := CarrierFromHeader(InjectSpanToHeader(span))
+	value, _ := json.Marshal(carrier)
+	span.Finish()
+
+	child := StartSpanFromMsgAfterReceived("new", kafkaMsg(map[string]string{SpanKey: string(value)}))
+	child.Finish()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[1].Parent.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Fatalf("exported %+v", spans)
+	}
+}
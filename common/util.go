@@ -28,6 +28,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/domain"
 	"github.com/finogeeks/ligase/common/jsonerror"
 	"github.com/finogeeks/ligase/common/uid"
@@ -57,6 +58,15 @@ func CalcStringHashCode64(str string) uint64 {
 func BuildToken(key, id, loc, userId, deviceIdentifier string,
 	guest bool, deviceID, deviceType string,
 	human bool,
+) (string, error) {
+	return BuildExpiringToken(key, id, loc, userId, deviceIdentifier, guest, deviceID, deviceType, human, 0)
+}
+
+// BuildExpiringToken builds an access token which VerifyToken rejects once
+// expireTs (unix milliseconds) has passed. An expireTs of 0 never expires.
+func BuildExpiringToken(key, id, loc, userId, deviceIdentifier string,
+	guest bool, deviceID, deviceType string,
+	human bool, expireTs int64,
 ) (string, error) {
 	mac, err := macaroon.New([]byte(key), []byte(id), loc, macaroon.V1)
 	if err != nil {
@@ -85,6 +95,9 @@ func BuildToken(key, id, loc, userId, deviceIdentifier string,
 	if guest == true {
 		mac.AddFirstPartyCaveat([]byte("guest = true"))
 	}
+	if expireTs > 0 {
+		mac.AddFirstPartyCaveat([]byte("expire = " + strconv.FormatInt(expireTs, 10)))
+	}
 	bytes, err := mac.MarshalBinary()
 	res := base64.RawURLEncoding.EncodeToString(bytes)
 	// log.Infof("BuildToken token:%s sig:%s\n", res, base64.RawURLEncoding.EncodeToString(mac.Signature()))
@@ -131,25 +144,33 @@ func BuildSuperAdminToken(key, id, loc, userId, deviceIdentifier string,
 }
 
 func ExtractToken(key, id, loc, token string) (*authtypes.Device, bool, error) {
+	dev, guest, _, err := ExtractExpiringToken(key, id, loc, token)
+	return dev, guest, err
+}
+
+// ExtractExpiringToken is ExtractToken that also returns the expiry of the
+// token in unix milliseconds, 0 if the token never expires.
+func ExtractExpiringToken(key, id, loc, token string) (*authtypes.Device, bool, int64, error) {
 	bytes, err := base64.RawURLEncoding.DecodeString(token)
 	guest := false
+	var expireTs int64
 	if err != nil {
-		return nil, guest, err
+		return nil, guest, 0, err
 	}
 
 	mac, err := macaroon.New([]byte(key), []byte(id), loc, macaroon.V1)
 	if err != nil {
-		return nil, guest, err
+		return nil, guest, 0, err
 	}
 
 	err = mac.UnmarshalBinary(bytes)
 	if err != nil {
-		return nil, guest, err
+		return nil, guest, 0, err
 	}
 
 	caveats, err := mac.VerifySignature([]byte(key), nil)
 	if err != nil {
-		return nil, guest, err
+		return nil, guest, 0, err
 	}
 
 	var dev authtypes.Device
@@ -170,9 +191,11 @@ func ExtractToken(key, id, loc, token string) (*authtypes.Device, bool, error) {
 		} else if res[0] == "guest" {
 			guest = true
 			dev.IsHuman = true
+		} else if res[0] == "expire" {
+			expireTs, _ = strconv.ParseInt(res[2], 10, 64)
 		}
 	}
-	return &dev, guest, nil
+	return &dev, guest, expireTs, nil
 }
 
 func BuildDevice(idg *uid.UidGenerator, did *string, isHuman, genNewDevice bool) (string, string, error) {
@@ -226,6 +249,12 @@ func CheckValidDomain(id string, domains []string) bool {
 	return domain.CheckValidDomain(id, domains)
 }
 
+// IsLocalDomain tells if id is one of the domains of the server, including
+// the ones of a reloaded matrix.server_name
+func IsLocalDomain(id string) bool {
+	return domain.CheckValidDomain(id, config.GetReloadable().ServerName)
+}
+
 func GetRemoteIP(r *http.Request) string {
 	xRealIP := r.Header.Get("X-Real-Ip")
 	xForwardedFor := r.Header.Get("X-Forwarded-For")
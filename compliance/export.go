@@ -0,0 +1,314 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package compliance exports the history of a room, with the originals of
+// the events under legal hold which were redacted or edited since.
+package compliance
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	"github.com/finogeeks/ligase/storage/model"
+	jsoniter "github.com/json-iterator/go"
+	"golang.org/x/crypto/ed25519"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatEML   = "eml"
+)
+
+const exportBatchSize = 500
+
+// MinStreamPos is before every event, backfilled events have negative
+// stream positions
+const MinStreamPos int64 = -1 << 62
+
+// Record is one event of an export. Original is the event as it was before a
+// redaction or an edit replaced its content. Originals are saved when the
+// redaction or the edit is processed and only if the room or the sender is
+// under legal hold at that time: an event changed before its hold was placed
+// is exported as it is now, without an original.
+type Record struct {
+	StreamID int64                          `json:"stream_id"`
+	Event    gomatrixserverlib.ClientEvent  `json:"event"`
+	Original *gomatrixserverlib.ClientEvent `json:"original,omitempty"`
+}
+
+// Manifest describes an export, it is signed by the server key. SHA256 is the
+// digest of everything written before the manifest for the jsonl and eml
+// formats, and of the events array as written for the json format.
+type Manifest struct {
+	RoomID     string `json:"room_id"`
+	FromTs     int64  `json:"from_ts"`
+	ToTs       int64  `json:"to_ts"`
+	ExportedTs int64  `json:"exported_ts"`
+	Count      int    `json:"count"`
+	SHA256     string `json:"sha256,omitempty"`
+}
+
+type Exporter struct {
+	syncDB     model.SyncAPIDatabase
+	serverName string
+	keyID      gomatrixserverlib.KeyID
+	privateKey ed25519.PrivateKey
+}
+
+func NewExporter(cfg *config.Dendrite, syncDB model.SyncAPIDatabase) *Exporter {
+	return &Exporter{
+		syncDB:     syncDB,
+		serverName: cfg.Matrix.ServerName[0],
+		keyID:      cfg.Matrix.KeyID,
+		privateKey: cfg.Matrix.PrivateKey,
+	}
+}
+
+// Sign adds the signature of the server to a json object
+func (e *Exporter) Sign(message []byte) ([]byte, error) {
+	return gomatrixserverlib.SignJSON(e.serverName, e.keyID, e.privateKey, message)
+}
+
+// Records returns up to limit events of the room sent in [fromTs, toTs) after
+// the stream position fromPos, in stream order
+func (e *Exporter) Records(
+	ctx context.Context, roomID string, fromTs, toTs, fromPos int64, limit int,
+) ([]Record, error) {
+	events, err := e.syncDB.SelectRoomExportEvents(ctx, roomID, fromTs, toTs, fromPos, limit)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(events))
+	changed := []string{}
+	for _, ev := range events {
+		records = append(records, Record{StreamID: ev.Offset, Event: ev.Event})
+		if len(ev.Event.Unsigned) > 0 {
+			changed = append(changed, ev.Event.EventID)
+		}
+	}
+	if len(changed) == 0 {
+		return records, nil
+	}
+	originals, err := e.syncDB.GetLegalHoldEvents(ctx, changed)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if original, ok := originals[records[i].Event.EventID]; ok {
+			records[i].Original = &original
+		}
+	}
+	return records, nil
+}
+
+// Export writes the history of a room sent in [fromTs, toTs) to w
+func (e *Exporter) Export(
+	ctx context.Context, w io.Writer, roomID string, fromTs, toTs int64, format string,
+) (int, error) {
+	manifest := Manifest{
+		RoomID:     roomID,
+		FromTs:     fromTs,
+		ToTs:       toTs,
+		ExportedTs: time.Now().UnixNano() / 1000000,
+	}
+	switch format {
+	case FormatJSON:
+		return e.exportJSON(ctx, w, &manifest)
+	case FormatJSONL, FormatEML:
+		return e.exportStream(ctx, w, &manifest, format)
+	default:
+		return 0, fmt.Errorf("unknown export format %s", format)
+	}
+}
+
+func (e *Exporter) forEach(ctx context.Context, m *Manifest, f func(*Record) error) error {
+	fromPos := MinStreamPos
+	for {
+		records, err := e.Records(ctx, m.RoomID, m.FromTs, m.ToTs, fromPos, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		for i := range records {
+			if err := f(&records[i]); err != nil {
+				return err
+			}
+			m.Count++
+		}
+		if len(records) < exportBatchSize {
+			return nil
+		}
+		fromPos = records[len(records)-1].StreamID
+	}
+}
+
+// exportJSON writes one json object, {"events":[...],"manifest":{...}}. The
+// events are written as they are read, the signed manifest carries the digest
+// of the events array.
+func (e *Exporter) exportJSON(ctx context.Context, w io.Writer, m *Manifest) (int, error) {
+	buf := bufio.NewWriter(w)
+	digest := sha256.New()
+	events := io.MultiWriter(buf, digest)
+	if _, err := buf.WriteString(`{"events":`); err != nil {
+		return 0, err
+	}
+	if _, err := events.Write([]byte{'['}); err != nil {
+		return 0, err
+	}
+	err := e.forEach(ctx, m, func(r *Record) error {
+		bytes, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if m.Count > 0 {
+			bytes = append([]byte{','}, bytes...)
+		}
+		_, err = events.Write(bytes)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := events.Write([]byte{']'}); err != nil {
+		return 0, err
+	}
+
+	m.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return 0, err
+	}
+	if bytes, err = e.Sign(bytes); err != nil {
+		return 0, err
+	}
+	if _, err := buf.WriteString(`,"manifest":`); err != nil {
+		return 0, err
+	}
+	if _, err := buf.Write(bytes); err != nil {
+		return 0, err
+	}
+	if _, err := buf.WriteString("}\n"); err != nil {
+		return 0, err
+	}
+	return m.Count, buf.Flush()
+}
+
+// exportStream writes the events one by one then the signed manifest, as the
+// last line of a jsonl export or the last message of an eml archive
+func (e *Exporter) exportStream(ctx context.Context, w io.Writer, m *Manifest, format string) (int, error) {
+	buf := bufio.NewWriter(w)
+	digest := sha256.New()
+	out := io.MultiWriter(buf, digest)
+	err := e.forEach(ctx, m, func(r *Record) error {
+		if format == FormatEML {
+			return writeEML(out, r)
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(append(line, '\n'))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	m.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return 0, err
+	}
+	if bytes, err = e.Sign(bytes); err != nil {
+		return 0, err
+	}
+	if format == FormatEML {
+		err = writeEMLMessage(buf, e.serverName, m.RoomID, "export manifest", time.Unix(0, m.ExportedTs*1000000), nil, string(bytes))
+	} else {
+		_, err = buf.Write(append(bytes, '\n'))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return m.Count, buf.Flush()
+}
+
+// writeEML writes the record as a message of an mbox archive
+func writeEML(w io.Writer, r *Record) error {
+	ev := &r.Event
+	headers := []string{
+		"Message-ID: <" + ev.EventID + ">",
+		"X-Matrix-Event-Type: " + ev.Type,
+		fmt.Sprintf("X-Matrix-Stream-ID: %d", r.StreamID),
+	}
+	if ev.StateKey != nil {
+		headers = append(headers, "X-Matrix-State-Key: "+*ev.StateKey)
+	}
+	if ev.Redacts != "" {
+		headers = append(headers, "In-Reply-To: <"+ev.Redacts+">")
+	}
+	body := emlBody(ev)
+	if r.Original != nil {
+		body += "\n\n--- original before redaction or edit ---\n" + emlBody(r.Original)
+	}
+	return writeEMLMessage(w, ev.Sender, ev.RoomID, ev.Type, time.Unix(0, int64(ev.OriginServerTS)*1000000), headers, body)
+}
+
+func emlBody(ev *gomatrixserverlib.ClientEvent) string {
+	var content struct {
+		Body string `json:"body"`
+	}
+	if ev.Type == "m.room.message" && json.Unmarshal(ev.Content, &content) == nil && content.Body != "" {
+		return content.Body
+	}
+	return string(ev.Content)
+}
+
+// event types and state keys are chosen by clients, they must not break out
+// of their header
+var headerEscaper = strings.NewReplacer("\r", " ", "\n", " ")
+
+func writeEMLMessage(w io.Writer, from, to, subject string, date time.Time, headers []string, body string) error {
+	from, to, subject = headerEscaper.Replace(from), headerEscaper.Replace(to), headerEscaper.Replace(subject)
+	var sb strings.Builder
+	sb.WriteString("From " + from + " " + date.UTC().Format(time.ANSIC) + "\n")
+	sb.WriteString("From: " + from + "\n")
+	sb.WriteString("To: " + to + "\n")
+	sb.WriteString("Subject: " + subject + "\n")
+	sb.WriteString("Date: " + date.UTC().Format(time.RFC1123Z) + "\n")
+	for _, h := range headers {
+		sb.WriteString(headerEscaper.Replace(h) + "\n")
+	}
+	sb.WriteString("Content-Type: text/plain; charset=utf-8\n\n")
+	for _, line := range strings.Split(body, "\n") {
+		// mboxrd quoting
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+		sb.WriteString(line + "\n")
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,222 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	jsonRaw "encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/syncapitypes"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	"github.com/finogeeks/ligase/storage/model"
+	"golang.org/x/crypto/ed25519"
+)
+
+// fakeSyncDB serves the events of one room and their legal hold originals
+type fakeSyncDB struct {
+	model.SyncAPIDatabase
+	events    []syncapitypes.ExportEvent
+	originals map[string]gomatrixserverlib.ClientEvent
+}
+
+func (f *fakeSyncDB) SelectRoomExportEvents(
+	ctx context.Context, roomID string, fromTs, toTs, fromPos int64, limit int,
+) ([]syncapitypes.ExportEvent, error) {
+	events := []syncapitypes.ExportEvent{}
+	for _, ev := range f.events {
+		ts := int64(ev.Event.OriginServerTS)
+		if ev.Event.RoomID == roomID && ev.Offset > fromPos && ts >= fromTs && ts < toTs && len(events) < limit {
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+func (f *fakeSyncDB) GetLegalHoldEvents(ctx context.Context, eventIDs []string) (map[string]gomatrixserverlib.ClientEvent, error) {
+	originals := map[string]gomatrixserverlib.ClientEvent{}
+	for _, eventID := range eventIDs {
+		if ev, ok := f.originals[eventID]; ok {
+			originals[eventID] = ev
+		}
+	}
+	return originals, nil
+}
+
+func message(offset int64, eventID, body string) syncapitypes.ExportEvent {
+	content, _ := json.Marshal(map[string]string{"msgtype": "m.text", "body": body})
+	return syncapitypes.ExportEvent{
+		Offset: offset,
+		Event: gomatrixserverlib.ClientEvent{
+			EventID:        eventID,
+			RoomID:         "!room:test",
+			Sender:         "@alice:test",
+			Type:           "m.room.message",
+			OriginServerTS: gomatrixserverlib.Timestamp(1000 + offset),
+			Content:        content,
+		},
+	}
+}
+
+func newExportTest(t *testing.T, n int) (*Exporter, *fakeSyncDB, ed25519.PublicKey) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Dendrite{}
+	cfg.Matrix.ServerName = []string{"test"}
+	cfg.Matrix.KeyID = "ed25519:test"
+	cfg.Matrix.PrivateKey = private
+
+	db := &fakeSyncDB{originals: map[string]gomatrixserverlib.ClientEvent{}}
+	for i := 1; i <= n; i++ {
+		db.events = append(db.events, message(int64(i), fmt.Sprintf("$%d:test", i), fmt.Sprintf("message %d", i)))
+	}
+	// the first message was edited while the room was under legal hold
+	original := db.events[0].Event
+	db.events[0].Event.Content = []byte(`{"msgtype":"m.text","body":"edited"}`)
+	db.events[0].Event.Unsigned = []byte(`{"m.relations":{}}`)
+	db.originals[original.EventID] = original
+	return NewExporter(cfg, db), db, public
+}
+
+// verifyManifest checks the signature of the manifest and the digest it
+// carries
+func verifyManifest(t *testing.T, public ed25519.PublicKey, manifest, signed []byte) *Manifest {
+	if err := gomatrixserverlib.VerifyJSON("test", "ed25519:test", public, manifest); err != nil {
+		t.Fatalf("the manifest signature does not verify: %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(signed)
+	if m.SHA256 != hex.EncodeToString(digest[:]) {
+		t.Fatalf("the manifest digest does not match the export")
+	}
+	return &m
+}
+
+func TestExportJSON(t *testing.T) {
+	// more than a batch, the events are written as they are read
+	n := exportBatchSize + 2
+	exporter, _, public := newExportTest(t, n)
+	var out bytes.Buffer
+	count, err := exporter.Export(context.Background(), &out, "!room:test", 0, 1<<40, FormatJSON)
+	if err != nil || count != n {
+		t.Fatalf("got %d %v, want %d events", count, err, n)
+	}
+
+	var export map[string]jsonRaw.RawMessage
+	if err := jsonRaw.Unmarshal(out.Bytes(), &export); err != nil {
+		t.Fatalf("the export is not a json object: %v", err)
+	}
+	m := verifyManifest(t, public, export["manifest"], export["events"])
+	if m.Count != n || m.RoomID != "!room:test" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	var records []Record
+	if err := json.Unmarshal(export["events"], &records); err != nil || len(records) != n {
+		t.Fatalf("got %d records %v", len(records), err)
+	}
+	if records[0].Original == nil || !strings.Contains(string(records[0].Original.Content), "message 1") {
+		t.Fatalf("the original of the edited event is not exported: %+v", records[0])
+	}
+	if records[1].Original != nil || records[n-1].StreamID != int64(n) {
+		t.Fatalf("unexpected records %+v %+v", records[1], records[n-1])
+	}
+
+	// tampering with an event breaks the digest
+	tampered := bytes.Replace(export["events"], []byte("message 2"), []byte("message X"), 1)
+	digest := sha256.Sum256(tampered)
+	if m.SHA256 == hex.EncodeToString(digest[:]) {
+		t.Fatal("the digest does not cover the events")
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	exporter, _, public := newExportTest(t, 3)
+	var out bytes.Buffer
+	count, err := exporter.Export(context.Background(), &out, "!room:test", 1002, 1<<40, FormatJSONL)
+	if err != nil || count != 2 {
+		t.Fatalf("got %d %v, want the 2 events from from_ts", count, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 2 events and the manifest", len(lines))
+	}
+	signed := out.Bytes()[:out.Len()-len(lines[2])-1]
+	m := verifyManifest(t, public, []byte(lines[2]), signed)
+	if m.Count != 2 || m.FromTs != 1002 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	var r Record
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil || r.Event.EventID != "$2:test" {
+		t.Fatalf("unexpected first record %s %v", lines[0], err)
+	}
+}
+
+func TestExportEML(t *testing.T) {
+	exporter, db, public := newExportTest(t, 3)
+	// a client picked the event type, it must not add headers
+	db.events[1].Event.Type = "m.custom\r\nBcc: mallory@test"
+	db.events[2].Event.Content = []byte(`{"msgtype":"m.text","body":"From now on\nbye"}`)
+	var out bytes.Buffer
+	if _, err := exporter.Export(context.Background(), &out, "!room:test", 0, 1<<40, FormatEML); err != nil {
+		t.Fatal(err)
+	}
+	eml := out.String()
+
+	messages := strings.Split(eml, "\nFrom ")
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 3 events and the manifest:\n%s", len(messages), eml)
+	}
+	first := messages[0]
+	for _, want := range []string{
+		"From: @alice:test\n", "To: !room:test\n", "Message-ID: <$1:test>\n", "X-Matrix-Stream-ID: 1\n",
+		"\nedited\n", "--- original before redaction or edit ---\nmessage 1\n",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("the first message misses %q:\n%s", want, first)
+		}
+	}
+	if strings.Contains(eml, "\nBcc:") || !strings.Contains(eml, "X-Matrix-Event-Type: m.custom  Bcc: mallory@test\n") {
+		t.Errorf("the event type broke out of its header:\n%s", eml)
+	}
+	if !strings.Contains(eml, "\n>From now on\nbye\n") {
+		t.Errorf("a body line starting with From is not quoted:\n%s", eml)
+	}
+
+	manifestStart := strings.LastIndex(eml, "From test ")
+	headerEnd := strings.Index(eml[manifestStart:], "\n\n") + manifestStart + 2
+	manifest := strings.TrimSpace(eml[headerEnd:])
+	m := verifyManifest(t, public, []byte(manifest), out.Bytes()[:manifestStart])
+	if m.Count != 3 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	exporter, _, _ := newExportTest(t, 1)
+	if _, err := exporter.Export(context.Background(), &bytes.Buffer{}, "!room:test", 0, 1<<40, "pdf"); err == nil {
+		t.Fatal("an unknown format must fail")
+	}
+}
@@ -122,7 +122,7 @@ func (p *DownloadConsumer) Start() error {
 		}
 
 		domain, url, thumbnailUrl := p.parseEv(&ev)
-		if common.CheckValidDomain(domain, config.GetConfig().Matrix.ServerName) {
+		if common.IsLocalDomain(domain) {
 			continue
 		}
 
@@ -291,7 +291,7 @@ func (p *DownloadConsumer) OnMessage(ctx context.Context, topic string, partitio
 
 	domain, url, thumbnailUrl := p.parseEv(&ev)
 	log.Infof("DownloadConsumer recvive %s %s %s", domain, url, thumbnailUrl)
-	if common.CheckValidDomain(domain, config.GetConfig().Matrix.ServerName) {
+	if common.IsLocalDomain(domain) {
 		return
 	}
 
@@ -30,6 +30,7 @@ import (
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/basecomponent"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/health"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/content/download"
 	"github.com/finogeeks/ligase/content/repos"
@@ -167,6 +168,10 @@ func handleSignal() {
 			case syscall.SIGINT:
 				log.Warnf("quit", s)
 				os.Exit(0)
+			case syscall.SIGHUP:
+				if _, _, err := config.Reload(); err != nil {
+					log.Errorf("reload config err:%v", err)
+				}
 			default:
 				log.Warnf("other", s)
 			}
@@ -202,6 +207,8 @@ func Entry() {
 		*cmdLine.httpBindAddr = defaultListenAddr
 	}
 
+	health.Handle(http.DefaultServeMux)
+	health.Begin("startup")
 	setUpTransport(base, cmdLine)
 
 	startContentService(base, cmdLine)
@@ -220,6 +227,7 @@ func Entry() {
 		logSysPorformance(cmdLine, procName)
 	}
 
+	health.Finish("startup")
 	select {}
 }
 
@@ -230,6 +238,12 @@ func startContentService(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 
 	addConsumer(transportMultiplexer, kafka.Consumer.SettingUpdateContent, base.Cfg.MultiInstance.Instance)
 	addConsumer(transportMultiplexer, kafka.Consumer.DownloadMedia, base.Cfg.MultiInstance.Instance)
+	// reloads broadcast by the admin api, in a group of the content servers
+	reloadConf := kafka.Consumer.SettingUpdateReload
+	reloadConf.Group += "-content"
+	if reloadConf.Topic != "" {
+		addConsumer(transportMultiplexer, reloadConf, base.Cfg.MultiInstance.Instance)
+	}
 
 	transportMultiplexer.PreStart()
 
@@ -263,7 +277,7 @@ func startContentService(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 	}
 
 	cache := &cache.RedisCache{}
-	if err := cache.Prepare(cfg.Redis.Uris); err != nil {
+	if err := cache.Prepare(cfg.Redis); err != nil {
 		log.Panicf("failed to connect to redis cache err:%v", err)
 	}
 
@@ -277,6 +291,8 @@ func startContentService(base *basecomponent.BaseDendrite, cmd *serverCmdPar) {
 		log.Panicf("failed to start settings consumer err:%v", err)
 	}
 
+	common.NewConfigReloadConsumer(reloadConf.Underlying, reloadConf.Name)
+
 	feddomains := common.NewFedDomains(settings)
 	settings.RegisterFederationDomainsUpdateCallback(feddomains.OnFedDomainsUpdate)
 
@@ -83,7 +83,7 @@ func (p *Processor) CheckEmote(rw http.ResponseWriter, req *http.Request, device
 	vars := mux.Vars(req)
 	domain := vars["serverName"]
 	mediaID := vars["mediaId"]
-	if !common.CheckValidDomain(domain,p.cfg.Matrix.ServerName){
+	if !common.IsLocalDomain(domain){
 		p.repo.Wait(req.Context(), domain, mediaID)
 	}
 	reqUrl := p.BuildBaseURL(p.cfg.Media.NetdiskUrl, "check", "emote", mediaID)
@@ -96,7 +96,7 @@ func (p *Processor) FavoriteEmote(rw http.ResponseWriter, req *http.Request, dev
 	vars := mux.Vars(req)
 	domain := vars["serverName"]
 	mediaID := vars["mediaId"]
-	if !common.CheckValidDomain(domain,p.cfg.Matrix.ServerName){
+	if !common.IsLocalDomain(domain){
 		p.repo.Wait(req.Context(), domain, mediaID)
 	}
 	reqUrl := p.BuildBaseURL(p.cfg.Media.NetdiskUrl, "favorite", "emote", mediaID)
@@ -109,7 +109,7 @@ func (p *Processor) FavoriteFileEmote(rw http.ResponseWriter, req *http.Request,
 	vars := mux.Vars(req)
 	domain := vars["serverName"]
 	mediaID := vars["mediaId"]
-	if !common.CheckValidDomain(domain,p.cfg.Matrix.ServerName){
+	if !common.IsLocalDomain(domain){
 		p.repo.Wait(req.Context(), domain, mediaID)
 	}
 	reqUrl := p.BuildBaseURL(p.cfg.Media.NetdiskUrl, "favorite", "fileemote", mediaID)
@@ -252,7 +252,7 @@ func (p *Processor) doDownload(
 	}
 
 	cfg := p.cfg
-	// if !useFed && !common.CheckValidDomain(service, cfg.Matrix.ServerName) {
+	// if !useFed && !common.IsLocalDomain(service) {
 	// 	p.responseError(w, util.JSONResponse{
 	// 		Code: http.StatusNotFound,
 	// 		JSON: jsonerror.Unknown("Unknown serverName"),
@@ -297,7 +297,7 @@ func (p *Processor) doDownload(
 		}
 	}
 
-	if !common.CheckValidDomain(service, cfg.Matrix.ServerName) {
+	if !common.IsLocalDomain(service) {
 		p.repo.Wait(req.Context(), service, netdiskID)
 	}
 
@@ -306,7 +306,7 @@ func (p *Processor) doDownload(
 	fromRemoteDomain := false
 	if err != nil {
 		log.Warnf("NetDiskDownLoad http response, err: %v, res: %v", err, res)
-		if !useFed || common.CheckValidDomain(service, cfg.Matrix.ServerName) {
+		if !useFed || common.IsLocalDomain(service) {
 			log.Errorw("download file error", log.KeysAndValues{"mediaId", netdiskID, "err", err})
 			p.responseError(w, util.JSONResponse{
 				Code: http.StatusInternalServerError,
@@ -318,7 +318,7 @@ func (p *Processor) doDownload(
 	}
 	if err == nil && res.StatusCode != http.StatusOK {
 		log.Warnf("NetDiskDownLoad http response, err: %v, res: %v", err, res)
-		if !useFed || common.CheckValidDomain(service, cfg.Matrix.ServerName) {
+		if !useFed || common.IsLocalDomain(service) {
 			var errInfo mediatypes.UploadError
 			err = json.NewDecoder(res.Body).Decode(&errInfo)
 			if err != nil {
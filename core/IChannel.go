@@ -41,6 +41,8 @@ type IChannel interface {
 	Start()
 	Stop()
 	Close()
+	// Ping checks the broker of the channel can be reached
+	Ping(ctx context.Context) error
 }
 
 type IChannelConsumer interface {
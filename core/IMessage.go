@@ -24,6 +24,13 @@ type Coder interface {
 	Decode(input []byte) error
 }
 
+// HeaderCoder is a response which sets http headers, such as the Location
+// of a redirect
+type HeaderCoder interface {
+	Coder
+	Headers() map[string]string
+}
+
 const (
 	FORMAT_JSON = int8(0)
 	FORMAT_GOB  = int8(1)
@@ -65,3 +65,15 @@ func GetSelector(name string, conf interface{}) (ISelector, error) {
 
 	return sel, err
 }
+
+// NewSelector returns a new selector, unlike GetSelector which shares one
+// per name
+func NewSelector(name string, conf interface{}) (ISelector, error) {
+	regSelectorMu.RLock()
+	f := newSelectorHandler[name]
+	regSelectorMu.RUnlock()
+	if f == nil {
+		return nil, errors.New("unknown selector " + name)
+	}
+	return f(conf)
+}
@@ -15,9 +15,12 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"log"
 	"sync"
+
+	"github.com/finogeeks/ligase/common/health"
 )
 
 type ITransport interface {
@@ -34,6 +37,8 @@ type ITransport interface {
 	GetStatsInterval() int
 	PreStart()
 	Start()
+	// Ping checks the brokers of the channels can be reached
+	Ping(ctx context.Context) error
 }
 
 var regTransportMu sync.RWMutex
@@ -70,6 +75,7 @@ func GetTransport(name, typeName string, conf interface{}) (ITransport, error) {
 	sel, err := f(conf)
 	if err == nil {
 		transportMap.Store(name, sel)
+		health.Register("transport:"+name, sel.Ping)
 	}
 
 	return sel, err
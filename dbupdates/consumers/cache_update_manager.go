@@ -17,12 +17,11 @@ package consumers
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"sync"
-	"time"
 
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/redispool"
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/dbupdates/dbregistry"
 	log "github.com/finogeeks/ligase/skunkworks/log"
@@ -31,26 +30,18 @@ import (
 
 type CacheUpdateManager struct {
 	cfg       *config.Dendrite
-	pools     []*redis.Pool
-	poolSize  int
+	connPool  *redis.Pool
 	consumers sync.Map
 }
 
 func NewCacheUpdateManager(cfg *config.Dendrite) *CacheUpdateManager {
 	m := new(CacheUpdateManager)
 	m.cfg = cfg
-	m.poolSize = len(m.cfg.Redis.Uris)
-	m.pools = make([]*redis.Pool, m.poolSize)
-	for i := 0; i < m.poolSize; i++ {
-		addr := m.cfg.Redis.Uris[i]
-		m.pools[i] = &redis.Pool{
-			MaxIdle:     200,
-			MaxActive:   200,
-			Wait:        true,
-			IdleTimeout: 240 * time.Second,
-			Dial:        func() (redis.Conn, error) { return redis.DialURL(addr) },
-		}
+	connPool, err := redispool.NewPool(cfg.Redis)
+	if err != nil {
+		log.Panicf("NewCacheUpdateManager: failed to connect to redis err:%v", err)
 	}
+	m.connPool = connPool
 
 	return m
 }
@@ -127,8 +118,7 @@ func (m *CacheUpdateManager) Start() error {
 }
 
 func (m *CacheUpdateManager) Pool() *redis.Pool {
-	slot := rand.Int() % m.poolSize
-	return m.pools[slot]
+	return m.connPool
 }
 
 func (m *CacheUpdateManager) OnMessage(ctx context.Context, topic string, partition int32, data []byte, rawMsg interface{}) {
@@ -44,7 +44,6 @@ type InternalMsgConsumer struct {
 	syncDB       model.SyncAPIDatabase
 	idg          *uid.UidGenerator
 	federation   *gomatrixserverlib.FederationClient
-	serverName   []string
 }
 
 func NewInternalMsgConsumer(
@@ -55,7 +54,6 @@ func NewInternalMsgConsumer(
 	cache service.Cache,
 	rpcCli *common.RpcClient,
 	federation *gomatrixserverlib.FederationClient,
-	serverName []string,
 ) *InternalMsgConsumer {
 	c := new(InternalMsgConsumer)
 	c.Cfg = cfg
@@ -65,7 +63,6 @@ func NewInternalMsgConsumer(
 	c.idg = idg
 	c.cache = cache
 	c.federation = federation
-	c.serverName = serverName
 	return c
 }
 
@@ -180,7 +177,7 @@ func (ReqPostQueryKey) Process(ctx context.Context, consumer interface{}, msg co
 	c := consumer.(*InternalMsgConsumer)
 	req := msg.(*external.PostQueryKeysRequest)
 	return routing.QueryPKeys(
-		ctx, req, device.ID, c.cache, c.federation, c.serverName,
+		ctx, req, device.ID, c.cache, c.federation,
 	)
 }
 
@@ -42,11 +42,10 @@ func SetupEncryptApi(
 ) model.EncryptorAPIDatabase {
 	encryptionDB := base.CreateEncryptApiDB()
 	syncDB := base.CreateSyncDB()
-	serverName := base.Cfg.Matrix.ServerName
 
 	apiConsumer := api.NewInternalMsgConsumer(
 		*base.Cfg, encryptionDB, syncDB,
-		idg, cache, rpcClient, federation, serverName,
+		idg, cache, rpcClient, federation,
 	)
 	apiConsumer.Start()
 
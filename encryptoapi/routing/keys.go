@@ -23,11 +23,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/finogeeks/ligase/clientapi/httputil"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/audit"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/model/authtypes"
@@ -65,6 +67,16 @@ func UploadPKeys(
 	keySpecific := turnSpecific(keyBody)
 	// persist keys into encryptionDB
 	err := persistKeys(ctx, encryptionDB, &keySpecific, userID, device.ID, cache, rpcClient, syncDB, idg)
+	audit.Emit(ctx, &authtypes.AuditEvent{
+		Type:     authtypes.AuditKeyUpload,
+		UserID:   userID,
+		DeviceID: device.ID,
+		Success:  err == nil,
+		Details: map[string]string{
+			"device_keys":   strconv.Itoa(len(keyBody.DeviceKeys.Keys)),
+			"one_time_keys": strconv.Itoa(len(keyBody.OneTimeKey)),
+		},
+	})
 	// numMap is algorithm-num map
 	numMap := (QueryOneTimeKeys(userID, device.ID, cache)).(map[string]int)
 
@@ -88,7 +100,6 @@ func QueryPKeys(
 	deviceID string,
 	cache service.Cache,
 	federation *gomatrixserverlib.FederationClient,
-	serverName []string,
 ) (int, core.Coder) {
 	var err error
 	// var queryRq types.QueryRequest
@@ -152,7 +163,7 @@ func QueryPKeys(
 		}
 
 		/* federation consideration */
-		if common.CheckValidDomain(server, serverName) == false {
+		if common.IsLocalDomain(server) == false {
 			umap := make(map[string][]string)
 			umap[uid] = midArr
 			rq := &gomatrixserverlib.QueryRequest{
@@ -21,6 +21,7 @@ import (
 	"strconv"
 
 	"github.com/finogeeks/ligase/adapter"
+	commonconfig "github.com/finogeeks/ligase/common/config"
 
 	"github.com/finogeeks/ligase/skunkworks/log"
 	"gopkg.in/yaml.v2"
@@ -102,10 +103,8 @@ type Fed struct {
 		Account    DataBaseConf `yaml:"account"`
 		UseSync    bool         `yaml:"use_sync"`
 	} `yaml:"database"`
-	Redis struct {
-		Uris []string `yaml:"uris"`
-	} `yaml:"redis"`
-	Log struct {
+	Redis commonconfig.RedisConf `yaml:"redis"`
+	Log   struct {
 		Debug          bool     `yaml:"debug"`
 		Level          string   `yaml:"level"`
 		Files          []string `yaml:"files"`
@@ -27,6 +27,7 @@ import (
 	"github.com/finogeeks/ligase/cache"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/domain"
+	"github.com/finogeeks/ligase/common/health"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/federation/client"
@@ -73,7 +74,10 @@ func Entry() {
 	log.Infof("Server version:%s", VERSION)
 	log.Infof("-------------------------------------")
 
+	health.Handle(http.DefaultServeMux)
+	health.Begin("startup")
 	startFedMonolith()
+	health.Finish("startup")
 
 	if httpBindAddr != nil && *httpBindAddr != "" {
 		listenHTTP(*httpBindAddr)
@@ -163,7 +167,7 @@ func startFedMonolith() {
 	}
 
 	cache := &cache.RedisCache{}
-	err = cache.Prepare(cfg.Redis.Uris)
+	err = cache.Prepare(cfg.Redis)
 	if err != nil {
 		log.Panicf("failed to connect to redis cache err:%v", err)
 	}
@@ -111,8 +111,7 @@ func (e *EduSender) OnMessage(ctx context.Context, topic string, partition int32
 		log.Errorf("fed-dispatch: message parse failure err:%v", err)
 		return
 	}
-	span := common.StartSpanFromMsgAfterReceived(topic, rawMsg)
-	span.Finish()
-	ctx = common.ContextWithSpan(ctx, span)
+	span, ctx := common.StartSomSpan(ctx, "EduSender.OnMessage")
+	defer span.Finish()
 	e.sender.sendEdu(ctx, &output)
 }
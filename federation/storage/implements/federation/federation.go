@@ -74,6 +74,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) prepare() error {
 	var err error
 
@@ -0,0 +1,379 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/lib/pq"
+)
+
+const usersPageSize = 500
+
+const selectSynapseUserIDsSQL = "" +
+	"SELECT name FROM users WHERE name > $1 AND is_guest = 0 ORDER BY name LIMIT $2"
+
+const selectSynapseUsersSQL = "" +
+	"SELECT name, COALESCE(password_hash, ''), COALESCE(creation_ts, 0), COALESCE(admin, 0)," +
+	" COALESCE(appservice_id, ''), COALESCE(deactivated, 0)" +
+	" FROM users WHERE name = ANY($1)"
+
+// profiles are keyed by localpart in synapse
+const selectSynapseProfilesSQL = "" +
+	"SELECT user_id, COALESCE(displayname, ''), COALESCE(avatar_url, '') FROM profiles WHERE user_id = ANY($1)"
+
+// hidden devices hold cross-signing keys, they are not devices of the user
+const selectSynapseDevicesSQL = "" +
+	"SELECT user_id, device_id, COALESCE(display_name, ''), COALESCE(last_seen, 0)" +
+	" FROM devices WHERE user_id = ANY($1) AND NOT hidden"
+
+const selectSynapseAccessTokensSQL = "" +
+	"SELECT user_id, device_id, token, valid_until_ms FROM access_tokens" +
+	" WHERE user_id = ANY($1) AND device_id IS NOT NULL AND puppets_user_id IS NULL" +
+	" AND (valid_until_ms IS NULL OR valid_until_ms > $2)" +
+	" ORDER BY id DESC"
+
+const selectSynapsePushRulesSQL = "" +
+	"SELECT user_name, rule_id, priority_class, priority, conditions, actions FROM push_rules WHERE user_name = ANY($1)"
+
+const selectSynapsePushRulesEnableSQL = "" +
+	"SELECT user_name, rule_id, COALESCE(enabled, 1) FROM push_rules_enable WHERE user_name = ANY($1)"
+
+const selectSynapseAccountDataSQL = "" +
+	"SELECT user_id, account_data_type, content FROM account_data WHERE user_id = ANY($1)"
+
+const selectSynapseRoomAccountDataSQL = "" +
+	"SELECT user_id, room_id, account_data_type, content FROM room_account_data WHERE user_id = ANY($1)"
+
+const selectSynapseRoomTagsSQL = "" +
+	"SELECT user_id, room_id, tag, COALESCE(content, '{}') FROM room_tags WHERE user_id = ANY($1)"
+
+const selectSynapseRoomAliasesSQL = "" +
+	"SELECT room_alias, room_id FROM room_aliases ORDER BY room_alias"
+
+// eachUserPage calls fn with the synapse users after the checkpoint of step, a
+// page at a time. The checkpoint is cleared once every user is done, so the
+// next run syncs all of them again.
+func (m *Migrator) eachUserPage(ctx context.Context, step string, fn func(ctx context.Context, userIDs []string) error) error {
+	lastKey, _, _, err := m.progress.get(ctx, step)
+	if err != nil {
+		return err
+	}
+	if lastKey != "" {
+		log.Infof("migration step %s resume after user %s", step, lastKey)
+	}
+	total := 0
+	for {
+		rows, err := m.synapse.QueryContext(ctx, selectSynapseUserIDsSQL, lastKey, usersPageSize)
+		if err != nil {
+			return err
+		}
+		userIDs := []string{}
+		for rows.Next() {
+			var userID string
+			if err := rows.Scan(&userID); err != nil {
+				rows.Close() // nolint: errcheck
+				return err
+			}
+			userIDs = append(userIDs, userID)
+		}
+		rows.Close() // nolint: errcheck
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return m.progress.set(ctx, step, "", 0)
+		}
+		if err := fn(ctx, userIDs); err != nil {
+			return err
+		}
+		lastKey = userIDs[len(userIDs)-1]
+		if err := m.progress.set(ctx, step, lastKey, 0); err != nil {
+			return err
+		}
+		total += len(userIDs)
+		log.Infof("migration step %s %d users done, last %s", step, total, lastKey)
+	}
+}
+
+func (m *Migrator) migrateAccounts(ctx context.Context) error {
+	return m.eachUserPage(ctx, StepAccounts, func(ctx context.Context, userIDs []string) error {
+		rows, err := m.synapse.QueryContext(ctx, selectSynapseUsersSQL, pq.StringArray(userIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close() // nolint: errcheck
+		for rows.Next() {
+			var userID, hash, appServiceID string
+			var createdTs int64
+			var admin, deactivated int
+			if err := rows.Scan(&userID, &hash, &createdTs, &admin, &appServiceID, &deactivated); err != nil {
+				return err
+			}
+			if appServiceID == "" {
+				appServiceID = "actual"
+			}
+			// synapse keeps the creation time in seconds
+			if err := m.accountDB.OnInsertAccount(ctx, userID, hash, appServiceID, createdTs*1000); err != nil {
+				return err
+			}
+			if err := m.accountDB.SetAccountAdmin(ctx, userID, admin != 0); err != nil {
+				return err
+			}
+			if err := m.accountDB.SetAccountLocked(ctx, userID, deactivated != 0); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return m.migrateProfiles(ctx, userIDs)
+	})
+}
+
+func (m *Migrator) migrateProfiles(ctx context.Context, userIDs []string) error {
+	localparts := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if localpart, _, err := gomatrixserverlib.SplitID('@', userID); err == nil {
+			localparts = append(localparts, localpart)
+		}
+	}
+	rows, err := m.synapse.QueryContext(ctx, selectSynapseProfilesSQL, pq.StringArray(localparts))
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // nolint: errcheck
+	for rows.Next() {
+		var localpart, displayName, avatarURL string
+		if err := rows.Scan(&localpart, &displayName, &avatarURL); err != nil {
+			return err
+		}
+		userID := "@" + localpart + ":" + m.domain
+		// an existing ligase profile is only replaced with update_avatar
+		if m.cfg.Migration.UpdateAvatar {
+			err = m.accountDB.OnUpsertProfile(ctx, userID, displayName, avatarURL)
+		} else {
+			err = m.accountDB.OnInitProfile(ctx, userID, displayName, avatarURL)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// migrateDevices imports the devices and maps each of their synapse access
+// tokens to a new ligase token, the clients stay logged in. Only the newest
+// token of a device is kept.
+func (m *Migrator) migrateDevices(ctx context.Context) error {
+	return m.eachUserPage(ctx, StepDevices, func(ctx context.Context, userIDs []string) error {
+		rows, err := m.synapse.QueryContext(ctx, selectSynapseDevicesSQL, pq.StringArray(userIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close() // nolint: errcheck
+		now := time.Now().UnixNano() / 1000000
+		for rows.Next() {
+			var userID, deviceID, displayName string
+			var lastSeen int64
+			if err := rows.Scan(&userID, &deviceID, &displayName, &lastSeen); err != nil {
+				return err
+			}
+			createdTs := lastSeen
+			if createdTs == 0 {
+				createdTs = now
+			}
+			if err := m.deviceDB.OnInsertDevice(ctx, userID, &deviceID, &displayName, createdTs, lastSeen, "actual", ""); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		tokenRows, err := m.synapse.QueryContext(ctx, selectSynapseAccessTokensSQL, pq.StringArray(userIDs), now)
+		if err != nil {
+			return err
+		}
+		defer tokenRows.Close() // nolint: errcheck
+		for tokenRows.Next() {
+			var userID, deviceID, token string
+			var validUntil sql.NullInt64
+			if err := tokenRows.Scan(&userID, &deviceID, &token, &validUntil); err != nil {
+				return err
+			}
+			migToken, err := m.migratedToken(userID, deviceID, validUntil, now)
+			if err != nil {
+				return err
+			}
+			if err := m.deviceDB.OnInsertMigDevice(ctx, token, migToken, deviceID, userID); err != nil {
+				return err
+			}
+		}
+		return tokenRows.Err()
+	})
+}
+
+// migratedToken builds the ligase token an imported access token maps to
+func (m *Migrator) migratedToken(userID, deviceID string, validUntil sql.NullInt64, now int64) (string, error) {
+	return common.BuildExpiringToken(m.cfg.Macaroon.Key, userID, m.domain, userID, "", false, deviceID, "actual", true,
+		migratedTokenExpire(validUntil, now, m.cfg.Authorization.AccessTokenLifetime))
+}
+
+// migratedTokenExpire is when the imported access token expires: when synapse
+// would have expired it, and at the latest after the access token lifetime of
+// this server. The imported sessions have no refresh token, their users log
+// in again.
+func migratedTokenExpire(validUntil sql.NullInt64, now, lifetime int64) int64 {
+	var expireTs int64
+	if validUntil.Valid {
+		expireTs = validUntil.Int64
+	}
+	if lifetime > 0 && (expireTs == 0 || expireTs > now+lifetime) {
+		expireTs = now + lifetime
+	}
+	return expireTs
+}
+
+func (m *Migrator) migratePushRules(ctx context.Context) error {
+	return m.eachUserPage(ctx, StepPushRules, func(ctx context.Context, userIDs []string) error {
+		rows, err := m.synapse.QueryContext(ctx, selectSynapsePushRulesSQL, pq.StringArray(userIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close() // nolint: errcheck
+		for rows.Next() {
+			var userID, ruleID, conditions, actions string
+			var priorityClass, priority int
+			if err := rows.Scan(&userID, &ruleID, &priorityClass, &priority, &conditions, &actions); err != nil {
+				return err
+			}
+			if err := m.pushDB.OnAddPushRule(ctx, userID, ruleID, priorityClass, priority, []byte(conditions), []byte(actions)); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		enableRows, err := m.synapse.QueryContext(ctx, selectSynapsePushRulesEnableSQL, pq.StringArray(userIDs))
+		if err != nil {
+			return err
+		}
+		defer enableRows.Close() // nolint: errcheck
+		for enableRows.Next() {
+			var userID, ruleID string
+			var enabled int
+			if err := enableRows.Scan(&userID, &ruleID, &enabled); err != nil {
+				return err
+			}
+			if err := m.pushDB.OnAddPushRuleEnable(ctx, userID, ruleID, enabled); err != nil {
+				return err
+			}
+		}
+		return enableRows.Err()
+	})
+}
+
+func (m *Migrator) migrateAccountData(ctx context.Context) error {
+	return m.eachUserPage(ctx, StepAccountData, func(ctx context.Context, userIDs []string) error {
+		rows, err := m.synapse.QueryContext(ctx, selectSynapseAccountDataSQL, pq.StringArray(userIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close() // nolint: errcheck
+		for rows.Next() {
+			var userID, dataType, content string
+			if err := rows.Scan(&userID, &dataType, &content); err != nil {
+				return err
+			}
+			if err := m.accountDB.OnInsertAccountData(ctx, userID, "", dataType, content); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		roomRows, err := m.synapse.QueryContext(ctx, selectSynapseRoomAccountDataSQL, pq.StringArray(userIDs))
+		if err != nil {
+			return err
+		}
+		defer roomRows.Close() // nolint: errcheck
+		for roomRows.Next() {
+			var userID, roomID, dataType, content string
+			if err := roomRows.Scan(&userID, &roomID, &dataType, &content); err != nil {
+				return err
+			}
+			if !m.wantRoom(roomID) {
+				continue
+			}
+			if err := m.accountDB.OnInsertAccountData(ctx, userID, roomID, dataType, content); err != nil {
+				return err
+			}
+		}
+		if err := roomRows.Err(); err != nil {
+			return err
+		}
+
+		tagRows, err := m.synapse.QueryContext(ctx, selectSynapseRoomTagsSQL, pq.StringArray(userIDs))
+		if err != nil {
+			return err
+		}
+		defer tagRows.Close() // nolint: errcheck
+		for tagRows.Next() {
+			var userID, roomID, tag, content string
+			if err := tagRows.Scan(&userID, &roomID, &tag, &content); err != nil {
+				return err
+			}
+			if !m.wantRoom(roomID) {
+				continue
+			}
+			if err := m.accountDB.OnInsertRoomTag(ctx, userID, roomID, tag, []byte(content)); err != nil {
+				return err
+			}
+		}
+		return tagRows.Err()
+	})
+}
+
+func (m *Migrator) migrateAliases(ctx context.Context) error {
+	rows, err := m.synapse.QueryContext(ctx, selectSynapseRoomAliasesSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // nolint: errcheck
+	count := 0
+	for rows.Next() {
+		var alias, roomID string
+		if err := rows.Scan(&alias, &roomID); err != nil {
+			return err
+		}
+		if !m.wantRoom(roomID) {
+			continue
+		}
+		if err := m.roomDB.AliaseInsertRaw(ctx, alias, roomID); err != nil {
+			return err
+		}
+		count++
+	}
+	log.Infof("migration step %s %d aliases done", StepAliases, count)
+	return rows.Err()
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/model/service"
+)
+
+func TestMigratedTokenExpire(t *testing.T) {
+	const now, hour = int64(1000000), int64(3600000)
+	cases := []struct {
+		validUntil sql.NullInt64
+		lifetime   int64
+		want       int64
+	}{
+		{sql.NullInt64{}, 0, 0},
+		{sql.NullInt64{}, hour, now + hour},
+		{sql.NullInt64{Int64: now + 10, Valid: true}, 0, now + 10},
+		{sql.NullInt64{Int64: now + 10, Valid: true}, hour, now + 10},
+		{sql.NullInt64{Int64: now + 2*hour, Valid: true}, hour, now + hour},
+	}
+	for _, c := range cases {
+		if got := migratedTokenExpire(c.validUntil, now, c.lifetime); got != c.want {
+			t.Errorf("valid until %v lifetime %d: got %d, want %d", c.validUntil, c.lifetime, got, c.want)
+		}
+	}
+}
+
+// migTokenCache maps the imported tokens to the migrated ones
+type migTokenCache struct {
+	service.Cache
+	tokens map[string]string
+}
+
+func (c *migTokenCache) GetMigTokenByToken(token string) (string, error) {
+	return c.tokens[token], nil
+}
+
+func TestMigratedTokenExpires(t *testing.T) {
+	cfg := &config.Dendrite{}
+	cfg.Macaroon.Key = "key"
+	cfg.Migration.AcceptTokens = true
+	m := &Migrator{cfg: cfg, domain: "test"}
+
+	// imported while synapse still accepted it, verified after valid_until_ms
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	validUntil := sql.NullInt64{Int64: now - 1000, Valid: true}
+	migToken, err := m.migratedToken("@alice:test", "DEVICE", validUntil, now-60000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &migTokenCache{tokens: map[string]string{"syt_imported": migToken}}
+	device, resErr := common.VerifyToken("syt_imported", "/sync", cache, *cfg, nil)
+	if device != nil || resErr == nil {
+		t.Fatal("migrated token accepted after valid_until_ms")
+	}
+	if e, ok := resErr.JSON.(*jsonerror.UnknownTokenError); !ok || !e.SoftLogout {
+		t.Fatalf("expired migrated token did not soft log out: %v", resErr.JSON)
+	}
+
+	validUntil.Int64 = now + 60000
+	if migToken, err = m.migratedToken("@alice:test", "DEVICE", validUntil, now); err != nil {
+		t.Fatal(err)
+	}
+	cache.tokens["syt_imported"] = migToken
+	if device, resErr := common.VerifyToken("syt_imported", "/sync", cache, *cfg, nil); resErr != nil || device.UserID != "@alice:test" {
+		t.Fatalf("valid migrated token refused: %v", resErr)
+	}
+}
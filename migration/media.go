@@ -0,0 +1,95 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+const selectSynapseLocalMediaSQL = "" +
+	"SELECT media_id, COALESCE(media_type, ''), COALESCE(media_length, 0), COALESCE(created_ts, 0)," +
+	" COALESCE(upload_name, ''), COALESCE(user_id, '')" +
+	" FROM local_media_repository WHERE quarantined_by IS NULL AND url_cache IS NULL" +
+	" ORDER BY media_id"
+
+// MediaRef is a file of the synapse media store. The files live in the media
+// service of ligase, the references are written out for it to load them under
+// the same mxc uri so the imported events keep working.
+type MediaRef struct {
+	URI        string `json:"uri"`
+	MediaType  string `json:"media_type"`
+	Length     int64  `json:"media_length"`
+	CreatedTs  int64  `json:"created_ts"`
+	UploadName string `json:"upload_name,omitempty"`
+	UserID     string `json:"user_id"`
+	// Path is relative to the synapse media_store_path
+	Path string `json:"path"`
+}
+
+// migrateMedia writes one MediaRef per line to the media file. The file is
+// rewritten on every run.
+func (m *Migrator) migrateMedia(ctx context.Context) error {
+	f, err := os.Create(m.mediaOut)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+	w := bufio.NewWriter(f)
+
+	rows, err := m.synapse.QueryContext(ctx, selectSynapseLocalMediaSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() // nolint: errcheck
+	count := 0
+	for rows.Next() {
+		var ref MediaRef
+		var mediaID string
+		if err := rows.Scan(&mediaID, &ref.MediaType, &ref.Length, &ref.CreatedTs, &ref.UploadName, &ref.UserID); err != nil {
+			return err
+		}
+		ref.URI = "mxc://" + m.domain + "/" + mediaID
+		ref.Path = synapseMediaPath(mediaID)
+		line, err := json.Marshal(ref)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Infof("migration step %s %d media written to %s", StepMedia, count, m.mediaOut)
+	return f.Sync()
+}
+
+// synapseMediaPath mirrors the local_content layout of the synapse media store
+func synapseMediaPath(mediaID string) string {
+	if len(mediaID) < 5 {
+		return path.Join("local_content", mediaID)
+	}
+	return path.Join("local_content", mediaID[0:2], mediaID[2:4], mediaID[4:])
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package migration imports the data of a Synapse homeserver into ligase.
+//
+// Accounts, devices, push rules and account data are written straight to the
+// ligase databases, run the cache-loader afterwards to refresh redis. Room
+// history is replayed through the running roomserver as KindImport events so
+// the sync and push pipelines see it like any other event.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/uid"
+	"github.com/finogeeks/ligase/model/service/roomserverapi"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/finogeeks/ligase/storage/model"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// The steps of a migration, config migration.migration_list picks a subset
+const (
+	StepAccounts    = "accounts"
+	StepDevices     = "devices"
+	StepAliases     = "aliases"
+	StepPushRules   = "push_rules"
+	StepAccountData = "account_data"
+	StepRooms       = "rooms"
+	StepMedia       = "media"
+)
+
+// Steps lists every step in the order they run. Rooms come after accounts so
+// the members exist when their events arrive.
+var Steps = []string{StepAccounts, StepDevices, StepAliases, StepPushRules, StepAccountData, StepRooms, StepMedia}
+
+const defaultBatchSize = 50
+
+type Migrator struct {
+	cfg       *config.Dendrite
+	synapse   *sql.DB
+	accountDB model.AccountsDatabase
+	deviceDB  model.DeviceDatabase
+	roomDB    model.RoomServerDatabase
+	pushDB    model.PushAPIDatabase
+	rsRpcCli  roomserverapi.RoomserverRPCAPI
+	idg       *uid.UidGenerator
+	progress  *progressTable
+	domain    string
+	steps     map[string]bool
+	rooms     map[string]bool
+	ignore    map[string]bool
+	batchSize int
+	mediaOut  string
+}
+
+// NewMigrator prepares a migration from the synapse database to the ligase
+// databases. Event NIDs come from the last worker id which no ligase
+// instance is configured with.
+func NewMigrator(
+	cfg *config.Dendrite,
+	synapse *sql.DB,
+	accountDB model.AccountsDatabase,
+	deviceDB model.DeviceDatabase,
+	roomDB model.RoomServerDatabase,
+	pushDB model.PushAPIDatabase,
+	rsRpcCli roomserverapi.RoomserverRPCAPI,
+) (*Migrator, error) {
+	progress, err := newProgressTable(roomDB.GetDB())
+	if err != nil {
+		return nil, err
+	}
+	idg, _ := uid.NewIdGenerator(uid.MaxWorkId, uid.MaxWorkId)
+	m := &Migrator{
+		cfg:       cfg,
+		synapse:   synapse,
+		accountDB: accountDB,
+		deviceDB:  deviceDB,
+		roomDB:    roomDB,
+		pushDB:    pushDB,
+		rsRpcCli:  rsRpcCli,
+		idg:       idg,
+		progress:  progress,
+		domain:    cfg.Migration.DomainName,
+		steps:     make(map[string]bool),
+		rooms:     make(map[string]bool),
+		ignore:    make(map[string]bool),
+		batchSize: defaultBatchSize,
+	}
+	if m.domain == "" {
+		m.domain = cfg.Matrix.ServerName[0]
+	}
+	for _, step := range cfg.Migration.MigrationList {
+		m.steps[step] = true
+	}
+	for _, roomID := range cfg.Migration.RoomList {
+		m.rooms[roomID] = true
+	}
+	for _, roomID := range cfg.Migration.IgnoreRooms {
+		m.ignore[roomID] = true
+	}
+	return m, nil
+}
+
+// SetBatchSize sets how many events are sent to the roomserver at once
+func (m *Migrator) SetBatchSize(size int) {
+	if size > 0 {
+		m.batchSize = size
+	}
+}
+
+// SetMediaOut sets the file the media references are written to
+func (m *Migrator) SetMediaOut(path string) {
+	m.mediaOut = path
+}
+
+// Run runs the configured steps. Every step can be run again, the rooms
+// continue from the last imported event.
+func (m *Migrator) Run(ctx context.Context) error {
+	for _, step := range Steps {
+		if !m.enabled(step) {
+			continue
+		}
+		log.Infof("migration step %s start", step)
+		var err error
+		switch step {
+		case StepAccounts:
+			err = m.migrateAccounts(ctx)
+		case StepDevices:
+			err = m.migrateDevices(ctx)
+		case StepAliases:
+			err = m.migrateAliases(ctx)
+		case StepPushRules:
+			err = m.migratePushRules(ctx)
+		case StepAccountData:
+			err = m.migrateAccountData(ctx)
+		case StepRooms:
+			err = m.migrateRooms(ctx)
+		case StepMedia:
+			err = m.migrateMedia(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("migration step %s: %v", step, err)
+		}
+		log.Infof("migration step %s done", step)
+	}
+	return nil
+}
+
+func (m *Migrator) enabled(step string) bool {
+	if step == StepDevices && !m.cfg.Migration.ProcessDevice {
+		return false
+	}
+	if step == StepMedia && m.mediaOut == "" {
+		return false
+	}
+	return len(m.steps) == 0 || m.steps[step]
+}
+
+func (m *Migrator) wantRoom(roomID string) bool {
+	if m.ignore[roomID] {
+		return false
+	}
+	return len(m.rooms) == 0 || m.rooms[roomID]
+}
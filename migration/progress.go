@@ -0,0 +1,75 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const progressSchema = `
+-- Stores how far a synapse migration got, so it can be resumed.
+CREATE TABLE IF NOT EXISTS migration_synapse_progress (
+	-- The step, or "room:" and the room id for room history
+	item TEXT NOT NULL PRIMARY KEY,
+	-- The last user id handled by a step
+	last_key TEXT NOT NULL DEFAULT '',
+	-- The synapse stream_ordering of the last imported room event
+	last_pos BIGINT NOT NULL DEFAULT 0,
+	updated_ts BIGINT NOT NULL
+);
+`
+
+const selectProgressSQL = "" +
+	"SELECT last_key, last_pos FROM migration_synapse_progress WHERE item = $1"
+
+const upsertProgressSQL = "" +
+	"INSERT INTO migration_synapse_progress(item, last_key, last_pos, updated_ts) VALUES ($1, $2, $3, $4)" +
+	" ON CONFLICT (item) DO UPDATE SET last_key = EXCLUDED.last_key, last_pos = EXCLUDED.last_pos, updated_ts = EXCLUDED.updated_ts"
+
+type progressTable struct {
+	selectProgressStmt *sql.Stmt
+	upsertProgressStmt *sql.Stmt
+}
+
+func newProgressTable(db *sql.DB) (*progressTable, error) {
+	if _, err := db.Exec(progressSchema); err != nil {
+		return nil, err
+	}
+	t := new(progressTable)
+	var err error
+	if t.selectProgressStmt, err = db.Prepare(selectProgressSQL); err != nil {
+		return nil, err
+	}
+	if t.upsertProgressStmt, err = db.Prepare(upsertProgressSQL); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// get returns the saved position of item, or the zero values if it never ran
+func (t *progressTable) get(ctx context.Context, item string) (lastKey string, lastPos int64, exists bool, err error) {
+	err = t.selectProgressStmt.QueryRowContext(ctx, item).Scan(&lastKey, &lastPos)
+	if err == sql.ErrNoRows {
+		return "", 0, false, nil
+	}
+	return lastKey, lastPos, err == nil, err
+}
+
+func (t *progressTable) set(ctx context.Context, item, lastKey string, lastPos int64) error {
+	_, err := t.upsertProgressStmt.ExecContext(ctx, item, lastKey, lastPos, time.Now().UnixNano()/1000000)
+	return err
+}
@@ -0,0 +1,289 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/finogeeks/ligase/model/service/roomserverapi"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const selectSynapseRoomsSQL = "" +
+	"SELECT room_id FROM rooms ORDER BY room_id"
+
+// outliers and rejected events are not part of the room history. Backfilled
+// events have a negative stream_ordering which decreases going back in time,
+// so ordering by it replays the oldest events first.
+const synapseRoomEventsWhere = "" +
+	" FROM events e JOIN event_json j ON j.event_id = e.event_id" +
+	" LEFT JOIN rejections r ON r.event_id = e.event_id" +
+	" WHERE e.room_id = $1 AND NOT e.outlier AND r.event_id IS NULL"
+
+const selectSynapseRoomEventsSQL = "" +
+	"SELECT e.stream_ordering, e.event_id, j.json" + synapseRoomEventsWhere +
+	" AND e.stream_ordering > $2 ORDER BY e.stream_ordering LIMIT $3"
+
+const selectSynapseRoomEventsCountSQL = "" +
+	"SELECT count(1), count(1) FILTER (WHERE e.stream_ordering <= $2)" + synapseRoomEventsWhere
+
+const selectSynapseEventSenderSQL = "" +
+	"SELECT sender FROM events WHERE event_id = $1"
+
+// the fields that reference another event of the room and that ligase keeps
+var eventRefPaths = []string{
+	"redacts",
+	"content.redacts",
+	`content.m\.relates_to.event_id`,
+	`content.m\.relates_to.m\.in_reply_to.event_id`,
+}
+
+// ligase events have no place for these fields: events are replayed in stream
+// order instead of by their DAG, and they are issued again by this server
+var droppedEventPaths = []string{
+	"prev_events",
+	"auth_events",
+	"hashes",
+	"signatures",
+}
+
+func (m *Migrator) migrateRooms(ctx context.Context) error {
+	rows, err := m.synapse.QueryContext(ctx, selectSynapseRoomsSQL)
+	if err != nil {
+		return err
+	}
+	roomIDs := []string{}
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			rows.Close() // nolint: errcheck
+			return err
+		}
+		if m.wantRoom(roomID) {
+			roomIDs = append(roomIDs, roomID)
+		}
+	}
+	rows.Close() // nolint: errcheck
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, roomID := range roomIDs {
+		if err := m.migrateRoom(ctx, roomID, i+1, len(roomIDs)); err != nil {
+			return fmt.Errorf("room %s: %v", roomID, err)
+		}
+	}
+	return nil
+}
+
+// migrateRoom replays the history of a room in batches and saves the position
+// after each one. Events the roomserver already has are skipped, so a batch
+// interrupted halfway is not imported twice.
+func (m *Migrator) migrateRoom(ctx context.Context, roomID string, index, rooms int) error {
+	item := "room:" + roomID
+	_, lastPos, started, err := m.progress.get(ctx, item)
+	if err != nil {
+		return err
+	}
+	if !started {
+		exists, err := m.roomDB.RoomExists(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		if exists && !m.cfg.Migration.AppendWhenRoomExist {
+			log.Infof("migration room %s (%d/%d) already exists, skipped", roomID, index, rooms)
+			return nil
+		}
+		lastPos = math.MinInt64
+	}
+
+	var total, done int
+	if err := m.synapse.QueryRowContext(ctx, selectSynapseRoomEventsCountSQL, roomID, lastPos).Scan(&total, &done); err != nil {
+		return err
+	}
+	if done == total {
+		log.Infof("migration room %s (%d/%d) up to date, %d events", roomID, index, rooms, total)
+		return nil
+	}
+
+	senders := make(map[string]string)
+	for {
+		rows, err := m.synapse.QueryContext(ctx, selectSynapseRoomEventsSQL, roomID, lastPos, m.batchSize)
+		if err != nil {
+			return err
+		}
+		var events []gomatrixserverlib.Event
+		var ids []string
+		n := 0
+		for rows.Next() {
+			var pos int64
+			var eventID, eventJSON string
+			if err := rows.Scan(&pos, &eventID, &eventJSON); err != nil {
+				rows.Close() // nolint: errcheck
+				return err
+			}
+			lastPos = pos
+			n++
+			ev, err := m.importEvent(ctx, eventID, []byte(eventJSON), senders)
+			if err != nil {
+				log.Warnf("migration room %s skip event %s: %v", roomID, eventID, err)
+				continue
+			}
+			events = append(events, ev)
+			ids = append(ids, ev.EventID())
+		}
+		rows.Close() // nolint: errcheck
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		if len(ids) > 0 {
+			known, err := m.roomDB.EventNIDs(ctx, ids)
+			if err != nil {
+				return err
+			}
+			fresh := events[:0]
+			for _, ev := range events {
+				if _, ok := known[ev.EventID()]; !ok {
+					fresh = append(fresh, ev)
+				}
+			}
+			if len(fresh) > 0 {
+				rawEvent := roomserverapi.RawEvent{
+					RoomID: roomID,
+					Kind:   roomserverapi.KindImport,
+					Trust:  true,
+				}
+				rawEvent.BulkEvents.Events = fresh
+				rawEvent.BulkEvents.SvrName = m.domain
+				if _, err := m.rsRpcCli.InputRoomEvents(ctx, &rawEvent); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := m.progress.set(ctx, item, "", lastPos); err != nil {
+			return err
+		}
+		done += n
+		log.Infof("migration room %s (%d/%d) %d/%d events", roomID, index, rooms, done, total)
+	}
+	return nil
+}
+
+// importEvent turns synapse event JSON into a ligase event. Event ids of room
+// version 3 and later carry no domain, which ligase requires to match the
+// origin of the event. The id of the event and every id the kept fields
+// reference go through importEventID, so the references still lead to the
+// imported events.
+func (m *Migrator) importEvent(ctx context.Context, eventID string, eventJSON []byte, senders map[string]string) (ev gomatrixserverlib.Event, err error) {
+	roomID := gjson.GetBytes(eventJSON, "room_id").String()
+	senders[eventID] = gjson.GetBytes(eventJSON, "sender").String()
+	if eventID, err = m.importEventID(ctx, roomID, eventID, senders); err != nil {
+		return
+	}
+	_, origin, err := gomatrixserverlib.SplitID('$', eventID)
+	if err != nil {
+		return
+	}
+
+	for _, path := range droppedEventPaths {
+		if eventJSON, err = sjson.DeleteBytes(eventJSON, path); err != nil {
+			return
+		}
+	}
+	for _, path := range eventRefPaths {
+		ref := gjson.GetBytes(eventJSON, path)
+		if ref.Type != gjson.String {
+			continue
+		}
+		refID, err := m.importEventID(ctx, roomID, ref.String(), senders)
+		if err != nil {
+			return ev, err
+		}
+		if eventJSON, err = sjson.SetBytes(eventJSON, path, refID); err != nil {
+			return ev, err
+		}
+		if path == "redacts" || path == "content.redacts" {
+			refSender, err := m.eventSender(ctx, ref.String(), senders)
+			if err != nil {
+				return ev, err
+			}
+			if eventJSON, err = sjson.SetBytes(eventJSON, "redacts_sender", refSender); err != nil {
+				return ev, err
+			}
+		}
+	}
+
+	nid, err := m.idg.Next()
+	if err != nil {
+		return
+	}
+	if eventJSON, err = sjson.SetBytes(eventJSON, "event_id", eventID); err != nil {
+		return
+	}
+	if eventJSON, err = sjson.SetBytes(eventJSON, "origin", string(origin)); err != nil {
+		return
+	}
+	if eventJSON, err = sjson.SetBytes(eventJSON, "event_nid", nid); err != nil {
+		return
+	}
+	return gomatrixserverlib.NewEventFromUntrustedJSON(eventJSON)
+}
+
+// importEventID returns the ligase id of a synapse event. Ids with a domain
+// are kept, the others get the domain of the sender, or of the room if the
+// event is unknown, so an id maps to the same one wherever it appears.
+func (m *Migrator) importEventID(ctx context.Context, roomID, eventID string, senders map[string]string) (string, error) {
+	if strings.Contains(eventID, ":") {
+		return eventID, nil
+	}
+	sender, err := m.eventSender(ctx, eventID, senders)
+	if err != nil {
+		return "", err
+	}
+	if _, domain, err := gomatrixserverlib.SplitID('@', sender); err == nil {
+		return eventID + ":" + string(domain), nil
+	}
+	if _, domain, err := gomatrixserverlib.SplitID('!', roomID); err == nil {
+		return eventID + ":" + string(domain), nil
+	}
+	return eventID, nil
+}
+
+// eventSender returns the sender of a synapse event, an empty string if it is
+// unknown
+func (m *Migrator) eventSender(ctx context.Context, eventID string, senders map[string]string) (string, error) {
+	if sender, ok := senders[eventID]; ok {
+		return sender, nil
+	}
+	var sender string
+	err := m.synapse.QueryRowContext(ctx, selectSynapseEventSenderSQL, eventID).Scan(&sender)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	senders[eventID] = sender
+	return sender, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migration
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/uid"
+	"github.com/tidwall/gjson"
+)
+
+func newImportTest(t *testing.T) *Migrator {
+	idg, err := uid.NewIdGenerator(uid.MaxWorkId, uid.MaxWorkId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no synapse db, every sender the tests need is known
+	return &Migrator{idg: idg}
+}
+
+func TestImportEventRoomV1(t *testing.T) {
+	m := newImportTest(t)
+	senders := map[string]string{"$target:old": "@alice:old"}
+	eventJSON := `{"event_id":"$redact:other","room_id":"!room:old","sender":"@bob:other","type":"m.room.redaction",` +
+		`"redacts":"$target:old","content":{},"depth":5,"origin_server_ts":10,` +
+		`"prev_events":[["$target:old",{"sha256":"x"}]],"auth_events":[["$create:old",{"sha256":"y"}]],` +
+		`"hashes":{"sha256":"z"},"signatures":{"other":{"ed25519:a":"s"}}}`
+	ev, err := m.importEvent(context.Background(), "$redact:other", []byte(eventJSON), senders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.EventID() != "$redact:other" || ev.Redacts() != "$target:old" || ev.RedactEventSender() != "@alice:old" {
+		t.Fatalf("ids with a domain must be kept: %s", ev.JSON())
+	}
+	if ev.Origin() != "other" || ev.EventNID() == 0 || ev.Depth() != 5 {
+		t.Fatalf("unexpected event %s", ev.JSON())
+	}
+}
+
+func TestImportEventRoomV3(t *testing.T) {
+	m := newImportTest(t)
+	ctx := context.Background()
+	senders := map[string]string{}
+	// events arrive in stream order, the target first
+	target, err := m.importEvent(ctx, "$target", []byte(`{"room_id":"!room:old","sender":"@alice:old",`+
+		`"type":"m.room.message","content":{"body":"hi"},"prev_events":["$create"],"auth_events":["$create"]}`), senders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.EventID() != "$target:old" || target.Origin() != "old" {
+		t.Fatalf("the id must get the domain of the sender: %s", target.JSON())
+	}
+
+	reply, err := m.importEvent(ctx, "$reply", []byte(`{"room_id":"!room:old","sender":"@bob:other",`+
+		`"type":"m.room.message","content":{"body":"hello","m.relates_to":{"m.in_reply_to":{"event_id":"$target"}}},`+
+		`"prev_events":["$target"],"auth_events":["$create"]}`), senders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.EventID() != "$reply:other" || reply.Origin() != "other" {
+		t.Fatalf("unexpected reply %s", reply.JSON())
+	}
+	if got := gjson.GetBytes(reply.Content(), `m\.relates_to.m\.in_reply_to.event_id`).String(); got != target.EventID() {
+		t.Fatalf("the reply points to %s, the target was imported as %s", got, target.EventID())
+	}
+
+	redaction, err := m.importEvent(ctx, "$redact", []byte(`{"room_id":"!room:old","sender":"@alice:old",`+
+		`"type":"m.room.redaction","redacts":"$target","content":{}}`), senders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redaction.Redacts() != target.EventID() || redaction.RedactEventSender() != "@alice:old" {
+		t.Fatalf("unexpected redaction %s", redaction.JSON())
+	}
+
+	// ligase keeps no DAG, the fields are not carried over stale
+	for _, field := range []string{"prev_events", "auth_events", "hashes", "signatures"} {
+		if strings.Contains(string(reply.JSON()), field) {
+			t.Errorf("%s is kept: %s", field, reply.JSON())
+		}
+	}
+}
+
+func TestImportEventUnknownReference(t *testing.T) {
+	m := newImportTest(t)
+	// the referenced event is not in synapse either
+	senders := map[string]string{"$gone": ""}
+	ev, err := m.importEvent(context.Background(), "$edit", []byte(`{"room_id":"!room:old","sender":"@bob:other",`+
+		`"type":"m.room.message","content":{"body":"* fixed","m.relates_to":{"rel_type":"m.replace","event_id":"$gone"}}}`), senders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gjson.GetBytes(ev.Content(), `m\.relates_to.event_id`).String(); got != "$gone:old" {
+		t.Fatalf("an unknown event takes the domain of the room, got %s", got)
+	}
+}
@@ -27,7 +27,15 @@ type Account struct {
 	ServerName   gomatrixserverlib.ServerName
 	Profile      *Profile
 	AppServiceID string
-	// TODO: Other flags like IsAdmin, IsGuest
+	CreatedTs    int64
+	// IsAdmin grants access to the /_ligase/admin api
+	IsAdmin bool
+	// Locked accounts can't log in
+	Locked bool
+	// ShadowBanned accounts see their messages and invites succeed but no one
+	// else receives them
+	ShadowBanned bool
+	// TODO: Other flags like IsGuest
 	// TODO: Devices
 	// TODO: Associations (e.g. with application services)
 }
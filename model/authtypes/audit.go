@@ -0,0 +1,111 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authtypes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Types of the audit events
+const (
+	AuditLogin          = "login"
+	AuditAdminLogin     = "admin_login"
+	AuditLogout         = "logout"
+	AuditLogoutAll      = "logout_all"
+	AuditPasswordChange = "password_change"
+	AuditDeviceDelete   = "device_delete"
+	AuditRoomDismiss    = "room_dismiss"
+	AuditPowerLevels    = "power_levels"
+	AuditBan            = "ban"
+	AuditUnban          = "unban"
+	AuditKick           = "kick"
+	AuditKeyUpload      = "key_upload"
+	// an action of the /_ligase/admin api, details.action tells which
+	AuditAdminAction = "admin_action"
+)
+
+// AuditEvent is a security relevant action. Only the fields the auditors
+// need are recorded, never a token nor a password.
+type AuditEvent struct {
+	// Position in the audit log, set when it is stored
+	Seq int64 `json:"seq"`
+	// Milliseconds since the epoch
+	Ts   int64  `json:"ts"`
+	Type string `json:"type"`
+	// Who acted, and from where when it is known
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	// The user or device acted on
+	Target  string            `json:"target,omitempty"`
+	RoomID  string            `json:"room_id,omitempty"`
+	Success bool              `json:"success"`
+	Details map[string]string `json:"details,omitempty"`
+	// Hash of the previous event of the log, and of this one chained to it
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// ChainHash returns the hash of the event following the one hashed prev,
+// the sha256 of prev and of the json of the event without seq and hashes
+func (e *AuditEvent) ChainHash(prev string) string {
+	content := *e
+	content.Seq, content.PrevHash, content.Hash = 0, "", ""
+	// maps are marshalled with sorted keys, the json is stable
+	data, _ := json.Marshal(&content)
+	sum := sha256.New()
+	sum.Write([]byte(prev))
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// VerifyAuditChain checks the hash of every event, and that consecutive
+// events are chained. When the events are a contiguous part of the log, a
+// missing seq fails too. It returns the seq of the first event failing, 0 if
+// all pass.
+func VerifyAuditChain(events []AuditEvent, contiguous bool) int64 {
+	for i := range events {
+		e := &events[i]
+		if e.Hash != e.ChainHash(e.PrevHash) {
+			return e.Seq
+		}
+		if i == 0 {
+			continue
+		}
+		prev := &events[i-1]
+		if e.Seq != prev.Seq+1 {
+			if contiguous {
+				return e.Seq
+			}
+		} else if e.PrevHash != prev.Hash {
+			return e.Seq
+		}
+	}
+	return 0
+}
+
+// AuditFilter selects audit events, the empty fields match all
+type AuditFilter struct {
+	// Events after this seq
+	From   int64
+	Limit  int
+	UserID string
+	Type   string
+	// Milliseconds since the epoch, Until excluded
+	Since int64
+	Until int64
+}
@@ -23,6 +23,13 @@ const (
 	LoginTypeSharedSecret = "org.matrix.login.shared_secret"
 	LoginTypeRecaptcha    = "m.login.recaptcha"
 	LoginTypePassword     = "m.login.password"
+	LoginTypeSSO          = "m.login.sso"
+	LoginTypeCAS          = "m.login.cas"
+	LoginTypeToken        = "m.login.token"
+	LoginTypeEmail        = "m.login.email.identity"
+	LoginTypeMSISDN       = "m.login.msisdn"
+
+	LoginTypeRegistrationToken = "m.login.registration_token"
 
 	LoginTypeApplicationService = "m.login.application_service"
 )
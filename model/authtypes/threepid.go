@@ -0,0 +1,64 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authtypes
+
+const (
+	MediumEmail  = "email"
+	MediumMSISDN = "msisdn"
+)
+
+// ThreePIDSession is the validation of a third party identifier the server
+// sent a token to
+type ThreePIDSession struct {
+	SessionID    string
+	ClientSecret string
+	Medium       string
+	// A lowercase email address or the msisdn digits
+	Address     string
+	Token       string
+	SendAttempt int
+	NextLink    string
+	CreatedTs   int64
+	// Zero until the token was submitted
+	ValidatedTs int64
+}
+
+// ThreePID is a third party identifier bound to an account
+type ThreePID struct {
+	Medium      string
+	Address     string
+	UserID      string
+	ValidatedTs int64
+	AddedTs     int64
+}
+
+// RegistrationToken allows to register while registration requires a token
+type RegistrationToken struct {
+	Token string
+	// Zero means unlimited
+	UsesAllowed int
+	// Only completed registrations use the token up
+	Completed int
+	// Zero means the token never expires
+	ExpiryTs int64
+}
+
+// Valid tells if the token can still be used at now
+func (t *RegistrationToken) Valid(now int64) bool {
+	if t.ExpiryTs != 0 && t.ExpiryTs <= now {
+		return false
+	}
+	return t.UsesAllowed == 0 || t.Completed < t.UsesAllowed
+}
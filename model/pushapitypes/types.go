@@ -304,6 +304,39 @@ type Tweaks struct {
 	HighLight bool   `json:"highlight,omitempty"`
 }
 
+// GatewayNotify is the body of a push gateway /_matrix/push/v1/notify request.
+type GatewayNotify struct {
+	Notification GatewayNotification `json:"notification"`
+}
+
+type GatewayNotification struct {
+	EventId           string          `json:"event_id,omitempty"`
+	RoomId            string          `json:"room_id,omitempty"`
+	Type              string          `json:"type,omitempty"`
+	Sender            string          `json:"sender,omitempty"`
+	SenderDisplayName string          `json:"sender_display_name,omitempty"`
+	RoomName          string          `json:"room_name,omitempty"`
+	RoomAlias         string          `json:"room_alias,omitempty"`
+	UserIsTarget      bool            `json:"user_is_target,omitempty"`
+	Priority          string          `json:"prio,omitempty"`
+	Content           interface{}     `json:"content,omitempty"`
+	Counts            GatewayCounts   `json:"counts"`
+	Devices           []GatewayDevice `json:"devices"`
+}
+
+type GatewayCounts struct {
+	UnRead      int64 `json:"unread"`
+	MissedCalls int64 `json:"missed_calls,omitempty"`
+}
+
+type GatewayDevice struct {
+	AppId     string      `json:"app_id"`
+	PushKey   string      `json:"pushkey"`
+	PushKeyTs int64       `json:"pushkey_ts,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Tweaks    *Tweaks     `json:"tweaks,omitempty"`
+}
+
 type PushAck struct {
 	Rejected []string `json:"rejected,omitempty"`
 }
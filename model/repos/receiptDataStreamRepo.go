@@ -400,3 +400,14 @@ func (tl *ReceiptDataStreamRepo) flush(ctx context.Context) {
 	})
 	log.Infof("ReceiptDataStreamRepo finished flush")
 }
+
+// Evict drops the cached receipts of the room, it returns false if some are
+// not flushed to the db yet
+func (tl *ReceiptDataStreamRepo) Evict(roomID string) bool {
+	if _, ok := tl.updatedRoom.Load(roomID); ok {
+		return false
+	}
+	tl.container.Delete(roomID)
+	tl.ready.Delete(roomID)
+	return true
+}
@@ -385,3 +385,21 @@ func (tl *RoomHistoryTimeLineRepo) LoadRoomLatest(ctx context.Context, rooms []s
 	}
 	return nil
 }
+
+// Evict drops the cached timeline of the room, it is loaded from the db again
+// on the next read. Used after part of the room history was purged.
+func (tl *RoomHistoryTimeLineRepo) Evict(roomID string) {
+	tl.repo.remove(roomID)
+	tl.ready.Delete(roomID)
+	tl.roomMinStream.Delete(roomID)
+}
+
+// LoadedRooms returns the rooms whose history is loaded
+func (tl *RoomHistoryTimeLineRepo) LoadedRooms() []string {
+	var rooms []string
+	tl.ready.Range(func(key, _ interface{}) bool {
+		rooms = append(rooms, key.(string))
+		return true
+	})
+	return rooms
+}
@@ -381,3 +381,11 @@ func (tl *RoomStateTimeLineRepo) GetStateEvents(ctx context.Context, roomID stri
 
 	return streamEvs, events
 }
+
+// Evict drops the cached states of the room, they are loaded from the db
+// again on the next read
+func (tl *RoomStateTimeLineRepo) Evict(roomID string) {
+	tl.repo.remove(roomID)
+	tl.stateReady.Delete(roomID)
+	tl.RemoveStateStreams(roomID)
+}
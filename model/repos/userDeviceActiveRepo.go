@@ -17,6 +17,8 @@ package repos
 import (
 	"context"
 	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/model/types"
 	"github.com/finogeeks/ligase/skunkworks/log"
 	"github.com/finogeeks/ligase/storage/model"
 	"sync"
@@ -24,8 +26,13 @@ import (
 )
 
 type DeviceInfo struct {
-	ts  int64
 	did string
+
+	// requests update the last seen while the flush reads it
+	mu        sync.Mutex
+	ts        int64
+	ip        string
+	userAgent string
 }
 
 type UserDev struct {
@@ -35,6 +42,7 @@ type UserDev struct {
 
 type UserDeviceActiveRepo struct {
 	persist    model.DeviceDatabase
+	cache      service.Cache
 	userDevMap sync.Map
 	timer      time.Timer
 	flushDB    bool
@@ -48,9 +56,7 @@ func NewUserDeviceActiveRepo(
 	uda := new(UserDeviceActiveRepo)
 	uda.flushDB = flushDB
 	uda.delay = delay
-	if flushDB {
-		uda.startFlush()
-	}
+	uda.startFlush()
 	return uda
 }
 
@@ -58,6 +64,12 @@ func (uda *UserDeviceActiveRepo) SetPersist(db model.DeviceDatabase) {
 	uda.persist = db
 }
 
+// SetCache makes the repo publish the last ip and user agent of the devices,
+// they are read back by the admin whois api
+func (uda *UserDeviceActiveRepo) SetCache(cache service.Cache) {
+	uda.cache = cache
+}
+
 func (uda *UserDeviceActiveRepo) startFlush() error {
 	go func() {
 		t := time.NewTimer(time.Millisecond * time.Duration(uda.delay))
@@ -78,25 +90,21 @@ func (uda *UserDeviceActiveRepo) startFlush() error {
 }
 
 func (uda *UserDeviceActiveRepo) UpdateDevActiveTs(uid, devId string) {
-	var userDev *UserDev
-	var devInfo *DeviceInfo
-	if val, ok := uda.userDevMap.Load(uid); ok {
-		userDev = val.(*UserDev)
-	} else {
-		userDev = new(UserDev)
-		userDev.uid = uid
-		uda.userDevMap.Store(uid, userDev)
-	}
+	uda.UpdateDevLastSeen(uid, devId, "", "")
+}
 
-	if val, ok := userDev.devMap.Load(devId); ok {
-		devInfo = val.(*DeviceInfo)
-		devInfo.ts = time.Now().UnixNano() / 1000000
-	} else {
-		devInfo = new(DeviceInfo)
-		devInfo.did = devId
-		devInfo.ts = time.Now().UnixNano() / 1000000
-		userDev.devMap.Store(devId, devInfo)
+func (uda *UserDeviceActiveRepo) UpdateDevLastSeen(uid, devId, ip, userAgent string) {
+	val, _ := uda.userDevMap.LoadOrStore(uid, &UserDev{uid: uid})
+	userDev := val.(*UserDev)
+	val, _ = userDev.devMap.LoadOrStore(devId, &DeviceInfo{did: devId})
+	devInfo := val.(*DeviceInfo)
+	devInfo.mu.Lock()
+	devInfo.ts = time.Now().UnixNano() / 1000000
+	if ip != "" {
+		devInfo.ip = ip
+		devInfo.userAgent = userAgent
 	}
+	devInfo.mu.Unlock()
 }
 
 func (uda *UserDeviceActiveRepo) flush(ctx context.Context) {
@@ -116,11 +124,28 @@ func (uda *UserDeviceActiveRepo) flushToDB(ctx context.Context, userDev *UserDev
 	}
 	userDev.devMap.Range(func(key, value interface{}) bool {
 		devInfo := value.(*DeviceInfo)
-		err := uda.persist.UpdateDeviceActiveTs(ctx, devInfo.did, userDev.uid, devInfo.ts)
-		if err != nil {
-			log.Errorw("UserDeviceActiveRepo flushToDB could not update device last_active_ts", log.KeysAndValues{
-				"deviceID", devInfo.did, "userID", userDev.uid, "error", err,
+		devInfo.mu.Lock()
+		ts, ip, userAgent := devInfo.ts, devInfo.ip, devInfo.userAgent
+		devInfo.mu.Unlock()
+		if uda.flushDB {
+			err := uda.persist.UpdateDeviceActiveTs(ctx, devInfo.did, userDev.uid, ts)
+			if err != nil {
+				log.Errorw("UserDeviceActiveRepo flushToDB could not update device last_active_ts", log.KeysAndValues{
+					"deviceID", devInfo.did, "userID", userDev.uid, "error", err,
+				})
+			}
+		}
+		if uda.cache != nil && ip != "" {
+			err := uda.cache.SetDeviceLastSeen(userDev.uid, devInfo.did, &types.DeviceLastSeen{
+				IP:        ip,
+				UserAgent: userAgent,
+				Ts:        ts,
 			})
+			if err != nil {
+				log.Errorw("UserDeviceActiveRepo flushToDB could not update device last seen", log.KeysAndValues{
+					"deviceID", devInfo.did, "userID", userDev.uid, "error", err,
+				})
+			}
 		}
 		userDev.devMap.Delete(key)
 		return true
@@ -479,6 +479,25 @@ func (tl *UserTimeLineRepo) UpdateRoomOffset(roomID string, offset int64){
 	}
 }
 
+// ResetRoomOffset reloads the latest offset of a room whose history was purged
+func (tl *UserTimeLineRepo) ResetRoomOffset(ctx context.Context, roomID string) error {
+	if _, ok := tl.roomOffsets.Load(roomID); !ok {
+		return nil
+	}
+	roomMap, err := tl.persist.GetRoomLastOffsets(ctx, []string{roomID})
+	if err != nil {
+		return err
+	}
+	tl.roomMutex.Lock()
+	defer tl.roomMutex.Unlock()
+	if offset, ok := roomMap[roomID]; ok {
+		tl.roomOffsets.Store(roomID, offset)
+	} else {
+		tl.roomOffsets.Delete(roomID)
+	}
+	return nil
+}
+
 func (tl *UserTimeLineRepo) GetRoomOffset(roomID, user, membership string) int64 {
 	switch membership {
 	case "invite", "leave":
@@ -50,3 +50,28 @@ type RoomNIDs struct {
 	RoomID  string
 	RoomNID int64
 }
+
+// EventReport is a report of an event made by a member of its room.
+type EventReport struct {
+	ID      int64
+	RoomID  string
+	EventID string
+	// UserID made the report, Sender sent the event
+	UserID     string
+	Sender     string
+	Reason     string
+	Score      *int64
+	EventJSON  []byte
+	ReceivedTs int64
+	Resolved   bool
+	ResolvedBy string
+	ResolvedTs int64
+	Note       string
+}
+
+// EventReportFilter selects event reports, empty fields match everything.
+type EventReportFilter struct {
+	RoomID   string
+	UserID   string
+	Resolved *bool
+}
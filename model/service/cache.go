@@ -17,13 +17,14 @@ package service
 import (
 	"sync"
 
+	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/model/authtypes"
 	"github.com/finogeeks/ligase/model/pushapitypes"
 	"github.com/finogeeks/ligase/model/types"
 )
 
 type Cache interface {
-	Prepare(cfg []string) (err error)
+	Prepare(cfg config.RedisConf) (err error)
 
 	GetMigTokenByToken(token string) (string, error)
 
@@ -152,6 +153,44 @@ type Cache interface {
 	GetRoomStateExt(roomID string) (*types.RoomStateExt, error)
 	UpdateRoomStateExt(roomID string, ext map[string]interface{}) error
 	SetRoomStateExt(roomID string, roomstateExt *types.RoomStateExt) error
+	DelRoomState(roomID string) error
+
+	//admin room
+	SetRoomBlocked(roomID, userID string) error
+	DelRoomBlocked(roomID string) error
+	GetRoomBlocked(roomID string) (string, error)
+	SetPurgeHistoryStatus(purgeID string, status interface{}, expire int64) error
+	GetPurgeHistoryStatus(purgeID string) ([]byte, error)
+
+	//admin user
+	SetUserShadowBanned(userID string) error
+	DelUserShadowBanned(userID string) error
+	GetUserShadowBanned(userID string) (bool, error)
+
+	//device last seen
+	SetDeviceLastSeen(userID, deviceID string, lastSeen *types.DeviceLastSeen) error
+	GetDevicesLastSeen(userID string) (map[string]*types.DeviceLastSeen, error)
+	DelDeviceLastSeen(userID, deviceID string) error
+
+	//refresh token
+	SetRefreshToken(token string, dev *authtypes.Device, expire int64) error
+	TakeRefreshToken(token string) (*authtypes.Device, error)
+	DelDeviceRefreshToken(userID, deviceID string) error
+	DelUserRefreshTokens(userID string) error
+
+	//openid token
+	SetOpenIDToken(token, userID string, expire int64) error
+	GetOpenIDToken(token string) (string, error)
+
+	//sso login token
+	SetLoginToken(token, userID string, expire int64) error
+	TakeLoginToken(token string) (string, error)
+	AddSAMLRequest(id string, expire int64) error
+	TakeSAMLRequest(id string) (bool, error)
+	AddSAMLAssertion(id string, expire int64) (bool, error)
+
+	//ratelimit
+	TakeRateLimitToken(key string, perSecond float64, burst int) (int64, error)
 
 	//distlock
 	Lock(lockKey string, expire, wait int) (lockToken string, err error)
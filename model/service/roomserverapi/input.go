@@ -38,6 +38,10 @@ const (
 	// KindBackfill event extend the contiguous graph going backwards.
 	// They always have state.
 	KindBackfill = 3
+	// KindImport event is history imported from another homeserver, e.g.
+	// by cmd/migrate. It is applied like KindNew but never sent over
+	// federation.
+	KindImport = 4
 )
 
 // DoNotSendToOtherServers tells us not to send the event to other matrix
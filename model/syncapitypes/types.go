@@ -386,3 +386,18 @@ func (es ClientEvents) Less(i, j int) bool {
 }
 
 func (es ClientEvents) Swap(i, j int) { es[i], es[j] = es[j], es[i] }
+
+// LegalHold keeps the history of a room, or everything a user sent, from
+// being deleted or overwritten. Target is a room or a user ID.
+type LegalHold struct {
+	Target    string `json:"target"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedBy string `json:"created_by"`
+	CreatedTs int64  `json:"created_ts"`
+}
+
+// ExportEvent is an event of a room history export with its stream position
+type ExportEvent struct {
+	Offset int64
+	Event  gomatrixserverlib.ClientEvent
+}
@@ -44,6 +44,9 @@ var DeviceStateUpdateDef = "sync-device-state-update-topic"
 var VerifyTokenTopicDef = "proxy-verify-token-topic"
 var PresenceTopicDef = "sync-presence-topic"
 var RCSEventTopicDef = "rcs-event-topic"
+var RoomHistoryPurgeTopicDef = "sync-room-history-purge-topic"
+var SyncServerMembershipTopicDef = "sync-server-membership-topic"
+var SyncServerHandoffTopicDef = "sync-server-handoff-topic"
 
 const (
 	//proxy -> front
@@ -60,6 +63,7 @@ const (
 	ROOMINPUT_RPC_GROUP  = "roominputrpc"
 	ROOOMALIAS_RPC_GROUP = "roomaliasrpc"
 	ROOMQRY_PRC_GROUP    = "roomqryrpc"
+	APPSERVICE_RPC_GROUP = "appservicerpc"
 )
 
 //dist_lock prefix
@@ -67,6 +71,7 @@ const (
 	LOCK_INSTANCE_PREFIX      = "dist_lock_instance:"
 	LOCK_ROOMSTATE_PREFIX     = "dist_lock_roomstate:"
 	LOCK_ROOMSTATE_EXT_PREFIX = "dist_lock_roomstate_ext:"
+	LOCK_RETENTION_PURGE      = "dist_lock_retention_purge"
 )
 
 const (
@@ -141,6 +146,12 @@ type TypingContent struct {
 	UserID string `json:"user_id,omitempty"`
 }
 
+// RoomHistoryPurgeContent tells the sync servers to drop the cached timeline
+// of a room after part of its history was purged
+type RoomHistoryPurgeContent struct {
+	RoomID string `json:"room_id"`
+}
+
 type SysManageContent struct {
 	Type  string `json:"type,omitempty"`
 	Reply string
@@ -399,6 +410,13 @@ type LoginInfoContent struct {
 	Identifier  string `json:"identifier,omitempty"`
 }
 
+// DeviceLastSeen is the last connection the proxy saw from a device
+type DeviceLastSeen struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Ts        int64  `json:"ts"`
+}
+
 type FilterTokenContent struct {
 	UserID     string `json:"user_id,omitempty"`
 	DeviceID   string `json:"device_id,omitempty"`
@@ -228,6 +228,24 @@ func (c *KafkaChannel) Close() {
 	}
 }
 
+// Ping asks the brokers for the metadata of the default topic
+func (c *KafkaChannel) Ping(ctx context.Context) error {
+	timeout := DefaultTimeOut * 1000
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = int(time.Until(deadline) / time.Millisecond)
+	}
+	var err error
+	switch {
+	case c.producer != nil:
+		_, err = c.producer.GetMetadata(&c.topic, false, timeout)
+	case c.consumer != nil:
+		_, err = c.consumer.GetMetadata(&c.topic, false, timeout)
+	default:
+		err = errors.New("kafka channel is not started")
+	}
+	return err
+}
+
 func (c *KafkaChannel) Commit(rawMsgs []interface{}) error {
 	if rawMsgs == nil || len(rawMsgs) == 0 || c.consumer == nil {
 		return nil
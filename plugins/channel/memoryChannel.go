@@ -0,0 +1,173 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package channel
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/core"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/nats-io/go-nats"
+)
+
+// MemoryChannel is a channel of the memory transport. A consumer group is a
+// queue group of the bus, so each group gets every message once, in the
+// order it was sent.
+type MemoryChannel struct {
+	start   bool
+	logPorf bool
+	dir     int
+	id      string
+	topic   string
+	grp     string
+	handler core.IChannelConsumer
+	bus     *common.LocalBus
+	sub     common.Subscription
+}
+
+func init() {
+	core.RegisterChannel("memory", NewMemoryChannel)
+}
+
+func NewMemoryChannel(conf interface{}) (core.IChannel, error) {
+	k := new(MemoryChannel)
+	return k, nil
+}
+
+func (c *MemoryChannel) Init(logPorf bool) {
+	c.start = false
+	c.logPorf = logPorf
+}
+
+func (c *MemoryChannel) SetTopic(topic string) {
+	c.topic = topic
+}
+
+func (c *MemoryChannel) SetGroup(group string) {
+	c.grp = group
+}
+
+func (c *MemoryChannel) SetID(id string) {
+	c.id = id
+}
+
+func (c *MemoryChannel) GetID() string {
+	return c.id
+}
+
+func (c *MemoryChannel) SetDir(dir int) {
+	c.dir = dir
+}
+
+func (c *MemoryChannel) GetDir() int {
+	return c.dir
+}
+
+func (c *MemoryChannel) SetHandler(handler core.IChannelConsumer) {
+	c.handler = handler
+}
+
+func (c *MemoryChannel) SetBus(bus *common.LocalBus) {
+	c.bus = bus
+}
+
+func (c *MemoryChannel) PreStart(broker string, statsInterval int) {
+	if c.bus == nil {
+		log.Fatalf("MemoryTransport: channel %s has no bus", c.id)
+	}
+}
+
+func (c *MemoryChannel) Start() {
+	if c.start == false {
+		c.start = true
+		if c.dir == core.CHANNEL_SUB {
+			c.sub, _ = c.bus.QueueSubscribe(c.topic, c.grp, c.cb)
+		}
+	}
+}
+
+func (c *MemoryChannel) Stop() {
+	c.start = false
+	if c.sub != nil {
+		c.sub.Unsubscribe()
+		c.sub = nil
+	}
+}
+
+func (c *MemoryChannel) Close() {
+	c.Stop()
+}
+
+func (c *MemoryChannel) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *MemoryChannel) Commit(rawMsg []interface{}) error {
+	return nil
+}
+
+func (c *MemoryChannel) Send(topic string, partition int32, keys, bytes []byte, headers map[string]string) error {
+	if c.start == false {
+		return errors.New("memory producer not start yet")
+	}
+	if topic == "" {
+		topic = c.topic
+	}
+	return c.bus.Publish(topic, common.WrapNatsData(headers, bytes))
+}
+
+// SendAndRecv returns once the message is queued to the consumers, there is
+// no broker to wait for
+func (c *MemoryChannel) SendAndRecv(topic string, partition int32, keys, bytes []byte, headers map[string]string) error {
+	return c.Send(topic, partition, keys, bytes, headers)
+}
+
+func (c *MemoryChannel) SendWithRetry(topic string, partition int32, keys, bytes []byte, headers map[string]string) error {
+	return c.Send(topic, partition, keys, bytes, headers)
+}
+
+func (c *MemoryChannel) SendAndRecvWithRetry(topic string, partition int32, keys, bytes []byte, headers map[string]string) error {
+	return c.Send(topic, partition, keys, bytes, headers)
+}
+
+func (c *MemoryChannel) SendRecv(topic string, bytes []byte, timeout int, headers map[string]string) ([]byte, error) {
+	if topic == "" {
+		topic = c.topic
+	}
+	msg, err := c.bus.Request(topic, common.WrapNatsData(headers, bytes), time.Duration(timeout)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+func (c *MemoryChannel) cb(msg *nats.Msg) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.Errorf("channel consumer panic: %#v", e)
+		}
+	}()
+	data, header := common.ParseNatsData(msg.Data)
+	if header != nil {
+		msg.Data = data
+	}
+	span := common.StartSpanFromMsgAfterReceived(msg.Subject, header)
+	defer span.Finish()
+	ctx := common.ContextWithSpan(context.Background(), span)
+	c.handler.OnMessage(ctx, msg.Subject, -1, msg.Data, msg)
+}
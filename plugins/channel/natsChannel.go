@@ -17,9 +17,7 @@ package channel
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/finogeeks/ligase/common"
-	"github.com/opentracing/opentracing-go"
 	"time"
 
 	"github.com/finogeeks/ligase/core"
@@ -106,9 +104,9 @@ func (c *NatsChannel) Start() {
 		c.start = true
 		if c.dir == core.CHANNEL_SUB {
 			if c.grp != "" {
-				c.sub, _ = c.conn.QueueSubscribe(c.topic, c.grp, common.NatsWrapHandler(c.cb))
+				c.sub, _ = c.conn.QueueSubscribe(c.topic, c.grp, c.cb)
 			} else {
-				c.sub, _ = c.conn.Subscribe(c.topic, common.NatsWrapHandler(c.cb))
+				c.sub, _ = c.conn.Subscribe(c.topic, c.cb)
 			}
 		}
 	}
@@ -126,6 +124,13 @@ func (c *NatsChannel) Close() {
 	c.conn.Close()
 }
 
+func (c *NatsChannel) Ping(ctx context.Context) error {
+	if c.conn == nil || !c.conn.IsConnected() {
+		return errors.New("nats is not connected")
+	}
+	return nil
+}
+
 func (c *NatsChannel) Commit(rawMsg []interface{}) error {
 	return nil
 }
@@ -135,7 +140,7 @@ func (c *NatsChannel) Send(topic string, partition int32, keys, bytes []byte, he
 		topic = c.topic
 	}
 
-	err := c.conn.Publish(topic, bytes)
+	err := c.conn.Publish(topic, common.WrapNatsData(headers, bytes))
 	if err != nil {
 		log.Errorf("Nats pub fail, topic:%s", topic)
 	}
@@ -147,7 +152,7 @@ func (c *NatsChannel) SendRecv(topic string, bytes []byte, timeout int, headers
 		topic = c.topic
 	}
 
-	msg, err := c.conn.Request(topic, bytes, time.Duration(timeout)*time.Millisecond)
+	msg, err := c.conn.Request(topic, common.WrapNatsData(headers, bytes), time.Duration(timeout)*time.Millisecond)
 
 	if err != nil {
 		return nil, err
@@ -157,11 +162,12 @@ func (c *NatsChannel) SendRecv(topic string, bytes []byte, timeout int, headers
 }
 
 func (c *NatsChannel) cb(msg *nats.Msg) {
-	nowStr := fmt.Sprintf("%d", time.Now().UnixNano()/1e6)
-	span := opentracing.StartSpan(msg.Subject)
+	data, header := common.ParseNatsData(msg.Data)
+	if header != nil {
+		msg.Data = data
+	}
+	span := common.StartSpanFromMsgAfterReceived(msg.Subject, header)
 	defer span.Finish()
-	span.SetBaggageItem("sob", nowStr)
-	span.SetBaggageItem("som", nowStr)
 	ctx := common.ContextWithSpan(context.Background(), span)
 	c.handler.OnMessage(ctx, msg.Subject, -1, msg.Data, msg)
 }
@@ -28,8 +28,10 @@ type ThirdPartyIdentifier struct {
 
 // ThreePID represents a third-party identifier
 type ThreePID struct {
-	Address string `json:"address"`
-	Medium  string `json:"medium"`
+	Address     string `json:"address"`
+	Medium      string `json:"medium"`
+	ValidatedAt int64  `json:"validated_at,omitempty"`
+	AddedAt     int64  `json:"added_at,omitempty"`
 }
 
 type GetThreePIDsResponse struct {
@@ -40,6 +42,8 @@ type GetThreePIDsResponse struct {
 type PostAccount3PIDRequest struct {
 	ThreePIDCreds ThreePidCredentials `json:"three_pid_creds"`
 	Bind          bool                `json:"bind"`
+	// r0.2 name of three_pid_creds
+	ThreePIDCredsOld ThreePidCredentials `json:"threePidCreds"`
 }
 
 type ThreePidCredentials struct {
@@ -83,6 +87,22 @@ type PostAccount3PIDMsisdnRequest struct {
 
 type PostAccount3PIDMsisdnResponse struct {
 	Sid string `json:"sid"`
+	// The client posts the code it received there
+	SubmitURL string `json:"submit_url,omitempty"`
+}
+
+// POST /_matrix/client/r0/{register|account/3pid}/{email|msisdn}/submitToken
+type Post3PIDSubmitTokenRequest struct {
+	Medium       string `json:"medium"`
+	Sid          string `json:"sid"`
+	ClientSecret string `json:"client_secret"`
+	Token        string `json:"token"`
+	// the email link was followed, send the browser on to next_link
+	Redirect bool `json:"redirect,omitempty"`
+}
+
+type Post3PIDSubmitTokenResponse struct {
+	Success bool `json:"success"`
 }
 
 // GET /_matrix/client/r0/account/whoami
@@ -710,12 +710,12 @@ type PostAccount3PIDMsisdnResponseCapn struct{ capnp.Struct }
 const PostAccount3PIDMsisdnResponseCapn_TypeID = 0xc8a9640b58c1a854
 
 func NewPostAccount3PIDMsisdnResponseCapn(s *capnp.Segment) (PostAccount3PIDMsisdnResponseCapn, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 1})
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 2})
 	return PostAccount3PIDMsisdnResponseCapn{st}, err
 }
 
 func NewRootPostAccount3PIDMsisdnResponseCapn(s *capnp.Segment) (PostAccount3PIDMsisdnResponseCapn, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 1})
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 2})
 	return PostAccount3PIDMsisdnResponseCapn{st}, err
 }
 
@@ -748,12 +748,31 @@ func (s PostAccount3PIDMsisdnResponseCapn) SetSid(v string) error {
 	return s.Struct.SetText(0, v)
 }
 
+func (s PostAccount3PIDMsisdnResponseCapn) SubmitURL() (string, error) {
+	p, err := s.Struct.Ptr(1)
+	return p.Text(), err
+}
+
+func (s PostAccount3PIDMsisdnResponseCapn) HasSubmitURL() bool {
+	p, err := s.Struct.Ptr(1)
+	return p.IsValid() || err != nil
+}
+
+func (s PostAccount3PIDMsisdnResponseCapn) SubmitURLBytes() ([]byte, error) {
+	p, err := s.Struct.Ptr(1)
+	return p.TextBytes(), err
+}
+
+func (s PostAccount3PIDMsisdnResponseCapn) SetSubmitURL(v string) error {
+	return s.Struct.SetText(1, v)
+}
+
 // PostAccount3PIDMsisdnResponseCapn_List is a list of PostAccount3PIDMsisdnResponseCapn.
 type PostAccount3PIDMsisdnResponseCapn_List struct{ capnp.List }
 
 // NewPostAccount3PIDMsisdnResponseCapn creates a new list of PostAccount3PIDMsisdnResponseCapn.
 func NewPostAccount3PIDMsisdnResponseCapn_List(s *capnp.Segment, sz int32) (PostAccount3PIDMsisdnResponseCapn_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 0, PointerCount: 1}, sz)
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 0, PointerCount: 2}, sz)
 	return PostAccount3PIDMsisdnResponseCapn_List{l}, err
 }
 
@@ -784,12 +803,12 @@ type PostAccount3PIDRequestCapn struct{ capnp.Struct }
 const PostAccount3PIDRequestCapn_TypeID = 0x9cac11bd6cf7b473
 
 func NewPostAccount3PIDRequestCapn(s *capnp.Segment) (PostAccount3PIDRequestCapn, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 1})
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2})
 	return PostAccount3PIDRequestCapn{st}, err
 }
 
 func NewRootPostAccount3PIDRequestCapn(s *capnp.Segment) (PostAccount3PIDRequestCapn, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 1})
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2})
 	return PostAccount3PIDRequestCapn{st}, err
 }
 
@@ -836,12 +855,37 @@ func (s PostAccount3PIDRequestCapn) SetBind(v bool) {
 	s.Struct.SetBit(0, v)
 }
 
+func (s PostAccount3PIDRequestCapn) ThreePIDCredsOld() (ThreePidCredentialsCapn, error) {
+	p, err := s.Struct.Ptr(1)
+	return ThreePidCredentialsCapn{Struct: p.Struct()}, err
+}
+
+func (s PostAccount3PIDRequestCapn) HasThreePIDCredsOld() bool {
+	p, err := s.Struct.Ptr(1)
+	return p.IsValid() || err != nil
+}
+
+func (s PostAccount3PIDRequestCapn) SetThreePIDCredsOld(v ThreePidCredentialsCapn) error {
+	return s.Struct.SetPtr(1, v.Struct.ToPtr())
+}
+
+// NewThreePIDCredsOld sets the threePIDCredsOld field to a newly
+// allocated ThreePidCredentialsCapn struct, preferring placement in s's segment.
+func (s PostAccount3PIDRequestCapn) NewThreePIDCredsOld() (ThreePidCredentialsCapn, error) {
+	ss, err := NewThreePidCredentialsCapn(s.Struct.Segment())
+	if err != nil {
+		return ThreePidCredentialsCapn{}, err
+	}
+	err = s.Struct.SetPtr(1, ss.Struct.ToPtr())
+	return ss, err
+}
+
 // PostAccount3PIDRequestCapn_List is a list of PostAccount3PIDRequestCapn.
 type PostAccount3PIDRequestCapn_List struct{ capnp.List }
 
 // NewPostAccount3PIDRequestCapn creates a new list of PostAccount3PIDRequestCapn.
 func NewPostAccount3PIDRequestCapn_List(s *capnp.Segment, sz int32) (PostAccount3PIDRequestCapn_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 8, PointerCount: 1}, sz)
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 8, PointerCount: 2}, sz)
 	return PostAccount3PIDRequestCapn_List{l}, err
 }
 
@@ -870,6 +914,10 @@ func (p PostAccount3PIDRequestCapn_Promise) ThreePIDCreds() ThreePidCredentialsC
 	return ThreePidCredentialsCapn_Promise{Pipeline: p.Pipeline.GetPipeline(0)}
 }
 
+func (p PostAccount3PIDRequestCapn_Promise) ThreePIDCredsOld() ThreePidCredentialsCapn_Promise {
+	return ThreePidCredentialsCapn_Promise{Pipeline: p.Pipeline.GetPipeline(1)}
+}
+
 type ThirdPartyIdentifierCapn struct{ capnp.Struct }
 
 // ThirdPartyIdentifierCapn_TypeID is the unique identifier for the type ThirdPartyIdentifierCapn.
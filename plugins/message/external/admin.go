@@ -0,0 +1,301 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+import (
+	jsonRaw "encoding/json"
+)
+
+// POST /_ligase/admin/v1/rooms/{roomID}/shutdown
+type PostAdminRoomShutdownRequest struct {
+	RoomID string `json:"room_id"`
+	// local user that creates the notice room, no notice room if empty
+	NewRoomUserID string `json:"new_room_user_id,omitempty"`
+	RoomName      string `json:"room_name,omitempty"`
+	Message       string `json:"message,omitempty"`
+	// defaults to true
+	Block *bool `json:"block,omitempty"`
+}
+
+type PostAdminRoomShutdownResponse struct {
+	KickedUsers       []string `json:"kicked_users"`
+	FailedToKickUsers []string `json:"failed_to_kick_users"`
+	LocalAliases      []string `json:"local_aliases"`
+	NewRoomID         string   `json:"new_room_id,omitempty"`
+}
+
+// POST /_ligase/admin/v1/rooms/{roomID}/purge_history
+type PostAdminRoomPurgeHistoryRequest struct {
+	RoomID         string `json:"room_id"`
+	PurgeUpToTs    int64  `json:"purge_up_to_ts,omitempty"`
+	PurgeUpToEvent string `json:"purge_up_to_event_id,omitempty"`
+}
+
+type PostAdminRoomPurgeHistoryResponse struct {
+	PurgeID string `json:"purge_id"`
+}
+
+// GET /_ligase/admin/v1/rooms/{roomID}/purge_history/{purgeID}
+type GetAdminRoomPurgeStatusRequest struct {
+	RoomID  string `json:"room_id"`
+	PurgeID string `json:"purge_id"`
+}
+
+type GetAdminRoomPurgeStatusResponse struct {
+	RoomID        string `json:"room_id"`
+	Status        string `json:"status"`
+	DeletedEvents int64  `json:"deleted_events"`
+	Error         string `json:"error,omitempty"`
+	// last refreshed by the server running the purge, in milliseconds
+	UpdatedTs int64 `json:"updated_ts"`
+}
+
+// POST /_ligase/admin/v1/rooms/{roomID}/block
+// POST /_ligase/admin/v1/rooms/{roomID}/unblock
+// GET /_ligase/admin/v1/rooms/{roomID}/block
+type AdminRoomBlockRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+type AdminRoomBlockResponse struct {
+	Block bool   `json:"block"`
+	User  string `json:"user_id,omitempty"`
+}
+
+// GET /_ligase/admin/v1/users
+type GetAdminUsersRequest struct {
+	// matched against the user id and the display name
+	Search string `json:"search,omitempty"`
+	From   int    `json:"from,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type GetAdminUsersResponse struct {
+	Users     []AdminUserInfo `json:"users"`
+	Total     int             `json:"total"`
+	NextToken string          `json:"next_token,omitempty"`
+}
+
+// GET /_ligase/admin/v1/users/{userID}
+type AdminUserInfo struct {
+	UserID       string `json:"user_id"`
+	DisplayName  string `json:"displayname,omitempty"`
+	AvatarURL    string `json:"avatar_url,omitempty"`
+	CreationTs   int64  `json:"creation_ts"`
+	AppServiceID string `json:"appservice_id,omitempty"`
+	Admin        bool   `json:"admin"`
+	Locked       bool   `json:"locked"`
+	ShadowBanned bool   `json:"shadow_banned"`
+}
+
+// GET /_ligase/admin/v1/users/{userID}
+// POST /_ligase/admin/v1/users/{userID}/lock
+// POST /_ligase/admin/v1/users/{userID}/unlock
+// POST /_ligase/admin/v1/users/{userID}/logout
+type AdminUserRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// POST /_ligase/admin/v1/users/{userID}/reset_password
+type PostAdminUserResetPasswordRequest struct {
+	UserID      string `json:"user_id"`
+	NewPassword string `json:"new_password"`
+	// defaults to true
+	LogoutDevices *bool `json:"logout_devices,omitempty"`
+}
+
+// PUT /_ligase/admin/v1/users/{userID}/admin
+type PutAdminUserAdminRequest struct {
+	UserID string `json:"user_id"`
+	Admin  bool   `json:"admin"`
+}
+
+// PUT /_ligase/admin/v1/users/{userID}/shadow_ban
+type PutAdminUserShadowBanRequest struct {
+	UserID       string `json:"user_id"`
+	ShadowBanned bool   `json:"shadow_banned"`
+}
+
+// GET /_ligase/admin/v1/event_reports
+type GetAdminEventReportsRequest struct {
+	From   int    `json:"from,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	RoomID string `json:"room_id,omitempty"`
+	// the reporter
+	UserID string `json:"user_id,omitempty"`
+	// "true", "false" or empty for all reports
+	Resolved string `json:"resolved,omitempty"`
+}
+
+type GetAdminEventReportsResponse struct {
+	EventReports []EventReportInfo `json:"event_reports"`
+	Total        int               `json:"total"`
+	NextToken    string            `json:"next_token,omitempty"`
+}
+
+type EventReportInfo struct {
+	ID         int64  `json:"id"`
+	RoomID     string `json:"room_id"`
+	EventID    string `json:"event_id"`
+	UserID     string `json:"user_id"`
+	Sender     string `json:"sender"`
+	Reason     string `json:"reason"`
+	Score      *int64 `json:"score,omitempty"`
+	ReceivedTs int64  `json:"received_ts"`
+	Resolved   bool   `json:"resolved"`
+	ResolvedBy string `json:"resolved_by,omitempty"`
+	ResolvedTs int64  `json:"resolved_ts,omitempty"`
+	Note       string `json:"note,omitempty"`
+	// only filled in the details of one report
+	EventJSON jsonRaw.RawMessage `json:"event_json,omitempty"`
+}
+
+// GET /_ligase/admin/v1/event_reports/{reportID}
+type AdminEventReportRequest struct {
+	ReportID int64 `json:"report_id"`
+}
+
+// POST /_ligase/admin/v1/event_reports/{reportID}/resolve
+type PostAdminEventReportResolveRequest struct {
+	ReportID int64 `json:"report_id"`
+	// defaults to true, false reopens the report
+	Resolved *bool `json:"resolved,omitempty"`
+}
+
+// PUT /_ligase/admin/v1/event_reports/{reportID}/note
+type PutAdminEventReportNoteRequest struct {
+	ReportID int64  `json:"report_id"`
+	Note     string `json:"note"`
+}
+
+// GET /_ligase/admin/v1/rooms/{roomID}/export
+type GetAdminRoomExportRequest struct {
+	RoomID string `json:"room_id"`
+	// the events sent in [from_ts, to_ts), to_ts defaults to now
+	FromTs int64 `json:"from_ts,omitempty"`
+	ToTs   int64 `json:"to_ts,omitempty"`
+	// next_token of the previous page
+	From  string `json:"from,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// One page of a room export, signed by the server key
+type GetAdminRoomExportResponse struct {
+	RoomID     string               `json:"room_id"`
+	FromTs     int64                `json:"from_ts"`
+	ToTs       int64                `json:"to_ts"`
+	ExportedTs int64                `json:"exported_ts"`
+	Count      int                  `json:"count"`
+	Events     []jsonRaw.RawMessage `json:"events"`
+	NextToken  string               `json:"next_token,omitempty"`
+	// server name -> key id -> signature
+	Signatures map[string]map[string]string `json:"signatures,omitempty"`
+}
+
+// GET /_ligase/admin/v1/legal_holds
+type GetAdminLegalHoldsResponse struct {
+	LegalHolds []AdminLegalHold `json:"legal_holds"`
+}
+
+type AdminLegalHold struct {
+	// a room or a user ID
+	Target    string `json:"target"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedBy string `json:"created_by"`
+	CreatedTs int64  `json:"created_ts"`
+}
+
+// PUT /_ligase/admin/v1/legal_holds/{target}
+type PutAdminLegalHoldRequest struct {
+	Target string `json:"target"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// DELETE /_ligase/admin/v1/legal_holds/{target}
+type DelAdminLegalHoldRequest struct {
+	Target string `json:"target"`
+}
+
+// GET /_ligase/admin/v1/registration_tokens
+type GetAdminRegistrationTokensResponse struct {
+	RegistrationTokens []AdminRegistrationToken `json:"registration_tokens"`
+}
+
+type AdminRegistrationToken struct {
+	Token string `json:"token"`
+	// null means unlimited
+	UsesAllowed *int `json:"uses_allowed"`
+	Completed   int  `json:"completed"`
+	// null means the token never expires
+	ExpiryTime *int64 `json:"expiry_time"`
+}
+
+// POST /_ligase/admin/v1/registration_tokens/new
+type PostAdminRegistrationTokenRequest struct {
+	// generated if empty
+	Token string `json:"token,omitempty"`
+	// of the generated token
+	Length      int    `json:"length,omitempty"`
+	UsesAllowed *int   `json:"uses_allowed,omitempty"`
+	ExpiryTime  *int64 `json:"expiry_time,omitempty"`
+}
+
+// DELETE /_ligase/admin/v1/registration_tokens/{token}
+type DelAdminRegistrationTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// POST /_ligase/admin/v1/config/reload
+type PostAdminConfigReloadResponse struct {
+	// sha256 of the config file in use
+	Digest string `json:"digest"`
+	// false if the file was the one already in use
+	Changed bool `json:"changed"`
+}
+
+// GET /_ligase/admin/v1/audit
+type GetAdminAuditEventsRequest struct {
+	// events after this seq
+	From   int64  `json:"from,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+	Type   string `json:"type,omitempty"`
+	// milliseconds since the epoch, until excluded
+	Since int64 `json:"since,omitempty"`
+	Until int64 `json:"until,omitempty"`
+}
+
+type GetAdminAuditEventsResponse struct {
+	Events []AdminAuditEvent `json:"events"`
+	// from of the next page, absent on the last one
+	NextFrom int64 `json:"next_from,omitempty"`
+	// seq of the first event of the page whose hash chain does not verify
+	ChainBrokenAt int64 `json:"chain_broken_at,omitempty"`
+}
+
+type AdminAuditEvent struct {
+	Seq      int64             `json:"seq"`
+	Ts       int64             `json:"ts"`
+	Type     string            `json:"type"`
+	UserID   string            `json:"user_id"`
+	DeviceID string            `json:"device_id,omitempty"`
+	IP       string            `json:"ip,omitempty"`
+	Target   string            `json:"target,omitempty"`
+	RoomID   string            `json:"room_id,omitempty"`
+	Success  bool              `json:"success"`
+	Details  map[string]string `json:"details,omitempty"`
+	PrevHash string            `json:"prev_hash"`
+	Hash     string            `json:"hash"`
+}
@@ -0,0 +1,26 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package external
+
+// POST /_matrix/client/v1/appservice/{appserviceId}/ping
+type PostAppServicePingRequest struct {
+	AppServiceID string `json:"appservice_id"`
+	AccessToken  string `json:"access_token"`
+	TxnID        string `json:"transaction_id,omitempty"`
+}
+
+type PostAppServicePingResponse struct {
+	DurationMS int64 `json:"duration_ms"`
+}
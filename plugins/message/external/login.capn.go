@@ -266,12 +266,12 @@ type PostLoginResponseCapn struct{ capnp.Struct }
 const PostLoginResponseCapn_TypeID = 0xc853484cccd8383e
 
 func NewPostLoginResponseCapn(s *capnp.Segment) (PostLoginResponseCapn, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4})
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5})
 	return PostLoginResponseCapn{st}, err
 }
 
 func NewRootPostLoginResponseCapn(s *capnp.Segment) (PostLoginResponseCapn, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4})
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5})
 	return PostLoginResponseCapn{st}, err
 }
 
@@ -361,12 +361,39 @@ func (s PostLoginResponseCapn) SetDeviceID(v string) error {
 	return s.Struct.SetText(3, v)
 }
 
+func (s PostLoginResponseCapn) ExpiresInMS() int64 {
+	return int64(s.Struct.Uint64(0))
+}
+
+func (s PostLoginResponseCapn) SetExpiresInMS(v int64) {
+	s.Struct.SetUint64(0, uint64(v))
+}
+
+func (s PostLoginResponseCapn) RefreshToken() (string, error) {
+	p, err := s.Struct.Ptr(4)
+	return p.Text(), err
+}
+
+func (s PostLoginResponseCapn) HasRefreshToken() bool {
+	p, err := s.Struct.Ptr(4)
+	return p.IsValid() || err != nil
+}
+
+func (s PostLoginResponseCapn) RefreshTokenBytes() ([]byte, error) {
+	p, err := s.Struct.Ptr(4)
+	return p.TextBytes(), err
+}
+
+func (s PostLoginResponseCapn) SetRefreshToken(v string) error {
+	return s.Struct.SetText(4, v)
+}
+
 // PostLoginResponseCapn_List is a list of PostLoginResponseCapn.
 type PostLoginResponseCapn_List struct{ capnp.List }
 
 // NewPostLoginResponseCapn creates a new list of PostLoginResponseCapn.
 func NewPostLoginResponseCapn_List(s *capnp.Segment, sz int32) (PostLoginResponseCapn_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4}, sz)
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5}, sz)
 	return PostLoginResponseCapn_List{l}, err
 }
 
@@ -44,6 +44,9 @@ type PostLoginRequest struct {
 	InitialDisplayName *string        `json:"initial_device_display_name"`
 	IsHuman            *bool          `json:"is_human"`
 	IsAdmin            bool           `json:"is_admin"`
+	RefreshToken       bool           `json:"refresh_token"`
+	// Set by the proxy from the connection, for the audit log
+	IP string `json:"ip,omitempty"`
 }
 type PostLoginAdminRequest PostLoginRequest
 
@@ -53,10 +56,25 @@ type UserIdentifier struct {
 
 //response
 type PostLoginResponse struct {
-	UserID      string `json:"user_id"`
-	AccessToken string `json:"access_token"`
-	HomeServer  string `json:"home_server"`
-	DeviceID    string `json:"device_id"`
+	UserID       string `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	HomeServer   string `json:"home_server"`
+	DeviceID     string `json:"device_id"`
+	ExpiresInMS  int64  `json:"expires_in_ms,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+//POST /_matrix/client/r0/refresh
+//request
+type PostRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+//response
+type PostRefreshResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresInMS  int64  `json:"expires_in_ms,omitempty"`
 }
 
 //POST /_matrix/client/r0/logout
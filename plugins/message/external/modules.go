@@ -486,12 +486,12 @@ type DeviceInfo struct {
 }
 
 type SessionInfo struct {
-	Connections []ConnectionInfo `json:"connections`
+	Connections []ConnectionInfo `json:"connections"`
 }
 
 type ConnectionInfo struct {
 	Ip        string `json:"ip"`
-	LastSeen  int    `json:"last_seen"`
+	LastSeen  int64  `json:"last_seen"`
 	UserAgent string `json:"user_agent"`
 }
 
@@ -506,33 +506,56 @@ type GetCasLoginTickerRequest struct {
 	Ticket      string `json:"ticket"`
 }
 
+//GET /_matrix/client/r0/login/sso/redirect
+type GetSSOLoginRedirectRequest struct {
+	RedirectURL string `json:"redirectUrl"`
+}
+
+//POST /_matrix/client/r0/login/saml2/authn_response
+type PostSAMLAuthnResponseRequest struct {
+	SAMLResponse string `json:"SAMLResponse"`
+	RelayState   string `json:"RelayState"`
+}
+
+// SSORedirectResponse sends the browser on to Location
+type SSORedirectResponse struct {
+	Location string `json:"location"`
+}
+
+func (res *SSORedirectResponse) Headers() map[string]string {
+	return map[string]string{"Location": res.Location}
+}
+
 //POST /_matrix/client/r0/rooms/{roomId}/report/{eventId}
 type PostRoomReportRequest struct {
 	RoomID  string `json:"roomId"`
 	EventID string `json:"eventId"`
-	Score   int    `json:"score"`
+	Score   *int64 `json:"score,omitempty"`
 	Reason  string `json:"reason"`
 }
 
 //GET /_matrix/client/r0/thirdparty/protocols
-type GetThirdPartyProtocalsResponse struct {
+type GetThirdPartyProtocalsResponse map[string]ThirdPartyProtocol
+
+type ThirdPartyProtocol struct {
 	UserFields     []string              `json:"user_fields"`
 	LocationFields []string              `json:"location_fields"`
 	Icon           string                `json:"icon"`
-	FieldsTypes    map[string]FieldsType `json:"fields_types"`
+	FieldsTypes    map[string]FieldsType `json:"field_types"`
 	Instances      []ProtocolInstance    `json:"instances"`
 }
 
 type FieldsType struct {
 	Regexp      string `json:"regexp"`
-	PlaceHolder string `json:"placeholder`
+	PlaceHolder string `json:"placeholder"`
 }
 
 type ProtocolInstance struct {
-	Desc      string      `json:"desc"`
-	Icon      string      `json:"icon"`
-	Fields    interface{} `json:"fields"`
-	NetworkID string      `json:"network_id"`
+	Desc       string      `json:"desc"`
+	Icon       string      `json:"icon,omitempty"`
+	Fields     interface{} `json:"fields"`
+	NetworkID  string      `json:"network_id"`
+	InstanceID string      `json:"instance_id,omitempty"`
 }
 
 //GET /_matrix/client/r0/thirdparty/protocol/{protocol}
@@ -540,23 +563,15 @@ type GetThirdPartyProtocalByNameRequest struct {
 	Protocol string `json:"protocol"`
 }
 
-type GetThirdPartyProtocalByNameResponse struct {
-	UserFields     []string              `json:"user_fields"`
-	LocationFields []string              `json:"location_fields"`
-	Icon           string                `json:"icon"`
-	FieldsTypes    map[string]FieldsType `json:"fields_types"`
-	Instances      []ProtocolInstance    `json:"instances"`
-}
+type GetThirdPartyProtocalByNameResponse ThirdPartyProtocol
 
 //GET /_matrix/client/r0/thirdparty/location/{protocol}
 type GetThirdPartyLocationByProtocolRequest struct {
-	Protocol     string `json:"protocol"`
-	SearchFields string `json:"searchFields"`
+	Protocol string            `json:"protocol"`
+	Fields   map[string]string `json:"fields"`
 }
 
-type GetThirdPartyLocationByProtocolResponse struct {
-	Body []Location `json:"<body"`
-}
+type GetThirdPartyLocationByProtocolResponse []Location
 
 type Location struct {
 	Alias    string      `json:"alias"`
@@ -566,13 +581,11 @@ type Location struct {
 
 //GET /_matrix/client/r0/thirdparty/user/{protocol}
 type GetThirdPartyUserByProtocolRequest struct {
-	Protocol string `json:"protocol"`
-	Fields   string `json:"fields..."`
+	Protocol string            `json:"protocol"`
+	Fields   map[string]string `json:"fields"`
 }
 
-type GetThirdPartyUserByProtocolResponse struct {
-	Body []ThirdPartyUser `json:"<body>"`
-}
+type GetThirdPartyUserByProtocolResponse []ThirdPartyUser
 
 type ThirdPartyUser struct {
 	UserID   string      `json:"userid"`
@@ -585,18 +598,14 @@ type GetThirdPartyLocationRequest struct {
 	Alias string `json:"alias"`
 }
 
-type GetThirdPartyLocationResponse struct {
-	Body []Location `json:"<body>"`
-}
+type GetThirdPartyLocationResponse []Location
 
 //GET /_matrix/client/r0/thirdparty/user
 type GetThirdPartyUserRequest struct {
 	UserID string `json:"userid"`
 }
 
-type GetThirdPartyUserResponse struct {
-	Body []ThirdPartyUser `json:"<body>"`
-}
+type GetThirdPartyUserResponse []ThirdPartyUser
 
 //POST /_matrix/client/r0/user/{userId}/openid/request_token
 type PostUserOpenIDRequest struct {
@@ -610,6 +619,15 @@ type PostUserOpenIDResponse struct {
 	ExpiresIn        int    `json:"expires_in"`
 }
 
+//GET /_matrix/federation/v1/openid/userinfo
+type GetFedOpenIDUserInfoRequest struct {
+	AccessToken string `json:"access_token"`
+}
+
+type GetFedOpenIDUserInfoResponse struct {
+	Sub string `json:"sub"`
+}
+
 //POST /system/manager//{type}
 type PostSystemManagerRequest struct {
 	Type string `json:"type"`
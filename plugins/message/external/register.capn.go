@@ -117,12 +117,12 @@ type AuthDictCapn struct{ capnp.Struct }
 const AuthDictCapn_TypeID = 0xeee54a14f2c8c4f3
 
 func NewAuthDictCapn(s *capnp.Segment) (AuthDictCapn, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4})
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 7})
 	return AuthDictCapn{st}, err
 }
 
 func NewRootAuthDictCapn(s *capnp.Segment) (AuthDictCapn, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4})
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 7})
 	return AuthDictCapn{st}, err
 }
 
@@ -207,12 +207,81 @@ func (s AuthDictCapn) SetResponse(v string) error {
 	return s.Struct.SetText(3, v)
 }
 
+func (s AuthDictCapn) ThreePIDCreds() (ThreePidCredentialsCapn, error) {
+	p, err := s.Struct.Ptr(4)
+	return ThreePidCredentialsCapn{Struct: p.Struct()}, err
+}
+
+func (s AuthDictCapn) HasThreePIDCreds() bool {
+	p, err := s.Struct.Ptr(4)
+	return p.IsValid() || err != nil
+}
+
+func (s AuthDictCapn) SetThreePIDCreds(v ThreePidCredentialsCapn) error {
+	return s.Struct.SetPtr(4, v.Struct.ToPtr())
+}
+
+// NewThreePIDCreds sets the threePIDCreds field to a newly
+// allocated ThreePidCredentialsCapn struct, preferring placement in s's segment.
+func (s AuthDictCapn) NewThreePIDCreds() (ThreePidCredentialsCapn, error) {
+	ss, err := NewThreePidCredentialsCapn(s.Struct.Segment())
+	if err != nil {
+		return ThreePidCredentialsCapn{}, err
+	}
+	err = s.Struct.SetPtr(4, ss.Struct.ToPtr())
+	return ss, err
+}
+
+func (s AuthDictCapn) ThreePIDCredsOld() (ThreePidCredentialsCapn, error) {
+	p, err := s.Struct.Ptr(5)
+	return ThreePidCredentialsCapn{Struct: p.Struct()}, err
+}
+
+func (s AuthDictCapn) HasThreePIDCredsOld() bool {
+	p, err := s.Struct.Ptr(5)
+	return p.IsValid() || err != nil
+}
+
+func (s AuthDictCapn) SetThreePIDCredsOld(v ThreePidCredentialsCapn) error {
+	return s.Struct.SetPtr(5, v.Struct.ToPtr())
+}
+
+// NewThreePIDCredsOld sets the threePIDCredsOld field to a newly
+// allocated ThreePidCredentialsCapn struct, preferring placement in s's segment.
+func (s AuthDictCapn) NewThreePIDCredsOld() (ThreePidCredentialsCapn, error) {
+	ss, err := NewThreePidCredentialsCapn(s.Struct.Segment())
+	if err != nil {
+		return ThreePidCredentialsCapn{}, err
+	}
+	err = s.Struct.SetPtr(5, ss.Struct.ToPtr())
+	return ss, err
+}
+
+func (s AuthDictCapn) Token() (string, error) {
+	p, err := s.Struct.Ptr(6)
+	return p.Text(), err
+}
+
+func (s AuthDictCapn) HasToken() bool {
+	p, err := s.Struct.Ptr(6)
+	return p.IsValid() || err != nil
+}
+
+func (s AuthDictCapn) TokenBytes() ([]byte, error) {
+	p, err := s.Struct.Ptr(6)
+	return p.TextBytes(), err
+}
+
+func (s AuthDictCapn) SetToken(v string) error {
+	return s.Struct.SetText(6, v)
+}
+
 // AuthDictCapn_List is a list of AuthDictCapn.
 type AuthDictCapn_List struct{ capnp.List }
 
 // NewAuthDictCapn creates a new list of AuthDictCapn.
 func NewAuthDictCapn_List(s *capnp.Segment, sz int32) (AuthDictCapn_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4}, sz)
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 0, PointerCount: 7}, sz)
 	return AuthDictCapn_List{l}, err
 }
 
@@ -233,6 +302,14 @@ func (p AuthDictCapn_Promise) Struct() (AuthDictCapn, error) {
 	return AuthDictCapn{s}, err
 }
 
+func (p AuthDictCapn_Promise) ThreePIDCreds() ThreePidCredentialsCapn_Promise {
+	return ThreePidCredentialsCapn_Promise{Pipeline: p.Pipeline.GetPipeline(4)}
+}
+
+func (p AuthDictCapn_Promise) ThreePIDCredsOld() ThreePidCredentialsCapn_Promise {
+	return ThreePidCredentialsCapn_Promise{Pipeline: p.Pipeline.GetPipeline(5)}
+}
+
 type AuthFlowCapn struct{ capnp.Struct }
 
 // AuthFlowCapn_TypeID is the unique identifier for the type AuthFlowCapn.
@@ -1883,6 +1960,14 @@ func (s PostRegisterRequestCapn) SetAdmin(v bool) {
 	s.Struct.SetBit(2, v)
 }
 
+func (s PostRegisterRequestCapn) RefreshToken() bool {
+	return s.Struct.Bit(3)
+}
+
+func (s PostRegisterRequestCapn) SetRefreshToken(v bool) {
+	s.Struct.SetBit(3, v)
+}
+
 // PostRegisterRequestCapn_List is a list of PostRegisterRequestCapn.
 type PostRegisterRequestCapn_List struct{ capnp.List }
 
@@ -1923,12 +2008,12 @@ type RegisterResponseCapn struct{ capnp.Struct }
 const RegisterResponseCapn_TypeID = 0xc235bc5c20ec749c
 
 func NewRegisterResponseCapn(s *capnp.Segment) (RegisterResponseCapn, error) {
-	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4})
+	st, err := capnp.NewStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5})
 	return RegisterResponseCapn{st}, err
 }
 
 func NewRootRegisterResponseCapn(s *capnp.Segment) (RegisterResponseCapn, error) {
-	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4})
+	st, err := capnp.NewRootStruct(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5})
 	return RegisterResponseCapn{st}, err
 }
 
@@ -2018,12 +2103,39 @@ func (s RegisterResponseCapn) SetDeviceID(v string) error {
 	return s.Struct.SetText(3, v)
 }
 
+func (s RegisterResponseCapn) ExpiresInMS() int64 {
+	return int64(s.Struct.Uint64(0))
+}
+
+func (s RegisterResponseCapn) SetExpiresInMS(v int64) {
+	s.Struct.SetUint64(0, uint64(v))
+}
+
+func (s RegisterResponseCapn) RefreshToken() (string, error) {
+	p, err := s.Struct.Ptr(4)
+	return p.Text(), err
+}
+
+func (s RegisterResponseCapn) HasRefreshToken() bool {
+	p, err := s.Struct.Ptr(4)
+	return p.IsValid() || err != nil
+}
+
+func (s RegisterResponseCapn) RefreshTokenBytes() ([]byte, error) {
+	p, err := s.Struct.Ptr(4)
+	return p.TextBytes(), err
+}
+
+func (s RegisterResponseCapn) SetRefreshToken(v string) error {
+	return s.Struct.SetText(4, v)
+}
+
 // RegisterResponseCapn_List is a list of RegisterResponseCapn.
 type RegisterResponseCapn_List struct{ capnp.List }
 
 // NewRegisterResponseCapn creates a new list of RegisterResponseCapn.
 func NewRegisterResponseCapn_List(s *capnp.Segment, sz int32) (RegisterResponseCapn_List, error) {
-	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 0, PointerCount: 4}, sz)
+	l, err := capnp.NewCompositeList(s, capnp.ObjectSize{DataSize: 8, PointerCount: 5}, sz)
 	return RegisterResponseCapn_List{l}, err
 }
 
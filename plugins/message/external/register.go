@@ -21,6 +21,12 @@ type AuthDict struct {
 	Session  string `json:"session"`
 	Mac      []byte `json:"mac"`
 	Response string `json:"response"`
+	// m.login.email.identity and m.login.msisdn
+	ThreePIDCreds ThreePidCredentials `json:"threepid_creds"`
+	// r0.2 name of threepid_creds
+	ThreePIDCredsOld ThreePidCredentials `json:"threepidCreds"`
+	// m.login.registration_token
+	Token string `json:"token"`
 }
 
 type PostRegisterRequest struct {
@@ -39,6 +45,8 @@ type PostRegisterRequest struct {
 	RemoteAddr string `json:"remote_addr"`
 
 	Admin bool `json:"admin"`
+
+	RefreshToken bool `json:"refresh_token"`
 }
 
 // legacyRegisterRequest represents the submitted registration request for v1 API.
@@ -52,10 +60,12 @@ type LegacyRegisterRequest struct {
 
 //response
 type RegisterResponse struct {
-	UserID      string `json:"user_id"`
-	AccessToken string `json:"access_token"`
-	HomeServer  string `json:"home_server"`
-	DeviceID    string `json:"device_id"`
+	UserID       string `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	HomeServer   string `json:"home_server"`
+	DeviceID     string `json:"device_id"`
+	ExpiresInMS  int64  `json:"expires_in_ms,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 // Flow represents one possible way that the client can authenticate a request.
@@ -159,3 +169,12 @@ type GetRegisterAvail struct {
 type GetRegisterAvailResponse struct {
 	Available bool `json:"available"`
 }
+
+// GET /_matrix/client/r0/register/m.login.registration_token/validity
+type GetRegistrationTokenValidityRequest struct {
+	Token string `json:"token"`
+}
+
+type GetRegistrationTokenValidityResponse struct {
+	Valid bool `json:"valid"`
+}
@@ -456,6 +456,7 @@ func (externalReq *PostRegisterRequest) Decode(input []byte) error {
 		return err
 	}
 	externalReq.Admin = reqCapn.Admin()
+	externalReq.RefreshToken = reqCapn.RefreshToken()
 	authCapn, err := reqCapn.Auth()
 	externalReq.Auth.Type, _ = authCapn.Type()
 	externalReq.Auth.Session, _ = authCapn.Session()
@@ -464,6 +465,21 @@ func (externalReq *PostRegisterRequest) Decode(input []byte) error {
 	if err != nil {
 		return err
 	}
+	externalReq.Auth.Token, _ = authCapn.Token()
+	threePIDCredsCapn, err := authCapn.ThreePIDCreds()
+	if err != nil {
+		return err
+	}
+	externalReq.Auth.ThreePIDCreds.ClientSecret, _ = threePIDCredsCapn.ClientSecret()
+	externalReq.Auth.ThreePIDCreds.IdServer, _ = threePIDCredsCapn.IdServer()
+	externalReq.Auth.ThreePIDCreds.Sid, _ = threePIDCredsCapn.Sid()
+	threePIDCredsOldCapn, err := authCapn.ThreePIDCredsOld()
+	if err != nil {
+		return err
+	}
+	externalReq.Auth.ThreePIDCredsOld.ClientSecret, _ = threePIDCredsOldCapn.ClientSecret()
+	externalReq.Auth.ThreePIDCredsOld.IdServer, _ = threePIDCredsOldCapn.IdServer()
+	externalReq.Auth.ThreePIDCredsOld.Sid, _ = threePIDCredsOldCapn.Sid()
 	return nil
 }
 
@@ -740,6 +756,13 @@ func (externalReq *PostAccount3PIDRequest) Decode(input []byte) error {
 	externalReq.ThreePIDCreds.ClientSecret, _ = threePIDCredsCapn.ClientSecret()
 	externalReq.ThreePIDCreds.IdServer, _ = threePIDCredsCapn.IdServer()
 	externalReq.ThreePIDCreds.Sid, _ = threePIDCredsCapn.Sid()
+	threePIDCredsOldCapn, err := reqCapn.ThreePIDCredsOld()
+	if err != nil {
+		return err
+	}
+	externalReq.ThreePIDCredsOld.ClientSecret, _ = threePIDCredsOldCapn.ClientSecret()
+	externalReq.ThreePIDCredsOld.IdServer, _ = threePIDCredsOldCapn.IdServer()
+	externalReq.ThreePIDCredsOld.Sid, _ = threePIDCredsOldCapn.Sid()
 	return nil
 }
 
@@ -2000,3 +2023,107 @@ func (externalReq *PostClaimClientKeysRequest) Decode(data []byte) error {
 func (externalReq *DismissRoomRequest) Decode(data []byte) error {
 	return json.Unmarshal(data, externalReq)
 }
+
+func (externalReq *PostAppServicePingRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PostRefreshRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PostAdminRoomShutdownRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PostAdminRoomPurgeHistoryRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetAdminRoomPurgeStatusRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *AdminRoomBlockRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetAdminUsersRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *AdminUserRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PostAdminUserResetPasswordRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PutAdminUserAdminRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PutAdminUserShadowBanRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetAdminEventReportsRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *AdminEventReportRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PostAdminEventReportResolveRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PutAdminEventReportNoteRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetAdminRoomExportRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PutAdminLegalHoldRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *DelAdminLegalHoldRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetFedOpenIDUserInfoRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetSSOLoginRedirectRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PostSAMLAuthnResponseRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *Post3PIDSubmitTokenRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetRegistrationTokenValidityRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *PostAdminRegistrationTokenRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *DelAdminRegistrationTokenRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
+
+func (externalReq *GetAdminAuditEventsRequest) Decode(data []byte) error {
+	return json.Unmarshal(data, externalReq)
+}
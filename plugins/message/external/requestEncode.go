@@ -388,6 +388,7 @@ func (externalReq *PostRegisterRequest) Encode() ([]byte, error) {
 	reqCapn.SetAccessToken(externalReq.AccessToken)
 	reqCapn.SetRemoteAddr(externalReq.RemoteAddr)
 	reqCapn.SetAdmin(externalReq.Admin)
+	reqCapn.SetRefreshToken(externalReq.RefreshToken)
 
 	auth, err := reqCapn.NewAuth()
 	if err != nil {
@@ -398,6 +399,23 @@ func (externalReq *PostRegisterRequest) Encode() ([]byte, error) {
 	auth.SetSession(externalReq.Auth.Session)
 	auth.SetMac(externalReq.Auth.Mac)
 	auth.SetResponse(externalReq.Auth.Response)
+	auth.SetToken(externalReq.Auth.Token)
+	creds, err := auth.NewThreePIDCreds()
+	if err != nil {
+		return nil, err
+	}
+
+	creds.SetClientSecret(externalReq.Auth.ThreePIDCreds.ClientSecret)
+	creds.SetIdServer(externalReq.Auth.ThreePIDCreds.IdServer)
+	creds.SetSid(externalReq.Auth.ThreePIDCreds.Sid)
+	credsOld, err := auth.NewThreePIDCredsOld()
+	if err != nil {
+		return nil, err
+	}
+
+	credsOld.SetClientSecret(externalReq.Auth.ThreePIDCredsOld.ClientSecret)
+	credsOld.SetIdServer(externalReq.Auth.ThreePIDCredsOld.IdServer)
+	credsOld.SetSid(externalReq.Auth.ThreePIDCredsOld.Sid)
 
 	data, err := msg.Marshal()
 	if err != nil {
@@ -681,6 +699,14 @@ func (externalReq *PostAccount3PIDRequest) Encode() ([]byte, error) {
 	creds.SetClientSecret(externalReq.ThreePIDCreds.ClientSecret)
 	creds.SetIdServer(externalReq.ThreePIDCreds.IdServer)
 	creds.SetSid(externalReq.ThreePIDCreds.Sid)
+	credsOld, err := reqCapn.NewThreePIDCredsOld()
+	if err != nil {
+		return nil, err
+	}
+
+	credsOld.SetClientSecret(externalReq.ThreePIDCredsOld.ClientSecret)
+	credsOld.SetIdServer(externalReq.ThreePIDCredsOld.IdServer)
+	credsOld.SetSid(externalReq.ThreePIDCredsOld.Sid)
 	data, err := msg.Marshal()
 	if err != nil {
 		return nil, err
@@ -1847,3 +1873,107 @@ func (externalReq *PostClaimClientKeysRequest) Encode() ([]byte, error) {
 func (externalReq *DismissRoomRequest) Encode() ([]byte, error) {
 	return json.Marshal(externalReq)
 }
+
+func (externalReq *PostAppServicePingRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PostRefreshRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PostAdminRoomShutdownRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PostAdminRoomPurgeHistoryRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetAdminRoomPurgeStatusRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *AdminRoomBlockRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetAdminUsersRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *AdminUserRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PostAdminUserResetPasswordRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PutAdminUserAdminRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PutAdminUserShadowBanRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetAdminEventReportsRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *AdminEventReportRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PostAdminEventReportResolveRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PutAdminEventReportNoteRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetAdminRoomExportRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PutAdminLegalHoldRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *DelAdminLegalHoldRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetFedOpenIDUserInfoRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetSSOLoginRedirectRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PostSAMLAuthnResponseRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *Post3PIDSubmitTokenRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetRegistrationTokenValidityRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *PostAdminRegistrationTokenRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *DelAdminRegistrationTokenRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
+
+func (externalReq *GetAdminAuditEventsRequest) Encode() ([]byte, error) {
+	return json.Marshal(externalReq)
+}
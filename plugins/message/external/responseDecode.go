@@ -81,6 +81,11 @@ func (res *PostLoginResponse) Decode(input []byte) error {
 	if err != nil {
 		return err
 	}
+	res.ExpiresInMS = resCapn.ExpiresInMS()
+	res.RefreshToken, err = resCapn.RefreshToken()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -111,6 +116,11 @@ func (res *RegisterResponse) Decode(input []byte) error {
 	if err != nil {
 		return err
 	}
+	res.ExpiresInMS = resCapn.ExpiresInMS()
+	res.RefreshToken, err = resCapn.RefreshToken()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -259,6 +269,10 @@ func (res *PostAccount3PIDMsisdnResponse) Decode(input []byte) error {
 	if err != nil {
 		return err
 	}
+	res.SubmitURL, err = resCapn.SubmitURL()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1149,4 +1163,116 @@ func (res *PostClaimClientKeysResponse) Decode(input []byte) error {
 
 func (res *DismissRoomResponse) Decode(input []byte) error {
 	return json.Unmarshal(input, res)
-}
\ No newline at end of file
+}
+
+func (res *PostAppServicePingResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *PostRefreshResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *PostAdminRoomShutdownResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *PostAdminRoomPurgeHistoryResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetAdminRoomPurgeStatusResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *AdminRoomBlockResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetAdminUsersResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *AdminUserInfo) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetWhoIsResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetAdminEventReportsResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *EventReportInfo) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetAdminRoomExportResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetAdminLegalHoldsResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *PostUserOpenIDResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetFedOpenIDUserInfoResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetThirdPartyProtocalsResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetThirdPartyProtocalByNameResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetThirdPartyLocationByProtocolResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetThirdPartyUserByProtocolResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetThirdPartyLocationResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetThirdPartyUserResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *SSORedirectResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *Post3PIDSubmitTokenResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetRegistrationTokenValidityResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetAdminRegistrationTokensResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *AdminRegistrationToken) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *PostAdminConfigReloadResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
+
+func (res *GetAdminAuditEventsResponse) Decode(input []byte) error {
+	return json.Unmarshal(input, res)
+}
@@ -70,6 +70,8 @@ func (res *PostLoginResponse) Encode() ([]byte, error) {
 	resCapn.SetAccessToken(res.AccessToken)
 	resCapn.SetHomeServer(res.HomeServer)
 	resCapn.SetDeviceID(res.DeviceID)
+	resCapn.SetExpiresInMS(res.ExpiresInMS)
+	resCapn.SetRefreshToken(res.RefreshToken)
 
 	data, err := msg.Marshal()
 	if err != nil {
@@ -93,6 +95,8 @@ func (res *RegisterResponse) Encode() ([]byte, error) {
 	resCapn.SetAccessToken(res.AccessToken)
 	resCapn.SetHomeServer(res.HomeServer)
 	resCapn.SetDeviceID(res.DeviceID)
+	resCapn.SetExpiresInMS(res.ExpiresInMS)
+	resCapn.SetRefreshToken(res.RefreshToken)
 
 	data, err := msg.Marshal()
 	if err != nil {
@@ -265,6 +269,7 @@ func (res *PostAccount3PIDMsisdnResponse) Encode() ([]byte, error) {
 	}
 
 	resCapn.SetSid(res.Sid)
+	resCapn.SetSubmitURL(res.SubmitURL)
 
 	data, err := msg.Marshal()
 	if err != nil {
@@ -1136,4 +1141,116 @@ func (r *PostClaimClientKeysResponse) Encode() ([]byte, error) {
 
 func (res *DismissRoomResponse) Encode() ([]byte, error) {
 	return json.Marshal(res)
-}
\ No newline at end of file
+}
+
+func (res *PostAppServicePingResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *PostRefreshResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *PostAdminRoomShutdownResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *PostAdminRoomPurgeHistoryResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetAdminRoomPurgeStatusResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *AdminRoomBlockResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetAdminUsersResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *AdminUserInfo) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetWhoIsResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetAdminEventReportsResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *EventReportInfo) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetAdminRoomExportResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetAdminLegalHoldsResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *PostUserOpenIDResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetFedOpenIDUserInfoResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetThirdPartyProtocalsResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetThirdPartyProtocalByNameResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetThirdPartyLocationByProtocolResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetThirdPartyUserByProtocolResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetThirdPartyLocationResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetThirdPartyUserResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *SSORedirectResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *Post3PIDSubmitTokenResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetRegistrationTokenValidityResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetAdminRegistrationTokensResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *AdminRegistrationToken) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *PostAdminConfigReloadResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (res *GetAdminAuditEventsResponse) Encode() ([]byte, error) {
+	return json.Marshal(res)
+}
@@ -45,6 +45,7 @@ const (
 	MSG_POST_LOGIN_ADMIN int32 = 0x00010103
 	MSG_POST_LOGOUT      int32 = 0x00010202
 	MSG_POST_LOGOUT_ALL  int32 = 0x00010302
+	MSG_POST_REFRESH     int32 = 0x00010402
 
 	MSG_POST_REGISTER           int32 = 0x00020002
 	MSG_POST_REGISTER_LEGACY    int32 = 0x00020003
@@ -56,11 +57,14 @@ const (
 	MSG_POST_ACCOUNT_DEACTIVATE int32 = 0x00020602
 	MSG_GET_REGISTER_AVAILABLE  int32 = 0x00020700
 
+	MSG_GET_REGISTER_TOKEN_VALIDITY int32 = 0x00020800
+
 	MSG_GET_ACCOUNT_3PID         int32 = 0x00030000
 	MSG_POST_ACCOUNT_3PID        int32 = 0x00030102
 	MSG_POST_ACCOUNT_3PID_DEL    int32 = 0x00030202
 	MSG_POST_ACCOUNT_3PID_EMAIL  int32 = 0x00030302
 	MSG_POST_ACCOUNT_3PID_MSISDN int32 = 0x00030402
+	MSG_POST_3PID_SUBMIT_TOKEN   int32 = 0x00030502
 
 	MSG_GET_ACCOUNT_WHOAMI int32 = 0x00040000
 
@@ -202,6 +206,8 @@ const (
 
 	MSG_GET_CAS_LOGIN_REDIRECT int32 = 0x00240001
 	MSG_GET_CAS_LOGIN_TICKET   int32 = 0x00240101
+	MSG_GET_SSO_LOGIN_REDIRECT int32 = 0x00240201
+	MSG_POST_SAML_AUTHN_RESP   int32 = 0x00240302
 
 	MSG_POST_ROOM_REPORT int32 = 0x00250002
 
@@ -212,7 +218,8 @@ const (
 	MSG_GET_THIRDPARTY_LOCATION          int32 = 0x00260401
 	MSG_GET_THIRDPARTY_USER              int32 = 0x00260501
 
-	MSG_POST_USER_OPENID int32 = 0x00270002
+	MSG_POST_USER_OPENID        int32 = 0x00270002
+	MSG_GET_FED_OPENID_USERINFO int32 = 0x00270100
 
 	MSG_POST_SYSTEM_MANAGER int32 = 0x00280001
 
@@ -253,6 +260,42 @@ const (
 
 	MSG_GET_RCS_FRIENDSHIPS int32 = 0x00500000
 	MSG_GET_RCS_ROOMID      int32 = 0x00500100
+
+	MSG_POST_APPSERVICE_PING int32 = 0x00600002
+
+	MSG_POST_ADMIN_ROOM_SHUTDOWN      int32 = 0x00700002
+	MSG_POST_ADMIN_ROOM_PURGE_HISTORY int32 = 0x00700102
+	MSG_GET_ADMIN_ROOM_PURGE_STATUS   int32 = 0x00700200
+	MSG_POST_ADMIN_ROOM_BLOCK         int32 = 0x00700302
+	MSG_POST_ADMIN_ROOM_UNBLOCK       int32 = 0x00700402
+	MSG_GET_ADMIN_ROOM_BLOCK          int32 = 0x00700500
+	MSG_GET_ADMIN_ROOM_EXPORT         int32 = 0x00700600
+
+	MSG_GET_ADMIN_USERS                int32 = 0x00710000
+	MSG_GET_ADMIN_USER                 int32 = 0x00710100
+	MSG_POST_ADMIN_USER_RESET_PASSWORD int32 = 0x00710202
+	MSG_POST_ADMIN_USER_LOCK           int32 = 0x00710302
+	MSG_POST_ADMIN_USER_UNLOCK         int32 = 0x00710402
+	MSG_POST_ADMIN_USER_LOGOUT         int32 = 0x00710502
+	MSG_PUT_ADMIN_USER_ADMIN           int32 = 0x00710601
+	MSG_PUT_ADMIN_USER_SHADOW_BAN      int32 = 0x00710701
+
+	MSG_GET_ADMIN_EVENT_REPORTS         int32 = 0x00720000
+	MSG_GET_ADMIN_EVENT_REPORT          int32 = 0x00720100
+	MSG_POST_ADMIN_EVENT_REPORT_RESOLVE int32 = 0x00720202
+	MSG_PUT_ADMIN_EVENT_REPORT_NOTE     int32 = 0x00720301
+
+	MSG_GET_ADMIN_LEGAL_HOLDS int32 = 0x00730000
+	MSG_PUT_ADMIN_LEGAL_HOLD  int32 = 0x00730101
+	MSG_DEL_ADMIN_LEGAL_HOLD  int32 = 0x00730203
+
+	MSG_GET_ADMIN_REGISTRATION_TOKENS int32 = 0x00740000
+	MSG_POST_ADMIN_REGISTRATION_TOKEN int32 = 0x00740102
+	MSG_DEL_ADMIN_REGISTRATION_TOKEN  int32 = 0x00740203
+
+	MSG_POST_ADMIN_CONFIG_RELOAD int32 = 0x00750002
+
+	MSG_GET_ADMIN_AUDIT_EVENTS int32 = 0x00760000
 )
 
 const (
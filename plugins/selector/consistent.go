@@ -63,7 +63,8 @@ func (c *Consistent) AddNode(host string) {
 		return
 	}
 
-	c.loadMap[host] = &defaultLoad
+	load := defaultLoad
+	c.loadMap[host] = &load
 	for i := 0; i < replicationFactor; i++ {
 		h := c.hash(fmt.Sprintf("%s%d", host, i))
 		c.keys[h] = host
@@ -26,7 +26,7 @@ import (
 const consistentWithBoundedLoadName = "consistent-boundedload"
 
 func init() {
-	core.RegisterSelector(consistentWithBoundedLoadName, NewConsistent)
+	core.RegisterSelector(consistentWithBoundedLoadName, NewConsistentWithBoundedLoad)
 }
 
 type ConsistentWithBoundedLoad struct {
@@ -44,6 +44,10 @@ func NewConsistentWithBoundedLoad(conf interface{}) (core.ISelector, error) {
 	return val, nil
 }
 
+func (c *ConsistentWithBoundedLoad) GetName() string {
+	return consistentWithBoundedLoadName
+}
+
 // It uses Consistent Hashing With Bounded loads
 //
 // https://research.googleblog.com/2017/04/consistent-hashing-with-bounded-loads.html
@@ -15,6 +15,8 @@
 package transport
 
 import (
+	"context"
+	"fmt"
 	"sync"
 
 	"github.com/finogeeks/ligase/core"
@@ -116,3 +118,16 @@ func (t *baseTransport) Start() {
 		return true
 	})
 }
+
+func (t *baseTransport) Ping(ctx context.Context) error {
+	var err error
+	t.channels.Range(func(key, value interface{}) bool {
+		channel := value.(core.IChannel)
+		if e := channel.Ping(ctx); e != nil {
+			err = fmt.Errorf("channel %s: %v", channel.GetID(), e)
+			return false
+		}
+		return true
+	})
+	return err
+}
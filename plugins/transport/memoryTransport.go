@@ -0,0 +1,80 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package transport
+
+import (
+	"log"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/core"
+)
+
+func init() {
+	core.RegisterTransport("memory", NewMemoryTransport)
+}
+
+// NewMemoryTransport passes the messages of its channels in the process, it
+// stands in for kafka when the monolith-server runs on its own
+func NewMemoryTransport(conf interface{}) (core.ITransport, error) {
+	k := new(MemoryTransport)
+	k.bus = common.NewLocalBus()
+	return k, nil
+}
+
+type MemoryTransport struct {
+	baseTransport
+	bus *common.LocalBus
+}
+
+func (t *MemoryTransport) AddChannel(dir int, id, topic, grp string, conf interface{}) bool {
+	_, ok := t.channels.Load(id)
+	if ok {
+		return true
+	}
+
+	channel, err := core.GetChannel("memory", conf)
+	if err != nil {
+		log.Printf("MemoryTransport AddChannel dir:%d id:%s topic:%s grp:%s get channel fail\n", dir, id, topic, grp)
+		return false
+	}
+	channel.Init(t.logPorf)
+	channel.SetDir(dir)
+	channel.SetTopic(topic)
+	channel.SetID(id)
+	channel.SetGroup(grp)
+	if c, ok := channel.(interface{ SetBus(*common.LocalBus) }); ok {
+		c.SetBus(t.bus)
+	}
+
+	t.channels.Store(id, channel)
+
+	log.Printf("MemoryTransport AddChannel dir:%d id:%s topic:%s grp:%s\n", dir, id, topic, grp)
+
+	return true
+}
+
+// Start subscribes the consumers before the producers start, the bus keeps
+// no message for a consumer to come
+func (t *MemoryTransport) Start() {
+	for _, dir := range []int{core.CHANNEL_SUB, core.CHANNEL_PUB} {
+		t.channels.Range(func(key, value interface{}) bool {
+			channel := value.(core.IChannel)
+			if channel.GetDir() == dir {
+				channel.Start()
+			}
+			return true
+		})
+	}
+}
@@ -211,7 +211,6 @@ func (ReqGetFedProfile) FillRequest(coder core.Coder, req *http.Request, vars ma
 }
 func (ReqGetFedProfile) Process(ctx context.Context, ud interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
 	req := msg.(*ReqGetFedProfileRequest)
-	cfg := ud.(*FedApiUserData).Cfg
 	idg := ud.(*FedApiUserData).Idg
 
 	userID := req.UserID
@@ -226,7 +225,7 @@ func (ReqGetFedProfile) Process(ctx context.Context, ud interface{}, msg core.Co
 		return http.StatusBadRequest, jsonerror.InvalidArgumentValue(err.Error())
 	}
 
-	if common.CheckValidDomain(string(domain), cfg.Matrix.ServerName) {
+	if common.IsLocalDomain(string(domain)) {
 		log.Infof("source dest: %s", domain)
 		// return jsonerror.InternalServerError()
 	}
@@ -917,7 +916,6 @@ func (ReqGetFedUserInfo) FillRequest(coder core.Coder, req *http.Request, vars m
 }
 func (ReqGetFedUserInfo) Process(ctx context.Context, ud interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
 	req := msg.(*ReqGetFedUserInfoRequest)
-	cfg := ud.(*FedApiUserData).Cfg
 	idg := ud.(*FedApiUserData).Idg
 
 	userID := req.UserID
@@ -929,7 +927,7 @@ func (ReqGetFedUserInfo) Process(ctx context.Context, ud interface{}, msg core.C
 	if err != nil {
 		return http.StatusBadRequest, jsonerror.InvalidArgumentValue(err.Error())
 	}
-	if common.CheckValidDomain(string(domain), cfg.Matrix.ServerName) {
+	if common.IsLocalDomain(string(domain)) {
 		log.Infof("source dest: %s", domain)
 		// return jsonerror.InternalServerError()
 	}
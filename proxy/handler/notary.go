@@ -41,7 +41,7 @@ func NoticeHandler(ctx context.Context, action, targetDomain string, keyDB model
 		// reqUrl := fmt.Sprintf(config.GetConfig().NotaryService.CertUrl, "dev.finogeeks.club")
 		_, err = DownloadFromNotary(ctx, "cert", reqUrl, keyDB)
 	} else if action == "update" {
-		if common.CheckValidDomain(targetDomain, config.GetConfig().Matrix.ServerName) {
+		if common.IsLocalDomain(targetDomain) {
 			reqUrl = fmt.Sprintf(config.GetConfig().NotaryService.CertUrl, config.GetConfig().Matrix.ServerName[0])
 			// reqUrl = fmt.Sprintf(config.GetConfig().NotaryService.CertUrl, "dev.finogeeks.club")
 			_, err = DownloadFromNotary(ctx, "cert", reqUrl, keyDB)
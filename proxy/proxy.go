@@ -76,8 +76,11 @@ func SetupProxy(
 	//	log.Panicf("proxy load certs failed, err: %v", err)
 	//}
 
+	// the admin flag of the accounts exempts them from the rate limits
+	accountDB := base.CreateAccountsDB()
+
 	routing.Setup(
-		base.APIMux, *base.Cfg, cache, rpcCli, rsRpcCli, tokenFilter, feddomains, keyDB,
+		base.APIMux, *base.Cfg, cache, rpcCli, rsRpcCli, tokenFilter, feddomains, keyDB, accountDB,
 	)
 }
 
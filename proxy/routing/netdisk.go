@@ -145,7 +145,7 @@ func NetDiskDownLoad(
 		return http.StatusMethodNotAllowed
 	}
 
-	if !useFed && !common.CheckValidDomain(service, cfg.Matrix.ServerName) {
+	if !useFed && !common.IsLocalDomain(service) {
 		responseError(w, util.JSONResponse{
 			Code: http.StatusNotFound,
 			JSON: jsonerror.Unknown("Unknown serverName"),
@@ -190,7 +190,7 @@ func NetDiskDownLoad(
 	fromRemoteDomain := false
 	if err != nil {
 		log.Warnf("NetDiskDownLoad http response, err: %v, res: %v", err, res)
-		if !useFed || common.CheckValidDomain(service, cfg.Matrix.ServerName) {
+		if !useFed || common.IsLocalDomain(service) {
 			log.Errorw("download file error", log.KeysAndValues{"mediaId", mediaID, "err", err})
 			responseError(w, util.JSONResponse{
 				Code: http.StatusInternalServerError,
@@ -202,7 +202,7 @@ func NetDiskDownLoad(
 	}
 	if err == nil && res.StatusCode != http.StatusOK {
 		log.Warnf("NetDiskDownLoad http response, err: %v, res: %v", err, res)
-		if !useFed || common.CheckValidDomain(service, cfg.Matrix.ServerName) {
+		if !useFed || common.IsLocalDomain(service) {
 			var errInfo mediatypes.UploadError
 			err = json.NewDecoder(res.Body).Decode(&errInfo)
 			if err != nil {
@@ -34,6 +34,7 @@ import (
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/model/authtypes"
 	"github.com/finogeeks/ligase/model/mediatypes"
+	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/service"
 	"github.com/finogeeks/ligase/model/service/roomserverapi"
 	"github.com/finogeeks/ligase/plugins/message/internals"
@@ -63,9 +64,15 @@ type HttpProcessor struct {
 	feddomains *common.FedDomains
 	keyDB      model.KeyDatabase
 	localCache service.LocalCache
+	limiter    *rateLimiter
+	devActive  *repos.UserDeviceActiveRepo
 	// counter   mon.LabeledCounter
 }
 
+// how often the last ip and user agent of the devices are written to the cache,
+// in milliseconds
+const deviceLastSeenFlush = 60000
+
 func NewHttpProcessor(
 	r *mux.Router, cfg config.Dendrite,
 	cacheIn service.Cache, rpcCli *common.RpcClient,
@@ -74,10 +81,13 @@ func NewHttpProcessor(
 	histogram mon.LabeledHistogram,
 	feddomains *common.FedDomains,
 	keyDB model.KeyDatabase,
+	limiter *rateLimiter,
 	// counter mon.LabeledCounter,
 ) *HttpProcessor {
 	localCache := new(cache.LocalCacheRepo)
 	localCache.Start(1, cfg.Cache.DurationDefault)
+	devActive := repos.NewUserDeviceActiveRepo(deviceLastSeenFlush, false)
+	devActive.SetCache(cacheIn)
 	return &HttpProcessor{
 		router:      r,
 		cfg:         cfg,
@@ -90,6 +100,8 @@ func NewHttpProcessor(
 		feddomains:  feddomains,
 		keyDB:       keyDB,
 		localCache:  localCache,
+		limiter:     limiter,
+		devActive:   devActive,
 		// counter:     counter,
 	}
 }
@@ -121,6 +133,12 @@ func (w *HttpProcessor) Route(path, metricsName, topic string, msgType int32, ap
 	}
 
 	handler := func(req *http.Request, device *authtypes.Device) util.JSONResponse {
+		if res := w.checkRateLimit(req, msgType, device); res != nil {
+			return *res
+		}
+		if device != nil {
+			w.devActive.UpdateDevLastSeen(device.UserID, device.ID, common.GetRemoteIP(req), req.UserAgent())
+		}
 		r, err := newRequest(req)
 		if err != nil {
 			return util.JSONResponse{
@@ -201,6 +219,9 @@ func (w *HttpProcessor) Route(path, metricsName, topic string, msgType int32, ap
 	} else if apiType == apiconsumer.APITypeUpload {
 		w.router.Handle(path,
 			common.MakeAuthAPI(metricsName, w.cacheIn, w.cfg, w.tokenFilter, w.histogram, func(req *http.Request, device *authtypes.Device) util.JSONResponse {
+				if res := w.checkRateLimit(req, msgType, device); res != nil {
+					return *res
+				}
 				return NetDiskUpLoad(req, &w.cfg, device)
 			}),
 		).Methods(methods...)
@@ -255,6 +276,10 @@ func (w *HttpProcessor) Route(path, metricsName, topic string, msgType int32, ap
 	}
 }
 
+func (w *HttpProcessor) checkRateLimit(req *http.Request, msgType int32, device *authtypes.Device) *util.JSONResponse {
+	return w.limiter.check(req, msgType, device)
+}
+
 func (w *HttpProcessor) genInput(coder core.Coder, processor apiconsumer.APIProcessor, device *authtypes.Device) (*internals.InputMsg, error) {
 	input := new(internals.InputMsg)
 	if device != nil {
@@ -280,7 +305,7 @@ func (w *HttpProcessor) ProcessInput(req *http.Request, coder core.Coder, proces
 		}
 	}
 
-	outputMsg, err := w.send(topic, input)
+	outputMsg, err := w.send(req.Context(), topic, input)
 	if err != nil {
 		return util.JSONResponse{
 			Code: http.StatusInternalServerError,
@@ -303,7 +328,7 @@ func (w *HttpProcessor) handleRecv(processor apiconsumer.APIProcessor, outputMsg
 
 	var resp util.JSONResponse
 	resp.Code = outputMsg.Code
-	if resp.Headers != nil {
+	if len(outputMsg.Headers) > 0 {
 		err := json.Unmarshal(outputMsg.Headers, &resp.Headers)
 		if err != nil {
 			return util.JSONResponse{
@@ -330,16 +355,17 @@ func (w *HttpProcessor) handleRecv(processor apiconsumer.APIProcessor, outputMsg
 	return resp
 }
 
-func (w *HttpProcessor) send(topic string, input *internals.InputMsg) (*internals.OutputMsg, error) {
+// send forwards input to the api server of topic, in the trace of the http
+// request
+func (w *HttpProcessor) send(ctx context.Context, topic string, input *internals.InputMsg) (*internals.OutputMsg, error) {
 	bytes, err := input.Encode()
 	if err != nil {
 		return nil, err
 	}
 
-	//span, ctx := common.StartSobSomSpan(context.Background(), topic)
-	//defer span.Finish()
-	//resp, err := w.rpcCli.RequestWithContext(ctx, topic, bytes, 60000000)
-	resp, err := w.rpcCli.Request(topic, bytes, 60000000)
+	span, ctx := common.StartSobSomSpan(ctx, topic)
+	defer span.Finish()
+	resp, err := w.rpcCli.RequestWithContext(ctx, topic, bytes, 60000000)
 	if err != nil {
 		log.Errorf("OutputMsg decode error %s", err.Error())
 		return nil, err
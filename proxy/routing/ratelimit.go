@@ -0,0 +1,322 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/plugins/message/internals"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	util "github.com/finogeeks/ligase/skunkworks/gomatrixutil"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	mon "github.com/finogeeks/ligase/skunkworks/monitor/go-client/monitor"
+	"github.com/finogeeks/ligase/storage/model"
+	"github.com/gorilla/mux"
+)
+
+const (
+	rateLimitSendMessage = "send_message"
+	rateLimitLogin       = "login"
+	rateLimitRegister    = "register"
+	rateLimitMediaUpload = "media_upload"
+	rateLimitJoin        = "join"
+)
+
+// how long the admin flag of an account is trusted before it is read again,
+// and how many accounts are remembered at most
+const (
+	rateLimitAdminTTL     = time.Minute
+	rateLimitAdminEntries = 100000
+)
+
+var (
+	rateLimitedCounter    mon.LabeledCounter
+	rateLimitErrorCounter mon.LabeledCounter
+)
+
+func init() {
+	rateLimitedCounter = mon.GetInstance().NewLabeledCounter("proxy_rate_limited", []string{"class"})
+	rateLimitErrorCounter = mon.GetInstance().NewLabeledCounter("proxy_rate_limit_errors", []string{"class"})
+}
+
+type adminCheck struct {
+	admin  bool
+	expire time.Time
+}
+
+// rateLimiter enforces the token buckets configured in rate_limit. The
+// buckets are kept in redis so a client hitting several proxies is still
+// limited once. The limits follow the reloaded config.
+type rateLimiter struct {
+	cfg       *config.Dendrite
+	cache     service.Cache
+	accountDB model.AccountsDatabase
+	current   func() *config.Reloadable
+
+	mu       sync.Mutex
+	loaded   *config.Reloadable
+	exempt   map[string]bool
+	asTokens map[string]bool
+	trusted  []*net.IPNet
+	admins   map[string]adminCheck
+}
+
+func newRateLimiter(cfg *config.Dendrite, cache service.Cache, accountDB model.AccountsDatabase) *rateLimiter {
+	return &rateLimiter{
+		cfg:       cfg,
+		cache:     cache,
+		accountDB: accountDB,
+		current:   config.GetReloadable,
+		admins:    make(map[string]adminCheck),
+	}
+}
+
+// reloadable returns the config in use, with the exempt users, application
+// service tokens and trusted proxies built from it
+func (r *rateLimiter) reloadable() (*config.Reloadable, map[string]bool, map[string]bool, []*net.IPNet) {
+	cur := r.current()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loaded != cur {
+		r.loaded = cur
+		r.exempt = make(map[string]bool)
+		r.asTokens = make(map[string]bool)
+		r.trusted = nil
+		for _, proxy := range cur.RateLimit.TrustedProxies {
+			if !strings.Contains(proxy, "/") {
+				if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+					proxy += "/32"
+				} else {
+					proxy += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				log.Warnw("rate limit invalid trusted proxy", log.KeysAndValues{"proxy", proxy, "error", err})
+				continue
+			}
+			r.trusted = append(r.trusted, network)
+		}
+		for _, userID := range cur.RateLimit.ExemptUsers {
+			r.exempt[userID] = true
+		}
+		for _, userID := range r.cfg.Authorization.AdminUsers {
+			r.exempt[userID] = true
+		}
+		for _, as := range cur.ApplicationServices {
+			r.asTokens[as.ASToken] = true
+		}
+	}
+	return r.loaded, r.exempt, r.asTokens, r.trusted
+}
+
+func isTrustedProxy(trusted []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address unauthenticated requests are limited by. The
+// X-Forwarded-For header is only read when the peer is a trusted proxy, and
+// the right-most hop which is not a trusted proxy is the client, the hops on
+// its left are made up by the client.
+func clientIP(req *http.Request, trusted []*net.IPNet) string {
+	peer := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if !isTrustedProxy(trusted, peer) {
+		return peer
+	}
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(trusted, hop) {
+			return hop
+		}
+		peer = hop
+	}
+	return peer
+}
+
+// isAdmin tells if the account of userID has the admin flag. The flag is
+// remembered for rateLimitAdminTTL so that a limited request does not cost a
+// database query.
+func (r *rateLimiter) isAdmin(userID string) bool {
+	if r.accountDB == nil {
+		return false
+	}
+	now := time.Now()
+	r.mu.Lock()
+	check, ok := r.admins[userID]
+	r.mu.Unlock()
+	if ok && now.Before(check.expire) {
+		return check.admin
+	}
+
+	account, err := r.accountDB.GetAccount(context.TODO(), userID)
+	if err != nil {
+		log.Warnw("rate limit get account failed", log.KeysAndValues{"user", userID, "error", err})
+		return false
+	}
+	check = adminCheck{admin: account != nil && account.IsAdmin, expire: now.Add(rateLimitAdminTTL)}
+	r.mu.Lock()
+	if len(r.admins) >= rateLimitAdminEntries {
+		r.admins = make(map[string]adminCheck)
+	}
+	r.admins[userID] = check
+	r.mu.Unlock()
+	return check.admin
+}
+
+// rateLimitClass returns the class of the route, or "" if the route is not
+// limited
+func rateLimitClass(msgType int32, vars map[string]string) string {
+	switch msgType {
+	case internals.MSG_PUT_ROOM_SEND_WITH_TYPE_AND_TXNID:
+		return rateLimitSendMessage
+	case internals.MSG_POST_LOGIN, internals.MSG_POST_LOGIN_ADMIN:
+		return rateLimitLogin
+	case internals.MSG_POST_REGISTER, internals.MSG_POST_REGISTER_LEGACY:
+		return rateLimitRegister
+	case internals.MSG_POST_MEDIA_UPLOAD:
+		return rateLimitMediaUpload
+	case internals.MSG_POST_JOIN_ALIAS:
+		return rateLimitJoin
+	case internals.MSG_POST_ROOM_MEMBERSHIP:
+		if vars["membership"] == "join" {
+			return rateLimitJoin
+		}
+	}
+	return ""
+}
+
+func rateLimitConf(rl *config.RateLimitsConf, class string) config.RateLimitConf {
+	switch class {
+	case rateLimitSendMessage:
+		return rl.SendMessage
+	case rateLimitLogin:
+		return rl.Login
+	case rateLimitRegister:
+		return rl.Register
+	case rateLimitMediaUpload:
+		return rl.MediaUpload
+	case rateLimitJoin:
+		return rl.Join
+	}
+	return config.RateLimitConf{}
+}
+
+// isExempt reports whether requests of the user are never limited: exempt
+// users, server admins, application service senders and users in an
+// appservice namespace.
+func (r *rateLimiter) isExempt(cur *config.Reloadable, exempt map[string]bool, userID string) bool {
+	if exempt[userID] {
+		return true
+	}
+	localpart, domain, err := gomatrixserverlib.SplitID('@', userID)
+	if err != nil {
+		return false
+	}
+	for i := range cur.ApplicationServices {
+		as := &cur.ApplicationServices[i]
+		if as.SenderLocalpart == localpart && common.CheckValidDomain(string(domain), cur.ServerName) {
+			return true
+		}
+		if as.IsInterestedInUserID(userID) {
+			return true
+		}
+	}
+	return r.isAdmin(userID)
+}
+
+// check takes a token for the request. It returns nil if the request may go
+// on, or the M_LIMIT_EXCEEDED response to send back.
+func (r *rateLimiter) check(req *http.Request, msgType int32, device *authtypes.Device) *util.JSONResponse {
+	cur, exempt, asTokens, trusted := r.reloadable()
+	if !cur.RateLimit.Enable {
+		return nil
+	}
+	class := rateLimitClass(msgType, mux.Vars(req))
+	if class == "" {
+		return nil
+	}
+	conf := rateLimitConf(&cur.RateLimit, class)
+	if conf.PerSecond <= 0 {
+		return nil
+	}
+	burst := conf.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	var key string
+	if device != nil && device.UserID != "" {
+		if r.isExempt(cur, exempt, device.UserID) {
+			return nil
+		}
+		key = class + ":user:" + device.UserID
+	} else {
+		// unauthenticated appservice requests, e.g. registering a
+		// namespaced user, carry the as_token
+		if token, err := common.ExtractAccessToken(req); err == nil && asTokens[token] {
+			return nil
+		}
+		key = class + ":ip:" + clientIP(req, trusted)
+	}
+
+	retryAfterMS, err := r.cache.TakeRateLimitToken(key, conf.PerSecond, burst)
+	if err != nil {
+		rateLimitErrorCounter.WithLabelValues(class).Inc()
+		log.Errorw("rate limit check failed", log.KeysAndValues{"class", class, "fail_closed", cur.RateLimit.FailClosed, "error", err})
+		if cur.RateLimit.FailClosed {
+			return &util.JSONResponse{
+				Code: http.StatusServiceUnavailable,
+				JSON: jsonerror.Unknown("Rate limit unavailable"),
+			}
+		}
+		// fail open, redis trouble should not take the whole api down
+		return nil
+	}
+	if retryAfterMS <= 0 {
+		return nil
+	}
+
+	rateLimitedCounter.WithLabelValues(class).Inc()
+	return &util.JSONResponse{
+		Code: http.StatusTooManyRequests,
+		JSON: jsonerror.LimitExceeded("Too Many Requests", retryAfterMS),
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package routing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/finogeeks/ligase/cache"
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/jsonerror"
+	"github.com/finogeeks/ligase/model/authtypes"
+	"github.com/finogeeks/ligase/model/service"
+	"github.com/finogeeks/ligase/plugins/message/internals"
+	util "github.com/finogeeks/ligase/skunkworks/gomatrixutil"
+	"github.com/finogeeks/ligase/storage/model"
+)
+
+type fakeAccounts struct {
+	model.AccountsDatabase
+	admins map[string]bool
+	reads  int
+}
+
+func (f *fakeAccounts) GetAccount(ctx context.Context, userID string) (*authtypes.Account, error) {
+	f.reads++
+	return &authtypes.Account{UserID: userID, IsAdmin: f.admins[userID]}, nil
+}
+
+type failingCache struct {
+	service.Cache
+}
+
+func (failingCache) TakeRateLimitToken(key string, perSecond float64, burst int) (int64, error) {
+	return 0, errors.New("redis down")
+}
+
+func newTestLimiter(t *testing.T, rl config.RateLimitsConf, c service.Cache) (*rateLimiter, *fakeAccounts) {
+	if c == nil {
+		rc := &cache.RedisCache{}
+		if err := rc.Prepare(config.RedisConf{Mode: "memory"}); err != nil {
+			t.Fatal(err)
+		}
+		c = rc
+	}
+	cfg := &config.Dendrite{}
+	cfg.Matrix.ServerName = []string{"test"}
+	cfg.Authorization.AdminUsers = []string{"@configadmin:test"}
+	accounts := &fakeAccounts{admins: map[string]bool{"@admin:test": true}}
+	r := newRateLimiter(cfg, c, accounts)
+	cur := &config.Reloadable{ServerName: cfg.Matrix.ServerName, RateLimit: rl}
+	cur.RateLimit.Enable = true
+	cur.ApplicationServices = []config.ApplicationService{{ASToken: "astoken", SenderLocalpart: "bridge"}}
+	r.current = func() *config.Reloadable { return cur }
+	return r, accounts
+}
+
+func sendMessage(r *rateLimiter, userID string) *jsonerror.LimitExceededError {
+	req := httptest.NewRequest(http.MethodPut, "/rooms/!r:test/send/m.room.message/1", nil)
+	var device *authtypes.Device
+	if userID != "" {
+		device = &authtypes.Device{UserID: userID, ID: "DEV"}
+	}
+	res := r.check(req, internals.MSG_PUT_ROOM_SEND_WITH_TYPE_AND_TXNID, device)
+	if res == nil {
+		return nil
+	}
+	return res.JSON.(*jsonerror.LimitExceededError)
+}
+
+func TestRateLimitBucket(t *testing.T) {
+	r, _ := newTestLimiter(t, config.RateLimitsConf{SendMessage: config.RateLimitConf{PerSecond: 1, Burst: 2}}, nil)
+	for i := 0; i < 2; i++ {
+		if res := sendMessage(r, "@TestRateLimitBucket:test"); res != nil {
+			t.Fatalf("request %d limited", i)
+		}
+	}
+	res := sendMessage(r, "@TestRateLimitBucket:test")
+	if res == nil || res.RetryAfterMS <= 0 || res.RetryAfterMS > 1000 {
+		t.Fatalf("third request %+v", res)
+	}
+	if res := sendMessage(r, "@TestRateLimitBucket2:test"); res != nil {
+		t.Fatal("another user shares the bucket")
+	}
+}
+
+func TestRateLimitExempt(t *testing.T) {
+	r, accounts := newTestLimiter(t, config.RateLimitsConf{
+		ExemptUsers: []string{"@exempt:test"},
+		SendMessage: config.RateLimitConf{PerSecond: 0.001, Burst: 1},
+	}, nil)
+	for _, userID := range []string{"@exempt:test", "@configadmin:test", "@admin:test", "@bridge:test"} {
+		for i := 0; i < 3; i++ {
+			if res := sendMessage(r, userID); res != nil {
+				t.Fatalf("%s limited", userID)
+			}
+		}
+	}
+	if accounts.reads != 1 {
+		t.Fatalf("%d account reads, the admin flag is not remembered", accounts.reads)
+	}
+	sendMessage(r, "@TestRateLimitExempt:test")
+	if res := sendMessage(r, "@TestRateLimitExempt:test"); res == nil {
+		t.Fatal("user not limited")
+	}
+}
+
+func TestRateLimitFailure(t *testing.T) {
+	r, _ := newTestLimiter(t, config.RateLimitsConf{SendMessage: config.RateLimitConf{PerSecond: 1, Burst: 1}}, failingCache{})
+	if res := sendMessage(r, "@user:test"); res != nil {
+		t.Fatal("limited when failing open")
+	}
+	r.current().RateLimit.FailClosed = true
+	req := httptest.NewRequest(http.MethodPut, "/", nil)
+	res := r.check(req, internals.MSG_PUT_ROOM_SEND_WITH_TYPE_AND_TXNID, nil)
+	if res == nil || res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("failing closed %+v", res)
+	}
+}
+
+func login(r *rateLimiter, remoteAddr, forwardedFor string) *util.JSONResponse {
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	return r.check(req, internals.MSG_POST_LOGIN, nil)
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	r, _ := newTestLimiter(t, config.RateLimitsConf{
+		TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16"},
+		Login:          config.RateLimitConf{PerSecond: 0.001, Burst: 1},
+	}, nil)
+
+	// the header of a peer which is not a trusted proxy is ignored
+	if res := login(r, "198.51.100.1:1234", "203.0.113.1"); res != nil {
+		t.Fatal("first login limited")
+	}
+	if res := login(r, "198.51.100.1:1234", "203.0.113.2"); res == nil {
+		t.Fatal("a new X-Forwarded-For got past the limit")
+	}
+
+	// behind the proxies the right-most untrusted hop is the client, the
+	// hops on its left are up to the client
+	if res := login(r, "10.0.0.1:1234", "1.1.1.1, 198.51.100.2, 192.168.1.1"); res != nil {
+		t.Fatal("first proxied login limited")
+	}
+	if res := login(r, "10.0.0.1:1234", "2.2.2.2, 198.51.100.2, 192.168.1.1"); res == nil {
+		t.Fatal("a made up hop got past the limit")
+	}
+	if res := login(r, "10.0.0.1:1234", "198.51.100.3"); res != nil {
+		t.Fatal("another client behind the proxy shares the bucket")
+	}
+}
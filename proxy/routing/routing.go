@@ -47,6 +47,7 @@ func Setup(
 	tokenFilter *filter.SimpleFilter,
 	feddomains *common.FedDomains,
 	keyDB model.KeyDatabase,
+	accountDB model.AccountsDatabase,
 ) {
 	monitor := mon.GetInstance()
 	histogram := monitor.NewLabeledHistogram(
@@ -85,14 +86,17 @@ func Setup(
 		"mediaR0":  "/_matrix/media/r0",
 		"mediaV1":  "/_matrix/media/v1",
 		"fedV1":    "/_matrix/federation/v1",
+		"clientV1": "/_matrix/client/v1",
+		"admin":    "/_ligase/admin/v1",
 	}
 
 	muxs := map[string]*mux.Router{}
 	procs := map[string]*HttpProcessor{}
+	limiter := newRateLimiter(&cfg, cacheIn, accountDB)
 	for k, v := range prefixMap {
 		m := apiMux.PathPrefix(v).Subrouter()
 		muxs[k] = m
-		proc := NewHttpProcessor(m, cfg, cacheIn, rpcCli, rsRpcCli, tokenFilter, idg, histogram, feddomains, keyDB /*, counter*/)
+		proc := NewHttpProcessor(m, cfg, cacheIn, rpcCli, rsRpcCli, tokenFilter, idg, histogram, feddomains, keyDB, limiter /*, counter*/)
 		procs[k] = proc
 	}
 
@@ -120,27 +124,4 @@ func Setup(
 		}
 		return true
 	})
-
-	// // r0?
-	// r0Processor.route("/admin/whois/{userId}", "whois", internals.MSG_GET_WHO_IS, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/login/cas/redirect", "cas_redirect", internals.MSG_GET_CAS_LOGIN_REDIRECT, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/login/cas/ticket", "cas_ticket", internals.MSG_GET_CAS_LOGIN_TICKET, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/rooms/{roomId}/report/{eventId}", "room_report", internals.MSG_POST_ROOM_REPORT, http.MethodPost, http.MethodOptions)
-
-	// r0Processor.route("/thirdparty/protocols", "thirdparty_protocols", internals.MSG_GET_THIRDPARTY_PROTOS, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/thirdparty/protocol/{protocol}", "thirdparty_by_name", internals.MSG_GET_THIRDPARTY_PROTO_BY_NAME, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/thirdparty/location/{protocol}", "thirdparty_location_by_name", internals.MSG_GET_THIRDPARTY_LOCATION_BY_PROTO, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/thirdparty/user/{protocol}", "thirdparty_user_by_name", internals.MSG_GET_THIRDPARTY_USER_BY_PROTO, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/thirdparty/location", "thirdparty_location", internals.MSG_GET_THIRDPARTY_LOCATION, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/thirdparty/user", "thirdparty_user", internals.MSG_GET_THIRDPARTY_USER, http.MethodGet, http.MethodOptions)
-
-	// r0Processor.route("/user/{userId}/openid/request_token", "user_openid", internals.MSG_POST_USER_OPENID, http.MethodPost, http.MethodOptions)
 }
@@ -15,19 +15,15 @@
 package consumers
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"github.com/finogeeks/ligase/common/filter"
-	"io/ioutil"
-	"net"
-	"net/http"
 	"sync"
-	"time"
 
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/model/pushapitypes"
+	"github.com/finogeeks/ligase/pushsender/gateway"
 	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
 	"github.com/finogeeks/ligase/storage/model"
 	"github.com/json-iterator/go"
@@ -46,9 +42,9 @@ type PushDataConsumer struct {
 	pushCount  *sync.Map
 	chanSize   uint32
 	//msgChan    []chan *pushapitypes.PushPubContents
-	msgChan    []chan common.ContextMsg
-	httpClient *http.Client
-	lock    	*sync.Mutex
+	msgChan []chan common.ContextMsg
+	backend gateway.Backend
+	lock    *sync.Mutex
 }
 
 func NewPushDataConsumer(
@@ -61,33 +57,19 @@ func NewPushDataConsumer(
 		pushDB:    pushDB,
 		rpcClient: client,
 		chanSize:  16,
-		lock: new(sync.Mutex),
+		lock:      new(sync.Mutex),
 	}
 	s.pushCount = new(sync.Map)
-	s.httpClient = &http.Client{
-		Transport: s.createTransport(),
+	backend, err := gateway.GetBackend(cfg.PushService.Backend, cfg, nil)
+	if err != nil {
+		log.Panicw("failed to create push backend", log.KeysAndValues{"backend", cfg.PushService.Backend, "error", err})
 	}
+	s.backend = backend
 	pushFilter := filter.GetFilterMng().Register("pushSender", nil)
 	s.pushFilter = pushFilter
 	return s
 }
 
-func (s *PushDataConsumer) createTransport() *http.Transport {
-	dialer := &net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
-	}
-	return &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		DialContext:           dialer.DialContext,
-		MaxIdleConns:          200,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		MaxIdleConnsPerHost:   200,
-	}
-}
-
 func (s *PushDataConsumer) GetCB() common.MsgHandlerWithContext {
 	return s.cb
 }
@@ -113,7 +95,6 @@ func (s *PushDataConsumer) cb(ctx context.Context, msg *nats.Msg) {
 
 func (s *PushDataConsumer) startWorker(msgChan chan common.ContextMsg) {
 	for msg := range msgChan {
-		ctx := msg.Ctx
 		data := msg.Msg.(*pushapitypes.PushPubContents)
 		if s.pushFilter.Lookup([]byte(data.Input.EventID)) {
 			log.Infof("PushDataConsumer startWorker lookup eventID:%s len(msgChan):%d", data.Input.EventID, len(msgChan))
@@ -121,6 +102,7 @@ func (s *PushDataConsumer) startWorker(msgChan chan common.ContextMsg) {
 		}
 		log.Infof("start push roomID:%s eventID:%s len(msgChan):%d len(contents):%d", data.Input.RoomID, data.Input.EventID, len(msgChan), len(data.Contents))
 		s.pushFilter.Insert([]byte(data.Input.EventID))
+		span, ctx := common.StartSomSpan(msg.Ctx, "PushDataConsumer.push")
 		for _, content := range data.Contents {
 			s.PushData(
 				ctx,
@@ -135,6 +117,7 @@ func (s *PushDataConsumer) startWorker(msgChan chan common.ContextMsg) {
 				data.CreateContent,
 			)
 		}
+		span.Finish()
 	}
 }
 
@@ -188,153 +171,55 @@ func (s *PushDataConsumer) PushData(
 		}
 	}()
 	for _, pusher := range pushers.Pushers {
-		var content pushapitypes.PushContent
-		err := json.Unmarshal(input.Content, &content.Content)
-		if err != nil {
-			log.Errorf("PushData Unmarshal err: %d  Event: %s", err, string(input.EventID))
-			continue
+		n := &gateway.Notification{
+			Event:             input,
+			Pusher:            pusher,
+			SenderDisplayName: senderDisplayName,
+			RoomName:          roomName,
+			RoomAlias:         roomAlias,
+			UserID:            userID,
+			Action:            action,
+			NotifyCount:       notifyCount,
+			CreateContent:     createContent,
 		}
-
-		userIsTarget := false
-		if (input.StateKey != nil) && (userID == *input.StateKey) {
-			userIsTarget = true
-		}
-
-		var url string
-		pushChannel := "ios"
-		var pusherData interface{}
-		if v, ok := interface{}(pusher.Data).(map[string]interface{}); ok {
-			var data map[string]interface{}
-			data = v
-			if v, ok := data["url"]; ok {
-				url = v.(string)
-			}
-			delete(data, "url")
-			if v, ok := data["push_channel"]; ok {
-				pushChannel = v.(string)
-			}
-			pusherData = data
-		} else {
-			continue
-		}
-
-		if roomName == "" {
-			roomName = senderDisplayName
-		}
-
-		notify := pushapitypes.Notify{
-			Notify: pushapitypes.Notification{
-				EventId:           input.EventID,
-				RoomId:            input.RoomID,
-				Type:              input.Type,
-				Sender:            input.Sender,
-				SenderDisplayName: senderDisplayName,
-				RoomName:          roomName,
-				RoomAlias:         roomAlias,
-				UserIsTarget:      userIsTarget,
-				Priority:          "high",
-				Content:           content.Content,
-				Counts: pushapitypes.Counts{
-					UnRead: notifyCount,
-				},
-				Devices: []pushapitypes.Device{
-					{
-						DeviceID:  pusher.DeviceID,
-						UserName:  pusher.UserName,
-						AppId:     pusher.AppId,
-						PushKey:   pusher.PushKey,
-						PushKeyTs: pusher.PushKeyTs,
-						Data:      pusherData,
-						Tweak: pushapitypes.Tweaks{
-							Sound:     action.Sound,
-							HighLight: action.HighLight,
-						},
-					},
-				},
-				CreateEvent: createContent,
-			},
-		}
-
-		request, err := json.Marshal(notify)
-		if err != nil {
-			log.Errorw("process marshal error", log.KeysAndValues{"err", err})
-			continue
-		}
-
-		if pushChannel == "ios" || pushChannel == "" {
-			if s.cfg.PushService.PushServerUrl != "" {
-				url = s.cfg.PushService.PushServerUrl
-			}
-		} else {
-			if s.cfg.PushService.AndroidPushServerUrl != "" {
-				url = s.cfg.PushService.AndroidPushServerUrl
-			}
-		}
-		go s.doPush(url, request, pusher)
+		go s.doPush(n)
 	}
 }
 
-func (s *PushDataConsumer) doPush(url string, request []byte, pusher pushapitypes.Pusher){
-	code, body, err := s.HttpRequest(url, request)
-	if err != nil {
-		log.Errorw("http request error", log.KeysAndValues{"content", string(request), "error", err})
+func (s *PushDataConsumer) doPush(n *gateway.Notification) {
+	pusher := n.Pusher
+	rejected, err := s.backend.Notify(context.TODO(), n)
+	if err == gateway.ErrSkip {
+		return
+	}
+	if _, ok := err.(*gateway.ErrContent); ok {
+		log.Warnw("push skipped", log.KeysAndValues{"error", err, "appId", pusher.AppId, "pushkey", pusher.PushKey, "eventID", n.Event.EventID})
 		return
 	}
 
 	pusherKey := fmt.Sprintf("%s:%s", pusher.AppId, pusher.PushKey)
 
-	if code != http.StatusOK {
-		log.Errorw("http request error", log.KeysAndValues{"status_code", code, "response", string(body), "appId", pusher.AppId, "pushkey", pusher.PushKey, "content", string(request)})
+	if err != nil {
+		log.Errorw("push gateway request error", log.KeysAndValues{"error", err, "appId", pusher.AppId, "pushkey", pusher.PushKey, "eventID", n.Event.EventID})
 
 		failCount := s.SetPushFailTimes(pusherKey, false)
-		if failCount > s.cfg.PushService.RemoveFailTimes {
+		if failCount > config.GetReloadable().PushService.RemoveFailTimes {
 			log.Warnf("for failed too many del appId:%s, pushKey:%s, display:%s", pusher.AppId, pusher.PushKey, pusher.DeviceDisplayName)
 			if err := s.pushDB.DeletePushersByKey(context.TODO(), pusher.AppId, pusher.PushKey); err != nil {
 				log.Errorw("delete pusher error", log.KeysAndValues{"err", err, "AppId", pusher.AppId, "PushKey", pusher.PushKey})
 			}
 		}
-	} else {
-		//用以追踪IOS重复推送问题
-		log.Infof("push content success, appid:%s, pushkey:%s , content:%s", pusher.AppId, pusher.PushKey, string(request))
-		s.SetPushFailTimes(pusherKey, true)
-
-		var ack pushapitypes.PushAck
-		err = json.Unmarshal(body, &ack)
-		if len(ack.Rejected) > 0 {
-			for _, v := range ack.Rejected {
-				log.Warnf("for reject del pushKey:%s", v)
-				if err := s.pushDB.DeletePushersByKeyOnly(context.TODO(), v); err != nil {
-					log.Errorw("delete pusher error", log.KeysAndValues{"err", err})
-				}
-			}
-		}
-	}
-}
-
-func (s *PushDataConsumer) HttpRequest(
-	reqUrl string,
-	content []byte,
-) (int, []byte, error) {
-	bs := time.Now().UnixNano() / 1000000
-	req, err := http.NewRequest(http.MethodPost, reqUrl, bytes.NewReader(content))
-	if err != nil {
-		return -1, nil, err
+		return
 	}
 
-	req.Close = true
-	req.Header.Set("Content-Type", "application/json")
+	//用以追踪IOS重复推送问题
+	log.Infof("push content success, appid:%s, pushkey:%s, eventID:%s", pusher.AppId, pusher.PushKey, n.Event.EventID)
+	s.SetPushFailTimes(pusherKey, true)
 
-	resp, err := s.httpClient.Do(req)
-	defer func() {
-		if resp != nil && resp.Body != nil {
-			resp.Body.Close()
+	for _, v := range rejected {
+		log.Warnf("for reject del appId:%s pushKey:%s", pusher.AppId, v)
+		if err := s.pushDB.DeletePushersByKey(context.TODO(), pusher.AppId, v); err != nil {
+			log.Errorw("delete pusher error", log.KeysAndValues{"err", err, "AppId", pusher.AppId, "PushKey", v})
 		}
-	}()
-	spend := time.Now().UnixNano()/1000000 - bs
-	log.Infof("post http to push-service spend:%d", spend)
-	if err != nil {
-		return -1, nil, err
 	}
-	b, _ := ioutil.ReadAll(resp.Body)
-	return resp.StatusCode, b, err
 }
@@ -0,0 +1,190 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/pushapitypes"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+const (
+	BackendLegacy = "legacy"
+	BackendMatrix = "matrix"
+)
+
+// Notification carries everything a backend needs to notify one pusher
+// about one event.
+type Notification struct {
+	Event             *gomatrixserverlib.ClientEvent
+	Pusher            pushapitypes.Pusher
+	SenderDisplayName string
+	RoomName          string
+	RoomAlias         string
+	UserID            string
+	Action            *pushapitypes.TweakAction
+	NotifyCount       int64
+	CreateContent     interface{}
+}
+
+func (n *Notification) userIsTarget() bool {
+	return n.Event.StateKey != nil && n.UserID == *n.Event.StateKey
+}
+
+// pusherData returns a copy of the pusher data so backends may strip
+// server-side keys without touching the cached pusher.
+func (n *Notification) pusherData() (map[string]interface{}, bool) {
+	v, ok := n.Pusher.Data.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	data := make(map[string]interface{}, len(v))
+	for key, val := range v {
+		data[key] = val
+	}
+	return data, true
+}
+
+// ErrStatus is returned when the gateway answers with a non-200 status.
+type ErrStatus struct {
+	Code int
+	Body []byte
+}
+
+func (e *ErrStatus) Error() string {
+	return fmt.Sprintf("push gateway responded with status %d: %s", e.Code, string(e.Body))
+}
+
+// ErrContent is returned when the event content cannot be decoded. The
+// event is at fault, not the gateway, so it does not count as a failure of
+// the pusher either.
+type ErrContent struct {
+	Err error
+}
+
+func (e *ErrContent) Error() string {
+	return fmt.Sprintf("malformed event content: %v", e.Err)
+}
+
+// ErrSkip is returned when a backend cannot handle a pusher, e.g. because
+// of its kind or a missing url. It does not count as a gateway failure.
+var ErrSkip = errors.New("pusher skipped by backend")
+
+// Backend delivers notifications to a push gateway.
+type Backend interface {
+	// Notify sends the notification and returns the pushkeys the gateway
+	// rejected; those pushers must be removed by the caller.
+	Notify(ctx context.Context, n *Notification) (rejected []string, err error)
+}
+
+var regBackendMu sync.RWMutex
+var newBackendHandler = make(map[string]func(cfg *config.Dendrite, client *http.Client) (Backend, error))
+
+func RegisterBackend(name string, f func(cfg *config.Dendrite, client *http.Client) (Backend, error)) {
+	regBackendMu.Lock()
+	defer regBackendMu.Unlock()
+
+	if f == nil {
+		log.Panicf("push backend Register: %s func nil", name)
+	}
+	if _, ok := newBackendHandler[name]; ok {
+		log.Panicf("push backend Register: %s already registered", name)
+	}
+
+	newBackendHandler[name] = f
+}
+
+// GetBackend builds the backend called name, defaulting to the legacy
+// relay when name is empty.
+func GetBackend(name string, cfg *config.Dendrite, client *http.Client) (Backend, error) {
+	if name == "" {
+		name = BackendLegacy
+	}
+
+	regBackendMu.RLock()
+	f := newBackendHandler[name]
+	regBackendMu.RUnlock()
+	if f == nil {
+		return nil, errors.New("unknown push backend " + name)
+	}
+	if client == nil {
+		client = NewHTTPClient()
+	}
+
+	return f(cfg, client)
+}
+
+func NewHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          200,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			MaxIdleConnsPerHost:   200,
+		},
+	}
+}
+
+// postNotify posts body to reqUrl and decodes the rejected pushkeys of a
+// successful response.
+func postNotify(ctx context.Context, client *http.Client, reqUrl string, body []byte) ([]string, error) {
+	bs := time.Now().UnixNano() / 1000000
+	req, err := http.NewRequest(http.MethodPost, reqUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	spend := time.Now().UnixNano()/1000000 - bs
+	log.Infof("post http to push gateway:%s spend:%d", reqUrl, spend)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ErrStatus{Code: resp.StatusCode, Body: b}
+	}
+
+	var ack pushapitypes.PushAck
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &ack); err != nil {
+			log.Warnf("push gateway:%s returned invalid ack: %v", reqUrl, err)
+		}
+	}
+	return ack.Rejected, nil
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/pushapitypes"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+)
+
+func newTestNotification(url, format string) *Notification {
+	data := map[string]interface{}{"url": url}
+	if format != "" {
+		data["format"] = format
+	}
+	return &Notification{
+		Event: &gomatrixserverlib.ClientEvent{
+			EventID: "$ev1:test",
+			RoomID:  "!room:test",
+			Type:    "m.room.message",
+			Sender:  "@alice:test",
+			Content: []byte(`{"msgtype":"m.text","body":"hello"}`),
+		},
+		Pusher: pushapitypes.Pusher{
+			Kind:    "http",
+			AppId:   "com.example.app",
+			PushKey: "key1",
+			Data:    data,
+		},
+		SenderDisplayName: "Alice",
+		RoomName:          "Room",
+		UserID:            "@bob:test",
+		Action:            &pushapitypes.TweakAction{Notify: "notify", Sound: "default"},
+		NotifyCount:       2,
+	}
+}
+
+func TestMatrixBackendNotify(t *testing.T) {
+	g := NewStubGateway()
+	defer g.Close()
+
+	backend, err := GetBackend(BackendMatrix, &config.Dendrite{}, nil)
+	if err != nil {
+		t.Fatalf("GetBackend: %v", err)
+	}
+	rejected, err := backend.Notify(context.Background(), newTestNotification(g.URL(), ""))
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(rejected) != 0 {
+		t.Errorf("want no rejected pushkeys, got %v", rejected)
+	}
+
+	received := g.Received()
+	if len(received) != 1 {
+		t.Fatalf("want 1 notification, got %d", len(received))
+	}
+	n := received[0].Notification
+	if n.EventId != "$ev1:test" || n.Sender != "@alice:test" || n.Content == nil || n.Counts.UnRead != 2 {
+		t.Errorf("unexpected notification %+v", n)
+	}
+	if len(n.Devices) != 1 || n.Devices[0].PushKey != "key1" || n.Devices[0].Tweaks == nil {
+		t.Fatalf("unexpected devices %+v", n.Devices)
+	}
+	if data, _ := n.Devices[0].Data.(map[string]interface{}); data["url"] != nil {
+		t.Errorf("url must be stripped from device data, got %v", data)
+	}
+}
+
+func TestMatrixBackendEventIDOnly(t *testing.T) {
+	g := NewStubGateway()
+	defer g.Close()
+
+	backend, _ := GetBackend(BackendMatrix, &config.Dendrite{}, nil)
+	if _, err := backend.Notify(context.Background(), newTestNotification(g.URL(), FormatEventIDOnly)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	n := g.Received()[0].Notification
+	if n.EventId != "$ev1:test" || n.RoomId != "!room:test" {
+		t.Errorf("event_id_only must keep event and room id, got %+v", n)
+	}
+	if n.Sender != "" || n.Content != nil || n.Type != "" || n.SenderDisplayName != "" {
+		t.Errorf("event_id_only must not leak event details, got %+v", n)
+	}
+}
+
+func TestMatrixBackendRejected(t *testing.T) {
+	g := NewStubGateway()
+	defer g.Close()
+	g.Reject("key1")
+
+	backend, _ := GetBackend(BackendMatrix, &config.Dendrite{}, nil)
+	rejected, err := backend.Notify(context.Background(), newTestNotification(g.URL(), ""))
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(rejected) != 1 || rejected[0] != "key1" {
+		t.Errorf("want [key1] rejected, got %v", rejected)
+	}
+}
+
+func TestMatrixBackendStatusError(t *testing.T) {
+	g := NewStubGateway()
+	defer g.Close()
+	g.SetStatus(http.StatusBadGateway)
+
+	backend, _ := GetBackend(BackendMatrix, &config.Dendrite{}, nil)
+	_, err := backend.Notify(context.Background(), newTestNotification(g.URL(), ""))
+	if e, ok := err.(*ErrStatus); !ok || e.Code != http.StatusBadGateway {
+		t.Errorf("want ErrStatus 502, got %v", err)
+	}
+}
+
+func TestMatrixBackendSkipsWithoutUrl(t *testing.T) {
+	backend, _ := GetBackend(BackendMatrix, &config.Dendrite{}, nil)
+	if _, err := backend.Notify(context.Background(), newTestNotification("", "")); err != ErrSkip {
+		t.Errorf("want ErrSkip, got %v", err)
+	}
+}
+
+func TestBackendsMalformedContent(t *testing.T) {
+	g := NewStubGateway()
+	defer g.Close()
+
+	for _, name := range []string{BackendLegacy, BackendMatrix} {
+		backend, _ := GetBackend(name, &config.Dendrite{}, nil)
+		n := newTestNotification(g.URL(), "")
+		n.Event.Content = []byte(`{"body":`)
+		if _, err := backend.Notify(context.Background(), n); err == nil {
+			t.Errorf("%s: no error", name)
+		} else if _, ok := err.(*ErrContent); !ok {
+			t.Errorf("%s: want ErrContent, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/pushapitypes"
+)
+
+func init() {
+	RegisterBackend(BackendLegacy, NewLegacyBackend)
+}
+
+// LegacyBackend posts the proprietary notification payload to the
+// configured ios/android relay.
+type LegacyBackend struct {
+	cfg    *config.Dendrite
+	client *http.Client
+}
+
+func NewLegacyBackend(cfg *config.Dendrite, client *http.Client) (Backend, error) {
+	return &LegacyBackend{cfg: cfg, client: client}, nil
+}
+
+func (b *LegacyBackend) Notify(ctx context.Context, n *Notification) ([]string, error) {
+	var content interface{}
+	if err := json.Unmarshal(n.Event.Content, &content); err != nil {
+		return nil, &ErrContent{Err: err}
+	}
+
+	data, ok := n.pusherData()
+	if !ok {
+		return nil, ErrSkip
+	}
+	var url string
+	if v, ok := data["url"].(string); ok {
+		url = v
+	}
+	delete(data, "url")
+	pushChannel := "ios"
+	if v, ok := data["push_channel"].(string); ok {
+		pushChannel = v
+	}
+
+	roomName := n.RoomName
+	if roomName == "" {
+		roomName = n.SenderDisplayName
+	}
+
+	notify := pushapitypes.Notify{
+		Notify: pushapitypes.Notification{
+			EventId:           n.Event.EventID,
+			RoomId:            n.Event.RoomID,
+			Type:              n.Event.Type,
+			Sender:            n.Event.Sender,
+			SenderDisplayName: n.SenderDisplayName,
+			RoomName:          roomName,
+			RoomAlias:         n.RoomAlias,
+			UserIsTarget:      n.userIsTarget(),
+			Priority:          "high",
+			Content:           content,
+			Counts: pushapitypes.Counts{
+				UnRead: n.NotifyCount,
+			},
+			Devices: []pushapitypes.Device{
+				{
+					DeviceID:  n.Pusher.DeviceID,
+					UserName:  n.Pusher.UserName,
+					AppId:     n.Pusher.AppId,
+					PushKey:   n.Pusher.PushKey,
+					PushKeyTs: n.Pusher.PushKeyTs,
+					Data:      data,
+					Tweak: pushapitypes.Tweaks{
+						Sound:     n.Action.Sound,
+						HighLight: n.Action.HighLight,
+					},
+				},
+			},
+			CreateEvent: n.CreateContent,
+		},
+	}
+
+	request, err := json.Marshal(notify)
+	if err != nil {
+		return nil, err
+	}
+
+	pushService := config.GetReloadable().PushService
+	if pushChannel == "ios" || pushChannel == "" {
+		if pushService.PushServerUrl != "" {
+			url = pushService.PushServerUrl
+		}
+	} else {
+		if pushService.AndroidPushServerUrl != "" {
+			url = pushService.AndroidPushServerUrl
+		}
+	}
+	if url == "" {
+		return nil, ErrSkip
+	}
+
+	return postNotify(ctx, b.client, url, request)
+}
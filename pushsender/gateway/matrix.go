@@ -0,0 +1,122 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/model/pushapitypes"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+const (
+	NotifyPath = "/_matrix/push/v1/notify"
+
+	FormatEventIDOnly = "event_id_only"
+)
+
+func init() {
+	RegisterBackend(BackendMatrix, NewMatrixBackend)
+}
+
+// MatrixBackend implements the push gateway API, so any Sygnal-compatible
+// gateway can be used.
+type MatrixBackend struct {
+	cfg    *config.Dendrite
+	client *http.Client
+}
+
+func NewMatrixBackend(cfg *config.Dendrite, client *http.Client) (Backend, error) {
+	return &MatrixBackend{cfg: cfg, client: client}, nil
+}
+
+func (b *MatrixBackend) Notify(ctx context.Context, n *Notification) ([]string, error) {
+	if n.Pusher.Kind != "" && n.Pusher.Kind != "http" {
+		log.Warnf("matrix push backend skip pusher kind:%s appId:%s", n.Pusher.Kind, n.Pusher.AppId)
+		return nil, ErrSkip
+	}
+
+	data, ok := n.pusherData()
+	if !ok {
+		data = map[string]interface{}{}
+	}
+	url, _ := data["url"].(string)
+	delete(data, "url")
+	if url == "" {
+		url = config.GetReloadable().PushService.GatewayUrl
+	}
+	if url == "" {
+		log.Warnf("matrix push backend no url for appId:%s pushkey:%s", n.Pusher.AppId, n.Pusher.PushKey)
+		return nil, ErrSkip
+	}
+	format, _ := data["format"].(string)
+
+	notify, err := b.buildNotify(n, data, format)
+	if err != nil {
+		return nil, err
+	}
+	request, err := json.Marshal(notify)
+	if err != nil {
+		return nil, err
+	}
+
+	return postNotify(ctx, b.client, url, request)
+}
+
+func (b *MatrixBackend) buildNotify(n *Notification, data map[string]interface{}, format string) (*pushapitypes.GatewayNotify, error) {
+	device := pushapitypes.GatewayDevice{
+		AppId:     n.Pusher.AppId,
+		PushKey:   n.Pusher.PushKey,
+		PushKeyTs: n.Pusher.PushKeyTs,
+		Data:      data,
+	}
+	if n.Action != nil && (n.Action.Sound != "" || n.Action.HighLight) {
+		device.Tweaks = &pushapitypes.Tweaks{
+			Sound:     n.Action.Sound,
+			HighLight: n.Action.HighLight,
+		}
+	}
+
+	notify := &pushapitypes.GatewayNotify{
+		Notification: pushapitypes.GatewayNotification{
+			EventId:  n.Event.EventID,
+			RoomId:   n.Event.RoomID,
+			Priority: "high",
+			Counts: pushapitypes.GatewayCounts{
+				UnRead: n.NotifyCount,
+			},
+			Devices: []pushapitypes.GatewayDevice{device},
+		},
+	}
+	if format == FormatEventIDOnly {
+		return notify, nil
+	}
+
+	var content interface{}
+	if err := json.Unmarshal(n.Event.Content, &content); err != nil {
+		return nil, &ErrContent{Err: err}
+	}
+	notify.Notification.Type = n.Event.Type
+	notify.Notification.Sender = n.Event.Sender
+	notify.Notification.SenderDisplayName = n.SenderDisplayName
+	notify.Notification.RoomName = n.RoomName
+	notify.Notification.RoomAlias = n.RoomAlias
+	notify.Notification.UserIsTarget = n.userIsTarget()
+	notify.Notification.Content = content
+	return notify, nil
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/finogeeks/ligase/model/pushapitypes"
+)
+
+// StubGateway is an in-process push gateway which records every
+// notification it receives. Pushkeys added with Reject are reported back
+// as rejected. It is meant for tests and local development.
+type StubGateway struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	received []pushapitypes.GatewayNotify
+	rejected map[string]bool
+	status   int
+}
+
+func NewStubGateway() *StubGateway {
+	g := &StubGateway{
+		rejected: make(map[string]bool),
+		status:   http.StatusOK,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(NotifyPath, g.handleNotify)
+	g.server = httptest.NewServer(mux)
+	return g
+}
+
+// URL returns the notify endpoint to use as a pusher's data.url.
+func (g *StubGateway) URL() string {
+	return g.server.URL + NotifyPath
+}
+
+func (g *StubGateway) Close() {
+	g.server.Close()
+}
+
+func (g *StubGateway) Reject(pushKey string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rejected[pushKey] = true
+}
+
+// SetStatus makes the gateway answer every request with code.
+func (g *StubGateway) SetStatus(code int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.status = code
+}
+
+func (g *StubGateway) Received() []pushapitypes.GatewayNotify {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	res := make([]pushapitypes.GatewayNotify, len(g.received))
+	copy(res, g.received)
+	return res
+}
+
+func (g *StubGateway) handleNotify(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var notify pushapitypes.GatewayNotify
+	if err := json.Unmarshal(body, &notify); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.status != http.StatusOK {
+		w.WriteHeader(g.status)
+		return
+	}
+	g.received = append(g.received, notify)
+	ack := pushapitypes.PushAck{Rejected: []string{}}
+	for _, device := range notify.Notification.Devices {
+		if g.rejected[device.PushKey] {
+			ack.Rejected = append(ack.Rejected, device.PushKey)
+		}
+	}
+	resp, _ := json.Marshal(ack)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
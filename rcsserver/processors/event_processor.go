@@ -253,7 +253,7 @@ func (p *EventProcessor) handleInvite(
 		return nil, errors.New("State key is nil")
 	}
 	domain, _ := common.DomainFromID(ev.Sender())
-	if common.CheckValidDomain(domain, p.cfg.Matrix.ServerName) {
+	if common.IsLocalDomain(domain) {
 		return p.handleLocalInvite(ctx, ev)
 	}
 	return p.handleFedInvite(ctx, ev)
@@ -488,7 +488,7 @@ func (p *EventProcessor) handleNormalMembership(
 	f, err := p.db.GetFriendshipByRoomID(ctx, roomID)
 	if err != nil {
 		// Special case: leave deleted room, only for remote domain.
-		if p.db.NotFound(err) && op == OP_LEAVE && !common.CheckValidDomain(domain, p.cfg.Matrix.ServerName) {
+		if p.db.NotFound(err) && op == OP_LEAVE && !common.IsLocalDomain(domain) {
 			return []gomatrixserverlib.Event{*ev}, nil
 		}
 		log.Errorf("Failed to get friendship: %v\n", err)
@@ -517,7 +517,7 @@ func (p *EventProcessor) handleNormalMembership(
 
 	var evs []gomatrixserverlib.Event
 	// Special case: leaved member invite another member, only for local domain.
-	if common.CheckValidDomain(domain, p.cfg.Matrix.ServerName) &&
+	if common.IsLocalDomain(domain) &&
 		senderSt == ST_LEAVE && op == OP_INVITE && sender != stateKey {
 		log.Infoln("rcsserver=====================EventProcessor.handleNormalMembership, leaved member invite another member")
 		// events: invite myself, join, invite another(if he leaved).
@@ -188,6 +188,7 @@ func TestHandleCreate(t *testing.T) {
 	sender := "@aa:" + domainID
 	var cfg config.Dendrite
 	cfg.Matrix.ServerName = []string{domainID}
+	config.SetConfig(&cfg)
 	idg, _ := uid.NewDefaultIdGenerator(0)
 	var dbIface interface{}
 	var db MockFriendshipDatabase
@@ -224,6 +225,7 @@ func TestHandleLocalInvite(t *testing.T) {
 	toFcID2 := fcID1
 	var cfg config.Dendrite
 	cfg.Matrix.ServerName = []string{domainID}
+	config.SetConfig(&cfg)
 	idg, _ := uid.NewDefaultIdGenerator(0)
 	nid1, _ := idg.Next()
 	nid2, _ := idg.Next()
@@ -418,6 +420,7 @@ func TestHandleFedInvite(t *testing.T) {
 	toFcID2 := fcID1
 	var cfg config.Dendrite
 	cfg.Matrix.ServerName = []string{domainID2}
+	config.SetConfig(&cfg)
 	idg, _ := uid.NewDefaultIdGenerator(0)
 	nid1, _ := idg.Next()
 	nid2, _ := idg.Next()
@@ -711,6 +714,7 @@ func TestNormalMembership(t *testing.T) {
 	toFcID := "@fcID2:" + domainID
 	var cfg config.Dendrite
 	cfg.Matrix.ServerName = []string{domainID}
+	config.SetConfig(&cfg)
 	idg, _ := uid.NewDefaultIdGenerator(0)
 	nid, _ := idg.Next()
 	roomID := fmt.Sprintf("!%d:%s", nid, domainID)
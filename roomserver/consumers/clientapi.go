@@ -119,9 +119,7 @@ func (s *InputRoomEventConsumer) OnMessage(ctx context.Context, topic string, pa
 	idx := common.CalcStringHashCode(roomId) % s.chanSize
 
 	//log.Infof("InputRoomEventConsumer room:%s slot:%d all:%d have:%d cap:%d", roomId, idx, s.chanSize, len(s.msgChan[idx]), cap(s.msgChan[idx]))
-	span := common.StartSpanFromMsgAfterReceived(topic, rawMsg)
-	span.Finish()
-	ctx = common.ContextWithSpan(ctx, span)
+	// ctx holds the span of the channel, processEvent starts its child
 	s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: &input}
 	//log.Infof("InputRoomEventConsumer room:%s write slot:%d all:%d", roomId, idx, s.chanSize)
 
@@ -157,6 +155,8 @@ func (s *InputRoomEventConsumer) cb(ctx context.Context, msg *nats.Msg) {
 
 //worker, replay when needed
 func (s *InputRoomEventConsumer) processEvent(ctx context.Context, input *roomserverapi.RawEvent) error {
+	span, ctx := common.StartSomSpan(ctx, "InputRoomEventConsumer.processEvent")
+	defer span.Finish()
 	log.Infof("------------------------client-api processEvent start roomId:%s len:%d", input.RoomID, len(input.BulkEvents.Events))
 	begin := time.Now()
 	last := begin
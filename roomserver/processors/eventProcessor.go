@@ -235,6 +235,8 @@ func (r *EventsProcessor) processRoomEvent(
 		return r.processRoomNewEvent(ctx, event, trustedJSON, txnID, svrName)
 	} else if kind == roomserverapi.KindBackfill {
 		return r.processBackfill(ctx, event, txnID, svrName)
+	} else if kind == roomserverapi.KindImport {
+		return r.processRoomImportEvent(ctx, event, txnID, svrName)
 	} else {
 		log.Infof("processRoomEvent unknown type: %d", kind)
 	}
@@ -253,6 +255,9 @@ func (r *EventsProcessor) processRoomNewEvent(
 		spend := time.Now().UnixNano() / 1000000 - bs
 		log.Infof("processRoomNewEvent roomID:%s eventId:%s type:%s spend:%d", ev.RoomID(), ev.EventID(), ev.Type(), spend)
 	}(bs, event)
+	if err := r.checkRoomBlocked(&event); err != nil {
+		return err
+	}
 	lockProcess := common.IsStateEv(&event)
 	if lockProcess {
 		lockKey := types.LOCK_ROOMSTATE_PREFIX + event.RoomID()
@@ -314,7 +319,7 @@ func (r *EventsProcessor) processRoomNewEvent(
 				return err
 			}
 			bs = time.Now().UnixNano() / 1000000
-			err := r.processNew(ctx, ev, txnID, svrName, trustedJSON, rs)
+			err := r.processNew(ctx, ev, txnID, svrName, trustedJSON, rs, roomserverapi.KindNew)
 			spend = time.Now().UnixNano()/1000000 - bs
 			log.Infof("processRoomNewEvent processNew roomid:%s spend:%d ms", event.RoomID(), spend)
 			if err != nil {
@@ -331,7 +336,7 @@ func (r *EventsProcessor) processRoomNewEvent(
 			return err
 		}
 		bs = time.Now().UnixNano() / 1000000
-		err = r.processNew(ctx, event, txnID, svrName, trustedJSON, rs)
+		err = r.processNew(ctx, event, txnID, svrName, trustedJSON, rs, roomserverapi.KindNew)
 		spend = time.Now().UnixNano()/1000000 - bs
 		log.Infof("processRoomNewEvent processNew roomid:%s spend:%d ms", event.RoomID(), spend)
 		return err
@@ -339,6 +344,55 @@ func (r *EventsProcessor) processRoomNewEvent(
 	return nil
 }
 
+// processRoomImportEvent applies an event imported from another homeserver's
+// history. The event is trusted and goes through the same path as a new event,
+// without the direct room and federated invite handling.
+func (r *EventsProcessor) processRoomImportEvent(
+	ctx context.Context,
+	event gomatrixserverlib.Event,
+	txnID *roomservertypes.TransactionID,
+	svrName string,
+) error {
+	if common.IsStateEv(&event) {
+		lockKey := types.LOCK_ROOMSTATE_PREFIX + event.RoomID()
+		token, err := r.Repo.GetCache().Lock(lockKey, adapter.GetDistLockCfg().LockRoomState.Timeout, adapter.GetDistLockCfg().LockRoomState.Wait)
+		if err != nil {
+			log.Errorf("dist lock key:%s token:%s err:%v", lockKey, token, err)
+		}
+		defer func() {
+			if err := r.Repo.GetCache().UnLock(lockKey, token, adapter.GetDistLockCfg().LockRoomState.Force); err != nil {
+				log.Errorf("dist unlock key:%s token:%s err:%v", lockKey, token, err)
+			}
+		}()
+	}
+	rs := r.Repo.GetRoomState(ctx, event.RoomID())
+	if rs == nil && event.Type() != gomatrixserverlib.MRoomCreate {
+		return errors.New("Room not found")
+	}
+	return r.processNew(ctx, event, txnID, svrName, true, rs, roomserverapi.KindImport)
+}
+
+// checkRoomBlocked refuses new members in rooms blocked by an admin, members
+// may still leave or be kicked
+func (r *EventsProcessor) checkRoomBlocked(event *gomatrixserverlib.Event) error {
+	if event.Type() != gomatrixserverlib.MRoomMember {
+		return nil
+	}
+	membership, err := event.Membership()
+	if err != nil || (membership != "join" && membership != "invite") {
+		return nil
+	}
+	blockedBy, err := r.Repo.GetCache().GetRoomBlocked(event.RoomID())
+	if err != nil {
+		log.Errorf("EventsProcessor check room:%s blocked error %v", event.RoomID(), err)
+		return nil
+	}
+	if blockedBy != "" {
+		return errors.New("room is blocked")
+	}
+	return nil
+}
+
 func (r *EventsProcessor) processDirectRoomCreateOrMemberEvent(
 	ctx context.Context,
 	event gomatrixserverlib.Event,
@@ -385,7 +439,7 @@ func (r *EventsProcessor) processFedInvite(ctx context.Context, event gomatrixse
 	}
 	sender := event.Sender()
 	senderDomain, _ := common.DomainFromID(sender)
-	if !common.CheckValidDomain(senderDomain, r.Cfg.Matrix.ServerName) {
+	if !common.IsLocalDomain(senderDomain) {
 		return event, nil
 	}
 	content := map[string]interface{}{}
@@ -413,7 +467,7 @@ func (r *EventsProcessor) processFedInvite(ctx context.Context, event gomatrixse
 		return event, errors.New("invitee Id must be in the form '@localpart:domain'")
 	}
 
-	if !common.CheckValidDomain(inviteeDomain, r.Cfg.Matrix.ServerName) {
+	if !common.IsLocalDomain(inviteeDomain) {
 		//TODO federation auto join
 		type UnsingedInviteStates struct {
 			States []gomatrixserverlib.Event `json:"invite_room_state"`
@@ -448,6 +502,7 @@ func (r *EventsProcessor) processNew(
 	svrName string,
 	trustedJSON bool,
 	rs *repos.RoomServerState,
+	kind int,
 ) error {
 	bs := time.Now().UnixNano() / 1000000
 	defer func(bs int64, ev gomatrixserverlib.Event){
@@ -532,7 +587,7 @@ func (r *EventsProcessor) processNew(
 	log.Debugf("------------------------processNew set-state %v", time.Now().Sub(last))
 	last = time.Now()
 
-	err = r.postProcessNew(ctx, &event, preEv, eventNID, roomNID, rs, svrName, txnID, curSnap)
+	err = r.postProcessNew(ctx, &event, preEv, eventNID, roomNID, rs, svrName, txnID, curSnap, kind)
 	log.Infof("------------------------processRoomEvent roomid:%s ev-graph-update %v ", event.RoomID(), time.Now().Sub(last))
 	return err
 }
@@ -680,6 +735,7 @@ func (r *EventsProcessor) postProcessNew(
 	sendServer string,
 	transactionID *roomservertypes.TransactionID,
 	curSnap int64,
+	kind int,
 ) error {
 	bs := time.Now().UnixNano() / 1000000
 	defer func(bs int64, ev gomatrixserverlib.Event){
@@ -700,7 +756,7 @@ func (r *EventsProcessor) postProcessNew(
 		r.Repo.FlushRoomState(rs)
 		log.Infof("postProcessNew FlushRoomState roomid:%s spend %v", event.RoomID(), time.Now().Sub(last))
 	}
-	if common.CheckValidDomain(sendDomain, r.Cfg.Matrix.ServerName) && event.OriginServerTS() == 0 {
+	if common.IsLocalDomain(sendDomain) && event.OriginServerTS() == 0 {
 		event.SetOriginServerTS(gomatrixserverlib.AsTimestamp(time.Now()))
 	}
 	ore := r.buildOutputRoomEvent(transactionID, sendServer, rs, *event, pre)
@@ -739,7 +795,9 @@ func (r *EventsProcessor) postProcessNew(
 		return err
 	}
 	last = time.Now()
-	if common.CheckValidDomain(sendDomain, r.Cfg.Matrix.ServerName) == true {
+	if kind == roomserverapi.KindImport {
+		// imported history is already known to the other servers in the room
+	} else if common.IsLocalDomain(sendDomain) == true {
 		domains := rs.GetDomainTlMap()
 		hasFed := false
 		domains.Range(func(key, value interface{}) bool {
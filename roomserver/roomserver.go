@@ -18,6 +18,8 @@
 package roomserver
 
 import (
+	"context"
+
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/basecomponent"
 	"github.com/finogeeks/ligase/common/filter"
@@ -59,6 +61,7 @@ func SetupRoomServerComponent(
 	roomserverDB.SetIDGenerator(idg)
 	repo := repos.NewRoomServerCurStateRepo(roomserverDB, repoCache, queryHitCounter)
 	umsRepo := repos.NewRoomServerUserMembershipRepo(roomserverDB, repoCache, queryHitCounter)
+	loadBlockedRooms(roomserverDB, repoCache)
 
 	inputAPI := processors.EventsProcessor{
 		DB:         roomserverDB,
@@ -116,6 +119,22 @@ func SetupRoomServerComponent(
 	return &inputAPI, rsRpcCli, roomserverDB
 }
 
+// loadBlockedRooms copies the blocked rooms to the cache, joins and invites
+// are checked against the cache only
+func loadBlockedRooms(db model.RoomServerDatabase, cache service.Cache) {
+	roomIDs, blockedBy, err := db.GetBlockedRooms(context.Background())
+	if err != nil {
+		log.Errorf("roomserver load blocked rooms error %v", err)
+		return
+	}
+	for i, roomID := range roomIDs {
+		if err := cache.SetRoomBlocked(roomID, blockedBy[i]); err != nil {
+			log.Errorf("roomserver cache blocked room %s error %v", roomID, err)
+		}
+	}
+	log.Infof("roomserver loaded %d blocked rooms", len(roomIDs))
+}
+
 func FixCorruptRooms(
 	base *basecomponent.BaseDendrite,
 ) {
@@ -18,6 +18,7 @@ import (
 	"context"
 	"github.com/finogeeks/ligase/model/types"
 
+	"github.com/finogeeks/ligase/appservice/query"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/model/repos"
@@ -127,6 +128,17 @@ func (s *RoomAliasRpcConsumer) processGetAliasRoomID(
 	var response roomserverapi.GetAliasRoomIDResponse
 
 	s.Proc.GetAliasRoomID(ctx, request, &response)
+	if response.RoomID == "" && query.IsRoomAliasInterested(s.cfg, request.Alias) {
+		// the application service may take a while to create the room, don't
+		// hold up the other lookups queued behind this one
+		go func() {
+			if query.RoomAliasExists(ctx, s.cfg, request.Alias) {
+				s.Proc.GetAliasRoomID(ctx, request, &response)
+			}
+			s.rpcClient.PubObj(reply, response)
+		}()
+		return
+	}
 	s.rpcClient.PubObj(reply, response)
 }
 
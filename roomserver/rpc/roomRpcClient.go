@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/finogeeks/ligase/appservice/query"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
 	"github.com/finogeeks/ligase/common/uid"
@@ -114,7 +115,11 @@ func (c *RoomserverRpcClient) GetAliasRoomID( //fed & cli
 ) error {
 	if c.aliase != nil {
 		log.Infof("-------RoomserverRpcClient GetAliasRoomID direct call")
-		return c.aliase.GetAliasRoomID(ctx, req, response)
+		err := c.aliase.GetAliasRoomID(ctx, req, response)
+		if err == nil && response.RoomID == "" && query.RoomAliasExists(ctx, c.cfg, req.Alias) {
+			err = c.aliase.GetAliasRoomID(ctx, req, response)
+		}
+		return err
 	}
 
 	content := roomserverapi.RoomserverAliasRequest{
@@ -276,9 +281,10 @@ func (c *RoomserverRpcClient) InputRoomEvents(
 			c.cfg.Kafka.Producer.InputRoomEvent.Underlying,
 			c.cfg.Kafka.Producer.InputRoomEvent.Name,
 			&core.TransportPubMsg{
-				Keys: []byte(rawEvent.RoomID),
-				Obj:  rawEvent,
-				Inst: c.cfg.Kafka.Producer.InputRoomEvent.Inst,
+				Keys:    []byte(rawEvent.RoomID),
+				Obj:     rawEvent,
+				Inst:    c.cfg.Kafka.Producer.InputRoomEvent.Inst,
+				Headers: common.InjectSpanToHeaderForSending(span),
 			})
 	}
 
@@ -288,7 +294,7 @@ func (c *RoomserverRpcClient) InputRoomEvents(
 	}
 
 	log.Errorf("-------RoomserverRpcClient InputRoomEvents request topic:%s val:%s", c.cfg.Rpc.RoomInputTopic, string(bytes))
-	data, err := c.rpcClient.Request(c.cfg.Rpc.RoomInputTopic, bytes, 3000+len(rawEvent.BulkEvents.Events)*1000)
+	data, err := c.rpcClient.RequestWithContext(ctx, c.cfg.Rpc.RoomInputTopic, bytes, 3000+len(rawEvent.BulkEvents.Events)*1000)
 	if err != nil {
 		return 0, err
 	}
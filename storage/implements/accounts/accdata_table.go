@@ -62,10 +62,6 @@ type accountDataStatements struct {
 	recoverAccountDataStmt     *sql.Stmt
 }
 
-func (s *accountDataStatements) getSchema() string {
-	return accountDataSchema
-}
-
 func (s *accountDataStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.insertAccountDataStmt, err = d.db.Prepare(insertAccountDataSQL); err != nil {
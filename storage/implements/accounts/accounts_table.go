@@ -46,6 +46,17 @@ CREATE TABLE IF NOT EXISTS account_accounts (
 CREATE UNIQUE INDEX IF NOT EXISTS account_accounts_user_id ON account_accounts(user_id);
 `
 
+// accountsFlagsSchema adds the flags of the admin API
+const accountsFlagsSchema = `
+ALTER TABLE account_accounts ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE account_accounts ADD COLUMN IF NOT EXISTS locked BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+// accountsShadowBanSchema adds the shadow ban flag of the admin API
+const accountsShadowBanSchema = `
+ALTER TABLE account_accounts ADD COLUMN IF NOT EXISTS shadow_banned BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
 const insertAccountSQL = "" +
 	"INSERT INTO account_accounts(user_id, created_ts, password_hash, app_service_id) VALUES ($1, $2, $3, $4)" +
 	"ON CONFLICT (user_id) DO NOTHING"
@@ -54,7 +65,33 @@ const selectAccountsCountSQL = "" +
 	"SELECT count(1) FROM account_accounts"
 
 const selectAccountSQL = "" +
-	"SELECT user_id, app_service_id FROM account_accounts WHERE user_id = $1"
+	"SELECT user_id, created_ts, app_service_id, is_admin, locked, shadow_banned FROM account_accounts WHERE user_id = $1"
+
+const selectAccountsSQL = "" +
+	"SELECT a.user_id, a.created_ts, COALESCE(a.app_service_id, ''), a.is_admin, a.locked, a.shadow_banned," +
+	" COALESCE(p.display_name, ''), COALESCE(p.avatar_url, '')" +
+	" FROM account_accounts a LEFT JOIN account_profiles p ON a.user_id = p.user_id" +
+	" WHERE a.user_id ILIKE $1 OR p.display_name ILIKE $1" +
+	" ORDER BY a.user_id LIMIT $2 OFFSET $3"
+
+const selectAccountsSearchCountSQL = "" +
+	"SELECT count(1) FROM account_accounts a LEFT JOIN account_profiles p ON a.user_id = p.user_id" +
+	" WHERE a.user_id ILIKE $1 OR p.display_name ILIKE $1"
+
+const updateAccountAdminSQL = "" +
+	"UPDATE account_accounts SET is_admin = $1 WHERE user_id = $2"
+
+const updateAccountLockedSQL = "" +
+	"UPDATE account_accounts SET locked = $1 WHERE user_id = $2"
+
+const selectShadowBannedAccountsSQL = "" +
+	"SELECT user_id FROM account_accounts WHERE shadow_banned"
+
+const updateAccountShadowBannedSQL = "" +
+	"UPDATE account_accounts SET shadow_banned = $1 WHERE user_id = $2"
+
+const updatePasswordSQL = "" +
+	"UPDATE account_accounts SET password_hash = $1 WHERE user_id = $2"
 
 const selectActualCountSQL = "" +
 	"SELECT count(1) FROM account_accounts where app_service_id = 'actual'"
@@ -69,10 +106,14 @@ type accountsStatements struct {
 	selectAccountStmt       *sql.Stmt
 	selectActualCountStmt   *sql.Stmt
 	updateAccountStmt       *sql.Stmt
-}
 
-func (s *accountsStatements) getSchema() string {
-	return accountsSchema
+	selectAccountsStmt            *sql.Stmt
+	selectAccountsSearchCountStmt *sql.Stmt
+	updateAccountAdminStmt        *sql.Stmt
+	updateAccountLockedStmt       *sql.Stmt
+	updateAccountShadowBannedStmt *sql.Stmt
+	selectShadowBannedStmt        *sql.Stmt
+	updatePasswordStmt            *sql.Stmt
 }
 
 func (s *accountsStatements) prepare(d *Database) (err error) {
@@ -92,6 +133,27 @@ func (s *accountsStatements) prepare(d *Database) (err error) {
 	if s.updateAccountStmt, err = d.db.Prepare(updateAccountSQL); err != nil {
 		return
 	}
+	if s.selectAccountsStmt, err = d.db.Prepare(selectAccountsSQL); err != nil {
+		return
+	}
+	if s.selectAccountsSearchCountStmt, err = d.db.Prepare(selectAccountsSearchCountSQL); err != nil {
+		return
+	}
+	if s.updateAccountAdminStmt, err = d.db.Prepare(updateAccountAdminSQL); err != nil {
+		return
+	}
+	if s.updateAccountLockedStmt, err = d.db.Prepare(updateAccountLockedSQL); err != nil {
+		return
+	}
+	if s.updateAccountShadowBannedStmt, err = d.db.Prepare(updateAccountShadowBannedSQL); err != nil {
+		return
+	}
+	if s.selectShadowBannedStmt, err = d.db.Prepare(selectShadowBannedAccountsSQL); err != nil {
+		return
+	}
+	if s.updatePasswordStmt, err = d.db.Prepare(updatePasswordSQL); err != nil {
+		return
+	}
 	return
 }
 
@@ -104,7 +166,7 @@ func (s *accountsStatements) selectAccount(ctx context.Context, userID string) (
 	var account authtypes.Account
 	defer rows.Close()
 	for rows.Next() {
-		if err := rows.Scan(&account.UserID, &account.AppServiceID); err != nil {
+		if err := rows.Scan(&account.UserID, &account.CreatedTs, &account.AppServiceID, &account.IsAdmin, &account.Locked, &account.ShadowBanned); err != nil {
 			return nil, err
 		}
 	}
@@ -181,3 +243,79 @@ func (s *accountsStatements) selectActualTotal(
 	err = s.selectActualCountStmt.QueryRowContext(ctx).Scan(&count)
 	return
 }
+
+// selectAccounts pages through the accounts whose user id or display name
+// matches the ILIKE pattern, it also returns the number of matches
+func (s *accountsStatements) selectAccounts(
+	ctx context.Context, pattern string, limit, offset int,
+) ([]authtypes.Account, int, error) {
+	var total int
+	if err := s.selectAccountsSearchCountStmt.QueryRowContext(ctx, pattern).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.selectAccountsStmt.QueryContext(ctx, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	accounts := []authtypes.Account{}
+	for rows.Next() {
+		var account authtypes.Account
+		var profile authtypes.Profile
+		if err := rows.Scan(
+			&account.UserID, &account.CreatedTs, &account.AppServiceID, &account.IsAdmin, &account.Locked, &account.ShadowBanned,
+			&profile.DisplayName, &profile.AvatarURL,
+		); err != nil {
+			return nil, 0, err
+		}
+		profile.UserID = account.UserID
+		account.Profile = &profile
+		accounts = append(accounts, account)
+	}
+	return accounts, total, rows.Err()
+}
+
+func (s *accountsStatements) updateAccountAdmin(
+	ctx context.Context, userID string, admin bool,
+) error {
+	_, err := s.updateAccountAdminStmt.ExecContext(ctx, admin, userID)
+	return err
+}
+
+func (s *accountsStatements) updateAccountLocked(
+	ctx context.Context, userID string, locked bool,
+) error {
+	_, err := s.updateAccountLockedStmt.ExecContext(ctx, locked, userID)
+	return err
+}
+
+func (s *accountsStatements) updateAccountShadowBanned(
+	ctx context.Context, userID string, banned bool,
+) error {
+	_, err := s.updateAccountShadowBannedStmt.ExecContext(ctx, banned, userID)
+	return err
+}
+
+func (s *accountsStatements) selectShadowBannedAccounts(ctx context.Context) ([]string, error) {
+	rows, err := s.selectShadowBannedStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	userIDs := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+func (s *accountsStatements) updatePassword(
+	ctx context.Context, userID, hash string,
+) error {
+	_, err := s.updatePasswordStmt.ExecContext(ctx, hash, userID)
+	return err
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/finogeeks/ligase/model/authtypes"
+)
+
+const auditEventsSchema = `
+-- Append-only log of the security relevant actions, each event carries the
+-- hash of the previous one
+CREATE TABLE IF NOT EXISTS account_audit_events (
+    seq BIGINT NOT NULL PRIMARY KEY,
+    ts BIGINT NOT NULL,
+    type TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    device_id TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    room_id TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_audit_events_user_id_idx ON account_audit_events(user_id, seq);
+CREATE INDEX IF NOT EXISTS account_audit_events_ts_idx ON account_audit_events(ts);
+
+-- The last event of the log, locked while an event is appended so the
+-- writers of all the servers chain their events one after the other
+CREATE TABLE IF NOT EXISTS account_audit_head (
+    id INTEGER NOT NULL PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    hash TEXT NOT NULL
+);
+
+INSERT INTO account_audit_head (id, seq, hash) VALUES (1, 0, '') ON CONFLICT (id) DO NOTHING;
+`
+
+const selectAuditHeadSQL = "" +
+	"SELECT seq, hash FROM account_audit_head WHERE id = 1 FOR UPDATE"
+
+const updateAuditHeadSQL = "" +
+	"UPDATE account_audit_head SET seq = $1, hash = $2 WHERE id = 1"
+
+const insertAuditEventSQL = "" +
+	"INSERT INTO account_audit_events (seq, ts, type, user_id, device_id, ip, target, room_id, success, details, prev_hash, hash)" +
+	" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)"
+
+const selectAuditEventsSQL = "" +
+	"SELECT seq, ts, type, user_id, device_id, ip, target, room_id, success, details, prev_hash, hash FROM account_audit_events" +
+	" WHERE seq > $1 AND ($2 = '' OR user_id = $2) AND ($3 = '' OR type = $3) AND ts >= $4 AND ($5 = 0 OR ts < $5)" +
+	" ORDER BY seq LIMIT $6"
+
+type auditEventsStatements struct {
+	db                    *Database
+	selectAuditHeadStmt   *sql.Stmt
+	updateAuditHeadStmt   *sql.Stmt
+	insertAuditEventStmt  *sql.Stmt
+	selectAuditEventsStmt *sql.Stmt
+}
+
+func (s *auditEventsStatements) prepare(d *Database) (err error) {
+	s.db = d
+	if s.selectAuditHeadStmt, err = d.db.Prepare(selectAuditHeadSQL); err != nil {
+		return
+	}
+	if s.updateAuditHeadStmt, err = d.db.Prepare(updateAuditHeadSQL); err != nil {
+		return
+	}
+	if s.insertAuditEventStmt, err = d.db.Prepare(insertAuditEventSQL); err != nil {
+		return
+	}
+	if s.selectAuditEventsStmt, err = d.db.Prepare(selectAuditEventsSQL); err != nil {
+		return
+	}
+	return
+}
+
+// insertAuditEvent appends ev to the log, setting its seq and hashes
+func (s *auditEventsStatements) insertAuditEvent(ctx context.Context, ev *authtypes.AuditEvent) (err error) {
+	details := ""
+	if len(ev.Details) > 0 {
+		data, err := json.Marshal(ev.Details)
+		if err != nil {
+			return err
+		}
+		details = string(data)
+	}
+
+	tx, err := s.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback() // nolint: errcheck
+		}
+	}()
+
+	var seq int64
+	var prevHash string
+	if err = tx.StmtContext(ctx, s.selectAuditHeadStmt).QueryRowContext(ctx).Scan(&seq, &prevHash); err != nil {
+		return err
+	}
+	ev.Seq = seq + 1
+	ev.PrevHash = prevHash
+	ev.Hash = ev.ChainHash(prevHash)
+	if _, err = tx.StmtContext(ctx, s.insertAuditEventStmt).ExecContext(
+		ctx, ev.Seq, ev.Ts, ev.Type, ev.UserID, ev.DeviceID, ev.IP, ev.Target, ev.RoomID, ev.Success, details, ev.PrevHash, ev.Hash,
+	); err != nil {
+		return err
+	}
+	if _, err = tx.StmtContext(ctx, s.updateAuditHeadStmt).ExecContext(ctx, ev.Seq, ev.Hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *auditEventsStatements) selectAuditEvents(ctx context.Context, filter *authtypes.AuditFilter) ([]authtypes.AuditEvent, error) {
+	rows, err := s.selectAuditEventsStmt.QueryContext(
+		ctx, filter.From, filter.UserID, filter.Type, filter.Since, filter.Until, filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	events := []authtypes.AuditEvent{}
+	for rows.Next() {
+		var ev authtypes.AuditEvent
+		var details string
+		if err = rows.Scan(
+			&ev.Seq, &ev.Ts, &ev.Type, &ev.UserID, &ev.DeviceID, &ev.IP, &ev.Target, &ev.RoomID, &ev.Success, &details, &ev.PrevHash, &ev.Hash,
+		); err != nil {
+			return nil, err
+		}
+		if details != "" {
+			if err = json.Unmarshal([]byte(details), &ev.Details); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
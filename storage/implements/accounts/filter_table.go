@@ -55,10 +55,6 @@ type filterStatements struct {
 	recoverFilterStmt *sql.Stmt
 }
 
-func (s *filterStatements) getSchema() string {
-	return filterSchema
-}
-
 func (s *filterStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.insertFilterStmt, err = d.db.Prepare(insertFilterSQL); err != nil {
@@ -0,0 +1,53 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import "github.com/finogeeks/ligase/common"
+
+// migrations of the accounts database, append the schema changes
+var migrations = []common.Migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		Up: accountsSchema +
+			profilesSchema +
+			accountDataSchema +
+			filterSchema +
+			roomTagsSchema +
+			userInfoSchema +
+			threepidSchema +
+			registrationTokensSchema,
+	},
+	{
+		Version:     2,
+		Description: "account admin and locked flags",
+		Up:          accountsFlagsSchema,
+	},
+	{
+		Version:     3,
+		Description: "audit log",
+		Up:          auditEventsSchema,
+	},
+	{
+		Version:     4,
+		Description: "account shadow ban flag",
+		Up:          accountsShadowBanSchema,
+	},
+	{
+		Version:     5,
+		Description: "single sign-on identities",
+		Up:          ssoIdentitiesSchema,
+	},
+}
@@ -80,10 +80,6 @@ type profilesStatements struct {
 	selectProfileStmt     *sql.Stmt
 }
 
-func (s *profilesStatements) getSchema() string {
-	return profilesSchema
-}
-
 func (s *profilesStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.upsertProfileStmt, err = d.db.Prepare(upsertProfileSQL); err != nil {
@@ -58,10 +58,6 @@ type roomTagsStatements struct {
 	recoverRoomTagsStmt     *sql.Stmt
 }
 
-func (s *roomTagsStatements) getSchema() string {
-	return roomTagsSchema
-}
-
 func (s *roomTagsStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.insertRoomTagsStmt, err = d.db.Prepare(insertRoomTagsSQL); err != nil {
@@ -0,0 +1,84 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const ssoIdentitiesSchema = `
+-- Identities of single sign-on providers linked to an account. A login
+-- through single sign-on only reaches the account its identity is linked to,
+-- existing accounts are linked by inserting a row.
+CREATE TABLE IF NOT EXISTS account_sso_identities (
+    -- the CAS server url or the SAML identity provider entity id
+    idp TEXT NOT NULL,
+    -- the CAS user or the SAML NameID
+    subject TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    added_ts BIGINT NOT NULL,
+    PRIMARY KEY (idp, subject)
+);
+CREATE INDEX IF NOT EXISTS account_sso_identities_user_id_idx ON account_sso_identities(user_id);
+`
+
+const insertSSOIdentitySQL = "" +
+	"INSERT INTO account_sso_identities (idp, subject, user_id, added_ts) VALUES ($1, $2, $3, $4)" +
+	" ON CONFLICT (idp, subject) DO NOTHING"
+
+const selectSSOIdentityUserSQL = "" +
+	"SELECT user_id FROM account_sso_identities WHERE idp = $1 AND subject = $2"
+
+type ssoIdentitiesStatements struct {
+	db                        *Database
+	insertSSOIdentityStmt     *sql.Stmt
+	selectSSOIdentityUserStmt *sql.Stmt
+}
+
+func (s *ssoIdentitiesStatements) prepare(d *Database) (err error) {
+	s.db = d
+	if s.insertSSOIdentityStmt, err = d.db.Prepare(insertSSOIdentitySQL); err != nil {
+		return
+	}
+	if s.selectSSOIdentityUserStmt, err = d.db.Prepare(selectSSOIdentityUserSQL); err != nil {
+		return
+	}
+	return
+}
+
+// insertSSOIdentity returns false if the identity is already linked
+func (s *ssoIdentitiesStatements) insertSSOIdentity(
+	ctx context.Context, idp, subject, userID string,
+) (bool, error) {
+	res, err := s.insertSSOIdentityStmt.ExecContext(ctx, idp, subject, userID, time.Now().UnixNano()/1000000)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *ssoIdentitiesStatements) selectSSOIdentityUser(
+	ctx context.Context, idp, subject string,
+) (string, error) {
+	var userID string
+	err := s.selectSSOIdentityUserStmt.QueryRowContext(ctx, idp, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
@@ -20,6 +20,7 @@ package accounts
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/finogeeks/ligase/common"
@@ -34,7 +35,7 @@ import (
 )
 
 func init() {
-	common.Register("accounts", NewDatabase)
+	common.Register("accounts", NewDatabase, migrations...)
 }
 
 // Database represents an account database
@@ -48,6 +49,10 @@ type Database struct {
 	filter      filterStatements
 	tags        roomTagsStatements
 	userInfo    userInfoStatements
+	threepids   threepidStatements
+	regTokens   registrationTokensStatements
+	audit       auditEventsStatements
+	ssoIDs      ssoIdentitiesStatements
 	AsyncSave   bool
 
 	qryDBGauge mon.LabeledGauge
@@ -69,12 +74,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	acc.db.SetMaxIdleConns(30)
 	acc.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{acc.accounts.getSchema(), acc.profiles.getSchema(), acc.accountData.getSchema(), acc.filter.getSchema(), acc.tags.getSchema(), acc.userInfo.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := acc.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(acc.db, driver, "accounts"); err != nil {
+		return nil, err
 	}
 
 	if err = acc.accounts.prepare(acc); err != nil {
@@ -95,6 +96,18 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	if err = acc.userInfo.prepare(acc); err != nil {
 		return nil, err
 	}
+	if err = acc.threepids.prepare(acc); err != nil {
+		return nil, err
+	}
+	if err = acc.regTokens.prepare(acc); err != nil {
+		return nil, err
+	}
+	if err = acc.audit.prepare(acc); err != nil {
+		return nil, err
+	}
+	if err = acc.ssoIDs.prepare(acc); err != nil {
+		return nil, err
+	}
 
 	acc.AsyncSave = useAsync
 	acc.underlying = underlying
@@ -107,6 +120,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) RecoverCache() {
 	span, ctx := common.StartSobSomSpan(context.Background(), "RecoverCache")
 	defer span.Finish()
@@ -259,6 +276,47 @@ func (d *Database) InsertAccount(
 	return d.accounts.insertAccount(ctx, userID, hash, appServiceID)
 }
 
+// GetAccounts pages through the accounts whose user id or display name
+// contains search, all accounts if search is empty
+func (d *Database) GetAccounts(
+	ctx context.Context, search string, limit, offset int,
+) ([]authtypes.Account, int, error) {
+	pattern := "%"
+	if search != "" {
+		pattern = "%" + likeEscaper.Replace(search) + "%"
+	}
+	return d.accounts.selectAccounts(ctx, pattern, limit, offset)
+}
+
+// The admin flags and the password are written straight to the db, an admin
+// expects them to apply to the very next request.
+
+func (d *Database) SetAccountAdmin(ctx context.Context, userID string, admin bool) error {
+	return d.accounts.updateAccountAdmin(ctx, userID, admin)
+}
+
+func (d *Database) SetAccountLocked(ctx context.Context, userID string, locked bool) error {
+	return d.accounts.updateAccountLocked(ctx, userID, locked)
+}
+
+func (d *Database) SetAccountShadowBanned(ctx context.Context, userID string, banned bool) error {
+	return d.accounts.updateAccountShadowBanned(ctx, userID, banned)
+}
+
+func (d *Database) GetShadowBannedAccounts(ctx context.Context) ([]string, error) {
+	return d.accounts.selectShadowBannedAccounts(ctx)
+}
+
+func (d *Database) SetPassword(ctx context.Context, userID, plaintextPassword string) error {
+	hash, err := hashPassword(plaintextPassword)
+	if err != nil {
+		return err
+	}
+	return d.accounts.updatePassword(ctx, userID, hash)
+}
+
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
 func hashPassword(plaintext string) (hash string, err error) {
 	hashBytes, err := bcrypt.GenerateFromPassword([]byte(plaintext), bcrypt.DefaultCost)
 	return string(hashBytes), err
@@ -422,3 +480,88 @@ func (d *Database) OnDeleteUserInfo(
 ) error {
 	return d.userInfo.onDeleteUserInfo(ctx, userID)
 }
+
+func (d *Database) InsertThreePIDSession(ctx context.Context, session *authtypes.ThreePIDSession) error {
+	return d.threepids.insertThreePIDSession(ctx, session)
+}
+
+func (d *Database) GetThreePIDSession(ctx context.Context, sessionID string) (*authtypes.ThreePIDSession, error) {
+	return d.threepids.selectThreePIDSession(ctx, sessionID)
+}
+
+func (d *Database) GetThreePIDSessionBySecret(ctx context.Context, clientSecret, medium, address string) (*authtypes.ThreePIDSession, error) {
+	return d.threepids.selectThreePIDSessionBySecret(ctx, clientSecret, medium, address)
+}
+
+func (d *Database) UpdateThreePIDSessionAttempt(ctx context.Context, sessionID string, sendAttempt int, token string, createdTs int64) error {
+	return d.threepids.updateThreePIDSessionAttempt(ctx, sessionID, sendAttempt, token, createdTs)
+}
+
+func (d *Database) ValidateThreePIDSession(ctx context.Context, sessionID string, validatedTs int64) error {
+	return d.threepids.updateThreePIDSessionValidated(ctx, sessionID, validatedTs)
+}
+
+func (d *Database) DeleteThreePIDSessionsBefore(ctx context.Context, ts int64) error {
+	return d.threepids.deleteThreePIDSessionsBefore(ctx, ts)
+}
+
+func (d *Database) InsertThreePID(ctx context.Context, threepid *authtypes.ThreePID) (bool, error) {
+	return d.threepids.insertThreePID(ctx, threepid)
+}
+
+func (d *Database) GetThreePIDsByUser(ctx context.Context, userID string) ([]authtypes.ThreePID, error) {
+	return d.threepids.selectThreePIDsByUser(ctx, userID)
+}
+
+func (d *Database) GetThreePIDUser(ctx context.Context, medium, address string) (string, error) {
+	return d.threepids.selectThreePIDUser(ctx, medium, address)
+}
+
+func (d *Database) DeleteThreePID(ctx context.Context, userID, medium, address string) (bool, error) {
+	return d.threepids.deleteThreePID(ctx, userID, medium, address)
+}
+
+func (d *Database) InsertRegistrationToken(ctx context.Context, token *authtypes.RegistrationToken) (bool, error) {
+	return d.regTokens.insertRegistrationToken(ctx, token)
+}
+
+func (d *Database) GetRegistrationToken(ctx context.Context, token string) (*authtypes.RegistrationToken, error) {
+	return d.regTokens.selectRegistrationToken(ctx, token)
+}
+
+func (d *Database) GetRegistrationTokens(ctx context.Context) ([]authtypes.RegistrationToken, error) {
+	return d.regTokens.selectRegistrationTokens(ctx)
+}
+
+func (d *Database) DeleteRegistrationToken(ctx context.Context, token string) (bool, error) {
+	return d.regTokens.deleteRegistrationToken(ctx, token)
+}
+
+func (d *Database) UseRegistrationToken(ctx context.Context, token string, now int64) (bool, error) {
+	return d.regTokens.useRegistrationToken(ctx, token, now)
+}
+
+func (d *Database) ReleaseRegistrationToken(ctx context.Context, token string) error {
+	return d.regTokens.releaseRegistrationToken(ctx, token)
+}
+
+// InsertSSOIdentity links the identity subject of the provider idp to
+// userID, false is returned if it is already linked
+func (d *Database) InsertSSOIdentity(ctx context.Context, idp, subject, userID string) (bool, error) {
+	return d.ssoIDs.insertSSOIdentity(ctx, idp, subject, userID)
+}
+
+// GetSSOIdentityUser returns the user the identity is linked to, or an empty
+// string
+func (d *Database) GetSSOIdentityUser(ctx context.Context, idp, subject string) (string, error) {
+	return d.ssoIDs.selectSSOIdentityUser(ctx, idp, subject)
+}
+
+// InsertAuditEvent appends ev to the audit log, its seq and hashes are set
+func (d *Database) InsertAuditEvent(ctx context.Context, ev *authtypes.AuditEvent) error {
+	return d.audit.insertAuditEvent(ctx, ev)
+}
+
+func (d *Database) GetAuditEvents(ctx context.Context, filter *authtypes.AuditFilter) ([]authtypes.AuditEvent, error) {
+	return d.audit.selectAuditEvents(ctx, filter)
+}
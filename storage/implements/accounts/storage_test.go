@@ -0,0 +1,157 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/model/authtypes"
+	_ "github.com/finogeeks/ligase/storage/sqlite"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	db, err := NewDatabase(common.SQLiteDriver, "", "file:"+filepath.Join(t.TempDir(), "account.db"), "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db.(*Database)
+}
+
+func TestAccounts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	for _, userID := range []string{"@alice:x", "@bob:x", "@al_ice:x"} {
+		if _, err := db.CreateAccount(ctx, userID, "secret", "", ""); err != nil {
+			t.Fatalf("create %s: %v", userID, err)
+		}
+	}
+	// creating it again does nothing
+	if _, err := db.CreateAccount(ctx, "@bob:x", "secret", "", ""); err != nil {
+		t.Fatalf("create @bob:x again: %v", err)
+	}
+
+	if err := db.SetAccountAdmin(ctx, "@bob:x", true); err != nil {
+		t.Fatal(err)
+	}
+	acc, err := db.GetAccount(ctx, "@bob:x")
+	if err != nil || !acc.IsAdmin || acc.Locked {
+		t.Fatalf("get @bob:x = %+v, %v", acc, err)
+	}
+
+	accs, total, err := db.GetAccounts(ctx, "AL_", 10, 0)
+	if err != nil || total != 1 || len(accs) != 1 || accs[0].UserID != "@al_ice:x" {
+		t.Fatalf("search AL_ = %v, %d, %v", accs, total, err)
+	}
+	accs, total, err = db.GetAccounts(ctx, "", 2, 1)
+	if err != nil || total != 3 || len(accs) != 2 {
+		t.Fatalf("page 2 = %v, %d, %v", accs, total, err)
+	}
+}
+
+func TestAccountData(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	if err := db.SaveAccountData(ctx, "@alice:x", "", "m.push_rules", `{"a":1}`); err != nil {
+		t.Fatal(err)
+	}
+	// an upsert
+	if err := db.SaveAccountData(ctx, "@alice:x", "", "m.push_rules", `{"a":2}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpsertProfileSync(ctx, "@alice:x", "Alice", "mxc://x/a"); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := db.GetProfileByUserID(ctx, "@alice:x")
+	if err != nil || profile.DisplayName != "Alice" || profile.AvatarURL != "mxc://x/a" {
+		t.Fatalf("profile = %+v, %v", profile, err)
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	for i, ev := range []authtypes.AuditEvent{
+		{Ts: 100, Type: authtypes.AuditLogin, UserID: "@alice:x", DeviceID: "D1", IP: "10.0.0.1", Success: true},
+		{Ts: 200, Type: authtypes.AuditLogin, UserID: "@bob:x", Success: false, Details: map[string]string{"reason": "wrong password"}},
+		{Ts: 300, Type: authtypes.AuditBan, UserID: "@alice:x", Target: "@bob:x", RoomID: "!r:x", Success: true},
+	} {
+		if err := db.InsertAuditEvent(ctx, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Seq != int64(i+1) || ev.Hash == "" {
+			t.Fatalf("inserted %+v", ev)
+		}
+	}
+
+	events, err := db.GetAuditEvents(ctx, &authtypes.AuditFilter{Limit: 10})
+	if err != nil || len(events) != 3 {
+		t.Fatalf("get all = %v, %v", events, err)
+	}
+	if events[0].PrevHash != "" || events[1].PrevHash != events[0].Hash || events[1].Details["reason"] != "wrong password" {
+		t.Fatalf("events not chained %+v", events)
+	}
+	if seq := authtypes.VerifyAuditChain(events, true); seq != 0 {
+		t.Fatalf("chain broken at %d", seq)
+	}
+
+	events, err = db.GetAuditEvents(ctx, &authtypes.AuditFilter{From: 1, Limit: 10, UserID: "@alice:x"})
+	if err != nil || len(events) != 1 || events[0].Type != authtypes.AuditBan {
+		t.Fatalf("get alice from 1 = %v, %v", events, err)
+	}
+	events, err = db.GetAuditEvents(ctx, &authtypes.AuditFilter{Limit: 10, Type: authtypes.AuditLogin, Since: 150, Until: 300})
+	if err != nil || len(events) != 1 || events[0].UserID != "@bob:x" {
+		t.Fatalf("get logins in [150, 300) = %v, %v", events, err)
+	}
+
+	// a changed or a removed event no longer verifies
+	events, _ = db.GetAuditEvents(ctx, &authtypes.AuditFilter{Limit: 10})
+	events[1].Success = true
+	if seq := authtypes.VerifyAuditChain(events, true); seq != 2 {
+		t.Fatalf("changed chain verified up to %d", seq)
+	}
+	events, _ = db.GetAuditEvents(ctx, &authtypes.AuditFilter{Limit: 10})
+	events = append(events[:1], events[2:]...)
+	if seq := authtypes.VerifyAuditChain(events, true); seq != 3 {
+		t.Fatalf("chain missing an event verified up to %d", seq)
+	}
+	if seq := authtypes.VerifyAuditChain(events, false); seq != 0 {
+		t.Fatalf("filtered chain broken at %d", seq)
+	}
+}
+
+func TestSSOIdentities(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	if ok, err := db.InsertSSOIdentity(ctx, "https://idp", "alice", "@alice:x"); err != nil || !ok {
+		t.Fatalf("link alice = %v, %v", ok, err)
+	}
+	// an identity stays linked to its first account
+	if ok, err := db.InsertSSOIdentity(ctx, "https://idp", "alice", "@mallory:x"); err != nil || ok {
+		t.Fatalf("link alice again = %v, %v", ok, err)
+	}
+	if userID, err := db.GetSSOIdentityUser(ctx, "https://idp", "alice"); err != nil || userID != "@alice:x" {
+		t.Fatalf("alice is linked to %q, %v", userID, err)
+	}
+	if userID, err := db.GetSSOIdentityUser(ctx, "https://other", "alice"); err != nil || userID != "" {
+		t.Fatalf("alice of another idp is linked to %q, %v", userID, err)
+	}
+}
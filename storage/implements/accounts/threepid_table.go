@@ -0,0 +1,248 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/finogeeks/ligase/model/authtypes"
+)
+
+const threepidSchema = `
+-- Validations of third party identifiers the server sent a token to
+CREATE TABLE IF NOT EXISTS account_threepid_sessions (
+    session_id TEXT NOT NULL PRIMARY KEY,
+    client_secret TEXT NOT NULL,
+    -- "email" or "msisdn"
+    medium TEXT NOT NULL,
+    address TEXT NOT NULL,
+    token TEXT NOT NULL,
+    send_attempt INTEGER NOT NULL,
+    next_link TEXT NOT NULL DEFAULT '',
+    created_ts BIGINT NOT NULL,
+    -- 0 until the token was submitted
+    validated_ts BIGINT NOT NULL DEFAULT 0
+);
+CREATE UNIQUE INDEX IF NOT EXISTS account_threepid_sessions_secret_idx ON account_threepid_sessions(client_secret, medium, address);
+
+-- Third party identifiers bound to an account
+CREATE TABLE IF NOT EXISTS account_threepids (
+    medium TEXT NOT NULL,
+    address TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    validated_ts BIGINT NOT NULL,
+    added_ts BIGINT NOT NULL,
+    PRIMARY KEY (medium, address)
+);
+CREATE INDEX IF NOT EXISTS account_threepids_user_id_idx ON account_threepids(user_id);
+`
+
+const insertThreePIDSessionSQL = "" +
+	"INSERT INTO account_threepid_sessions (session_id, client_secret, medium, address, token, send_attempt, next_link, created_ts)" +
+	" VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+
+const selectThreePIDSessionSQL = "" +
+	"SELECT session_id, client_secret, medium, address, token, send_attempt, next_link, created_ts, validated_ts" +
+	" FROM account_threepid_sessions WHERE session_id = $1"
+
+const selectThreePIDSessionBySecretSQL = "" +
+	"SELECT session_id, client_secret, medium, address, token, send_attempt, next_link, created_ts, validated_ts" +
+	" FROM account_threepid_sessions WHERE client_secret = $1 AND medium = $2 AND address = $3"
+
+const updateThreePIDSessionAttemptSQL = "" +
+	"UPDATE account_threepid_sessions SET send_attempt = $2, token = $3, created_ts = $4 WHERE session_id = $1"
+
+const updateThreePIDSessionValidatedSQL = "" +
+	"UPDATE account_threepid_sessions SET validated_ts = $2 WHERE session_id = $1"
+
+const deleteThreePIDSessionsBeforeSQL = "" +
+	"DELETE FROM account_threepid_sessions WHERE created_ts < $1"
+
+const insertThreePIDSQL = "" +
+	"INSERT INTO account_threepids (medium, address, user_id, validated_ts, added_ts) VALUES ($1, $2, $3, $4, $5)" +
+	" ON CONFLICT (medium, address) DO NOTHING"
+
+const selectThreePIDsByUserSQL = "" +
+	"SELECT medium, address, user_id, validated_ts, added_ts FROM account_threepids WHERE user_id = $1 ORDER BY added_ts"
+
+const selectThreePIDUserSQL = "" +
+	"SELECT user_id FROM account_threepids WHERE medium = $1 AND address = $2"
+
+const deleteThreePIDSQL = "" +
+	"DELETE FROM account_threepids WHERE user_id = $1 AND medium = $2 AND address = $3"
+
+type threepidStatements struct {
+	db                                 *Database
+	insertThreePIDSessionStmt          *sql.Stmt
+	selectThreePIDSessionStmt          *sql.Stmt
+	selectThreePIDSessionBySecretStmt  *sql.Stmt
+	updateThreePIDSessionAttemptStmt   *sql.Stmt
+	updateThreePIDSessionValidatedStmt *sql.Stmt
+	deleteThreePIDSessionsBeforeStmt   *sql.Stmt
+	insertThreePIDStmt                 *sql.Stmt
+	selectThreePIDsByUserStmt          *sql.Stmt
+	selectThreePIDUserStmt             *sql.Stmt
+	deleteThreePIDStmt                 *sql.Stmt
+}
+
+func (s *threepidStatements) prepare(d *Database) (err error) {
+	s.db = d
+	if s.insertThreePIDSessionStmt, err = d.db.Prepare(insertThreePIDSessionSQL); err != nil {
+		return
+	}
+	if s.selectThreePIDSessionStmt, err = d.db.Prepare(selectThreePIDSessionSQL); err != nil {
+		return
+	}
+	if s.selectThreePIDSessionBySecretStmt, err = d.db.Prepare(selectThreePIDSessionBySecretSQL); err != nil {
+		return
+	}
+	if s.updateThreePIDSessionAttemptStmt, err = d.db.Prepare(updateThreePIDSessionAttemptSQL); err != nil {
+		return
+	}
+	if s.updateThreePIDSessionValidatedStmt, err = d.db.Prepare(updateThreePIDSessionValidatedSQL); err != nil {
+		return
+	}
+	if s.deleteThreePIDSessionsBeforeStmt, err = d.db.Prepare(deleteThreePIDSessionsBeforeSQL); err != nil {
+		return
+	}
+	if s.insertThreePIDStmt, err = d.db.Prepare(insertThreePIDSQL); err != nil {
+		return
+	}
+	if s.selectThreePIDsByUserStmt, err = d.db.Prepare(selectThreePIDsByUserSQL); err != nil {
+		return
+	}
+	if s.selectThreePIDUserStmt, err = d.db.Prepare(selectThreePIDUserSQL); err != nil {
+		return
+	}
+	if s.deleteThreePIDStmt, err = d.db.Prepare(deleteThreePIDSQL); err != nil {
+		return
+	}
+	return
+}
+
+func (s *threepidStatements) insertThreePIDSession(
+	ctx context.Context, session *authtypes.ThreePIDSession,
+) error {
+	_, err := s.insertThreePIDSessionStmt.ExecContext(
+		ctx, session.SessionID, session.ClientSecret, session.Medium, session.Address,
+		session.Token, session.SendAttempt, session.NextLink, session.CreatedTs,
+	)
+	return err
+}
+
+func scanThreePIDSession(row *sql.Row) (*authtypes.ThreePIDSession, error) {
+	var session authtypes.ThreePIDSession
+	err := row.Scan(
+		&session.SessionID, &session.ClientSecret, &session.Medium, &session.Address, &session.Token,
+		&session.SendAttempt, &session.NextLink, &session.CreatedTs, &session.ValidatedTs,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *threepidStatements) selectThreePIDSession(
+	ctx context.Context, sessionID string,
+) (*authtypes.ThreePIDSession, error) {
+	return scanThreePIDSession(s.selectThreePIDSessionStmt.QueryRowContext(ctx, sessionID))
+}
+
+func (s *threepidStatements) selectThreePIDSessionBySecret(
+	ctx context.Context, clientSecret, medium, address string,
+) (*authtypes.ThreePIDSession, error) {
+	return scanThreePIDSession(s.selectThreePIDSessionBySecretStmt.QueryRowContext(ctx, clientSecret, medium, address))
+}
+
+func (s *threepidStatements) updateThreePIDSessionAttempt(
+	ctx context.Context, sessionID string, sendAttempt int, token string, createdTs int64,
+) error {
+	_, err := s.updateThreePIDSessionAttemptStmt.ExecContext(ctx, sessionID, sendAttempt, token, createdTs)
+	return err
+}
+
+func (s *threepidStatements) updateThreePIDSessionValidated(
+	ctx context.Context, sessionID string, validatedTs int64,
+) error {
+	_, err := s.updateThreePIDSessionValidatedStmt.ExecContext(ctx, sessionID, validatedTs)
+	return err
+}
+
+func (s *threepidStatements) deleteThreePIDSessionsBefore(
+	ctx context.Context, ts int64,
+) error {
+	_, err := s.deleteThreePIDSessionsBeforeStmt.ExecContext(ctx, ts)
+	return err
+}
+
+// insertThreePID returns false if the identifier is already bound
+func (s *threepidStatements) insertThreePID(
+	ctx context.Context, threepid *authtypes.ThreePID,
+) (bool, error) {
+	res, err := s.insertThreePIDStmt.ExecContext(
+		ctx, threepid.Medium, threepid.Address, threepid.UserID, threepid.ValidatedTs, threepid.AddedTs,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *threepidStatements) selectThreePIDsByUser(
+	ctx context.Context, userID string,
+) ([]authtypes.ThreePID, error) {
+	rows, err := s.selectThreePIDsByUserStmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	threepids := []authtypes.ThreePID{}
+	for rows.Next() {
+		var threepid authtypes.ThreePID
+		if err := rows.Scan(&threepid.Medium, &threepid.Address, &threepid.UserID, &threepid.ValidatedTs, &threepid.AddedTs); err != nil {
+			return nil, err
+		}
+		threepids = append(threepids, threepid)
+	}
+	return threepids, rows.Err()
+}
+
+func (s *threepidStatements) selectThreePIDUser(
+	ctx context.Context, medium, address string,
+) (string, error) {
+	var userID string
+	err := s.selectThreePIDUserStmt.QueryRowContext(ctx, medium, address).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
+
+func (s *threepidStatements) deleteThreePID(
+	ctx context.Context, userID, medium, address string,
+) (bool, error) {
+	res, err := s.deleteThreePIDStmt.ExecContext(ctx, userID, medium, address)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -70,10 +70,6 @@ type userInfoStatements struct {
 	deleteUserInfoStmt    *sql.Stmt
 }
 
-func (s *userInfoStatements) getSchema() string {
-	return userInfoSchema
-}
-
 func (s *userInfoStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.upsertUserInfoStmt, err = d.db.Prepare(upsertUserInfoSQL); err != nil {
@@ -61,9 +61,11 @@ CREATE TABLE IF NOT EXISTS appservice_events_mirror (
 CREATE INDEX IF NOT EXISTS appservice_events_as_id_mirror ON appservice_events_mirror(as_id);
 `
 
+// Events of transactions already sent once come first, oldest transaction
+// first, so they are sent again under their original transaction ID.
 const selectEventsByApplicationServiceIDSQL = "" +
 	"SELECT id, event_json, txn_id, type " +
-	"FROM appservice_events WHERE as_id = $1 ORDER BY txn_id DESC, id ASC"
+	"FROM appservice_events WHERE as_id = $1 ORDER BY txn_id = -1, txn_id ASC, id ASC"
 
 const countEventsByApplicationServiceIDSQL = "" +
 	"SELECT COUNT(id) FROM appservice_events WHERE as_id = $1"
@@ -120,11 +122,6 @@ type eventsStatements struct {
 }
 
 func (s *eventsStatements) prepare(db *sql.DB) (err error) {
-	_, err = db.Exec(appserviceEventsSchema)
-	if err != nil {
-		return
-	}
-
 	if s.selectEventsByApplicationServiceIDStmt, err = db.Prepare(selectEventsByApplicationServiceIDSQL); err != nil {
 		return
 	}
@@ -182,14 +179,13 @@ func (s *eventsStatements) selectEventsByApplicationServiceID(
 		return
 	}
 	defer func() {
-		err = eventRows.Close()
-		if err != nil {
-			log.Fatalw("appservice unable to select new events to send", log.KeysAndValues{"appservice", applicationServiceID, "error", err})
+		if closeErr := eventRows.Close(); closeErr != nil {
+			log.Errorw("appservice unable to select new events to send", log.KeysAndValues{"appservice", applicationServiceID, "error", closeErr})
 		}
 	}()
 	events, maxID, txnID, eventsRemaining, err = retrieveEvents(eventRows, limit)
 	if err != nil {
-		log.Fatalw("retrieveEvents error", log.KeysAndValues{"appservice", applicationServiceID, "error", err})
+		log.Errorw("retrieveEvents error", log.KeysAndValues{"appservice", applicationServiceID, "error", err})
 		return
 	}
 
@@ -25,7 +25,7 @@ import (
 )
 
 func init() {
-	common.Register("appservice", NewDatabase)
+	common.Register("appservice", NewDatabase, migrations...)
 }
 
 type Database struct {
@@ -55,6 +55,10 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	result.db.SetMaxIdleConns(30)
 	result.db.SetConnMaxLifetime(time.Minute * 3)
 
+	if err = common.Migrate(result.db, driver, "appservice"); err != nil {
+		return nil, err
+	}
+
 	result.topic = topic
 	result.underlying = underlying
 
@@ -68,6 +72,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) prepare() error {
 	if err := d.events.prepare(d.db); err != nil {
 		return err
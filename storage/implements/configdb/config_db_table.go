@@ -44,10 +44,6 @@ type configDbStatements struct {
 	selectServerNameStmt *sql.Stmt
 }
 
-func (s *configDbStatements) getSchema() string {
-	return serverNameSchema
-}
-
 func (s *configDbStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.upsertServerNameStmt, err = d.db.Prepare(upsertServerNameSQL); err != nil {
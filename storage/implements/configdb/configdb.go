@@ -24,7 +24,7 @@ import (
 )
 
 func init() {
-	common.Register("server_conf", NewDatabase)
+	common.Register("server_conf", NewDatabase, migrations...)
 }
 
 type Database struct {
@@ -53,12 +53,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	dataBase.db.SetMaxIdleConns(30)
 	dataBase.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{dataBase.statements.getSchema(), dataBase.instanceStatements.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := dataBase.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(dataBase.db, driver, "server_conf"); err != nil {
+		return nil, err
 	}
 
 	if err = dataBase.statements.prepare(dataBase); err != nil {
@@ -80,6 +76,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) UpsertServerName(
 	ctx context.Context,
 	nid int64,
@@ -44,10 +44,6 @@ type serverInstanceStatements struct {
 	selectServerInstanceStmt *sql.Stmt
 }
 
-func (s *serverInstanceStatements) getSchema() string {
-	return serverInstanceSchema
-}
-
 func (s *serverInstanceStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.upsertServerInstanceStmt, err = d.db.Prepare(upsertServerInstanceSQL); err != nil {
@@ -92,10 +92,6 @@ type devicesStatements struct {
 	CheckDeviceStmt          *sql.Stmt
 }
 
-func (s *devicesStatements) getSchema() string {
-	return devicesSchema
-}
-
 func (s *devicesStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.upsertDeviceStmt, err = d.db.Prepare(upsertDeviceSQL); err != nil {
@@ -40,7 +40,8 @@ CREATE UNIQUE INDEX IF NOT EXISTS mig_device_user_id_idx ON mig_device_devices(u
 `
 
 const insertMigDeviceSQL = "" +
-	"INSERT INTO mig_device_devices(access_token, mig_access_token, device_id, user_id) VALUES ($1, $2, $3, $4)"
+	"INSERT INTO mig_device_devices(access_token, mig_access_token, device_id, user_id) VALUES ($1, $2, $3, $4)" +
+	" ON CONFLICT DO NOTHING"
 
 const deleteMigDeviceSQL = "" +
 	"DELETE FROM mig_device_devices WHERE device_id = $1 AND user_id = $2"
@@ -59,10 +60,6 @@ type migDevicesStatements struct {
 	recoverMigDeviceStmt      *sql.Stmt
 }
 
-func (s *migDevicesStatements) getSchema() string {
-	return migDevicesSchema
-}
-
 func (s *migDevicesStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.insertMigDeviceStmt, err = d.db.Prepare(insertMigDeviceSQL); err != nil {
@@ -32,7 +32,7 @@ import (
 )
 
 func init() {
-	common.Register("devices", NewDatabase)
+	common.Register("devices", NewDatabase, migrations...)
 }
 
 // Database represents a device database.
@@ -62,12 +62,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	dataBase.db.SetMaxIdleConns(30)
 	dataBase.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{dataBase.devices.getSchema(), dataBase.migDevices.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := dataBase.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(dataBase.db, driver, "devices"); err != nil {
+		return nil, err
 	}
 
 	if err = dataBase.devices.prepare(dataBase); err != nil {
@@ -89,6 +85,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // WriteOutputEvents implements OutputRoomEventWriter
 func (d *Database) WriteDBEvent(ctx context.Context, update *dbtypes.DBEvent) error {
 	span, _ := common.StartSpanFromContext(ctx, d.topic)
@@ -68,10 +68,6 @@ type alStatements struct {
 
 func (s *alStatements) prepare(d *Database) (err error) {
 	s.db = d
-	_, err = d.db.Exec(algorithmSchema)
-	if err != nil {
-		return
-	}
 	if s.insertAlStmt, err = d.db.Prepare(insertAlSQL); err != nil {
 		return
 	}
@@ -70,10 +70,6 @@ type deviceKeyStatements struct {
 
 func (s *deviceKeyStatements) prepare(d *Database) (err error) {
 	s.db = d
-	_, err = d.db.Exec(deviceKeySchema)
-	if err != nil {
-		return
-	}
 	if s.insertDeviceKeyStmt, err = d.db.Prepare(insertDeviceKeySQL); err != nil {
 		return
 	}
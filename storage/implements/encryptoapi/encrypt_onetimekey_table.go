@@ -76,10 +76,6 @@ type oneTimeKeyStatements struct {
 
 func (s *oneTimeKeyStatements) prepare(d *Database) (err error) {
 	s.db = d
-	_, err = d.db.Exec(oneTimeKeySchema)
-	if err != nil {
-		return
-	}
 	if s.insertOneTimeKeyStmt, err = d.db.Prepare(insertOneTimeKeySQL); err != nil {
 		return
 	}
@@ -30,7 +30,7 @@ import (
 )
 
 func init() {
-	common.Register("encryptoapi", NewDatabase)
+	common.Register("encryptoapi", NewDatabase, migrations...)
 }
 
 // Database represents a presence database.
@@ -60,6 +60,10 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	dataBase.db.SetMaxIdleConns(30)
 	dataBase.db.SetConnMaxLifetime(time.Minute * 3)
 
+	if err = common.Migrate(dataBase.db, driver, "encryptoapi"); err != nil {
+		return nil, err
+	}
+
 	if err = dataBase.deviceKeyStatements.prepare(dataBase); err != nil {
 		return nil, err
 	}
@@ -80,6 +84,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // WriteOutputEvents implements OutputRoomEventWriter
 func (d *Database) WriteDBEvent(ctx context.Context, update *dbtypes.DBEvent) error {
 	span, _ := common.StartSpanFromContext(ctx, d.topic)
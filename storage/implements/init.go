@@ -27,4 +27,5 @@ import (
 	_ "github.com/finogeeks/ligase/storage/implements/rcs_server"
 	_ "github.com/finogeeks/ligase/storage/implements/roomserver"
 	_ "github.com/finogeeks/ligase/storage/implements/syncapi"
+	_ "github.com/finogeeks/ligase/storage/sqlite"
 )
@@ -41,10 +41,6 @@ type certStatements struct {
 }
 
 func (s *certStatements) prepare(db *sql.DB) (err error) {
-	_, err = db.Exec(CertSchema)
-	if err != nil {
-		return err
-	}
 	if s.insertRootCAStmt, err = db.Prepare(insertRootCASQL); err != nil {
 		return
 	}
@@ -29,12 +29,13 @@ import (
 )
 
 func init() {
-	common.Register("serverkey", NewDatabase)
+	common.Register("serverkey", NewDatabase, migrations...)
 }
 
 // A Database implements gomatrixserverlib.KeyDatabase and is used to store
 // the public keys for other matrix servers.
 type Database struct {
+	db         *sql.DB
 	statements serverKeyStatements
 	cert       certStatements
 	qryDBGauge mon.LabeledGauge
@@ -56,8 +57,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	db.SetMaxIdleConns(30)
 	db.SetConnMaxLifetime(time.Minute * 3)
 
-	d := new(Database)
-	if _, err = db.Exec(d.statements.getSchema()); err != nil {
+	d := &Database{db: db}
+	if err = common.Migrate(db, driver, "serverkey"); err != nil {
 		return nil, err
 	}
 
@@ -74,6 +75,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // FetcherName implements KeyFetcher
 func (d Database) FetcherName() string {
 	return "KeyDatabase"
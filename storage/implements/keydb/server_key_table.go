@@ -66,10 +66,6 @@ type serverKeyStatements struct {
 	upsertServerKeysStmt     *sql.Stmt
 }
 
-func (s *serverKeyStatements) getSchema() string {
-	return serverKeysSchema
-}
-
 func (s *serverKeyStatements) prepare(db *sql.DB) (err error) {
 	if s.bulkSelectServerKeysStmt, err = db.Prepare(bulkSelectServerKeysSQL); err != nil {
 		return
@@ -50,10 +50,6 @@ type presencesStatements struct {
 	recoverPresencesStmt *sql.Stmt
 }
 
-func (s *presencesStatements) getSchema() string {
-	return presenceSchema
-}
-
 func (s *presencesStatements) prepare(d *Database) (err error) {
 	s.db = d
 	if s.upsertPresencesStmt, err = d.db.Prepare(upsertPresencesSQL); err != nil {
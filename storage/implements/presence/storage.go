@@ -27,7 +27,7 @@ import (
 )
 
 func init() {
-	common.Register("presence", NewDatabase)
+	common.Register("presence", NewDatabase, migrations...)
 }
 
 type Database struct {
@@ -54,12 +54,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	dataBase.db.SetMaxIdleConns(30)
 	dataBase.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{dataBase.presence.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := dataBase.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(dataBase.db, driver, "presence"); err != nil {
+		return nil, err
 	}
 
 	if err = dataBase.presence.prepare(dataBase); err != nil {
@@ -77,6 +73,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // WriteOutputEvents implements OutputRoomEventWriter
 func (d *Database) WriteDBEvent(ctx context.Context, update *dbtypes.DBEvent) error {
 	span, _ := common.StartSpanFromContext(ctx, d.topic)
@@ -140,10 +140,6 @@ type publicRoomsStatements struct {
 	updateRoomAttributeStmts                map[string]*sql.Stmt
 }
 
-func (s *publicRoomsStatements) getSchema() string {
-	return publicRoomsSchema
-}
-
 // nolint: safesql
 func (s *publicRoomsStatements) prepare(d *Database) (err error) {
 	s.db = d
@@ -33,7 +33,7 @@ import (
 )
 
 func init() {
-	common.Register("publicroomapi", NewDatabase)
+	common.Register("publicroomapi", NewDatabase, migrations...)
 }
 
 // Database represents a public rooms server database.
@@ -63,12 +63,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	public.db.SetMaxIdleConns(30)
 	public.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{public.statements.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := public.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(public.db, driver, "publicroomapi"); err != nil {
+		return nil, err
 	}
 
 	if err = public.statements.prepare(public); err != nil {
@@ -85,6 +81,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) SetIDGenerator(idg *uid.UidGenerator) {
 	d.idg = idg
 }
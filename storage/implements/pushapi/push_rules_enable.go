@@ -54,10 +54,6 @@ type pushRulesEnableStatements struct {
 	recoverPushRuleEnableStmt     *sql.Stmt
 }
 
-func (s *pushRulesEnableStatements) getSchema() string {
-	return pushRulesEnableSchema
-}
-
 func (s *pushRulesEnableStatements) prepare(d *DataBase) (err error) {
 	s.db = d
 	if s.insertPushRuleEnableStmt, err = d.db.Prepare(insertPushRuleEnableSQL); err != nil {
@@ -61,10 +61,6 @@ type pushRulesStatements struct {
 	recoverPushRuleStmt      *sql.Stmt
 }
 
-func (s *pushRulesStatements) getSchema() string {
-	return pushrulesSchema
-}
-
 func (s *pushRulesStatements) prepare(d *DataBase) (err error) {
 	s.db = d
 	if s.insertPushRuleStmt, err = d.db.Prepare(insertPushRuleSQL); err != nil {
@@ -73,10 +73,6 @@ type pushersStatements struct {
 	recoverPusherStmt          *sql.Stmt
 }
 
-func (s *pushersStatements) getSchema() string {
-	return pushersSchema
-}
-
 func (s *pushersStatements) prepare(d *DataBase) (err error) {
 	s.db = d
 	if s.deleteUserPushersStmt, err = d.db.Prepare(deleteUserPushersSQL); err != nil {
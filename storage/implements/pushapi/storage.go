@@ -27,7 +27,7 @@ import (
 )
 
 func init() {
-	common.Register("pushapi", NewDatabase)
+	common.Register("pushapi", NewDatabase, migrations...)
 }
 
 type DataBase struct {
@@ -56,12 +56,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	d.db.SetMaxIdleConns(30)
 	d.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{d.pushers.getSchema(), d.pushRules.getSchema(), d.pushRulesEnable.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := d.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(d.db, driver, "pushapi"); err != nil {
+		return nil, err
 	}
 
 	if err = d.pushers.prepare(d); err != nil {
@@ -84,6 +80,10 @@ func (d *DataBase) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *DataBase) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // WriteOutputEvents implements OutputRoomEventWriter
 func (d *DataBase) WriteDBEvent(ctx context.Context, update *dbtypes.DBEvent) error {
 	span, _ := common.StartSpanFromContext(ctx, d.topic)
@@ -111,17 +111,8 @@ type friendshipStatements struct {
 	deleteFriendshipByRoomIDStmt               *sql.Stmt
 }
 
-func (s *friendshipStatements) getSchema() string {
-	return friendshipSchema
-}
-
 func (s *friendshipStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	_, err = db.Exec(friendshipSchema)
-	if err != nil {
-		return
-	}
-
 	return statementList{
 		{&s.insertFriendshipStmt, insertFriendshipSQL},
 		{&s.selectFriendshipByRoomIDStmt, selectFriendshipByRoomIDSQL},
@@ -29,7 +29,7 @@ import (
 )
 
 func init() {
-	common.Register("rcsserver", NewDatabase)
+	common.Register("rcsserver", NewDatabase, migrations...)
 }
 
 type Database struct {
@@ -52,12 +52,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	d.db.SetMaxIdleConns(30)
 	d.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{d.statements.friendshipStatements.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := d.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(d.db, driver, "rcsserver"); err != nil {
+		return nil, err
 	}
 
 	if err = d.statements.prepare(d.db, d); err != nil {
@@ -71,6 +67,10 @@ func (d *Database) SetGauge(gauge mon.LabeledGauge) {
 	d.gauge = gauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) SetIDGenerator(idg *uid.UidGenerator) {
 	d.idg = idg
 }
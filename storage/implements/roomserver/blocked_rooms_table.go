@@ -0,0 +1,92 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package roomserver
+
+import (
+	"context"
+	"database/sql"
+)
+
+const blockedRoomsSchema = `
+-- Rooms nobody may join or be invited to, set by a server admin
+CREATE TABLE IF NOT EXISTS roomserver_blocked_rooms (
+    room_id TEXT NOT NULL PRIMARY KEY,
+    -- The admin who blocked the room
+    blocked_by TEXT NOT NULL,
+    ts BIGINT NOT NULL
+);
+`
+
+const upsertBlockedRoomSQL = "" +
+	"INSERT INTO roomserver_blocked_rooms (room_id, blocked_by, ts) VALUES ($1, $2, $3)" +
+	" ON CONFLICT (room_id) DO UPDATE SET blocked_by = $2, ts = $3"
+
+const deleteBlockedRoomSQL = "" +
+	"DELETE FROM roomserver_blocked_rooms WHERE room_id = $1"
+
+const selectBlockedRoomsSQL = "" +
+	"SELECT room_id, blocked_by FROM roomserver_blocked_rooms"
+
+type blockedRoomsStatements struct {
+	db                     *Database
+	upsertBlockedRoomStmt  *sql.Stmt
+	deleteBlockedRoomStmt  *sql.Stmt
+	selectBlockedRoomsStmt *sql.Stmt
+}
+
+func (s *blockedRoomsStatements) prepare(db *sql.DB, d *Database) (err error) {
+	s.db = d
+	return statementList{
+		{&s.upsertBlockedRoomStmt, upsertBlockedRoomSQL},
+		{&s.deleteBlockedRoomStmt, deleteBlockedRoomSQL},
+		{&s.selectBlockedRoomsStmt, selectBlockedRoomsSQL},
+	}.prepare(db)
+}
+
+// blocking is an admin action, it is written straight away instead of going
+// through the async db writer so a rejoin right after is already refused
+func (s *blockedRoomsStatements) insertBlockedRoom(
+	ctx context.Context, roomID, blockedBy string, ts int64,
+) error {
+	_, err := s.upsertBlockedRoomStmt.ExecContext(ctx, roomID, blockedBy, ts)
+	return err
+}
+
+func (s *blockedRoomsStatements) deleteBlockedRoom(
+	ctx context.Context, roomID string,
+) error {
+	_, err := s.deleteBlockedRoomStmt.ExecContext(ctx, roomID)
+	return err
+}
+
+func (s *blockedRoomsStatements) selectBlockedRooms(
+	ctx context.Context,
+) ([]string, []string, error) {
+	rows, err := s.selectBlockedRoomsStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+	var roomIDs, blockedBy []string
+	for rows.Next() {
+		var roomID, user string
+		if err = rows.Scan(&roomID, &user); err != nil {
+			return nil, nil, err
+		}
+		roomIDs = append(roomIDs, roomID)
+		blockedBy = append(blockedBy, user)
+	}
+	return roomIDs, blockedBy, rows.Err()
+}
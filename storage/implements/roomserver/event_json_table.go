@@ -59,6 +59,12 @@ const insertEventJSONSQLMirror = "" +
 	"INSERT INTO roomserver_event_json_mirror (event_nid, event_json) VALUES ($1, $2)" +
 	" ON CONFLICT DO NOTHING"
 
+const deleteEventJSONSQL = "" +
+	"DELETE FROM roomserver_event_json WHERE event_nid = ANY($1)"
+
+const deleteEventJSONSQLMirror = "" +
+	"DELETE FROM roomserver_event_json_mirror WHERE event_nid = ANY($1)"
+
 // Bulk event JSON lookup by numeric event ID.
 // Sort by the numeric event ID.
 // This means that we can use binary search to lookup by numeric event ID.
@@ -104,13 +110,11 @@ type eventJSONStatements struct {
 	selectMsgEventsStmt                *sql.Stmt
 	selectMsgEventsCountStmt           *sql.Stmt
 	updateMsgEventStmt                 *sql.Stmt
+	deleteEventJSONStmt                *sql.Stmt
+	deleteEventJSONStmtMirror          *sql.Stmt
 	selectRoomEventByNIDStmt           *sql.Stmt
 }
 
-func (s *eventJSONStatements) getSchema() string {
-	return eventJSONSchema
-}
-
 func (s *eventJSONStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 
@@ -125,6 +129,8 @@ func (s *eventJSONStatements) prepare(db *sql.DB, d *Database) (err error) {
 		{&s.selectMsgEventsCountStmt, selectMsgEventsCountSQL},
 		{&s.updateMsgEventStmt, updateMsgEventSQL},
 		{&s.selectRoomEventByNIDStmt, selectRoomEventByNIDSQL},
+		{&s.deleteEventJSONStmt, deleteEventJSONSQL},
+		{&s.deleteEventJSONStmtMirror, deleteEventJSONSQLMirror},
 	}.prepare(db)
 }
 
@@ -319,3 +325,11 @@ func (s *eventJSONStatements) selectRoomEventByNID(ctx context.Context, eventNID
 	}
 	return nil, nil
 }
+
+func (s *eventJSONStatements) deleteEventJSON(ctx context.Context, eventNIDs []int64) error {
+	if _, err := s.deleteEventJSONStmt.ExecContext(ctx, pq.Int64Array(eventNIDs)); err != nil {
+		return err
+	}
+	_, err := s.deleteEventJSONStmtMirror.ExecContext(ctx, pq.Int64Array(eventNIDs))
+	return err
+}
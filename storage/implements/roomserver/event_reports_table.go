@@ -0,0 +1,201 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package roomserver
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/finogeeks/ligase/model/roomservertypes"
+)
+
+const eventReportsSchema = `
+-- Events reported by the members of their room, the moderation queue
+CREATE TABLE IF NOT EXISTS roomserver_event_reports (
+    id BIGINT NOT NULL PRIMARY KEY,
+    room_id TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    -- The user who made the report
+    user_id TEXT NOT NULL,
+    -- The sender of the reported event
+    sender TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    -- From -100 (most offensive) to 0, NULL if the reporter gave none
+    score INTEGER,
+    -- The event as it was when reported, it may be redacted or purged since
+    event_json TEXT NOT NULL,
+    received_ts BIGINT NOT NULL,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    resolved_by TEXT NOT NULL DEFAULT '',
+    resolved_ts BIGINT NOT NULL DEFAULT 0,
+    -- Moderator annotation
+    note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS roomserver_event_reports_received_ts_idx ON roomserver_event_reports(received_ts);
+`
+
+const eventReportsColumns = "" +
+	"id, room_id, event_id, user_id, sender, reason, score, event_json, received_ts," +
+	" resolved, resolved_by, resolved_ts, note"
+
+// the filters match everything when empty, $3 is '', 'true' or 'false'
+const eventReportsWhere = "" +
+	" WHERE ($1 = '' OR room_id = $1) AND ($2 = '' OR user_id = $2)" +
+	" AND ($3 = '' OR resolved = $3::BOOLEAN)"
+
+const insertEventReportSQL = "" +
+	"INSERT INTO roomserver_event_reports (id, room_id, event_id, user_id, sender, reason, score, event_json, received_ts)" +
+	" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+
+const selectEventReportSQL = "" +
+	"SELECT " + eventReportsColumns + " FROM roomserver_event_reports WHERE id = $1"
+
+const selectEventReportsSQL = "" +
+	"SELECT " + eventReportsColumns + " FROM roomserver_event_reports" + eventReportsWhere +
+	" ORDER BY received_ts DESC, id DESC LIMIT $4 OFFSET $5"
+
+const selectEventReportsCountSQL = "" +
+	"SELECT count(1) FROM roomserver_event_reports" + eventReportsWhere
+
+const updateEventReportResolvedSQL = "" +
+	"UPDATE roomserver_event_reports SET resolved = $2, resolved_by = $3, resolved_ts = $4 WHERE id = $1"
+
+const updateEventReportNoteSQL = "" +
+	"UPDATE roomserver_event_reports SET note = $2 WHERE id = $1"
+
+type eventReportsStatements struct {
+	db                            *Database
+	insertEventReportStmt         *sql.Stmt
+	selectEventReportStmt         *sql.Stmt
+	selectEventReportsStmt        *sql.Stmt
+	selectEventReportsCountStmt   *sql.Stmt
+	updateEventReportResolvedStmt *sql.Stmt
+	updateEventReportNoteStmt     *sql.Stmt
+}
+
+func (s *eventReportsStatements) prepare(db *sql.DB, d *Database) (err error) {
+	s.db = d
+	return statementList{
+		{&s.insertEventReportStmt, insertEventReportSQL},
+		{&s.selectEventReportStmt, selectEventReportSQL},
+		{&s.selectEventReportsStmt, selectEventReportsSQL},
+		{&s.selectEventReportsCountStmt, selectEventReportsCountSQL},
+		{&s.updateEventReportResolvedStmt, updateEventReportResolvedSQL},
+		{&s.updateEventReportNoteStmt, updateEventReportNoteSQL},
+	}.prepare(db)
+}
+
+func (s *eventReportsStatements) insertEventReport(
+	ctx context.Context, report *roomservertypes.EventReport,
+) error {
+	var score sql.NullInt64
+	if report.Score != nil {
+		score = sql.NullInt64{Int64: *report.Score, Valid: true}
+	}
+	_, err := s.insertEventReportStmt.ExecContext(
+		ctx, report.ID, report.RoomID, report.EventID, report.UserID, report.Sender,
+		report.Reason, score, string(report.EventJSON), report.ReceivedTs,
+	)
+	return err
+}
+
+func scanEventReport(scan func(dest ...interface{}) error) (*roomservertypes.EventReport, error) {
+	var report roomservertypes.EventReport
+	var score sql.NullInt64
+	var eventJSON string
+	if err := scan(
+		&report.ID, &report.RoomID, &report.EventID, &report.UserID, &report.Sender,
+		&report.Reason, &score, &eventJSON, &report.ReceivedTs,
+		&report.Resolved, &report.ResolvedBy, &report.ResolvedTs, &report.Note,
+	); err != nil {
+		return nil, err
+	}
+	if score.Valid {
+		report.Score = &score.Int64
+	}
+	report.EventJSON = []byte(eventJSON)
+	return &report, nil
+}
+
+// selectEventReport returns nil if there is no such report
+func (s *eventReportsStatements) selectEventReport(
+	ctx context.Context, id int64,
+) (*roomservertypes.EventReport, error) {
+	report, err := scanEventReport(s.selectEventReportStmt.QueryRowContext(ctx, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return report, err
+}
+
+func eventReportFilterArgs(filter *roomservertypes.EventReportFilter) (string, string, string) {
+	resolved := ""
+	if filter.Resolved != nil {
+		if *filter.Resolved {
+			resolved = "true"
+		} else {
+			resolved = "false"
+		}
+	}
+	return filter.RoomID, filter.UserID, resolved
+}
+
+func (s *eventReportsStatements) selectEventReports(
+	ctx context.Context, filter *roomservertypes.EventReportFilter, limit, offset int,
+) ([]*roomservertypes.EventReport, int, error) {
+	roomID, userID, resolved := eventReportFilterArgs(filter)
+	var total int
+	err := s.selectEventReportsCountStmt.QueryRowContext(ctx, roomID, userID, resolved).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.selectEventReportsStmt.QueryContext(ctx, roomID, userID, resolved, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close() // nolint: errcheck
+	reports := []*roomservertypes.EventReport{}
+	for rows.Next() {
+		report, err := scanEventReport(rows.Scan)
+		if err != nil {
+			return nil, 0, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, total, rows.Err()
+}
+
+func (s *eventReportsStatements) updateEventReportResolved(
+	ctx context.Context, id int64, resolved bool, resolvedBy string, ts int64,
+) (bool, error) {
+	res, err := s.updateEventReportResolvedStmt.ExecContext(ctx, id, resolved, resolvedBy, ts)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *eventReportsStatements) updateEventReportNote(
+	ctx context.Context, id int64, note string,
+) (bool, error) {
+	res, err := s.updateEventReportNoteStmt.ExecContext(ctx, id, note)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -121,6 +121,8 @@ const updateRoomEventSQL = "update roomserver_events set offsets = $1, domain =
 
 const selectRoomEventByDepthSQL = "SELECT event_nid, event_id FROM roomserver_events WHERE room_nid = $1 AND depth = $2"
 
+const deleteEventsSQL = "DELETE FROM roomserver_events WHERE event_id = ANY($1) RETURNING event_nid"
+
 const selectRoomMaxDomainOffsetSQL = "SELECT t.domain, t.m, m.event_id FROM(SELECT MAX(offsets) AS m, domain FROM roomserver_events WHERE room_nid=$1 GROUP BY domain) t LEFT JOIN roomserver_events m ON room_nid=$1 AND t.domain=m.domain AND t.m=m.offsets"
 
 type eventStatements struct {
@@ -147,10 +149,7 @@ type eventStatements struct {
 	updateRoomEventStmt                        *sql.Stmt
 	selectRoomEventByDepthStmt                 *sql.Stmt
 	selectRoomMaxDomainOffsetStmt              *sql.Stmt
-}
-
-func (s *eventStatements) getSchema() string {
-	return eventsSchema
+	deleteEventsStmt                           *sql.Stmt
 }
 
 func (s *eventStatements) prepare(db *sql.DB, d *Database) (err error) {
@@ -179,6 +178,7 @@ func (s *eventStatements) prepare(db *sql.DB, d *Database) (err error) {
 		{&s.updateRoomEventStmt, updateRoomEventSQL},
 		{&s.selectRoomEventByDepthStmt, selectRoomEventByDepthSQL},
 		{&s.selectRoomMaxDomainOffsetStmt, selectRoomMaxDomainOffsetSQL},
+		{&s.deleteEventsStmt, deleteEventsSQL},
 	}.prepare(db)
 }
 
@@ -630,3 +630,21 @@ func (s *eventStatements) selectRoomStateNIDByStateBlockNID(ctx context.Context,
 	}
 	return eventNIDs, eventTypes, stateKeys, domains, nil
 }
+
+func (s *eventStatements) deleteEvents(ctx context.Context, eventIDs []string) ([]int64, error) {
+	rows, err := s.deleteEventsStmt.QueryContext(ctx, pq.StringArray(eventIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	var nids []int64
+	for rows.Next() {
+		var nid int64
+		if err = rows.Scan(&nid); err != nil {
+			return nil, err
+		}
+		nids = append(nids, nid)
+	}
+	return nids, rows.Err()
+}
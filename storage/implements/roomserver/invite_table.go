@@ -82,10 +82,6 @@ type inviteItem struct {
 	sender_nid      int64
 }
 
-func (s *inviteStatements) getSchema() string {
-	return inviteSchema
-}
-
 func (s *inviteStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 
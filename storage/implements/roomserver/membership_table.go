@@ -126,10 +126,6 @@ type membershipStatements struct {
 	selectMembershipsFromTargetStmt            *sql.Stmt
 }
 
-func (s *membershipStatements) getSchema() string {
-	return membershipSchema
-}
-
 func (s *membershipStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 
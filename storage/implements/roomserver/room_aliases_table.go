@@ -61,10 +61,6 @@ type roomAliasesStatements struct {
 	selectAllAliasesStmt        *sql.Stmt
 }
 
-func (s *roomAliasesStatements) getSchema() string {
-	return roomAliasesSchema
-}
-
 func (s *roomAliasesStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 
@@ -47,19 +47,8 @@ type roomDomainsStatements struct {
 	selectRoomDomainsStmt *sql.Stmt
 }
 
-func (s *roomDomainsStatements) getSchema() string {
-	return roomdomainsSchema
-}
-
 func (s *roomDomainsStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	if prepare_with_create {
-		_, err = db.Exec(roomdomainsSchema)
-		if err != nil {
-			return
-		}
-	}
-
 	return statementList{
 		{&s.upsertRoomDomainsStmt, upsertRoomDomainsSQL},
 		{&s.selectRoomDomainsStmt, selectRoomDomainsSQL},
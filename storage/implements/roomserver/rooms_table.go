@@ -74,19 +74,8 @@ type roomStatements struct {
 	updateRoomDepthStmt       *sql.Stmt
 }
 
-func (s *roomStatements) getSchema() string {
-	return roomsSchema
-}
-
 func (s *roomStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	if prepare_with_create {
-		_, err = db.Exec(roomsSchema)
-		if err != nil {
-			return
-		}
-	}
-
 	return statementList{
 		{&s.insertRoomNIDStmt, insertRoomNIDSQL},
 		{&s.selectRoomExistsStmt, selectRoomExistsSQL},
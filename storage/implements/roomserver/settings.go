@@ -56,19 +56,8 @@ type settingsStatements struct {
 	selectSettingKeyStmt *sql.Stmt
 }
 
-func (s *settingsStatements) getSchema() string {
-	return settingsSchema
-}
-
 func (s *settingsStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	if prepare_with_create {
-		_, err = db.Exec(settingsSchema)
-		if err != nil {
-			return
-		}
-	}
-
 	return statementList{
 		{&s.usertSettingStmt, upsertSettingsSQL},
 		{&s.selectSettingsStmt, selectSettingsSQL},
@@ -31,6 +31,8 @@ type statements struct {
 	membershipStatements
 	roomDomainsStatements
 	settingsStatements
+	blockedRoomsStatements
+	eventReportsStatements
 }
 
 func (s *statements) prepare(db *sql.DB, d *Database) error {
@@ -46,6 +48,8 @@ func (s *statements) prepare(db *sql.DB, d *Database) error {
 		s.membershipStatements.prepare,
 		s.roomDomainsStatements.prepare,
 		s.settingsStatements.prepare,
+		s.blockedRoomsStatements.prepare,
+		s.eventReportsStatements.prepare,
 	} {
 		if err = prepare(db, d); err != nil {
 			return err
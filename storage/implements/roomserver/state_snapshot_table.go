@@ -62,10 +62,6 @@ type stateSnapshotStatements struct {
 	selectStateStmt *sql.Stmt
 }
 
-func (s *stateSnapshotStatements) getSchema() string {
-	return stateSnapshotSchema
-}
-
 func (s *stateSnapshotStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 
@@ -39,7 +39,7 @@ import (
 )
 
 func init() {
-	common.Register("roomserver", NewDatabase)
+	common.Register("roomserver", NewDatabase, migrations...)
 }
 
 // A Database is used to store room events and stream offsets.
@@ -54,8 +54,6 @@ type Database struct {
 	qryDBGauge mon.LabeledGauge
 }
 
-var prepare_with_create = true
-
 // Open a postgres database.
 func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync bool) (interface{}, error) {
 	d := new(Database)
@@ -73,21 +71,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	d.db.SetMaxIdleConns(30)
 	d.db.SetConnMaxLifetime(time.Minute * 3)
 
-	schemas := []string{
-		d.statements.roomStatements.getSchema(),
-		d.statements.eventStatements.getSchema(),
-		d.statements.eventJSONStatements.getSchema(),
-		d.statements.stateSnapshotStatements.getSchema(),
-		d.statements.roomAliasesStatements.getSchema(),
-		d.statements.inviteStatements.getSchema(),
-		d.statements.membershipStatements.getSchema(),
-		d.statements.roomDomainsStatements.getSchema(),
-		d.statements.settingsStatements.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := d.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(d.db, driver, "roomserver"); err != nil {
+		return nil, err
 	}
 
 	if err = d.statements.prepare(d.db, d); err != nil {
@@ -101,6 +86,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) RecoverCache() {
 	span, ctx := common.StartSobSomSpan(context.Background(), "Database.RecoverCache")
 	defer span.Finish()
@@ -764,3 +753,55 @@ func (d *Database) UpdateMsgEventMigration(ctx context.Context, id int64, Encryp
 func (d *Database) GetRoomEventByNID(ctx context.Context, eventNID int64) ([]byte, error) {
 	return d.statements.selectRoomEventByNID(ctx, eventNID)
 }
+
+// PurgeEvents deletes the events and their json, it is up to the caller to
+// keep the state events and the forward extremities of the room
+func (d *Database) PurgeEvents(ctx context.Context, eventIDs []string) (int64, error) {
+	if len(eventIDs) == 0 {
+		return 0, nil
+	}
+	nids, err := d.statements.deleteEvents(ctx, eventIDs)
+	if err != nil {
+		return 0, err
+	}
+	if len(nids) == 0 {
+		return 0, nil
+	}
+	return int64(len(nids)), d.statements.deleteEventJSON(ctx, nids)
+}
+
+func (d *Database) BlockRoom(ctx context.Context, roomID, blockedBy string, ts int64) error {
+	return d.statements.insertBlockedRoom(ctx, roomID, blockedBy, ts)
+}
+
+func (d *Database) UnblockRoom(ctx context.Context, roomID string) error {
+	return d.statements.deleteBlockedRoom(ctx, roomID)
+}
+
+func (d *Database) GetBlockedRooms(ctx context.Context) ([]string, []string, error) {
+	return d.statements.selectBlockedRooms(ctx)
+}
+
+func (d *Database) InsertEventReport(ctx context.Context, report *roomservertypes.EventReport) error {
+	return d.statements.insertEventReport(ctx, report)
+}
+
+func (d *Database) GetEventReport(ctx context.Context, id int64) (*roomservertypes.EventReport, error) {
+	return d.statements.selectEventReport(ctx, id)
+}
+
+func (d *Database) GetEventReports(
+	ctx context.Context, filter *roomservertypes.EventReportFilter, limit, offset int,
+) ([]*roomservertypes.EventReport, int, error) {
+	return d.statements.selectEventReports(ctx, filter, limit, offset)
+}
+
+// ResolveEventReport returns false if there is no such report
+func (d *Database) ResolveEventReport(ctx context.Context, id int64, resolved bool, resolvedBy string, ts int64) (bool, error) {
+	return d.statements.updateEventReportResolved(ctx, id, resolved, resolvedBy, ts)
+}
+
+// SetEventReportNote returns false if there is no such report
+func (d *Database) SetEventReportNote(ctx context.Context, id int64, note string) (bool, error) {
+	return d.statements.updateEventReportNote(ctx, id, note)
+}
@@ -65,10 +65,6 @@ type clientDataStreamStatements struct {
 	selectHistoryClientDataStreamStmt *sql.Stmt
 }
 
-func (s *clientDataStreamStatements) getSchema() string {
-	return clientDataStreamSchema
-}
-
 func (s *clientDataStreamStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 	if s.insertClientDataStreamStmt, err = db.Prepare(insertClientDataStreamSQL); err != nil {
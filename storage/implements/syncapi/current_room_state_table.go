@@ -87,6 +87,9 @@ const updateRoomStateSQL = "" +
 const selectRoomStateByEventIDSQL = "" +
 	"SELECT event_json FROM syncapi_current_room_state WHERE event_id = $1"
 
+const selectRoomsStateByTypeSQL = "" +
+	"SELECT room_id, event_json FROM syncapi_current_room_state WHERE type = $1 AND state_key = ''"
+
 type currentRoomStateStatements struct {
 	db                              *Database
 	upsertRoomStateStmt             *sql.Stmt
@@ -98,10 +101,7 @@ type currentRoomStateStatements struct {
 	selectRoomStateCountStmt     *sql.Stmt
 	updateRoomStateStmt          *sql.Stmt
 	selectRoomStateByEventIDStmt *sql.Stmt
-}
-
-func (s *currentRoomStateStatements) getSchema() string {
-	return currentRoomStateSchema
+	selectRoomsStateByTypeStmt   *sql.Stmt
 }
 
 func (s *currentRoomStateStatements) prepare(db *sql.DB, d *Database) (err error) {
@@ -134,6 +134,9 @@ func (s *currentRoomStateStatements) prepare(db *sql.DB, d *Database) (err error
 	if s.selectRoomStateByEventIDStmt, err = db.Prepare(selectRoomStateByEventIDSQL); err != nil {
 		return
 	}
+	if s.selectRoomsStateByTypeStmt, err = db.Prepare(selectRoomsStateByTypeSQL); err != nil {
+		return
+	}
 	return
 }
 
@@ -405,3 +408,35 @@ func (s *currentRoomStateStatements) selectRoomStateByEventID(
 	}
 	return eventBytes, nil
 }
+
+// selectRoomsStateByType returns the current state event of type evType with
+// an empty state key of every room which has one
+func (s *currentRoomStateStatements) selectRoomsStateByType(
+	ctx context.Context, evType string,
+) ([]string, []gomatrixserverlib.ClientEvent, error) {
+	rows, err := s.selectRoomsStateByTypeStmt.QueryContext(ctx, evType)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	roomIDs := []string{}
+	result := []gomatrixserverlib.ClientEvent{}
+	for rows.Next() {
+		var roomID string
+		var eventBytes []byte
+		if err := rows.Scan(&roomID, &eventBytes); err != nil {
+			return nil, nil, err
+		}
+		if encryption.CheckCrypto(evType) {
+			eventBytes = encryption.Decrypt(eventBytes)
+		}
+		var ev gomatrixserverlib.ClientEvent
+		if err := json.Unmarshal(eventBytes, &ev); err != nil {
+			return nil, nil, err
+		}
+		roomIDs = append(roomIDs, roomID)
+		result = append(result, ev)
+	}
+	return roomIDs, result, rows.Err()
+}
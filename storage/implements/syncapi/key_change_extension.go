@@ -56,16 +56,8 @@ type keyChangeStatements struct {
 	selectHistoryKeyStreamStmt *sql.Stmt
 }
 
-func (s *keyChangeStatements) getSchema() string {
-	return KeyChangeSchema
-}
-
 func (s *keyChangeStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	_, err = db.Exec(KeyChangeSchema)
-	if err != nil {
-		return
-	}
 	if s.insertKeyStreamStmt, err = db.Prepare(insertKeyStreamSQL); err != nil {
 		return
 	}
@@ -0,0 +1,204 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syncapi
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/finogeeks/ligase/common/encryption"
+	"github.com/finogeeks/ligase/model/syncapitypes"
+	"github.com/finogeeks/ligase/skunkworks/gomatrixserverlib"
+	"github.com/lib/pq"
+)
+
+const legalHoldsSchema = `
+-- Rooms and users whose history must not be deleted
+CREATE TABLE IF NOT EXISTS syncapi_legal_holds (
+    -- A room ID or a user ID
+    target TEXT NOT NULL PRIMARY KEY,
+    reason TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    created_ts BIGINT NOT NULL
+);
+
+-- The events under legal hold as they were before a redaction or an edit
+-- overwrote them in syncapi_output_room_events. They are saved when the
+-- redaction or the edit is processed, nothing is kept for the changes made
+-- before the hold was placed.
+CREATE TABLE IF NOT EXISTS syncapi_legal_hold_events (
+    event_id TEXT NOT NULL PRIMARY KEY,
+    room_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    event_json TEXT NOT NULL,
+    saved_ts BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS syncapi_legal_hold_events_room_idx ON syncapi_legal_hold_events(room_id);
+`
+
+const insertLegalHoldSQL = "" +
+	"INSERT INTO syncapi_legal_holds (target, reason, created_by, created_ts) VALUES ($1, $2, $3, $4)" +
+	" ON CONFLICT (target) DO UPDATE SET reason = EXCLUDED.reason"
+
+const deleteLegalHoldSQL = "" +
+	"DELETE FROM syncapi_legal_holds WHERE target = $1"
+
+const selectLegalHoldsSQL = "" +
+	"SELECT target, reason, created_by, created_ts FROM syncapi_legal_holds ORDER BY created_ts"
+
+const selectLegalHoldTargetsSQL = "" +
+	"SELECT target FROM syncapi_legal_holds WHERE target = ANY($1)"
+
+// the first original is the one to keep, later edits must not replace it
+const insertLegalHoldEventSQL = "" +
+	"INSERT INTO syncapi_legal_hold_events (event_id, room_id, type, event_json, saved_ts) VALUES ($1, $2, $3, $4, $5)" +
+	" ON CONFLICT (event_id) DO NOTHING"
+
+const selectLegalHoldEventsSQL = "" +
+	"SELECT event_id, type, event_json FROM syncapi_legal_hold_events WHERE event_id = ANY($1)"
+
+type legalHoldsStatements struct {
+	db                         *Database
+	insertLegalHoldStmt        *sql.Stmt
+	deleteLegalHoldStmt        *sql.Stmt
+	selectLegalHoldsStmt       *sql.Stmt
+	selectLegalHoldTargetsStmt *sql.Stmt
+	insertLegalHoldEventStmt   *sql.Stmt
+	selectLegalHoldEventsStmt  *sql.Stmt
+}
+
+func (s *legalHoldsStatements) prepare(db *sql.DB, d *Database) (err error) {
+	s.db = d
+	if s.insertLegalHoldStmt, err = db.Prepare(insertLegalHoldSQL); err != nil {
+		return
+	}
+	if s.deleteLegalHoldStmt, err = db.Prepare(deleteLegalHoldSQL); err != nil {
+		return
+	}
+	if s.selectLegalHoldsStmt, err = db.Prepare(selectLegalHoldsSQL); err != nil {
+		return
+	}
+	if s.selectLegalHoldTargetsStmt, err = db.Prepare(selectLegalHoldTargetsSQL); err != nil {
+		return
+	}
+	if s.insertLegalHoldEventStmt, err = db.Prepare(insertLegalHoldEventSQL); err != nil {
+		return
+	}
+	if s.selectLegalHoldEventsStmt, err = db.Prepare(selectLegalHoldEventsSQL); err != nil {
+		return
+	}
+	return
+}
+
+func (s *legalHoldsStatements) insertLegalHold(
+	ctx context.Context, hold *syncapitypes.LegalHold,
+) error {
+	_, err := s.insertLegalHoldStmt.ExecContext(ctx, hold.Target, hold.Reason, hold.CreatedBy, hold.CreatedTs)
+	return err
+}
+
+func (s *legalHoldsStatements) deleteLegalHold(
+	ctx context.Context, target string,
+) (bool, error) {
+	res, err := s.deleteLegalHoldStmt.ExecContext(ctx, target)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *legalHoldsStatements) selectLegalHolds(
+	ctx context.Context,
+) ([]syncapitypes.LegalHold, error) {
+	rows, err := s.selectLegalHoldsStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	holds := []syncapitypes.LegalHold{}
+	for rows.Next() {
+		var hold syncapitypes.LegalHold
+		if err := rows.Scan(&hold.Target, &hold.Reason, &hold.CreatedBy, &hold.CreatedTs); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// selectLegalHoldTargets returns the targets which are under legal hold
+func (s *legalHoldsStatements) selectLegalHoldTargets(
+	ctx context.Context, targets []string,
+) (map[string]bool, error) {
+	rows, err := s.selectLegalHoldTargetsStmt.QueryContext(ctx, pq.StringArray(targets))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	held := map[string]bool{}
+	for rows.Next() {
+		var target string
+		if err := rows.Scan(&target); err != nil {
+			return nil, err
+		}
+		held[target] = true
+	}
+	return held, rows.Err()
+}
+
+func (s *legalHoldsStatements) insertLegalHoldEvent(
+	ctx context.Context, ev *gomatrixserverlib.ClientEvent, ts int64,
+) error {
+	eventBytes, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if encryption.CheckCrypto(ev.Type) {
+		eventBytes = encryption.Encrypt(eventBytes)
+	}
+	_, err = s.insertLegalHoldEventStmt.ExecContext(ctx, ev.EventID, ev.RoomID, ev.Type, eventBytes, ts)
+	return err
+}
+
+func (s *legalHoldsStatements) selectLegalHoldEvents(
+	ctx context.Context, eventIDs []string,
+) (map[string]gomatrixserverlib.ClientEvent, error) {
+	rows, err := s.selectLegalHoldEventsStmt.QueryContext(ctx, pq.StringArray(eventIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	result := map[string]gomatrixserverlib.ClientEvent{}
+	for rows.Next() {
+		var eventID, eventType string
+		var eventBytes []byte
+		if err := rows.Scan(&eventID, &eventType, &eventBytes); err != nil {
+			return nil, err
+		}
+		if encryption.CheckCrypto(eventType) {
+			eventBytes = encryption.Decrypt(eventBytes)
+		}
+		var ev gomatrixserverlib.ClientEvent
+		if err := json.Unmarshal(eventBytes, &ev); err != nil {
+			return nil, err
+		}
+		result[eventID] = ev
+	}
+	return result, rows.Err()
+}
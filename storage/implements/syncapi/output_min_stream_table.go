@@ -45,16 +45,8 @@ type outputMinStreamStatements struct {
 	selectOutputMinStreamStmt *sql.Stmt
 }
 
-func (s *outputMinStreamStatements) getSchema() string {
-	return OutputMinStreamSchema
-}
-
 func (s *outputMinStreamStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	_, err = db.Exec(OutputMinStreamSchema)
-	if err != nil {
-		return
-	}
 	if s.insertOutputMinStreamStmt, err = db.Prepare(insertOutputMinStreamSQL); err != nil {
 		return
 	}
@@ -207,6 +207,28 @@ const selectEventsByRoomIDSQL = "" +
 const selectEventsByEventsSQL = "" +
 	"SELECT id, event_id, room_id FROM syncapi_output_room_events WHERE event_id = ANY($1)"
 
+const selectRoomEventTsSQL = "" +
+	"SELECT origin_server_ts FROM syncapi_output_room_events WHERE room_id = $1 AND event_id = $2"
+
+const selectRoomMaxStreamSQL = "" +
+	"SELECT COALESCE(MAX(id), 0) FROM syncapi_output_room_events WHERE room_id = $1"
+
+const selectRoomPurgeEventsSQL = "" +
+	"SELECT id, event_id, event_json, type FROM syncapi_output_room_events" +
+	" WHERE room_id = $1 AND origin_server_ts < $2 AND id > $3 AND id < $4" +
+	" ORDER BY id ASC LIMIT $5"
+
+const selectRoomExportEventsSQL = "" +
+	"SELECT id, type, event_json FROM syncapi_output_room_events" +
+	" WHERE room_id = $1 AND origin_server_ts >= $2 AND origin_server_ts < $3 AND id > $4" +
+	" ORDER BY id ASC LIMIT $5"
+
+const deleteRoomEventsSQL = "" +
+	"DELETE FROM syncapi_output_room_events WHERE room_id = $1 AND event_id = ANY($2)"
+
+const deleteRoomEventsMirrorSQL = "" +
+	"DELETE FROM syncapi_output_room_events_mirror WHERE room_id = $1 AND event_id = ANY($2)"
+
 type outputRoomEventsStatements struct {
 	db                          *Database
 	insertEventStmt             *sql.Stmt
@@ -238,18 +260,16 @@ type outputRoomEventsStatements struct {
 	selectEventRawStmt            *sql.Stmt
 	selectEventsByRoomIDStmt      *sql.Stmt
 	selectEventsByEventsStmt 	  *sql.Stmt
-}
-
-func (s *outputRoomEventsStatements) getSchema() string {
-	return outputRoomEventsSchema
+	selectRoomEventTsStmt         *sql.Stmt
+	selectRoomMaxStreamStmt       *sql.Stmt
+	selectRoomPurgeEventsStmt     *sql.Stmt
+	selectRoomExportEventsStmt    *sql.Stmt
+	deleteRoomEventsStmt          *sql.Stmt
+	deleteRoomEventsMirrorStmt    *sql.Stmt
 }
 
 func (s *outputRoomEventsStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	_, err = db.Exec(outputRoomEventsSchema)
-	if err != nil {
-		return
-	}
 	if s.insertEventStmt, err = db.Prepare(insertEventSQL); err != nil {
 		return
 	}
@@ -337,6 +357,24 @@ func (s *outputRoomEventsStatements) prepare(db *sql.DB, d *Database) (err error
 	if s.selectEventsByEventsStmt, err = db.Prepare(selectEventsByEventsSQL); err != nil {
 		return
 	}
+	if s.selectRoomEventTsStmt, err = db.Prepare(selectRoomEventTsSQL); err != nil {
+		return
+	}
+	if s.selectRoomMaxStreamStmt, err = db.Prepare(selectRoomMaxStreamSQL); err != nil {
+		return
+	}
+	if s.selectRoomPurgeEventsStmt, err = db.Prepare(selectRoomPurgeEventsSQL); err != nil {
+		return
+	}
+	if s.selectRoomExportEventsStmt, err = db.Prepare(selectRoomExportEventsSQL); err != nil {
+		return
+	}
+	if s.deleteRoomEventsStmt, err = db.Prepare(deleteRoomEventsSQL); err != nil {
+		return
+	}
+	if s.deleteRoomEventsMirrorStmt, err = db.Prepare(deleteRoomEventsMirrorSQL); err != nil {
+		return
+	}
 	return
 }
 
@@ -1099,3 +1137,107 @@ func (s *outputRoomEventsStatements) selectEventsByEvents(
 	}
 	return ids, eventIDs, roomIDs, nil
 }
+
+func (s *outputRoomEventsStatements) selectRoomEventTs(
+	ctx context.Context, roomID, eventID string,
+) (ts int64, err error) {
+	err = s.selectRoomEventTsStmt.QueryRowContext(ctx, roomID, eventID).Scan(&ts)
+	return
+}
+
+func (s *outputRoomEventsStatements) selectRoomMaxStream(
+	ctx context.Context, roomID string,
+) (id int64, err error) {
+	err = s.selectRoomMaxStreamStmt.QueryRowContext(ctx, roomID).Scan(&id)
+	return
+}
+
+// selectRoomPurgeEvents scans up to limit events of the room sent before ts,
+// with a stream position in (fromPos, toPos). State events are skipped, the
+// room state is still built from them. The position of the last scanned row
+// is returned so the caller can go on from there.
+func (s *outputRoomEventsStatements) selectRoomPurgeEvents(
+	ctx context.Context, roomID string, ts, fromPos, toPos int64, limit int,
+) (eventIDs, senders []string, lastPos int64, scanned int, err error) {
+	rows, err := s.selectRoomPurgeEventsStmt.QueryContext(ctx, roomID, ts, fromPos, toPos, limit)
+	if err != nil {
+		return nil, nil, fromPos, 0, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	lastPos = fromPos
+	for rows.Next() {
+		var (
+			streamPos  int64
+			eventID    string
+			eventBytes []byte
+			eventType  string
+		)
+		if err = rows.Scan(&streamPos, &eventID, &eventBytes, &eventType); err != nil {
+			return nil, nil, fromPos, 0, err
+		}
+		lastPos = streamPos
+		scanned++
+
+		if encryption.CheckCrypto(eventType) {
+			eventBytes = encryption.Decrypt(eventBytes)
+		}
+		var ev struct {
+			Sender   string  `json:"sender"`
+			StateKey *string `json:"state_key"`
+		}
+		if err := json.Unmarshal(eventBytes, &ev); err != nil {
+			log.Warnf("outputRoomEvents selectRoomPurgeEvents skip undecodable event, id: %d, room: %s, err: %v", streamPos, roomID, err)
+			continue
+		}
+		if ev.StateKey != nil {
+			continue
+		}
+		eventIDs = append(eventIDs, eventID)
+		senders = append(senders, ev.Sender)
+	}
+	return eventIDs, senders, lastPos, scanned, rows.Err()
+}
+
+// selectRoomExportEvents returns every event of a room, state included, sent
+// in [fromTs, toTs) after the stream position fromPos
+func (s *outputRoomEventsStatements) selectRoomExportEvents(
+	ctx context.Context, roomID string, fromTs, toTs, fromPos int64, limit int,
+) ([]syncapitypes.ExportEvent, error) {
+	rows, err := s.selectRoomExportEventsStmt.QueryContext(ctx, roomID, fromTs, toTs, fromPos, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint: errcheck
+
+	result := []syncapitypes.ExportEvent{}
+	for rows.Next() {
+		var (
+			streamPos  int64
+			eventType  string
+			eventBytes []byte
+		)
+		if err := rows.Scan(&streamPos, &eventType, &eventBytes); err != nil {
+			return nil, err
+		}
+		if encryption.CheckCrypto(eventType) {
+			eventBytes = encryption.Decrypt(eventBytes)
+		}
+		var ev gomatrixserverlib.ClientEvent
+		if err := json.Unmarshal(eventBytes, &ev); err != nil {
+			return nil, err
+		}
+		result = append(result, syncapitypes.ExportEvent{Offset: streamPos, Event: ev})
+	}
+	return result, rows.Err()
+}
+
+func (s *outputRoomEventsStatements) deleteRoomEvents(
+	ctx context.Context, roomID string, eventIDs []string,
+) error {
+	if _, err := s.deleteRoomEventsStmt.ExecContext(ctx, roomID, pq.StringArray(eventIDs)); err != nil {
+		return err
+	}
+	_, err := s.deleteRoomEventsMirrorStmt.ExecContext(ctx, roomID, pq.StringArray(eventIDs))
+	return err
+}
@@ -58,10 +58,6 @@ type presenceDataStreamStatements struct {
 	selectUserPresenceDataStreamStmt    *sql.Stmt
 }
 
-func (s *presenceDataStreamStatements) getSchema() string {
-	return presencetDataStreamSchema
-}
-
 func (s *presenceDataStreamStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 	if s.insertPresenceDataStreamStmt, err = db.Prepare(insertPresenceDataStreamSQL); err != nil {
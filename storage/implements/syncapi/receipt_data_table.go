@@ -70,10 +70,6 @@ type receiptDataStreamStatements struct {
 	selectUserMaxReceiptPosStmt        *sql.Stmt
 }
 
-func (s *receiptDataStreamStatements) getSchema() string {
-	return receiptDataStreamSchema
-}
-
 func (s *receiptDataStreamStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 	if s.insertReceiptDataStreamStmt, err = db.Prepare(insertReceiptDataStreamSQL); err != nil {
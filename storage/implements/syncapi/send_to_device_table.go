@@ -73,16 +73,8 @@ type stdEventsStatements struct {
 	deleteMacStdEventStmt            *sql.Stmt
 }
 
-func (s *stdEventsStatements) getSchema() string {
-	return sendToDeviceSchema
-}
-
 func (s *stdEventsStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
-	_, err = db.Exec(sendToDeviceSchema)
-	if err != nil {
-		return
-	}
 	if s.insertStdEventStmt, err = db.Prepare(insertSTDSQL); err != nil {
 		return
 	}
@@ -39,7 +39,7 @@ import (
 )
 
 func init() {
-	common.Register("syncapi", NewDatabase)
+	common.Register("syncapi", NewDatabase, migrations...)
 }
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
@@ -67,6 +67,7 @@ type Database struct {
 	presenceData    presenceDataStreamStatements
 	userTimeLine    userTimeLineStatements
 	outputMinStream outputMinStreamStatements
+	legalHolds      legalHoldsStatements
 	AsyncSave       bool
 
 	qryDBGauge mon.LabeledGauge
@@ -126,22 +127,8 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	d.underlying = underlying
 	d.AsyncSave = useAsync
 
-	schemas := []string{
-		d.events.getSchema(),
-		d.roomstate.getSchema(),
-		d.keyChange.getSchema(),
-		d.stdMsg.getSchema(),
-		d.clientData.getSchema(),
-		d.receiptData.getSchema(),
-		d.presenceData.getSchema(),
-		d.userReceiptData.getSchema(),
-		d.userTimeLine.getSchema(),
-		d.outputMinStream.getSchema()}
-	for _, sqlStr := range schemas {
-		_, err := d.db.Exec(sqlStr)
-		if err != nil {
-			return nil, err
-		}
+	if err = common.Migrate(d.db, driver, "syncapi"); err != nil {
+		return nil, err
 	}
 
 	if err = d.events.prepare(d.db, d); err != nil {
@@ -174,6 +161,9 @@ func NewDatabase(driver, createAddr, address, underlying, topic string, useAsync
 	if err := d.outputMinStream.prepare(d.db, d); err != nil {
 		return nil, err
 	}
+	if err := d.legalHolds.prepare(d.db, d); err != nil {
+		return nil, err
+	}
 	return d, nil
 }
 
@@ -181,6 +171,10 @@ func (d *Database) SetGauge(qryDBGauge mon.LabeledGauge) {
 	d.qryDBGauge = qryDBGauge
 }
 
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 func (d *Database) SetIDGenerator(idg *uid.UidGenerator) {
 	d.idg = idg
 }
@@ -740,3 +734,51 @@ func (d *Database) GetRoomStateWithLimit(ctx context.Context, limit, offset int6
 func (d *Database) GetRoomStateByEventID(ctx context.Context, eventID string) ([]byte, error) {
 	return d.roomstate.selectRoomStateByEventID(ctx, eventID)
 }
+
+func (d *Database) SelectRoomsStateByType(ctx context.Context, evType string) ([]string, []gomatrixserverlib.ClientEvent, error) {
+	return d.roomstate.selectRoomsStateByType(ctx, evType)
+}
+
+func (d *Database) SelectRoomEventTs(ctx context.Context, roomID, eventID string) (int64, error) {
+	return d.events.selectRoomEventTs(ctx, roomID, eventID)
+}
+
+func (d *Database) SelectRoomMaxStream(ctx context.Context, roomID string) (int64, error) {
+	return d.events.selectRoomMaxStream(ctx, roomID)
+}
+
+func (d *Database) SelectRoomPurgeEvents(ctx context.Context, roomID string, ts, fromPos, toPos int64, limit int) ([]string, []string, int64, int, error) {
+	return d.events.selectRoomPurgeEvents(ctx, roomID, ts, fromPos, toPos, limit)
+}
+
+func (d *Database) DeleteRoomEvents(ctx context.Context, roomID string, eventIDs []string) error {
+	return d.events.deleteRoomEvents(ctx, roomID, eventIDs)
+}
+
+func (d *Database) SelectRoomExportEvents(ctx context.Context, roomID string, fromTs, toTs, fromPos int64, limit int) ([]syncapitypes.ExportEvent, error) {
+	return d.events.selectRoomExportEvents(ctx, roomID, fromTs, toTs, fromPos, limit)
+}
+
+func (d *Database) InsertLegalHold(ctx context.Context, hold *syncapitypes.LegalHold) error {
+	return d.legalHolds.insertLegalHold(ctx, hold)
+}
+
+func (d *Database) DeleteLegalHold(ctx context.Context, target string) (bool, error) {
+	return d.legalHolds.deleteLegalHold(ctx, target)
+}
+
+func (d *Database) GetLegalHolds(ctx context.Context) ([]syncapitypes.LegalHold, error) {
+	return d.legalHolds.selectLegalHolds(ctx)
+}
+
+func (d *Database) GetLegalHoldTargets(ctx context.Context, targets []string) (map[string]bool, error) {
+	return d.legalHolds.selectLegalHoldTargets(ctx, targets)
+}
+
+func (d *Database) InsertLegalHoldEvent(ctx context.Context, ev *gomatrixserverlib.ClientEvent, ts int64) error {
+	return d.legalHolds.insertLegalHoldEvent(ctx, ev, ts)
+}
+
+func (d *Database) GetLegalHoldEvents(ctx context.Context, eventIDs []string) (map[string]gomatrixserverlib.ClientEvent, error) {
+	return d.legalHolds.selectLegalHoldEvents(ctx, eventIDs)
+}
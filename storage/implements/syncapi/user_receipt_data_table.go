@@ -52,10 +52,6 @@ type userReceiptDataStatements struct {
 	selectHistoryUserReceiptDataStmt *sql.Stmt
 }
 
-func (s *userReceiptDataStatements) getSchema() string {
-	return userReceiptDataSchema
-}
-
 func (s *userReceiptDataStatements) prepare(db *sql.DB, d *Database) (err error) {
 	s.db = d
 	if s.insertUserReceiptDataStmt, err = db.Prepare(insertUserReceiptDataSQL); err != nil {
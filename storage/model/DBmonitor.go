@@ -15,11 +15,15 @@
 package model
 
 import (
+	"context"
+
 	mon "github.com/finogeeks/ligase/skunkworks/monitor/go-client/monitor"
 )
 
 type DBMonitor interface {
 	SetGauge(gauge mon.LabeledGauge)
+	// Ping checks the database can be reached, for the readiness of the server
+	Ping(ctx context.Context) error
 	// SetCounter(counter mon.LabeledCounter)
 	// SetHistogram(histogram mon.LabeledHistogram)
 	// SetSummary(summary mon.LabeledSummary)
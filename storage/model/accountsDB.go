@@ -40,6 +40,13 @@ type AccountsDatabase interface {
 
 	GetAccount(ctx context.Context, userID string) (*authtypes.Account, error)
 
+	GetAccounts(ctx context.Context, search string, limit, offset int) ([]authtypes.Account, int, error)
+	SetAccountAdmin(ctx context.Context, userID string, admin bool) error
+	SetAccountLocked(ctx context.Context, userID string, locked bool) error
+	SetAccountShadowBanned(ctx context.Context, userID string, banned bool) error
+	GetShadowBannedAccounts(ctx context.Context) ([]string, error)
+	SetPassword(ctx context.Context, userID, plaintextPassword string) error
+
 	UpsertProfile(ctx context.Context, userID, displayName, avatarURL string) error
 	UpsertProfileSync(ctx context.Context, userID, displayName, avatarURL string) error
 
@@ -87,4 +94,28 @@ type AccountsDatabase interface {
 	GetAllUserInfo() ([]authtypes.UserInfo, error)
 	DeleteUserInfo(ctx context.Context, userID string) error
 	OnDeleteUserInfo(ctx context.Context, userID string) error
+
+	InsertThreePIDSession(ctx context.Context, session *authtypes.ThreePIDSession) error
+	GetThreePIDSession(ctx context.Context, sessionID string) (*authtypes.ThreePIDSession, error)
+	GetThreePIDSessionBySecret(ctx context.Context, clientSecret, medium, address string) (*authtypes.ThreePIDSession, error)
+	UpdateThreePIDSessionAttempt(ctx context.Context, sessionID string, sendAttempt int, token string, createdTs int64) error
+	ValidateThreePIDSession(ctx context.Context, sessionID string, validatedTs int64) error
+	DeleteThreePIDSessionsBefore(ctx context.Context, ts int64) error
+	InsertThreePID(ctx context.Context, threepid *authtypes.ThreePID) (bool, error)
+	GetThreePIDsByUser(ctx context.Context, userID string) ([]authtypes.ThreePID, error)
+	GetThreePIDUser(ctx context.Context, medium, address string) (string, error)
+	DeleteThreePID(ctx context.Context, userID, medium, address string) (bool, error)
+
+	InsertRegistrationToken(ctx context.Context, token *authtypes.RegistrationToken) (bool, error)
+	GetRegistrationToken(ctx context.Context, token string) (*authtypes.RegistrationToken, error)
+	GetRegistrationTokens(ctx context.Context) ([]authtypes.RegistrationToken, error)
+	DeleteRegistrationToken(ctx context.Context, token string) (bool, error)
+	UseRegistrationToken(ctx context.Context, token string, now int64) (bool, error)
+	ReleaseRegistrationToken(ctx context.Context, token string) error
+
+	InsertSSOIdentity(ctx context.Context, idp, subject, userID string) (bool, error)
+	GetSSOIdentityUser(ctx context.Context, idp, subject string) (string, error)
+
+	InsertAuditEvent(ctx context.Context, ev *authtypes.AuditEvent) error
+	GetAuditEvents(ctx context.Context, filter *authtypes.AuditFilter) ([]authtypes.AuditEvent, error)
 }
@@ -156,4 +156,14 @@ type RoomServerDatabase interface {
 	GetMsgEventsTotalMigration(ctx context.Context) (int, int64, error)
 	UpdateMsgEventMigration(ctx context.Context, id int64, EncryptedEventBytes []byte) error
 	GetRoomEventByNID(ctx context.Context, eventNID int64) ([]byte, error)
+
+	PurgeEvents(ctx context.Context, eventIDs []string) (int64, error)
+	BlockRoom(ctx context.Context, roomID, blockedBy string, ts int64) error
+	UnblockRoom(ctx context.Context, roomID string) error
+	GetBlockedRooms(ctx context.Context) ([]string, []string, error)
+	InsertEventReport(ctx context.Context, report *roomservertypes.EventReport) error
+	GetEventReport(ctx context.Context, id int64) (*roomservertypes.EventReport, error)
+	GetEventReports(ctx context.Context, filter *roomservertypes.EventReportFilter, limit, offset int) ([]*roomservertypes.EventReport, int, error)
+	ResolveEventReport(ctx context.Context, id int64, resolved bool, resolvedBy string, ts int64) (bool, error)
+	SetEventReportNote(ctx context.Context, id int64, note string) (bool, error)
 }
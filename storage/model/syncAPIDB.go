@@ -283,4 +283,18 @@ type SyncAPIDatabase interface {
 	GetRoomStateTotal(ctx context.Context) (int, error)
 	UpdateRoomStateWithEventID(ctx context.Context, eventID string, eventBytes []byte) error
 	GetRoomStateByEventID(ctx context.Context, eventID string) ([]byte, error)
+	SelectRoomsStateByType(ctx context.Context, evType string) ([]string, []gomatrixserverlib.ClientEvent, error)
+
+	SelectRoomEventTs(ctx context.Context, roomID, eventID string) (int64, error)
+	SelectRoomMaxStream(ctx context.Context, roomID string) (int64, error)
+	SelectRoomPurgeEvents(ctx context.Context, roomID string, ts, fromPos, toPos int64, limit int) ([]string, []string, int64, int, error)
+	DeleteRoomEvents(ctx context.Context, roomID string, eventIDs []string) error
+	SelectRoomExportEvents(ctx context.Context, roomID string, fromTs, toTs, fromPos int64, limit int) ([]syncapitypes.ExportEvent, error)
+
+	InsertLegalHold(ctx context.Context, hold *syncapitypes.LegalHold) error
+	DeleteLegalHold(ctx context.Context, target string) (bool, error)
+	GetLegalHolds(ctx context.Context) ([]syncapitypes.LegalHold, error)
+	GetLegalHoldTargets(ctx context.Context, targets []string) (map[string]bool, error)
+	InsertLegalHoldEvent(ctx context.Context, ev *gomatrixserverlib.ClientEvent, ts int64) error
+	GetLegalHoldEvents(ctx context.Context, eventIDs []string) (map[string]gomatrixserverlib.ClientEvent, error)
 }
@@ -0,0 +1,215 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package sqlite runs the storage implementations on a sqlite file. It
+// registers the common.SQLiteDriver database/sql driver, which rewrites the
+// postgres SQL of the implementations for sqlite and reports the sqlite
+// errors as the pq errors they check:
+//
+//	database:
+//	  account:
+//	    driver: sqlite
+//	    addresses: file:/mnt/data/account.db
+//
+// Arrays are stored as postgres array literals, pq.Array reads them back.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/url"
+	"strings"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sql.Register(common.SQLiteDriver, &Driver{
+		sqlite: sqlite3.SQLiteDriver{ConnectHook: registerFunctions},
+	})
+}
+
+// dsnDefaults lets the connections of a pool wait for each other, a
+// transaction takes the write lock when it begins so two of them can not
+// deadlock upgrading their read locks
+var dsnDefaults = map[string]string{
+	"_busy_timeout": "10000",
+	"_journal_mode": "WAL",
+	"_txlock":       "immediate",
+}
+
+// Driver is the database/sql driver of the sqlite databases
+type Driver struct {
+	sqlite sqlite3.SQLiteDriver
+}
+
+// Open opens the sqlite file of dsn, file:path?options or a path
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.sqlite.Open(withDefaults(dsn))
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &conn{c.(*sqlite3.SQLiteConn)}, nil
+}
+
+// registerFunctions adds the postgres functions the statements use
+func registerFunctions(c *sqlite3.SQLiteConn) error {
+	return c.RegisterFunc("array_to_string", arrayToString, true)
+}
+
+func arrayToString(array, sep string) (string, error) {
+	var items pq.StringArray
+	if err := items.Scan(array); err != nil {
+		return "", err
+	}
+	return strings.Join(items, sep), nil
+}
+
+func withDefaults(dsn string) string {
+	path, rawQuery := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		path, rawQuery = dsn[:i], dsn[i+1:]
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return dsn
+	}
+	for k, v := range dsnDefaults {
+		if params.Get(k) == "" {
+			params.Set(k, v)
+		}
+	}
+	return path + "?" + params.Encode()
+}
+
+type conn struct {
+	c *sqlite3.SQLiteConn
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	q := rewrite(query)
+	s, err := c.c.PrepareContext(ctx, q.sql)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &stmt{s: s, q: q}, nil
+}
+
+func (c *conn) Close() error {
+	return c.c.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.c.BeginTx(ctx, opts)
+	return tx, mapError(err)
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	return c.c.Ping(ctx)
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	q := rewrite(query)
+	args, err := q.args(args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.c.ExecContext(ctx, q.sql, args)
+	return res, mapError(err)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q := rewrite(query)
+	args, err := q.args(args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.c.QueryContext(ctx, q.sql, args)
+	return rows, mapError(err)
+}
+
+type stmt struct {
+	s driver.Stmt
+	q *query
+}
+
+func (s *stmt) Close() error {
+	return s.s.Close()
+}
+
+// NumInput is unknown, a numbered parameter may be used twice
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), named(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	args, err := s.q.args(args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.s.(driver.StmtExecContext).ExecContext(ctx, args)
+	return res, mapError(err)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	args, err := s.q.args(args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.s.(driver.StmtQueryContext).QueryContext(ctx, args)
+	return rows, mapError(err)
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+// mapError returns the pq error the storage implementations check for the
+// sqlite errors having one
+func mapError(err error) error {
+	e, ok := err.(sqlite3.Error)
+	if !ok {
+		return err
+	}
+	switch {
+	case e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+		return &pq.Error{Code: "23505", Message: e.Error()}
+	case e.Code == sqlite3.ErrError && strings.HasPrefix(e.Error(), "no such table"):
+		return &pq.Error{Code: "42P01", Message: e.Error()}
+	}
+	return err
+}
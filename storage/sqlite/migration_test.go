@@ -0,0 +1,121 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/finogeeks/ligase/common"
+)
+
+func noDatabase(string, string, string, string, string, bool) (interface{}, error) {
+	return nil, nil
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open(common.SQLiteDriver, "file:"+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func appliedVersions(t *testing.T, db *sql.DB, name string) []int64 {
+	states, err := common.MigrationStatus(db, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := []int64{}
+	for _, s := range states {
+		if s.AppliedAt != 0 {
+			applied = append(applied, s.Version)
+		}
+	}
+	return applied
+}
+
+func TestMigrate(t *testing.T) {
+	common.Register("migration_test", noDatabase,
+		common.Migration{Version: 1, Description: "initial schema", Up: "CREATE TABLE IF NOT EXISTS items (id BIGINT PRIMARY KEY);"},
+		common.Migration{Version: 2, Description: "item names", Up: "ALTER TABLE items ADD COLUMN name TEXT NOT NULL DEFAULT '';"},
+	)
+	db := openTestDB(t)
+
+	// nothing was migrated yet, the migrations table does not exist
+	states, err := common.MigrationStatus(db, "migration_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].AppliedAt != 0 || states[1].AppliedAt != 0 {
+		t.Fatalf("unexpected states before migrating %+v", states)
+	}
+
+	if err := common.Migrate(db, common.SQLiteDriver, "migration_test"); err != nil {
+		t.Fatal(err)
+	}
+	if v := appliedVersions(t, db, "migration_test"); len(v) != 2 {
+		t.Fatalf("applied %v, want both migrations", v)
+	}
+	if _, err := db.Exec("INSERT INTO items (id, name) VALUES (1, 'a')"); err != nil {
+		t.Fatalf("schema was not migrated: %v", err)
+	}
+
+	// applied migrations are not run again, the ALTER would fail
+	if err := common.Migrate(db, common.SQLiteDriver, "migration_test"); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	common.Register("migration_fail_test", noDatabase,
+		common.Migration{Version: 1, Description: "initial schema", Up: "CREATE TABLE IF NOT EXISTS things (id BIGINT);"},
+		common.Migration{Version: 2, Description: "broken", Up: "CREATE TABLE others (id BIGINT); INSERT INTO missing VALUES (1);"},
+	)
+	db := openTestDB(t)
+
+	if err := common.Migrate(db, common.SQLiteDriver, "migration_fail_test"); err == nil {
+		t.Fatal("a failing migration must fail Migrate")
+	}
+	if v := appliedVersions(t, db, "migration_fail_test"); len(v) != 1 || v[0] != 1 {
+		t.Fatalf("applied %v, want [1]", v)
+	}
+	if _, err := db.Exec("SELECT id FROM others"); err == nil {
+		t.Fatal("the failed migration was not rolled back")
+	}
+}
+
+func TestMigrationStatusNewerRelease(t *testing.T) {
+	common.Register("migration_newer_test", noDatabase,
+		common.Migration{Version: 1, Description: "initial schema", Up: "CREATE TABLE IF NOT EXISTS stuff (id BIGINT);"},
+	)
+	db := openTestDB(t)
+	if err := common.Migrate(db, common.SQLiteDriver, "migration_newer_test"); err != nil {
+		t.Fatal(err)
+	}
+	// a newer release migrated the database further
+	if _, err := db.Exec("INSERT INTO schema_migrations(name, version, description, applied_at) VALUES ('migration_newer_test', 2, 'newer', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	states, err := common.MigrationStatus(db, "migration_newer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Version != 1 || states[0].AppliedAt == 0 {
+		t.Fatalf("unexpected states %+v", states)
+	}
+}
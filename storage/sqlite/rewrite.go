@@ -0,0 +1,146 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// query is a statement rewritten for sqlite
+type query struct {
+	sql string
+	// the parameters compared with ANY, bound as json arrays
+	arrays map[int]bool
+}
+
+var queries sync.Map
+
+var (
+	anyLiteralRe   = regexp.MustCompile(`(?i)\s*=\s*any\s*\(\s*'\{([^']*)\}'\s*\)`)
+	anyParamRe     = regexp.MustCompile(`(?i)\s*=\s*any\s*\(\s*\$(\d+)\s*\)`)
+	anySelectRe    = regexp.MustCompile(`(?i)\s*=\s*any\s*\(\s*select\b`)
+	onConstraintRe = regexp.MustCompile(`(?i)\bon\s+conflict\s+on\s+constraint\s+\w+`)
+	castRe         = regexp.MustCompile(`::\s*\w+(\[\])?`)
+	arrayTypeRe    = regexp.MustCompile(`(?i)\b(bigint|text|integer)\[\]`)
+	sequenceRe     = regexp.MustCompile(`(?i)\bcreate\s+sequence\s+if\s+not\s+exists\s+(\w+)[^;]*;`)
+	nextvalRe      = regexp.MustCompile(`(?i)\bselect\s+nextval\s*\(\s*'(\w+)'\s*\)`)
+	offsetRe       = regexp.MustCompile(`(?i)\boffset\s+(\$\d+)\s+limit\s+(\$\d+)`)
+	limitOffsetRe  = regexp.MustCompile(`(?i)(\blimit\s+\S+\s+)?\boffset\b`)
+	addColumnRe    = regexp.MustCompile(`(?i)\badd\s+column\s+if\s+not\s+exists\b`)
+	indexNullsRe   = regexp.MustCompile(`(?i)(\bcreate\s+(?:unique\s+)?index\b[^;]*?)\s+nulls\s+(?:first|last)`)
+	publicRe       = regexp.MustCompile(`(?i)\bpublic\.`)
+	ilikeRe        = regexp.MustCompile(`(?i)\bilike\s+(\$\d+)`)
+	greatestRe     = regexp.MustCompile(`(?i)\bgreatest\s*\(`)
+	leastRe        = regexp.MustCompile(`(?i)\bleast\s*\(`)
+	forUpdateRe    = regexp.MustCompile(`(?i)\s+for\s+update\b`)
+	paramRe        = regexp.MustCompile(`\$(\d+)`)
+)
+
+// rewrite translates the postgres SQL of the storage implementations
+func rewrite(sql string) *query {
+	if q, ok := queries.Load(sql); ok {
+		return q.(*query)
+	}
+	q := &query{arrays: make(map[int]bool)}
+	s := anyLiteralRe.ReplaceAllStringFunc(sql, func(m string) string {
+		items := strings.Split(anyLiteralRe.FindStringSubmatch(m)[1], ",")
+		for i, item := range items {
+			item = strings.Trim(strings.TrimSpace(item), `"`)
+			items[i] = "'" + strings.Replace(item, "'", "''", -1) + "'"
+		}
+		return " IN (" + strings.Join(items, ", ") + ")"
+	})
+	s = anyParamRe.ReplaceAllStringFunc(s, func(m string) string {
+		n, _ := strconv.Atoi(anyParamRe.FindStringSubmatch(m)[1])
+		q.arrays[n] = true
+		return fmt.Sprintf(" IN (SELECT value FROM json_each(?%d))", n)
+	})
+	s = anySelectRe.ReplaceAllString(s, " IN (SELECT")
+	s = onConstraintRe.ReplaceAllString(s, "ON CONFLICT")
+	s = castRe.ReplaceAllString(s, "")
+	s = arrayTypeRe.ReplaceAllString(s, "$1")
+	// a sequence is a table handing out rowids
+	s = sequenceRe.ReplaceAllString(s, "CREATE TABLE IF NOT EXISTS $1 (id INTEGER PRIMARY KEY AUTOINCREMENT);")
+	s = nextvalRe.ReplaceAllString(s, "INSERT INTO $1 DEFAULT VALUES RETURNING id")
+	// sqlite has no OFFSET without LIMIT, nor before it
+	s = offsetRe.ReplaceAllString(s, "LIMIT $2 OFFSET $1")
+	s = limitOffsetRe.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(strings.ToUpper(m), "LIMIT") {
+			return m
+		}
+		return "LIMIT -1 " + m
+	})
+	s = addColumnRe.ReplaceAllString(s, "ADD COLUMN")
+	s = indexNullsRe.ReplaceAllString(s, "$1")
+	s = publicRe.ReplaceAllString(s, "")
+	// LIKE ignores the case of ascii, and escapes nothing by default
+	s = ilikeRe.ReplaceAllString(s, `LIKE $1 ESCAPE '\'`)
+	s = greatestRe.ReplaceAllString(s, "MAX(")
+	s = leastRe.ReplaceAllString(s, "MIN(")
+	// the transactions are immediate, the database is locked already
+	s = forUpdateRe.ReplaceAllString(s, "")
+	// ?NNN binds the NNNth argument wherever it is, like $NNN
+	q.sql = paramRe.ReplaceAllString(s, "?$1")
+
+	queries.Store(sql, q)
+	return q
+}
+
+// args binds the postgres array literals compared with ANY as json arrays
+func (q *query) args(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	if len(q.arrays) == 0 {
+		return args, nil
+	}
+	out := make([]driver.NamedValue, len(args))
+	copy(out, args)
+	for i := range out {
+		if !q.arrays[out[i].Ordinal] {
+			continue
+		}
+		v, err := jsonArray(out[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: argument %d: %v", out[i].Ordinal, err)
+		}
+		out[i].Value = v
+	}
+	return out, nil
+}
+
+// jsonArray converts the postgres array literal pq.Array gives to json, the
+// integers staying numbers
+func jsonArray(v driver.Value) (string, error) {
+	var items pq.StringArray
+	if err := items.Scan(v); err != nil {
+		return "", err
+	}
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		if n, err := strconv.ParseInt(item, 10, 64); err == nil {
+			values[i] = n
+		} else {
+			values[i] = item
+		}
+	}
+	b, err := json.Marshal(values)
+	return string(b), err
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/lib/pq"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		sql, want string
+	}{
+		{"SELECT a FROM t WHERE id = $1", "SELECT a FROM t WHERE id = ?1"},
+		{"SELECT a FROM t WHERE id = ANY($2) AND b = $1",
+			"SELECT a FROM t WHERE id IN (SELECT value FROM json_each(?2)) AND b = ?1"},
+		{"SELECT a FROM t WHERE k = ANY('{m.room.create,m.room.member}')",
+			"SELECT a FROM t WHERE k IN ('m.room.create', 'm.room.member')"},
+		{"SELECT a FROM t WHERE id=any(select id FROM u)", "SELECT a FROM t WHERE id IN (SELECT id FROM u)"},
+		{"INSERT INTO t(a) VALUES ($1) ON CONFLICT ON CONSTRAINT t_unique DO NOTHING",
+			"INSERT INTO t(a) VALUES (?1) ON CONFLICT DO NOTHING"},
+		{"INSERT INTO t(a) VALUES ($1::bigint[])", "INSERT INTO t(a) VALUES (?1)"},
+		{"CREATE TABLE t (ids BIGINT[] NOT NULL)", "CREATE TABLE t (ids BIGINT NOT NULL)"},
+		{"CREATE SEQUENCE IF NOT EXISTS t_seq START 1;", "CREATE TABLE IF NOT EXISTS t_seq (id INTEGER PRIMARY KEY AUTOINCREMENT);"},
+		{"SELECT nextval('t_seq')", "INSERT INTO t_seq DEFAULT VALUES RETURNING id"},
+		{"SELECT a FROM t ORDER BY a OFFSET $1 LIMIT $2", "SELECT a FROM t ORDER BY a LIMIT ?2 OFFSET ?1"},
+		{"SELECT a FROM t ORDER BY a OFFSET $1", "SELECT a FROM t ORDER BY a LIMIT -1 OFFSET ?1"},
+		{"SELECT a FROM t LIMIT $1 OFFSET $2", "SELECT a FROM t LIMIT ?1 OFFSET ?2"},
+		{"ALTER TABLE t ADD COLUMN IF NOT EXISTS b TEXT", "ALTER TABLE t ADD COLUMN b TEXT"},
+		{"CREATE INDEX IF NOT EXISTS t_idx ON t(a DESC NULLS LAST);", "CREATE INDEX IF NOT EXISTS t_idx ON t(a DESC);"},
+		{"SELECT a FROM public.t", "SELECT a FROM t"},
+		{"SELECT a FROM t WHERE a ILIKE $1", `SELECT a FROM t WHERE a LIKE ?1 ESCAPE '\'`},
+		{"UPDATE t SET a = GREATEST(a, $1), b = LEAST(b, $2)", "UPDATE t SET a = MAX(a, ?1), b = MIN(b, ?2)"},
+		{"SELECT seq, hash FROM head WHERE id = 1 FOR UPDATE", "SELECT seq, hash FROM head WHERE id = 1"},
+	}
+	for _, tt := range tests {
+		if got := rewrite(tt.sql).sql; got != tt.want {
+			t.Errorf("rewrite(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestJSONArray(t *testing.T) {
+	tests := []struct {
+		array driver.Valuer
+		want  string
+	}{
+		{pq.Array([]string{"$a", "b,c"}), `["$a","b,c"]`},
+		{pq.Array([]int64{1, 22}), `[1,22]`},
+		{pq.Array([]string{}), `[]`},
+	}
+	for _, tt := range tests {
+		v, err := tt.array.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := jsonArray(v)
+		if err != nil || got != tt.want {
+			t.Errorf("jsonArray(%v) = %s, %v, want %s", v, got, err, tt.want)
+		}
+	}
+}
+
+func TestDriver(t *testing.T) {
+	db, err := sql.Open(common.SQLiteDriver, "file:"+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("CREATE TABLE t (id BIGINT PRIMARY KEY, ids BIGINT[] NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	insert := "INSERT INTO t(id, ids) VALUES ($1, $2)"
+	if _, err = db.Exec(insert, 1, pq.Array([]int64{1, 2})); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(insert, 1, pq.Array([]int64{}))
+	if pqErr, ok := err.(*pq.Error); !ok || pqErr.Code != "23505" {
+		t.Fatalf("duplicate insert err = %v, want a unique violation", err)
+	}
+
+	var ids []int64
+	err = db.QueryRow("SELECT ids FROM t WHERE id = ANY($1)", pq.Array([]int64{3, 1})).Scan(pq.Array(&ids))
+	if err != nil || len(ids) != 2 || ids[1] != 2 {
+		t.Fatalf("select ids = %v, %v", ids, err)
+	}
+	var s string
+	if err = db.QueryRow("SELECT array_to_string(ids, ',') FROM t").Scan(&s); err != nil || s != "1,2" {
+		t.Fatalf("array_to_string = %q, %v", s, err)
+	}
+
+	_, err = db.Query("SELECT a FROM missing")
+	if pqErr, ok := err.(*pq.Error); !ok || pqErr.Code != "42P01" {
+		t.Fatalf("missing table err = %v, want an undefined table", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/apiconsumer"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/service"
@@ -37,6 +38,7 @@ type InternalMsgConsumer struct {
 	stdEventTimeline *repos.STDEventStreamRepo
 	db               model.SyncAPIDatabase
 	cache            service.Cache
+	shardRing        *syncshard.Ring
 }
 
 func NewInternalMsgConsumer(
@@ -63,6 +65,10 @@ func NewInternalMsgConsumer(
 	return c
 }
 
+func (c *InternalMsgConsumer) SetShardRing(shardRing *syncshard.Ring) {
+	c.shardRing = shardRing
+}
+
 func (c *InternalMsgConsumer) Start() {
 	c.APIConsumer.Init("synaggregatecapi", c, c.Cfg.Rpc.ProxySyncAggregateApiTopic)
 	//c.APIConsumer.InitGroup("synaggregatecapi", c, c.Cfg.Rpc.ProxySyncAggregateApiTopic,types.SYNC_AGGR_GROUP)
@@ -78,7 +78,7 @@ func (ReqGetUserUnread) Process(ctx context.Context, consumer interface{}, msg c
 	requestMap := make(map[uint32]*syncapitypes.SyncUnreadRequest)
 	if joinMap != nil {
 		joinMap.Range(func(key, value interface{}) bool {
-			instance := common.GetSyncInstance(key.(string), c.Cfg.MultiInstance.SyncServerTotal)
+			instance := c.shardRing.Owner(key.(string))
 			var request *syncapitypes.SyncUnreadRequest
 			if data, ok := requestMap[instance]; ok {
 				request = data
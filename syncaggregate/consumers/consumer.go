@@ -219,12 +219,12 @@ func (s *EventFeedConsumer) addUserTimeLineEvent(ctx context.Context, ev *gomatr
 		} else {
 			updateProfileUser = map[string]map[string]struct{}{}
 			domain, _ := common.DomainFromID(*ev.StateKey)
-			isSelfDomain := common.CheckValidDomain(domain, s.cfg.Matrix.ServerName)
+			isSelfDomain := common.IsLocalDomain(domain)
 			bs := time.Now().UnixNano() / 1000000
 			for _, member := range relateUsers {
 				hasLoad, hasFriendship := s.userTimeLine.AddFriendShip(member, *ev.StateKey)
 				domainCheck, _ := common.DomainFromID(member)
-				isSelfDomainCheck := common.CheckValidDomain(domainCheck, s.cfg.Matrix.ServerName)
+				isSelfDomainCheck := common.IsLocalDomain(domainCheck)
 				if (!hasLoad || !hasFriendship) && isSelfDomainCheck != isSelfDomain {
 					var domainA, userB string
 					if isSelfDomain {
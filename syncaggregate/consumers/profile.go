@@ -184,14 +184,14 @@ func (s *ProfileConsumer) onMessage(ctx context.Context, output *types.ProfileSt
 	if friendMap != nil {
 		friendMap.Range(func(key, _ interface{}) bool {
 			domain, _ := common.DomainFromID(key.(string))
-			if !common.CheckValidDomain(domain, s.cfg.Matrix.ServerName) {
+			if !common.IsLocalDomain(domain) {
 				domainMap[domain] = true
 			}
 			return true
 		})
 	}
 	senderDomain, _ := common.DomainFromID(output.UserID)
-	if common.CheckValidDomain(senderDomain, s.cfg.Matrix.ServerName) && isRelate {
+	if common.IsLocalDomain(senderDomain) && isRelate {
 		fedProfile := types.ProfileContent{
 			UserID:       output.UserID,
 			DisplayName:  output.Presence.DisplayName,
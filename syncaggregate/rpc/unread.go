@@ -17,6 +17,7 @@ package rpc
 import (
 	"context"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/model/syncapitypes"
 	"github.com/finogeeks/ligase/model/types"
 	"net/http"
@@ -36,8 +37,9 @@ type UnReadRpcConsumer struct {
 	userTimeLine *repos.UserTimeLineRepo
 	chanSize     uint32
 	//msgChan      []chan *types.UnreadReqContent
-	msgChan []chan common.ContextMsg
-	cfg     *config.Dendrite
+	msgChan   []chan common.ContextMsg
+	cfg       *config.Dendrite
+	shardRing *syncshard.Ring
 }
 
 func NewUnReadRpcConsumer(
@@ -55,6 +57,11 @@ func NewUnReadRpcConsumer(
 	return s
 }
 
+func (s *UnReadRpcConsumer) SetShardRing(shardRing *syncshard.Ring) *UnReadRpcConsumer {
+	s.shardRing = shardRing
+	return s
+}
+
 func (s *UnReadRpcConsumer) GetTopic() string {
 	return types.UnreadReqTopicDef
 }
@@ -107,7 +114,7 @@ func (s *UnReadRpcConsumer) processOnUnread(ctx context.Context, userID, reply s
 	requestMap := make(map[uint32]*syncapitypes.SyncUnreadRequest)
 	if joinMap != nil {
 		joinMap.Range(func(key, value interface{}) bool {
-			instance := common.GetSyncInstance(key.(string), s.cfg.MultiInstance.SyncServerTotal)
+			instance := s.shardRing.Owner(key.(string))
 			var request *syncapitypes.SyncUnreadRequest
 			if data, ok := requestMap[instance]; ok {
 				request = data
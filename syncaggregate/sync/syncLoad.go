@@ -16,7 +16,6 @@ package sync
 
 import (
 	"context"
-	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/model/syncapitypes"
 	"github.com/finogeeks/ligase/model/types"
 	"github.com/finogeeks/ligase/skunkworks/log"
@@ -248,7 +247,7 @@ func (sm *SyncMng) buildLoadRequest(req *request) {
 	req.reqRooms.Range(func(key, value interface{}) bool {
 		roomID := key.(string)
 		reqRoom := value.(*syncapitypes.SyncRoom)
-		instance := common.GetSyncInstance(roomID, sm.cfg.MultiInstance.SyncServerTotal)
+		instance := sm.shardRing.Owner(roomID)
 		var request *syncapitypes.SyncServerRequest
 		if data, ok := requestMap[instance]; ok {
 			request = data
@@ -267,7 +266,7 @@ func (sm *SyncMng) buildLoadRequest(req *request) {
 		return true
 	})
 	for _, roomID := range req.joinRooms {
-		instance := common.GetSyncInstance(roomID, sm.cfg.MultiInstance.SyncServerTotal)
+		instance := sm.shardRing.Owner(roomID)
 		var request *syncapitypes.SyncServerRequest
 		if data, ok := requestMap[instance]; ok {
 			request = data
@@ -23,6 +23,7 @@ import (
 
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/model/authtypes"
 	"github.com/finogeeks/ligase/model/feedstypes"
@@ -50,6 +51,7 @@ type SyncMng struct {
 	rpcClient    *common.RpcClient
 	cache        service.Cache
 	complexCache *common.ComplexCache
+	shardRing    *syncshard.Ring
 	//repos
 	onlineRepo           *repos.OnlineUserRepo
 	userTimeLine         *repos.UserTimeLineRepo
@@ -82,6 +84,11 @@ func (sm *SyncMng) SetCache(cache service.Cache) *SyncMng {
 	return sm
 }
 
+func (sm *SyncMng) SetShardRing(shardRing *syncshard.Ring) *SyncMng {
+	sm.shardRing = shardRing
+	return sm
+}
+
 func (sm *SyncMng) SetComplexCache(complexCache *common.ComplexCache) *SyncMng {
 	sm.complexCache = complexCache
 	return sm
@@ -374,7 +381,7 @@ func (sm *SyncMng) buildSyncData(ctx context.Context, req *request, res *syncapi
 	req.reqRooms.Range(func(key, value interface{}) bool {
 		roomID := key.(string)
 		reqRoom := value.(*syncapitypes.SyncRoom)
-		instance := common.GetSyncInstance(roomID, sm.cfg.MultiInstance.SyncServerTotal)
+		instance := sm.shardRing.Owner(roomID)
 		var request *syncapitypes.SyncServerRequest
 		if data, ok := requestMap[instance]; ok {
 			request = data
@@ -394,7 +401,7 @@ func (sm *SyncMng) buildSyncData(ctx context.Context, req *request, res *syncapi
 	})
 
 	for _, roomID := range req.joinRooms {
-		instance := common.GetSyncInstance(roomID, sm.cfg.MultiInstance.SyncServerTotal)
+		instance := sm.shardRing.Owner(roomID)
 		var request *syncapitypes.SyncServerRequest
 		if data, ok := requestMap[instance]; ok {
 			request = data
@@ -17,6 +17,7 @@ package syncaggregate
 import (
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/service"
@@ -45,6 +46,10 @@ func SetupSyncAggregateComponent(
 		syncMngChanNum = base.Cfg.SyncMngChanNum
 	}
 
+	// only tells the owners of the rooms, the instance is not a syncserver one
+	shardRing := syncshard.NewRing(base.Cfg, base.Cfg.MultiInstance.Instance)
+	shardRing.Watch(rpcClient)
+
 	monitor := mon.GetInstance()
 	queryHitCounter := monitor.NewLabeledCounter("syncaggreate_query_hit", []string{"target", "repo", "func"})
 
@@ -146,10 +151,16 @@ func SetupSyncAggregateComponent(
 	}
 
 	unReadRpcConsumer := rpc.NewUnReadRpcConsumer(rpcClient, userTimeLine, base.Cfg)
+	unReadRpcConsumer.SetShardRing(shardRing)
 	if err := unReadRpcConsumer.Start(); err != nil {
 		log.Panicf("failed to start sync unread rpc consumer err:%v", err)
 	}
 
+	purgeRpcConsumer := rpc.NewRoomHistoryPurgeRpcConsumer(rpcClient, userTimeLine)
+	if err := purgeRpcConsumer.Start(); err != nil {
+		log.Panicf("failed to start sync aggregate room history purge rpc consumer err:%v", err)
+	}
+
 	presenceRpcConsumer := rpc.NewPresenceRpcConsumer(rpcClient, onlineRepo, presenceStreamRepo, base.Cfg)
 	if err := presenceRpcConsumer.Start(); err != nil {
 		log.Panicf("failed to start sync presence rpc consumer err:%v", err)
@@ -157,6 +168,7 @@ func SetupSyncAggregateComponent(
 
 	syncMng := sync.NewSyncMng(syncDB, syncMngChanNum, 1024, base.Cfg, rpcClient)
 	syncMng.SetCache(cacheIn)
+	syncMng.SetShardRing(shardRing)
 	syncMng.SetComplexCache(complexCache)
 	syncMng.SetOnlineRepo(onlineRepo)
 	syncMng.SetUserTimeLine(userTimeLine)
@@ -174,5 +186,6 @@ func SetupSyncAggregateComponent(
 	}
 
 	apiConsumer := api.NewInternalMsgConsumer(*base.Cfg, rpcClient, idg, syncMng, userTimeLine, kcRepo, stdEventStreamRepo, syncDB, cacheIn)
+	apiConsumer.SetShardRing(shardRing)
 	apiConsumer.Start()
 }
@@ -18,6 +18,7 @@ import (
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/apiconsumer"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/service"
@@ -39,6 +40,7 @@ type InternalMsgConsumer struct {
 	receiptConsumer *consumers.ReceiptConsumer
 	settings        *common.Settings
 	cache           service.Cache
+	shardRing       *syncshard.Ring
 }
 
 func NewInternalMsgConsumer(
@@ -69,6 +71,10 @@ func NewInternalMsgConsumer(
 	return c
 }
 
+func (c *InternalMsgConsumer) SetShardRing(shardRing *syncshard.Ring) {
+	c.shardRing = shardRing
+}
+
 func (c *InternalMsgConsumer) Start() {
 	c.APIConsumer.Init("syncapi", c, c.Cfg.Rpc.ProxySyncApiTopic)
 	//c.APIConsumer.InitGroup("syncapi",c,c.Cfg.Rpc.ProxySyncApiTopic,types.SYNC_API_GROUP)
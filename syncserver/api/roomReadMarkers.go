@@ -65,7 +65,7 @@ func (ReqPostRoomReadMarkers) NewResponse(code int) core.Coder {
 func (ReqPostRoomReadMarkers) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
 	c := consumer.(*InternalMsgConsumer)
 	req := msg.(*external.PostRoomReadMarkersRequest)
-	if !common.IsRelatedRequest(req.RoomID, c.Cfg.MultiInstance.Instance, c.Cfg.MultiInstance.Total, c.Cfg.MultiInstance.MultiWrite) {
+	if !c.shardRing.Serves(req.RoomID) {
 		return internals.HTTP_RESP_DISCARD, jsonerror.MsgDiscard("msg discard")
 	}
 	data := &types.ReceiptContent{
@@ -16,7 +16,6 @@ package api
 
 import (
 	"context"
-	"github.com/finogeeks/ligase/common"
 	"net/http"
 
 	"github.com/finogeeks/ligase/common/apiconsumer"
@@ -62,7 +61,7 @@ func (ReqGetRoomState) NewResponse(code int) core.Coder {
 func (ReqGetRoomState) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
 	c := consumer.(*InternalMsgConsumer)
 	req := msg.(*external.GetRoomStateRequest)
-	if !common.IsRelatedRequest(req.RoomID, c.Cfg.MultiInstance.Instance, c.Cfg.MultiInstance.Total, c.Cfg.MultiInstance.MultiWrite) {
+	if !c.shardRing.Serves(req.RoomID) {
 		return internals.HTTP_RESP_DISCARD, jsonerror.MsgDiscard("msg discard")
 	}
 
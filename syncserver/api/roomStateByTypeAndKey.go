@@ -16,7 +16,6 @@ package api
 
 import (
 	"context"
-	"github.com/finogeeks/ligase/common"
 	"net/http"
 
 	"github.com/finogeeks/ligase/common/apiconsumer"
@@ -65,7 +64,7 @@ func (ReqGetRoomStateByTypeAndKey) NewResponse(code int) core.Coder {
 func (ReqGetRoomStateByTypeAndKey) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
 	c := consumer.(*InternalMsgConsumer)
 	req := msg.(*external.GetRoomStateByTypeAndStateKeyRequest)
-	if !common.IsRelatedRequest(req.RoomID, c.Cfg.MultiInstance.Instance, c.Cfg.MultiInstance.Total, c.Cfg.MultiInstance.MultiWrite) {
+	if !c.shardRing.Serves(req.RoomID) {
 		return internals.HTTP_RESP_DISCARD, jsonerror.MsgDiscard("msg discard")
 	}
 
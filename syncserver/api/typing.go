@@ -68,7 +68,7 @@ func (ReqPutTyping) NewResponse(code int) core.Coder {
 func (ReqPutTyping) Process(ctx context.Context, consumer interface{}, msg core.Coder, device *authtypes.Device) (int, core.Coder) {
 	c := consumer.(*InternalMsgConsumer)
 	req := msg.(*external.PutRoomUserTypingRequest)
-	if !common.IsRelatedRequest(req.RoomID, c.Cfg.MultiInstance.Instance, c.Cfg.MultiInstance.Total, c.Cfg.MultiInstance.MultiWrite) {
+	if !c.shardRing.Serves(req.RoomID) {
 		return internals.HTTP_RESP_DISCARD, jsonerror.MsgDiscard("msg discard")
 	}
 
@@ -93,7 +93,7 @@ func (ReqPutTyping) Process(ctx context.Context, consumer interface{}, msg core.
 		state.GetJoinMap().Range(func(key, value interface{}) bool {
 			update.RoomUsers = append(update.RoomUsers, key.(string))
 			domain, _ := common.DomainFromID(key.(string))
-			if common.CheckValidDomain(domain, c.Cfg.Matrix.ServerName) == false {
+			if common.IsLocalDomain(domain) == false {
 				domainMap[domain] = true
 			}
 			return true
@@ -107,7 +107,7 @@ func (ReqPutTyping) Process(ctx context.Context, consumer interface{}, msg core.
 		}
 
 		senderDomain, _ := common.DomainFromID(data.UserID)
-		if common.CheckValidDomain(senderDomain, c.Cfg.Matrix.ServerName) {
+		if common.IsLocalDomain(senderDomain) {
 			content, _ := json.Marshal(data)
 			for domain := range domainMap {
 				edu := gomatrixserverlib.EDU{
@@ -33,6 +33,7 @@ import (
 
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/core"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/service/roomserverapi"
@@ -57,6 +58,7 @@ type RoomEventFeedConsumer struct {
 	displayNameRepo       *repos.DisplayNameRepo
 	pushConsumer          *PushConsumer
 	cfg                   *config.Dendrite
+	shardRing             *syncshard.Ring
 	rpcClient             *common.RpcClient
 	chanSize              uint32
 	//msgChan               []chan roomserverapi.OutputEvent
@@ -94,6 +96,11 @@ func NewRoomEventFeedConsumer(
 	return nil
 }
 
+func (s *RoomEventFeedConsumer) SetShardRing(shardRing *syncshard.Ring) *RoomEventFeedConsumer {
+	s.shardRing = shardRing
+	return s
+}
+
 func (s *RoomEventFeedConsumer) SetReceiptRepo(receiptDataStreamRepo *repos.ReceiptDataStreamRepo) *RoomEventFeedConsumer {
 	s.receiptDataStreamRepo = receiptDataStreamRepo
 	return s
@@ -154,14 +161,14 @@ func (s *RoomEventFeedConsumer) OnMessage(ctx context.Context, topic string, par
 
 	switch output.Type {
 	case roomserverapi.OutputTypeNewRoomEvent:
-		if common.IsRelatedRequest(output.NewRoomEvent.Event.RoomID, s.cfg.MultiInstance.Instance, s.cfg.MultiInstance.Total, s.cfg.MultiInstance.MultiWrite) {
+		if s.shardRing.IsRelated(output.NewRoomEvent.Event.RoomID) {
 			bytes, _ := json.Marshal(output.NewRoomEvent.Event)
 			log.Infow("sync server received event from room server", log.KeysAndValues{"type", output.NewRoomEvent.Event.Type, "event_id", output.NewRoomEvent.Event.EventID, "room_id", output.NewRoomEvent.Event.RoomID, "instance", s.cfg.MultiInstance.Instance, "data", string(bytes)})
 			idx := common.CalcStringHashCode(output.NewRoomEvent.Event.RoomID) % s.chanSize
 			s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: output}
 		}
 	case roomserverapi.OutputBackfillRoomEvent:
-		if common.IsRelatedRequest(output.NewRoomEvent.Event.RoomID, s.cfg.MultiInstance.Instance, s.cfg.MultiInstance.Total, s.cfg.MultiInstance.MultiWrite) {
+		if s.shardRing.IsRelated(output.NewRoomEvent.Event.RoomID) {
 			log.Infow("sync writer received back fill event from room server", log.KeysAndValues{"type", output.NewRoomEvent.Event.Type, "event_id", output.NewRoomEvent.Event.EventID, "room_id", output.NewRoomEvent.Event.RoomID})
 			idx := common.CalcStringHashCode(output.NewRoomEvent.Event.RoomID) % s.chanSize
 			s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: output}
@@ -600,11 +607,11 @@ func (s *RoomEventFeedConsumer) onNewRoomEvent(
 				senderDomain, _ := common.DomainFromID(*ev.StateKey)
 				rs := s.roomCurState.GetRoomState(ev.RoomID)
 				if rs != nil {
-					if common.CheckValidDomain(senderDomain, s.cfg.Matrix.ServerName) {
+					if common.IsLocalDomain(senderDomain) {
 						domainMap := make(map[string]bool)
 						rs.GetJoinMap().Range(func(key, value interface{}) bool {
 							domain, _ := common.DomainFromID(key.(string))
-							if common.CheckValidDomain(domain, s.cfg.Matrix.ServerName) == false {
+							if common.IsLocalDomain(domain) == false {
 								domainMap[domain] = true
 							}
 							return true
@@ -648,7 +655,7 @@ func (s *RoomEventFeedConsumer) onNewRoomEvent(
 					} else {
 						rs.GetJoinMap().Range(func(key, value interface{}) bool {
 							domain, _ := common.DomainFromID(key.(string))
-							if common.CheckValidDomain(domain, s.cfg.Matrix.ServerName) {
+							if common.IsLocalDomain(domain) {
 								fedProfile := types.ProfileContent{
 									UserID: key.(string),
 								}
@@ -374,7 +374,7 @@ func (s *PushConsumer) pubPushContents(ctx context.Context, pushContents *push.P
 	bytes, err := json.Marshal(pushContents)
 	if err == nil {
 		log.Infof("EventDataConsumer.pubPushContents %s", string(bytes))
-		s.rpcClient.Pub(s.pubTopic, bytes)
+		s.rpcClient.PubWithContext(ctx, s.pubTopic, bytes)
 	} else {
 		log.Errorf("EventDataConsumer.pubPushContents marsh err %v", err)
 	}
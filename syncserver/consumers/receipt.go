@@ -186,14 +186,14 @@ func (s *ReceiptConsumer) OnReceipt(ctx context.Context, req *types.ReceiptConte
 			domainMap := make(map[string]bool)
 			s.roomCurState.GetRoomState(req.RoomID).GetJoinMap().Range(func(key, value interface{}) bool {
 				domain, _ := common.DomainFromID(key.(string))
-				if common.CheckValidDomain(domain, s.cfg.Matrix.ServerName) == false {
+				if common.IsLocalDomain(domain) == false {
 					domainMap[domain] = true
 				}
 				return true
 			})
 
 			senderDomain, _ := common.DomainFromID(req.UserID)
-			if common.CheckValidDomain(senderDomain, s.cfg.Matrix.ServerName) {
+			if common.IsLocalDomain(senderDomain) {
 				content, _ := json.Marshal(req)
 				for domain := range domainMap {
 					edu := gomatrixserverlib.EDU{
@@ -0,0 +1,62 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+
+	"github.com/finogeeks/ligase/common"
+	"github.com/finogeeks/ligase/model/repos"
+	"github.com/finogeeks/ligase/model/types"
+	"github.com/finogeeks/ligase/skunkworks/log"
+	"github.com/nats-io/go-nats"
+)
+
+// RoomHistoryPurgeRpcConsumer drops the cached timeline of rooms whose
+// history was purged, by an admin or by their retention policy. Every sync
+// server instance subscribes, each one caches the rooms it served.
+type RoomHistoryPurgeRpcConsumer struct {
+	rpcClient   *common.RpcClient
+	roomHistory *repos.RoomHistoryTimeLineRepo
+}
+
+func NewRoomHistoryPurgeRpcConsumer(
+	rpcClient *common.RpcClient,
+	roomHistory *repos.RoomHistoryTimeLineRepo,
+) *RoomHistoryPurgeRpcConsumer {
+	return &RoomHistoryPurgeRpcConsumer{
+		rpcClient:   rpcClient,
+		roomHistory: roomHistory,
+	}
+}
+
+func (s *RoomHistoryPurgeRpcConsumer) GetTopic() string {
+	return types.RoomHistoryPurgeTopicDef
+}
+
+func (s *RoomHistoryPurgeRpcConsumer) cb(ctx context.Context, msg *nats.Msg) {
+	var result types.RoomHistoryPurgeContent
+	if err := json.Unmarshal(msg.Data, &result); err != nil {
+		log.Errorf("rpc room history purge cb error %v", err)
+		return
+	}
+	log.Infof("evict room history timeline room:%s", result.RoomID)
+	s.roomHistory.Evict(result.RoomID)
+}
+
+func (s *RoomHistoryPurgeRpcConsumer) Start() error {
+	s.rpcClient.ReplyWithContext(s.GetTopic(), s.cb)
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/model/types"
 	"github.com/finogeeks/ligase/skunkworks/log"
 	"github.com/finogeeks/ligase/syncserver/consumers"
@@ -29,8 +30,9 @@ type ReceiptRpcConsumer struct {
 	receiptConsumer *consumers.ReceiptConsumer
 	chanSize        uint32
 	//msgChan         []chan *types.ReceiptContent
-	msgChan []chan common.ContextMsg
-	cfg     *config.Dendrite
+	msgChan   []chan common.ContextMsg
+	cfg       *config.Dendrite
+	shardRing *syncshard.Ring
 }
 
 func NewReceiptRpcConsumer(
@@ -48,6 +50,11 @@ func NewReceiptRpcConsumer(
 	return s
 }
 
+func (s *ReceiptRpcConsumer) SetShardRing(shardRing *syncshard.Ring) *ReceiptRpcConsumer {
+	s.shardRing = shardRing
+	return s
+}
+
 func (s *ReceiptRpcConsumer) GetCB() common.MsgHandlerWithContext {
 	return s.cb
 }
@@ -65,7 +72,7 @@ func (s *ReceiptRpcConsumer) cb(ctx context.Context, msg *nats.Msg) {
 		log.Errorf("rpc receipt cb error %v", err)
 		return
 	}
-	if common.IsRelatedRequest(result.RoomID, s.cfg.MultiInstance.Instance, s.cfg.MultiInstance.Total, s.cfg.MultiInstance.MultiWrite) {
+	if s.shardRing.IsRelated(result.RoomID) {
 		idx := common.CalcStringHashCode(result.RoomID) % s.chanSize
 		s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: &result}
 	}
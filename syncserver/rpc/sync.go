@@ -18,6 +18,7 @@ import (
 	"context"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/syncapitypes"
 	"github.com/finogeeks/ligase/model/types"
@@ -34,6 +35,7 @@ type SyncServerRpcConsumer struct {
 	msgChan    []chan common.ContextMsg
 	syncServer *consumers.SyncServer
 	cfg        *config.Dendrite
+	shardRing  *syncshard.Ring
 }
 
 func NewSyncServerRpcConsumer(
@@ -51,6 +53,11 @@ func NewSyncServerRpcConsumer(
 	return s
 }
 
+func (s *SyncServerRpcConsumer) SetShardRing(shardRing *syncshard.Ring) *SyncServerRpcConsumer {
+	s.shardRing = shardRing
+	return s
+}
+
 func (s *SyncServerRpcConsumer) SetRoomHistory(roomHistory *repos.RoomHistoryTimeLineRepo) *SyncServerRpcConsumer {
 	s.roomHistory = roomHistory
 	return s
@@ -73,7 +80,7 @@ func (s *SyncServerRpcConsumer) cb(ctx context.Context, msg *nats.Msg) {
 		log.Errorf("rpc sync cb error %v", err)
 		return
 	}
-	if common.IsRelatedSyncRequest(result.SyncInstance, s.cfg.MultiInstance.Instance, s.cfg.MultiInstance.Total, s.cfg.MultiInstance.MultiWrite) {
+	if s.shardRing.IsRelatedSyncRequest(result.SyncInstance) {
 		log.Infof("traceid:%s is related sync req instance:%d,server instance:%d,server total:%d userid:%s deviceid:%s", result.TraceID, result.SyncInstance, s.cfg.MultiInstance.Instance, s.cfg.MultiInstance.Total, result.UserID, result.DeviceID)
 		result.Reply = msg.Reply
 		idx := common.CalcStringHashCode(result.UserID) % s.chanSize
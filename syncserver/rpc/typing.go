@@ -18,6 +18,7 @@ import (
 	"context"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/syncapitypes"
 	"github.com/finogeeks/ligase/model/types"
@@ -34,8 +35,9 @@ type TypingRpcConsumer struct {
 	rpcClient    *common.RpcClient
 	chanSize     uint32
 	//msgChan      []chan *types.TypingContent
-	msgChan []chan common.ContextMsg
-	cfg     *config.Dendrite
+	msgChan   []chan common.ContextMsg
+	cfg       *config.Dendrite
+	shardRing *syncshard.Ring
 }
 
 func NewTypingRpcConsumer(
@@ -53,6 +55,11 @@ func NewTypingRpcConsumer(
 	return s
 }
 
+func (s *TypingRpcConsumer) SetShardRing(shardRing *syncshard.Ring) *TypingRpcConsumer {
+	s.shardRing = shardRing
+	return s
+}
+
 func (s *TypingRpcConsumer) GetCB() common.MsgHandlerWithContext {
 	return s.cb
 }
@@ -70,7 +77,7 @@ func (s *TypingRpcConsumer) cb(ctx context.Context, msg *nats.Msg) {
 		log.Errorf("rpc typing cb error %v", err)
 		return
 	}
-	if common.IsRelatedRequest(result.RoomID, s.cfg.MultiInstance.Instance, s.cfg.MultiInstance.Total, s.cfg.MultiInstance.MultiWrite) {
+	if s.shardRing.IsRelated(result.RoomID) {
 		idx := common.CalcStringHashCode(result.RoomID) % s.chanSize
 		s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: &result}
 	}
@@ -90,7 +97,7 @@ func (s *TypingRpcConsumer) startWorker(msgChan chan common.ContextMsg) {
 			state.GetJoinMap().Range(func(key, value interface{}) bool {
 				update.RoomUsers = append(update.RoomUsers, key.(string))
 				domain, _ := common.DomainFromID(key.(string))
-				if common.CheckValidDomain(domain, s.cfg.Matrix.ServerName) == false {
+				if common.IsLocalDomain(domain) == false {
 					domainMap[domain] = true
 				}
 				return true
@@ -104,7 +111,7 @@ func (s *TypingRpcConsumer) startWorker(msgChan chan common.ContextMsg) {
 			}
 
 			senderDomain, _ := common.DomainFromID(data.UserID)
-			if common.CheckValidDomain(senderDomain, s.cfg.Matrix.ServerName) {
+			if common.IsLocalDomain(senderDomain) {
 				content, _ := json.Marshal(data)
 				for domain := range domainMap {
 					edu := gomatrixserverlib.EDU{
@@ -18,6 +18,7 @@ import (
 	"context"
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/syncapitypes"
 	"github.com/finogeeks/ligase/model/types"
@@ -32,6 +33,7 @@ type SyncUnreadRpcConsumer struct {
 	msgChan       []chan common.ContextMsg
 	readCountRepo *repos.ReadCountRepo
 	cfg           *config.Dendrite
+	shardRing     *syncshard.Ring
 }
 
 func NewSyncUnreadRpcConsumer(
@@ -49,6 +51,11 @@ func NewSyncUnreadRpcConsumer(
 	return s
 }
 
+func (s *SyncUnreadRpcConsumer) SetShardRing(shardRing *syncshard.Ring) *SyncUnreadRpcConsumer {
+	s.shardRing = shardRing
+	return s
+}
+
 func (s *SyncUnreadRpcConsumer) GetCB() common.MsgHandlerWithContext {
 	return s.cb
 }
@@ -66,7 +73,7 @@ func (s *SyncUnreadRpcConsumer) cb(ctx context.Context, msg *nats.Msg) {
 		log.Errorf("rpc unread cb error %v", err)
 		return
 	}
-	if common.IsRelatedSyncRequest(result.SyncInstance, s.cfg.MultiInstance.Instance, s.cfg.MultiInstance.Total, s.cfg.MultiInstance.MultiWrite) {
+	if s.shardRing.IsRelatedSyncRequest(result.SyncInstance) {
 		result.Reply = msg.Reply
 		idx := common.CalcStringHashCode(result.UserID) % s.chanSize
 		s.msgChan[idx] <- common.ContextMsg{Ctx: ctx, Msg: &result}
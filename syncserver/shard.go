@@ -0,0 +1,81 @@
+// Copyright (C) 2020 Finogeeks Co., Ltd
+//
+// This program is free software: you can redistribute it and/or  modify
+// it under the terms of the GNU Affero General Public License, version 3,
+// as published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package syncserver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/finogeeks/ligase/model/repos"
+	"github.com/finogeeks/ligase/skunkworks/log"
+)
+
+const preloadWorkers = 16
+
+// roomPreloader loads the rooms handed off to the syncserver into its repos
+type roomPreloader struct {
+	roomHistory *repos.RoomHistoryTimeLineRepo
+	rsTimeline  *repos.RoomStateTimeLineRepo
+	receiptRepo *repos.ReceiptDataStreamRepo
+}
+
+func (p *roomPreloader) LoadedRooms() []string {
+	return p.roomHistory.LoadedRooms()
+}
+
+func (p *roomPreloader) Preload(ctx context.Context, roomIDs []string) {
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < preloadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for roomID := range work {
+				p.rsTimeline.LoadStates(ctx, roomID, true)
+				p.rsTimeline.LoadStreamStates(ctx, roomID, true)
+				p.roomHistory.LoadHistory(ctx, roomID, true)
+				p.roomHistory.GetRoomMinStream(ctx, roomID)
+				p.receiptRepo.LoadHistory(ctx, roomID, true)
+			}
+		}()
+	}
+
+	count := 0
+loop:
+	for _, roomID := range roomIDs {
+		select {
+		case work <- roomID:
+			count++
+		case <-ctx.Done():
+			// the rest is loaded on the first sync
+			log.Warnf("syncserver preload timeout, loaded %d of %d rooms", count, len(roomIDs))
+			break loop
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+func (p *roomPreloader) Release(roomIDs []string) {
+	for _, roomID := range roomIDs {
+		if !p.receiptRepo.Evict(roomID) {
+			// keep the room until its receipts are flushed, a later
+			// release drops it
+			continue
+		}
+		p.roomHistory.Evict(roomID)
+		p.rsTimeline.Evict(roomID)
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/basecomponent"
+	"github.com/finogeeks/ligase/common/syncshard"
 	"github.com/finogeeks/ligase/common/uid"
 	"github.com/finogeeks/ligase/model/repos"
 	"github.com/finogeeks/ligase/model/service"
@@ -89,6 +90,9 @@ func SetupSyncServerComponent(
 	userReceiptRepo.SetPersist(syncDB)
 	userReceiptRepo.SetMonitor(qureyHitCounter)
 
+	shardRing := syncshard.NewRing(base.Cfg, base.Cfg.MultiInstance.Instance)
+	shardRing.Watch(rpcClient)
+
 	settings := common.NewSettings(cacheIn)
 
 	settingConsumer := common.NewSettingConsumer(
@@ -115,6 +119,7 @@ func SetupSyncServerComponent(
 	feedServer.SetRsTimeline(rsTimeline)
 	feedServer.SetReceiptRepo(receiptDataStreamRepo)
 	feedServer.SetDisplayNameRepo(displayNameRepo)
+	feedServer.SetShardRing(shardRing)
 	if err := feedServer.Start(); err != nil {
 		log.Panicf("failed to start sync room server consumer err:%v", err)
 	}
@@ -149,28 +154,45 @@ func SetupSyncServerComponent(
 	syncServer.Start()
 
 	typingRpcConsumer := rpc.NewTypingRpcConsumer(rsCurState, rpcClient, base.Cfg)
+	typingRpcConsumer.SetShardRing(shardRing)
 	if err := typingRpcConsumer.Start(); err != nil {
 		log.Panicf("failed to start sync typing rpc consumer err:%v", err)
 	}
 
 	receiptRpcConsumer := rpc.NewReceiptRpcConsumer(receiptConsumer, rpcClient, base.Cfg)
+	receiptRpcConsumer.SetShardRing(shardRing)
 	if err := receiptRpcConsumer.Start(); err != nil {
 		log.Panicf("failed to start sync receipt rpc consumer err:%v", err)
 	}
 
 	syncServerRpcConsumer := rpc.NewSyncServerRpcConsumer(rpcClient, syncServer, base.Cfg)
+	syncServerRpcConsumer.SetShardRing(shardRing)
 	if err := syncServerRpcConsumer.Start(); err != nil {
 		log.Panicf("failed to start sync server rpc consumer err:%v", err)
 	}
 
 	syncUnreadRpcConsumer := rpc.NewSyncUnreadRpcConsumer(rpcClient, readCountRepo, base.Cfg)
+	syncUnreadRpcConsumer.SetShardRing(shardRing)
 	if err := syncUnreadRpcConsumer.Start(); err != nil {
 		log.Panicf("failed to start sync unread rpc consumer err:%v", err)
 	}
 
+	purgeRpcConsumer := rpc.NewRoomHistoryPurgeRpcConsumer(rpcClient, roomHistory)
+	if err := purgeRpcConsumer.Start(); err != nil {
+		log.Panicf("failed to start sync room history purge rpc consumer err:%v", err)
+	}
+
 	log.Infof("instance:%d,syncserver total:%d", base.Cfg.MultiInstance.Instance, base.Cfg.MultiInstance.SyncServerTotal)
 	apiConsumer := api.NewInternalMsgConsumer(*base.Cfg, rpcClient, idg, syncDB, rsCurState, rsTimeline, roomHistory, displayNameRepo, receiptConsumer, settings, cacheIn)
+	apiConsumer.SetShardRing(shardRing)
 	apiConsumer.Start()
+
+	preloader := &roomPreloader{
+		roomHistory: roomHistory,
+		rsTimeline:  rsTimeline,
+		receiptRepo: receiptDataStreamRepo,
+	}
+	syncshard.NewMember(shardRing, rpcClient, preloader).Start()
 }
 
 func FixSyncCorruptRooms(
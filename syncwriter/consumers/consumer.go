@@ -21,6 +21,7 @@ import (
 	"context"
 	jsonRaw "encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/finogeeks/ligase/common"
 	"github.com/finogeeks/ligase/common/config"
@@ -204,6 +205,8 @@ func (s *RoomEventConsumer) processRedactEv(ctx context.Context, ev *gomatrixser
 		}
 	}
 
+	s.keepLegalHoldOriginal(ctx, &redactEv)
+
 	unsigned := types.RedactUnsigned{}
 	if ev.Type == "m.room.redaction" {
 		reaction := s.parseRelatesContent(redactEv)
@@ -237,6 +240,22 @@ func (s *RoomEventConsumer) processRedactEv(ctx context.Context, ev *gomatrixser
 	}
 }
 
+// keepLegalHoldOriginal saves the event before a redaction or an edit
+// overwrites it, if its room or its sender is under legal hold
+func (s *RoomEventConsumer) keepLegalHoldOriginal(ctx context.Context, ev *gomatrixserverlib.ClientEvent) {
+	held, err := s.db.GetLegalHoldTargets(ctx, []string{ev.RoomID, ev.Sender})
+	if err != nil {
+		log.Errorf("processRedactEv check legal hold of:%s err:%v", ev.EventID, err)
+		return
+	}
+	if len(held) == 0 {
+		return
+	}
+	if err := s.db.InsertLegalHoldEvent(ctx, ev, time.Now().UnixNano()/1000000); err != nil {
+		log.Errorf("processRedactEv keep legal hold original of:%s err:%v", ev.EventID, err)
+	}
+}
+
 func (s *RoomEventConsumer) updateReactionEvent(ctx context.Context, roomID string, reaction *types.ReactionContent){
 	var originEv gomatrixserverlib.ClientEvent
 	stream := s.roomHistoryTimeLine.GetStreamEv(ctx, roomID, reaction.EventID)